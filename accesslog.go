@@ -0,0 +1,32 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"tls-agent/internal/accesslog"
+	"tls-agent/internal/features"
+	"tls-agent/internal/signals"
+)
+
+// buildAccessLog wraps handler with the access log when it is enabled. A
+// dedicated access log file is reopened on rotate_logs like the agent log.
+func buildAccessLog(cfg features.AccessLogConfig, handler http.Handler, registry *signals.Registry) (http.Handler, error) {
+	if !cfg.Enabled {
+		return handler, nil
+	}
+	logger := &accesslog.Logger{SampleRate: cfg.SampleRate, ErrorsOnly: cfg.ErrorsOnly}
+	if cfg.Path != "" {
+		out := &reopenableFile{}
+		if err := out.Open(cfg.Path); err != nil {
+			return nil, err
+		}
+		registry.Subscribe(signals.ActionRotateLogs, func() {
+			if err := out.Reopen(); err != nil {
+				log.Println("Failed to reopen access log:", err)
+			}
+		})
+		logger.Out = out
+	}
+	return logger.Middleware(handler), nil
+}
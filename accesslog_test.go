@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"tls-agent/internal/accesslog"
+	"tls-agent/internal/features"
+	"tls-agent/internal/signals"
+)
+
+// TestBuildAccessLog tests writing the access log to a rotated file
+func TestBuildAccessLog(t *testing.T) {
+	registry, err := signals.New(nil)
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	path := filepath.Join(t.TempDir(), "access.log")
+
+	handler, err := buildAccessLog(features.AccessLogConfig{Enabled: true, Path: path, SampleRate: 1}, next, registry)
+	if err != nil {
+		t.Fatalf("Failed to build access log: %v", err)
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/first", nil))
+
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatalf("Failed to rotate: %v", err)
+	}
+	registry.Dispatch(signals.ActionRotateLogs)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/second", nil))
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read access log: %v", err)
+	}
+	var e accesslog.Entry
+	if err := json.Unmarshal(data, &e); err != nil || e.Path != "/second" {
+		t.Errorf("Expected the reopened log to hold /second, got %q (%v)", data, err)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"tls-agent/internal/acme"
+	"tls-agent/internal/features"
+	"tls-agent/internal/storage"
+)
+
+// buildIssuer returns the ACME issuer writing to certFile and keyFile. The
+// account key lives in the "acme" namespace of cache, or next to the
+// certificate when no storage is configured.
+func buildIssuer(cfg features.ACMEConfig, certFile, keyFile string, cache storage.Storage) (*acme.Issuer, error) {
+	provider, err := dnsProvider(cfg.DNS)
+	if err != nil {
+		return nil, err
+	}
+	state := namespace(cache, "acme")
+	if state == nil {
+		state = &storage.FS{Dir: filepath.Join(filepath.Dir(certFile), ".acme")}
+	}
+
+	acmeCfg := acme.Config{
+		DirectoryURL: cfg.DirectoryURL,
+		EABKeyID:     cfg.EABKeyID,
+		Email:        cfg.Email,
+		Domains:      cfg.Domains,
+		CertFile:     certFile,
+		KeyFile:      keyFile,
+		RenewBefore:  time.Duration(cfg.RenewBeforeDays) * 24 * time.Hour,
+		Provider:     provider,
+		Propagation:  time.Duration(cfg.DNS.PropagationTimeout) * time.Second,
+		Storage:      state,
+	}
+	if cfg.CABundle != "" {
+		if acmeCfg.RootCAs, err = loadCertPool(cfg.CABundle); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.EABHMACKeyFile != "" {
+		encoded, err := readSecret(cfg.EABHMACKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		// CAs hand out the key base64url encoded, some with padding
+		if acmeCfg.EABKey, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "=")); err != nil {
+			return nil, fmt.Errorf("acme: EAB HMAC key in %s: %w", cfg.EABHMACKeyFile, err)
+		}
+	}
+	return acme.New(acmeCfg)
+}
+
+// dnsProvider builds the configured DNS-01 provider
+func dnsProvider(cfg features.ACMEDNSConfig) (acme.Provider, error) {
+	switch cfg.Provider {
+	case features.DNSCloudflare:
+		token, err := readSecret(cfg.APITokenFile)
+		if err != nil {
+			return nil, err
+		}
+		return &acme.Cloudflare{Token: token, ZoneID: cfg.ZoneID}, nil
+	case features.DNSRoute53:
+		return &acme.Route53{
+			HostedZoneID:    cfg.HostedZoneID,
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}, nil
+	case features.DNSRFC2136:
+		provider := &acme.RFC2136{
+			Nameserver:    cfg.Nameserver,
+			Zone:          cfg.Zone,
+			TSIGKey:       cfg.TSIGKey,
+			TSIGAlgorithm: cfg.TSIGAlgorithm,
+		}
+		if cfg.TSIGSecretFile != "" {
+			secret, err := readSecret(cfg.TSIGSecretFile)
+			if err != nil {
+				return nil, err
+			}
+			provider.TSIGSecret = secret
+		}
+		return provider, nil
+	case features.DNSExec:
+		return &acme.Exec{Command: cfg.Command}, nil
+	default:
+		return nil, fmt.Errorf("unknown ACME DNS provider %q", cfg.Provider)
+	}
+}
+
+// readSecret reads a credential file, ignoring surrounding whitespace
+func readSecret(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
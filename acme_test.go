@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"tls-agent/internal/acme"
+	"tls-agent/internal/features"
+)
+
+// TestDNSProvider tests building DNS providers from configuration
+func TestDNSProvider(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	if err := os.WriteFile(tokenFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatalf("Failed to write token: %v", err)
+	}
+
+	p, err := dnsProvider(features.ACMEDNSConfig{Provider: features.DNSCloudflare, ZoneID: "zone", APITokenFile: tokenFile})
+	if err != nil {
+		t.Fatalf("Failed to build cloudflare provider: %v", err)
+	}
+	if cf, ok := p.(*acme.Cloudflare); !ok || cf.Token != "secret" || cf.ZoneID != "zone" {
+		t.Errorf("Unexpected cloudflare provider: %+v", p)
+	}
+
+	p, err = dnsProvider(features.ACMEDNSConfig{Provider: features.DNSRFC2136, Nameserver: "ns1:53", Zone: "example.com", TSIGKey: "acme", TSIGSecretFile: tokenFile})
+	if err != nil {
+		t.Fatalf("Failed to build rfc2136 provider: %v", err)
+	}
+	if r, ok := p.(*acme.RFC2136); !ok || r.TSIGSecret != "secret" {
+		t.Errorf("Unexpected rfc2136 provider: %+v", p)
+	}
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	p, err = dnsProvider(features.ACMEDNSConfig{Provider: features.DNSRoute53, HostedZoneID: "Z123"})
+	if r, ok := p.(*acme.Route53); err != nil || !ok || r.AccessKeyID != "AKID" {
+		t.Errorf("Unexpected route53 provider: %+v, %v", p, err)
+	}
+
+	if _, err := dnsProvider(features.ACMEDNSConfig{Provider: features.DNSCloudflare, APITokenFile: filepath.Join(dir, "missing")}); err == nil {
+		t.Error("Expected an error for a missing token file")
+	}
+	if _, err := dnsProvider(features.ACMEDNSConfig{Provider: "godaddy"}); err == nil {
+		t.Error("Expected an error for an unknown provider")
+	}
+}
+
+// TestBuildIssuer tests issuer construction without configured storage
+func TestBuildIssuer(t *testing.T) {
+	dir := t.TempDir()
+	cfg := features.DefaultACMEConfig()
+	cfg.Domains = []string{"example.com"}
+	cfg.DNS = features.ACMEDNSConfig{Provider: features.DNSExec, Command: []string{"true"}}
+
+	issuer, err := buildIssuer(cfg, filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), nil)
+	if err != nil {
+		t.Fatalf("Failed to build issuer: %v", err)
+	}
+	if reason := issuer.NeedsRenewal(); reason != "no certificate" {
+		t.Errorf("Expected a missing certificate to need issuance, got %q", reason)
+	}
+}
+
+// TestBuildIssuerEAB tests loading external account binding credentials
+func TestBuildIssuerEAB(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "eab")
+	if err := os.WriteFile(keyFile, []byte("aG1hYy1rZXk\n"), 0600); err != nil {
+		t.Fatalf("Failed to write EAB key: %v", err)
+	}
+	cfg := features.DefaultACMEConfig()
+	cfg.DirectoryURL = "zerossl"
+	cfg.Domains = []string{"example.com"}
+	cfg.DNS = features.ACMEDNSConfig{Provider: features.DNSExec, Command: []string{"true"}}
+	cfg.EABKeyID = "kid"
+	cfg.EABHMACKeyFile = keyFile
+
+	if _, err := buildIssuer(cfg, filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), nil); err != nil {
+		t.Fatalf("Failed to build issuer with EAB: %v", err)
+	}
+
+	if err := os.WriteFile(keyFile, []byte("not base64!"), 0600); err != nil {
+		t.Fatalf("Failed to write EAB key: %v", err)
+	}
+	if _, err := buildIssuer(cfg, filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), nil); err == nil {
+		t.Error("Expected an error for a malformed EAB key")
+	}
+
+	cfg.EABHMACKeyFile = ""
+	cfg.CABundle = filepath.Join(dir, "missing.pem")
+	if _, err := buildIssuer(cfg, filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), nil); err == nil {
+		t.Error("Expected an error for a missing CA bundle")
+	}
+}
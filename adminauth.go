@@ -0,0 +1,144 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"tls-agent/internal/admin"
+	"tls-agent/internal/features"
+	"tls-agent/internal/signals"
+	"tls-agent/internal/tlsconfig"
+	"tls-agent/internal/tlsstore"
+	"tls-agent/internal/watch"
+)
+
+// Environment variables read by the CLI commands that query the admin API
+const (
+	// adminTokenEnv holds the bearer token to send
+	adminTokenEnv = "TLS_AGENT_ADMIN_TOKEN"
+
+	// adminCAEnv names a PEM bundle to verify a TLS admin API against,
+	// instead of the system roots
+	adminCAEnv = "TLS_AGENT_ADMIN_CA"
+)
+
+// setupAdminTLS serves adminServer over TLS. A configured pair gives the
+// admin API its own identity, reloaded when its files change or on a
+// certificate reload signal; otherwise it serves the certificates in store.
+// A client CA, also reloaded, verifies client certificates. Key exchange
+// settings the admin listener leaves unset are inherited from listenerTLS.
+// With fips the listener is limited to FIPS-approved algorithms.
+func setupAdminTLS(adminServer *admin.Server, cfg features.AdminTLSConfig, listenerTLS features.ListenerTLSConfig, fips bool, store *tlsstore.Store, files *watch.Watcher, registry *signals.Registry) error {
+	tlsCfg := &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: store.GetCertificate}
+	curves, postQuantum := listenerTLS.KeyExchange(cfg.CurvePreferences, cfg.PostQuantum)
+	if err := tlsconfig.ApplyCurves(tlsCfg, "admin", curves, postQuantum); err != nil {
+		return err
+	}
+	if fips {
+		tlsconfig.ApplyFIPS(tlsCfg)
+	}
+
+	if cfg.CertFile != "" {
+		cert, err := tlsstore.Load(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return fmt.Errorf("admin certificate: %w", err)
+		}
+		adminStore := tlsstore.New(cert)
+		reload := func() {
+			cert, err := tlsstore.Load(cfg.CertFile, cfg.KeyFile)
+			if err != nil {
+				log.Printf("Admin TLS: reload of %s failed: %v", cfg.CertFile, err)
+				return
+			}
+			adminStore.Update(cert)
+			log.Println("Admin TLS: reloaded", cfg.CertFile)
+		}
+		if err := files.Add("admin certificate", reload, cfg.CertFile, cfg.KeyFile); err != nil {
+			return err
+		}
+		registry.Subscribe(signals.ActionReloadCerts, reload)
+		tlsCfg.GetCertificate = adminStore.GetCertificate
+	}
+
+	if cfg.ClientCA != "" {
+		roots, err := tlsstore.NewRootCAStore(cfg.ClientCA)
+		if err != nil {
+			return fmt.Errorf("admin client CA: %w", err)
+		}
+		if err := roots.Register(files, nil); err != nil {
+			return err
+		}
+		// Certificates are optional so token-only callers can connect;
+		// presented ones must verify
+		tlsCfg.ClientAuth = tls.RequestClientCert
+		tlsCfg.VerifyPeerCertificate = roots.VerifyClientCertificate
+	}
+	adminServer.SetTLSConfig(tlsCfg)
+	adminServer.SetConnState(tlsconfig.HandshakeMetrics("admin"))
+	return nil
+}
+
+// setupAdminAuth requires authentication on adminServer
+func setupAdminAuth(adminServer *admin.Server, cfg features.AdminAuthConfig) error {
+	auth := &admin.Auth{OperatorPaths: cfg.OperatorPaths, PublicPaths: cfg.PublicPaths}
+	for _, t := range cfg.Tokens {
+		secret, err := readSecret(t.TokenFile)
+		if err != nil {
+			return fmt.Errorf("admin token %s: %w", t.Name, err)
+		}
+		auth.Tokens = append(auth.Tokens, admin.Token{Name: t.Name, Secret: secret, Role: t.Role})
+	}
+	for _, c := range cfg.Clients {
+		auth.Clients = append(auth.Clients, admin.Client{Allow: c.Allow, Role: c.Role})
+	}
+	if err := auth.Validate(); err != nil {
+		return err
+	}
+	adminServer.SetAuth(auth)
+	return nil
+}
+
+// adminURL returns the base URL of the admin API described by cfg
+func adminURL(cfg features.Features) string {
+	if cfg.AdminTLS.Enabled {
+		return "https://" + cfg.AdminAddress
+	}
+	return "http://" + cfg.AdminAddress
+}
+
+// adminClient returns the client the CLI commands query the admin API with.
+// The token in TLS_AGENT_ADMIN_TOKEN, if set, is sent with every request, and
+// TLS_AGENT_ADMIN_CA, if set, replaces the system roots.
+func adminClient(timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport
+	if caFile := os.Getenv(adminCAEnv); caFile != "" {
+		roots := x509.NewCertPool()
+		if pem, err := os.ReadFile(caFile); err != nil || !roots.AppendCertsFromPEM(pem) {
+			log.Printf("Warning: no certificates loaded from %s=%s", adminCAEnv, caFile)
+		}
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12, RootCAs: roots}
+		transport = t
+	}
+	if token := os.Getenv(adminTokenEnv); token != "" {
+		transport = bearerTransport{token: token, next: transport}
+	}
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// bearerTransport adds a bearer token to requests
+type bearerTransport struct {
+	token string
+	next  http.RoundTripper
+}
+
+func (t bearerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set("Authorization", "Bearer "+t.token)
+	return t.next.RoundTrip(r)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"tls-agent/internal/admin"
+	"tls-agent/internal/features"
+	"tls-agent/internal/signals"
+	"tls-agent/internal/tlsstore"
+	"tls-agent/internal/watch"
+)
+
+// TestSetupAdminAuth tests token and client certificate authentication on
+// the admin API
+func TestSetupAdminAuth(t *testing.T) {
+	dir := t.TempDir()
+	serverCert, serverKey := writeTestPair(t, dir, "admin.test")
+	clientCert, clientKey := writeTestPair(t, dir, "oncall.ops.example")
+	tokenFile := filepath.Join(dir, "token")
+	if err := os.WriteFile(tokenFile, []byte("s3cret\n"), 0600); err != nil {
+		t.Fatalf("Failed to write token: %v", err)
+	}
+	cert, err := tls.LoadX509KeyPair(serverCert, serverKey)
+	if err != nil {
+		t.Fatalf("Failed to load pair: %v", err)
+	}
+	files, err := watch.New(0)
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+
+	registry, err := signals.New(nil)
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+
+	cfg := features.DefaultAdminAuthConfig()
+	cfg.Enabled = true
+	cfg.Tokens = []features.AdminTokenConfig{{Name: "ci", TokenFile: tokenFile, Role: admin.RoleReader}}
+	cfg.Clients = []features.AdminClientConfig{{Allow: []string{"dns:*.ops.example"}, Role: admin.RoleOperator}}
+
+	adminServer := admin.New("127.0.0.1:0")
+	adminServer.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {})
+	adminTLS := features.AdminTLSConfig{Enabled: true, ClientCA: clientCert}
+	if err := setupAdminTLS(adminServer, adminTLS, features.ListenerTLSConfig{}, false, tlsstore.New(&cert), files, registry); err != nil {
+		t.Fatalf("setupAdminTLS failed: %v", err)
+	}
+	if err := setupAdminAuth(adminServer, cfg); err != nil {
+		t.Fatalf("setupAdminAuth failed: %v", err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	go adminServer.Serve(ln)
+	defer adminServer.Close()
+
+	roots := x509.NewCertPool()
+	pem, _ := os.ReadFile(serverCert)
+	roots.AppendCertsFromPEM(pem)
+	url := "https://" + ln.Addr().String()
+	get := func(client *http.Client, method string) int {
+		req, _ := http.NewRequest(method, url+"/status", nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	transport := func(certs ...tls.Certificate) *http.Transport {
+		return &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, ServerName: "admin.test", Certificates: certs}}
+	}
+
+	if code := get(&http.Client{Transport: transport()}, http.MethodGet); code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without credentials, got %d", code)
+	}
+
+	t.Setenv(adminTokenEnv, "s3cret")
+	if bt, ok := adminClient(0).Transport.(bearerTransport); !ok || bt.token != "s3cret" {
+		t.Fatalf("Expected the CLI client to send %s", adminTokenEnv)
+	}
+	tokenClient := &http.Client{Transport: bearerTransport{token: "s3cret", next: transport()}}
+	if code := get(tokenClient, http.MethodGet); code != http.StatusOK {
+		t.Errorf("Expected the reader token to read, got %d", code)
+	}
+	if code := get(tokenClient, http.MethodPost); code != http.StatusForbidden {
+		t.Errorf("Expected the reader token to be refused a POST, got %d", code)
+	}
+
+	pair, err := tls.LoadX509KeyPair(clientCert, clientKey)
+	if err != nil {
+		t.Fatalf("Failed to load client pair: %v", err)
+	}
+	if code := get(&http.Client{Transport: transport(pair)}, http.MethodPost); code != http.StatusOK {
+		t.Errorf("Expected the operator certificate to POST, got %d", code)
+	}
+
+	bad := cfg
+	bad.Tokens = []features.AdminTokenConfig{{Name: "ci", TokenFile: tokenFile, Role: "root"}}
+	if err := setupAdminAuth(admin.New(""), bad); err == nil {
+		t.Error("Expected an unknown role to be rejected")
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+
+	"tls-agent/internal/admin"
+	"tls-agent/internal/features"
+	"tls-agent/internal/signals"
+	"tls-agent/internal/tlsstore"
+	"tls-agent/internal/watch"
+)
+
+// TestSetupAdminTLS tests that the admin API serves its own certificate,
+// separate from the public one, and reloads it
+func TestSetupAdminTLS(t *testing.T) {
+	dir := t.TempDir()
+	publicCert, publicKey := writeTestPair(t, dir, "public.test")
+	cert, err := tls.LoadX509KeyPair(publicCert, publicKey)
+	if err != nil {
+		t.Fatalf("Failed to load pair: %v", err)
+	}
+	adminCert, adminKey := writeTestPair(t, dir, "admin.internal")
+	files, err := watch.New(0)
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+	registry, err := signals.New(nil)
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+
+	cfg := features.AdminTLSConfig{Enabled: true, CertFile: adminCert, KeyFile: adminKey}
+	adminServer := admin.New("127.0.0.1:0")
+	adminServer.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {})
+	if err := setupAdminTLS(adminServer, cfg, features.ListenerTLSConfig{}, false, tlsstore.New(&cert), files, registry); err != nil {
+		t.Fatalf("setupAdminTLS failed: %v", err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	go adminServer.Serve(ln)
+	defer adminServer.Close()
+
+	served := func() string {
+		conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+		if err != nil {
+			t.Fatalf("Handshake failed: %v", err)
+		}
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+	}
+	if name := served(); name != "admin.internal" {
+		t.Fatalf("Expected the admin certificate, got %s", name)
+	}
+
+	// Overwrite the admin pair and reload it
+	renamed, renamedKey := writeTestPair(t, dir, "admin2.internal")
+	for src, dst := range map[string]string{renamed: adminCert, renamedKey: adminKey} {
+		data, err := os.ReadFile(src)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", src, err)
+		}
+		if err := os.WriteFile(dst, data, 0600); err != nil {
+			t.Fatalf("Failed to write %s: %v", dst, err)
+		}
+	}
+	registry.Dispatch(signals.ActionReloadCerts)
+	if name := served(); name != "admin2.internal" {
+		t.Errorf("Expected the reloaded admin certificate, got %s", name)
+	}
+
+	// The CLI trusts the admin CA named in the environment
+	t.Setenv(adminCAEnv, renamed)
+	resp, err := adminClient(0).Get(adminURL(features.Features{AdminAddress: ln.Addr().String(), AdminTLS: cfg}) + "/status")
+	if err == nil {
+		resp.Body.Close()
+		t.Error("Expected the certificate name not to match the address")
+	} else if hostErr := (x509.HostnameError{}); !errors.As(err, &hostErr) {
+		t.Errorf("Expected a hostname mismatch once the CA is trusted, got %v", err)
+	}
+
+	bad := cfg
+	bad.KeyFile = publicKey
+	if err := setupAdminTLS(admin.New(""), bad, features.ListenerTLSConfig{}, false, tlsstore.New(&cert), files, registry); err == nil {
+		t.Error("Expected a mismatched admin pair to be rejected")
+	}
+}
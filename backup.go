@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"tls-agent/internal/backup"
+	"tls-agent/internal/features"
+)
+
+// buildBackups returns the backup store, or nil when backups are disabled
+func buildBackups(cfg features.BackupConfig) *backup.Store {
+	if cfg.Dir == "" {
+		return nil
+	}
+	return &backup.Store{
+		Dir:    cfg.Dir,
+		Keep:   cfg.Keep,
+		MaxAge: time.Duration(cfg.MaxAgeDays) * 24 * time.Hour,
+	}
+}
+
+// runRestore implements `tls-agent restore [target [id]]`: without an ID it
+// lists the backups the running agent holds, with one it restores that
+// backup. It returns the exit code.
+func runRestore(adminURL string, args []string, out io.Writer) int {
+	client := adminClient(10 * time.Second)
+	base := adminURL + "/backups"
+
+	if len(args) >= 2 {
+		target := url.PathEscape(args[0])
+		resp, err := client.Post(base+"/"+target+"/"+url.PathEscape(args[1])+"/restore", "", nil)
+		if err != nil {
+			fmt.Fprintf(out, "Could not reach agent at %s: %v\n", adminURL, err)
+			return 1
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+			fmt.Fprintf(out, "Restore failed: %s\n", strings.TrimSpace(string(msg)))
+			return 1
+		}
+		fmt.Fprintf(out, "Restored %s from backup %s\n", args[0], args[1])
+		return 0
+	}
+
+	all := map[string][]backup.Snapshot{}
+	path := base
+	if len(args) == 1 {
+		path += "/" + url.PathEscape(args[0])
+	}
+	resp, err := client.Get(path)
+	if err != nil {
+		fmt.Fprintf(out, "Could not reach agent at %s: %v\n", adminURL, err)
+		return 1
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(out, "Listing backups failed: %s\n", resp.Status)
+		return 1
+	}
+
+	var decodeErr error
+	if len(args) == 1 {
+		var body struct {
+			Backups []backup.Snapshot `json:"backups"`
+		}
+		decodeErr = json.NewDecoder(resp.Body).Decode(&body)
+		all[args[0]] = body.Backups
+	} else {
+		var body struct {
+			Backups map[string][]backup.Snapshot `json:"backups"`
+		}
+		decodeErr = json.NewDecoder(resp.Body).Decode(&body)
+		all = body.Backups
+	}
+	if decodeErr != nil {
+		fmt.Fprintf(out, "Invalid response from agent: %v\n", decodeErr)
+		return 1
+	}
+
+	printBackups(out, all)
+	return 0
+}
+
+// printBackups formats backups as a table, by target and newest first
+func printBackups(out io.Writer, all map[string][]backup.Snapshot) {
+	targets := make([]string, 0, len(all))
+	for target, snaps := range all {
+		if len(snaps) > 0 {
+			targets = append(targets, target)
+		}
+	}
+	if len(targets) == 0 {
+		fmt.Fprintln(out, "No backups")
+		return
+	}
+	sort.Strings(targets)
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TARGET\tID\tTIME\tFILES")
+	for _, target := range targets {
+		for _, snap := range all[target] {
+			paths := make([]string, len(snap.Files))
+			for i, f := range snap.Files {
+				paths[i] = f.Path
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", target, snap.ID, snap.Time.Local().Format(time.RFC3339), strings.Join(paths, ", "))
+		}
+	}
+	w.Flush()
+}
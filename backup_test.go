@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tls-agent/internal/backup"
+	"tls-agent/internal/features"
+)
+
+// TestRestoreCommand tests listing and restoring backups through the admin API
+func TestRestoreCommand(t *testing.T) {
+	if buildBackups(features.DefaultBackupConfig()) != nil {
+		t.Error("Expected backups to be disabled without a directory")
+	}
+	store := buildBackups(features.BackupConfig{Dir: t.TempDir(), Keep: 5})
+
+	path := filepath.Join(t.TempDir(), "cert.pem")
+	if err := os.WriteFile(path, []byte("cert v1"), 0644); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	snap, _, err := store.Backup("nginx", path)
+	if err != nil {
+		t.Fatalf("Failed to back up: %v", err)
+	}
+	os.WriteFile(path, []byte("cert v2"), 0644)
+
+	admin := httptest.NewServer(backup.Handler(store))
+	defer admin.Close()
+	address := admin.URL
+
+	for _, args := range [][]string{nil, {"nginx"}} {
+		var out bytes.Buffer
+		if code := runRestore(address, args, &out); code != 0 {
+			t.Fatalf("Expected exit code 0, got %d: %s", code, out.String())
+		}
+		for _, want := range []string{"TARGET", "nginx", snap.ID, path} {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("Output missing %q:\n%s", want, out.String())
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	if code := runRestore(address, []string{"nginx", snap.ID}, &out); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, out.String())
+	}
+	if got, _ := os.ReadFile(path); string(got) != "cert v1" {
+		t.Errorf("Expected the backup to be restored, got %q", got)
+	}
+
+	out.Reset()
+	if code := runRestore(address, []string{"nginx", "unknown"}, &out); code == 0 {
+		t.Errorf("Expected non-zero exit code for an unknown backup: %s", out.String())
+	}
+}
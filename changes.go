@@ -0,0 +1,41 @@
+package main
+
+import (
+	"log"
+
+	"tls-agent/internal/deploy"
+	"tls-agent/internal/metrics"
+	"tls-agent/internal/tlsstore"
+)
+
+var (
+	certificateChanges = metrics.NewCounter("tls_agent_certificate_changes_total",
+		"Times the served certificate was replaced, by any reload, rollback or push")
+	certificateNotAfter = metrics.NewGauge("tls_agent_certificate_not_after_timestamp_seconds",
+		"Expiry of the served certificate as a Unix timestamp")
+)
+
+// subscribeCertificateMetrics keeps the served certificate's metrics current
+// from store updates rather than polling
+func subscribeCertificateMetrics(store tlsstore.CertificateProvider) {
+	set := func(info tlsstore.Managed) {
+		if info.Leaf != nil {
+			certificateNotAfter.Set(float64(info.Leaf.NotAfter.Unix()))
+		}
+	}
+	set(store.Info())
+	store.Subscribe(func(c tlsstore.Change) {
+		certificateChanges.Inc()
+		set(c.New)
+	})
+}
+
+// subscribeDeployer redeploys whenever the store's certificate changes, so
+// every source of a new certificate reaches the deploy targets
+func subscribeDeployer(store tlsstore.CertificateProvider, deployer *deploy.Deployer) {
+	store.Subscribe(func(tlsstore.Change) {
+		if err := deployer.Deploy(); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	})
+}
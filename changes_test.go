@@ -0,0 +1,53 @@
+package main
+
+import (
+	"crypto/tls"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"tls-agent/internal/features"
+	"tls-agent/internal/tlsstore"
+)
+
+// TestStoreSubscribers tests that certificate metrics and deploy targets
+// follow store updates without a reload event
+func TestStoreSubscribers(t *testing.T) {
+	dir := t.TempDir()
+	firstCert, firstKey := writeTestPair(t, dir, "first.test")
+	secondCert, secondKey := writeTestPair(t, dir, "second.test")
+	first, err := tls.LoadX509KeyPair(firstCert, firstKey)
+	if err != nil {
+		t.Fatalf("Failed to load pair: %v", err)
+	}
+	second, err := tls.LoadX509KeyPair(secondCert, secondKey)
+	if err != nil {
+		t.Fatalf("Failed to load pair: %v", err)
+	}
+
+	store := tlsstore.New(&first)
+	subscribeCertificateMetrics(store)
+	if got := certificateNotAfter.Value(); got != float64(first.Leaf.NotAfter.Unix()) {
+		t.Errorf("Expiry gauge = %v, want the initial certificate's", got)
+	}
+
+	deployed := filepath.Join(dir, "deployed.pem")
+	deployer, err := buildDeployer([]features.DeployTargetConfig{{Format: "pem", CertFile: deployed}}, store)
+	if err != nil {
+		t.Fatalf("Failed to build deployer: %v", err)
+	}
+	subscribeDeployer(store, deployer)
+
+	changes := certificateChanges.Value()
+	store.Update(&second)
+	if certificateChanges.Value() != changes+1 {
+		t.Error("Expected the change counter to increase")
+	}
+	if got := certificateNotAfter.Value(); got != float64(second.Leaf.NotAfter.Unix()) {
+		t.Errorf("Expiry gauge = %v, want the new certificate's", got)
+	}
+	want, _ := os.ReadFile(secondCert)
+	if got, err := os.ReadFile(deployed); err != nil || string(got) != string(want) {
+		t.Errorf("Deploy target not updated: %v", err)
+	}
+}
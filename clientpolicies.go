@@ -0,0 +1,66 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+
+	"tls-agent/internal/features"
+	"tls-agent/internal/tlsconfig"
+	"tls-agent/internal/tlsstore"
+	"tls-agent/internal/watch"
+)
+
+// buildClientPolicies converts the configured per-connection policies.
+// Policies with their own CA bundle get a hot-reloaded trust store; the
+// others verify clients against trust, the main trust store. chainCheck, if
+// set, is applied to the policies' own stores as it is to trust.
+func buildClientPolicies(cfgs []features.ClientPolicyConfig, trust *tlsstore.RootCAStore, chainCheck func([]*x509.Certificate) error, files *watch.Watcher) ([]tlsconfig.ClientPolicy, error) {
+	policies := make([]tlsconfig.ClientPolicy, 0, len(cfgs))
+	for _, c := range cfgs {
+		p := tlsconfig.ClientPolicy{Name: c.Name, ServerNames: c.ServerNames}
+		var err error
+		if p.Sources, err = tlsconfig.ParsePrefixes(c.Sources); err != nil {
+			return nil, fmt.Errorf("client policy %s: %w", c.Name, err)
+		}
+		if p.MinVersion, err = tlsconfig.ParseVersion(c.MinVersion); err != nil {
+			return nil, fmt.Errorf("client policy %s: %w", c.Name, err)
+		}
+		if p.CipherSuites, err = tlsconfig.ParseCipherSuites(c.CipherSuites); err != nil {
+			return nil, fmt.Errorf("client policy %s: %w", c.Name, err)
+		}
+
+		switch c.ClientAuth {
+		case "", "none":
+			p.ClientAuth = tls.NoClientCert
+			policies = append(policies, p)
+			continue
+		case "request":
+			p.ClientAuth = tls.RequestClientCert
+		case "require":
+			p.ClientAuth = tls.RequireAnyClientCert
+		default:
+			return nil, fmt.Errorf("client policy %s: invalid client_auth %q", c.Name, c.ClientAuth)
+		}
+
+		roots := trust
+		if c.CABundle != "" {
+			if roots, err = tlsstore.NewRootCAStore(c.CABundle); err != nil {
+				return nil, fmt.Errorf("client policy %s: %w", c.Name, err)
+			}
+			if err := roots.Register(files, nil); err != nil {
+				return nil, err
+			}
+			if chainCheck != nil {
+				roots.SetChainCheck(chainCheck)
+			}
+		}
+		if roots == nil {
+			return nil, fmt.Errorf("client policy %s: client_auth %q needs a ca_bundle", c.Name, c.ClientAuth)
+		}
+		p.VerifyClient = roots.VerifyClientCertificate
+		p.ClientCAs = roots.Pool
+		policies = append(policies, p)
+	}
+	return policies, nil
+}
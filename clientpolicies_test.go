@@ -0,0 +1,78 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"tls-agent/internal/features"
+	"tls-agent/internal/watch"
+	"tls-agent/pkg/agenttest"
+)
+
+// TestBuildClientPolicies tests converting configured client policies
+func TestBuildClientPolicies(t *testing.T) {
+	bundle, _ := writeTestPair(t, t.TempDir(), "ca")
+	files, err := watch.New(0)
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+
+	policies, err := buildClientPolicies([]features.ClientPolicyConfig{
+		{Name: "public", ServerNames: []string{"www.example.com"}},
+		{Name: "internal", Sources: []string{"10.0.0.0/8"}, ClientAuth: "require", CABundle: bundle, MinVersion: "1.3"},
+	}, nil, nil, files)
+	if err != nil {
+		t.Fatalf("Failed to build policies: %v", err)
+	}
+	if len(policies) != 2 || policies[0].ClientAuth != tls.NoClientCert || policies[0].VerifyClient != nil {
+		t.Errorf("Expected the public policy to skip client auth, got %+v", policies[0])
+	}
+	internal := policies[1]
+	if internal.ClientAuth != tls.RequireAnyClientCert || internal.VerifyClient == nil || internal.ClientCAs() == nil {
+		t.Errorf("Expected the internal policy to verify clients against its bundle, got %+v", internal)
+	}
+	if internal.MinVersion != tls.VersionTLS13 || len(internal.Sources) != 1 {
+		t.Errorf("Unexpected internal policy %+v", internal)
+	}
+
+	if _, err := buildClientPolicies([]features.ClientPolicyConfig{{Name: "mtls", ClientAuth: "request"}}, nil, nil, files); err == nil {
+		t.Error("Expected an error for client auth without any CA bundle")
+	}
+}
+
+// TestClientPolicyChainCheck tests that a policy with its own CA bundle
+// applies the chain check, and that its clients count as verified
+func TestClientPolicyChainCheck(t *testing.T) {
+	ca := agenttest.NewCA(t)
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Cert.Raw}), 0644); err != nil {
+		t.Fatalf("Failed to write bundle: %v", err)
+	}
+	files, err := watch.New(0)
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+
+	cfgs := []features.ClientPolicyConfig{{Name: "internal", ClientAuth: "require", CABundle: bundle}}
+	revoked := errors.New("revoked")
+	policies, err := buildClientPolicies(cfgs, nil, func([]*x509.Certificate) error { return revoked }, files)
+	if err != nil {
+		t.Fatalf("Failed to build policies: %v", err)
+	}
+	client := ca.IssueTLS(t, "client.example.com")
+	if err := policies[0].VerifyClient(client.Certificate, nil); !errors.Is(err, revoked) {
+		t.Errorf("Expected the chain check to reject the client, got %v", err)
+	}
+
+	if !clientCertsVerified(features.Features{TLS: features.ListenerTLSConfig{ClientPolicies: cfgs}}) {
+		t.Error("Expected a verifying client policy to mark client certificates verified")
+	}
+	if clientCertsVerified(features.Features{}) {
+		t.Error("Expected no verification without a trust store or client policy")
+	}
+}
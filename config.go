@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"tls-agent/internal/features"
+)
+
+// configUsage describes the config subcommands
+const configUsage = `Usage:
+  tls-agent config validate <file>   Check a config file offline
+  tls-agent config schema            Print the config JSON Schema
+  tls-agent config dump [--json]     Print the effective configuration from
+                                     FEATURES_CONFIG_PATH and the environment
+`
+
+// runConfig implements `tls-agent config`. It returns the exit code.
+func runConfig(args []string, out io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(out, configUsage)
+		return 2
+	}
+	switch args[0] {
+	case "validate":
+		if len(args) != 2 {
+			fmt.Fprint(out, configUsage)
+			return 2
+		}
+		return runConfigValidate(args[1], out)
+	case "dump":
+		return runConfigDump(hasFlag(args[1:], "--json"), out)
+	case "schema":
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(features.Schema()); err != nil {
+			return 1
+		}
+		return 0
+	default:
+		fmt.Fprintf(out, "Unknown config command %q\n%s", args[0], configUsage)
+		return 2
+	}
+}
+
+// runConfigValidate checks path's syntax, its keys and types against the
+// schema, and the semantic rules the agent enforces at startup, without
+// touching certificates or ports. Each stage runs only if the previous one
+// passed. It returns the exit code.
+func runConfigValidate(path string, out io.Writer) int {
+	fmt.Fprintln(out, path)
+	stage := func(name string, err error) bool {
+		if err == nil {
+			fmt.Fprintf(out, "  %-10s ok\n", name)
+			return true
+		}
+		fmt.Fprintf(out, "  %-10s FAILED\n", name)
+		for _, line := range strings.Split(err.Error(), "\n") {
+			fmt.Fprintf(out, "    - %s\n", line)
+		}
+		fmt.Fprintln(out, "Configuration invalid")
+		return false
+	}
+
+	doc, err := features.ReadDocument(path)
+	if !stage("syntax", err) {
+		return 1
+	}
+	if !stage("schema", features.ValidateDocument(doc)) {
+		return 1
+	}
+
+	loader := features.NewConfigLoader()
+	loader.SetStrict(true)
+	load := loader.LoadFromYAML
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		load = loader.LoadFromJSON
+	}
+	// The loader logs where it loaded from, which is noise here
+	logOut := log.Writer()
+	log.SetOutput(io.Discard)
+	err = load(path)
+	log.SetOutput(logOut)
+	if err == nil {
+		err = validateConfig(loader.Get())
+	}
+	if !stage("semantics", err) {
+		return 1
+	}
+	fmt.Fprintln(out, "Configuration valid")
+	return 0
+}
+
+// runConfigDump implements `tls-agent config dump`: it prints the
+// configuration this environment resolves to, the config file merged with
+// its includes and the environment overrides, with secrets redacted. It
+// returns the exit code.
+func runConfigDump(asJSON bool, out io.Writer) int {
+	logOut := log.Writer()
+	log.SetOutput(io.Discard)
+	loader, err := loadFeatures()
+	log.SetOutput(logOut)
+	if err != nil {
+		fmt.Fprintf(out, "Invalid features config: %v\n", err)
+		return 1
+	}
+
+	cfg := features.Redact(loader.Get())
+	if asJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(cfg)
+	} else {
+		enc := yaml.NewEncoder(out)
+		enc.SetIndent(2)
+		err = enc.Encode(cfg)
+	}
+	if err != nil {
+		fmt.Fprintf(out, "Failed to encode config: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// configHandler serves the running agent's effective configuration, with
+// secrets redacted, as JSON
+func configHandler(cfg features.Features) http.Handler {
+	redacted := features.Redact(cfg)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(redacted)
+	})
+}
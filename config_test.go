@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tls-agent/internal/features"
+)
+
+// TestConfigValidate tests each stage of `config validate`
+func TestConfigValidate(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		return path
+	}
+
+	for _, tc := range []struct {
+		name, content string
+		code          int
+		want          []string
+	}{
+		{"valid.yaml", "logging: false\nshutdown_timeout: 15\n", 0, []string{"syntax     ok", "semantics  ok", "Configuration valid"}},
+		{"syntax.yaml", "logging: [\n", 1, []string{"syntax     FAILED"}},
+		{"schema.json", `{"shutdown_timout": 15}`, 1, []string{"syntax     ok", "schema     FAILED", `did you mean "shutdown_timeout"`}},
+		{"semantics.yaml", "heartbeat:\n  enabled: true\n", 1, []string{"schema     ok", "semantics  FAILED", "heartbeat needs a url"}},
+	} {
+		var out bytes.Buffer
+		if code := runConfig([]string{"validate", write(tc.name, tc.content)}, &out); code != tc.code {
+			t.Errorf("%s: expected exit code %d, got %d:\n%s", tc.name, tc.code, code, out.String())
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("%s: output missing %q:\n%s", tc.name, want, out.String())
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	if code := runConfig([]string{"validate"}, &out); code != 2 || !strings.Contains(out.String(), "Usage") {
+		t.Errorf("Expected usage and exit code 2, got %d:\n%s", code, out.String())
+	}
+}
+
+// TestConfigSchema tests printing the schema
+func TestConfigSchema(t *testing.T) {
+	var out bytes.Buffer
+	if code := runConfig([]string{"schema"}, &out); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(out.Bytes(), &schema); err != nil || schema["type"] != "object" {
+		t.Errorf("Expected a JSON Schema object, got %s (%v)", out.String(), err)
+	}
+}
+
+// TestConfigDump tests dumping the effective configuration
+func TestConfigDump(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "features.yaml")
+	if err := os.WriteFile(path, []byte("shutdown_timeout: 42\nheartbeat:\n  enabled: true\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	t.Setenv("FEATURES_CONFIG_PATH", path)
+	t.Setenv("TLS_AGENT_FEATURES_HEARTBEAT_URL", "https://hc-ping.com/uuid")
+
+	var out bytes.Buffer
+	if code := runConfig([]string{"dump"}, &out); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, out.String())
+	}
+	for _, want := range []string{"shutdown_timeout: 42", "url: '[REDACTED]'"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Output missing %q:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "hc-ping.com") {
+		t.Errorf("Expected the heartbeat URL to be redacted:\n%s", out.String())
+	}
+
+	out.Reset()
+	if code := runConfig([]string{"dump", "--json"}, &out); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, out.String())
+	}
+	var cfg features.Features
+	if err := json.Unmarshal(out.Bytes(), &cfg); err != nil || cfg.ShutdownTimeout != 42 || !cfg.Heartbeat.Enabled {
+		t.Errorf("Expected the merged config as JSON, got %s (%v)", out.String(), err)
+	}
+}
+
+// TestConfigHandler tests the admin /config endpoint
+func TestConfigHandler(t *testing.T) {
+	cfg := features.DefaultFeatures()
+	cfg.Notifications.WebhookURL = "https://hooks.example/secret"
+	handler := configHandler(cfg)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/config", nil))
+	var got features.Features
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Failed to decode config: %v", err)
+	}
+	if got.Notifications.WebhookURL != features.Redacted || got.AdminAddress != cfg.AdminAddress {
+		t.Errorf("Expected the redacted config, got %+v", got.Notifications)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/config", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for PUT, got %d", rec.Code)
+	}
+}
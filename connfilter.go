@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+
+	"tls-agent/internal/connfilter"
+	"tls-agent/internal/features"
+	"tls-agent/internal/tlsconfig"
+)
+
+// buildConnFilter returns the configured connection filter, or nil when it
+// would admit everything
+func buildConnFilter(cfg features.ConnectionFilterConfig) (*connfilter.Filter, error) {
+	if len(cfg.Allow) == 0 && len(cfg.Deny) == 0 && cfg.RatePerIP == 0 {
+		return nil, nil
+	}
+	allow, err := tlsconfig.ParsePrefixes(cfg.Allow)
+	if err != nil {
+		return nil, fmt.Errorf("connection_filter.allow: %w", err)
+	}
+	deny, err := tlsconfig.ParsePrefixes(cfg.Deny)
+	if err != nil {
+		return nil, fmt.Errorf("connection_filter.deny: %w", err)
+	}
+	return &connfilter.Filter{Allow: allow, Deny: deny, Rate: cfg.RatePerIP, Burst: cfg.BurstPerIP}, nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/netip"
+	"testing"
+
+	"tls-agent/internal/connfilter"
+	"tls-agent/internal/features"
+)
+
+// TestBuildConnFilter tests converting the connection filter config
+func TestBuildConnFilter(t *testing.T) {
+	if f, err := buildConnFilter(features.ConnectionFilterConfig{}); err != nil || f != nil {
+		t.Errorf("Expected no filter without configuration, got %v (%v)", f, err)
+	}
+
+	f, err := buildConnFilter(features.ConnectionFilterConfig{Allow: []string{"10.0.0.0/8"}, Deny: []string{"10.0.0.1"}})
+	if err != nil {
+		t.Fatalf("Failed to build filter: %v", err)
+	}
+	if reason := f.Check(netip.MustParseAddr("10.0.0.1")); reason != connfilter.ReasonDenied {
+		t.Errorf("Expected a single denied address, got %q", reason)
+	}
+	if reason := f.Check(netip.MustParseAddr("10.0.0.2")); reason != "" {
+		t.Errorf("Expected an allowed address, got %q", reason)
+	}
+
+	if _, err := buildConnFilter(features.ConnectionFilterConfig{Deny: []string{"bogus"}}); err == nil {
+		t.Error("Invalid deny entry should be rejected")
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"tls-agent/internal/pidfile"
+)
+
+// backgroundStartTimeout bounds how long --background waits for the agent to
+// write its PID file
+const backgroundStartTimeout = 10 * time.Second
+
+// daemonOptions are the command-line options for running under classic init
+// systems:
+//
+//	--pid-file PATH   write the process ID to PATH while running
+//	--background      detach from the terminal and return once started
+//	--stdout PATH     append standard output to PATH
+//	--stderr PATH     append standard error (and the default log) to PATH
+type daemonOptions struct {
+	pidFile    string
+	background bool
+	stdout     string
+	stderr     string
+}
+
+// parseDaemonOptions reads the daemon options from args
+func parseDaemonOptions(args []string) daemonOptions {
+	return daemonOptions{
+		pidFile:    flagValue(args, "--pid-file"),
+		background: hasFlag(args, "--background"),
+		stdout:     flagValue(args, "--stdout"),
+		stderr:     flagValue(args, "--stderr"),
+	}
+}
+
+// flagValue returns the value of flag given as "--flag value" or
+// "--flag=value", or "" when it is absent
+func flagValue(args []string, flag string) string {
+	for i, a := range args {
+		if a == flag && i+1 < len(args) {
+			return args[i+1]
+		}
+		if value, ok := strings.CutPrefix(a, flag+"="); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+// withoutFlags returns args with the given flags and their values removed
+func withoutFlags(args, boolFlags, valueFlags []string) []string {
+	var out []string
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		name, _, hasValue := strings.Cut(a, "=")
+		switch {
+		case slices.Contains(boolFlags, a):
+		case slices.Contains(valueFlags, name):
+			if !hasValue {
+				i++
+			}
+		default:
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// daemonize starts the agent again as a detached process with its output
+// redirected, and returns once it is running: when a PID file is configured,
+// once the child has written it. The parent should then exit.
+func daemonize(opts daemonOptions, args []string) (int, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return 0, fmt.Errorf("background: %w", err)
+	}
+
+	cmd := exec.Command(exe, withoutFlags(args, []string{"--background"}, []string{"--stdout", "--stderr"})...)
+	cmd.SysProcAttr, err = detachAttr()
+	if err != nil {
+		return 0, err
+	}
+	// Nil streams are connected to the null device
+	if opts.stdout != "" {
+		f, err := openOutput(opts.stdout)
+		if err != nil {
+			return 0, err
+		}
+		defer f.Close()
+		cmd.Stdout = f
+	}
+	if opts.stderr != "" {
+		f, err := openOutput(opts.stderr)
+		if err != nil {
+			return 0, err
+		}
+		defer f.Close()
+		cmd.Stderr = f
+	}
+
+	if err := cmd.Start(); err != nil {
+		return 0, fmt.Errorf("background: %w", err)
+	}
+	pid := cmd.Process.Pid
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	if opts.pidFile == "" {
+		return pid, cmd.Process.Release()
+	}
+
+	deadline := time.After(backgroundStartTimeout)
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-exited:
+			return 0, fmt.Errorf("background: agent exited during startup: %v", err)
+		case <-deadline:
+			return 0, fmt.Errorf("background: agent did not write %s within %s", opts.pidFile, backgroundStartTimeout)
+		case <-ticker.C:
+			if written, err := pidfile.Read(opts.pidFile); err == nil && written == pid {
+				return pid, nil
+			}
+		}
+	}
+}
+
+// redirectOutput sends this process's standard output and error to files
+func redirectOutput(stdout, stderr string) error {
+	for _, r := range []struct {
+		path string
+		std  **os.File
+	}{
+		{stdout, &os.Stdout},
+		{stderr, &os.Stderr},
+	} {
+		if r.path == "" {
+			continue
+		}
+		f, err := openOutput(r.path)
+		if err != nil {
+			return err
+		}
+		if err := redirect(f, *r.std); err != nil {
+			f.Close()
+			return fmt.Errorf("redirect to %s: %w", r.path, err)
+		}
+		*r.std = f
+	}
+	log.SetOutput(os.Stderr)
+	return nil
+}
+
+func openOutput(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("open output: %w", err)
+	}
+	return f, nil
+}
+
+// acquirePIDFile writes the PID file, exiting if another agent holds it
+func acquirePIDFile(path string) *pidfile.File {
+	f, err := pidfile.Acquire(path)
+	if errors.Is(err, pidfile.ErrRunning) {
+		log.Fatalf("%v; is the agent already running?", err)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	return f
+}
@@ -0,0 +1,22 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// detachAttr reports that background mode is unavailable; on Windows run the
+// agent as a service instead
+func detachAttr() (*syscall.SysProcAttr, error) {
+	return nil, errors.New("background mode is not supported on this platform")
+}
+
+// redirect is a no-op; only the os.Stdout and os.Stderr variables are
+// replaced, so output written directly to the original handles is not
+// captured
+func redirect(f, std *os.File) error {
+	return nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestFlagValue tests reading flag values in both supported forms
+func TestFlagValue(t *testing.T) {
+	args := []string{"--pid-file", "/run/agent.pid", "--stdout=/var/log/out.log", "--stderr"}
+	if got := flagValue(args, "--pid-file"); got != "/run/agent.pid" {
+		t.Errorf("Expected /run/agent.pid, got %q", got)
+	}
+	if got := flagValue(args, "--stdout"); got != "/var/log/out.log" {
+		t.Errorf("Expected /var/log/out.log, got %q", got)
+	}
+	if got := flagValue(args, "--stderr"); got != "" {
+		t.Errorf("Expected no value for a trailing flag, got %q", got)
+	}
+}
+
+// TestWithoutFlags tests that the background child does not inherit the
+// options its parent already handled
+func TestWithoutFlags(t *testing.T) {
+	args := []string{"--background", "--pid-file", "agent.pid", "--stdout", "out.log", "--stderr=err.log"}
+	got := withoutFlags(args, []string{"--background"}, []string{"--stdout", "--stderr"})
+	want := []string{"--pid-file", "agent.pid"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,22 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// detachAttr starts the background process in a new session, detached from
+// the controlling terminal
+func detachAttr() (*syscall.SysProcAttr, error) {
+	return &syscall.SysProcAttr{Setsid: true}, nil
+}
+
+// redirect points std's file descriptor at f, so output written directly to
+// the descriptor (such as runtime panics) lands in f too
+func redirect(f, std *os.File) error {
+	return unix.Dup2(int(f.Fd()), int(std.Fd()))
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"expvar"
+	"net/http/pprof"
+	"runtime"
+	"sync"
+
+	"tls-agent/internal/admin"
+	"tls-agent/internal/agent"
+)
+
+// publishVars guards the process-wide expvar registrations
+var publishVars sync.Once
+
+// registerDebug serves expvar and pprof on the admin API. Besides Go's
+// memstats and cmdline, expvar reports goroutines and the reload count.
+func registerDebug(adminServer *admin.Server, state *agent.State) {
+	publishVars.Do(func() {
+		expvar.Publish("goroutines", expvar.Func(func() any { return runtime.NumGoroutine() }))
+		expvar.Publish("reloads", expvar.Func(func() any { return len(state.History()) }))
+	})
+
+	adminServer.Handle("/debug/vars", expvar.Handler())
+	adminServer.HandleFunc("/debug/pprof/", pprof.Index)
+	adminServer.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	adminServer.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	adminServer.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	adminServer.HandleFunc("/debug/pprof/trace", pprof.Trace)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"tls-agent/internal/admin"
+	"tls-agent/internal/agent"
+	"tls-agent/internal/features"
+)
+
+// TestRegisterDebug tests the expvar and pprof endpoints
+func TestRegisterDebug(t *testing.T) {
+	adminServer := admin.New("127.0.0.1:0")
+	registerDebug(adminServer, &agent.State{})
+
+	rec := httptest.NewRecorder()
+	adminServer.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/vars", nil))
+	var vars map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &vars); err != nil {
+		t.Fatalf("Failed to parse expvars: %v", err)
+	}
+	for _, name := range []string{"memstats", "goroutines", "reloads"} {
+		if _, ok := vars[name]; !ok {
+			t.Errorf("Expected expvar %s", name)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	adminServer.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/pprof/goroutine?debug=1", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected the goroutine profile, got status %d", rec.Code)
+	}
+
+	// The public handler must not expose what expvar and pprof register
+	// on the default mux
+	handler, err := buildHandler(features.MinimalFeatures(), &upstreamTrust{})
+	if err != nil {
+		t.Fatalf("Failed to build handler: %v", err)
+	}
+	for _, path := range []string{"/debug/vars", "/debug/pprof/"} {
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("Expected %s to be absent from the public handler, got %d", path, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"time"
+
+	"tls-agent/internal/delegated"
+	"tls-agent/internal/features"
+	"tls-agent/internal/lifecycle"
+	"tls-agent/internal/tlsstore"
+)
+
+// setupDelegated issues the first delegated credential for the served
+// certificate and keeps rotating it. The returned rotator also reissues on
+// reload when added to the notifier chain.
+func setupDelegated(cfg features.DelegatedCredentialsConfig, store *tlsstore.Store, runner *lifecycle.Runner) (*delegated.Rotator, error) {
+	scheme, err := delegated.ParseScheme(cfg.KeyType)
+	if err != nil {
+		return nil, err
+	}
+	rotator := &delegated.Rotator{
+		Certificate: func() *tls.Certificate {
+			cert, _ := store.GetCertificate(nil)
+			return cert
+		},
+		Scheme:         scheme,
+		Validity:       time.Duration(cfg.Validity) * time.Hour,
+		CredentialFile: cfg.CredentialFile,
+		KeyFile:        cfg.KeyFile,
+	}
+	if err := rotator.Rotate(); err != nil {
+		return nil, fmt.Errorf("delegated credentials: %w", err)
+	}
+	log.Printf("Delegated credentials: writing %s, valid %dh", cfg.CredentialFile, cfg.Validity)
+	runner.Go("delegated credentials", rotator.Run)
+	return rotator, nil
+}
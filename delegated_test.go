@@ -0,0 +1,36 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"tls-agent/internal/delegated"
+	"tls-agent/internal/features"
+	"tls-agent/internal/lifecycle"
+	"tls-agent/internal/tlsstore"
+)
+
+// TestSetupDelegatedRequiresDelegationUsage tests refusing certificates without the extension
+func TestSetupDelegatedRequiresDelegationUsage(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestPair(t, dir, "server")
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Failed to load pair: %v", err)
+	}
+	cfg := features.DefaultDelegatedCredentialsConfig()
+	cfg.CredentialFile = filepath.Join(dir, "dc.bin")
+	cfg.KeyFile = filepath.Join(dir, "dc.key")
+
+	_, err = setupDelegated(cfg, tlsstore.New(&cert), &lifecycle.Runner{})
+	if !errors.Is(err, delegated.ErrNoDelegationUsage) {
+		t.Errorf("Expected ErrNoDelegationUsage, got %v", err)
+	}
+
+	cfg.KeyType = "rsa"
+	if _, err := setupDelegated(cfg, tlsstore.New(&cert), &lifecycle.Runner{}); err == nil {
+		t.Error("Expected an unsupported key type to be rejected")
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	"tls-agent/internal/authz"
+	"tls-agent/internal/distribution"
+	"tls-agent/internal/features"
+	"tls-agent/internal/lifecycle"
+	"tls-agent/internal/tlsstore"
+	"tls-agent/internal/watch"
+)
+
+// setupDistribution serves the store's certificates to peer agents over
+// mutual TLS, using the agent's own certificate as the server certificate.
+// With noExport only the listing is served.
+func setupDistribution(cfg features.DistributionServerConfig, noExport bool, store *tlsstore.Store, files *watch.Watcher, runner *lifecycle.Runner) error {
+	clientCAs, err := tlsstore.NewRootCAStore(cfg.ClientCA)
+	if err != nil {
+		return fmt.Errorf("distribution: %w", err)
+	}
+	if err := clientCAs.Register(files, nil); err != nil {
+		return fmt.Errorf("distribution: %w", err)
+	}
+
+	dist := &distribution.Server{
+		Lookup: func(name string) *tls.Certificate {
+			if name == distribution.DefaultName {
+				cert, _ := store.GetCertificate(nil)
+				return cert
+			}
+			if !slices.Contains(store.SNINames(), name) {
+				return nil
+			}
+			cert, _ := store.GetCertificate(&tls.ClientHelloInfo{ServerName: name})
+			return cert
+		},
+		Names: func() []string {
+			return append([]string{distribution.DefaultName}, store.SNINames()...)
+		},
+		NoExport: noExport,
+	}
+	handler := dist.Handler()
+	if len(cfg.AllowedClients) > 0 {
+		handler = authz.New([]authz.Rule{{Allow: cfg.AllowedClients}}).Middleware(handler)
+	}
+
+	// Waiting requests end when shutdown starts instead of holding it up
+	base, cancel := context.WithCancel(context.Background())
+	server := &http.Server{
+		Addr:              cfg.Address,
+		Handler:           handler,
+		ReadHeaderTimeout: 5 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return base },
+		TLSConfig: &tls.Config{
+			GetCertificate:        store.GetCertificate,
+			ClientAuth:            tls.RequireAnyClientCert,
+			VerifyPeerCertificate: clientCAs.VerifyClientCertificate,
+			MinVersion:            tls.VersionTLS12,
+		},
+	}
+	server.RegisterOnShutdown(cancel)
+	runner.AddServer("distribution server", server, func() error { return server.ListenAndServeTLS("", "") })
+	return nil
+}
+
+// remoteSource returns a source pulling the served certificate from a
+// distribution server. The client certificate is re-read for every new
+// connection so that it can rotate too.
+func remoteSource(cfg features.RemoteSourceConfig, upstreams *upstreamTrust) (*distribution.Source, error) {
+	trust := features.UpstreamTLSConfig{CABundle: cfg.CABundle, Pins: cfg.Pins}
+	transport, err := upstreams.transport(trust, &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return tlsstore.Load(cfg.CertFile, cfg.KeyFile)
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("distribution: %w", err)
+	}
+	return &distribution.Source{
+		URL:  cfg.URL,
+		Name: cfg.Name,
+		Client: &http.Client{
+			Transport: transport,
+			Timeout:   distribution.DefaultMaxWait + 30*time.Second,
+		},
+	}, nil
+}
+
+// loadCertPool reads a PEM bundle of CA certificates
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates in %s", path)
+	}
+	return pool, nil
+}
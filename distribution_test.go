@@ -0,0 +1,33 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"tls-agent/internal/features"
+)
+
+// TestRemoteSourceCABundle tests that an unusable server CA bundle is
+// rejected before the agent starts
+func TestRemoteSourceCABundle(t *testing.T) {
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	if err := os.WriteFile(empty, nil, 0644); err != nil {
+		t.Fatalf("Failed to write bundle: %v", err)
+	}
+
+	for _, bundle := range []string{empty, filepath.Join(t.TempDir(), "missing.pem")} {
+		cfg := features.RemoteSourceConfig{URL: "https://certs.internal:9443", Name: "default", CABundle: bundle}
+		if _, err := remoteSource(cfg, &upstreamTrust{}); err == nil {
+			t.Errorf("Expected an error for %s", bundle)
+		}
+	}
+
+	source, err := remoteSource(features.RemoteSourceConfig{URL: "https://certs.internal:9443", Name: "default"}, &upstreamTrust{})
+	if err != nil {
+		t.Fatalf("Failed to create source with system roots: %v", err)
+	}
+	if source.Name != "default" || source.Client == nil {
+		t.Errorf("Unexpected source %+v", source)
+	}
+}
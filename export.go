@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"tls-agent/internal/admin"
+	"tls-agent/internal/tlsstore"
+)
+
+// exportHandler serves GET /export: the certificate and chain served for
+// ?name= (the default certificate when empty) as JSON, or with ?format=pem
+// as one PEM file. ?key=true adds the private key, which needs allowKey
+// and an authenticated caller with the operator role; every key export is
+// audited.
+func exportHandler(store *tlsstore.Store, allowKey bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		q := r.URL.Query()
+		format := q.Get("format")
+		if format != "" && format != "json" && format != "pem" {
+			http.Error(w, "format must be json or pem", http.StatusBadRequest)
+			return
+		}
+		includeKey := false
+		if v := q.Get("key"); v != "" {
+			var err error
+			if includeKey, err = strconv.ParseBool(v); err != nil {
+				http.Error(w, "key must be true or false", http.StatusBadRequest)
+				return
+			}
+		}
+
+		requester := "unauthenticated " + r.RemoteAddr
+		if includeKey {
+			caller, authenticated := admin.CallerFrom(r.Context())
+			if authenticated {
+				requester = caller.Name
+			}
+			switch {
+			case !allowKey:
+				tlsstore.AuditKey("export refused", "to "+requester+": key_hygiene.admin_key_export is off")
+				http.Error(w, "key export is disabled", http.StatusForbidden)
+				return
+			case !authenticated:
+				tlsstore.AuditKey("export refused", "to "+requester+": admin_auth is not enabled")
+				http.Error(w, "key export needs an authenticated caller", http.StatusForbidden)
+				return
+			case caller.Role != admin.RoleOperator:
+				tlsstore.AuditKey("export refused", "to "+requester+": role "+caller.Role)
+				http.Error(w, "key export needs the operator role", http.StatusForbidden)
+				return
+			}
+		}
+
+		snap, err := store.Export(q.Get("name"), tlsstore.ExportOptions{IncludeKey: includeKey, Requester: requester})
+		switch {
+		case errors.Is(err, tlsstore.ErrNoCertificate):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case errors.Is(err, tlsstore.ErrKeyNotExportable):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case err != nil:
+			log.Printf("Export: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if includeKey {
+			w.Header().Set("Cache-Control", "no-store")
+		}
+		if format == "pem" {
+			w.Header().Set("Content-Type", "application/x-pem-file")
+			_, _ = w.Write(snap.PEM())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(snap)
+	})
+}
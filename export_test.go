@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tls-agent/internal/admin"
+	"tls-agent/internal/tlsstore"
+)
+
+// TestExportHandler tests the formats of /export and that the key is only
+// exported when enabled and to operators
+func TestExportHandler(t *testing.T) {
+	certFile, keyFile := writeTestPair(t, t.TempDir(), "export.example.com")
+	cert, err := tlsstore.Load(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Failed to load certificate: %v", err)
+	}
+	store := tlsstore.New(cert)
+	auth := &admin.Auth{Tokens: []admin.Token{
+		{Name: "grafana", Secret: "read-token", Role: admin.RoleReader},
+		{Name: "deploy", Secret: "op-token", Role: admin.RoleOperator},
+	}}
+
+	get := func(allowKey bool, query, token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/export"+query, nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		auth.Middleware(exportHandler(store, allowKey)).ServeHTTP(rec, r)
+		return rec
+	}
+
+	rec := get(false, "", "read-token")
+	var snap tlsstore.Snapshot
+	if err := json.Unmarshal(rec.Body.Bytes(), &snap); rec.Code != http.StatusOK || err != nil {
+		t.Fatalf("Expected a JSON snapshot, got %d: %s", rec.Code, rec.Body)
+	}
+	if snap.CertPEM == "" || snap.KeyPEM != "" || snap.Subject != "CN=export.example.com" {
+		t.Fatalf("Unexpected snapshot: %+v", snap)
+	}
+
+	rec = get(false, "?format=pem", "read-token")
+	if body := rec.Body.String(); rec.Header().Get("Content-Type") != "application/x-pem-file" || !strings.HasPrefix(body, "-----BEGIN CERTIFICATE-----") || strings.Contains(body, "PRIVATE KEY") {
+		t.Fatalf("Unexpected PEM export: %s", body)
+	}
+
+	for _, tc := range []struct {
+		allowKey bool
+		query    string
+		token    string
+		want     int
+	}{
+		{false, "?key=true", "op-token", http.StatusForbidden},
+		{true, "?key=true", "read-token", http.StatusForbidden},
+		{true, "?key=maybe", "op-token", http.StatusBadRequest},
+		{true, "?format=der", "op-token", http.StatusBadRequest},
+		{true, "?name=other.example.com", "op-token", http.StatusNotFound},
+	} {
+		if rec := get(tc.allowKey, tc.query, tc.token); rec.Code != tc.want {
+			t.Errorf("%s (allow key %v, %s): expected %d, got %d", tc.query, tc.allowKey, tc.token, tc.want, rec.Code)
+		}
+	}
+
+	rec = get(true, "?key=true&format=pem", "op-token")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "PRIVATE KEY") || rec.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("Expected the key to be exported to an operator, got %d: %s", rec.Code, rec.Body)
+	}
+	if _, err := tlsstore.ParseCombined(rec.Body.Bytes()); err != nil {
+		t.Fatalf("Exported PEM does not load: %v", err)
+	}
+
+	// Without admin auth there is no caller to trust with the key
+	rec = httptest.NewRecorder()
+	exportHandler(store, true).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/export?key=true", nil))
+	if rec.Code != http.StatusForbidden || strings.Contains(rec.Body.String(), "PRIVATE KEY") {
+		t.Fatalf("Expected an unauthenticated key export to be refused, got %d: %s", rec.Code, rec.Body)
+	}
+}
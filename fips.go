@@ -0,0 +1,58 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+
+	"tls-agent/internal/policy"
+	"tls-agent/internal/tlsconfig"
+	"tls-agent/internal/tlsstore"
+)
+
+// fipsStatus is the compliance status reported by the fips health check
+type fipsStatus struct {
+	// Module is whether Go's FIPS 140-3 module is enabled; without it TLS
+	// 1.3 may still negotiate ChaCha20-Poly1305
+	Module bool `json:"module"`
+
+	// Violations lists the non-compliant certificates being served, by name
+	Violations map[string][]policy.Violation `json:"violations,omitempty"`
+}
+
+// fipsLoad wraps load to refuse certificates that are not FIPS compliant
+func fipsLoad(load func(certFile, keyFile string) (*tls.Certificate, error)) func(certFile, keyFile string) (*tls.Certificate, error) {
+	return policyLoad(policy.Policy{FIPS: true}, load)
+}
+
+// fipsCheck returns a health check reporting FIPS compliance of the
+// certificates in store against certPolicy
+func fipsCheck(store *tlsstore.Store, certPolicy policy.Policy) func() (any, error) {
+	return func() (any, error) {
+		status := fipsStatus{Module: tlsconfig.FIPSModule()}
+		check := func(name string, cert *tls.Certificate) {
+			if cert == nil {
+				return
+			}
+			leaf, err := tlsstore.ParseLeaf(cert)
+			if err != nil {
+				return
+			}
+			if violations := certPolicy.Evaluate(leaf); len(violations) > 0 {
+				if status.Violations == nil {
+					status.Violations = map[string][]policy.Violation{}
+				}
+				status.Violations[name] = violations
+			}
+		}
+		cert, _ := store.GetCertificate(nil)
+		check("default", cert)
+		for _, name := range store.SNINames() {
+			cert, _ := store.GetCertificate(&tls.ClientHelloInfo{ServerName: name})
+			check(name, cert)
+		}
+		if len(status.Violations) > 0 {
+			return status, fmt.Errorf("%d certificates are not FIPS compliant", len(status.Violations))
+		}
+		return status, nil
+	}
+}
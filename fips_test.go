@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"tls-agent/internal/policy"
+	"tls-agent/internal/tlsstore"
+)
+
+// TestFIPSLoadAndCheck tests that FIPS mode refuses non-compliant
+// certificates and reports them on the health check
+func TestFIPSLoadAndCheck(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestPair(t, dir, "fips.example")
+	load := fipsLoad(tlsstore.Load)
+	cert, err := load(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Expected a P-256 certificate to load, got %v", err)
+	}
+
+	store := tlsstore.New(cert)
+	check := fipsCheck(store, policy.Policy{FIPS: true})
+	if _, err := check(); err != nil {
+		t.Errorf("Expected a compliant store, got %v", err)
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:       big.NewInt(1),
+		Subject:            pkix.Name{CommonName: "legacy.example"},
+		NotBefore:          time.Now().Add(-time.Hour),
+		NotAfter:           time.Now().Add(time.Hour),
+		SignatureAlgorithm: x509.SHA1WithRSA,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	legacy := &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	if _, err := fipsLoad(func(string, string) (*tls.Certificate, error) { return legacy, nil })("legacy.crt", ""); err == nil {
+		t.Error("Expected a 1024-bit SHA-1 certificate to be refused")
+	}
+
+	store.Update(legacy)
+	details, err := check()
+	if err == nil {
+		t.Fatal("Expected the health check to fail for a non-compliant certificate")
+	}
+	if status := details.(fipsStatus); len(status.Violations["default"]) != 2 {
+		t.Errorf("Expected two violations for the default certificate, got %+v", status.Violations)
+	}
+}
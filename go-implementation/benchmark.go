@@ -2,24 +2,35 @@ package main
 
 import (
 	"fmt"
-	"os"
+	"math"
 	"runtime"
-	"strconv"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type BenchmarkResult struct {
-	Implementation string
-	TaskCount      int
-	ExecutionTime  time.Duration
-	MemoryUsed     int64
-	Throughput     float64
+	Implementation  string        `json:"implementation"`
+	Workload        string        `json:"workload"`
+	TaskCount       int           `json:"task_count"`
+	Workers         int           `json:"workers"`
+	Runs            int           `json:"runs"`
+	ExecutionTime   time.Duration `json:"execution_time_ns"` // mean of the measured runs
+	ExecutionStdDev time.Duration `json:"execution_stddev_ns"`
+	MemoryUsed      int64         `json:"memory_used_mb"` // largest of the measured runs
+	Throughput      float64       `json:"throughput"`     // tasks per second at the mean execution time
+	P50             time.Duration `json:"p50_ns"`         // task latency over every measured run
+	P95             time.Duration `json:"p95_ns"`
+	P99             time.Duration `json:"p99_ns"`
+	Errors          int           `json:"errors"` // failed tasks over every measured run
 }
 
 func (br BenchmarkResult) String() string {
-	return fmt.Sprintf("%s: %d tasks in %v (%.2f tasks/sec, %d MB memory)",
-		br.Implementation, br.TaskCount, br.ExecutionTime, br.Throughput, br.MemoryUsed)
+	return fmt.Sprintf("%s: %d %s tasks on %d workers in %v ± %v over %d runs (%.2f tasks/sec, p50 %v, p95 %v, p99 %v, %d MB memory, %d errors)",
+		br.Implementation, br.TaskCount, br.Workload, br.Workers, br.ExecutionTime, br.ExecutionStdDev, br.Runs, br.Throughput,
+		br.P50, br.P95, br.P99, br.MemoryUsed, br.Errors)
 }
 
 func getMemoryUsage() int64 {
@@ -28,74 +39,145 @@ func getMemoryUsage() int64 {
 	return int64(m.Alloc) / 1024 / 1024 // Convert to MB
 }
 
-func simulateIOBoundTask() {
-	time.Sleep(50 * time.Millisecond) // 50ms simulated I/O latency
+// runGoroutineBenchmark runs taskCount tasks of w on workers goroutines
+// at a time, warmup times unmeasured, so the runtime has grown its stacks
+// and heap, then runs times measured
+func runGoroutineBenchmark(w *workload, taskCount, workers, warmup, runs int) BenchmarkResult {
+	for i := 0; i < warmup; i++ {
+		runGoroutinesOnce(w, taskCount, workers)
+	}
+
+	var times, latencies []time.Duration
+	var memoryUsed int64
+	errCount := 0
+	for i := 0; i < runs; i++ {
+		executionTime, memory, taskLatencies, errs := runGoroutinesOnce(w, taskCount, workers)
+		errCount += errs
+		times = append(times, executionTime)
+		latencies = append(latencies, taskLatencies...)
+		if memory > memoryUsed {
+			memoryUsed = memory
+		}
+	}
+
+	mean, stdDev := meanStdDev(times)
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	return BenchmarkResult{
+		Implementation:  "Go Goroutines",
+		Workload:        w.name,
+		TaskCount:       taskCount,
+		Workers:         workers,
+		Runs:            runs,
+		ExecutionTime:   mean,
+		ExecutionStdDev: stdDev,
+		MemoryUsed:      memoryUsed,
+		Throughput:      float64(taskCount) / mean.Seconds(),
+		P50:             percentile(latencies, 50),
+		P95:             percentile(latencies, 95),
+		P99:             percentile(latencies, 99),
+		Errors:          errCount,
+	}
 }
 
-func runGoroutineBenchmark(taskCount int) BenchmarkResult {
+// runGoroutinesOnce runs taskCount tasks of w and returns the wall-clock
+// time, the memory grown by, each task's latency from being started to
+// finishing, and how many tasks failed
+func runGoroutinesOnce(w *workload, taskCount, workers int) (time.Duration, int64, []time.Duration, int) {
 	runtime.GC() // Clean up before benchmark
 	startMemory := getMemoryUsage()
 	startTime := time.Now()
 
 	var wg sync.WaitGroup
-	semaphore := make(chan struct{}, runtime.NumCPU()*2) // Limit concurrent goroutines
+	semaphore := make(chan struct{}, workers) // Limit concurrent goroutines
+	latencies := make([]time.Duration, taskCount)
+	var errCount atomic.Int64
 
 	for i := 0; i < taskCount; i++ {
 		wg.Add(1)
 		semaphore <- struct{}{} // Acquire semaphore
-		go func() {
+		go func(i int, started time.Time) {
 			defer wg.Done()
 			defer func() { <-semaphore }() // Release semaphore
-			simulateIOBoundTask()
-		}()
+			if err := w.task(); err != nil {
+				errCount.Add(1)
+			}
+			latencies[i] = time.Since(started)
+		}(i, time.Now())
 	}
 
 	wg.Wait()
 
-	endTime := time.Now()
-	endMemory := getMemoryUsage()
-
-	executionTime := endTime.Sub(startTime)
-	memoryUsed := endMemory - startMemory
+	executionTime := time.Since(startTime)
+	memoryUsed := getMemoryUsage() - startMemory
 	if memoryUsed < 0 {
 		memoryUsed = 0
 	}
+	return executionTime, memoryUsed, latencies, int(errCount.Load())
+}
 
-	throughput := float64(taskCount) / executionTime.Seconds()
+// meanStdDev returns the mean and sample standard deviation of durations
+func meanStdDev(durations []time.Duration) (time.Duration, time.Duration) {
+	if len(durations) == 0 {
+		return 0, 0
+	}
+	var sum float64
+	for _, d := range durations {
+		sum += float64(d)
+	}
+	mean := sum / float64(len(durations))
+	if len(durations) == 1 {
+		return time.Duration(mean), 0
+	}
+	var squares float64
+	for _, d := range durations {
+		squares += (float64(d) - mean) * (float64(d) - mean)
+	}
+	return time.Duration(mean), time.Duration(math.Sqrt(squares / float64(len(durations)-1)))
+}
 
-	return BenchmarkResult{
-		Implementation: "Go Goroutines",
-		TaskCount:      taskCount,
-		ExecutionTime:  executionTime,
-		MemoryUsed:     memoryUsed,
-		Throughput:     throughput,
+// percentile returns the p-th percentile of sorted by nearest rank
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(float64(len(sorted))*p/100+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
 	}
+	return sorted[rank]
 }
 
 func printResults(results []BenchmarkResult) {
-	fmt.Println("\n=== GOROUTINE BENCHMARK RESULTS ===")
-	fmt.Printf("%-20s %-10s %-15s %-15s\n", "Implementation", "Tasks", "Time", "Throughput")
-	fmt.Println("-".repeat(60))
+	fmt.Fprintln(progress, "\n=== GOROUTINE BENCHMARK RESULTS ===")
+	fmt.Fprintf(progress, "%-20s %-10s %-15s %-12s %-12s %-10s %-10s %-10s %-8s\n",
+		"Implementation", "Tasks", "Time", "StdDev", "Throughput", "p50", "p95", "p99", "Errors")
+	fmt.Fprintln(progress, strings.Repeat("-", 112))
 
 	for _, result := range results {
-		fmt.Printf("%-20s %-10d %-15v %-15.2f\n",
-			result.Implementation, result.TaskCount, result.ExecutionTime, result.Throughput)
+		fmt.Fprintf(progress, "%-20s %-10d %-15v %-12v %-12.2f %-10v %-10v %-10v %-8d\n",
+			result.Implementation, result.TaskCount,
+			result.ExecutionTime.Round(time.Microsecond), result.ExecutionStdDev.Round(time.Microsecond), result.Throughput,
+			result.P50.Round(time.Microsecond), result.P95.Round(time.Microsecond), result.P99.Round(time.Microsecond),
+			result.Errors)
 	}
-	fmt.Println()
+	fmt.Fprintln(progress)
 }
 
-func runGoroutineComparison(taskCounts []int) {
-	fmt.Println("=== Go Goroutines Performance Test ===")
-	fmt.Println("Testing Goroutines performance with I/O-bound tasks\n")
+func runGoroutineComparison(w *workload, taskCounts []int, workers, warmup, runs int) []BenchmarkResult {
+	fmt.Fprintln(progress, "=== Go Goroutines Performance Test ===")
+	fmt.Fprintf(progress, "Testing Goroutines performance with %s tasks on %d workers\n\n", w.name, workers)
 
 	var results []BenchmarkResult
 
 	for _, taskCount := range taskCounts {
-		fmt.Printf("Running %d tasks with Goroutines...\n", taskCount)
-		result := runGoroutineBenchmark(taskCount)
+		fmt.Fprintf(progress, "Running %d tasks with Goroutines (%d warmup, %d measured runs)...\n", taskCount, warmup, runs)
+		result := runGoroutineBenchmark(w, taskCount, workers, warmup, runs)
 		results = append(results, result)
-		fmt.Println(result)
-		fmt.Println()
+		fmt.Fprintln(progress, result)
+		fmt.Fprintln(progress)
 
 		// Brief pause between tests
 		time.Sleep(500 * time.Millisecond)
@@ -103,15 +185,16 @@ func runGoroutineComparison(taskCounts []int) {
 
 	printResults(results)
 
-	fmt.Println("=== Goroutine Scalability Analysis ===")
+	fmt.Fprintln(progress, "=== Goroutine Scalability Analysis ===")
 	for i, result := range results {
 		if i > 0 {
 			prevResult := results[i-1]
 			scalability := float64(result.TaskCount) / float64(prevResult.TaskCount)
 			timeIncrease := result.ExecutionTime.Seconds() / prevResult.ExecutionTime.Seconds()
 
-			fmt.Printf("Task count increased %.1fx, execution time increased %.2fx\n",
+			fmt.Fprintf(progress, "Task count increased %.1fx, execution time increased %.2fx\n",
 				scalability, timeIncrease)
 		}
 	}
+	return results
 }
@@ -2,6 +2,10 @@ module virtual-threads-benchmark
 
 go 1.21
 
+require github.com/urfave/cli v1.22.9
+
 require (
-	github.com/urfave/cli v1.22.9
+	github.com/cpuguy83/go-md2man/v2 v2.0.0-20190314233015-f79a8a8ca69d // indirect
+	github.com/russross/blackfriday/v2 v2.0.1 // indirect
+	github.com/shurcooL/sanitized_anchor_name v1.0.0 // indirect
 )
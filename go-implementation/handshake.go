@@ -0,0 +1,427 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// handshakeTimeout bounds each dial, handshake and request
+const handshakeTimeout = 5 * time.Second
+
+// HandshakeResult is one handshake scenario's measurements. Latency covers
+// the TLS handshake only, not the TCP connect or the request after it.
+type HandshakeResult struct {
+	Scenario   string        `json:"scenario"`
+	Handshakes int           `json:"handshakes"`
+	Resumed    int           `json:"resumed"`
+	Errors     int           `json:"errors"`
+	FirstError string        `json:"first_error,omitempty"`
+	Elapsed    time.Duration `json:"elapsed_ns"`
+	Rate       float64       `json:"handshakes_per_sec"` // successful handshakes only
+	P50        time.Duration `json:"p50_ns"`
+	P90        time.Duration `json:"p90_ns"`
+	P99        time.Duration `json:"p99_ns"`
+	Max        time.Duration `json:"max_ns"`
+}
+
+func (hr HandshakeResult) String() string {
+	return fmt.Sprintf("%s: %d handshakes in %v (%.2f handshakes/sec, p50 %v, p99 %v, %d resumed, %d errors)",
+		hr.Scenario, hr.Handshakes, hr.Elapsed, hr.Rate, hr.P50, hr.P99, hr.Resumed, hr.Errors)
+}
+
+// handshakeTarget is a TLS server to handshake with, and the client
+// configuration to use, without a session cache
+type handshakeTarget struct {
+	name   string // key type, or the target address
+	addr   string
+	config *tls.Config
+	close  func()
+}
+
+func handshakeCommand() cli.Command {
+	return cli.Command{
+		Name:  "handshake",
+		Usage: "Benchmark real TLS handshakes: full vs resumed, RSA vs ECDSA, with and without client certificates",
+		Description: "Without --target the benchmark starts a local TLS server per key type, using the same\n" +
+			"crypto/tls stack as the agent. With --target it handshakes with a running agent, whose\n" +
+			"certificate decides the key type; pass --cert and --key to add client certificate runs.",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "target", Usage: "host:port of a running agent; empty starts a local server"},
+			&cli.IntFlag{Name: "handshakes", Value: 2000, Usage: "Handshakes per scenario"},
+			&cli.IntFlag{Name: "concurrency", Value: 0, Usage: "Concurrent clients (0 means runtime.NumCPU() * 2)"},
+			&cli.StringFlag{Name: "key-types", Value: "rsa,ecdsa", Usage: "Server key types for the local server"},
+			&cli.StringFlag{Name: "server-name", Usage: "SNI and verification name for --target (default: its host)"},
+			&cli.StringFlag{Name: "ca", Usage: "PEM CA bundle verifying --target (default: system roots)"},
+			&cli.BoolFlag{Name: "insecure", Usage: "Skip verifying --target's certificate"},
+			&cli.StringFlag{Name: "cert", Usage: "Client certificate PEM for --target"},
+			&cli.StringFlag{Name: "key", Usage: "Client key PEM for --target"},
+		},
+		Action: func(c *cli.Context) error {
+			concurrency := c.Int("concurrency")
+			if concurrency <= 0 {
+				concurrency = runtime.NumCPU() * 2
+			}
+			if c.Int("handshakes") <= 0 {
+				return errors.New("--handshakes must be positive")
+			}
+
+			fmt.Fprintln(progress, "🔐 TLS Handshake Benchmark")
+			fmt.Fprintln(progress, "=====================================")
+			fmt.Fprintf(progress, "Configuration: %d handshakes per scenario, %d concurrent clients\n\n",
+				c.Int("handshakes"), concurrency)
+
+			var results []HandshakeResult
+			run := func(target *handshakeTarget, clientCert bool) {
+				for _, resume := range []bool{false, true} {
+					scenario := handshakeScenario(target.name, resume, clientCert)
+					fmt.Fprintf(progress, "Running %s...\n", scenario)
+					result := runHandshakeBenchmark(target, scenario, resume, c.Int("handshakes"), concurrency)
+					results = append(results, result)
+					fmt.Fprintln(progress, result)
+					fmt.Fprintln(progress)
+				}
+			}
+
+			if addr := c.String("target"); addr != "" {
+				plain, withCert, err := remoteTargets(c)
+				if err != nil {
+					return err
+				}
+				run(plain, false)
+				if withCert != nil {
+					run(withCert, true)
+				}
+			} else {
+				for _, keyType := range strings.Split(c.String("key-types"), ",") {
+					keyType = strings.TrimSpace(keyType)
+					for _, clientCert := range []bool{false, true} {
+						target, err := newLocalTarget(keyType, clientCert)
+						if err != nil {
+							return err
+						}
+						run(target, clientCert)
+						target.close()
+					}
+				}
+			}
+
+			printHandshakeResults(results)
+			return emitResults(c, "handshake", results)
+		},
+	}
+}
+
+// handshakeScenario names a run, e.g. "ecdsa resumed +client-cert"
+func handshakeScenario(name string, resume, clientCert bool) string {
+	scenario := name + " full"
+	if resume {
+		scenario = name + " resumed"
+	}
+	if clientCert {
+		scenario += " +client-cert"
+	}
+	return scenario
+}
+
+// runHandshakeBenchmark performs count handshakes with target from
+// concurrency clients. When resume is set each client keeps a session
+// cache, primed by one unmeasured handshake, so later handshakes can
+// resume; otherwise session tickets are disabled and every handshake is
+// full.
+func runHandshakeBenchmark(target *handshakeTarget, scenario string, resume bool, count, concurrency int) HandshakeResult {
+	var (
+		next      atomic.Int64
+		resumed   atomic.Int64
+		mu        sync.Mutex
+		latencies []time.Duration
+		errCount  int
+		firstErr  error
+		wg        sync.WaitGroup
+	)
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errCount++
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	startTime := time.Now()
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			config := target.config.Clone()
+			if resume {
+				config.ClientSessionCache = tls.NewLRUClientSessionCache(1)
+				// A failure here recurs in the measured handshakes
+				handshakeOnce(target.addr, config)
+			} else {
+				config.SessionTicketsDisabled = true
+			}
+
+			var local []time.Duration
+			for next.Add(1) <= int64(count) {
+				latency, state, err := handshakeOnce(target.addr, config)
+				if err != nil {
+					fail(err)
+					continue
+				}
+				if state.DidResume {
+					resumed.Add(1)
+				}
+				local = append(local, latency)
+			}
+			mu.Lock()
+			latencies = append(latencies, local...)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(startTime)
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	result := HandshakeResult{
+		Scenario:   scenario,
+		Handshakes: len(latencies),
+		Resumed:    int(resumed.Load()),
+		Errors:     errCount,
+		Elapsed:    elapsed,
+		Rate:       float64(len(latencies)) / elapsed.Seconds(),
+		P50:        percentile(latencies, 50),
+		P90:        percentile(latencies, 90),
+		P99:        percentile(latencies, 99),
+	}
+	if len(latencies) > 0 {
+		result.Max = latencies[len(latencies)-1]
+	}
+	if firstErr != nil {
+		result.FirstError = firstErr.Error()
+	}
+	return result
+}
+
+// handshakeOnce connects to addr, times the handshake and then makes one
+// HTTP request, which also reads the session tickets a TLS 1.3 server sends
+// after the handshake. It returns the handshake latency and the
+// connection's state.
+func handshakeOnce(addr string, config *tls.Config) (time.Duration, tls.ConnectionState, error) {
+	raw, err := net.DialTimeout("tcp", addr, handshakeTimeout)
+	if err != nil {
+		return 0, tls.ConnectionState{}, err
+	}
+	conn := tls.Client(raw, config)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+
+	ctx, cancel := context.WithTimeout(context.Background(), handshakeTimeout)
+	defer cancel()
+	start := time.Now()
+	if err := conn.HandshakeContext(ctx); err != nil {
+		return 0, tls.ConnectionState{}, err
+	}
+	latency := time.Since(start)
+
+	host := config.ServerName
+	if host == "" {
+		host = addr
+	}
+	if _, err := fmt.Fprintf(conn, "HEAD / HTTP/1.1\r\nHost: %s\r\nConnection: close\r\n\r\n", host); err != nil {
+		return 0, tls.ConnectionState{}, err
+	}
+	if _, err := io.Copy(io.Discard, conn); err != nil {
+		return 0, tls.ConnectionState{}, err
+	}
+	return latency, conn.ConnectionState(), nil
+}
+
+func printHandshakeResults(results []HandshakeResult) {
+	fmt.Fprintln(progress, "\n=== TLS HANDSHAKE BENCHMARK RESULTS ===")
+	fmt.Fprintf(progress, "%-32s %-10s %-12s %-10s %-10s %-10s %-8s %-8s\n",
+		"Scenario", "Handshakes", "HS/sec", "p50", "p90", "p99", "Resumed", "Errors")
+	fmt.Fprintln(progress, strings.Repeat("-", 106))
+
+	for _, result := range results {
+		fmt.Fprintf(progress, "%-32s %-10d %-12.2f %-10v %-10v %-10v %-8d %-8d\n",
+			result.Scenario, result.Handshakes, result.Rate,
+			result.P50.Round(time.Microsecond), result.P90.Round(time.Microsecond), result.P99.Round(time.Microsecond),
+			result.Resumed, result.Errors)
+	}
+	for _, result := range results {
+		if result.FirstError != "" {
+			fmt.Fprintf(progress, "%s: first error: %s\n", result.Scenario, result.FirstError)
+		}
+	}
+	fmt.Fprintln(progress)
+}
+
+// remoteTargets returns the --target configuration without a client
+// certificate, and with one when --cert and --key are set
+func remoteTargets(c *cli.Context) (*handshakeTarget, *handshakeTarget, error) {
+	addr := c.String("target")
+	serverName := c.String("server-name")
+	if serverName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("--target: %w", err)
+		}
+		serverName = host
+	}
+	config := &tls.Config{ServerName: serverName, InsecureSkipVerify: c.Bool("insecure")}
+	if path := c.String("ca"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(data) {
+			return nil, nil, fmt.Errorf("--ca %s: no certificates", path)
+		}
+	}
+	plain := &handshakeTarget{name: addr, addr: addr, config: config, close: func() {}}
+
+	if c.String("cert") == "" && c.String("key") == "" {
+		return plain, nil, nil
+	}
+	pair, err := tls.LoadX509KeyPair(c.String("cert"), c.String("key"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("client certificate: %w", err)
+	}
+	withCert := config.Clone()
+	withCert.Certificates = []tls.Certificate{pair}
+	return plain, &handshakeTarget{name: addr, addr: addr, config: withCert, close: func() {}}, nil
+}
+
+// newLocalTarget starts an HTTPS server on loopback with a certificate of
+// keyType ("rsa" or "ecdsa") from a throwaway CA. With clientCert the
+// server requires client certificates from that CA and the client
+// configuration presents one.
+func newLocalTarget(keyType string, clientCert bool) (*handshakeTarget, error) {
+	ca, caKey, err := newBenchmarkCA("Handshake Benchmark CA", 1, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+
+	serverCert, err := issueBenchmarkCert(ca, caKey, keyType, 2, x509.ExtKeyUsageServerAuth)
+	if err != nil {
+		return nil, err
+	}
+	serverConfig := &tls.Config{Certificates: []tls.Certificate{serverCert}}
+	clientConfig := &tls.Config{ServerName: "localhost", RootCAs: pool}
+	if clientCert {
+		cert, err := issueBenchmarkCert(ca, caKey, "ecdsa", 3, x509.ExtKeyUsageClientAuth)
+		if err != nil {
+			return nil, err
+		}
+		serverConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		serverConfig.ClientCAs = pool
+		clientConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}),
+		TLSConfig: serverConfig,
+	}
+	go srv.ServeTLS(ln, "", "")
+
+	return &handshakeTarget{
+		name:   keyType,
+		addr:   ln.Addr().String(),
+		config: clientConfig,
+		close:  func() { srv.Close() },
+	}, nil
+}
+
+// newBenchmarkCA creates a CA certificate with a new ECDSA key, signed by
+// parent, or self-signed when parent is nil
+func newBenchmarkCA(name string, serial int64, parent *x509.Certificate, parentKey crypto.Signer) (*x509.Certificate, crypto.Signer, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, key.Public(), parentKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, key, nil
+}
+
+// issueBenchmarkCert issues a localhost certificate with a new key of
+// keyType, signed by ca
+func issueBenchmarkCert(ca *x509.Certificate, caKey crypto.Signer, keyType string, serial int64, usage x509.ExtKeyUsage) (tls.Certificate, error) {
+	var key crypto.Signer
+	var err error
+	switch keyType {
+	case "rsa":
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	case "ecdsa":
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	default:
+		return tls.Certificate{}, fmt.Errorf("unknown key type %q (want rsa or ecdsa)", keyType)
+	}
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, key.Public(), caKey)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
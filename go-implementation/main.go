@@ -1,57 +1,103 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"runtime"
+	"time"
 
 	"github.com/urfave/cli"
 )
 
 func main() {
-	app := cli.NewApp(&cli.App{
-		Name:  "virtual-threads-benchmark",
-		Usage: "Performance comparison between Go Goroutines and Java Virtual Threads",
-		Flags: []cli.Flag{
-			&cli.IntFlag{
-				Name:  "tasks",
-				Value: 10000,
-				Usage: "Number of concurrent tasks to run",
-			},
-			&cli.StringFlag{
-				Name:  "duration",
-				Value: "50ms",
-				Usage: "Duration of each simulated I/O task",
-			},
-			&cli.IntFlag{
-				Name:  "workers",
-				Value: 0, // 0 means use runtime.NumCPU() * 2
-				Usage: "Maximum number of concurrent workers",
-			},
-		},
-		Action: func(c *cli.Context) error {
-			taskCounts := []int{1000, 5000, 10000, 50000, 100000}
-
-			if c.Int("tasks") > 0 {
-				taskCounts = []int{c.Int("tasks")}
-			}
-
-			fmt.Println("🚀 Virtual Threads vs Goroutines Benchmark")
-			fmt.Println("=====================================")
-			fmt.Printf("Configuration: %d tasks max, %s duration per task\n\n",
-				c.Int("tasks"), c.String("duration"))
-
-			// Run Go goroutine benchmarks
-			runGoroutineComparison(taskCounts)
-
-			fmt.Println("\n📊 Benchmark completed!")
-			fmt.Println("Run the Java implementation to compare results:")
-			fmt.Println("  cd ../java-implementation")
-			fmt.Println("  mvn exec:java -Dexec.mainClass=\"com.benchmark.ComparisonRunner\"")
-
-			return nil
-		},
-	})
+	app := cli.NewApp()
+	app.Name = "virtual-threads-benchmark"
+	app.Usage = "Performance comparison between Go Goroutines and Java Virtual Threads"
+	app.Flags = []cli.Flag{
+		&cli.IntFlag{
+			Name:  "tasks",
+			Value: 10000,
+			Usage: "Number of concurrent tasks to run",
+		},
+		&cli.StringFlag{
+			Name:  "duration",
+			Value: "50ms",
+			Usage: "Duration of each task when run alone",
+		},
+		&cli.StringFlag{
+			Name:  "workload",
+			Value: "io",
+			Usage: "Task type: io (sleep), cpu (hashing), mixed, or network (TLS round trip to a local echo server)",
+		},
+		&cli.IntFlag{
+			Name:  "workers",
+			Value: 0, // 0 means use runtime.NumCPU() * 2
+			Usage: "Maximum number of concurrent workers",
+		},
+		&cli.IntFlag{
+			Name:  "warmup",
+			Value: 1,
+			Usage: "Unmeasured runs of each task count before measuring",
+		},
+		&cli.IntFlag{
+			Name:  "runs",
+			Value: 3,
+			Usage: "Measured runs of each task count",
+		},
+		&cli.StringFlag{
+			Name:  "output",
+			Value: "table",
+			Usage: "Result format on stdout: table, json or csv",
+		},
+		&cli.StringFlag{
+			Name:  "results-dir",
+			Usage: "Directory to also save each run's results in, named by benchmark and time",
+		},
+	}
+	app.Before = checkOutput
+	app.Commands = []cli.Command{handshakeCommand(), rotateCommand()}
+	app.Action = func(c *cli.Context) error {
+		if c.Int("runs") <= 0 {
+			return errors.New("--runs must be positive")
+		}
+
+		duration, err := time.ParseDuration(c.String("duration"))
+		if err != nil || duration < 0 {
+			return fmt.Errorf("--duration must be a non-negative duration such as 50ms, got %q", c.String("duration"))
+		}
+		workers := c.Int("workers")
+		if workers <= 0 {
+			workers = runtime.NumCPU() * 2
+		}
+		w, err := newWorkload(c.String("workload"), duration)
+		if err != nil {
+			return err
+		}
+		defer w.close()
+
+		taskCounts := []int{1000, 5000, 10000, 50000, 100000}
+
+		if c.Int("tasks") > 0 {
+			taskCounts = []int{c.Int("tasks")}
+		}
+
+		fmt.Fprintln(progress, "🚀 Virtual Threads vs Goroutines Benchmark")
+		fmt.Fprintln(progress, "=====================================")
+		fmt.Fprintf(progress, "Configuration: %d tasks max, %s %s tasks on %d workers, %d warmup and %d measured runs\n\n",
+			c.Int("tasks"), duration, w.name, workers, c.Int("warmup"), c.Int("runs"))
+
+		// Run Go goroutine benchmarks
+		results := runGoroutineComparison(w, taskCounts, workers, c.Int("warmup"), c.Int("runs"))
+
+		fmt.Fprintln(progress, "\n📊 Benchmark completed!")
+		fmt.Fprintln(progress, "Run the Java implementation to compare results:")
+		fmt.Fprintln(progress, "  cd ../java-implementation")
+		fmt.Fprintln(progress, "  mvn exec:java -Dexec.mainClass=\"com.benchmark.ComparisonRunner\"")
+
+		return emitResults(c, "goroutines", results)
+	}
 
 	if err := app.Run(os.Args); err != nil {
 		log.Fatal(err)
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// progress receives the human-readable output: progress lines and tables.
+// It moves to stderr when stdout carries JSON or CSV.
+var progress io.Writer = os.Stdout
+
+// outputFormats are the values of --output
+var outputFormats = []string{"table", "json", "csv"}
+
+// resultSet is one run's results as written by --output and --results-dir,
+// with what is needed to compare it with other runs
+type resultSet struct {
+	Benchmark string            `json:"benchmark"`
+	Timestamp time.Time         `json:"timestamp"`
+	GoVersion string            `json:"go_version"`
+	NumCPU    int               `json:"num_cpu"`
+	Config    map[string]string `json:"config"`
+	Results   any               `json:"results"` // a slice of result structs
+}
+
+// checkOutput validates --output and points progress at stderr for
+// machine-readable formats; it runs before any benchmark
+func checkOutput(c *cli.Context) error {
+	format := c.GlobalString("output")
+	valid := false
+	for _, f := range outputFormats {
+		valid = valid || format == f
+	}
+	if !valid {
+		return fmt.Errorf("--output must be one of %s, got %q", strings.Join(outputFormats, ", "), format)
+	}
+	if format != "table" {
+		progress = os.Stderr
+	}
+	return nil
+}
+
+// emitResults writes results, a slice of result structs, to stdout in the
+// --output format and, with --results-dir, to a timestamped file there.
+// Tables are printed by each benchmark as it runs, so for the table format
+// only the file is written, as JSON.
+func emitResults(c *cli.Context, benchmark string, results any) error {
+	set := resultSet{
+		Benchmark: benchmark,
+		Timestamp: time.Now().UTC(),
+		GoVersion: runtime.Version(),
+		NumCPU:    runtime.NumCPU(),
+		Config:    flagValues(c),
+		Results:   results,
+	}
+
+	format := c.GlobalString("output")
+	if format != "table" {
+		if err := writeResults(os.Stdout, format, set); err != nil {
+			return err
+		}
+	}
+
+	dir := c.GlobalString("results-dir")
+	if dir == "" {
+		return nil
+	}
+	if format == "table" {
+		format = "json"
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s.%s", benchmark, set.Timestamp.Format("20060102T150405Z"), format))
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := writeResults(f, format, set); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(progress, "📁 Results written to %s\n", path)
+	return nil
+}
+
+// flagValues returns the global and command flags as set for this run
+func flagValues(c *cli.Context) map[string]string {
+	values := map[string]string{}
+	for _, name := range c.GlobalFlagNames() {
+		values[name] = c.GlobalString(name)
+	}
+	for _, name := range c.FlagNames() {
+		values[name] = c.String(name)
+	}
+	return values
+}
+
+// writeResults writes set as indented JSON, or as CSV with one row per
+// result, a header from the results' json tags, and the benchmark and
+// timestamp leading each row so files from several runs can be
+// concatenated
+func writeResults(w io.Writer, format string, set resultSet) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(set)
+	}
+
+	rows := reflect.ValueOf(set.Results)
+	elem := rows.Type().Elem()
+	header := []string{"benchmark", "timestamp"}
+	for i := 0; i < elem.NumField(); i++ {
+		header = append(header, csvName(elem.Field(i)))
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for i := 0; i < rows.Len(); i++ {
+		row := []string{set.Benchmark, set.Timestamp.Format(time.RFC3339)}
+		for j := 0; j < elem.NumField(); j++ {
+			row = append(row, csvValue(rows.Index(i).Field(j)))
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvName is a field's JSON name, or its Go name without a json tag
+func csvName(f reflect.StructField) string {
+	if name, _, _ := strings.Cut(f.Tag.Get("json"), ","); name != "" {
+		return name
+	}
+	return f.Name
+}
+
+// csvValue formats a field the way encoding/json would: durations as
+// integer nanoseconds, floats in their shortest form
+func csvValue(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	}
+	return fmt.Sprint(v.Interface())
+}
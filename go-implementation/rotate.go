@@ -0,0 +1,415 @@
+package main
+
+import (
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// rotationWindow is how long after each rotation handshakes count towards
+// the rotation's latency impact rather than the baseline
+const rotationWindow = time.Second
+
+// RotationResult is the outcome of sustaining handshakes and requests
+// against the agent while its certificate rotates
+type RotationResult struct {
+	Duration    time.Duration `json:"duration_ns"`
+	Rotations   int           `json:"rotations"`
+	Observed    int           `json:"observed"` // rotations the agent was seen serving
+	Requests    int           `json:"requests"`
+	Errors      int           `json:"errors"`
+	FirstError  string        `json:"first_error,omitempty"`
+	ErrorRate   float64       `json:"error_rate"`         // errors as a fraction of requests
+	Mismatched  int           `json:"mismatched_chains"`  // chains whose leaf and intermediate were not issued together
+	Stale       int           `json:"stale_certificates"` // older certificates served after a newer one
+	BaselineP50 time.Duration `json:"baseline_p50_ns"`
+	BaselineP99 time.Duration `json:"baseline_p99_ns"`
+	RotationP50 time.Duration `json:"rotation_p50_ns"` // handshakes within rotationWindow of a rotation
+	RotationP99 time.Duration `json:"rotation_p99_ns"`
+	ReloadAvg   time.Duration `json:"reload_avg_ns"` // from writing a pair until it is first served
+	ReloadMax   time.Duration `json:"reload_max_ns"`
+}
+
+func (rr RotationResult) String() string {
+	return fmt.Sprintf("%d requests over %v, %d rotations (%d observed): %.3f%% errors, %d mismatched chains, %d stale",
+		rr.Requests, rr.Duration, rr.Rotations, rr.Observed, rr.ErrorRate*100, rr.Mismatched, rr.Stale)
+}
+
+func rotateCommand() cli.Command {
+	return cli.Command{
+		Name:  "rotate",
+		Usage: "Sustain HTTPS load against a running agent while rotating its certificate",
+		Description: "The benchmark overwrites --cert-file and --key-file, which must be the pair the agent at\n" +
+			"--target watches, with a new leaf and intermediate from its own CA every --interval. Each\n" +
+			"response's chain is checked: a leaf served with another generation's intermediate is a\n" +
+			"mismatched chain, the failure hot reload must never produce.",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "target", Value: "localhost:8443", Usage: "host:port of the agent"},
+			&cli.StringFlag{Name: "server-name", Value: "localhost", Usage: "SNI sent to the agent"},
+			&cli.StringFlag{Name: "cert-file", Usage: "Certificate file the agent watches (overwritten)"},
+			&cli.StringFlag{Name: "key-file", Usage: "Key file the agent watches (overwritten)"},
+			&cli.StringFlag{Name: "key-type", Value: "ecdsa", Usage: "Leaf key type: rsa or ecdsa"},
+			&cli.DurationFlag{Name: "duration", Value: 30 * time.Second, Usage: "How long to sustain load"},
+			&cli.DurationFlag{Name: "interval", Value: 3 * time.Second, Usage: "Time between rotations; keep it above the agent's debounce_interval"},
+			&cli.IntFlag{Name: "concurrency", Value: 0, Usage: "Concurrent clients (0 means runtime.NumCPU() * 2)"},
+		},
+		Action: func(c *cli.Context) error {
+			if c.String("cert-file") == "" || c.String("key-file") == "" {
+				return errors.New("--cert-file and --key-file are required")
+			}
+			concurrency := c.Int("concurrency")
+			if concurrency <= 0 {
+				concurrency = runtime.NumCPU() * 2
+			}
+
+			fmt.Fprintln(progress, "🔄 Rotation Under Load Benchmark")
+			fmt.Fprintln(progress, "=====================================")
+			fmt.Fprintf(progress, "Configuration: %v of load against %s, rotating every %v, %d concurrent clients\n\n",
+				c.Duration("duration"), c.String("target"), c.Duration("interval"), concurrency)
+
+			r, err := newRotator(c.String("cert-file"), c.String("key-file"), c.String("key-type"))
+			if err != nil {
+				return err
+			}
+			result, err := r.run(c.String("target"), c.String("server-name"), c.Duration("duration"), c.Duration("interval"), concurrency)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(progress, result)
+			printRotationResult(result)
+			if err := emitResults(c, "rotate", []RotationResult{result}); err != nil {
+				return err
+			}
+			if result.Mismatched > 0 || result.Stale > 0 {
+				return cli.NewExitError("❌ the agent served an inconsistent certificate chain", 1)
+			}
+			return nil
+		},
+	}
+}
+
+// generation is one rotated pair: its leaf and the intermediate issued
+// with it
+type generation struct {
+	leaf         *x509.Certificate
+	intermediate *x509.Certificate
+	written      time.Time
+	firstServed  time.Time
+}
+
+// rotator issues and writes generations of the agent's pair and checks
+// served chains against them
+type rotator struct {
+	certFile, keyFile string
+	keyType           string
+	root              *x509.Certificate
+	rootKey           crypto.Signer
+
+	mu          sync.Mutex
+	generations []*generation
+	bySerial    map[string]int // leaf serial to generation
+}
+
+func newRotator(certFile, keyFile, keyType string) (*rotator, error) {
+	root, rootKey, err := newBenchmarkCA("Rotation Benchmark Root", 1, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &rotator{
+		certFile: certFile,
+		keyFile:  keyFile,
+		keyType:  keyType,
+		root:     root,
+		rootKey:  rootKey,
+		bySerial: make(map[string]int),
+	}, nil
+}
+
+// rotate issues the next generation, a new intermediate and a leaf signed
+// by it, and atomically replaces the agent's files with it
+func (r *rotator) rotate() error {
+	r.mu.Lock()
+	n := len(r.generations)
+	r.mu.Unlock()
+
+	intermediate, intermediateKey, err := newBenchmarkCA(fmt.Sprintf("Rotation Benchmark Intermediate %d", n), int64(100+n), r.root, r.rootKey)
+	if err != nil {
+		return err
+	}
+	leaf, err := issueBenchmarkCert(intermediate, intermediateKey, r.keyType, int64(100000+n), x509.ExtKeyUsageServerAuth)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(leaf.PrivateKey)
+	if err != nil {
+		return err
+	}
+	leafCert, err := x509.ParseCertificate(leaf.Certificate[0])
+	if err != nil {
+		return err
+	}
+
+	certPEM := append(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Certificate[0]}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: intermediate.Raw})...)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+
+	r.mu.Lock()
+	r.generations = append(r.generations, &generation{leaf: leafCert, intermediate: intermediate, written: time.Now()})
+	r.bySerial[leafCert.SerialNumber.String()] = n
+	r.mu.Unlock()
+
+	// The key first: until the certificate follows, the agent sees a
+	// mismatched pair and keeps serving the previous one
+	if err := replaceFile(r.keyFile, keyPEM, 0600); err != nil {
+		return err
+	}
+	return replaceFile(r.certFile, certPEM, 0644)
+}
+
+// check matches a served chain to the generation it belongs to. ok is
+// false when the chain is not one the rotator wrote: an unknown leaf, or a
+// leaf served without its own intermediate.
+func (r *rotator) check(state tls.ConnectionState) (n int, ok bool) {
+	peer := state.PeerCertificates
+	if len(peer) == 0 {
+		return -1, false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n, known := r.bySerial[peer[0].SerialNumber.String()]
+	if !known || !peer[0].Equal(r.generations[n].leaf) {
+		return -1, false
+	}
+	if len(peer) < 2 || !peer[1].Equal(r.generations[n].intermediate) {
+		return n, false
+	}
+	if r.generations[n].firstServed.IsZero() {
+		r.generations[n].firstServed = time.Now()
+	}
+	return n, true
+}
+
+// served reports whether the latest generation has been served
+func (r *rotator) served() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return !r.generations[len(r.generations)-1].firstServed.IsZero()
+}
+
+// rotationSample is one request made under load
+type rotationSample struct {
+	start   time.Time
+	latency time.Duration
+}
+
+// run writes the first generation and waits for the agent to serve it,
+// then sustains load from concurrency clients for duration while rotating
+// every interval
+func (r *rotator) run(addr, serverName string, duration, interval time.Duration, concurrency int) (RotationResult, error) {
+	// Chains are checked against the generations, not verified to a root
+	config := &tls.Config{ServerName: serverName, InsecureSkipVerify: true, SessionTicketsDisabled: true}
+
+	if err := r.rotate(); err != nil {
+		return RotationResult{}, err
+	}
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		_, state, err := handshakeOnce(addr, config)
+		if err == nil {
+			if n, ok := r.check(state); ok && n == 0 {
+				break
+			}
+		}
+		if time.Now().After(deadline) {
+			return RotationResult{}, fmt.Errorf("%s did not serve the first rotated pair within 30s; are %s and %s the files it watches?",
+				addr, r.certFile, r.keyFile)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	var (
+		stop       atomic.Bool
+		mu         sync.Mutex
+		samples    []rotationSample
+		errCount   int
+		firstErr   error
+		mismatched atomic.Int64
+		stale      atomic.Int64
+		wg         sync.WaitGroup
+	)
+	startTime := time.Now()
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			latest := 0
+			var local []rotationSample
+			for !stop.Load() {
+				start := time.Now()
+				latency, state, err := handshakeOnce(addr, config)
+				if err != nil {
+					mu.Lock()
+					errCount++
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+					continue
+				}
+				local = append(local, rotationSample{start: start, latency: latency})
+				n, ok := r.check(state)
+				switch {
+				case !ok:
+					mismatched.Add(1)
+				case n < latest:
+					// This client already saw a newer pair being served
+					stale.Add(1)
+				default:
+					latest = n
+				}
+			}
+			mu.Lock()
+			samples = append(samples, local...)
+			mu.Unlock()
+		}()
+	}
+
+	ticker := time.NewTicker(interval)
+	end := time.After(duration)
+	rotations := 0
+	var rotateErr error
+load:
+	for rotateErr == nil {
+		select {
+		case <-ticker.C:
+			rotateErr = r.rotate()
+			rotations++
+		case <-end:
+			break load
+		}
+	}
+	ticker.Stop()
+	// Keep the load up until the last rotation is served, or for at most
+	// another interval
+	for wait := time.Now().Add(interval); time.Now().Before(wait) && !r.served(); {
+		time.Sleep(50 * time.Millisecond)
+	}
+	stop.Store(true)
+	wg.Wait()
+	if rotateErr != nil {
+		return RotationResult{}, rotateErr
+	}
+
+	result := RotationResult{
+		Duration:   time.Since(startTime),
+		Rotations:  rotations,
+		Requests:   len(samples) + errCount,
+		Errors:     errCount,
+		Mismatched: int(mismatched.Load()),
+		Stale:      int(stale.Load()),
+	}
+	if result.Requests > 0 {
+		result.ErrorRate = float64(errCount) / float64(result.Requests)
+	}
+	if firstErr != nil {
+		result.FirstError = firstErr.Error()
+	}
+
+	// Split handshake latencies into those shortly after a rotation and
+	// the rest
+	r.mu.Lock()
+	rotated := r.generations[1:]
+	var reloads []time.Duration
+	for _, g := range rotated {
+		if !g.firstServed.IsZero() {
+			result.Observed++
+			reloads = append(reloads, g.firstServed.Sub(g.written))
+		}
+	}
+	var baseline, during []time.Duration
+	for _, s := range samples {
+		inWindow := false
+		for _, g := range rotated {
+			if !s.start.Before(g.written) && s.start.Before(g.written.Add(rotationWindow)) {
+				inWindow = true
+				break
+			}
+		}
+		if inWindow {
+			during = append(during, s.latency)
+		} else {
+			baseline = append(baseline, s.latency)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, d := range [][]time.Duration{baseline, during, reloads} {
+		sort.Slice(d, func(i, j int) bool { return d[i] < d[j] })
+	}
+	result.BaselineP50, result.BaselineP99 = percentile(baseline, 50), percentile(baseline, 99)
+	result.RotationP50, result.RotationP99 = percentile(during, 50), percentile(during, 99)
+	if len(reloads) > 0 {
+		var total time.Duration
+		for _, d := range reloads {
+			total += d
+		}
+		result.ReloadAvg = total / time.Duration(len(reloads))
+		result.ReloadMax = reloads[len(reloads)-1]
+	}
+	return result, nil
+}
+
+func printRotationResult(result RotationResult) {
+	fmt.Fprintln(progress, "\n=== ROTATION UNDER LOAD RESULTS ===")
+	fmt.Fprintf(progress, "%-32s %v\n", "Rotations (observed)", fmt.Sprintf("%d (%d)", result.Rotations, result.Observed))
+	fmt.Fprintf(progress, "%-32s %d\n", "Requests", result.Requests)
+	fmt.Fprintf(progress, "%-32s %d (%.3f%%)\n", "Errors", result.Errors, result.ErrorRate*100)
+	fmt.Fprintf(progress, "%-32s %d\n", "Mismatched chains", result.Mismatched)
+	fmt.Fprintf(progress, "%-32s %d\n", "Stale certificates", result.Stale)
+	fmt.Fprintln(progress, strings.Repeat("-", 60))
+	fmt.Fprintf(progress, "%-32s %-10s %-10s\n", "Handshake latency", "p50", "p99")
+	fmt.Fprintf(progress, "%-32s %-10v %-10v\n", "Baseline", result.BaselineP50.Round(time.Microsecond), result.BaselineP99.Round(time.Microsecond))
+	fmt.Fprintf(progress, "%-32s %-10v %-10v\n", fmt.Sprintf("Within %v of a rotation", rotationWindow),
+		result.RotationP50.Round(time.Microsecond), result.RotationP99.Round(time.Microsecond))
+	fmt.Fprintf(progress, "%-32s avg %v, max %v\n", "Reload latency", result.ReloadAvg.Round(time.Millisecond), result.ReloadMax.Round(time.Millisecond))
+	if result.FirstError != "" {
+		fmt.Fprintf(progress, "First error: %s\n", result.FirstError)
+	}
+	fmt.Fprintln(progress)
+}
+
+// replaceFile atomically replaces path with data, the way deployment tools
+// and the agent's own writers do
+func replaceFile(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
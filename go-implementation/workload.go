@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// workloadTypes are the values of --workload
+var workloadTypes = []string{"io", "cpu", "mixed", "network"}
+
+// workload is the task every goroutine runs. Each kind takes about
+// --duration per task when run alone:
+//
+//   - io sleeps, simulating a blocking call
+//   - cpu hashes for a number of rounds calibrated at startup, so under
+//     contention it takes longer instead of finishing early
+//   - mixed spends half its time hashing and half sleeping
+//   - network makes a TLS connection to a local echo server, which answers
+//     after waiting --duration
+type workload struct {
+	name  string
+	task  func() error
+	close func()
+}
+
+// newWorkload returns the workload called kind, sized for duration
+func newWorkload(kind string, duration time.Duration) (*workload, error) {
+	switch kind {
+	case "io":
+		return &workload{name: kind, task: func() error {
+			time.Sleep(duration)
+			return nil
+		}, close: func() {}}, nil
+	case "cpu":
+		rounds := calibrateHashRounds(duration)
+		return &workload{name: kind, task: func() error {
+			hashRounds(rounds)
+			return nil
+		}, close: func() {}}, nil
+	case "mixed":
+		rounds := calibrateHashRounds(duration / 2)
+		return &workload{name: kind, task: func() error {
+			hashRounds(rounds)
+			time.Sleep(duration / 2)
+			return nil
+		}, close: func() {}}, nil
+	case "network":
+		return newNetworkWorkload(duration)
+	}
+	return nil, fmt.Errorf("--workload must be one of %s, got %q", strings.Join(workloadTypes, ", "), kind)
+}
+
+// hashBlock is what the CPU-bound workloads hash
+var hashBlock = make([]byte, 1024)
+
+// hashRounds hashes hashBlock rounds times, feeding each digest into the
+// next so the work cannot be optimised away
+func hashRounds(rounds int) [sha256.Size]byte {
+	sum := sha256.Sum256(hashBlock)
+	for i := 1; i < rounds; i++ {
+		block := append(sum[:], hashBlock[sha256.Size:]...)
+		sum = sha256.Sum256(block)
+	}
+	return sum
+}
+
+// calibrateHashRounds returns how many rounds of hashRounds take d on one
+// idle core
+func calibrateHashRounds(d time.Duration) int {
+	const sample = 2000
+	hashRounds(sample) // warm up
+	start := time.Now()
+	hashRounds(sample)
+	perRound := time.Since(start) / sample
+	if perRound <= 0 {
+		perRound = time.Nanosecond
+	}
+	if rounds := int(d / perRound); rounds > 0 {
+		return rounds
+	}
+	return 1
+}
+
+// echoMessage is what network tasks send and expect back
+var echoMessage = bytes.Repeat([]byte("ping"), 16)
+
+// newNetworkWorkload starts a TLS echo server on loopback that answers
+// each connection's message after delay, and returns the workload of one
+// connection, handshake and round trip per task
+func newNetworkWorkload(delay time.Duration) (*workload, error) {
+	ca, caKey, err := newBenchmarkCA("Workload Echo CA", 1, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := issueBenchmarkCert(ca, caKey, "ecdsa", 2, x509.ExtKeyUsageServerAuth)
+	if err != nil {
+		return nil, err
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		return nil, err
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer conn.Close()
+				conn.SetDeadline(time.Now().Add(handshakeTimeout + delay))
+				buf := make([]byte, len(echoMessage))
+				if _, err := io.ReadFull(conn, buf); err != nil {
+					return
+				}
+				time.Sleep(delay)
+				conn.Write(buf)
+			}()
+		}
+	}()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	config := &tls.Config{ServerName: "localhost", RootCAs: pool}
+	addr := ln.Addr().String()
+	return &workload{
+		name: "network",
+		task: func() error {
+			dialer := &net.Dialer{Timeout: handshakeTimeout}
+			conn, err := tls.DialWithDialer(dialer, "tcp", addr, config)
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(handshakeTimeout + delay))
+			if _, err := conn.Write(echoMessage); err != nil {
+				return err
+			}
+			buf := make([]byte, len(echoMessage))
+			if _, err := io.ReadFull(conn, buf); err != nil {
+				return err
+			}
+			if !bytes.Equal(buf, echoMessage) {
+				return errors.New("echo server returned different bytes")
+			}
+			return nil
+		},
+		close: func() {
+			ln.Close()
+			wg.Wait()
+		},
+	}, nil
+}
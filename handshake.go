@@ -0,0 +1,48 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"slices"
+	"time"
+
+	"tls-agent/internal/features"
+	"tls-agent/internal/handshake"
+)
+
+// buildHandshakeLimiter returns the limiter shared by the TLS listeners, or
+// nil when no limit is configured
+func buildHandshakeLimiter(cfg features.HandshakeLimitsConfig) *handshake.Limiter {
+	if !cfg.Enabled() {
+		return nil
+	}
+	return handshake.NewLimiter(handshake.Limits{
+		MaxConcurrent: cfg.MaxConcurrent,
+		Rate:          cfg.Rate,
+		Burst:         cfg.Burst,
+		RatePerIP:     cfg.RatePerIP,
+		BurstPerIP:    cfg.BurstPerIP,
+		Reject:        cfg.Overflow == "reject",
+		QueueTimeout:  time.Duration(cfg.QueueTimeout) * time.Second,
+		Timeout:       time.Duration(cfg.Timeout) * time.Second,
+	})
+}
+
+// handshakeConfig prepares server for connections handshaken outside
+// ServeTLS: it advertises the enabled protocols the way ServeTLS would,
+// which also makes Serve set up HTTP/2 for the negotiated connections. It
+// must run before the server starts.
+func handshakeConfig(server *http.Server) *tls.Config {
+	cfg := server.TLSConfig
+	h2 := server.TLSNextProto == nil
+	if server.Protocols != nil {
+		h2 = server.Protocols.HTTP2()
+	}
+	if h2 && !slices.Contains(cfg.NextProtos, "h2") {
+		cfg.NextProtos = append(cfg.NextProtos, "h2")
+	}
+	if !slices.Contains(cfg.NextProtos, "http/1.1") {
+		cfg.NextProtos = append(cfg.NextProtos, "http/1.1")
+	}
+	return cfg
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"testing"
+
+	"tls-agent/internal/features"
+)
+
+// TestServeTLSWithHandshakeLimits tests serving HTTP/2 through the handshake limiter
+func TestServeTLSWithHandshakeLimits(t *testing.T) {
+	if buildHandshakeLimiter(features.HandshakeLimitsConfig{}) != nil {
+		t.Error("Expected no limiter without limits")
+	}
+	limiter := buildHandshakeLimiter(features.HandshakeLimitsConfig{MaxConcurrent: 2, Overflow: "reject"})
+
+	certFile, keyFile := writeTestPair(t, t.TempDir(), "server")
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Failed to load pair: %v", err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	server := &http.Server{
+		Handler:   http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		TLSConfig: &tls.Config{Certificates: []tls.Certificate{cert}},
+	}
+	serve := listenerOptions{limiter: limiter, http2: features.HTTP2Config{Enabled: true}}.serve(server, ln, "test")
+	go serve()
+	defer server.Close()
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		ForceAttemptHTTP2: true,
+	}}
+	resp, err := client.Get("https://" + ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to get: %v", err)
+	}
+	resp.Body.Close()
+	if resp.ProtoMajor != 2 {
+		t.Errorf("Expected HTTP/2, got %s", resp.Proto)
+	}
+}
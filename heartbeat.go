@@ -0,0 +1,42 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	"tls-agent/internal/agent"
+	"tls-agent/internal/features"
+	"tls-agent/internal/health"
+	"tls-agent/internal/heartbeat"
+	"tls-agent/internal/tlsstore"
+)
+
+// buildHeartbeat returns a sender reporting the served certificate, the
+// last reload and, when health checks are enabled, their report
+func buildHeartbeat(cfg features.HeartbeatConfig, healthChecks bool, store *tlsstore.Store, state *agent.State) *heartbeat.Sender {
+	host, _ := os.Hostname()
+	return &heartbeat.Sender{
+		URL:      cfg.URL,
+		FailURL:  cfg.FailURL,
+		Interval: time.Duration(cfg.Interval) * time.Second,
+		Status: func() heartbeat.Status {
+			status := heartbeat.Status{Time: time.Now(), Host: host, Healthy: store.IsValid()}
+			if leaf := store.Leaf(); leaf != nil {
+				status.CertificateExpiry = leaf.NotAfter
+			}
+			if history := state.History(); len(history) > 0 {
+				status.LastReload = history[0].Time
+				status.LastReloadResult = history[0].Result
+			}
+			if lastErr := state.GetLastError(); lastErr != nil {
+				status.LastError = lastErr.Message
+			}
+			if healthChecks {
+				report := health.Default.Run()
+				status.Health = report
+				status.Healthy = status.Healthy && report.Status == "ok"
+			}
+			return status
+		},
+	}
+}
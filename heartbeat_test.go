@@ -0,0 +1,37 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"testing"
+
+	"tls-agent/internal/agent"
+	"tls-agent/internal/features"
+	"tls-agent/internal/tlsstore"
+)
+
+// TestBuildHeartbeat tests the reported status
+func TestBuildHeartbeat(t *testing.T) {
+	certFile, keyFile := writeTestPair(t, t.TempDir(), "server")
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Failed to load pair: %v", err)
+	}
+	store := tlsstore.New(&cert)
+	state := &agent.State{}
+	sender := buildHeartbeat(features.HeartbeatConfig{URL: "http://monitor", Interval: 60}, false, store, state)
+
+	status := sender.Status()
+	if !status.Healthy || !status.CertificateExpiry.Equal(store.Leaf().NotAfter) {
+		t.Errorf("Expected a healthy status with the certificate expiry, got %+v", status)
+	}
+
+	state.SetLastError(agent.SourceReload, errors.New("bad key"))
+	if status := sender.Status(); status.LastError != "bad key" {
+		t.Errorf("Expected the last error, got %+v", status)
+	}
+
+	if status := buildHeartbeat(features.HeartbeatConfig{}, false, tlsstore.New(nil), state).Status(); status.Healthy {
+		t.Error("Expected no certificate to be unhealthy")
+	}
+}
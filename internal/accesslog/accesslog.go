@@ -0,0 +1,161 @@
+// Package accesslog writes one structured (JSON) line per HTTP request,
+// including the TLS details of the connection it arrived on: protocol
+// version, cipher suite, SNI and the client certificate subject.
+package accesslog
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+
+	"tls-agent/internal/requestid"
+)
+
+// Entry is one access log line
+type Entry struct {
+	Time       time.Time `json:"time"`
+	Method     string    `json:"method"`
+	Host       string    `json:"host"`
+	Path       string    `json:"path"`
+	Proto      string    `json:"proto"`
+	RemoteAddr string    `json:"remote_addr"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	DurationMS float64   `json:"duration_ms"`
+
+	TLSVersion    string `json:"tls_version,omitempty"`
+	CipherSuite   string `json:"cipher_suite,omitempty"`
+	ServerName    string `json:"sni,omitempty"`
+	ClientSubject string `json:"client_subject,omitempty"`
+
+	RequestID string `json:"request_id,omitempty"`
+	TraceID   string `json:"trace_id,omitempty"`
+}
+
+// Logger writes access log entries
+type Logger struct {
+	// Out receives one JSON object per line; nil logs through the log
+	// package with an "ACCESS:" prefix
+	Out io.Writer
+
+	// SampleRate is the fraction of successful requests logged, from 0 to
+	// 1. Errors (status 400 and above) are always logged.
+	SampleRate float64
+
+	// ErrorsOnly logs only requests answered with status 400 and above
+	ErrorsOnly bool
+
+	random func() float64
+	mu     sync.Mutex
+}
+
+// Middleware logs requests served by next
+func (l *Logger) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &recorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if !l.sampled(rec.status()) {
+			return
+		}
+
+		e := Entry{
+			Time:       start.UTC(),
+			Method:     r.Method,
+			Host:       r.Host,
+			Path:       r.URL.Path,
+			Proto:      r.Proto,
+			RemoteAddr: r.RemoteAddr,
+			Status:     rec.status(),
+			Bytes:      rec.bytes,
+			DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+		}
+		if r.TLS != nil {
+			e.TLSVersion = tls.VersionName(r.TLS.Version)
+			e.CipherSuite = tls.CipherSuiteName(r.TLS.CipherSuite)
+			e.ServerName = r.TLS.ServerName
+			if len(r.TLS.PeerCertificates) > 0 {
+				e.ClientSubject = r.TLS.PeerCertificates[0].Subject.String()
+			}
+		}
+		if info, ok := requestid.FromContext(r.Context()); ok {
+			e.RequestID = info.RequestID
+			e.TraceID = info.TraceID
+		}
+		l.write(e)
+	})
+}
+
+// sampled reports whether a request answered with status is logged
+func (l *Logger) sampled(status int) bool {
+	if status >= http.StatusBadRequest {
+		return true
+	}
+	if l.ErrorsOnly || l.SampleRate <= 0 {
+		return false
+	}
+	if l.SampleRate >= 1 {
+		return true
+	}
+	random := rand.Float64
+	if l.random != nil {
+		random = l.random
+	}
+	return random() < l.SampleRate
+}
+
+func (l *Logger) write(e Entry) {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	if l.Out == nil {
+		log.Printf("ACCESS: %s", line)
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = l.Out.Write(append(line, '\n'))
+}
+
+// recorder captures the status and size of a response
+type recorder struct {
+	http.ResponseWriter
+	code  int
+	bytes int64
+}
+
+func (r *recorder) WriteHeader(code int) {
+	// Informational responses precede the final status
+	if r.code == 0 && code >= http.StatusOK {
+		r.code = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	if r.code == 0 {
+		r.code = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(p)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, which
+// the reverse proxy uses to flush streamed responses
+func (r *recorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+func (r *recorder) status() int {
+	if r.code == 0 {
+		return http.StatusOK
+	}
+	return r.code
+}
@@ -0,0 +1,83 @@
+package accesslog
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tls-agent/internal/requestid"
+)
+
+// TestMiddleware tests the logged fields
+func TestMiddleware(t *testing.T) {
+	var out bytes.Buffer
+	l := &Logger{Out: &out, SampleRate: 1}
+	h := requestid.Middleware{}.Wrap(l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	})))
+
+	req := httptest.NewRequest(http.MethodPost, "https://api.example.com/items", nil)
+	req.TLS = &tls.ConnectionState{
+		Version:          tls.VersionTLS13,
+		CipherSuite:      tls.TLS_AES_128_GCM_SHA256,
+		ServerName:       "api.example.com",
+		PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "client"}}},
+	}
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	var e Entry
+	if err := json.Unmarshal(out.Bytes(), &e); err != nil {
+		t.Fatalf("Failed to parse entry %q: %v", out.String(), err)
+	}
+	if e.Method != "POST" || e.Path != "/items" || e.Status != http.StatusCreated || e.Bytes != 5 {
+		t.Errorf("Unexpected request fields %+v", e)
+	}
+	if e.TLSVersion != "TLS 1.3" || e.CipherSuite != "TLS_AES_128_GCM_SHA256" || e.ServerName != "api.example.com" || e.ClientSubject != "CN=client" {
+		t.Errorf("Unexpected TLS fields %+v", e)
+	}
+	if len(e.TraceID) != 32 || e.RequestID != e.TraceID {
+		t.Errorf("Expected the assigned request and trace IDs, got %q and %q", e.RequestID, e.TraceID)
+	}
+}
+
+// TestSampling tests sampling and errors-only logging
+func TestSampling(t *testing.T) {
+	status := http.StatusOK
+	h := func(l *Logger) http.Handler {
+		return l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		}))
+	}
+	count := func(l *Logger, n int) int {
+		for i := 0; i < n; i++ {
+			h(l).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		}
+		return strings.Count(l.Out.(*bytes.Buffer).String(), "\n")
+	}
+
+	draws := []float64{0.1, 0.9, 0.2, 0.8}
+	sampled := &Logger{Out: &bytes.Buffer{}, SampleRate: 0.5, random: func() float64 {
+		d := draws[0]
+		draws = draws[1:]
+		return d
+	}}
+	if got := count(sampled, 4); got != 2 {
+		t.Errorf("Expected 2 of 4 requests sampled, got %d", got)
+	}
+
+	errorsOnly := &Logger{Out: &bytes.Buffer{}, SampleRate: 1, ErrorsOnly: true}
+	if got := count(errorsOnly, 3); got != 0 {
+		t.Errorf("Expected successful requests to be skipped, got %d", got)
+	}
+	status = http.StatusBadGateway
+	if got := count(errorsOnly, 2); got != 2 {
+		t.Errorf("Expected errors to be logged, got %d", got)
+	}
+}
@@ -0,0 +1,400 @@
+// Package acme obtains and renews the served certificate from an ACME CA
+// such as Let's Encrypt. Challenges are answered with DNS-01 records
+// published through a Provider, so wildcard names and hosts that the CA
+// cannot reach on :80 or :443 can be issued.
+package acme
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"tls-agent/internal/clock"
+	"tls-agent/internal/metrics"
+	"tls-agent/internal/storage"
+	"tls-agent/internal/tlsstore"
+
+	"golang.org/x/crypto/acme"
+)
+
+// Well-known ACME directories
+const (
+	LetsEncrypt        = acme.LetsEncryptURL
+	LetsEncryptStaging = "https://acme-staging-v02.api.letsencrypt.org/directory"
+	ZeroSSL            = "https://acme.zerossl.com/v2/DV90"
+	GooglePublicCA     = "https://dv.acme-v02.api.pki.goog/directory"
+	GoogleStaging      = "https://dv.acme-v02.test-api.pki.goog/directory"
+)
+
+// directories maps the short names accepted by Directory to their URLs
+var directories = map[string]string{
+	"letsencrypt":         LetsEncrypt,
+	"letsencrypt-staging": LetsEncryptStaging,
+	"zerossl":             ZeroSSL,
+	"google":              GooglePublicCA,
+	"google-staging":      GoogleStaging,
+}
+
+// Directory resolves a short CA name such as "zerossl" to its directory
+// URL; anything else, such as a private step-ca URL, is returned unchanged
+func Directory(name string) string {
+	if u, ok := directories[strings.ToLower(name)]; ok {
+		return u
+	}
+	return name
+}
+
+// ErrEABRequired is returned when the CA only accepts accounts bound to an
+// external account and no binding is configured
+var ErrEABRequired = errors.New("acme: the CA requires external account binding credentials")
+
+// DefaultRenewBefore is how long before expiry a certificate is renewed
+const DefaultRenewBefore = 30 * 24 * time.Hour
+
+var orders = metrics.NewCounterVec("tls_agent_acme_orders_total",
+	"ACME certificate orders by result (success, failed)", "result")
+
+// Config configures an Issuer
+type Config struct {
+	// DirectoryURL is the CA's ACME directory; defaults to LetsEncrypt
+	DirectoryURL string
+
+	// RootCAs verifies the directory's TLS certificate, for private CAs
+	// served under an internal root; nil uses the system roots
+	RootCAs *x509.CertPool
+
+	// EABKeyID and EABKey bind the account to an existing account at the
+	// CA, as ZeroSSL, Google Public CA and many private CAs require. EABKey
+	// is the raw HMAC key.
+	EABKeyID string
+	EABKey   []byte
+
+	// Email is the account contact; optional
+	Email string
+
+	// Domains are the certificate's names; the first is its common name.
+	// Wildcards such as *.example.com are allowed.
+	Domains []string
+
+	// CertFile and KeyFile receive the issued chain and its private key.
+	// The agent's watcher picks them up like any other certificate change.
+	CertFile string
+	KeyFile  string
+
+	// RenewBefore is how long before expiry to renew; defaults to
+	// DefaultRenewBefore
+	RenewBefore time.Duration
+
+	// Provider publishes the DNS-01 challenge records
+	Provider Provider
+
+	// Propagation bounds the wait for challenge records to become visible;
+	// defaults to DefaultPropagationTimeout
+	Propagation time.Duration
+
+	// Storage keeps the account key across restarts
+	Storage storage.Storage
+
+	// Clock schedules renewal checks and judges the renewal window;
+	// defaults to the wall clock
+	Clock clock.Clock
+}
+
+// Issuer obtains certificates for Config.Domains and renews them
+type Issuer struct {
+	cfg Config
+
+	// lookupTXT resolves challenge records while waiting for propagation
+	lookupTXT func(ctx context.Context, name string) ([]string, error)
+}
+
+// New creates an issuer
+func New(cfg Config) (*Issuer, error) {
+	if len(cfg.Domains) == 0 {
+		return nil, errors.New("acme: no domains")
+	}
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, errors.New("acme: cert and key files are required")
+	}
+	if cfg.Provider == nil {
+		return nil, errors.New("acme: no DNS provider")
+	}
+	if cfg.Storage == nil {
+		return nil, errors.New("acme: no storage for the account key")
+	}
+	if cfg.DirectoryURL == "" {
+		cfg.DirectoryURL = LetsEncrypt
+	}
+	cfg.DirectoryURL = Directory(cfg.DirectoryURL)
+	if cfg.EABKeyID != "" && len(cfg.EABKey) == 0 {
+		return nil, errors.New("acme: external account binding needs an HMAC key")
+	}
+	if cfg.RenewBefore <= 0 {
+		cfg.RenewBefore = DefaultRenewBefore
+	}
+	if cfg.Propagation <= 0 {
+		cfg.Propagation = DefaultPropagationTimeout
+	}
+	cfg.Clock = clock.Or(cfg.Clock)
+	return &Issuer{cfg: cfg, lookupTXT: lookupTXT}, nil
+}
+
+// NeedsRenewal reports why the certificate in CertFile should be replaced,
+// or "" when it is still good
+func (i *Issuer) NeedsRenewal() string {
+	data, err := os.ReadFile(i.cfg.CertFile)
+	if err != nil {
+		return "no certificate"
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return "unreadable certificate"
+	}
+	leaf, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return "unreadable certificate"
+	}
+
+	names := slices.Clone(leaf.DNSNames)
+	slices.Sort(names)
+	want := slices.Clone(i.cfg.Domains)
+	slices.Sort(want)
+	if !slices.Equal(names, want) {
+		return "domains changed"
+	}
+	if left := leaf.NotAfter.Sub(i.cfg.Clock.Now()); left < i.cfg.RenewBefore {
+		return fmt.Sprintf("expires in %s", left.Round(time.Hour))
+	}
+	return ""
+}
+
+// Run renews the certificate whenever NeedsRenewal says so, checking every
+// interval until ctx is done. Failures are retried on the next check.
+func (i *Issuer) Run(ctx context.Context, interval time.Duration) {
+	ticker := i.cfg.Clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if reason := i.NeedsRenewal(); reason != "" {
+			log.Printf("ACME: requesting certificate for %s (%s)", strings.Join(i.cfg.Domains, ", "), reason)
+			if err := i.Obtain(ctx); err != nil {
+				log.Printf("ACME: certificate order failed: %v", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+	}
+}
+
+// Obtain orders a certificate for Config.Domains and writes it to CertFile
+// and KeyFile
+func (i *Issuer) Obtain(ctx context.Context) error {
+	err := i.obtain(ctx)
+	if err != nil {
+		orders.With("failed").Inc()
+		return err
+	}
+	orders.With("success").Inc()
+	return nil
+}
+
+func (i *Issuer) obtain(ctx context.Context) error {
+	client, err := i.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	order, err := client.AuthorizeOrder(ctx, acme.DomainIDs(i.cfg.Domains...))
+	if err != nil {
+		return fmt.Errorf("acme: new order: %w", err)
+	}
+	for _, u := range order.AuthzURLs {
+		if err := i.authorize(ctx, client, u); err != nil {
+			return err
+		}
+	}
+	if _, err := client.WaitOrder(ctx, order.URI); err != nil {
+		return fmt.Errorf("acme: order: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: i.cfg.Domains[0]},
+		DNSNames: i.cfg.Domains,
+	}, key)
+	if err != nil {
+		return err
+	}
+	chain, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return fmt.Errorf("acme: finalize: %w", err)
+	}
+	return i.write(chain, key)
+}
+
+// authorize answers the DNS-01 challenge of one authorization
+func (i *Issuer) authorize(ctx context.Context, client *acme.Client, authzURL string) error {
+	authz, err := client.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return fmt.Errorf("acme: authorization: %w", err)
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+
+	var chal *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == "dns-01" {
+			chal = c
+			break
+		}
+	}
+	if chal == nil {
+		return fmt.Errorf("acme: %s offers no dns-01 challenge", authz.Identifier.Value)
+	}
+
+	value, err := client.DNS01ChallengeRecord(chal.Token)
+	if err != nil {
+		return err
+	}
+	fqdn := ChallengeFQDN(authz.Identifier.Value)
+	if err := i.cfg.Provider.Present(ctx, fqdn, value); err != nil {
+		return fmt.Errorf("acme: publish %s: %w", fqdn, err)
+	}
+	defer func() {
+		if err := i.cfg.Provider.CleanUp(context.WithoutCancel(ctx), fqdn, value); err != nil {
+			log.Printf("ACME: failed to remove %s: %v", fqdn, err)
+		}
+	}()
+
+	if err := i.waitPropagation(ctx, fqdn, value); err != nil {
+		return err
+	}
+	if _, err := client.Accept(ctx, chal); err != nil {
+		return fmt.Errorf("acme: accept challenge for %s: %w", authz.Identifier.Value, err)
+	}
+	if _, err := client.WaitAuthorization(ctx, authz.URI); err != nil {
+		return fmt.Errorf("acme: authorize %s: %w", authz.Identifier.Value, err)
+	}
+	return nil
+}
+
+// write stores the issued chain and key where the agent loads them. A
+// reload between the two writes fails the pair check and is retried when
+// the certificate lands.
+func (i *Issuer) write(chain [][]byte, key crypto.Signer) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	var certPEM []byte
+	for _, c := range chain {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c})...)
+	}
+
+	if err := tlsstore.WriteKeyFile(i.cfg.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})); err != nil {
+		return err
+	}
+	return tlsstore.WriteFile(i.cfg.CertFile, certPEM, 0644)
+}
+
+// client returns a client for the configured CA with a registered account
+func (i *Issuer) client(ctx context.Context) (*acme.Client, error) {
+	key, err := i.accountKey()
+	if err != nil {
+		return nil, err
+	}
+	client := &acme.Client{Key: key, DirectoryURL: i.cfg.DirectoryURL, UserAgent: "tls-agent"}
+	if i.cfg.RootCAs != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{RootCAs: i.cfg.RootCAs}
+		client.HTTPClient = &http.Client{Transport: transport}
+	}
+
+	dir, err := client.Discover(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("acme: directory %s: %w", i.cfg.DirectoryURL, err)
+	}
+	account := &acme.Account{}
+	if i.cfg.Email != "" {
+		account.Contact = []string{"mailto:" + i.cfg.Email}
+	}
+	if i.cfg.EABKeyID != "" {
+		account.ExternalAccountBinding = &acme.ExternalAccountBinding{KID: i.cfg.EABKeyID, Key: i.cfg.EABKey}
+	} else if dir.ExternalAccountRequired {
+		return nil, ErrEABRequired
+	}
+	if _, err := client.Register(ctx, account, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return nil, fmt.Errorf("acme: register account: %w", err)
+	}
+	return client, nil
+}
+
+// accountKey loads the account key for the configured CA, creating it on
+// first use. Each directory gets its own key.
+func (i *Issuer) accountKey() (crypto.Signer, error) {
+	name := accountKeyName(i.cfg.DirectoryURL)
+	data, _, err := i.cfg.Storage.Get(name)
+	if err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("acme: %s is not PEM", name)
+		}
+		tlsstore.AuditKey("loaded", "acme account "+name)
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	if !errors.Is(err, storage.ErrNotExist) {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := i.cfg.Storage.Put(name, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})); err != nil {
+		return nil, err
+	}
+	tlsstore.AuditKey("written", "acme account "+name)
+	return key, nil
+}
+
+// accountKeyName is the storage key of the account key for directory. The
+// path is part of the name because private CAs such as step-ca serve one
+// directory per provisioner on the same host.
+func accountKeyName(directory string) string {
+	name := "default"
+	if u, err := url.Parse(directory); err == nil && u.Host != "" {
+		name = strings.ReplaceAll(u.Host, ":", "_")
+		if p := strings.Trim(path.Clean("/"+u.Path), "/"); p != "" {
+			name += "/" + p
+		}
+	}
+	return "accounts/" + name + "/key.pem"
+}
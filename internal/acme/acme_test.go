@@ -0,0 +1,400 @@
+package acme
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"tls-agent/internal/clock"
+	"tls-agent/internal/storage"
+)
+
+// fakeCA is a minimal RFC 8555 server that issues for every dns-01
+// challenge it is asked to validate. It does not verify JWS signatures.
+type fakeCA struct {
+	t      *testing.T
+	server *httptest.Server
+	ca     *x509.Certificate
+	caKey  *ecdsa.PrivateKey
+
+	// requireEAB makes the CA demand external account binding
+	requireEAB bool
+
+	mu        sync.Mutex
+	names     []string
+	validated map[string]bool
+	cert      []byte
+	eabKeyID  string
+}
+
+func newFakeCA(t *testing.T) *fakeCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate CA key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Fake ACME CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create CA: %v", err)
+	}
+	ca, _ := x509.ParseCertificate(der)
+
+	f := &fakeCA{t: t, ca: ca, caKey: key, validated: make(map[string]bool)}
+	f.server = httptest.NewTLSServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeCA) serve(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Replay-Nonce", "nonce")
+	url := f.server.URL
+
+	var payload []byte
+	if r.Method == http.MethodPost {
+		var jws struct {
+			Payload string `json:"payload"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&jws); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		payload, _ = base64.RawURLEncoding.DecodeString(jws.Payload)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	reply := func(status int, v any) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(v)
+	}
+	order := func() map[string]any {
+		status := "pending"
+		if f.allValidated() {
+			status = "ready"
+		}
+		if f.cert != nil {
+			status = "valid"
+		}
+		var authz []string
+		for _, name := range f.names {
+			authz = append(authz, url+"/authz/"+name)
+		}
+		return map[string]any{"status": status, "authorizations": authz, "finalize": url + "/finalize", "certificate": url + "/cert"}
+	}
+
+	switch path := r.URL.Path; {
+	case path == "/directory":
+		reply(http.StatusOK, map[string]any{
+			"newNonce": url + "/nonce", "newAccount": url + "/account", "newOrder": url + "/order",
+			"meta": map[string]bool{"externalAccountRequired": f.requireEAB},
+		})
+	case path == "/nonce":
+		w.WriteHeader(http.StatusOK)
+	case path == "/account":
+		var req struct {
+			EAB *struct {
+				Protected string `json:"protected"`
+			} `json:"externalAccountBinding"`
+		}
+		_ = json.Unmarshal(payload, &req)
+		if req.EAB != nil {
+			var protected struct {
+				KID string `json:"kid"`
+			}
+			data, _ := base64.RawURLEncoding.DecodeString(req.EAB.Protected)
+			_ = json.Unmarshal(data, &protected)
+			f.eabKeyID = protected.KID
+		}
+		w.Header().Set("Location", url+"/account/1")
+		reply(http.StatusCreated, map[string]string{"status": "valid"})
+	case path == "/order":
+		var req struct {
+			Identifiers []struct{ Value string } `json:"identifiers"`
+		}
+		_ = json.Unmarshal(payload, &req)
+		f.names = nil
+		for _, id := range req.Identifiers {
+			f.names = append(f.names, id.Value)
+		}
+		w.Header().Set("Location", url+"/order/1")
+		reply(http.StatusCreated, order())
+	case path == "/order/1":
+		reply(http.StatusOK, order())
+	case len(path) > len("/authz/") && path[:len("/authz/")] == "/authz/":
+		name := path[len("/authz/"):]
+		status := "pending"
+		if f.validated[name] {
+			status = "valid"
+		}
+		reply(http.StatusOK, map[string]any{
+			"status":     status,
+			"identifier": map[string]string{"type": "dns", "value": name},
+			"challenges": []map[string]string{{"type": "dns-01", "url": url + "/chal/" + name, "token": "token-" + name, "status": status}},
+		})
+	case len(path) > len("/chal/") && path[:len("/chal/")] == "/chal/":
+		name := path[len("/chal/"):]
+		f.validated[name] = true
+		reply(http.StatusOK, map[string]string{"type": "dns-01", "url": url + path, "token": "token-" + name, "status": "valid"})
+	case path == "/finalize":
+		var req struct {
+			CSR string `json:"csr"`
+		}
+		_ = json.Unmarshal(payload, &req)
+		der, _ := base64.RawURLEncoding.DecodeString(req.CSR)
+		csr, err := x509.ParseCertificateRequest(der)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(2),
+			Subject:      csr.Subject,
+			DNSNames:     csr.DNSNames,
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+		}
+		f.cert, err = x509.CreateCertificate(rand.Reader, tmpl, f.ca, csr.PublicKey, f.caKey)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		reply(http.StatusOK, order())
+	case path == "/cert":
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		_ = pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: f.cert})
+		_ = pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: f.ca.Raw})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// roots returns a pool trusting the CA's TLS certificate
+func (f *fakeCA) roots() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(f.server.Certificate())
+	return pool
+}
+
+func (f *fakeCA) allValidated() bool {
+	for _, name := range f.names {
+		if !f.validated[name] {
+			return false
+		}
+	}
+	return len(f.names) > 0
+}
+
+// fakeDNS records challenge records as a Provider and serves them to the
+// propagation check
+type fakeDNS struct {
+	mu      sync.Mutex
+	records map[string][]string
+	removed int
+}
+
+func (d *fakeDNS) Present(_ context.Context, fqdn, value string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.records == nil {
+		d.records = make(map[string][]string)
+	}
+	d.records[fqdn] = append(d.records[fqdn], value)
+	return nil
+}
+
+func (d *fakeDNS) CleanUp(_ context.Context, fqdn, value string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.records[fqdn] = slices.DeleteFunc(d.records[fqdn], func(v string) bool { return v == value })
+	d.removed++
+	return nil
+}
+
+func (d *fakeDNS) lookup(_ context.Context, name string) ([]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return slices.Clone(d.records[name]), nil
+}
+
+func newTestIssuer(t *testing.T, directory string, dns *fakeDNS, domains ...string) *Issuer {
+	dir := t.TempDir()
+	issuer, err := New(Config{
+		DirectoryURL: directory,
+		Domains:      domains,
+		CertFile:     filepath.Join(dir, "tls.crt"),
+		KeyFile:      filepath.Join(dir, "tls.key"),
+		Provider:     dns,
+		Storage:      &storage.FS{Dir: filepath.Join(dir, "acme")},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create issuer: %v", err)
+	}
+	issuer.lookupTXT = dns.lookup
+	return issuer
+}
+
+// TestObtainDNS01 tests issuing a wildcard certificate through DNS-01
+func TestObtainDNS01(t *testing.T) {
+	ca := newFakeCA(t)
+	dns := &fakeDNS{}
+	issuer := newTestIssuer(t, ca.server.URL+"/directory", dns, "example.com", "*.example.com")
+	issuer.cfg.RootCAs = ca.roots()
+
+	if reason := issuer.NeedsRenewal(); reason != "no certificate" {
+		t.Errorf("Expected renewal for a missing certificate, got %q", reason)
+	}
+	if err := issuer.Obtain(context.Background()); err != nil {
+		t.Fatalf("Failed to obtain certificate: %v", err)
+	}
+
+	cert, err := tls.LoadX509KeyPair(issuer.cfg.CertFile, issuer.cfg.KeyFile)
+	if err != nil {
+		t.Fatalf("Failed to load issued pair: %v", err)
+	}
+	if len(cert.Certificate) != 2 {
+		t.Errorf("Expected leaf and issuer in the chain, got %d certificates", len(cert.Certificate))
+	}
+	if dns.removed != 2 || len(dns.records["_acme-challenge.example.com"]) != 0 {
+		t.Errorf("Expected both challenge records to be cleaned up, got %v", dns.records)
+	}
+	if reason := issuer.NeedsRenewal(); reason != "" {
+		t.Errorf("Expected a fresh certificate to need no renewal, got %q", reason)
+	}
+
+	issuer.cfg.Domains = []string{"example.com"}
+	if reason := issuer.NeedsRenewal(); reason != "domains changed" {
+		t.Errorf("Expected renewal after a domain change, got %q", reason)
+	}
+	issuer.cfg.Domains = []string{"example.com", "*.example.com"}
+	issuer.cfg.Clock = clock.NewFake(time.Now().Add(70 * 24 * time.Hour))
+	if reason := issuer.NeedsRenewal(); reason == "" {
+		t.Error("Expected renewal inside the renewal window")
+	}
+}
+
+// TestAccountKeyReused tests that the account key is created once per CA
+func TestAccountKeyReused(t *testing.T) {
+	issuer := newTestIssuer(t, "https://acme.example.com/directory", &fakeDNS{}, "example.com")
+
+	first, err := issuer.accountKey()
+	if err != nil {
+		t.Fatalf("Failed to create account key: %v", err)
+	}
+	second, err := issuer.accountKey()
+	if err != nil {
+		t.Fatalf("Failed to load account key: %v", err)
+	}
+	if !first.(*ecdsa.PrivateKey).Equal(second) {
+		t.Error("Expected the stored account key to be reused")
+	}
+	if _, _, err := issuer.cfg.Storage.Get("accounts/acme.example.com/directory/key.pem"); err != nil {
+		t.Errorf("Expected the account key under the CA's directory: %v", err)
+	}
+}
+
+// TestExternalAccountBinding tests registering with a CA that requires EAB
+func TestExternalAccountBinding(t *testing.T) {
+	ca := newFakeCA(t)
+	ca.requireEAB = true
+	issuer := newTestIssuer(t, ca.server.URL+"/directory", &fakeDNS{}, "example.com")
+	issuer.cfg.RootCAs = ca.roots()
+
+	if _, err := issuer.client(context.Background()); !errors.Is(err, ErrEABRequired) {
+		t.Fatalf("Expected ErrEABRequired without credentials, got %v", err)
+	}
+
+	issuer.cfg.EABKeyID = "kid-1"
+	issuer.cfg.EABKey = []byte("hmac-key")
+	if _, err := issuer.client(context.Background()); err != nil {
+		t.Fatalf("Failed to register with EAB: %v", err)
+	}
+	if ca.eabKeyID != "kid-1" {
+		t.Errorf("Expected the binding to carry kid-1, got %q", ca.eabKeyID)
+	}
+}
+
+// TestUntrustedDirectory tests that a private CA needs its root configured
+func TestUntrustedDirectory(t *testing.T) {
+	ca := newFakeCA(t)
+	issuer := newTestIssuer(t, ca.server.URL+"/directory", &fakeDNS{}, "example.com")
+
+	if _, err := issuer.client(context.Background()); err == nil {
+		t.Error("Expected the directory's certificate to be rejected without RootCAs")
+	}
+}
+
+// TestDirectory tests short CA names and account key names
+func TestDirectory(t *testing.T) {
+	if Directory("ZeroSSL") != ZeroSSL || Directory("letsencrypt-staging") != LetsEncryptStaging {
+		t.Error("Expected short names to resolve to directory URLs")
+	}
+	private := "https://ca.internal:9000/acme/prov/directory"
+	if Directory(private) != private {
+		t.Errorf("Expected URLs to be returned unchanged, got %s", Directory(private))
+	}
+	if got := accountKeyName(private); got != "accounts/ca.internal_9000/acme/prov/directory/key.pem" {
+		t.Errorf("Unexpected account key name %s", got)
+	}
+}
+
+// TestPropagationTimeout tests that an invisible record fails the order
+// before the CA is asked to validate it
+func TestPropagationTimeout(t *testing.T) {
+	issuer := newTestIssuer(t, "https://acme.example.com/directory", &fakeDNS{}, "example.com")
+	issuer.cfg.Propagation = 50 * time.Millisecond
+	defer func(poll time.Duration) { propagationPoll = poll }(propagationPoll)
+	propagationPoll = 10 * time.Millisecond
+
+	if err := issuer.waitPropagation(context.Background(), "_acme-challenge.example.com", "value"); err == nil {
+		t.Error("Expected a propagation timeout")
+	}
+}
+
+// TestChallengeFQDN tests challenge record names
+func TestChallengeFQDN(t *testing.T) {
+	for domain, want := range map[string]string{
+		"example.com":      "_acme-challenge.example.com",
+		"*.example.com":    "_acme-challenge.example.com",
+		"www.example.com.": "_acme-challenge.www.example.com",
+	} {
+		if got := ChallengeFQDN(domain); got != want {
+			t.Errorf("ChallengeFQDN(%s): expected %s, got %s", domain, want, got)
+		}
+	}
+}
+
+// TestNewValidation tests required issuer settings
+func TestNewValidation(t *testing.T) {
+	if _, err := New(Config{CertFile: "c", KeyFile: "k", Provider: &fakeDNS{}, Storage: &storage.FS{Dir: os.TempDir()}}); err == nil {
+		t.Error("Expected an error without domains")
+	}
+	if _, err := New(Config{Domains: []string{"example.com"}, CertFile: "c", KeyFile: "k", Storage: &storage.FS{Dir: os.TempDir()}}); err == nil {
+		t.Error("Expected an error without a provider")
+	}
+}
@@ -0,0 +1,102 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Cloudflare publishes challenge records through the Cloudflare API
+type Cloudflare struct {
+	// Token is an API token with DNS edit permission on the zone
+	Token string
+
+	// ZoneID is the zone holding the challenge records
+	ZoneID string
+
+	// Endpoint defaults to https://api.cloudflare.com/client/v4
+	Endpoint string
+
+	Client *http.Client
+}
+
+type cloudflareRecord struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	TTL     int    `json:"ttl"`
+}
+
+type cloudflareResponse struct {
+	Success bool              `json:"success"`
+	Errors  []json.RawMessage `json:"errors"`
+	Result  json.RawMessage   `json:"result"`
+}
+
+// Present creates the TXT record
+func (c *Cloudflare) Present(ctx context.Context, fqdn, value string) error {
+	body, err := json.Marshal(cloudflareRecord{Type: "TXT", Name: fqdn, Content: value, TTL: 120})
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, http.MethodPost, "/dns_records", body, nil)
+}
+
+// CleanUp deletes the TXT records of fqdn carrying value
+func (c *Cloudflare) CleanUp(ctx context.Context, fqdn, value string) error {
+	query := url.Values{"type": {"TXT"}, "name": {fqdn}, "content": {value}}
+	var records []cloudflareRecord
+	if err := c.do(ctx, http.MethodGet, "/dns_records?"+query.Encode(), nil, &records); err != nil {
+		return err
+	}
+	for _, r := range records {
+		if err := c.do(ctx, http.MethodDelete, "/dns_records/"+url.PathEscape(r.ID), nil, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Cloudflare) do(ctx context.Context, method, path string, body []byte, result any) error {
+	endpoint := c.Endpoint
+	if endpoint == "" {
+		endpoint = "https://api.cloudflare.com/client/v4"
+	}
+	u := strings.TrimSuffix(endpoint, "/") + "/zones/" + url.PathEscape(c.ZoneID) + path
+
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := c.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var decoded cloudflareResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&decoded); err != nil {
+		return fmt.Errorf("cloudflare: %s %s returned %d", method, path, resp.StatusCode)
+	}
+	if !decoded.Success {
+		return fmt.Errorf("cloudflare: %s %s failed: %s", method, path, decoded.Errors)
+	}
+	if result != nil {
+		return json.Unmarshal(decoded.Result, result)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package acme
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DefaultPropagationTimeout bounds the wait for a challenge record to appear
+const DefaultPropagationTimeout = 2 * time.Minute
+
+// propagationPoll is how often a pending challenge record is looked up
+var propagationPoll = 5 * time.Second
+
+// Provider publishes and removes DNS-01 challenge records. fqdn is the
+// record name without a trailing dot, e.g. _acme-challenge.example.com.
+type Provider interface {
+	Present(ctx context.Context, fqdn, value string) error
+	CleanUp(ctx context.Context, fqdn, value string) error
+}
+
+// ChallengeFQDN returns the TXT record name for domain. A wildcard shares
+// the record of its base domain.
+func ChallengeFQDN(domain string) string {
+	return "_acme-challenge." + strings.TrimSuffix(strings.TrimPrefix(domain, "*."), ".")
+}
+
+// waitPropagation polls until fqdn carries value, so the CA is not asked to
+// validate before the record is visible
+func (i *Issuer) waitPropagation(ctx context.Context, fqdn, value string) error {
+	ctx, cancel := context.WithTimeout(ctx, i.cfg.Propagation)
+	defer cancel()
+
+	for {
+		if values, err := i.lookupTXT(ctx, fqdn); err == nil && slices.Contains(values, value) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("acme: %s not visible after %s", fqdn, i.cfg.Propagation)
+		case <-time.After(propagationPoll):
+		}
+	}
+}
+
+func lookupTXT(ctx context.Context, name string) ([]string, error) {
+	return net.DefaultResolver.LookupTXT(ctx, name+".")
+}
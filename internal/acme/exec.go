@@ -0,0 +1,51 @@
+package acme
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Exec delegates challenge records to an external program, the plugin
+// point for DNS services without a built-in provider. The program is run
+// as `command... present|cleanup <fqdn> <value>`.
+type Exec struct {
+	// Command is the program and its leading arguments; it is not run by
+	// a shell
+	Command []string
+
+	// Timeout bounds each run; defaults to 2 minutes
+	Timeout time.Duration
+}
+
+// Present runs the command with "present"
+func (e *Exec) Present(ctx context.Context, fqdn, value string) error {
+	return e.run(ctx, "present", fqdn, value)
+}
+
+// CleanUp runs the command with "cleanup"
+func (e *Exec) CleanUp(ctx context.Context, fqdn, value string) error {
+	return e.run(ctx, "cleanup", fqdn, value)
+}
+
+func (e *Exec) run(ctx context.Context, action, fqdn, value string) error {
+	if len(e.Command) == 0 {
+		return errors.New("exec provider: no command")
+	}
+	timeout := e.Timeout
+	if timeout <= 0 {
+		timeout = 2 * time.Minute
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	args := append(e.Command[1:len(e.Command):len(e.Command)], action, fqdn, value)
+	out, err := exec.CommandContext(ctx, e.Command[0], args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("exec provider %s: %w: %s", action, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
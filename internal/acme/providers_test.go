@@ -0,0 +1,191 @@
+package acme
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// TestCloudflare tests creating and deleting records through the API
+func TestCloudflare(t *testing.T) {
+	var mu sync.Mutex
+	var calls []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = io.WriteString(w, `{"success":false,"errors":[{"message":"bad token"}]}`)
+			return
+		}
+		switch r.Method {
+		case http.MethodPost:
+			var rec cloudflareRecord
+			_ = json.NewDecoder(r.Body).Decode(&rec)
+			if rec.Type != "TXT" || rec.Name != "_acme-challenge.example.com" || rec.Content != "value" {
+				t.Errorf("Unexpected record: %+v", rec)
+			}
+			_, _ = io.WriteString(w, `{"success":true,"result":{"id":"rec1"}}`)
+		case http.MethodGet:
+			if r.URL.Query().Get("content") != "value" {
+				t.Errorf("Expected lookup by content, got %s", r.URL.RawQuery)
+			}
+			_, _ = io.WriteString(w, `{"success":true,"result":[{"id":"rec1"}]}`)
+		case http.MethodDelete:
+			_, _ = io.WriteString(w, `{"success":true,"result":{"id":"rec1"}}`)
+		}
+	}))
+	defer server.Close()
+
+	cf := &Cloudflare{Token: "secret", ZoneID: "zone", Endpoint: server.URL}
+	ctx := context.Background()
+	if err := cf.Present(ctx, "_acme-challenge.example.com", "value"); err != nil {
+		t.Fatalf("Failed to present record: %v", err)
+	}
+	if err := cf.CleanUp(ctx, "_acme-challenge.example.com", "value"); err != nil {
+		t.Fatalf("Failed to clean up record: %v", err)
+	}
+	want := []string{"POST /zones/zone/dns_records", "GET /zones/zone/dns_records", "DELETE /zones/zone/dns_records/rec1"}
+	if strings.Join(calls, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected calls %v, got %v", want, calls)
+	}
+
+	cf.Token = "wrong"
+	if err := cf.Present(ctx, "_acme-challenge.example.com", "value"); err == nil || !strings.Contains(err.Error(), "bad token") {
+		t.Errorf("Expected the API error to be reported, got %v", err)
+	}
+}
+
+// TestRoute53 tests the change batch and request signing
+func TestRoute53(t *testing.T) {
+	var body, auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		auth = r.Header.Get("Authorization")
+		if r.URL.Path != "/2013-04-01/hostedzone/Z123/rrset" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		_, _ = io.WriteString(w, "<ChangeResourceRecordSetsResponse/>")
+	}))
+	defer server.Close()
+
+	r53 := &Route53{
+		HostedZoneID:    "/hostedzone/Z123",
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "secret",
+		Endpoint:        server.URL,
+		now:             func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) },
+	}
+	if err := r53.Present(context.Background(), "_acme-challenge.example.com", "value"); err != nil {
+		t.Fatalf("Failed to present record: %v", err)
+	}
+	for _, want := range []string{"<Action>UPSERT</Action>", "<Name>_acme-challenge.example.com.</Name>", "<Value>&#34;value&#34;</Value>"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected %s in change batch: %s", want, body)
+		}
+	}
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/20240501/us-east-1/route53/aws4_request, SignedHeaders=content-type;host;x-amz-content-sha256;x-amz-date, Signature=") {
+		t.Errorf("Unexpected Authorization header: %s", auth)
+	}
+
+	if err := r53.CleanUp(context.Background(), "_acme-challenge.example.com", "value"); err != nil || !strings.Contains(body, "<Action>DELETE</Action>") {
+		t.Errorf("Expected a DELETE change, got %v: %s", err, body)
+	}
+}
+
+// TestRFC2136 tests signed DNS UPDATE messages against a local server
+func TestRFC2136(t *testing.T) {
+	const key, secret = "acme.", "c2VjcmV0c2VjcmV0c2VjcmV0"
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	var mu sync.Mutex
+	var updates []dns.RR
+	server := &dns.Server{
+		Listener:   ln,
+		TsigSecret: map[string]string{key: secret},
+		// The default accept function answers UPDATE with NOTIMP
+		MsgAcceptFunc: func(dns.Header) dns.MsgAcceptAction { return dns.MsgAccept },
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+			reply := new(dns.Msg)
+			reply.SetReply(req)
+			if req.IsTsig() == nil || w.TsigStatus() != nil {
+				reply.Rcode = dns.RcodeRefused
+			} else {
+				mu.Lock()
+				updates = append(updates, req.Ns...)
+				mu.Unlock()
+				reply.SetTsig(key, dns.HmacSHA256, 300, time.Now().Unix())
+			}
+			_ = w.WriteMsg(reply)
+		}),
+	}
+	go func() { _ = server.ActivateAndServe() }()
+	defer server.Shutdown()
+
+	provider := &RFC2136{Nameserver: ln.Addr().String(), Zone: "example.com", TSIGKey: "acme", TSIGSecret: secret}
+	ctx := context.Background()
+	if err := provider.Present(ctx, "_acme-challenge.example.com", "value"); err != nil {
+		t.Fatalf("Failed to present record: %v", err)
+	}
+	if err := provider.CleanUp(ctx, "_acme-challenge.example.com", "value"); err != nil {
+		t.Fatalf("Failed to clean up record: %v", err)
+	}
+	if len(updates) != 2 || updates[0].Header().Class != dns.ClassINET || updates[1].Header().Class != dns.ClassNONE {
+		t.Errorf("Expected an insert and a removal, got %v", updates)
+	}
+	if txt, ok := updates[0].(*dns.TXT); !ok || txt.Txt[0] != "value" {
+		t.Errorf("Expected TXT record with the challenge value, got %v", updates[0])
+	}
+
+	provider.TSIGSecret = "d3Jvbmd3cm9uZ3dyb25n"
+	if err := provider.Present(ctx, "_acme-challenge.example.com", "value"); err == nil {
+		t.Error("Expected an update with the wrong TSIG secret to fail")
+	}
+}
+
+// TestExec tests delegating records to an external program
+func TestExec(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("exec provider tests use /bin/sh")
+	}
+	out := filepath.Join(t.TempDir(), "calls")
+	provider := &Exec{Command: []string{"sh", "-c", `echo "$@" >> "$0"`, out}}
+
+	ctx := context.Background()
+	if err := provider.Present(ctx, "_acme-challenge.example.com", "value"); err != nil {
+		t.Fatalf("Failed to present record: %v", err)
+	}
+	if err := provider.CleanUp(ctx, "_acme-challenge.example.com", "value"); err != nil {
+		t.Fatalf("Failed to clean up record: %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("Failed to read calls: %v", err)
+	}
+	want := "present _acme-challenge.example.com value\ncleanup _acme-challenge.example.com value\n"
+	if string(data) != want {
+		t.Errorf("Expected calls %q, got %q", want, data)
+	}
+
+	failing := &Exec{Command: []string{"sh", "-c", "echo denied; exit 1"}}
+	if err := failing.Present(ctx, "x", "y"); err == nil || !strings.Contains(err.Error(), "denied") {
+		t.Errorf("Expected the command's output in the error, got %v", err)
+	}
+}
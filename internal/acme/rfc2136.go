@@ -0,0 +1,87 @@
+package acme
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// RFC2136 publishes challenge records with DNS UPDATE messages, as
+// supported by BIND, Knot, PowerDNS and most self-hosted servers
+type RFC2136 struct {
+	// Nameserver is the primary server's host:port
+	Nameserver string
+
+	// Zone is the zone holding the challenge records, e.g. example.com
+	Zone string
+
+	// TSIGKey, TSIGSecret (base64) and TSIGAlgorithm authenticate updates;
+	// an empty key sends them unsigned. The algorithm defaults to
+	// hmac-sha256.
+	TSIGKey       string
+	TSIGSecret    string
+	TSIGAlgorithm string
+
+	// Timeout bounds each exchange; defaults to 10 seconds
+	Timeout time.Duration
+}
+
+// Present adds the TXT record
+func (r *RFC2136) Present(ctx context.Context, fqdn, value string) error {
+	rr, err := r.record(fqdn, value)
+	if err != nil {
+		return err
+	}
+	msg := new(dns.Msg)
+	msg.SetUpdate(dns.Fqdn(r.Zone))
+	msg.Insert([]dns.RR{rr})
+	return r.exchange(ctx, msg)
+}
+
+// CleanUp removes the TXT record
+func (r *RFC2136) CleanUp(ctx context.Context, fqdn, value string) error {
+	rr, err := r.record(fqdn, value)
+	if err != nil {
+		return err
+	}
+	msg := new(dns.Msg)
+	msg.SetUpdate(dns.Fqdn(r.Zone))
+	msg.Remove([]dns.RR{rr})
+	return r.exchange(ctx, msg)
+}
+
+func (r *RFC2136) record(fqdn, value string) (dns.RR, error) {
+	rr, err := dns.NewRR(fmt.Sprintf("%s 60 IN TXT %q", dns.Fqdn(fqdn), value))
+	if err != nil {
+		return nil, fmt.Errorf("rfc2136: %w", err)
+	}
+	return rr, nil
+}
+
+func (r *RFC2136) exchange(ctx context.Context, msg *dns.Msg) error {
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	client := &dns.Client{Net: "tcp", Timeout: timeout}
+	if r.TSIGKey != "" {
+		algorithm := r.TSIGAlgorithm
+		if algorithm == "" {
+			algorithm = dns.HmacSHA256
+		}
+		key := dns.Fqdn(r.TSIGKey)
+		client.TsigSecret = map[string]string{key: r.TSIGSecret}
+		msg.SetTsig(key, dns.Fqdn(algorithm), 300, time.Now().Unix())
+	}
+
+	reply, _, err := client.ExchangeContext(ctx, msg, r.Nameserver)
+	if err != nil {
+		return fmt.Errorf("rfc2136: %w", err)
+	}
+	if reply.Rcode != dns.RcodeSuccess {
+		return fmt.Errorf("rfc2136: update refused: %s", dns.RcodeToString[reply.Rcode])
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Route53 publishes challenge records in an AWS Route 53 hosted zone.
+// Requests are signed with AWS Signature Version 4.
+type Route53 struct {
+	// HostedZoneID is the zone holding the challenge records
+	HostedZoneID string
+
+	// AccessKeyID, SecretAccessKey and the optional SessionToken are the
+	// AWS credentials
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+
+	// Endpoint defaults to https://route53.amazonaws.com
+	Endpoint string
+
+	Client *http.Client
+
+	now func() time.Time
+}
+
+type route53Change struct {
+	XMLName xml.Name `xml:"https://route53.amazonaws.com/doc/2013-04-01/ ChangeResourceRecordSetsRequest"`
+	Action  string   `xml:"ChangeBatch>Changes>Change>Action"`
+	Name    string   `xml:"ChangeBatch>Changes>Change>ResourceRecordSet>Name"`
+	Type    string   `xml:"ChangeBatch>Changes>Change>ResourceRecordSet>Type"`
+	TTL     int      `xml:"ChangeBatch>Changes>Change>ResourceRecordSet>TTL"`
+	Value   string   `xml:"ChangeBatch>Changes>Change>ResourceRecordSet>ResourceRecords>ResourceRecord>Value"`
+}
+
+// Present upserts the TXT record
+func (r *Route53) Present(ctx context.Context, fqdn, value string) error {
+	return r.change(ctx, "UPSERT", fqdn, value)
+}
+
+// CleanUp deletes the TXT record
+func (r *Route53) CleanUp(ctx context.Context, fqdn, value string) error {
+	return r.change(ctx, "DELETE", fqdn, value)
+}
+
+func (r *Route53) change(ctx context.Context, action, fqdn, value string) error {
+	body, err := xml.Marshal(route53Change{
+		Action: action,
+		Name:   fqdn + ".",
+		Type:   "TXT",
+		TTL:    60,
+		Value:  strconv.Quote(value),
+	})
+	if err != nil {
+		return err
+	}
+
+	endpoint := r.Endpoint
+	if endpoint == "" {
+		endpoint = "https://route53.amazonaws.com"
+	}
+	zone := strings.TrimPrefix(r.HostedZoneID, "/hostedzone/")
+	u := strings.TrimSuffix(endpoint, "/") + "/2013-04-01/hostedzone/" + url.PathEscape(zone) + "/rrset"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/xml")
+	now := time.Now
+	if r.now != nil {
+		now = r.now
+	}
+	r.sign(req, body, now().UTC())
+
+	client := r.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("route53: %s %s returned %d: %s", action, fqdn, resp.StatusCode, bytes.TrimSpace(detail))
+	}
+	return nil
+}
+
+// sign adds a Signature Version 4 Authorization header for the global
+// route53 service, which is signed in us-east-1
+func (r *Route53) sign(req *http.Request, body []byte, now time.Time) {
+	const region, service = "us-east-1", "route53"
+
+	stamp := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payload := sha256Hex(body)
+
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", stamp)
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+	signed := []string{"content-type", "host", "x-amz-content-sha256", "x-amz-date"}
+	if r.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", r.SessionToken)
+		signed = append(signed, "x-amz-security-token")
+	}
+
+	var headers strings.Builder
+	for _, h := range signed {
+		headers.WriteString(h + ":" + strings.TrimSpace(req.Header.Get(h)) + "\n")
+	}
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		headers.String(),
+		strings.Join(signed, ";"),
+		payload,
+	}, "\n")
+
+	scope := day + "/" + region + "/" + service + "/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + sha256Hex([]byte(canonical))
+
+	key := hmacSHA256([]byte("AWS4"+r.SecretAccessKey), day)
+	for _, part := range []string{region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		r.AccessKeyID, scope, strings.Join(signed, ";"), signature))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
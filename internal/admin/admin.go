@@ -0,0 +1,106 @@
+package admin
+
+import (
+	"context"
+	"crypto/tls"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Server is the admin/management HTTP listener (metrics, health, status)
+type Server struct {
+	mux    *http.ServeMux
+	server *http.Server
+}
+
+// New creates an admin server listening on addr. The OpenAPI document is
+// served at OpenAPIPath.
+func New(addr string) *Server {
+	mux := http.NewServeMux()
+	mux.Handle("GET "+OpenAPIPath, openAPIHandler())
+	return &Server{
+		mux: mux,
+		server: &http.Server{
+			Addr:              addr,
+			Handler:           mux,
+			ReadHeaderTimeout: 5 * time.Second,
+		},
+	}
+}
+
+// Handle registers a handler on the admin mux
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// HandleFunc registers a handler function on the admin mux
+func (s *Server) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	s.mux.HandleFunc(pattern, handler)
+}
+
+// HandleAPI registers a versioned API handler at APIPrefix+pattern, and at
+// pattern for clients predating the versioned API. The handler sees paths
+// without the prefix either way.
+func (s *Server) HandleAPI(pattern string, handler http.Handler) {
+	s.mux.Handle(APIPrefix+pattern, http.StripPrefix(APIPrefix, handler))
+	s.mux.Handle(pattern, handler)
+}
+
+// SetAuth requires every request to pass auth. Call it before serving.
+func (s *Server) SetAuth(auth *Auth) {
+	s.server.Handler = auth.Middleware(s.mux)
+}
+
+// SetTLSConfig serves the admin API over TLS with cfg. Call it before
+// serving.
+func (s *Server) SetTLSConfig(cfg *tls.Config) {
+	s.server.TLSConfig = cfg
+}
+
+// SetConnState calls hook on every client connection state change. Call it
+// before serving.
+func (s *Server) SetConnState(hook func(net.Conn, http.ConnState)) {
+	s.server.ConnState = hook
+}
+
+// Handler returns the handler requests are served by, mainly for tests
+func (s *Server) Handler() http.Handler {
+	return s.server.Handler
+}
+
+// Start serves the admin API in the background
+func (s *Server) Start() {
+	go func() {
+		if err := s.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("Admin server error: %v", err)
+		}
+	}()
+}
+
+// ListenAndServe serves the admin API until the server is shut down
+func (s *Server) ListenAndServe() error {
+	if s.server.TLSConfig != nil {
+		return s.server.ListenAndServeTLS("", "")
+	}
+	return s.server.ListenAndServe()
+}
+
+// Serve serves the admin API on ln until the server is shut down
+func (s *Server) Serve(ln net.Listener) error {
+	if s.server.TLSConfig != nil {
+		return s.server.ServeTLS(ln, "", "")
+	}
+	return s.server.Serve(ln)
+}
+
+// Shutdown gracefully stops the admin listener
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+// Close immediately closes the admin listener and its connections
+func (s *Server) Close() error {
+	return s.server.Close()
+}
@@ -0,0 +1,190 @@
+package admin
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"tls-agent/internal/authz"
+	"tls-agent/internal/metrics"
+)
+
+// Roles, from least to most privileged
+const (
+	// RoleReader may use GET and HEAD outside OperatorPaths
+	RoleReader = "reader"
+
+	// RoleOperator may do anything, e.g. reload, rollback and restore
+	RoleOperator = "operator"
+)
+
+var authFailures = metrics.NewCounterVec("tls_agent_admin_auth_failures_total",
+	"Admin API requests rejected by reason (unauthenticated, forbidden)", "reason")
+
+// Token is a bearer token granting Role
+type Token struct {
+	// Name identifies the token in audit logs without revealing it
+	Name   string
+	Secret string
+	Role   string
+}
+
+// Client grants Role to client certificates whose identities match Allow,
+// using authz patterns such as "dns:ops.internal.example.com" or
+// "uri:spiffe://example.com/ns/ops/*"
+type Client struct {
+	Allow []string
+	Role  string
+}
+
+// Auth authenticates admin API requests by bearer token or client
+// certificate and checks that the caller's role permits the request. Client
+// certificates are trusted as presented, so the listener must verify them
+// during the handshake.
+type Auth struct {
+	Tokens  []Token
+	Clients []Client
+
+	// OperatorPaths are path prefixes that need RoleOperator even to read,
+	// such as /debug/ whose profiles expose process memory
+	OperatorPaths []string
+
+	// PublicPaths are path prefixes served without authentication, such as
+	// /healthz for load balancer probes
+	PublicPaths []string
+}
+
+// Caller is who made an authenticated admin API request
+type Caller struct {
+	Name string
+	Role string
+}
+
+type callerKey struct{}
+
+// CallerFrom returns the caller Middleware authenticated for a request's
+// context. It reports false when the request was not authenticated, because
+// auth is disabled or the path is public.
+func CallerFrom(ctx context.Context) (Caller, bool) {
+	c, ok := ctx.Value(callerKey{}).(Caller)
+	return c, ok
+}
+
+// Validate checks that every token and client names a known role
+func (a *Auth) Validate() error {
+	for _, t := range a.Tokens {
+		if !validRole(t.Role) {
+			return fmt.Errorf("admin token %s: unknown role %q", t.Name, t.Role)
+		}
+		if t.Secret == "" {
+			return fmt.Errorf("admin token %s: empty token", t.Name)
+		}
+	}
+	for i, c := range a.Clients {
+		if !validRole(c.Role) {
+			return fmt.Errorf("admin client %d: unknown role %q", i, c.Role)
+		}
+	}
+	return nil
+}
+
+func validRole(role string) bool {
+	return role == RoleReader || role == RoleOperator
+}
+
+// Middleware rejects unauthenticated requests with 401 and requests beyond
+// the caller's role with 403
+func (a *Auth) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hasPrefix(a.PublicPaths, r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		who, role := a.authenticate(r)
+		if role == "" {
+			authFailures.With("unauthenticated").Inc()
+			w.Header().Set("WWW-Authenticate", `Bearer realm="tls-agent admin"`)
+			http.Error(w, "authentication required", http.StatusUnauthorized)
+			return
+		}
+		if need := a.required(r); need == RoleOperator && role != RoleOperator {
+			authFailures.With("forbidden").Inc()
+			log.Printf("AUDIT: admin denied %s %s to %s (role %s, needs %s) remote=%s", r.Method, r.URL.Path, who, role, need, r.RemoteAddr)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if role == RoleOperator && r.Method != http.MethodGet && r.Method != http.MethodHead {
+			log.Printf("AUDIT: admin %s %s by %s remote=%s", r.Method, r.URL.Path, who, r.RemoteAddr)
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), callerKey{}, Caller{Name: who, Role: role})))
+	})
+}
+
+// authenticate returns the caller's name and role, or "" for an unknown
+// caller. A token wins over a client certificate.
+func (a *Auth) authenticate(r *http.Request) (who, role string) {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		// Compare digests so the comparison time does not depend on the
+		// length of the configured tokens
+		sum := sha256.Sum256([]byte(token))
+		for _, t := range a.Tokens {
+			want := sha256.Sum256([]byte(t.Secret))
+			if subtle.ConstantTimeCompare(sum[:], want[:]) == 1 {
+				return "token:" + t.Name, t.Role
+			}
+		}
+		return "", ""
+	}
+	// The listener verifies presented certificates during the handshake
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		cert := r.TLS.PeerCertificates[0]
+		for _, c := range a.Clients {
+			if authz.Allowed(c.Allow, cert) && (role == "" || c.Role == RoleOperator) {
+				role = c.Role
+			}
+		}
+		if role != "" {
+			return clientName(cert), role
+		}
+	}
+	return "", ""
+}
+
+// required returns the role r needs
+func (a *Auth) required(r *http.Request) string {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return RoleOperator
+	}
+	if hasPrefix(a.OperatorPaths, r.URL.Path) {
+		return RoleOperator
+	}
+	return RoleReader
+}
+
+// hasPrefix reports whether p, or its unversioned form, starts with one of
+// prefixes, so "/healthz" also covers "/api/v1/healthz"
+func hasPrefix(prefixes []string, p string) bool {
+	if rest, ok := strings.CutPrefix(p, APIPrefix); ok && strings.HasPrefix(rest, "/") {
+		p = rest
+	}
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(p, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientName names a client certificate in audit logs
+func clientName(cert *x509.Certificate) string {
+	if ids := authz.Identities(cert); len(ids) > 0 {
+		return ids[0]
+	}
+	return "cn:" + cert.Subject.CommonName
+}
@@ -0,0 +1,79 @@
+package admin
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestAuth tests tokens, client certificates and the role model
+func TestAuth(t *testing.T) {
+	auth := &Auth{
+		Tokens: []Token{
+			{Name: "grafana", Secret: "read-token", Role: RoleReader},
+			{Name: "deploy", Secret: "op-token", Role: RoleOperator},
+		},
+		Clients: []Client{
+			{Allow: []string{"dns:*.ops.example"}, Role: RoleReader},
+			{Allow: []string{"dns:oncall.ops.example"}, Role: RoleOperator},
+		},
+		OperatorPaths: []string{"/debug/"},
+		PublicPaths:   []string{"/healthz"},
+	}
+	if err := auth.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	handler := auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	withCert := func(name string) *tls.ConnectionState {
+		return &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{DNSNames: []string{name}}}}
+	}
+	cases := []struct {
+		method, path, token string
+		tls                 *tls.ConnectionState
+		want                int
+	}{
+		{http.MethodGet, "/healthz", "", nil, http.StatusOK},
+		{http.MethodGet, "/api/v1/healthz", "", nil, http.StatusOK},
+		{http.MethodGet, "/api/v1healthz", "", nil, http.StatusUnauthorized},
+		{http.MethodGet, "/api/v1/debug/pprof/", "read-token", nil, http.StatusForbidden},
+		{http.MethodGet, "/status", "", nil, http.StatusUnauthorized},
+		{http.MethodGet, "/status", "wrong", nil, http.StatusUnauthorized},
+		{http.MethodGet, "/status", "read-token", nil, http.StatusOK},
+		{http.MethodPost, "/backups/default/1/restore", "read-token", nil, http.StatusForbidden},
+		{http.MethodGet, "/debug/pprof/", "read-token", nil, http.StatusForbidden},
+		{http.MethodPost, "/backups/default/1/restore", "op-token", nil, http.StatusOK},
+		{http.MethodGet, "/debug/pprof/", "op-token", nil, http.StatusOK},
+		{http.MethodGet, "/status", "", withCert("grafana.ops.example"), http.StatusOK},
+		{http.MethodPost, "/tenants/shop/reload", "", withCert("grafana.ops.example"), http.StatusForbidden},
+		{http.MethodPost, "/tenants/shop/reload", "", withCert("oncall.ops.example"), http.StatusOK},
+		{http.MethodGet, "/status", "", withCert("www.example"), http.StatusUnauthorized},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(c.method, c.path, nil)
+		if c.token != "" {
+			r.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		r.TLS = c.tls
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		if rec.Code != c.want {
+			t.Errorf("%s %s (token %q): expected %d, got %d", c.method, c.path, c.token, c.want, rec.Code)
+		}
+	}
+}
+
+// TestAuthValidate tests rejecting unknown roles and empty tokens
+func TestAuthValidate(t *testing.T) {
+	for _, auth := range []*Auth{
+		{Tokens: []Token{{Name: "a", Secret: "x", Role: "admin"}}},
+		{Tokens: []Token{{Name: "a", Role: RoleReader}}},
+		{Clients: []Client{{Allow: []string{"dns:*"}, Role: ""}}},
+	} {
+		if err := auth.Validate(); err == nil {
+			t.Errorf("Expected %+v to be rejected", auth)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package admin
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// APIPrefix is the path prefix of the current version of the admin API.
+// Changes that would break clients get a new prefix rather than changing
+// what is served under this one.
+const APIPrefix = "/api/v1"
+
+// OpenAPIPath is where the OpenAPI document describing the API is served
+const OpenAPIPath = "/api/openapi.json"
+
+//go:embed openapi.json
+var openAPI []byte
+
+// OpenAPI returns the OpenAPI document describing the admin API
+func OpenAPI() []byte {
+	return append([]byte(nil), openAPI...)
+}
+
+func openAPIHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(openAPI)
+	})
+}
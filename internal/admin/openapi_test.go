@@ -0,0 +1,83 @@
+package admin
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestOpenAPI tests that the OpenAPI document is served and describes the
+// versioned API
+func TestOpenAPI(t *testing.T) {
+	s := New("")
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + OpenAPIPath)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected JSON, got %q", ct)
+	}
+	var doc struct {
+		OpenAPI string `json:"openapi"`
+		Servers []struct {
+			URL string `json:"url"`
+		} `json:"servers"`
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		t.Fatalf("Invalid document: %v", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Errorf("Expected an OpenAPI 3 document, got %q", doc.OpenAPI)
+	}
+	if len(doc.Servers) != 1 || doc.Servers[0].URL != APIPrefix {
+		t.Errorf("Expected the server URL to be %s, got %+v", APIPrefix, doc.Servers)
+	}
+	for path, ops := range doc.Paths {
+		for method := range ops {
+			if method == "parameters" {
+				continue
+			}
+			if method != "get" && method != "post" {
+				t.Errorf("%s: unexpected method %s", path, method)
+			}
+		}
+	}
+	for _, path := range []string{"/status", "/certificates", "/config", "/backups/{name}/{id}/restore"} {
+		if _, ok := doc.Paths[path]; !ok {
+			t.Errorf("Expected %s to be documented", path)
+		}
+	}
+}
+
+// TestHandleAPI tests that API handlers are served with and without the
+// version prefix
+func TestHandleAPI(t *testing.T) {
+	s := New("")
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /backups/{name}", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.PathValue("name"))
+	})
+	s.HandleAPI("/backups/", mux)
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+
+	for _, path := range []string{"/api/v1/backups/web", "/backups/web"} {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || string(body) != "web" {
+			t.Errorf("%s: expected 200 web, got %d %q", path, resp.StatusCode, body)
+		}
+	}
+}
@@ -2,113 +2,735 @@ package agent
 
 import (
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
 	"log"
+	"runtime/debug"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"tls-agent/internal/clock"
+	"tls-agent/internal/metrics"
+	"tls-agent/internal/notify"
+	"tls-agent/internal/policy"
+	"tls-agent/internal/storage"
 	"tls-agent/internal/tlsstore"
 
 	"github.com/fsnotify/fsnotify"
 )
 
+// Watcher restart backoff bounds
+const (
+	minRestartBackoff = time.Second
+	maxRestartBackoff = time.Minute
+)
+
+// ErrWatcherClosed is returned (wrapped) when the file watcher shuts down
+// underneath the agent; the agent restarts it with backoff
+var ErrWatcherClosed = errors.New("agent: file watcher closed")
+
+// ErrNoPrevious is returned by a rollback when no certificate has been
+// replaced since the agent started
+var ErrNoPrevious = errors.New("agent: no previous certificate to roll back to")
+
+// ErrNotVersioned is returned by a rollback to a version when the store does
+// not retain versions
+var ErrNotVersioned = errors.New("agent: store does not retain certificate versions")
+
+// ErrProbeFailed is returned (wrapped) when Config.Probe rejects a reloaded
+// certificate
+var ErrProbeFailed = errors.New("agent: certificate probe failed")
+
+var watcherRestarts = metrics.NewCounter("tls_agent_watcher_restarts_total",
+	"Times the certificate watcher was restarted after failing")
+
 type State struct {
 	Current  *tls.Certificate
 	Previous *tls.Certificate
 	LastRun  time.Time
+
+	history *history
+	lastErr atomic.Pointer[LastError]
+
+	// expiryAlerted is the fingerprint of the last certificate reported as
+	// expiring, so each certificate is reported once
+	expiryAlerted string
 }
 
 func NewState(cert *tls.Certificate) *State {
 	return &State{
 		Current: cert,
 		LastRun: time.Now(),
+		history: newHistory(DefaultHistorySize),
+	}
+}
+
+// RecordReload appends a reload event to the history
+func (s *State) RecordReload(e ReloadEvent) {
+	if s.history == nil {
+		s.history = newHistory(DefaultHistorySize)
+	}
+	s.history.add(e)
+}
+
+// PersistHistory restores the reload history saved in store and keeps it
+// there from now on, so the history survives restarts
+func (s *State) PersistHistory(store storage.Storage) error {
+	if s.history == nil {
+		s.history = newHistory(DefaultHistorySize)
+	}
+	s.history.store = store
+	return s.history.load()
+}
+
+// History returns the recorded reload events, newest first
+func (s *State) History() []ReloadEvent {
+	if s.history == nil {
+		return nil
+	}
+	return s.history.list()
+}
+
+// Config customizes how the agent loads and accepts certificates
+type Config struct {
+	// CertFile and KeyFile are the watched certificate and key paths. An
+	// empty KeyFile, or one equal to CertFile, watches a single combined
+	// PEM file holding the key and chain.
+	CertFile string
+	KeyFile  string
+
+	// ChainFile, if set, is watched with the pair, for a Load that composes
+	// the pair with it (see tlsstore.WithChains)
+	ChainFile string
+
+	// Load loads a certificate pair; defaults to tlsstore.Load
+	Load func(certFile, keyFile string) (*tls.Certificate, error)
+
+	// Validate, if set, is evaluated on every reloaded certificate before it
+	// is swapped in. An error keeps the current certificate in place.
+	Validate func(*tls.Certificate) error
+
+	// Probe, if set, runs after Validate and must succeed before a reloaded
+	// certificate is served, e.g. a handshake from a verifying client
+	Probe func(*tls.Certificate) error
+
+	// Notifier receives reload and policy events
+	Notifier notify.Notifier
+
+	// Debounce is the quiet period after the last file event before a reload
+	// runs; zero reloads on every event
+	Debounce time.Duration
+
+	// CheckInterval is the period of the fallback expiry and watch check
+	CheckInterval time.Duration
+
+	// ExpiryWarning is how long before expiry a reload is attempted
+	ExpiryWarning time.Duration
+
+	// Clock drives debounce timers, the periodic checks and the expiry and
+	// validity checks; defaults to the wall clock
+	Clock Clock
+
+	// FS provides file watches and the sizes recorded by Recorder; defaults
+	// to the real file system. Loads go through Load.
+	FS FileSystem
+
+	// Reload, if set, forces a reload on every receive (e.g. on SIGUSR1)
+	Reload <-chan struct{}
+
+	// Rollback, if set, restores the certificate replaced by the last
+	// reload on every receive. The result is sent on the received channel,
+	// which must be buffered.
+	Rollback <-chan chan error
+
+	// RollbackVersion, if set, restores a version retained by the store,
+	// which must implement tlsstore.Versioned, on every receive
+	RollbackVersion <-chan RollbackRequest
+
+	// NotBeforeGrace accepts certificates whose NotBefore is up to this far
+	// in the future, to tolerate clock skew with the issuing CA
+	NotBeforeGrace time.Duration
+
+	// Watchdog, if set, is called every WatchdogInterval from the watch loop,
+	// so a supervisor such as the systemd watchdog can restart a loop that
+	// stopped making progress. It is not called while a failed watcher waits
+	// to restart.
+	Watchdog         func()
+	WatchdogInterval time.Duration
+
+	// Logger receives the agent's log lines; defaults to log.Default()
+	Logger *log.Logger
+
+	// WatcherErrors, if set, delivers errors handled as if the file watcher
+	// reported them, for fault injection
+	WatcherErrors <-chan error
+
+	// Recorder, if set, records file events and reload decisions for
+	// Replay
+	Recorder *Recorder
+
+	// ZeroizeRetired overwrites the private key of a certificate once a
+	// reload retires it, i.e. it is neither served nor kept for rollback,
+	// after ZeroizeDelay so handshakes already using it can finish
+	ZeroizeRetired bool
+	ZeroizeDelay   time.Duration
+
+	// OnZeroize, if set, is called with the fingerprint of each retired key
+	// once it has been overwritten
+	OnZeroize func(fingerprint string)
+}
+
+// DefaultConfig returns the configuration used by Run
+func DefaultConfig() Config {
+	return Config{
+		CertFile:       "certs/server.crt",
+		KeyFile:        "certs/server.key",
+		Load:           tlsstore.Load,
+		Debounce:       2 * time.Second,
+		CheckInterval:  30 * time.Second,
+		ExpiryWarning:  7 * 24 * time.Hour,
+		Clock:          RealClock{},
+		FS:             OSFileSystem{},
+		NotBeforeGrace: tlsstore.DefaultNotBeforeGrace,
+		Logger:         log.Default(),
 	}
 }
 
 // Run starts the certificate watcher agent.
 // It will watch for certificate file changes and reload them.
 // Pass a stop channel to gracefully shutdown the agent.
-func Run(store *tlsstore.Store, state *State, stopChan <-chan struct{}) {
+//
+// Deprecated: use New and Agent.Start, which take options instead of
+// positional arguments.
+func Run(store tlsstore.CertificateProvider, state *State, stopChan <-chan struct{}) {
+	RunWithConfig(store, state, stopChan, DefaultConfig())
+}
+
+// RunWithConfig is like Run but uses the given configuration
+//
+// Deprecated: use New with WithConfig and Agent.Start.
+func RunWithConfig(store tlsstore.CertificateProvider, state *State, stopChan <-chan struct{}, cfg Config) {
+	run(store, state, stopChan, cfg)
+}
+
+// run fills in cfg's defaults and runs the watch loop until stopChan closes
+func run(store tlsstore.CertificateProvider, state *State, stopChan <-chan struct{}, cfg Config) {
+	if cfg.Load == nil {
+		cfg.Load = tlsstore.Load
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = RealClock{}
+	}
+	if cfg.FS == nil {
+		cfg.FS = OSFileSystem{}
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = log.Default()
+	}
+	if cfg.CheckInterval <= 0 {
+		cfg.CheckInterval = DefaultConfig().CheckInterval
+	}
+
+	// A watcher that dies or a panic in a reload restarts the loop with
+	// bounded backoff instead of silently disabling hot reload
+	backoff := minRestartBackoff
+	for {
+		started := cfg.Clock.Now()
+		err := watch(store, state, stopChan, cfg)
+		if err == nil {
+			return
+		}
+
+		watcherRestarts.Inc()
+		state.SetLastError(SourceWatcher, err)
+
+		// A watcher that ran for a while before failing starts over at the minimum
+		if cfg.Clock.Now().Sub(started) > maxRestartBackoff {
+			backoff = minRestartBackoff
+		}
+		cfg.Logger.Printf("Agent: watcher failed (%v), restarting in %s", err, backoff)
+
+		timer := cfg.Clock.NewTimer(backoff)
+		select {
+		case <-timer.C():
+		case <-stopChan:
+			timer.Stop()
+			cfg.Logger.Println("Agent: received stop signal, shutting down gracefully")
+			return
+		}
+		backoff = min(backoff*2, maxRestartBackoff)
+	}
+}
+
+// watch runs one watcher session. It returns nil when stopped and an error
+// when the watcher died or a panic was recovered.
+func watch(store tlsstore.CertificateProvider, state *State, stopChan <-chan struct{}, cfg Config) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			cfg.Logger.Printf("Agent: recovered from panic: %v\n%s", r, debug.Stack())
+			err = fmt.Errorf("agent: panic: %v", r)
+		}
+	}()
+
 	// Create file watcher for certificate files
-	watcher, err := fsnotify.NewWatcher()
+	watcher, err := cfg.FS.NewWatcher()
 	if err != nil {
-		log.Println("Agent: failed to create watcher:", err)
-		return
+		cfg.Logger.Println("Agent: failed to create watcher:", err)
+		return fmt.Errorf("agent: create watcher: %w", err)
 	}
 	defer watcher.Close()
 
 	// Watch certificate files
-	if err := watcher.Add("certs/server.crt"); err != nil {
-		log.Println("Agent: failed to watch server.crt:", err)
+	paths := []string{cfg.CertFile}
+	if !tlsstore.IsCombined(cfg.CertFile, cfg.KeyFile) {
+		paths = append(paths, cfg.KeyFile)
+	}
+	if cfg.ChainFile != "" {
+		paths = append(paths, cfg.ChainFile)
 	}
-	if err := watcher.Add("certs/server.key"); err != nil {
-		log.Println("Agent: failed to watch server.key:", err)
+	for _, path := range paths {
+		if err := watcher.Add(path); err != nil {
+			cfg.Logger.Println("Agent: failed to watch", path+":", err)
+			state.SetLastError(SourceWatcher, fmt.Errorf("agent: watch %s: %w", path, err))
+		}
 	}
 
-	log.Println("Agent: watching certs/server.crt and certs/server.key for changes")
+	cfg.Logger.Printf("Agent: watching %s for changes", strings.Join(paths, " and "))
+	cfg.Recorder.start(paths, cfg.Debounce)
 
-	// Also run periodic checks (fallback, every 30 seconds)
-	ticker := time.NewTicker(30 * time.Second)
+	// Also run periodic checks as a fallback
+	ticker := cfg.Clock.NewTicker(cfg.CheckInterval)
 	defer ticker.Stop()
 
-	// Track recent reloads to avoid duplicate processing
-	lastReloadTime := time.Now()
-	reloadDebounce := 2 * time.Second
+	// Coalesce bursts of writes (cert and key are usually written back to back)
+	debounce := newDebouncer(cfg.Clock, cfg.Debounce)
+	defer debounce.Stop()
+
+	// Loads run off this loop, so a stuck one cannot stall it
+	reloads := newReloader(cfg)
+
+	var watchdog <-chan time.Time
+	if cfg.Watchdog != nil && cfg.WatchdogInterval > 0 {
+		cfg.Watchdog()
+		t := cfg.Clock.NewTicker(cfg.WatchdogInterval)
+		defer t.Stop()
+		watchdog = t.C()
+	}
 
 	for {
 		select {
-		case event, ok := <-watcher.Events:
+		case event, ok := <-watcher.Events():
 			if !ok {
-				log.Println("Agent: watcher events channel closed, exiting")
-				return
+				return fmt.Errorf("%w: events channel closed", ErrWatcherClosed)
 			}
-			// Ignore remove/rename events, only process write events
-			if event.Has(fsnotify.Write) {
-				now := time.Now()
-				// Debounce: ignore reload if last reload was < 2 seconds ago
-				if now.Sub(lastReloadTime) < reloadDebounce {
-					log.Println("Agent: debouncing rapid file changes")
-					continue
-				}
+			state.ClearLastError(SourceWatcher)
 
-				log.Println("Agent: detected certificate file change:", event.Name)
-				if reloadCert(store, state) {
-					lastReloadTime = now
+			changed := fileChanged(event.Op, func() bool { return rewatch(watcher, state, paths, cfg.Logger) })
+			cfg.Recorder.event(event, cfg.FS)
+			if changed {
+				cfg.Logger.Println("Agent: detected certificate file change:", event.Name)
+				if debounce.Trigger() {
+					reloads.Start(TriggerFileChange)
 				}
 			}
 
-		case err, ok := <-watcher.Errors:
+		case <-debounce.C():
+			debounce.Done()
+			reloads.Start(TriggerFileChange)
+
+		case res := <-reloads.C():
+			applyReload(store, state, cfg, res)
+			cfg.Recorder.result(res)
+			if res.trigger == TriggerExpiry {
+				alertExpiry(store, state, cfg)
+			}
+			reloads.Done()
+
+		case err, ok := <-watcher.Errors():
 			if !ok {
-				log.Println("Agent: watcher errors channel closed, exiting")
-				return
+				return fmt.Errorf("%w: errors channel closed", ErrWatcherClosed)
+			}
+			cfg.Logger.Println("Agent: watcher error:", err)
+			state.SetLastError(SourceWatcher, err)
+
+		case err := <-cfg.WatcherErrors:
+			cfg.Logger.Println("Agent: watcher error:", err)
+			state.SetLastError(SourceWatcher, err)
+
+		case <-watchdog:
+			cfg.Watchdog()
+			continue
+
+		case <-cfg.Reload:
+			cfg.Logger.Println("Agent: reload requested")
+			reloads.Start(TriggerManual)
+
+		case reply := <-cfg.Rollback:
+			cfg.Logger.Println("Agent: rollback requested")
+			reply <- rollbackCert(store, state, cfg)
+
+		case req := <-cfg.RollbackVersion:
+			cfg.Logger.Println("Agent: rollback to version", req.Version, "requested")
+			info, err := rollbackToVersion(store, state, cfg, req.Version)
+			req.Reply <- RollbackResult{Version: info, Err: err}
+
+		case <-ticker.C():
+			// Restore watches that were dropped without an event
+			if rewatch(watcher, state, paths, cfg.Logger) && debounce.Trigger() {
+				reloads.Start(TriggerFileChange)
 			}
-			log.Println("Agent: watcher error:", err)
 
-		case <-ticker.C:
-			// Periodic fallback check (e.g., detect external changes)
-			if state.Current.Leaf != nil && time.Until(state.Current.Leaf.NotAfter) < 7*24*time.Hour {
-				log.Println("Agent: cert nearing expiry (7 days), attempting reload")
-				reloadCert(store, state)
+			// Periodic fallback check (e.g., detect external changes); the
+			// expiry alert follows the reload's result
+			if expiringSoon(store.Info().Leaf, cfg.ExpiryWarning, cfg.Clock.Now()) {
+				cfg.Logger.Printf("Agent: cert nearing expiry (%s), attempting reload", cfg.ExpiryWarning)
+				reloads.Start(TriggerExpiry)
 			}
 
 		case <-stopChan:
-			log.Println("Agent: received stop signal, shutting down gracefully")
-			return
+			cfg.Logger.Println("Agent: received stop signal, shutting down gracefully")
+			return nil
 		}
 
-		state.LastRun = time.Now()
+		state.LastRun = cfg.Clock.Now()
 	}
 }
 
-func reloadCert(store *tlsstore.Store, state *State) bool {
-	cert, err := tlsstore.Load("certs/server.crt", "certs/server.key")
+// fileChanged decides whether a file event calls for a reload. A write or
+// create does. Removing or renaming a file drops its watch, so rewatch
+// re-adds it to keep atomic replacements visible; a file that is back under
+// the same name was replaced, which produces no write event.
+func fileChanged(op fsnotify.Op, rewatch func() bool) bool {
+	changed := op.Has(fsnotify.Write) || op.Has(fsnotify.Create)
+	if op.Has(fsnotify.Remove) || op.Has(fsnotify.Rename) {
+		if rewatch() {
+			changed = true
+		}
+	}
+	return changed
+}
+
+// expiringSoon reports whether leaf expires within window of now. A missing
+// or unparseable certificate counts as expiring so that a reload is
+// attempted.
+func expiringSoon(leaf *x509.Certificate, window time.Duration, now time.Time) bool {
+	if leaf == nil {
+		return true
+	}
+	return leaf.NotAfter.Sub(now) < window
+}
+
+// alertExpiry reports a served certificate that is still expiring after a
+// reload attempt, once per certificate
+func alertExpiry(store tlsstore.CertificateProvider, state *State, cfg Config) {
+	leaf := store.Info().Leaf
+	fingerprint := Fingerprint(state.Current)
+	now := clock.Or(cfg.Clock).Now()
+	if !expiringSoon(leaf, cfg.ExpiryWarning, now) || fingerprint == state.expiryAlerted {
+		return
+	}
+	state.expiryAlerted = fingerprint
+
+	fields := map[string]string{"cert_file": cfg.CertFile, "fingerprint": fingerprint}
+	message := "certificate could not be parsed"
+	if leaf != nil {
+		fields["not_after"] = leaf.NotAfter.UTC().Format(time.RFC3339)
+		message = fmt.Sprintf("certificate expires in %s", leaf.NotAfter.Sub(now).Round(time.Minute))
+	}
+	notify.Send(cfg.Notifier, notify.Event{
+		Type:     notify.EventCertificateExpiring,
+		Severity: notify.SeverityWarning,
+		Message:  message,
+		Fields:   fields,
+	})
+}
+
+// rewatch adds back any path missing from the watcher's watch list and
+// reports whether any watch was re-established
+func rewatch(watcher FileWatcher, state *State, paths []string, logger *log.Logger) bool {
+	restored := false
+	watched := make(map[string]bool)
+	for _, p := range watcher.WatchList() {
+		watched[p] = true
+	}
+	for _, path := range paths {
+		if watched[path] {
+			continue
+		}
+		if err := watcher.Add(path); err != nil {
+			state.SetLastError(SourceWatcher, fmt.Errorf("agent: watch on %s dropped: %w", path, err))
+			continue
+		}
+		logger.Println("Agent: re-established watch on", path)
+		restored = true
+	}
+	return restored
+}
+
+// reloadCert loads, vets and serves the certificate in line, reporting
+// whether it was swapped in
+func reloadCert(store tlsstore.CertificateProvider, state *State, cfg Config, trigger string) bool {
+	return applyReload(store, state, cfg, loadCert(cfg, trigger))
+}
+
+// loadCert loads and vets the certificate for a reload. It touches neither
+// the store nor the state, so it can run off the watch loop. A panic is
+// handed to applyReload, which raises it again on the watch loop.
+func loadCert(cfg Config, trigger string) (res reloadResult) {
+	res = reloadResult{trigger: trigger, started: clock.Or(cfg.Clock).Now()}
+	defer func() {
+		if r := recover(); r != nil {
+			cfg.Logger.Printf("Agent: reload panicked: %v\n%s", r, debug.Stack())
+			res.cert, res.panicked = nil, r
+		}
+	}()
+	if res.cert, res.err = cfg.Load(cfg.CertFile, cfg.KeyFile); res.err == nil {
+		res.rejected = validate(res.cert, cfg)
+	}
+	return res
+}
+
+// applyReload records res and serves its certificate if it was loaded and
+// accepted, reporting whether it was swapped in
+func applyReload(store tlsstore.CertificateProvider, state *State, cfg Config, res reloadResult) bool {
+	if res.panicked != nil {
+		panic(res.panicked)
+	}
+	trigger, cert, err := res.trigger, res.cert, res.err
+	event := ReloadEvent{
+		Time:           res.started,
+		Trigger:        trigger,
+		OldFingerprint: Fingerprint(state.Current),
+	}
+
 	if err != nil {
-		log.Println("Agent: reload failed:", err)
+		cfg.Logger.Println("Agent: reload failed:", err)
+		event.Result, event.Error = ResultFailed, err.Error()
+		state.RecordReload(event)
+		state.SetLastError(SourceReload, err)
+		notify.Send(cfg.Notifier, notify.Event{
+			Type:     notify.EventReloadFailed,
+			Severity: notify.SeverityWarning,
+			Message:  err.Error(),
+			Fields:   map[string]string{"cert_file": cfg.CertFile, "trigger": trigger},
+		})
+		return false
+	}
+
+	if err := res.rejected; err != nil {
+		cfg.Logger.Println("Agent: reloaded certificate rejected:", err)
+		event.NewFingerprint = Fingerprint(cert)
+		event.Result, event.Error = ResultRejected, err.Error()
+		state.RecordReload(event)
+		state.SetLastError(SourceReload, err)
+
+		alert := notify.Event{
+			Type:     notify.EventReloadFailed,
+			Severity: notify.SeverityWarning,
+			Message:  err.Error(),
+			Fields:   map[string]string{"cert_file": cfg.CertFile, "trigger": trigger},
+		}
+		var violation *policy.ViolationError
+		if errors.As(err, &violation) {
+			alert.Type = notify.EventPolicyViolation
+			alert.Severity = notify.SeverityCritical
+		} else if errors.Is(err, ErrProbeFailed) {
+			alert.Severity = notify.SeverityCritical
+		}
+		notify.Send(cfg.Notifier, alert)
 		return false
 	}
 
+	retired := retire(store, state.Previous, func() { store.Update(cert) })
 	state.Previous = state.Current
 	state.Current = cert
-	store.Update(cert)
+	if cfg.ZeroizeRetired {
+		for _, r := range retired {
+			zeroizeRetired(r, store, state, cfg)
+		}
+	}
 
-	log.Println("Agent: certificate reloaded successfully")
+	event.NewFingerprint = Fingerprint(cert)
+	event.Result = ResultSuccess
+	state.RecordReload(event)
+	state.ClearLastError(SourceReload)
+
+	cfg.Logger.Println("Agent: certificate reloaded successfully")
+	notify.Send(cfg.Notifier, notify.Event{
+		Type:     notify.EventReloadSucceeded,
+		Severity: notify.SeverityInfo,
+		Message:  "certificate reloaded",
+		Fields: map[string]string{
+			"cert_file":   cfg.CertFile,
+			"fingerprint": event.NewFingerprint,
+			"trigger":     trigger,
+		},
+	})
 	return true
 }
+
+// retire runs update and returns the certificates it retired: for a store
+// that retains versions those it stopped retaining, otherwise previous
+func retire(store tlsstore.CertificateProvider, previous *tls.Certificate, update func()) []*tls.Certificate {
+	versioned, ok := store.(tlsstore.Versioned)
+	if !ok {
+		update()
+		if previous == nil {
+			return nil
+		}
+		return []*tls.Certificate{previous}
+	}
+
+	before := versioned.Versions()
+	update()
+	kept := make(map[*tls.Certificate]bool)
+	for _, v := range versioned.Versions() {
+		kept[v.Cert] = true
+	}
+	var retired []*tls.Certificate
+	for _, v := range before {
+		if !kept[v.Cert] {
+			kept[v.Cert] = true
+			retired = append(retired, v.Cert)
+		}
+	}
+	return retired
+}
+
+// zeroizeRetired overwrites the key of retired after cfg.ZeroizeDelay on
+// cfg.Clock, unless the current or previous certificate, or a version the
+// store retains, shares it
+func zeroizeRetired(retired *tls.Certificate, store tlsstore.CertificateProvider, state *State, cfg Config) {
+	if retired == nil {
+		return
+	}
+	live := []*tls.Certificate{state.Current, state.Previous}
+	if versioned, ok := store.(tlsstore.Versioned); ok {
+		for _, v := range versioned.Versions() {
+			live = append(live, v.Cert)
+		}
+	}
+	for _, live := range live {
+		if live != nil && (live == retired || tlsstore.SameKey(live.PrivateKey, retired.PrivateKey)) {
+			return
+		}
+	}
+	fingerprint := Fingerprint(retired)
+	timer := clock.Or(cfg.Clock).NewTimer(cfg.ZeroizeDelay)
+	go func() {
+		<-timer.C()
+		if !tlsstore.Zeroize(retired) {
+			return
+		}
+		tlsstore.AuditKey("zeroized", fingerprint)
+		if cfg.OnZeroize != nil {
+			cfg.OnZeroize(fingerprint)
+		}
+	}()
+}
+
+// rollbackCert swaps the current and previous certificates, so a second
+// rollback undoes the first
+func rollbackCert(store tlsstore.CertificateProvider, state *State, cfg Config) error {
+	if state.Previous == nil {
+		return ErrNoPrevious
+	}
+	event := ReloadEvent{
+		Time:           clock.Or(cfg.Clock).Now(),
+		Trigger:        TriggerRollback,
+		OldFingerprint: Fingerprint(state.Current),
+		NewFingerprint: Fingerprint(state.Previous),
+		Result:         ResultSuccess,
+	}
+
+	state.Current, state.Previous = state.Previous, state.Current
+	retired := retire(store, nil, func() { store.Update(state.Current) })
+	state.RecordReload(event)
+	if cfg.ZeroizeRetired {
+		for _, r := range retired {
+			zeroizeRetired(r, store, state, cfg)
+		}
+	}
+
+	cfg.Logger.Println("Agent: rolled back to previous certificate", event.NewFingerprint)
+	notifyRollback(cfg, event)
+	return nil
+}
+
+// rollbackToVersion restores a version retained by the store. The replaced
+// certificate becomes the previous one, so Rollback undoes it.
+func rollbackToVersion(store tlsstore.CertificateProvider, state *State, cfg Config, version uint64) (tlsstore.VersionInfo, error) {
+	versioned, ok := store.(tlsstore.Versioned)
+	if !ok {
+		return tlsstore.VersionInfo{}, ErrNotVersioned
+	}
+	var info tlsstore.VersionInfo
+	var err error
+	retired := retire(store, nil, func() { info, err = versioned.Rollback(version) })
+	if err != nil {
+		return info, err
+	}
+	if info.Cert == state.Current {
+		return info, nil
+	}
+
+	event := ReloadEvent{
+		Time:           clock.Or(cfg.Clock).Now(),
+		Trigger:        TriggerRollback,
+		OldFingerprint: Fingerprint(state.Current),
+		NewFingerprint: Fingerprint(info.Cert),
+		Result:         ResultSuccess,
+	}
+	state.Previous, state.Current = state.Current, info.Cert
+	state.RecordReload(event)
+	if cfg.ZeroizeRetired {
+		for _, r := range retired {
+			zeroizeRetired(r, store, state, cfg)
+		}
+	}
+
+	cfg.Logger.Printf("Agent: rolled back to version %d as version %d: %s", version, info.Version, event.NewFingerprint)
+	notifyRollback(cfg, event)
+	return info, nil
+}
+
+func notifyRollback(cfg Config, event ReloadEvent) {
+	notify.Send(cfg.Notifier, notify.Event{
+		Type:     notify.EventReloadSucceeded,
+		Severity: notify.SeverityWarning,
+		Message:  "certificate rolled back",
+		Fields: map[string]string{
+			"cert_file":   cfg.CertFile,
+			"fingerprint": event.NewFingerprint,
+			"trigger":     TriggerRollback,
+		},
+	})
+}
+
+// validate rejects certificates that are not yet valid beyond the NotBefore
+// grace window, then applies cfg.Validate and cfg.Probe. Expired
+// certificates are left to the expiry check so that an expired replacement
+// is still reported there.
+func validate(cert *tls.Certificate, cfg Config) error {
+	leaf, err := tlsstore.ParseLeaf(cert)
+	if err != nil {
+		return err
+	}
+	now := clock.Or(cfg.Clock).Now()
+	if _, err := tlsstore.CheckValidity(leaf, now, cfg.NotBeforeGrace); errors.Is(err, tlsstore.ErrNotYetValid) {
+		return err
+	}
+	if cfg.Validate != nil {
+		if err := cfg.Validate(cert); err != nil {
+			return err
+		}
+	}
+	if cfg.Probe != nil {
+		if err := cfg.Probe(cert); err != nil {
+			return fmt.Errorf("%w: %w", ErrProbeFailed, err)
+		}
+	}
+	return nil
+}
@@ -2,14 +2,24 @@ package agent
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/tls"
+	"errors"
+	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"sync/atomic"
 	"syscall"
 	"testing"
 	"time"
 
+	"tls-agent/internal/clock"
+	"tls-agent/internal/notify"
+	"tls-agent/internal/policy"
 	"tls-agent/internal/tlsstore"
 )
 
@@ -558,6 +568,534 @@ func TestAgentIntegration(t *testing.T) {
 	}
 }
 
+// TestReloadPolicyViolation tests that a rejected certificate is not swapped in
+func TestReloadPolicyViolation(t *testing.T) {
+	cert, err := tlsstore.Load("../../certs/server.crt", "../../certs/server.key")
+	if err != nil {
+		t.Fatalf("Failed to load certificates: %v", err)
+	}
+
+	store := tlsstore.New(cert)
+	state := NewState(cert)
+
+	var events []notify.Event
+	cfg := DefaultConfig()
+	cfg.CertFile = "../../certs/server.crt"
+	cfg.KeyFile = "../../certs/server.key"
+	cfg.Validate = policy.Policy{RequiredSANs: []string{"not-present.example.com"}}.Check
+	cfg.Notifier = notify.NotifierFunc(func(_ context.Context, e notify.Event) error {
+		events = append(events, e)
+		return nil
+	})
+
+	if reloadCert(store, state, cfg, TriggerFileChange) {
+		t.Fatal("Reload should be rejected by policy")
+	}
+	if state.Current != cert || state.Previous != nil {
+		t.Error("State should be unchanged after a rejected reload")
+	}
+	if got, _ := store.GetCertificate(nil); got != cert {
+		t.Error("Store should keep serving the current certificate")
+	}
+	if len(events) != 1 || events[0].Type != notify.EventPolicyViolation {
+		t.Errorf("Expected one policy violation event, got %+v", events)
+	}
+
+	cfg.Validate = nil
+	if !reloadCert(store, state, cfg, TriggerFileChange) {
+		t.Fatal("Reload without policy should succeed")
+	}
+	if state.Previous != cert {
+		t.Error("Previous certificate should be recorded after a successful reload")
+	}
+}
+
+// TestReloadNotBeforeGrace tests that certificates from a CA with a skewed
+// clock are accepted only within the grace window
+func TestReloadNotBeforeGrace(t *testing.T) {
+	cert, err := tlsstore.Load("../../certs/server.crt", "../../certs/server.key")
+	if err != nil {
+		t.Fatalf("Failed to load certificates: %v", err)
+	}
+
+	store := tlsstore.New(cert)
+	state := NewState(cert)
+
+	// Our clock runs 10 minutes behind the CA that issued the certificate
+	fake := clock.NewFake(cert.Leaf.NotBefore.Add(-10 * time.Minute))
+
+	cfg := DefaultConfig()
+	cfg.CertFile = "../../certs/server.crt"
+	cfg.KeyFile = "../../certs/server.key"
+	cfg.Clock = fake
+	cfg.NotBeforeGrace = 5 * time.Minute
+
+	if reloadCert(store, state, cfg, TriggerFileChange) {
+		t.Fatal("Reload should be rejected beyond the grace window")
+	}
+	if history := state.History(); len(history) != 1 || history[0].Result != ResultRejected {
+		t.Errorf("Expected a rejected reload, got %+v", history)
+	}
+
+	cfg.NotBeforeGrace = 15 * time.Minute
+	if !reloadCert(store, state, cfg, TriggerFileChange) {
+		t.Fatal("Reload should be accepted within the grace window")
+	}
+}
+
+// TestReloadProbe tests that a failed probe keeps the current certificate
+// and raises a critical alert
+func TestReloadProbe(t *testing.T) {
+	cert, err := tlsstore.Load("../../certs/server.crt", "../../certs/server.key")
+	if err != nil {
+		t.Fatalf("Failed to load certificates: %v", err)
+	}
+
+	store := tlsstore.New(cert)
+	state := NewState(cert)
+
+	var alerts []notify.Event
+	cfg := DefaultConfig()
+	cfg.CertFile = "../../certs/server.crt"
+	cfg.KeyFile = "../../certs/server.key"
+	cfg.Notifier = notify.NotifierFunc(func(_ context.Context, e notify.Event) error {
+		alerts = append(alerts, e)
+		return nil
+	})
+	cfg.Probe = func(*tls.Certificate) error { return errors.New("x509: certificate signed by unknown authority") }
+
+	if reloadCert(store, state, cfg, TriggerFileChange) {
+		t.Fatal("Reload should be rejected when the probe fails")
+	}
+	if served, _ := store.GetCertificate(nil); served != cert {
+		t.Error("Expected the current certificate to stay in service")
+	}
+	if len(alerts) != 1 || alerts[0].Severity != notify.SeverityCritical {
+		t.Errorf("Expected one critical alert, got %+v", alerts)
+	}
+	if last := state.GetLastError(); last == nil || !strings.Contains(last.Message, ErrProbeFailed.Error()) {
+		t.Errorf("Expected the probe failure as the last error, got %+v", last)
+	}
+
+	cfg.Probe = func(*tls.Certificate) error { return nil }
+	if !reloadCert(store, state, cfg, TriggerFileChange) {
+		t.Fatal("Reload should succeed when the probe passes")
+	}
+}
+
+// TestReloadZeroizesRetiredKey tests that the key of a certificate dropped
+// from the rollback slot is overwritten, and live keys are left alone
+func TestReloadZeroizesRetiredKey(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.CertFile = "../../certs/server.crt"
+	cfg.KeyFile = "../../certs/server.key"
+	cfg.ZeroizeRetired = true
+	cfg.ZeroizeDelay = time.Minute
+	fake := clock.NewFake(time.Now())
+	cfg.Clock = fake
+	zeroized := make(chan string, 4)
+	cfg.OnZeroize = func(fingerprint string) { zeroized <- fingerprint }
+	var keys []*ecdsa.PrivateKey
+	cfg.Load = func(certFile, keyFile string) (*tls.Certificate, error) {
+		cert, err := tlsstore.Load(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+		cert.PrivateKey = key
+		return cert, nil
+	}
+
+	first, err := cfg.Load(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		t.Fatalf("Failed to load certificates: %v", err)
+	}
+	// Versions the store retains for rollback keep their keys, so retain
+	// only the current and previous ones
+	store := tlsstore.New(first)
+	store.SetRetainedVersions(2)
+	state := NewState(first)
+	for range 2 {
+		if !reloadCert(store, state, cfg, TriggerFileChange) {
+			t.Fatal("Reload failed")
+		}
+	}
+
+	// The key stays usable for handshakes in flight until the delay passes
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := fake.BlockUntil(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if keys[0].D.Sign() == 0 {
+		t.Fatal("Expected the retired key to be kept until the delay passes")
+	}
+	fake.Advance(cfg.ZeroizeDelay)
+	select {
+	case fingerprint := <-zeroized:
+		if fingerprint != Fingerprint(first) {
+			t.Errorf("Expected the first certificate's key to be zeroized, got %s", fingerprint)
+		}
+	case <-ctx.Done():
+		t.Fatal("Timed out waiting for the retired key to be zeroized")
+	}
+	if keys[0].D.Sign() != 0 {
+		t.Error("Expected the retired key to be zeroized")
+	}
+	for _, key := range keys[1:] {
+		if key.D.Sign() == 0 {
+			t.Error("Expected the current and previous keys to be kept")
+		}
+	}
+}
+
+// TestAgentRecoversFromPanic tests that a panicking reload restarts the watcher
+func TestAgentRecoversFromPanic(t *testing.T) {
+	cert, err := tlsstore.Load("../../certs/server.crt", "../../certs/server.key")
+	if err != nil {
+		t.Fatalf("Failed to load certificates: %v", err)
+	}
+
+	dir := t.TempDir()
+	cfg := DefaultConfig()
+	cfg.CertFile = dir + "/server.crt"
+	cfg.KeyFile = dir + "/server.key"
+	for _, path := range []string{cfg.CertFile, cfg.KeyFile} {
+		if err := os.WriteFile(path, []byte("placeholder"), 0600); err != nil {
+			t.Fatalf("Failed to create %s: %v", path, err)
+		}
+	}
+	cfg.Load = func(string, string) (*tls.Certificate, error) {
+		panic("loader bug")
+	}
+	cfg.Debounce = 10 * time.Millisecond
+
+	store := tlsstore.New(cert)
+	state := NewState(cert)
+	agentStopChan := make(chan struct{})
+	agentDone := make(chan struct{})
+	restartsBefore := watcherRestarts.Value()
+
+	go func() {
+		RunWithConfig(store, state, agentStopChan, cfg)
+		close(agentDone)
+	}()
+
+	// Give the watcher time to start, then trigger a reload
+	time.Sleep(100 * time.Millisecond)
+	if err := os.WriteFile(cfg.CertFile, []byte("changed"), 0600); err != nil {
+		t.Fatalf("Failed to modify certificate: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for watcherRestarts.Value() == restartsBefore && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if watcherRestarts.Value() == restartsBefore {
+		t.Error("Expected the watcher to be restarted after a panic")
+	}
+	if last := state.GetLastError(); last == nil || last.Source != SourceWatcher {
+		t.Errorf("Expected the panic to be recorded as a watcher error, got %+v", last)
+	}
+
+	close(agentStopChan)
+	select {
+	case <-agentDone:
+	case <-time.After(5 * time.Second):
+		t.Error("Agent did not stop after recovering from a panic")
+	}
+}
+
+// TestAgentExpiryCheckUsesConfig tests that the periodic check reloads and
+// alerts once the clock reaches the expiry warning window
+func TestAgentExpiryCheckUsesConfig(t *testing.T) {
+	fsys, cert := memPair(t)
+	fake := clock.NewFake(time.Now())
+	_, events := startMem(t, fsys, cert, []string{"/certs/server.crt"},
+		WithPaths("/certs/server.crt", "/certs/server.key"), WithClock(fake))
+
+	// Wait for the check ticker, then fast-forward to three days before expiry
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := fake.BlockUntil(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	fake.Set(cert.Leaf.NotAfter.Add(-72 * time.Hour))
+
+	if e := nextEvent(t, events); e.Type != notify.EventReloadSucceeded || e.Fields["trigger"] != TriggerExpiry {
+		t.Fatalf("Expected an expiry-triggered reload, got %+v", e)
+	}
+	e := nextEvent(t, events)
+	if e.Type != notify.EventCertificateExpiring || e.Message != "certificate expires in 72h0m0s" {
+		t.Errorf("Expected an expiry alert measured on the fake clock, got %+v", e)
+	}
+}
+
+// TestAlertExpiry tests that an expiring certificate is reported once
+func TestAlertExpiry(t *testing.T) {
+	cert, err := tlsstore.Load("../../certs/server.crt", "../../certs/server.key")
+	if err != nil {
+		t.Fatalf("Failed to load certificates: %v", err)
+	}
+
+	var alerts []notify.Event
+	cfg := DefaultConfig()
+	cfg.Notifier = notify.NotifierFunc(func(_ context.Context, e notify.Event) error {
+		alerts = append(alerts, e)
+		return nil
+	})
+	store := tlsstore.New(cert)
+	state := NewState(cert)
+
+	alertExpiry(store, state, cfg)
+	if len(alerts) != 0 {
+		t.Fatalf("Expected no alert outside the warning window, got %+v", alerts)
+	}
+
+	cfg.ExpiryWarning = 100 * 365 * 24 * time.Hour
+	alertExpiry(store, state, cfg)
+	alertExpiry(store, state, cfg)
+	if len(alerts) != 1 || alerts[0].Type != notify.EventCertificateExpiring || alerts[0].Fields["not_after"] == "" {
+		t.Errorf("Expected one expiring alert, got %+v", alerts)
+	}
+}
+
+// TestAgentManualReload tests that a receive on Config.Reload forces a reload
+func TestAgentManualReload(t *testing.T) {
+	cert, err := tlsstore.Load("../../certs/server.crt", "../../certs/server.key")
+	if err != nil {
+		t.Fatalf("Failed to load certificates: %v", err)
+	}
+
+	reload := make(chan struct{})
+	cfg := DefaultConfig()
+	cfg.CertFile = "../../certs/server.crt"
+	cfg.KeyFile = "../../certs/server.key"
+	cfg.Reload = reload
+
+	store := tlsstore.New(cert)
+	state := NewState(cert)
+	agentStopChan := make(chan struct{})
+	agentDone := make(chan struct{})
+
+	go func() {
+		RunWithConfig(store, state, agentStopChan, cfg)
+		close(agentDone)
+	}()
+
+	reload <- struct{}{}
+	deadline := time.Now().Add(2 * time.Second)
+	for len(state.History()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(agentStopChan)
+	<-agentDone
+
+	history := state.History()
+	if len(history) != 1 || history[0].Trigger != TriggerManual || history[0].Result != ResultSuccess {
+		t.Errorf("Expected one successful manual reload, got %+v", history)
+	}
+}
+
+// TestAgentRollback tests that a rollback restores the certificate replaced
+// by the last reload and fails when nothing has been replaced
+func TestAgentRollback(t *testing.T) {
+	cert, err := tlsstore.Load("../../certs/server.crt", "../../certs/server.key")
+	if err != nil {
+		t.Fatalf("Failed to load certificates: %v", err)
+	}
+
+	reload := make(chan struct{})
+	rollback := make(chan chan error)
+	cfg := DefaultConfig()
+	cfg.CertFile = "../../certs/server.crt"
+	cfg.KeyFile = "../../certs/server.key"
+	cfg.Reload = reload
+	cfg.Rollback = rollback
+
+	store := tlsstore.New(cert)
+	state := NewState(cert)
+	agentStopChan := make(chan struct{})
+	agentDone := make(chan struct{})
+
+	go func() {
+		RunWithConfig(store, state, agentStopChan, cfg)
+		close(agentDone)
+	}()
+	defer func() {
+		close(agentStopChan)
+		<-agentDone
+	}()
+
+	roll := func() error {
+		reply := make(chan error, 1)
+		rollback <- reply
+		return <-reply
+	}
+
+	if err := roll(); !errors.Is(err, ErrNoPrevious) {
+		t.Fatalf("Expected ErrNoPrevious before any reload, got %v", err)
+	}
+
+	reload <- struct{}{}
+	deadline := time.Now().Add(2 * time.Second)
+	for len(state.History()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if served, _ := store.GetCertificate(nil); served == cert {
+		t.Fatal("Expected the reload to replace the served certificate")
+	}
+
+	if err := roll(); err != nil {
+		t.Fatalf("Failed to roll back: %v", err)
+	}
+	if served, _ := store.GetCertificate(nil); served != cert {
+		t.Error("Expected the original certificate to be served after rollback")
+	}
+	if history := state.History(); history[0].Trigger != TriggerRollback || history[0].Result != ResultSuccess {
+		t.Errorf("Expected a successful rollback event, got %+v", history[0])
+	}
+}
+
+// TestAgentAtomicReplace tests that replacing a certificate by renaming a
+// new file over it triggers a reload even though no write event is seen,
+// and that the dropped watch is re-established
+func TestAgentAtomicReplace(t *testing.T) {
+	fsys, cert := memPair(t)
+	a, events := startMem(t, fsys, cert, []string{"/certs/server.crt", "/certs/server.key"},
+		WithPaths("/certs/server.crt", "/certs/server.key"))
+
+	data, err := fsys.ReadFile("/certs/server.crt")
+	if err != nil {
+		t.Fatalf("Failed to read certificate: %v", err)
+	}
+	fsys.WriteFile("/certs/server.crt.tmp", data)
+	if err := fsys.Rename("/certs/server.crt.tmp", "/certs/server.crt"); err != nil {
+		t.Fatalf("Failed to replace certificate: %v", err)
+	}
+	if e := nextEvent(t, events); e.Type != notify.EventReloadSucceeded {
+		t.Fatalf("Expected a successful reload, got %+v", e)
+	}
+
+	history := a.State().History()
+	if len(history) == 0 || history[0].Trigger != TriggerFileChange || history[0].Result != ResultSuccess {
+		t.Errorf("Expected a successful file change reload, got %+v", history)
+	}
+
+	// The watch is back, so a later write reloads again
+	fsys.WriteFile("/certs/server.crt", data)
+	if e := nextEvent(t, events); e.Type != notify.EventReloadSucceeded {
+		t.Errorf("Expected a reload after the watch was restored, got %+v", e)
+	}
+}
+
+// TestAgentCombinedFile tests watching and reloading a single file holding
+// the key and certificate
+func TestAgentCombinedFile(t *testing.T) {
+	fsys, _ := memPair(t)
+	data := append(mustRead(t, fsys, "/certs/server.key"), mustRead(t, fsys, "/certs/server.crt")...)
+	fsys.WriteFile("/certs/server.pem", data)
+	cert, err := LoadFS(fsys)("/certs/server.pem", "")
+	if err != nil {
+		t.Fatalf("Failed to load combined file: %v", err)
+	}
+
+	var logs syncBuffer
+	a, events := startMem(t, fsys, cert, []string{"/certs/server.pem"},
+		WithPaths("/certs/server.pem", ""), WithLogger(log.New(&logs, "", 0)))
+
+	fsys.WriteFile("/certs/server.pem.tmp", data)
+	if err := fsys.Rename("/certs/server.pem.tmp", "/certs/server.pem"); err != nil {
+		t.Fatalf("Failed to replace combined file: %v", err)
+	}
+	if e := nextEvent(t, events); e.Type != notify.EventReloadSucceeded {
+		t.Errorf("Expected a successful reload of the combined file, got %+v", e)
+	}
+	if err := a.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+	if !strings.Contains(logs.String(), "Agent: watching /certs/server.pem for changes") || strings.Contains(logs.String(), "failed to watch") {
+		t.Errorf("Expected only the combined file to be watched, got %q", logs.String())
+	}
+}
+
+// TestAgentChainFile tests that changing only the chain file reloads the
+// certificate
+func TestAgentChainFile(t *testing.T) {
+	fsys, cert := memPair(t)
+	fsys.WriteFile("/certs/chain.pem", []byte("chain"))
+	a, events := startMem(t, fsys, cert, []string{"/certs/chain.pem"},
+		WithPaths("/certs/server.crt", "/certs/server.key"), WithChainFile("/certs/chain.pem"))
+
+	fsys.WriteFile("/certs/chain.pem", []byte("re-issued chain"))
+	nextEvent(t, events)
+	if history := a.State().History(); len(history) == 0 || history[0].Trigger != TriggerFileChange {
+		t.Errorf("Expected a file change reload, got %+v", history)
+	}
+}
+
+// TestAgentWatchdog tests that the watch loop pings the watchdog periodically
+func TestAgentWatchdog(t *testing.T) {
+	cert, err := tlsstore.Load("../../certs/server.crt", "../../certs/server.key")
+	if err != nil {
+		t.Fatalf("Failed to load certificates: %v", err)
+	}
+
+	var pings atomic.Int32
+	cfg := DefaultConfig()
+	cfg.CertFile = "../../certs/server.crt"
+	cfg.KeyFile = "../../certs/server.key"
+	cfg.Watchdog = func() { pings.Add(1) }
+	cfg.WatchdogInterval = 10 * time.Millisecond
+
+	agentStopChan := make(chan struct{})
+	agentDone := make(chan struct{})
+	go func() {
+		RunWithConfig(tlsstore.New(cert), NewState(cert), agentStopChan, cfg)
+		close(agentDone)
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for pings.Load() < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(agentStopChan)
+	<-agentDone
+
+	if pings.Load() < 3 {
+		t.Errorf("Expected repeated watchdog pings, got %d", pings.Load())
+	}
+}
+
+// TestExpiringSoon tests the expiry check, including certificates without a cached leaf
+func TestExpiringSoon(t *testing.T) {
+	cert, err := tlsstore.Load("../../certs/server.crt", "../../certs/server.key")
+	if err != nil {
+		t.Fatalf("Failed to load certificates: %v", err)
+	}
+	// The store parses certificates loaded without a cached leaf
+	leaf := tlsstore.New(&tls.Certificate{Certificate: cert.Certificate}).Leaf()
+	now := time.Now()
+	remaining := cert.Leaf.NotAfter.Sub(now)
+
+	if expiringSoon(leaf, remaining-time.Hour, now) {
+		t.Error("Certificate should not be expiring within a shorter window")
+	}
+	if !expiringSoon(leaf, remaining+time.Hour, now) {
+		t.Error("Certificate without a cached leaf should still be checked")
+	}
+	if !expiringSoon(leaf, time.Hour, cert.Leaf.NotAfter.Add(-time.Minute)) {
+		t.Error("Certificate should be expiring an hour before NotAfter")
+	}
+	if !expiringSoon(nil, time.Hour, now) {
+		t.Error("A missing certificate should trigger a reload attempt")
+	}
+}
+
 // BenchmarkAgentOperations benchmarks agent operations
 func BenchmarkAgentOperations(b *testing.B) {
 	cert, err := tlsstore.Load("../../certs/server.crt", "../../certs/server.key")
@@ -0,0 +1,13 @@
+package agent
+
+import "tls-agent/internal/clock"
+
+// Clock abstracts time so that debounce, expiry checks and scheduling can
+// be driven deterministically in tests, e.g. by a clock.Fake
+type Clock = clock.Clock
+
+// Timer is the subset of *time.Timer used by the agent
+type Timer = clock.Timer
+
+// RealClock is the wall clock
+type RealClock = clock.Real
@@ -0,0 +1,66 @@
+package agent
+
+import "time"
+
+// debouncer coalesces bursts of file events into one trailing-edge reload:
+// every event restarts the quiet period and the reload runs once it elapses.
+// It is owned by a single goroutine.
+type debouncer struct {
+	clock    timerClock
+	interval time.Duration
+	timer    Timer
+	pending  bool
+}
+
+// timerClock is the part of Clock a debouncer needs
+type timerClock interface {
+	NewTimer(d time.Duration) Timer
+}
+
+func newDebouncer(clock timerClock, interval time.Duration) *debouncer {
+	return &debouncer{clock: clock, interval: interval}
+}
+
+// Trigger records an event and (re)starts the quiet period. It reports
+// whether the caller should act immediately because debouncing is disabled.
+func (d *debouncer) Trigger() bool {
+	if d.interval <= 0 {
+		return true
+	}
+
+	if d.timer == nil {
+		d.timer = d.clock.NewTimer(d.interval)
+	} else {
+		// Drain a fire that raced with this event so C does not deliver a stale tick
+		if !d.timer.Stop() && d.pending {
+			select {
+			case <-d.timer.C():
+			default:
+			}
+		}
+		d.timer.Reset(d.interval)
+	}
+	d.pending = true
+	return false
+}
+
+// C delivers once the quiet period after the last event elapses. It is nil
+// (blocking forever in a select) while nothing is pending.
+func (d *debouncer) C() <-chan time.Time {
+	if !d.pending {
+		return nil
+	}
+	return d.timer.C()
+}
+
+// Done marks the pending event as handled after a receive from C
+func (d *debouncer) Done() {
+	d.pending = false
+}
+
+// Stop releases the timer
+func (d *debouncer) Stop() {
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+}
@@ -0,0 +1,92 @@
+package agent
+
+import (
+	"testing"
+	"time"
+
+	"tls-agent/internal/clock"
+)
+
+func newFakeClock() *clock.Fake {
+	return clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+}
+
+// fired reports whether the debouncer's channel has a tick ready
+func fired(d *debouncer) bool {
+	select {
+	case <-d.C():
+		d.Done()
+		return true
+	default:
+		return false
+	}
+}
+
+// TestDebounceTrailingEdge tests that a burst of events produces one reload
+// after the quiet period
+func TestDebounceTrailingEdge(t *testing.T) {
+	clock := newFakeClock()
+	d := newDebouncer(clock, 2*time.Second)
+
+	if d.C() != nil {
+		t.Fatal("Idle debouncer should have a nil channel")
+	}
+
+	// Events every second keep pushing the reload out
+	for i := 0; i < 5; i++ {
+		if d.Trigger() {
+			t.Fatal("Trigger should defer while debouncing is enabled")
+		}
+		clock.Advance(time.Second)
+		if fired(d) {
+			t.Fatalf("Debouncer fired during the burst (event %d)", i)
+		}
+	}
+
+	// Exactly at the window boundary the reload fires once
+	clock.Advance(time.Second)
+	if !fired(d) {
+		t.Fatal("Expected the debouncer to fire after the quiet period")
+	}
+	clock.Advance(10 * time.Second)
+	if fired(d) {
+		t.Error("Debouncer should fire only once per burst")
+	}
+
+	// A later event starts a new window
+	d.Trigger()
+	clock.Advance(2 * time.Second)
+	if !fired(d) {
+		t.Error("Expected a second burst to fire")
+	}
+}
+
+// TestDebounceStaleTick tests that an event arriving after the timer fired
+// but before it was handled does not cause a premature reload
+func TestDebounceStaleTick(t *testing.T) {
+	clock := newFakeClock()
+	d := newDebouncer(clock, 2*time.Second)
+
+	d.Trigger()
+	clock.Advance(2 * time.Second) // fires, tick not yet received
+	d.Trigger()                    // new event restarts the window
+
+	if fired(d) {
+		t.Fatal("Stale tick should have been drained")
+	}
+	clock.Advance(2 * time.Second)
+	if !fired(d) {
+		t.Error("Expected the restarted window to fire")
+	}
+}
+
+// TestDebounceDisabled tests that a zero interval acts immediately
+func TestDebounceDisabled(t *testing.T) {
+	d := newDebouncer(newFakeClock(), 0)
+	if !d.Trigger() {
+		t.Error("Trigger should act immediately when debouncing is disabled")
+	}
+	if d.C() != nil {
+		t.Error("Disabled debouncer should never deliver")
+	}
+}
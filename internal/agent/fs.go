@@ -0,0 +1,77 @@
+package agent
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"tls-agent/internal/tlsstore"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// FileSystem abstracts the file access and change notification used by the
+// watch loop, so that it can be driven by an in-memory fake in tests
+type FileSystem interface {
+	Stat(name string) (fs.FileInfo, error)
+	ReadFile(name string) ([]byte, error)
+	NewWatcher() (FileWatcher, error)
+}
+
+// FileWatcher is the subset of *fsnotify.Watcher used by the agent
+type FileWatcher interface {
+	Add(name string) error
+	WatchList() []string
+	Events() <-chan fsnotify.Event
+	Errors() <-chan error
+	Close() error
+}
+
+// OSFileSystem is the real file system, watched with fsnotify
+type OSFileSystem struct{}
+
+// Stat returns the file info of name
+func (OSFileSystem) Stat(name string) (fs.FileInfo, error) { return os.Stat(name) }
+
+// ReadFile reads name
+func (OSFileSystem) ReadFile(name string) ([]byte, error) { return os.ReadFile(name) }
+
+// NewWatcher creates an fsnotify watcher
+func (OSFileSystem) NewWatcher() (FileWatcher, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	return osWatcher{w}, nil
+}
+
+type osWatcher struct{ w *fsnotify.Watcher }
+
+func (w osWatcher) Add(name string) error         { return w.w.Add(name) }
+func (w osWatcher) WatchList() []string           { return w.w.WatchList() }
+func (w osWatcher) Events() <-chan fsnotify.Event { return w.w.Events }
+func (w osWatcher) Errors() <-chan error          { return w.w.Errors }
+func (w osWatcher) Close() error                  { return w.w.Close() }
+
+// LoadFS returns a load function reading pairs from fsys, for use with
+// WithSource. Unlike tlsstore.Load it does not check key file permissions,
+// which a FileSystem does not expose.
+func LoadFS(fsys FileSystem) func(certFile, keyFile string) (*tls.Certificate, error) {
+	return func(certFile, keyFile string) (*tls.Certificate, error) {
+		certPEM, err := fsys.ReadFile(certFile)
+		if err != nil {
+			return nil, fmt.Errorf("agent: read certificate: %w", err)
+		}
+		if tlsstore.IsCombined(certFile, keyFile) {
+			defer clear(certPEM)
+			return tlsstore.ParseCombined(certPEM)
+		}
+		keyPEM, err := fsys.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("agent: read key: %w", err)
+		}
+		defer clear(keyPEM)
+		return tlsstore.LoadFromPEM(certPEM, keyPEM)
+	}
+}
@@ -0,0 +1,148 @@
+package agent
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"tls-agent/internal/storage"
+)
+
+// DefaultHistorySize is the number of reload events kept in State
+const DefaultHistorySize = 32
+
+// historyKey is where PersistHistory keeps the reload history
+const historyKey = "history/reloads.json"
+
+// Reload triggers recorded in the history
+const (
+	TriggerFileChange = "file_change"
+	TriggerExpiry     = "expiry"
+	TriggerManual     = "manual"
+	TriggerRollback   = "rollback"
+)
+
+// Reload results recorded in the history
+const (
+	ResultSuccess  = "success"
+	ResultFailed   = "failed"
+	ResultRejected = "rejected"
+)
+
+// ReloadEvent records one reload attempt
+type ReloadEvent struct {
+	Time           time.Time `json:"time"`
+	Trigger        string    `json:"trigger"`
+	OldFingerprint string    `json:"old_fingerprint,omitempty"`
+	NewFingerprint string    `json:"new_fingerprint,omitempty"`
+	Result         string    `json:"result"`
+	Error          string    `json:"error,omitempty"`
+}
+
+// history is a fixed-size ring buffer of reload events
+type history struct {
+	mu     sync.Mutex
+	events []ReloadEvent
+	next   int
+	full   bool
+
+	// store, if set, receives the whole history after every event
+	store storage.Storage
+}
+
+func newHistory(size int) *history {
+	return &history{events: make([]ReloadEvent, size)}
+}
+
+func (h *history) add(e ReloadEvent) {
+	h.mu.Lock()
+	h.push(e)
+	h.mu.Unlock()
+
+	if h.store != nil {
+		if err := h.save(); err != nil {
+			log.Printf("Failed to persist reload history: %v", err)
+		}
+	}
+}
+
+func (h *history) push(e ReloadEvent) {
+	h.events[h.next] = e
+	h.next = (h.next + 1) % len(h.events)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// load replays the events saved in the store, keeping the newest that fit
+func (h *history) load() error {
+	data, _, err := h.store.Get(historyKey)
+	if errors.Is(err, storage.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var saved []ReloadEvent
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	// saved is newest first, so push it in reverse
+	for _, e := range slices.Backward(saved) {
+		h.push(e)
+	}
+	return nil
+}
+
+func (h *history) save() error {
+	data, err := json.Marshal(h.list())
+	if err != nil {
+		return err
+	}
+	return h.store.Put(historyKey, data)
+}
+
+// list returns the events newest first
+func (h *history) list() []ReloadEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	n := h.next
+	if h.full {
+		n = len(h.events)
+	}
+	out := make([]ReloadEvent, 0, n)
+	for i := 1; i <= n; i++ {
+		out = append(out, h.events[(h.next-i+len(h.events))%len(h.events)])
+	}
+	return out
+}
+
+// Fingerprint returns the hex SHA-256 of cert's leaf, or "" for nil
+func Fingerprint(cert *tls.Certificate) string {
+	if cert == nil || len(cert.Certificate) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(cert.Certificate[0])
+	return hex.EncodeToString(sum[:])
+}
+
+// HistoryHandler serves the reload history as JSON, newest first
+func HistoryHandler(state *State) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(struct {
+			Reloads []ReloadEvent `json:"reloads"`
+		}{state.History()})
+	})
+}
@@ -0,0 +1,109 @@
+package agent
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tls-agent/internal/storage"
+	"tls-agent/internal/tlsstore"
+)
+
+// TestHistoryRingBuffer tests ordering and eviction of reload events
+func TestHistoryRingBuffer(t *testing.T) {
+	h := newHistory(3)
+	if len(h.list()) != 0 {
+		t.Fatal("New history should be empty")
+	}
+
+	for i := 0; i < 5; i++ {
+		h.add(ReloadEvent{Trigger: string(rune('a' + i))})
+	}
+
+	events := h.list()
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 retained events, got %d", len(events))
+	}
+	for i, want := range []string{"e", "d", "c"} {
+		if events[i].Trigger != want {
+			t.Errorf("Event %d: expected trigger %s, got %s", i, want, events[i].Trigger)
+		}
+	}
+}
+
+// TestReloadHistory tests that reloads are recorded and served as JSON
+func TestReloadHistory(t *testing.T) {
+	cert, err := tlsstore.Load("../../certs/server.crt", "../../certs/server.key")
+	if err != nil {
+		t.Fatalf("Failed to load certificates: %v", err)
+	}
+
+	store := tlsstore.New(cert)
+	state := NewState(cert)
+
+	cfg := DefaultConfig()
+	cfg.CertFile = "../../certs/server.crt"
+	cfg.KeyFile = "../../certs/server.key"
+	reloadCert(store, state, cfg, TriggerFileChange)
+
+	cfg.Load = func(string, string) (*tls.Certificate, error) {
+		return nil, errors.New("disk on fire")
+	}
+	reloadCert(store, state, cfg, TriggerExpiry)
+
+	events := state.History()
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+	if events[0].Result != ResultFailed || events[0].Error != "disk on fire" || events[0].Trigger != TriggerExpiry {
+		t.Errorf("Unexpected newest event: %+v", events[0])
+	}
+	if events[1].Result != ResultSuccess || events[1].OldFingerprint != Fingerprint(cert) || events[1].NewFingerprint == "" {
+		t.Errorf("Unexpected oldest event: %+v", events[1])
+	}
+	if time.Since(events[1].Time) > time.Minute {
+		t.Error("Event time should be set")
+	}
+
+	rec := httptest.NewRecorder()
+	HistoryHandler(state).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/reloads", nil))
+
+	var body struct {
+		Reloads []ReloadEvent `json:"reloads"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(body.Reloads) != 2 {
+		t.Errorf("Expected 2 reloads in response, got %d", len(body.Reloads))
+	}
+}
+
+// TestPersistHistory tests that the reload history survives a restart
+func TestPersistHistory(t *testing.T) {
+	store := &storage.FS{Dir: t.TempDir()}
+
+	first := NewState(nil)
+	if err := first.PersistHistory(store); err != nil {
+		t.Fatalf("Failed to persist empty history: %v", err)
+	}
+	for _, trigger := range []string{TriggerFileChange, TriggerManual} {
+		first.RecordReload(ReloadEvent{Trigger: trigger, Result: ResultSuccess})
+	}
+
+	second := NewState(nil)
+	if err := second.PersistHistory(store); err != nil {
+		t.Fatalf("Failed to restore history: %v", err)
+	}
+	events := second.History()
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 restored events, got %d", len(events))
+	}
+	if events[0].Trigger != TriggerManual || events[1].Trigger != TriggerFileChange {
+		t.Errorf("Expected newest first, got %s, %s", events[0].Trigger, events[1].Trigger)
+	}
+}
@@ -0,0 +1,38 @@
+package agent
+
+import "time"
+
+// Error sources recorded in State
+const (
+	SourceWatcher = "watcher"
+	SourceReload  = "reload"
+	SourceOCSP    = "ocsp"
+)
+
+// LastError is the most recent failure seen by the agent or a subsystem
+type LastError struct {
+	Source  string    `json:"source"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// SetLastError records err from source as the most recent failure
+func (s *State) SetLastError(source string, err error) {
+	if err == nil {
+		return
+	}
+	s.lastErr.Store(&LastError{Source: source, Message: err.Error(), Time: time.Now()})
+}
+
+// ClearLastError clears the recorded failure if it came from source, so a
+// success in one subsystem does not hide a failure in another
+func (s *State) ClearLastError(source string) {
+	if cur := s.lastErr.Load(); cur != nil && cur.Source == source {
+		s.lastErr.CompareAndSwap(cur, nil)
+	}
+}
+
+// GetLastError returns the most recent unresolved failure, or nil
+func (s *State) GetLastError() *LastError {
+	return s.lastErr.Load()
+}
@@ -0,0 +1,92 @@
+package agent
+
+import (
+	"crypto/tls"
+	"errors"
+	"testing"
+
+	"tls-agent/internal/tlsstore"
+)
+
+// TestLastError tests recording and source-scoped clearing of failures
+func TestLastError(t *testing.T) {
+	state := NewState(nil)
+	if state.GetLastError() != nil {
+		t.Fatal("New state should have no last error")
+	}
+
+	state.SetLastError(SourceOCSP, errors.New("responder down"))
+	last := state.GetLastError()
+	if last == nil || last.Source != SourceOCSP || last.Message != "responder down" || last.Time.IsZero() {
+		t.Fatalf("Unexpected last error: %+v", last)
+	}
+
+	// A success elsewhere does not hide the failure
+	state.ClearLastError(SourceReload)
+	if state.GetLastError() == nil {
+		t.Error("Clearing another source should keep the error")
+	}
+
+	state.ClearLastError(SourceOCSP)
+	if state.GetLastError() != nil {
+		t.Error("Clearing the same source should remove the error")
+	}
+}
+
+// TestReloadLastError tests that reload failures are recorded and cleared on success
+func TestReloadLastError(t *testing.T) {
+	cert, err := tlsstore.Load("../../certs/server.crt", "../../certs/server.key")
+	if err != nil {
+		t.Fatalf("Failed to load certificates: %v", err)
+	}
+
+	store := tlsstore.New(cert)
+	state := NewState(cert)
+	cfg := DefaultConfig()
+	cfg.CertFile = "../../certs/server.crt"
+	cfg.KeyFile = "../../certs/server.key"
+
+	failing := cfg
+	failing.Load = func(string, string) (*tls.Certificate, error) {
+		return nil, errors.New("truncated key")
+	}
+	reloadCert(store, state, failing, TriggerFileChange)
+	if last := state.GetLastError(); last == nil || last.Source != SourceReload {
+		t.Fatalf("Expected reload error, got %+v", last)
+	}
+
+	reloadCert(store, state, cfg, TriggerFileChange)
+	if last := state.GetLastError(); last != nil {
+		t.Errorf("Successful reload should clear the error, got %+v", last)
+	}
+}
+
+// TestAgentWatcherErrors tests that injected watcher errors are recorded
+// like those of the file watcher
+func TestAgentWatcherErrors(t *testing.T) {
+	cert, err := tlsstore.Load("../../certs/server.crt", "../../certs/server.key")
+	if err != nil {
+		t.Fatalf("Failed to load certificates: %v", err)
+	}
+
+	injected := make(chan error)
+	cfg := DefaultConfig()
+	cfg.CertFile = "../../certs/server.crt"
+	cfg.KeyFile = "../../certs/server.key"
+	cfg.WatcherErrors = injected
+
+	state := NewState(cert)
+	agentStopChan := make(chan struct{})
+	agentDone := make(chan struct{})
+	go func() {
+		RunWithConfig(tlsstore.New(cert), state, agentStopChan, cfg)
+		close(agentDone)
+	}()
+
+	injected <- errors.New("inotify queue overflow")
+	close(agentStopChan)
+	<-agentDone
+	if last := state.GetLastError(); last == nil || last.Source != SourceWatcher || last.Message != "inotify queue overflow" {
+		t.Errorf("Expected the injected watcher error, got %+v", last)
+	}
+}
@@ -0,0 +1,227 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// MemFS is an in-memory FileSystem for tests. Its watchers behave like
+// fsnotify watches on files under inotify: writing a watched file sends
+// Write, and renaming a file over a watched one or removing it sends Remove
+// and drops the watch. Events are handed to the watch loop synchronously,
+// so when WriteFile, Rename or Remove returns the loop has received the
+// event; no sleeps are needed to order a test against the agent.
+type MemFS struct {
+	mu       sync.Mutex
+	files    map[string][]byte
+	watchers []*memWatcher
+	changed  chan struct{} // closed and replaced when a watch is added
+}
+
+// NewMemFS returns an empty MemFS
+func NewMemFS() *MemFS {
+	return &MemFS{files: make(map[string][]byte), changed: make(chan struct{})}
+}
+
+// Stat returns the size of name
+func (m *MemFS) Stat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return memFileInfo{name: name, size: int64(len(data))}, nil
+}
+
+// ReadFile returns a copy of name's contents
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return slices.Clone(data), nil
+}
+
+// WriteFile replaces name's contents in place, sending Write to watchers
+// of name
+func (m *MemFS) WriteFile(name string, data []byte) {
+	m.mu.Lock()
+	m.files[name] = slices.Clone(data)
+	m.mu.Unlock()
+	m.send(name, fsnotify.Write, false)
+}
+
+// Rename moves from over to, as an atomic replace does. Watchers of to see
+// Remove, since the file they watched is gone, and watchers of from see
+// Rename; both watches are dropped.
+func (m *MemFS) Rename(from, to string) error {
+	m.mu.Lock()
+	data, ok := m.files[from]
+	if !ok {
+		m.mu.Unlock()
+		return &fs.PathError{Op: "rename", Path: from, Err: fs.ErrNotExist}
+	}
+	_, replaced := m.files[to]
+	delete(m.files, from)
+	m.files[to] = data
+	m.mu.Unlock()
+
+	m.send(from, fsnotify.Rename, true)
+	if replaced {
+		m.send(to, fsnotify.Remove, true)
+	}
+	return nil
+}
+
+// Remove deletes name, sending Remove to its watchers and dropping their
+// watches
+func (m *MemFS) Remove(name string) error {
+	m.mu.Lock()
+	_, ok := m.files[name]
+	delete(m.files, name)
+	m.mu.Unlock()
+	if !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	m.send(name, fsnotify.Remove, true)
+	return nil
+}
+
+// InjectError sends err to every open watcher's error channel
+func (m *MemFS) InjectError(err error) {
+	for _, w := range m.open() {
+		select {
+		case w.errs <- err:
+		case <-w.done:
+		}
+	}
+}
+
+// WaitWatched blocks until a watcher watches name, or ctx ends
+func (m *MemFS) WaitWatched(ctx context.Context, name string) error {
+	for {
+		m.mu.Lock()
+		changed := m.changed
+		watched := false
+		for _, w := range m.watchers {
+			if w.watches[name] {
+				watched = true
+			}
+		}
+		m.mu.Unlock()
+		if watched {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return fmt.Errorf("agent: %s not watched: %w", name, ctx.Err())
+		}
+	}
+}
+
+// NewWatcher returns a watcher of m's files
+func (m *MemFS) NewWatcher() (FileWatcher, error) {
+	w := &memWatcher{
+		fs:      m,
+		watches: make(map[string]bool),
+		events:  make(chan fsnotify.Event),
+		errs:    make(chan error),
+		done:    make(chan struct{}),
+	}
+	m.mu.Lock()
+	m.watchers = append(m.watchers, w)
+	m.mu.Unlock()
+	return w, nil
+}
+
+// open returns the watchers not yet closed
+func (m *MemFS) open() []*memWatcher {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.watchers)
+}
+
+// send delivers an event for name to its watchers, waiting until each
+// receives it or is closed, and drops their watches if unwatch
+func (m *MemFS) send(name string, op fsnotify.Op, unwatch bool) {
+	for _, w := range m.open() {
+		m.mu.Lock()
+		watched := w.watches[name]
+		if watched && unwatch {
+			delete(w.watches, name)
+		}
+		m.mu.Unlock()
+		if !watched {
+			continue
+		}
+		select {
+		case w.events <- fsnotify.Event{Name: name, Op: op}:
+		case <-w.done:
+		}
+	}
+}
+
+type memWatcher struct {
+	fs      *MemFS
+	watches map[string]bool // guarded by fs.mu
+	events  chan fsnotify.Event
+	errs    chan error
+	done    chan struct{}
+}
+
+func (w *memWatcher) Add(name string) error {
+	w.fs.mu.Lock()
+	defer w.fs.mu.Unlock()
+	if _, ok := w.fs.files[name]; !ok {
+		return &fs.PathError{Op: "watch", Path: name, Err: fs.ErrNotExist}
+	}
+	w.watches[name] = true
+	close(w.fs.changed)
+	w.fs.changed = make(chan struct{})
+	return nil
+}
+
+func (w *memWatcher) WatchList() []string {
+	w.fs.mu.Lock()
+	defer w.fs.mu.Unlock()
+	list := make([]string, 0, len(w.watches))
+	for name := range w.watches {
+		list = append(list, name)
+	}
+	return list
+}
+
+func (w *memWatcher) Events() <-chan fsnotify.Event { return w.events }
+func (w *memWatcher) Errors() <-chan error          { return w.errs }
+
+func (w *memWatcher) Close() error {
+	w.fs.mu.Lock()
+	defer w.fs.mu.Unlock()
+	if i := slices.Index(w.fs.watchers, w); i >= 0 {
+		w.fs.watchers = slices.Delete(w.fs.watchers, i, i+1)
+		close(w.done)
+	}
+	return nil
+}
+
+type memFileInfo struct {
+	name string
+	size int64
+}
+
+func (fi memFileInfo) Name() string       { return fi.name }
+func (fi memFileInfo) Size() int64        { return fi.size }
+func (fi memFileInfo) Mode() fs.FileMode  { return 0600 }
+func (fi memFileInfo) ModTime() time.Time { return time.Time{} }
+func (fi memFileInfo) IsDir() bool        { return false }
+func (fi memFileInfo) Sys() any           { return nil }
@@ -0,0 +1,171 @@
+package agent
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"tls-agent/internal/notify"
+	"tls-agent/internal/tlsstore"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// memPair returns a MemFS holding the repository's test pair as
+// /certs/server.crt and /certs/server.key, and the pair loaded
+func memPair(t *testing.T) (*MemFS, *tls.Certificate) {
+	t.Helper()
+	fsys := NewMemFS()
+	for src, dst := range map[string]string{"../../certs/server.crt": "/certs/server.crt", "../../certs/server.key": "/certs/server.key"} {
+		data, err := os.ReadFile(src)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", src, err)
+		}
+		fsys.WriteFile(dst, data)
+	}
+	cert, err := LoadFS(fsys)("/certs/server.crt", "/certs/server.key")
+	if err != nil {
+		t.Fatalf("Failed to load certificates: %v", err)
+	}
+	return fsys, cert
+}
+
+// startMem starts an agent on fsys and waits until it watches paths. It
+// returns the agent and the reload notifications it sends.
+func startMem(t *testing.T, fsys *MemFS, cert *tls.Certificate, paths []string, opts ...Option) (*Agent, <-chan notify.Event) {
+	t.Helper()
+	events := make(chan notify.Event, 16)
+	opts = append([]Option{
+		WithFileSystem(fsys),
+		WithDebounce(0),
+		WithNotifier(notify.NotifierFunc(func(_ context.Context, e notify.Event) error {
+			events <- e
+			return nil
+		})),
+	}, opts...)
+	a := New(tlsstore.New(cert), opts...)
+	if err := a.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	t.Cleanup(func() { a.Stop(context.Background()) })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, path := range paths {
+		if err := fsys.WaitWatched(ctx, path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return a, events
+}
+
+// nextEvent returns the agent's next notification. The timeout only guards
+// against a hung test; MemFS itself needs no waits.
+func nextEvent(t *testing.T, events <-chan notify.Event) notify.Event {
+	t.Helper()
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for a reload")
+		return notify.Event{}
+	}
+}
+
+// TestMemFS tests the fake's files and inotify-like watch semantics
+func TestMemFS(t *testing.T) {
+	fsys := NewMemFS()
+	if _, err := fsys.ReadFile("/a"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected ErrNotExist reading a missing file, got %v", err)
+	}
+	fsys.WriteFile("/a", []byte("one"))
+	fsys.WriteFile("/b.tmp", []byte("three"))
+
+	w, err := fsys.NewWatcher()
+	if err != nil {
+		t.Fatalf("NewWatcher failed: %v", err)
+	}
+	defer w.Close()
+	if err := w.Add("/missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected watching a missing file to fail, got %v", err)
+	}
+	if err := w.Add("/a"); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	got := make(chan fsnotify.Event, 4)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case e := <-w.Events():
+				got <- e
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	fsys.WriteFile("/a", []byte("two"))
+	if e := <-got; e.Name != "/a" || e.Op != fsnotify.Write {
+		t.Errorf("Expected WRITE /a, got %v", e)
+	}
+	if err := fsys.Rename("/b.tmp", "/a"); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	if e := <-got; e.Name != "/a" || e.Op != fsnotify.Remove {
+		t.Errorf("Expected REMOVE /a after a rename over it, got %v", e)
+	}
+	if list := w.WatchList(); len(list) != 0 {
+		t.Errorf("Expected the replace to drop the watch, got %v", list)
+	}
+	if data, _ := fsys.ReadFile("/a"); string(data) != "three" {
+		t.Errorf("Expected the renamed contents, got %q", data)
+	}
+	if info, err := fsys.Stat("/a"); err != nil || info.Size() != 5 {
+		t.Errorf("Expected a 5 byte file, got %v, %v", info, err)
+	}
+
+	// Removing a watched file drops its watch
+	if err := w.Add("/a"); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if err := fsys.Remove("/a"); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if e := <-got; e.Name != "/a" || e.Op != fsnotify.Remove {
+		t.Errorf("Expected REMOVE /a, got %v", e)
+	}
+	if list := w.WatchList(); len(list) != 0 {
+		t.Errorf("Expected no watches, got %v", list)
+	}
+}
+
+// TestAgentMemFSWatcherError tests an injected watcher error reaching the
+// agent's last error
+func TestAgentMemFSWatcherError(t *testing.T) {
+	fsys, cert := memPair(t)
+	a, _ := startMem(t, fsys, cert, []string{"/certs/server.crt"}, WithPaths("/certs/server.crt", "/certs/server.key"))
+
+	// The loop has handled the first error once it receives the second
+	fsys.InjectError(errors.New("queue overflow"))
+	fsys.InjectError(errors.New("queue overflow again"))
+	if last := a.State().GetLastError(); last == nil || last.Source != SourceWatcher || !strings.HasPrefix(last.Message, "queue overflow") {
+		t.Errorf("Expected the injected watcher error, got %+v", last)
+	}
+}
+
+func mustRead(t *testing.T, fsys *MemFS, name string) []byte {
+	t.Helper()
+	data, err := fsys.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
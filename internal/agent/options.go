@@ -0,0 +1,160 @@
+package agent
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"tls-agent/internal/notify"
+	"tls-agent/internal/tlsstore"
+)
+
+// ErrAlreadyStarted is returned by Start on an agent that is running or
+// has been stopped
+var ErrAlreadyStarted = errors.New("agent: already started")
+
+// Option configures an Agent. New options can be added without changing
+// New's signature.
+type Option func(*Agent)
+
+// WithConfig replaces the whole configuration, for callers that build a
+// Config directly. Options after it override single fields.
+func WithConfig(cfg Config) Option {
+	return func(a *Agent) { a.cfg = cfg }
+}
+
+// WithPaths sets the watched certificate and key files
+func WithPaths(certFile, keyFile string) Option {
+	return func(a *Agent) { a.cfg.CertFile, a.cfg.KeyFile = certFile, keyFile }
+}
+
+// WithChainFile watches chainFile with the pair, for a source composing the
+// pair with it
+func WithChainFile(chainFile string) Option {
+	return func(a *Agent) { a.cfg.ChainFile = chainFile }
+}
+
+// WithDebounce sets the quiet period after the last file event before a
+// reload runs; zero reloads on every event
+func WithDebounce(d time.Duration) Option {
+	return func(a *Agent) { a.cfg.Debounce = d }
+}
+
+// WithLogger sends the agent's log lines to logger
+func WithLogger(logger *log.Logger) Option {
+	return func(a *Agent) { a.cfg.Logger = logger }
+}
+
+// WithClock drives debounce timers and validity checks from clock
+func WithClock(clock Clock) Option {
+	return func(a *Agent) { a.cfg.Clock = clock }
+}
+
+// WithFileSystem watches and loads the pair through fsys, e.g. a MemFS in
+// tests. A WithSource after it replaces the loading.
+func WithFileSystem(fsys FileSystem) Option {
+	return func(a *Agent) { a.cfg.FS, a.cfg.Load = fsys, LoadFS(fsys) }
+}
+
+// WithSource loads certificate pairs with load instead of tlsstore.Load,
+// e.g. to pull them from a remote source or to wrap loading with stapling
+func WithSource(load func(certFile, keyFile string) (*tls.Certificate, error)) Option {
+	return func(a *Agent) { a.cfg.Load = load }
+}
+
+// WithNotifier sends reload and policy events to n
+func WithNotifier(n notify.Notifier) Option {
+	return func(a *Agent) { a.cfg.Notifier = n }
+}
+
+// WithValidator rejects reloaded certificates for which validate fails
+func WithValidator(validate func(*tls.Certificate) error) Option {
+	return func(a *Agent) { a.cfg.Validate = validate }
+}
+
+// WithState records reloads in state instead of a new State, so it can be
+// shared with status reporting
+func WithState(state *State) Option {
+	return func(a *Agent) { a.state = state }
+}
+
+// Agent watches a certificate pair and keeps a store serving its current
+// version. Create one with New; the zero value is not usable.
+type Agent struct {
+	store tlsstore.CertificateProvider
+	state *State
+	cfg   Config
+
+	mu      sync.Mutex
+	started bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// New returns an agent updating store, configured by DefaultConfig and
+// then opts. It does not start watching until Start.
+func New(store tlsstore.CertificateProvider, opts ...Option) *Agent {
+	a := &Agent{store: store, cfg: DefaultConfig()}
+	for _, opt := range opts {
+		opt(a)
+	}
+	if a.state == nil {
+		a.state = NewState(store.Info().Cert)
+	}
+	return a
+}
+
+// State returns the reload state the agent records into
+func (a *Agent) State() *State {
+	return a.state
+}
+
+// Config returns the agent's configuration
+func (a *Agent) Config() Config {
+	return a.cfg
+}
+
+// Start begins watching in the background. An agent can be started once.
+func (a *Agent) Start() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.started {
+		return ErrAlreadyStarted
+	}
+	a.started = true
+	a.stop = make(chan struct{})
+	a.done = make(chan struct{})
+
+	go func() {
+		defer close(a.done)
+		run(a.store, a.state, a.stop, a.cfg)
+	}()
+	return nil
+}
+
+// Stop signals the agent to stop and waits until it has, or until ctx ends.
+// Stopping an agent that was never started does nothing.
+func (a *Agent) Stop(ctx context.Context) error {
+	a.mu.Lock()
+	if !a.started {
+		a.mu.Unlock()
+		return nil
+	}
+	select {
+	case <-a.stop:
+	default:
+		close(a.stop)
+	}
+	done := a.done
+	a.mu.Unlock()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
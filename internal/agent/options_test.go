@@ -0,0 +1,148 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tls-agent/internal/tlsstore"
+)
+
+// syncBuffer is a bytes.Buffer safe for the agent's goroutine to log into
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// TestNewOptions tests that options configure the agent and that Start and
+// Stop run and end the watch loop
+func TestNewOptions(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	for src, dst := range map[string]string{"../../certs/server.crt": certFile, "../../certs/server.key": keyFile} {
+		data, err := os.ReadFile(src)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", src, err)
+		}
+		if err := os.WriteFile(dst, data, 0600); err != nil {
+			t.Fatalf("Failed to write %s: %v", dst, err)
+		}
+	}
+	cert, err := tlsstore.Load(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Failed to load certificates: %v", err)
+	}
+
+	var loads atomic.Int32
+	var logs syncBuffer
+	store := tlsstore.New(cert)
+	a := New(store,
+		WithPaths(certFile, keyFile),
+		WithDebounce(10*time.Millisecond),
+		WithLogger(log.New(&logs, "", 0)),
+		WithSource(func(certFile, keyFile string) (*tls.Certificate, error) {
+			loads.Add(1)
+			return tlsstore.Load(certFile, keyFile)
+		}),
+	)
+	if cfg := a.Config(); cfg.CertFile != certFile || cfg.Debounce != 10*time.Millisecond || cfg.ExpiryWarning != DefaultConfig().ExpiryWarning {
+		t.Errorf("Options not applied over the defaults: %+v", cfg)
+	}
+	if a.State().Current != cert {
+		t.Error("Expected the state to start from the store's certificate")
+	}
+
+	if err := a.Stop(context.Background()); err != nil {
+		t.Errorf("Stop before Start returned %v", err)
+	}
+	if err := a.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if err := a.Start(); !errors.Is(err, ErrAlreadyStarted) {
+		t.Errorf("Second Start returned %v, want ErrAlreadyStarted", err)
+	}
+
+	// Give the watcher time to start, then change the certificate
+	time.Sleep(100 * time.Millisecond)
+	data, _ := os.ReadFile(certFile)
+	if err := os.WriteFile(certFile, data, 0600); err != nil {
+		t.Fatalf("Failed to modify certificate: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for len(a.State().History()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if history := a.State().History(); len(history) == 0 || history[0].Result != ResultSuccess {
+		t.Errorf("Expected a successful reload, got %+v", history)
+	}
+	if loads.Load() == 0 {
+		t.Error("Expected the configured source to load the certificate")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := a.Stop(ctx); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+	if err := a.Stop(ctx); err != nil {
+		t.Errorf("Second Stop returned %v", err)
+	}
+	if !strings.Contains(logs.String(), "Agent: watching "+certFile) {
+		t.Errorf("Expected the agent to log to the configured logger, got %q", logs.String())
+	}
+}
+
+// fakeProvider is a CertificateProvider that only records updates
+type fakeProvider struct {
+	current *tls.Certificate
+	updates int
+}
+
+func (f *fakeProvider) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return f.current, nil
+}
+func (f *fakeProvider) Update(cert *tls.Certificate) { f.current = cert; f.updates++ }
+func (f *fakeProvider) Info() tlsstore.Managed       { return tlsstore.Managed{Cert: f.current} }
+func (f *fakeProvider) Subscribe(func(tlsstore.Change)) func() {
+	return func() {}
+}
+
+// TestAgentProvider tests that the agent works against any provider
+func TestAgentProvider(t *testing.T) {
+	cert, err := tlsstore.Load("../../certs/server.crt", "../../certs/server.key")
+	if err != nil {
+		t.Fatalf("Failed to load certificates: %v", err)
+	}
+	provider := &fakeProvider{current: cert}
+	a := New(provider, WithPaths("../../certs/server.crt", "../../certs/server.key"))
+	if a.State().Current != cert {
+		t.Error("Expected the state to start from the provider's certificate")
+	}
+	if !reloadCert(provider, a.State(), a.Config(), TriggerManual) {
+		t.Fatal("Reload failed")
+	}
+	if provider.updates != 1 || provider.current == cert {
+		t.Errorf("Expected the reloaded certificate in the provider, got %d updates", provider.updates)
+	}
+}
@@ -0,0 +1,136 @@
+package agent
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Kinds of Record
+const (
+	// RecordStart opens a watcher session with its paths and debounce
+	RecordStart = "start"
+
+	// RecordEvent is a file event, with the file's size after it
+	RecordEvent = "event"
+
+	// RecordReload is a reload started, RecordQueued one queued behind a
+	// running reload
+	RecordReload = "reload"
+	RecordQueued = "queued"
+
+	// RecordResult is a reload's outcome
+	RecordResult = "result"
+)
+
+// Record is one line of a recording
+type Record struct {
+	Time time.Time `json:"time"`
+	Kind string    `json:"kind"`
+
+	// Paths and Debounce describe the session (RecordStart)
+	Paths    []string `json:"paths,omitempty"`
+	Debounce string   `json:"debounce,omitempty"`
+
+	// Path, Op and Size describe a file event. Size is -1 when the file
+	// was missing, as in the middle of an atomic replace.
+	Path string `json:"path,omitempty"`
+	Op   string `json:"op,omitempty"`
+	Size int64  `json:"size,omitempty"`
+
+	// Trigger, Result, Error and Fingerprint describe a reload
+	Trigger     string `json:"trigger,omitempty"`
+	Result      string `json:"result,omitempty"`
+	Error       string `json:"error,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+// Recorder writes the watch loop's file events and reload decisions as
+// JSON lines, for Replay to analyse offline. A nil *Recorder records
+// nothing. File contents are never recorded, only sizes.
+type Recorder struct {
+	mu    sync.Mutex
+	enc   *json.Encoder
+	close func() error
+}
+
+// NewRecorder records to w
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{enc: json.NewEncoder(w), close: func() error { return nil }}
+}
+
+// OpenRecorder appends a recording to path
+func OpenRecorder(path string) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	r := NewRecorder(f)
+	r.close = f.Close
+	return r, nil
+}
+
+// Close closes the recording file
+func (r *Recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.close()
+}
+
+func (r *Recorder) write(rec Record) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rec.Time = time.Now()
+	// A failing recording must not disturb the agent
+	_ = r.enc.Encode(rec)
+}
+
+// start records a watcher session
+func (r *Recorder) start(paths []string, debounce time.Duration) {
+	r.write(Record{Kind: RecordStart, Paths: paths, Debounce: debounce.String()})
+}
+
+// event records a file event and the file's size in fsys after it
+func (r *Recorder) event(e fsnotify.Event, fsys FileSystem) {
+	if r == nil {
+		return
+	}
+	size := int64(-1)
+	if info, err := fsys.Stat(e.Name); err == nil {
+		size = info.Size()
+	}
+	r.write(Record{Kind: RecordEvent, Path: e.Name, Op: e.Op.String(), Size: size})
+}
+
+// reload records a reload decision, RecordReload or RecordQueued
+func (r *Recorder) reload(kind, trigger string) {
+	r.write(Record{Kind: kind, Trigger: trigger})
+}
+
+// result records a reload's outcome
+func (r *Recorder) result(res reloadResult) {
+	if r == nil {
+		return
+	}
+	rec := Record{Kind: RecordResult, Trigger: res.trigger, Result: ResultSuccess}
+	switch {
+	case res.err != nil:
+		rec.Result, rec.Error = ResultFailed, res.err.Error()
+	case res.rejected != nil:
+		rec.Result, rec.Error = ResultRejected, res.rejected.Error()
+	}
+	if res.cert != nil {
+		rec.Fingerprint = Fingerprint(res.cert)
+	}
+	r.write(rec)
+}
@@ -0,0 +1,68 @@
+package agent
+
+import (
+	"crypto/tls"
+	"time"
+)
+
+// reloadResult is a certificate loaded and vetted for a reload
+type reloadResult struct {
+	trigger string
+	started time.Time
+
+	// cert is the loaded certificate, or err why it could not be loaded;
+	// rejected is why a loaded certificate failed validation
+	cert     *tls.Certificate
+	err      error
+	rejected error
+
+	// panicked is the value the load panicked with, if it did
+	panicked any
+}
+
+// reloader runs reloads off the watch loop, so a slow or stuck load does
+// not hold up file events, rollbacks or stopping. One load runs at a time;
+// triggers that arrive meanwhile coalesce into one more reload after it. It
+// is owned by the watch loop goroutine, which applies each result.
+type reloader struct {
+	cfg     Config
+	results chan reloadResult
+	running bool
+
+	// pending is the trigger of the reload queued behind the running one
+	pending string
+}
+
+func newReloader(cfg Config) *reloader {
+	// Buffered so a load finishing after the loop stopped does not block
+	return &reloader{cfg: cfg, results: make(chan reloadResult, 1)}
+}
+
+// Start loads in the background, or queues a reload if one is running
+func (r *reloader) Start(trigger string) {
+	if r.running {
+		if r.pending == "" {
+			r.cfg.Logger.Println("Agent: reload in progress, queuing another")
+		}
+		r.pending = trigger
+		r.cfg.Recorder.reload(RecordQueued, trigger)
+		return
+	}
+	r.running = true
+	r.cfg.Recorder.reload(RecordReload, trigger)
+	go func() { r.results <- loadCert(r.cfg, trigger) }()
+}
+
+// C delivers the result of the running load
+func (r *reloader) C() <-chan reloadResult {
+	return r.results
+}
+
+// Done marks the running load applied and starts the queued one, if any
+func (r *reloader) Done() {
+	r.running = false
+	if trigger := r.pending; trigger != "" {
+		r.pending = ""
+		r.Start(trigger)
+	}
+}
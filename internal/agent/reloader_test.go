@@ -0,0 +1,75 @@
+package agent
+
+import (
+	"crypto/tls"
+	"errors"
+	"testing"
+	"time"
+
+	"tls-agent/internal/tlsstore"
+)
+
+// TestAgentStuckLoad tests that a load that does not return leaves the
+// watch loop serving other requests, and that reloads requested meanwhile
+// coalesce into one after it
+func TestAgentStuckLoad(t *testing.T) {
+	cert, err := tlsstore.Load("../../certs/server.crt", "../../certs/server.key")
+	if err != nil {
+		t.Fatalf("Failed to load certificates: %v", err)
+	}
+
+	unblock := make(chan struct{})
+	loads := make(chan struct{}, 10)
+	reload := make(chan struct{})
+	rollback := make(chan chan error)
+	cfg := DefaultConfig()
+	cfg.CertFile = "../../certs/server.crt"
+	cfg.KeyFile = "../../certs/server.key"
+	cfg.Load = func(certFile, keyFile string) (*tls.Certificate, error) {
+		loads <- struct{}{}
+		<-unblock
+		return tlsstore.Load(certFile, keyFile)
+	}
+	cfg.Reload = reload
+	cfg.Rollback = rollback
+
+	store := tlsstore.New(cert)
+	state := NewState(cert)
+	agentStopChan := make(chan struct{})
+	agentDone := make(chan struct{})
+	go func() {
+		RunWithConfig(store, state, agentStopChan, cfg)
+		close(agentDone)
+	}()
+
+	reload <- struct{}{}
+	<-loads
+	reload <- struct{}{}
+	reload <- struct{}{}
+
+	// The loop still answers while the load is stuck
+	reply := make(chan error, 1)
+	select {
+	case rollback <- reply:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Watch loop stalled behind a stuck load")
+	}
+	if err := <-reply; !errors.Is(err, ErrNoPrevious) {
+		t.Fatalf("Expected ErrNoPrevious, got %v", err)
+	}
+
+	close(unblock)
+	deadline := time.Now().Add(2 * time.Second)
+	for len(state.History()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(agentStopChan)
+	<-agentDone
+
+	if n := len(loads); n != 1 {
+		t.Errorf("Expected the queued reloads to coalesce into one more load, got %d", n)
+	}
+	if history := state.History(); len(history) != 2 || history[0].Result != ResultSuccess || history[0].Trigger != TriggerManual {
+		t.Errorf("Expected two successful manual reloads, got %+v", history)
+	}
+}
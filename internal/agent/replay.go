@@ -0,0 +1,235 @@
+package agent
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// ReplayOptions adjusts how a recording is replayed
+type ReplayOptions struct {
+	// Debounce, if positive, replaces the recorded quiet period, to see
+	// how another setting would have handled the same events
+	Debounce time.Duration
+
+	// NoDebounce replays with debouncing disabled
+	NoDebounce bool
+}
+
+// ReplaySummary counts what a replay saw and decided
+type ReplaySummary struct {
+	Sessions int
+	Events   int
+
+	// Recorded and Replayed count file change reloads started by the agent
+	// and by the replay
+	Recorded int
+	Replayed int
+
+	// Empty counts events after which the file was empty, the usual sign
+	// of a reader racing a partial write
+	Empty int
+}
+
+// Replay feeds a recording's file events back through the watch loop's
+// change detection and debouncing on a simulated clock, writing a timeline
+// of the recorded and replayed decisions to out. Loads are not repeated,
+// since the files have moved on; recorded results are shown as they were,
+// and a replayed reload is taken to finish at once.
+func Replay(in io.Reader, out io.Writer, opts ReplayOptions) (ReplaySummary, error) {
+	var summary ReplaySummary
+	clock := &replayClock{}
+	var debounce *debouncer
+
+	// fire starts the reloads whose quiet period ended by until
+	fire := func(until time.Time) {
+		for debounce != nil {
+			at, ok := clock.advance(until)
+			if !ok {
+				return
+			}
+			select {
+			case <-debounce.C():
+				debounce.Done()
+				summary.Replayed++
+				fmt.Fprintf(out, "%s  replayed  reload  %s\n", stamp(at), TriggerFileChange)
+			default:
+			}
+		}
+	}
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return summary, fmt.Errorf("agent: replay line %d: %w", line, err)
+		}
+		fire(rec.Time)
+		clock.set(rec.Time)
+
+		switch rec.Kind {
+		case RecordStart:
+			// A new session means the loop restarted and lost what it had pending
+			summary.Sessions++
+			d, _ := time.ParseDuration(rec.Debounce)
+			switch {
+			case opts.NoDebounce:
+				d = 0
+			case opts.Debounce > 0:
+				d = opts.Debounce
+			}
+			debounce = newDebouncer(clock, d)
+			fmt.Fprintf(out, "%s  recorded  start   watching %s, debounce %s\n", stamp(rec.Time), strings.Join(rec.Paths, " and "), d)
+
+		case RecordEvent:
+			summary.Events++
+			op := parseOp(rec.Op)
+			changed := fileChanged(op, func() bool { return rec.Size >= 0 })
+			note := "ignored"
+			if changed {
+				note = "change"
+			}
+			switch {
+			case rec.Size < 0:
+				note += ", file missing"
+			case rec.Size == 0:
+				summary.Empty++
+				note += ", file empty (partial write?)"
+			default:
+				note += fmt.Sprintf(", %d bytes", rec.Size)
+			}
+			fmt.Fprintf(out, "%s  recorded  event   %s %s: %s\n", stamp(rec.Time), rec.Op, rec.Path, note)
+			if changed && debounce != nil && debounce.Trigger() {
+				summary.Replayed++
+				fmt.Fprintf(out, "%s  replayed  reload  %s\n", stamp(rec.Time), TriggerFileChange)
+			}
+
+		case RecordReload, RecordQueued:
+			if rec.Kind == RecordReload && rec.Trigger == TriggerFileChange {
+				summary.Recorded++
+			}
+			fmt.Fprintf(out, "%s  recorded  %-6s  %s\n", stamp(rec.Time), rec.Kind, rec.Trigger)
+
+		case RecordResult:
+			detail := rec.Result
+			if rec.Fingerprint != "" {
+				detail += " " + rec.Fingerprint[:min(12, len(rec.Fingerprint))]
+			}
+			if rec.Error != "" {
+				detail += ": " + rec.Error
+			}
+			fmt.Fprintf(out, "%s  recorded  result  %s %s\n", stamp(rec.Time), rec.Trigger, detail)
+
+		default:
+			return summary, fmt.Errorf("agent: replay line %d: unknown record kind %q", line, rec.Kind)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return summary, fmt.Errorf("agent: replay: %w", err)
+	}
+	// Reloads still pending when the recording ends would have run
+	fire(time.Unix(1<<62, 0))
+
+	fmt.Fprintf(out, "%d events in %d sessions: the agent started %d file change reloads, the replay %d",
+		summary.Events, summary.Sessions, summary.Recorded, summary.Replayed)
+	if summary.Empty > 0 {
+		fmt.Fprintf(out, "; %d events saw an empty file", summary.Empty)
+	}
+	fmt.Fprintln(out)
+	return summary, nil
+}
+
+func stamp(t time.Time) string {
+	return t.Format("2006-01-02T15:04:05.000Z07:00")
+}
+
+// parseOp parses fsnotify.Op.String output such as "WRITE|CHMOD"
+func parseOp(s string) fsnotify.Op {
+	var op fsnotify.Op
+	for name := range strings.SplitSeq(s, "|") {
+		switch name {
+		case "CREATE":
+			op |= fsnotify.Create
+		case "WRITE":
+			op |= fsnotify.Write
+		case "REMOVE":
+			op |= fsnotify.Remove
+		case "RENAME":
+			op |= fsnotify.Rename
+		case "CHMOD":
+			op |= fsnotify.Chmod
+		}
+	}
+	return op
+}
+
+// replayClock is a Clock moved by Replay to each record's time. Its timers
+// fire only through advance, one at a time, so every fire is seen in order.
+type replayClock struct {
+	now    time.Time
+	timers []*replayTimer
+}
+
+type replayTimer struct {
+	clock    *replayClock
+	c        chan time.Time
+	deadline time.Time
+	active   bool
+}
+
+func (c *replayClock) Now() time.Time { return c.now }
+
+func (c *replayClock) NewTimer(d time.Duration) Timer {
+	t := &replayTimer{clock: c, c: make(chan time.Time, 1), deadline: c.now.Add(d), active: true}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// set moves the clock to t without firing timers; time never goes back
+func (c *replayClock) set(t time.Time) {
+	if t.After(c.now) {
+		c.now = t
+	}
+}
+
+// advance fires the earliest active timer due by until, moving the clock
+// to its deadline, and reports when it fired
+func (c *replayClock) advance(until time.Time) (time.Time, bool) {
+	var next *replayTimer
+	for _, t := range c.timers {
+		if t.active && !t.deadline.After(until) && (next == nil || t.deadline.Before(next.deadline)) {
+			next = t
+		}
+	}
+	if next == nil {
+		return time.Time{}, false
+	}
+	next.active = false
+	c.set(next.deadline)
+	next.c <- next.deadline
+	return next.deadline, true
+}
+
+func (t *replayTimer) C() <-chan time.Time { return t.c }
+
+func (t *replayTimer) Stop() bool {
+	wasActive := t.active
+	t.active = false
+	return wasActive
+}
+
+func (t *replayTimer) Reset(d time.Duration) bool {
+	wasActive := t.active
+	t.active = true
+	t.deadline = t.clock.now.Add(d)
+	return wasActive
+}
@@ -0,0 +1,113 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"tls-agent/internal/tlsstore"
+)
+
+// recording is a double write of the certificate, the second after a
+// truncating partial write, followed by an atomic replace of the key
+const recording = `{"time":"2026-01-01T00:00:00Z","kind":"start","paths":["tls.crt","tls.key"],"debounce":"2s"}
+{"time":"2026-01-01T00:00:10Z","kind":"event","path":"tls.crt","op":"WRITE","size":1200}
+{"time":"2026-01-01T00:00:10.5Z","kind":"event","path":"tls.crt","op":"WRITE"}
+{"time":"2026-01-01T00:00:11Z","kind":"event","path":"tls.crt","op":"WRITE","size":1200}
+{"time":"2026-01-01T00:00:11Z","kind":"event","path":"tls.crt","op":"CHMOD","size":1200}
+{"time":"2026-01-01T00:00:13Z","kind":"reload","trigger":"file_change"}
+{"time":"2026-01-01T00:00:13.1Z","kind":"result","trigger":"file_change","result":"success","fingerprint":"0123456789abcdef"}
+{"time":"2026-01-01T00:01:00Z","kind":"event","path":"tls.key","op":"RENAME","size":-1}
+{"time":"2026-01-01T00:01:00.2Z","kind":"event","path":"tls.key","op":"CREATE","size":240}
+`
+
+// TestReplay tests that a replay coalesces events as the agent did, flags
+// partial writes, and replays another debounce setting
+func TestReplay(t *testing.T) {
+	var out strings.Builder
+	summary, err := Replay(strings.NewReader(recording), &out, ReplayOptions{})
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if summary.Events != 6 || summary.Recorded != 1 || summary.Replayed != 2 || summary.Empty != 1 {
+		t.Fatalf("Unexpected summary %+v:\n%s", summary, out.String())
+	}
+	for _, want := range []string{
+		"2026-01-01T00:00:13.000Z  replayed  reload  file_change",
+		"file empty (partial write?)",
+		"CHMOD tls.crt: ignored",
+		"RENAME tls.key: ignored, file missing",
+		"2026-01-01T00:01:02.200Z  replayed  reload  file_change",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in the replay:\n%s", want, out.String())
+		}
+	}
+
+	summary, err = Replay(strings.NewReader(recording), &out, ReplayOptions{NoDebounce: true})
+	if err != nil || summary.Replayed != 4 {
+		t.Errorf("Expected every change to reload without debouncing, got %d (%v)", summary.Replayed, err)
+	}
+	if _, err := Replay(strings.NewReader(`{"kind":"bogus"}`), &out, ReplayOptions{}); err == nil {
+		t.Error("Expected an unknown record kind to fail the replay")
+	}
+}
+
+// TestAgentRecorder tests that a recording of the running agent replays to
+// the same reloads
+func TestAgentRecorder(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	for src, dst := range map[string]string{"../../certs/server.crt": certFile, "../../certs/server.key": keyFile} {
+		data, err := os.ReadFile(src)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", src, err)
+		}
+		if err := os.WriteFile(dst, data, 0600); err != nil {
+			t.Fatalf("Failed to write %s: %v", dst, err)
+		}
+	}
+	cert, err := tlsstore.Load(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Failed to load certificates: %v", err)
+	}
+
+	var recorded syncBuffer
+	cfg := DefaultConfig()
+	cfg.CertFile, cfg.KeyFile = certFile, keyFile
+	cfg.Debounce = 50 * time.Millisecond
+	cfg.Recorder = NewRecorder(&recorded)
+
+	state := NewState(cert)
+	agentStopChan := make(chan struct{})
+	agentDone := make(chan struct{})
+	go func() {
+		RunWithConfig(tlsstore.New(cert), state, agentStopChan, cfg)
+		close(agentDone)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	data, _ := os.ReadFile(certFile)
+	for range 3 {
+		if err := os.WriteFile(certFile, data, 0600); err != nil {
+			t.Fatalf("Failed to rewrite certificate: %v", err)
+		}
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(recorded.String(), `"kind":"result"`) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(agentStopChan)
+	<-agentDone
+
+	var out strings.Builder
+	summary, err := Replay(strings.NewReader(recorded.String()), &out, ReplayOptions{})
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if summary.Sessions != 1 || summary.Events == 0 || summary.Recorded != 1 || summary.Replayed != summary.Recorded {
+		t.Errorf("Expected the replay to match the agent, got %+v:\n%s", summary, out.String())
+	}
+}
@@ -0,0 +1,117 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"tls-agent/internal/tlsstore"
+)
+
+// RollbackRequest asks the agent to serve a version retained by its store
+// again. The result is sent on Reply, which must be buffered.
+type RollbackRequest struct {
+	Version uint64
+	Reply   chan RollbackResult
+}
+
+// RollbackResult is the outcome of a RollbackRequest: the version stored by
+// the rollback, or the error
+type RollbackResult struct {
+	Version tlsstore.VersionInfo
+	Err     error
+}
+
+// RequestRollback sends a rollback to version on requests and waits for the
+// agent's result, giving up when ctx ends
+func RequestRollback(ctx context.Context, requests chan<- RollbackRequest, version uint64) (tlsstore.VersionInfo, error) {
+	reply := make(chan RollbackResult, 1)
+	select {
+	case requests <- RollbackRequest{Version: version, Reply: reply}:
+	case <-ctx.Done():
+		return tlsstore.VersionInfo{}, ctx.Err()
+	}
+	select {
+	case res := <-reply:
+		return res.Version, res.Err
+	case <-ctx.Done():
+		return tlsstore.VersionInfo{}, ctx.Err()
+	}
+}
+
+// versionJSON is a retained version as served by VersionsHandler
+type versionJSON struct {
+	Version     uint64    `json:"version"`
+	Current     bool      `json:"current"`
+	Fingerprint string    `json:"fingerprint"`
+	Subject     string    `json:"subject,omitempty"`
+	NotAfter    time.Time `json:"not_after,omitzero"`
+	Source      string    `json:"source,omitempty"`
+	Stored      time.Time `json:"stored"`
+	RollbackOf  uint64    `json:"rollback_of,omitempty"`
+}
+
+func toVersionJSON(v tlsstore.VersionInfo) versionJSON {
+	out := versionJSON{
+		Version:     v.Version,
+		Current:     v.Current,
+		Fingerprint: Fingerprint(v.Cert),
+		Source:      v.Source,
+		Stored:      v.Stored,
+		RollbackOf:  v.RollbackOf,
+	}
+	if v.Leaf != nil {
+		out.Subject = v.Leaf.Subject.String()
+		out.NotAfter = v.Leaf.NotAfter
+	}
+	return out
+}
+
+// VersionsHandler serves the versions retained by store for the admin API:
+//
+//	GET  /versions                       retained versions, oldest first
+//	POST /versions/{version}/rollback    serve a retained version again
+//
+// rollback performs the rollback, normally through RequestRollback so the
+// agent's state follows it.
+func VersionsHandler(store tlsstore.Versioned, rollback func(ctx context.Context, version uint64) (tlsstore.VersionInfo, error)) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /versions", func(w http.ResponseWriter, r *http.Request) {
+		versions := store.Versions()
+		out := make([]versionJSON, len(versions))
+		for i, v := range versions {
+			out[i] = toVersionJSON(v)
+		}
+		writeJSON(w, struct {
+			Versions []versionJSON `json:"versions"`
+		}{out})
+	})
+	mux.HandleFunc("POST /versions/{version}/rollback", func(w http.ResponseWriter, r *http.Request) {
+		version, err := strconv.ParseUint(r.PathValue("version"), 10, 64)
+		if err != nil || version == 0 {
+			http.Error(w, "version must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		info, err := rollback(r.Context(), version)
+		if errors.Is(err, tlsstore.ErrUnknownVersion) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, struct {
+			Current versionJSON `json:"current"`
+		}{toVersionJSON(info)})
+	})
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,96 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tls-agent/internal/tlsstore"
+)
+
+// TestVersionsHandler tests listing versions and rolling back to one through
+// a running agent
+func TestVersionsHandler(t *testing.T) {
+	cert, err := tlsstore.Load("../../certs/server.crt", "../../certs/server.key")
+	if err != nil {
+		t.Fatalf("Failed to load certificates: %v", err)
+	}
+
+	reload := make(chan struct{})
+	rollback := make(chan RollbackRequest)
+	store := tlsstore.New(cert)
+	a := New(store, WithPaths("../../certs/server.crt", "../../certs/server.key"))
+	a.cfg.Reload = reload
+	a.cfg.RollbackVersion = rollback
+	if err := a.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer a.Stop(context.Background())
+
+	for i := 1; i <= 2; i++ {
+		reload <- struct{}{}
+		deadline := time.Now().Add(2 * time.Second)
+		for len(a.State().History()) < i && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	srv := httptest.NewServer(VersionsHandler(store, func(ctx context.Context, version uint64) (tlsstore.VersionInfo, error) {
+		return RequestRollback(ctx, rollback, version)
+	}))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/versions")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	var list struct {
+		Versions []versionJSON `json:"versions"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&list)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("Invalid response: %v", err)
+	}
+	if len(list.Versions) != 3 || list.Versions[0].Version != 1 || !list.Versions[2].Current || list.Versions[0].Fingerprint != Fingerprint(cert) {
+		t.Fatalf("Unexpected versions %+v", list.Versions)
+	}
+
+	for path, want := range map[string]int{
+		"/versions/1/rollback":   http.StatusOK,
+		"/versions/99/rollback":  http.StatusNotFound,
+		"/versions/one/rollback": http.StatusBadRequest,
+	} {
+		resp, err := http.Post(srv.URL+path, "", nil)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("POST %s: status %d, want %d", path, resp.StatusCode, want)
+		}
+	}
+
+	if served, _ := store.GetCertificate(nil); served != cert {
+		t.Error("Expected version 1's certificate to be served")
+	}
+	if a.State().Current != cert {
+		t.Error("Expected the agent's state to follow the rollback")
+	}
+	if history := a.State().History(); history[0].Trigger != TriggerRollback {
+		t.Errorf("Expected a rollback event first, got %+v", history)
+	}
+}
+
+// TestRollbackToVersionNotVersioned tests that providers without versions
+// are refused
+func TestRollbackToVersionNotVersioned(t *testing.T) {
+	provider := &fakeProvider{}
+	if _, err := rollbackToVersion(provider, NewState(nil), DefaultConfig(), 1); !errors.Is(err, ErrNotVersioned) {
+		t.Errorf("Expected ErrNotVersioned, got %v", err)
+	}
+}
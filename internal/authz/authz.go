@@ -0,0 +1,171 @@
+package authz
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"tls-agent/internal/metrics"
+	"tls-agent/internal/requestid"
+)
+
+var denied = metrics.NewCounterVec("tls_agent_authz_denied_total",
+	"Requests rejected by client identity authorization", "route")
+
+// ErrUnauthorized is returned when a client identity matches no allow pattern
+var ErrUnauthorized = errors.New("client identity not authorized")
+
+// Rule allows the listed identities on every route under PathPrefix. An empty
+// PathPrefix applies to the whole listener.
+//
+// Allow patterns are matched against the certificate's SANs with path.Match
+// semantics, prefixed by type: "dns:*.internal.example.com",
+// "uri:spiffe://prod.example.com/ns/payments/*", or "email:ops@example.com".
+// A pattern without a prefix matches any SAN type.
+type Rule struct {
+	PathPrefix string
+	Allow      []string
+}
+
+// Decision describes a denied request for the audit log
+type Decision struct {
+	Route      string
+	Path       string
+	RemoteAddr string
+	Identities []string
+	Reason     string
+
+	// RequestID identifies the request when request IDs are assigned
+	RequestID string
+}
+
+// Authorizer matches client certificate SANs against per-route allow rules
+type Authorizer struct {
+	rules []Rule
+
+	// Audit receives every denial; defaults to a log line
+	Audit func(Decision)
+}
+
+// New creates an authorizer. The most specific (longest) matching prefix wins.
+func New(rules []Rule) *Authorizer {
+	sorted := append([]Rule(nil), rules...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return len(sorted[i].PathPrefix) > len(sorted[j].PathPrefix)
+	})
+	return &Authorizer{rules: sorted}
+}
+
+// Identities returns the SANs of cert in the typed form used by allow patterns
+func Identities(cert *x509.Certificate) []string {
+	var ids []string
+	for _, name := range cert.DNSNames {
+		ids = append(ids, "dns:"+name)
+	}
+	for _, u := range cert.URIs {
+		ids = append(ids, "uri:"+u.String())
+	}
+	for _, email := range cert.EmailAddresses {
+		ids = append(ids, "email:"+email)
+	}
+	return ids
+}
+
+// rule returns the rule governing requestPath, or nil if none applies
+func (a *Authorizer) rule(requestPath string) *Rule {
+	for i := range a.rules {
+		if strings.HasPrefix(requestPath, a.rules[i].PathPrefix) {
+			return &a.rules[i]
+		}
+	}
+	return nil
+}
+
+// Authorize checks cert against the rule governing requestPath. Paths no
+// rule covers are allowed.
+func (a *Authorizer) Authorize(requestPath string, cert *x509.Certificate) error {
+	rule := a.rule(requestPath)
+	if rule == nil {
+		return nil
+	}
+	if cert == nil {
+		return fmt.Errorf("%w: no client certificate", ErrUnauthorized)
+	}
+
+	if Allowed(rule.Allow, cert) {
+		return nil
+	}
+	return fmt.Errorf("%w: %v", ErrUnauthorized, Identities(cert))
+}
+
+// Allowed reports whether one of cert's identities matches an allow pattern
+func Allowed(patterns []string, cert *x509.Certificate) bool {
+	ids := Identities(cert)
+	for _, pattern := range patterns {
+		for _, id := range ids {
+			if matches(pattern, id) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matches(pattern, id string) bool {
+	typed := strings.HasPrefix(pattern, "dns:") ||
+		strings.HasPrefix(pattern, "uri:") ||
+		strings.HasPrefix(pattern, "email:")
+	if !typed {
+		_, id, _ = strings.Cut(id, ":")
+	}
+	ok, err := path.Match(pattern, id)
+	return err == nil && ok
+}
+
+// Middleware rejects requests whose verified client identity is not allowed
+// with 403 Forbidden and records an audit entry
+func (a *Authorizer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var cert *x509.Certificate
+		if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+			cert = r.TLS.PeerCertificates[0]
+		}
+
+		if err := a.Authorize(r.URL.Path, cert); err != nil {
+			route := a.rule(r.URL.Path).PathPrefix
+			denied.With(route).Inc()
+
+			decision := Decision{
+				Route:      route,
+				Path:       r.URL.Path,
+				RemoteAddr: r.RemoteAddr,
+				Reason:     err.Error(),
+			}
+			if info, ok := requestid.FromContext(r.Context()); ok {
+				decision.RequestID = info.RequestID
+			}
+			if cert != nil {
+				decision.Identities = Identities(cert)
+			}
+			a.audit(decision)
+
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *Authorizer) audit(d Decision) {
+	if a.Audit != nil {
+		a.Audit(d)
+		return
+	}
+	log.Printf("AUDIT: authz denied route=%q path=%q remote=%s identities=%v reason=%q request_id=%q",
+		d.Route, d.Path, d.RemoteAddr, d.Identities, d.Reason, d.RequestID)
+}
@@ -0,0 +1,98 @@
+package authz
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// testCert returns a certificate carrying the given SANs
+func testCert(dns []string, uris ...string) *x509.Certificate {
+	cert := &x509.Certificate{DNSNames: dns}
+	for _, u := range uris {
+		parsed, _ := url.Parse(u)
+		cert.URIs = append(cert.URIs, parsed)
+	}
+	return cert
+}
+
+// TestAuthorize tests pattern matching and route selection
+func TestAuthorize(t *testing.T) {
+	a := New([]Rule{
+		{PathPrefix: "/", Allow: []string{"dns:*.example.com"}},
+		{PathPrefix: "/admin/", Allow: []string{"uri:spiffe://prod.example.com/ns/ops/*"}},
+		{PathPrefix: "/reports/", Allow: []string{"spiffe://prod.example.com/ns/*/reporter"}},
+	})
+
+	web := testCert([]string{"web.example.com"})
+	ops := testCert(nil, "spiffe://prod.example.com/ns/ops/deployer")
+	reporter := testCert(nil, "spiffe://prod.example.com/ns/billing/reporter")
+
+	tests := []struct {
+		path    string
+		cert    *x509.Certificate
+		allowed bool
+	}{
+		{"/", web, true},
+		{"/", ops, false},
+		{"/admin/users", ops, true},
+		{"/admin/users", web, false},
+		{"/reports/daily", reporter, true},
+		{"/reports/daily", ops, false},
+		{"/", nil, false},
+	}
+	for _, tt := range tests {
+		err := a.Authorize(tt.path, tt.cert)
+		if tt.allowed && err != nil {
+			t.Errorf("Authorize(%s) rejected: %v", tt.path, err)
+		}
+		if !tt.allowed && !errors.Is(err, ErrUnauthorized) {
+			t.Errorf("Authorize(%s) should be unauthorized, got %v", tt.path, err)
+		}
+	}
+
+	// Routes without a rule are open
+	if err := New([]Rule{{PathPrefix: "/admin/"}}).Authorize("/public", nil); err != nil {
+		t.Errorf("Uncovered route should be allowed: %v", err)
+	}
+}
+
+// TestMiddleware tests the 403 response and audit entry
+func TestMiddleware(t *testing.T) {
+	var audited []Decision
+	a := New([]Rule{{PathPrefix: "/admin/", Allow: []string{"dns:admin.example.com"}}})
+	a.Audit = func(d Decision) { audited = append(audited, d) }
+
+	handler := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	request := func(cert *x509.Certificate) int {
+		req := httptest.NewRequest(http.MethodGet, "/admin/keys", nil)
+		req.TLS = &tls.ConnectionState{}
+		if cert != nil {
+			req.TLS.PeerCertificates = []*x509.Certificate{cert}
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := request(testCert([]string{"admin.example.com"})); code != http.StatusOK {
+		t.Errorf("Expected 200 for allowed identity, got %d", code)
+	}
+	if code := request(testCert([]string{"web.example.com"})); code != http.StatusForbidden {
+		t.Errorf("Expected 403 for disallowed identity, got %d", code)
+	}
+
+	if len(audited) != 1 {
+		t.Fatalf("Expected one audit entry, got %d", len(audited))
+	}
+	if audited[0].Route != "/admin/" || len(audited[0].Identities) != 1 || audited[0].Identities[0] != "dns:web.example.com" {
+		t.Errorf("Unexpected audit entry: %+v", audited[0])
+	}
+}
@@ -0,0 +1,243 @@
+// Package backup keeps timestamped copies of certificate files before the
+// agent overwrites them, so a bad renewal or deployment can be undone.
+//
+// Each backup is a directory Dir/<name>/<id> holding copies of the files and
+// a manifest of their original paths and permissions. IDs are UTC
+// timestamps, so they sort oldest first.
+package backup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"tls-agent/internal/tlsstore"
+)
+
+// idFormat formats backup IDs; it sorts lexically in time order
+const idFormat = "20060102T150405.000000000Z"
+
+const manifestFile = "manifest.json"
+
+// ErrNotFound is returned when a backup does not exist
+var ErrNotFound = errors.New("backup: not found")
+
+// unsafeName matches characters not allowed in backup directory names
+var unsafeName = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// Store keeps backups under Dir with a retention policy
+type Store struct {
+	Dir string
+
+	// Keep is how many backups to keep per name; zero keeps all
+	Keep int
+
+	// MaxAge removes older backups; zero keeps them regardless of age
+	MaxAge time.Duration
+
+	now func() time.Time
+}
+
+// Snapshot describes one backup
+type Snapshot struct {
+	ID    string    `json:"id"`
+	Time  time.Time `json:"time"`
+	Files []File    `json:"files"`
+}
+
+// File is one backed up file
+type File struct {
+	Path string      `json:"path"`
+	Mode fs.FileMode `json:"mode"`
+
+	// stored is the copy's name inside the backup directory
+	Stored string `json:"stored"`
+}
+
+// Backup copies the existing files among paths into a new backup called
+// name, then applies the retention policy. It reports false when none of
+// the files exist yet.
+func (s *Store) Backup(name string, paths ...string) (Snapshot, bool, error) {
+	now := time.Now
+	if s.now != nil {
+		now = s.now
+	}
+	snap := Snapshot{Time: now().UTC()}
+	snap.ID = snap.Time.Format(idFormat)
+	dir := filepath.Join(s.Dir, dirName(name), snap.ID)
+
+	for i, path := range paths {
+		data, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return Snapshot{}, false, fmt.Errorf("backup: %w", err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return Snapshot{}, false, fmt.Errorf("backup: %w", err)
+		}
+		if len(snap.Files) == 0 {
+			if err := os.MkdirAll(dir, 0700); err != nil {
+				return Snapshot{}, false, fmt.Errorf("backup: %w", err)
+			}
+		}
+
+		// Copies are private whatever the original mode, since most hold keys
+		f := File{Path: path, Mode: info.Mode().Perm(), Stored: strconv.Itoa(i) + "-" + filepath.Base(path)}
+		if err := tlsstore.WriteKeyFile(filepath.Join(dir, f.Stored), data); err != nil {
+			return Snapshot{}, false, fmt.Errorf("backup: %w", err)
+		}
+		snap.Files = append(snap.Files, f)
+	}
+	if len(snap.Files) == 0 {
+		return Snapshot{}, false, nil
+	}
+
+	manifest, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return Snapshot{}, false, err
+	}
+	if err := tlsstore.WriteKeyFile(filepath.Join(dir, manifestFile), manifest); err != nil {
+		return Snapshot{}, false, fmt.Errorf("backup: %w", err)
+	}
+
+	if err := s.prune(name, snap.Time); err != nil {
+		log.Printf("Backup: retention for %s failed: %v", name, err)
+	}
+	return snap, true, nil
+}
+
+// List returns the backups called name, newest first
+func (s *Store) List(name string) ([]Snapshot, error) {
+	entries, err := os.ReadDir(filepath.Join(s.Dir, dirName(name)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("backup: %w", err)
+	}
+
+	var snaps []Snapshot
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		snap, err := s.read(name, e.Name())
+		if err != nil {
+			log.Printf("Backup: skipping %s/%s: %v", name, e.Name(), err)
+			continue
+		}
+		snaps = append(snaps, snap)
+	}
+	slices.Reverse(snaps)
+	return snaps, nil
+}
+
+// Names returns the names that have backups
+func (s *Store) Names() ([]string, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("backup: %w", err)
+	}
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
+
+// Restore writes the files of backup id back to their original paths. The
+// current files are backed up first, so a restore can itself be undone.
+func (s *Store) Restore(name, id string) (Snapshot, error) {
+	snap, err := s.read(name, id)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	dir := filepath.Join(s.Dir, dirName(name), id)
+
+	// Read everything before the new backup, whose retention may remove id
+	contents := make([][]byte, len(snap.Files))
+	for i, f := range snap.Files {
+		if contents[i], err = os.ReadFile(filepath.Join(dir, f.Stored)); err != nil {
+			return Snapshot{}, fmt.Errorf("backup: %w", err)
+		}
+	}
+	paths := make([]string, len(snap.Files))
+	for i, f := range snap.Files {
+		paths[i] = f.Path
+	}
+	if _, _, err := s.Backup(name, paths...); err != nil {
+		return Snapshot{}, err
+	}
+
+	for i, f := range snap.Files {
+		if err := tlsstore.WriteFile(f.Path, contents[i], f.Mode); err != nil {
+			return Snapshot{}, fmt.Errorf("backup: restore %s: %w", f.Path, err)
+		}
+	}
+	log.Printf("Backup: restored %s from %s", name, id)
+	return snap, nil
+}
+
+// read loads the manifest of one backup
+func (s *Store) read(name, id string) (Snapshot, error) {
+	if _, err := time.Parse(idFormat, id); err != nil {
+		return Snapshot{}, fmt.Errorf("%w: %s/%s", ErrNotFound, name, id)
+	}
+	data, err := os.ReadFile(filepath.Join(s.Dir, dirName(name), id, manifestFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return Snapshot{}, fmt.Errorf("%w: %s/%s", ErrNotFound, name, id)
+	}
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("backup: %w", err)
+	}
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return Snapshot{}, fmt.Errorf("backup: manifest %s/%s: %w", name, id, err)
+	}
+	return snap, nil
+}
+
+// prune removes backups beyond Keep and older than MaxAge. The newest
+// backup is always kept.
+func (s *Store) prune(name string, now time.Time) error {
+	snaps, err := s.List(name)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for i, snap := range snaps {
+		if i == 0 {
+			continue
+		}
+		tooMany := s.Keep > 0 && i >= s.Keep
+		tooOld := s.MaxAge > 0 && now.Sub(snap.Time) > s.MaxAge
+		if tooMany || tooOld {
+			errs = append(errs, os.RemoveAll(filepath.Join(s.Dir, dirName(name), snap.ID)))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// dirName maps a backup name to a safe directory name
+func dirName(name string) string {
+	if name == "" || name == "." || name == ".." {
+		return "_"
+	}
+	return unsafeName.ReplaceAllString(name, "_")
+}
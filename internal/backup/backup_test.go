@@ -0,0 +1,190 @@
+package backup
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// testStore returns a store whose clock advances a second per backup
+func testStore(t *testing.T, keep int, maxAge time.Duration) *Store {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	return &Store{
+		Dir:    t.TempDir(),
+		Keep:   keep,
+		MaxAge: maxAge,
+		now: func() time.Time {
+			now = now.Add(time.Second)
+			return now
+		},
+	}
+}
+
+func writeFile(t *testing.T, path, content string, mode os.FileMode) {
+	if err := os.WriteFile(path, []byte(content), mode); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
+
+// TestBackupRestore tests that a backup restores contents and modes
+func TestBackupRestore(t *testing.T) {
+	s := testStore(t, 0, 0)
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeFile(t, certPath, "cert v1", 0644)
+	writeFile(t, keyPath, "key v1", 0600)
+
+	snap, ok, err := s.Backup("web", certPath, keyPath, filepath.Join(dir, "missing.pem"))
+	if err != nil || !ok {
+		t.Fatalf("Failed to back up: %v", err)
+	}
+	if len(snap.Files) != 2 {
+		t.Errorf("Expected missing files to be skipped, got %+v", snap.Files)
+	}
+
+	writeFile(t, certPath, "cert v2", 0644)
+	os.Remove(keyPath)
+	if _, err := s.Restore("web", snap.ID); err != nil {
+		t.Fatalf("Failed to restore: %v", err)
+	}
+	for path, want := range map[string]string{certPath: "cert v1", keyPath: "key v1"} {
+		if got, _ := os.ReadFile(path); string(got) != want {
+			t.Errorf("Expected %s to contain %q, got %q", path, want, got)
+		}
+	}
+	if runtime.GOOS != "windows" {
+		if info, _ := os.Stat(keyPath); info.Mode().Perm() != 0600 {
+			t.Errorf("Expected the key mode to be restored, got %v", info.Mode().Perm())
+		}
+	}
+
+	// The restore backed up the overwritten certificate first
+	snaps, _ := s.List("web")
+	if len(snaps) != 2 || snaps[1].ID != snap.ID {
+		t.Fatalf("Expected the restore to add a backup, got %+v", snaps)
+	}
+	if len(snaps[0].Files) != 1 || snaps[0].Files[0].Path != certPath {
+		t.Errorf("Expected only the certificate in the new backup, got %+v", snaps[0].Files)
+	}
+}
+
+// TestBackupNothing tests that no backup is made when no file exists
+func TestBackupNothing(t *testing.T) {
+	s := testStore(t, 0, 0)
+	if _, ok, err := s.Backup("web", filepath.Join(t.TempDir(), "cert.pem")); ok || err != nil {
+		t.Errorf("Expected no backup, got %v, %v", ok, err)
+	}
+	if names, _ := s.Names(); len(names) != 0 {
+		t.Errorf("Expected no names, got %v", names)
+	}
+}
+
+// TestRetention tests that backups beyond Keep or older than MaxAge are removed
+func TestRetention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cert.pem")
+	writeFile(t, path, "cert", 0644)
+
+	s := testStore(t, 3, 0)
+	var ids []string
+	for range 5 {
+		snap, _, err := s.Backup("web", path)
+		if err != nil {
+			t.Fatalf("Failed to back up: %v", err)
+		}
+		ids = append(ids, snap.ID)
+	}
+	snaps, _ := s.List("web")
+	if len(snaps) != 3 || snaps[0].ID != ids[4] || snaps[2].ID != ids[2] {
+		t.Errorf("Expected the newest 3 backups, got %+v", snaps)
+	}
+
+	s = testStore(t, 0, 90*time.Second)
+	for range 3 {
+		s.Backup("web", path)
+	}
+	s.now = func() time.Time { return time.Date(2026, 1, 2, 3, 10, 0, 0, time.UTC) }
+	s.Backup("web", path)
+	if snaps, _ := s.List("web"); len(snaps) != 1 {
+		t.Errorf("Expected old backups to be removed, got %d", len(snaps))
+	}
+}
+
+// TestRestoreNotFound tests restoring unknown or malformed IDs
+func TestRestoreNotFound(t *testing.T) {
+	s := testStore(t, 0, 0)
+	for _, id := range []string{"20260102T030405.000000000Z", "../../etc"} {
+		if _, err := s.Restore("web", id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound for %q, got %v", id, err)
+		}
+	}
+}
+
+// TestDirName tests that names cannot escape the backup directory
+func TestDirName(t *testing.T) {
+	for name, want := range map[string]string{
+		"pem #1":   "pem__1",
+		"../x":     ".._x",
+		"..":       "_",
+		"":         "_",
+		"combined": "combined",
+	} {
+		if got := dirName(name); got != want {
+			t.Errorf("Expected %q for %q, got %q", want, name, got)
+		}
+	}
+}
+
+// TestHandler tests listing and restoring backups over HTTP
+func TestHandler(t *testing.T) {
+	s := testStore(t, 0, 0)
+	path := filepath.Join(t.TempDir(), "cert.pem")
+	writeFile(t, path, "cert v1", 0644)
+	snap, _, err := s.Backup("web", path)
+	if err != nil {
+		t.Fatalf("Failed to back up: %v", err)
+	}
+	writeFile(t, path, "cert v2", 0644)
+
+	srv := httptest.NewServer(Handler(s))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/backups")
+	if err != nil {
+		t.Fatalf("Failed to list backups: %v", err)
+	}
+	var list struct {
+		Backups map[string][]Snapshot `json:"backups"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&list)
+	resp.Body.Close()
+	if err != nil || len(list.Backups["web"]) != 1 || list.Backups["web"][0].ID != snap.ID {
+		t.Fatalf("Expected the backup to be listed, got %+v (%v)", list, err)
+	}
+
+	resp, err = http.Post(srv.URL+"/backups/web/"+snap.ID+"/restore", "", nil)
+	if err != nil {
+		t.Fatalf("Failed to restore: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "cert v1" {
+		t.Errorf("Expected the backup to be restored, got %q", got)
+	}
+
+	resp, err = http.Post(srv.URL+"/backups/web/unknown/restore", "", nil)
+	if err != nil {
+		t.Fatalf("Failed to restore: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", resp.StatusCode)
+	}
+}
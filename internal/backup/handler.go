@@ -0,0 +1,65 @@
+package backup
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// Handler serves the backups for the admin API:
+//
+//	GET  /backups                       every name and its backups
+//	GET  /backups/{name}                the backups of one name
+//	POST /backups/{name}/{id}/restore   restore a backup
+func Handler(s *Store) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /backups", func(w http.ResponseWriter, r *http.Request) {
+		names, err := s.Names()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		all := map[string][]Snapshot{}
+		for _, name := range names {
+			if all[name], err = s.List(name); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		writeJSON(w, struct {
+			Backups map[string][]Snapshot `json:"backups"`
+		}{all})
+	})
+	mux.HandleFunc("GET /backups/{name}", func(w http.ResponseWriter, r *http.Request) {
+		snaps, err := s.List(r.PathValue("name"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, struct {
+			Backups []Snapshot `json:"backups"`
+		}{append([]Snapshot{}, snaps...)})
+	})
+	mux.HandleFunc("POST /backups/{name}/{id}/restore", func(w http.ResponseWriter, r *http.Request) {
+		snap, err := s.Restore(r.PathValue("name"), r.PathValue("id"))
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Backup: restore failed: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, struct {
+			Restored Snapshot `json:"restored"`
+		}{snap})
+	})
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,130 @@
+// Package chaos injects faults into certificate loads and the file watcher
+// at configured rates, so alerting and the agent's recovery can be
+// exercised before it is trusted in production. It must never be enabled
+// on a host serving real traffic.
+package chaos
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"tls-agent/internal/metrics"
+)
+
+// ErrInjected is returned (wrapped) by every injected fault
+var ErrInjected = errors.New("chaos: injected fault")
+
+// Faults, as counted by tls_agent_chaos_faults_total
+const (
+	FaultLoadFailure  = "load_failure"
+	FaultSlowRead     = "slow_read"
+	FaultWatcherError = "watcher_error"
+)
+
+var faults = metrics.NewCounterVec("tls_agent_chaos_faults_total",
+	"Faults injected by chaos mode, by fault", "fault")
+
+// Config sets how often each fault is injected. Rates are probabilities
+// between 0 and 1.
+type Config struct {
+	// LoadFailureRate fails a certificate load
+	LoadFailureRate float64
+
+	// SlowReadRate delays a certificate load by SlowReadDelay, long enough
+	// to trip the load timeout if it exceeds it
+	SlowReadRate  float64
+	SlowReadDelay time.Duration
+
+	// WatcherErrorRate reports a watcher error, checked once a second
+	WatcherErrorRate float64
+
+	// Seed makes the faults reproducible; zero picks a random seed
+	Seed uint64
+}
+
+// Injector decides when to inject faults
+type Injector struct {
+	cfg Config
+
+	mu   sync.Mutex
+	rand *rand.Rand
+	errs chan error
+
+	// sleep and interval default to time.Sleep and a second
+	sleep    func(time.Duration)
+	interval time.Duration
+}
+
+// New returns an Injector for cfg
+func New(cfg Config) *Injector {
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+	log.Printf("WARNING: chaos mode enabled (seed %d): injecting load failures (%g), slow reads (%g, %s) and watcher errors (%g/s)",
+		seed, cfg.LoadFailureRate, cfg.SlowReadRate, cfg.SlowReadDelay, cfg.WatcherErrorRate)
+	return &Injector{cfg: cfg, rand: rand.New(rand.NewPCG(seed, seed)), errs: make(chan error, 1), sleep: time.Sleep, interval: time.Second}
+}
+
+// roll reports whether a fault with probability rate happens now
+func (in *Injector) roll(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return in.rand.Float64() < rate
+}
+
+// WrapLoad returns load with slow reads and failures injected
+func (in *Injector) WrapLoad(load func(certFile, keyFile string) (*tls.Certificate, error)) func(certFile, keyFile string) (*tls.Certificate, error) {
+	return func(certFile, keyFile string) (*tls.Certificate, error) {
+		if in.roll(in.cfg.SlowReadRate) {
+			faults.With(FaultSlowRead).Inc()
+			log.Printf("Chaos: delaying load of %s by %s", certFile, in.cfg.SlowReadDelay)
+			in.sleep(in.cfg.SlowReadDelay)
+		}
+		if in.roll(in.cfg.LoadFailureRate) {
+			faults.With(FaultLoadFailure).Inc()
+			return nil, fmt.Errorf("%w: load of %s failed", ErrInjected, certFile)
+		}
+		return load(certFile, keyFile)
+	}
+}
+
+// WatcherErrors delivers the errors Run injects, for the agent to handle
+// as if the file watcher reported them
+func (in *Injector) WatcherErrors() <-chan error {
+	return in.errs
+}
+
+// Run injects a watcher error with WatcherErrorRate each second until ctx
+// is done
+func (in *Injector) Run(ctx context.Context) error {
+	if in.cfg.WatcherErrorRate <= 0 {
+		return nil
+	}
+	ticker := time.NewTicker(in.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if !in.roll(in.cfg.WatcherErrorRate) {
+				continue
+			}
+			faults.With(FaultWatcherError).Inc()
+			select {
+			case in.errs <- fmt.Errorf("%w: watcher error", ErrInjected):
+			default:
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package chaos
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"testing"
+	"time"
+)
+
+func okLoad(string, string) (*tls.Certificate, error) {
+	return &tls.Certificate{}, nil
+}
+
+// TestWrapLoad tests injected load failures and slow reads
+func TestWrapLoad(t *testing.T) {
+	never := New(Config{Seed: 1})
+	if _, err := never.WrapLoad(okLoad)("tls.crt", "tls.key"); err != nil {
+		t.Fatalf("Expected no fault at rate 0, got %v", err)
+	}
+
+	always := New(Config{LoadFailureRate: 1, SlowReadRate: 1, SlowReadDelay: time.Minute, Seed: 1})
+	var slept time.Duration
+	always.sleep = func(d time.Duration) { slept += d }
+	if _, err := always.WrapLoad(okLoad)("tls.crt", "tls.key"); !errors.Is(err, ErrInjected) {
+		t.Fatalf("Expected an injected failure at rate 1, got %v", err)
+	}
+	if slept != time.Minute {
+		t.Errorf("Expected a slow read of a minute, slept %s", slept)
+	}
+
+	// The same seed injects the same faults
+	outcomes := func() []bool {
+		in := New(Config{LoadFailureRate: 0.5, Seed: 42})
+		var failed []bool
+		for range 20 {
+			_, err := in.WrapLoad(okLoad)("tls.crt", "tls.key")
+			failed = append(failed, err != nil)
+		}
+		return failed
+	}
+	first, second := outcomes(), outcomes()
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("Expected seeded faults to repeat, load %d differs", i)
+		}
+	}
+}
+
+// TestRun tests that watcher errors are injected until the context ends
+func TestRun(t *testing.T) {
+	in := New(Config{WatcherErrorRate: 1, Seed: 1})
+	in.interval = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- in.Run(ctx) }()
+
+	select {
+	case err := <-in.WatcherErrors():
+		if !errors.Is(err, ErrInjected) {
+			t.Errorf("Expected an injected watcher error, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("No watcher error injected")
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Run returned %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+package clock
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func ticked(c <-chan time.Time) (time.Time, bool) {
+	select {
+	case t := <-c:
+		return t, true
+	default:
+		return time.Time{}, false
+	}
+}
+
+// TestFakeTimer tests that timers fire once when the clock passes them
+func TestFakeTimer(t *testing.T) {
+	f := NewFake(epoch)
+	timer := f.NewTimer(time.Minute)
+
+	f.Advance(59 * time.Second)
+	if _, ok := ticked(timer.C()); ok {
+		t.Fatal("Timer fired early")
+	}
+	f.Advance(time.Second)
+	if at, ok := ticked(timer.C()); !ok || !at.Equal(epoch.Add(time.Minute)) {
+		t.Fatalf("Expected the timer to fire at its deadline, got %v, %v", at, ok)
+	}
+	f.Advance(time.Hour)
+	if _, ok := ticked(timer.C()); ok {
+		t.Error("Timer fired twice")
+	}
+
+	if timer.Reset(time.Second) {
+		t.Error("Reset of a fired timer reported it active")
+	}
+	if !timer.Stop() {
+		t.Error("Stop of a reset timer reported it inactive")
+	}
+	f.Advance(time.Minute)
+	if _, ok := ticked(timer.C()); ok {
+		t.Error("Stopped timer fired")
+	}
+}
+
+// TestFakeTicker tests that tickers fire each period and drop missed ticks
+func TestFakeTicker(t *testing.T) {
+	f := NewFake(epoch)
+	ticker := f.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	for i := 1; i <= 3; i++ {
+		f.Advance(10 * time.Second)
+		if at, ok := ticked(ticker.C()); !ok || !at.Equal(epoch.Add(time.Duration(i)*10*time.Second)) {
+			t.Fatalf("Tick %d: got %v, %v", i, at, ok)
+		}
+	}
+
+	// A year's jump delivers one tick and keeps the schedule
+	f.Advance(365 * 24 * time.Hour)
+	if _, ok := ticked(ticker.C()); !ok {
+		t.Fatal("Expected a tick after a long jump")
+	}
+	if _, ok := ticked(ticker.C()); ok {
+		t.Error("Expected missed ticks to be dropped")
+	}
+	f.Advance(10 * time.Second)
+	if _, ok := ticked(ticker.C()); !ok {
+		t.Error("Expected the ticker to keep its period after a jump")
+	}
+	if got := f.Now(); !got.Equal(epoch.Add(365*24*time.Hour + 40*time.Second)) {
+		t.Errorf("Expected the clock at the target time, got %v", got)
+	}
+}
+
+// TestFakeBlockUntil tests waiting for code to start waiting on the clock
+func TestFakeBlockUntil(t *testing.T) {
+	f := NewFake(epoch)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-f.NewTimer(time.Hour).C()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := f.BlockUntil(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	f.Advance(time.Hour)
+	<-done
+
+	short, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := f.BlockUntil(short, 1); err == nil {
+		t.Error("Expected BlockUntil to time out with no active timers")
+	}
+
+	// Set never moves time back
+	f.Set(epoch)
+	if !f.Now().Equal(epoch.Add(time.Hour)) {
+		t.Errorf("Expected the clock to stay at %v, got %v", epoch.Add(time.Hour), f.Now())
+	}
+}
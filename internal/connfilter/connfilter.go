@@ -0,0 +1,159 @@
+// Package connfilter drops unwanted connections before their TLS handshake
+// starts: clients outside the allow list or inside the deny list, and
+// clients opening connections faster than their per-IP rate allows. Doing
+// this at accept time keeps handshake floods from costing any crypto.
+package connfilter
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"tls-agent/internal/clock"
+	"tls-agent/internal/metrics"
+)
+
+// Reject reasons reported in metrics
+const (
+	ReasonDenied      = "denied"
+	ReasonNotAllowed  = "not_allowed"
+	ReasonRateLimited = "rate_limited"
+)
+
+var rejected = metrics.NewCounterVec("tls_agent_connections_rejected_total",
+	"Connections closed before the TLS handshake by listener and reason (denied, not_allowed, rate_limited)", "listener", "reason")
+
+// idleBucket is how long an unused per-IP bucket is kept
+const idleBucket = 10 * time.Minute
+
+// Filter decides which connections may proceed to the handshake
+type Filter struct {
+	// Allow, if not empty, admits only clients in these networks
+	Allow []netip.Prefix
+
+	// Deny rejects clients in these networks; it wins over Allow
+	Deny []netip.Prefix
+
+	// Rate is how many new connections per second each client address may
+	// open, with bursts up to Burst; zero disables rate limiting
+	Rate  float64
+	Burst int
+
+	// Clock refills the rate limit buckets; defaults to the wall clock
+	Clock clock.Clock
+
+	mu        sync.Mutex
+	buckets   map[netip.Addr]*bucket
+	lastPrune time.Time
+}
+
+// bucket is a token bucket for one client address
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Check returns the reason addr is rejected, or "" if it may connect
+func (f *Filter) Check(addr netip.Addr) string {
+	addr = addr.Unmap()
+	for _, p := range f.Deny {
+		if p.Contains(addr) {
+			return ReasonDenied
+		}
+	}
+	if len(f.Allow) > 0 {
+		allowed := false
+		for _, p := range f.Allow {
+			if p.Contains(addr) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return ReasonNotAllowed
+		}
+	}
+	if f.Rate > 0 && !f.take(addr) {
+		return ReasonRateLimited
+	}
+	return ""
+}
+
+// take removes a token from addr's bucket, reporting whether one was left
+func (f *Filter) take(addr netip.Addr) bool {
+	now := clock.Or(f.Clock).Now()
+	burst := float64(max(f.Burst, 1))
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.buckets == nil {
+		f.buckets = make(map[netip.Addr]*bucket)
+	}
+	if now.Sub(f.lastPrune) > idleBucket {
+		for a, b := range f.buckets {
+			if now.Sub(b.last) > idleBucket {
+				delete(f.buckets, a)
+			}
+		}
+		f.lastPrune = now
+	}
+
+	b, ok := f.buckets[addr]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		f.buckets[addr] = b
+	}
+	b.tokens = min(burst, b.tokens+now.Sub(b.last).Seconds()*f.Rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Listener closes rejected connections as they are accepted
+type Listener struct {
+	net.Listener
+	name   string
+	filter *Filter
+}
+
+// Wrap returns ln filtered by f; name labels the listener in metrics
+func Wrap(name string, ln net.Listener, f *Filter) *Listener {
+	return &Listener{Listener: ln, name: name, filter: f}
+}
+
+// Accept returns the next connection the filter admits
+func (l *Listener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		addr, err := remoteAddr(conn)
+		if err != nil {
+			// Non-IP listeners (unix sockets) have nothing to filter on
+			return conn, nil
+		}
+		if reason := l.filter.Check(addr); reason != "" {
+			rejected.With(l.name, reason).Inc()
+			conn.Close()
+			continue
+		}
+		return conn, nil
+	}
+}
+
+func remoteAddr(conn net.Conn) (netip.Addr, error) {
+	if tcp, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		return tcp.AddrPort().Addr(), nil
+	}
+	ap, err := netip.ParseAddrPort(conn.RemoteAddr().String())
+	if err != nil {
+		return netip.Addr{}, errors.New("connfilter: not an IP connection")
+	}
+	return ap.Addr(), nil
+}
@@ -0,0 +1,116 @@
+package connfilter
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"tls-agent/internal/clock"
+	"tls-agent/internal/metrics/metricstest"
+)
+
+// TestCheck tests allow and deny lists
+func TestCheck(t *testing.T) {
+	f := &Filter{
+		Allow: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("2001:db8::/32")},
+		Deny:  []netip.Prefix{netip.MustParsePrefix("10.66.0.0/16")},
+	}
+	for addr, want := range map[string]string{
+		"10.1.2.3":        "",
+		"::ffff:10.1.2.3": "",
+		"2001:db8::1":     "",
+		"10.66.1.1":       ReasonDenied,
+		"192.0.2.1":       ReasonNotAllowed,
+		"2001:db9::1":     ReasonNotAllowed,
+	} {
+		if got := f.Check(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("%s: expected %q, got %q", addr, want, got)
+		}
+	}
+}
+
+// TestRateLimit tests the per-address token bucket
+func TestRateLimit(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1000, 0))
+	f := &Filter{Rate: 2, Burst: 3, Clock: fake}
+	a := netip.MustParseAddr("192.0.2.1")
+	b := netip.MustParseAddr("192.0.2.2")
+
+	for i := 0; i < 3; i++ {
+		if reason := f.Check(a); reason != "" {
+			t.Fatalf("Connection %d within the burst rejected: %s", i, reason)
+		}
+	}
+	if reason := f.Check(a); reason != ReasonRateLimited {
+		t.Errorf("Expected the fourth connection to be rate limited, got %q", reason)
+	}
+	if reason := f.Check(b); reason != "" {
+		t.Errorf("Expected another address to have its own bucket, got %q", reason)
+	}
+
+	fake.Advance(500 * time.Millisecond)
+	if reason := f.Check(a); reason != "" {
+		t.Errorf("Expected a token after half a second at 2/s, got %q", reason)
+	}
+
+	fake.Advance(time.Hour)
+	f.Check(b)
+	if _, ok := f.buckets[a]; ok {
+		t.Error("Expected idle buckets to be pruned")
+	}
+}
+
+// acceptOne accepts a single connection from l in the background
+func acceptOne(l net.Listener) <-chan net.Conn {
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := l.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+	return accepted
+}
+
+// TestListener tests that rejected connections are closed on accept
+func TestListener(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		filter *Filter
+		admit  bool
+	}{
+		{"deny", &Filter{Deny: []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}}, false},
+		{"allow", &Filter{Allow: []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}}, true},
+	} {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Failed to listen: %v", err)
+		}
+		filtered := Wrap(tc.name, ln, tc.filter)
+		accepted := acceptOne(filtered)
+		denied := metricstest.Delta(rejected.With(tc.name, ReasonDenied))
+
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatalf("Failed to dial: %v", err)
+		}
+		if tc.admit {
+			select {
+			case c := <-accepted:
+				c.Close()
+			case <-time.After(2 * time.Second):
+				t.Errorf("%s: allowed connection was not accepted", tc.name)
+			}
+		} else {
+			_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+			if _, err := conn.Read(make([]byte, 1)); err == nil {
+				t.Errorf("%s: expected the connection to be closed", tc.name)
+			}
+			if got := denied(); got != 1 {
+				t.Errorf("%s: expected 1 denied connection, got %d", tc.name, got)
+			}
+		}
+		conn.Close()
+		filtered.Close()
+	}
+}
@@ -0,0 +1,166 @@
+// Package conntrack applies a policy to TLS connections that outlive a
+// certificate rotation. Clients holding a connection keep talking over the
+// session negotiated with the old certificate, which some compliance
+// regimes do not allow; the tracker drains or closes those connections.
+package conntrack
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"tls-agent/internal/metrics"
+	"tls-agent/internal/notify"
+)
+
+// Policy modes
+const (
+	// ModeNever leaves existing connections alone
+	ModeNever = "never"
+
+	// ModeDrain closes each older connection once it is idle, so no
+	// request is cut off, and closes the rest when the grace period ends
+	ModeDrain = "drain"
+
+	// ModeClose closes older connections when the grace period ends, or
+	// immediately without one
+	ModeClose = "close"
+)
+
+var closedByPolicy = metrics.NewCounterVec("tls_agent_connections_closed_by_policy_total",
+	"Connections closed after a certificate rotation by listener and policy mode", "listener", "mode")
+
+// Tracker follows the connections of one or more http.Servers and applies
+// its policy to those accepted before a rotation
+type Tracker struct {
+	// Mode is ModeNever, ModeDrain or ModeClose
+	Mode string
+
+	// Grace is how long older connections may live after a rotation; zero
+	// means drained connections may live until idle and closed ones are
+	// closed at once
+	Grace time.Duration
+
+	mu    sync.Mutex
+	conns map[net.Conn]*conn
+}
+
+// conn is the state of one tracked connection
+type conn struct {
+	listener string
+	since    time.Time
+	idle     bool
+	draining bool
+}
+
+// ConnState returns an http.Server.ConnState hook tracking the server's
+// connections; listener labels them in metrics
+func (t *Tracker) ConnState(listener string) func(net.Conn, http.ConnState) {
+	return func(nc net.Conn, state http.ConnState) {
+		t.mu.Lock()
+		if t.conns == nil {
+			t.conns = make(map[net.Conn]*conn)
+		}
+		c := t.conns[nc]
+		switch state {
+		case http.StateNew:
+			t.conns[nc] = &conn{listener: listener, since: time.Now()}
+		case http.StateActive:
+			if c != nil {
+				c.idle = false
+			}
+		case http.StateIdle:
+			if c != nil {
+				c.idle = true
+				if c.draining {
+					delete(t.conns, nc)
+					t.mu.Unlock()
+					t.close(nc, c)
+					return
+				}
+			}
+		case http.StateHijacked, http.StateClosed:
+			delete(t.conns, nc)
+		}
+		t.mu.Unlock()
+	}
+}
+
+// Rotated applies the policy to the connections accepted until now
+func (t *Tracker) Rotated() {
+	cutoff := time.Now()
+	switch t.Mode {
+	case ModeDrain:
+		t.drain(cutoff)
+	case ModeClose:
+		if t.Grace <= 0 {
+			t.closeBefore(cutoff)
+			return
+		}
+	default:
+		return
+	}
+	if t.Grace > 0 {
+		time.AfterFunc(t.Grace, func() { t.closeBefore(cutoff) })
+	}
+}
+
+// Notify applies the policy after a successful reload
+func (t *Tracker) Notify(_ context.Context, e notify.Event) error {
+	if e.Type == notify.EventReloadSucceeded {
+		t.Rotated()
+	}
+	return nil
+}
+
+// drain marks connections accepted before cutoff and closes the idle ones
+func (t *Tracker) drain(cutoff time.Time) {
+	idle := make(map[net.Conn]*conn)
+	t.mu.Lock()
+	for nc, c := range t.conns {
+		if c.since.After(cutoff) {
+			continue
+		}
+		c.draining = true
+		if c.idle {
+			idle[nc] = c
+			delete(t.conns, nc)
+		}
+	}
+	t.mu.Unlock()
+
+	for nc, c := range idle {
+		t.close(nc, c)
+	}
+}
+
+// closeBefore closes every connection accepted before cutoff
+func (t *Tracker) closeBefore(cutoff time.Time) {
+	old := make(map[net.Conn]*conn)
+	t.mu.Lock()
+	for nc, c := range t.conns {
+		if !c.since.After(cutoff) {
+			old[nc] = c
+			delete(t.conns, nc)
+		}
+	}
+	t.mu.Unlock()
+
+	for nc, c := range old {
+		t.close(nc, c)
+	}
+}
+
+func (t *Tracker) close(nc net.Conn, c *conn) {
+	closedByPolicy.With(c.listener, t.Mode).Inc()
+	nc.Close()
+}
+
+// Len returns the number of tracked connections
+func (t *Tracker) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.conns)
+}
@@ -0,0 +1,113 @@
+package conntrack
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newServer starts a TLS server tracked by tr whose handler blocks while
+// block is non-nil and open
+func newServer(t *testing.T, tr *Tracker, name string, block chan struct{}) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-block
+		}
+		io.WriteString(w, "ok")
+	}))
+	srv.Config.ConnState = tr.ConnState(name)
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// get performs a request on its own keep-alive client
+func get(t *testing.T, client *http.Client, url string) {
+	t.Helper()
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Errorf("Request to %s failed: %v", url, err)
+		return
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+}
+
+// waitFor polls cond for up to two seconds
+func waitFor(cond func() bool) bool {
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if cond() {
+			return true
+		}
+	}
+	return false
+}
+
+// TestDrain tests that drained connections close once idle
+func TestDrain(t *testing.T) {
+	tr := &Tracker{Mode: ModeDrain}
+	block := make(chan struct{})
+	srv := newServer(t, tr, "drain", block)
+	counter := closedByPolicy.With("drain", ModeDrain)
+	base := counter.Value()
+	closed := func() uint64 { return counter.Value() - base }
+
+	idle := srv.Client()
+	get(t, idle, srv.URL+"/")
+	active := &http.Client{Transport: srv.Client().Transport.(*http.Transport).Clone()}
+	done := make(chan struct{})
+	go func() {
+		get(t, active, srv.URL+"/slow")
+		close(done)
+	}()
+	if !waitFor(func() bool { return tr.Len() == 2 }) {
+		t.Fatalf("Expected 2 tracked connections, got %d", tr.Len())
+	}
+
+	tr.Rotated()
+	if got := closed(); got != 1 {
+		t.Errorf("Expected the idle connection to close at once, got %d closed", got)
+	}
+	close(block)
+	<-done
+	if !waitFor(func() bool { return closed() == 2 }) {
+		t.Errorf("Expected the active connection to close after its request, got %d closed", closed())
+	}
+
+	get(t, idle, srv.URL+"/")
+	if !waitFor(func() bool { return tr.Len() == 1 }) || closed() != 2 {
+		t.Errorf("Expected a new connection to be kept, got %d tracked", tr.Len())
+	}
+}
+
+// TestCloseAfterGrace tests closing older connections when the grace period ends
+func TestCloseAfterGrace(t *testing.T) {
+	tr := &Tracker{Mode: ModeClose, Grace: 100 * time.Millisecond}
+	srv := newServer(t, tr, "close", nil)
+	counter := closedByPolicy.With("close", ModeClose)
+	base := counter.Value()
+	closed := func() uint64 { return counter.Value() - base }
+
+	get(t, srv.Client(), srv.URL+"/")
+	tr.Rotated()
+	if closed() != 0 {
+		t.Error("Expected connections to survive during the grace period")
+	}
+	if !waitFor(func() bool { return closed() == 1 && tr.Len() == 0 }) {
+		t.Errorf("Expected the connection to close after the grace period, got %d closed", closed())
+	}
+}
+
+// TestNever tests that the default mode leaves connections open
+func TestNever(t *testing.T) {
+	tr := &Tracker{Mode: ModeNever}
+	srv := newServer(t, tr, "never", nil)
+	get(t, srv.Client(), srv.URL+"/")
+	tr.Rotated()
+	if tr.Len() != 1 {
+		t.Errorf("Expected the connection to stay open, got %d tracked", tr.Len())
+	}
+}
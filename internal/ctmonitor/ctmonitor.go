@@ -0,0 +1,251 @@
+package ctmonitor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"tls-agent/internal/notify"
+)
+
+// EventUnexpectedCertificate is raised when CT logs show a suspicious certificate
+const EventUnexpectedCertificate = "ct_unexpected_certificate"
+
+// Entry is a logged certificate relevant to a monitored domain
+type Entry struct {
+	ID        int64     `json:"id"`
+	Issuer    string    `json:"issuer_name"`
+	Names     []string  `json:"names"`
+	Serial    string    `json:"serial_number"`
+	NotBefore time.Time `json:"not_before"`
+}
+
+// Source searches certificate transparency logs for a domain
+type Source interface {
+	Search(ctx context.Context, domain string) ([]Entry, error)
+}
+
+// CrtSh queries the crt.sh CT aggregator
+type CrtSh struct {
+	Endpoint string
+	Client   *http.Client
+}
+
+type crtShEntry struct {
+	ID         int64  `json:"id"`
+	IssuerName string `json:"issuer_name"`
+	NameValue  string `json:"name_value"`
+	Serial     string `json:"serial_number"`
+	NotBefore  string `json:"not_before"`
+}
+
+// Search returns all logged certificates for domain and its subdomains
+func (c *CrtSh) Search(ctx context.Context, domain string) ([]Entry, error) {
+	endpoint := c.Endpoint
+	if endpoint == "" {
+		endpoint = "https://crt.sh/"
+	}
+	u := endpoint + "?output=json&q=" + url.QueryEscape("%."+domain)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := c.Client
+	if client == nil {
+		client = &http.Client{Timeout: 60 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("crt.sh returned %d", resp.StatusCode)
+	}
+
+	var raw []crtShEntry
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<20)).Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	entries := make([]Entry, 0, len(raw))
+	for _, r := range raw {
+		notBefore, _ := time.Parse("2006-01-02T15:04:05", r.NotBefore)
+		entries = append(entries, Entry{
+			ID:        r.ID,
+			Issuer:    r.IssuerName,
+			Names:     strings.Fields(r.NameValue),
+			Serial:    r.Serial,
+			NotBefore: notBefore,
+		})
+	}
+	return entries, nil
+}
+
+// Finding is an entry that did not match expectations
+type Finding struct {
+	Entry   Entry
+	Reasons []string
+}
+
+// Config configures a Monitor
+type Config struct {
+	// Domains are the registrable domains to watch
+	Domains []string
+
+	// AllowedIssuers are substrings one of which must appear in the issuer DN
+	AllowedIssuers []string
+
+	// ExpectedNames are name patterns (path.Match syntax, e.g. "*.example.com")
+	// every SAN must match; empty means each domain and its wildcard
+	ExpectedNames []string
+}
+
+// Monitor polls a Source and alerts on unexpected issuers or SAN sets
+type Monitor struct {
+	source   Source
+	cfg      Config
+	notifier notify.Notifier
+
+	mu        sync.Mutex
+	seen      map[int64]bool
+	baselined map[string]bool
+}
+
+// New creates a monitor
+func New(source Source, cfg Config, notifier notify.Notifier) *Monitor {
+	if len(cfg.ExpectedNames) == 0 {
+		for _, d := range cfg.Domains {
+			cfg.ExpectedNames = append(cfg.ExpectedNames, d, "*."+d)
+		}
+	}
+	return &Monitor{
+		source:    source,
+		cfg:       cfg,
+		notifier:  notifier,
+		seen:      make(map[int64]bool),
+		baselined: make(map[string]bool),
+	}
+}
+
+// Poll searches every domain once and alerts for each new suspicious entry.
+// The first successful search of a domain only records its existing entries
+// as a baseline, so a restart does not re-alert on the domain's history. A
+// failing domain does not stop the others; their errors are joined.
+func (m *Monitor) Poll(ctx context.Context) ([]Finding, error) {
+	var findings []Finding
+	var errs []error
+	for _, domain := range m.cfg.Domains {
+		entries, err := m.source.Search(ctx, domain)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("ct search %s: %w", domain, err))
+			continue
+		}
+
+		m.mu.Lock()
+		baseline := !m.baselined[domain]
+		m.baselined[domain] = true
+		m.mu.Unlock()
+
+		for _, e := range entries {
+			m.mu.Lock()
+			seen := m.seen[e.ID]
+			m.seen[e.ID] = true
+			m.mu.Unlock()
+			if seen || baseline {
+				continue
+			}
+
+			if reasons := m.check(e); len(reasons) > 0 {
+				f := Finding{Entry: e, Reasons: reasons}
+				findings = append(findings, f)
+				m.alert(f)
+			}
+		}
+	}
+	return findings, errors.Join(errs...)
+}
+
+func (m *Monitor) check(e Entry) []string {
+	var reasons []string
+
+	if len(m.cfg.AllowedIssuers) > 0 {
+		allowed := false
+		for _, issuer := range m.cfg.AllowedIssuers {
+			if strings.Contains(e.Issuer, issuer) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			reasons = append(reasons, fmt.Sprintf("unexpected issuer %q", e.Issuer))
+		}
+	}
+
+	for _, name := range e.Names {
+		if !m.expectedName(name) {
+			reasons = append(reasons, fmt.Sprintf("unexpected SAN %q", name))
+		}
+	}
+	return reasons
+}
+
+func (m *Monitor) expectedName(name string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range m.cfg.ExpectedNames {
+		pattern = strings.ToLower(pattern)
+		if pattern == name {
+			return true
+		}
+		// Only match the wildcard label-for-label so "*.example.com" does not
+		// cover "a.b.example.com"
+		if ok, _ := path.Match(pattern, name); ok && strings.Count(pattern, ".") == strings.Count(name, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Monitor) alert(f Finding) {
+	notify.Send(m.notifier, notify.Event{
+		Type:     EventUnexpectedCertificate,
+		Severity: notify.SeverityCritical,
+		Message:  "CT log shows unexpected certificate: " + strings.Join(f.Reasons, "; "),
+		Fields: map[string]string{
+			"ct_id":  fmt.Sprint(f.Entry.ID),
+			"issuer": f.Entry.Issuer,
+			"serial": f.Entry.Serial,
+			"names":  strings.Join(f.Entry.Names, ","),
+		},
+	})
+}
+
+// Run polls every interval until stopChan is closed
+func (m *Monitor) Run(interval time.Duration, stopChan <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		if _, err := m.Poll(ctx); err != nil {
+			log.Println("CT monitor: poll failed:", err)
+		}
+		cancel()
+
+		select {
+		case <-ticker.C:
+		case <-stopChan:
+			return
+		}
+	}
+}
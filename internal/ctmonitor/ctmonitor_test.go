@@ -0,0 +1,121 @@
+package ctmonitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"tls-agent/internal/notify"
+)
+
+// fakeSource returns a fixed set of entries per domain and fails for
+// domains without any
+type fakeSource map[string][]Entry
+
+func (f fakeSource) Search(_ context.Context, domain string) ([]Entry, error) {
+	entries, ok := f[domain]
+	if !ok {
+		return nil, errors.New("unavailable")
+	}
+	return entries, nil
+}
+
+// recorder collects delivered events
+type recorder struct {
+	mu     sync.Mutex
+	events []notify.Event
+}
+
+func (r *recorder) Notify(_ context.Context, e notify.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+	return nil
+}
+
+// TestMonitorFindings tests detection of unexpected issuers and SANs
+func TestMonitorFindings(t *testing.T) {
+	source := fakeSource{"example.com": {
+		{ID: 1, Issuer: "C=XX, O=Rogue CA", Names: []string{"example.com"}},
+	}}
+	rec := &recorder{}
+	m := New(source, Config{Domains: []string{"example.com"}, AllowedIssuers: []string{"Let's Encrypt"}}, rec)
+
+	// The first poll records existing entries as the baseline
+	findings, err := m.Poll(context.Background())
+	if err != nil {
+		t.Fatalf("Poll failed: %v", err)
+	}
+	if len(findings) != 0 || len(rec.events) != 0 {
+		t.Fatalf("Expected baseline poll to stay quiet, got %+v", findings)
+	}
+
+	source["example.com"] = append(source["example.com"],
+		Entry{ID: 2, Issuer: "C=US, O=Let's Encrypt, CN=R11", Names: []string{"example.com", "www.example.com"}},
+		Entry{ID: 3, Issuer: "C=XX, O=Rogue CA", Names: []string{"example.com"}},
+		Entry{ID: 4, Issuer: "C=US, O=Let's Encrypt, CN=R11", Names: []string{"evil.example.org"}},
+		Entry{ID: 5, Issuer: "C=US, O=Let's Encrypt, CN=R11", Names: []string{"a.b.example.com"}},
+	)
+	findings, err = m.Poll(context.Background())
+	if err != nil {
+		t.Fatalf("Poll failed: %v", err)
+	}
+
+	ids := map[int64]bool{}
+	for _, f := range findings {
+		ids[f.Entry.ID] = true
+	}
+	if ids[1] || ids[2] || !ids[3] || !ids[4] || !ids[5] {
+		t.Errorf("Unexpected findings: %+v", findings)
+	}
+	if len(rec.events) != 3 || rec.events[0].Type != EventUnexpectedCertificate {
+		t.Errorf("Expected 3 alerts, got %+v", rec.events)
+	}
+
+	// Entries are only reported once
+	findings, _ = m.Poll(context.Background())
+	if len(findings) != 0 {
+		t.Errorf("Expected no new findings on third poll, got %d", len(findings))
+	}
+}
+
+// TestMonitorDomainError tests that one failing domain does not stop the others
+func TestMonitorDomainError(t *testing.T) {
+	source := fakeSource{"example.org": {}}
+	m := New(source, Config{Domains: []string{"example.com", "example.org"}}, &recorder{})
+
+	m.Poll(context.Background())
+	source["example.org"] = []Entry{{ID: 1, Issuer: "O=Test CA", Names: []string{"evil.example.net"}}}
+
+	findings, err := m.Poll(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "example.com") {
+		t.Errorf("Expected example.com error, got %v", err)
+	}
+	if len(findings) != 1 {
+		t.Errorf("Expected example.org finding despite example.com failing, got %+v", findings)
+	}
+}
+
+// TestCrtShSource tests parsing of the crt.sh JSON format
+func TestCrtShSource(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if q := r.URL.Query().Get("q"); q != "%.example.com" {
+			t.Errorf("Unexpected query %q", q)
+		}
+		fmt.Fprint(w, `[{"id":42,"issuer_name":"O=Test CA","name_value":"example.com\nwww.example.com","serial_number":"0a","not_before":"2026-01-02T03:04:05"}]`)
+	}))
+	defer srv.Close()
+
+	entries, err := (&CrtSh{Endpoint: srv.URL + "/"}).Search(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(entries) != 1 || entries[0].ID != 42 || len(entries[0].Names) != 2 || entries[0].NotBefore.Year() != 2026 {
+		t.Errorf("Unexpected entries: %+v", entries)
+	}
+}
@@ -0,0 +1,137 @@
+// Package dashboard serves a small HTML page on the admin API showing the
+// managed certificates' expiry timelines, recent reloads and health, for
+// operators without a metrics stack. It is rendered server-side and needs no
+// external assets.
+package dashboard
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+
+	"tls-agent/internal/agent"
+	"tls-agent/internal/health"
+	"tls-agent/internal/inventory"
+)
+
+//go:embed dashboard.html
+var page string
+
+// refreshInterval is how often the page reloads itself
+const refreshInterval = 30 * time.Second
+
+// Expiry thresholds for colouring timelines
+const (
+	criticalWithin = 7 * 24 * time.Hour
+	warningWithin  = 30 * 24 * time.Hour
+)
+
+var tmpl = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"short": func(fp string) string {
+		if len(fp) > 12 {
+			return fp[:12]
+		}
+		return fp
+	},
+	"timestamp": func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return t.Local().Format("2006-01-02 15:04:05")
+	},
+}).Parse(page))
+
+// Dashboard renders the page from the agent's current state
+type Dashboard struct {
+	Certificates func() []inventory.Certificate
+	Reloads      func() []agent.ReloadEvent
+
+	// Health runs the health checks; nil hides the health section
+	Health func() health.Report
+
+	now func() time.Time
+}
+
+// timeline is one certificate row
+type timeline struct {
+	inventory.Certificate
+
+	// Elapsed is the percentage of the validity period that has passed
+	Elapsed int
+
+	// Remaining is the time left, rounded for display
+	Remaining string
+
+	// Class is "ok", "warning", "critical" or "expired"
+	Class string
+}
+
+// view is the template data
+type view struct {
+	Generated time.Time
+	Refresh   int
+	Timelines []timeline
+	Reloads   []agent.ReloadEvent
+	Health    *health.Report
+}
+
+// ServeHTTP renders the dashboard
+func (d *Dashboard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	if d.now != nil {
+		now = d.now()
+	}
+	v := view{Generated: now, Refresh: int(refreshInterval / time.Second)}
+	if d.Certificates != nil {
+		for _, c := range d.Certificates() {
+			v.Timelines = append(v.Timelines, newTimeline(c, now))
+		}
+	}
+	if d.Reloads != nil {
+		v.Reloads = d.Reloads()
+	}
+	if d.Health != nil {
+		report := d.Health()
+		v.Health = &report
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := tmpl.Execute(w, v); err != nil {
+		log.Printf("Dashboard: render failed: %v", err)
+	}
+}
+
+func newTimeline(c inventory.Certificate, now time.Time) timeline {
+	t := timeline{Certificate: c, Class: "ok"}
+	if total := c.NotAfter.Sub(c.NotBefore); total > 0 {
+		t.Elapsed = int(min(max(now.Sub(c.NotBefore)*100/total, 0), 100))
+	}
+
+	left := c.NotAfter.Sub(now)
+	switch {
+	case left <= 0:
+		t.Class, t.Remaining = "expired", "expired"
+		return t
+	case left < criticalWithin:
+		t.Class = "critical"
+	case left < warningWithin:
+		t.Class = "warning"
+	}
+	if days := int(left / (24 * time.Hour)); days > 0 {
+		t.Remaining = plural(days, "day")
+	} else {
+		t.Remaining = plural(int(left/time.Hour), "hour")
+	}
+	return t
+}
+
+func plural(n int, unit string) string {
+	if n != 1 {
+		unit += "s"
+	}
+	return fmt.Sprintf("%d %s", n, unit)
+}
@@ -0,0 +1,91 @@
+package dashboard
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"tls-agent/internal/agent"
+	"tls-agent/internal/health"
+	"tls-agent/internal/inventory"
+)
+
+// TestDashboard tests that certificates, reloads and health are rendered
+func TestDashboard(t *testing.T) {
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	registry := health.NewRegistry()
+	registry.Register("certificate", func() (any, error) { return nil, errors.New("expires soon") })
+
+	d := &Dashboard{
+		Certificates: func() []inventory.Certificate {
+			return []inventory.Certificate{{
+				Name:        "default",
+				SANs:        []string{"www.example.com", "<script>"},
+				Issuer:      "CN=Test CA",
+				Fingerprint: "0123456789abcdef",
+				NotBefore:   now.Add(-80 * 24 * time.Hour),
+				NotAfter:    now.Add(10 * 24 * time.Hour),
+				OCSP:        inventory.OCSPDisabled,
+			}}
+		},
+		Reloads: func() []agent.ReloadEvent {
+			return []agent.ReloadEvent{{Time: now, Trigger: agent.TriggerFileChange, Result: agent.ResultFailed, Error: "bad key"}}
+		},
+		Health: registry.Run,
+		now:    func() time.Time { return now },
+	}
+
+	srv := httptest.NewServer(d)
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Failed to get dashboard: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Expected HTML, got %q", ct)
+	}
+
+	page := string(body)
+	for _, want := range []string{
+		"www.example.com", "CN=Test CA", "0123456789ab", "10 days", `class="warning"`, "width: 88%",
+		"file_change", "bad key", "expires soon", "unhealthy", "&lt;script&gt;",
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("Page missing %q", want)
+		}
+	}
+	if strings.Contains(page, "<script>") {
+		t.Error("Expected certificate fields to be escaped")
+	}
+}
+
+// TestTimeline tests expiry classification
+func TestTimeline(t *testing.T) {
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		left      time.Duration
+		class     string
+		remaining string
+	}{
+		{60 * 24 * time.Hour, "ok", "60 days"},
+		{20 * 24 * time.Hour, "warning", "20 days"},
+		{36 * time.Hour, "critical", "1 day"},
+		{5 * time.Hour, "critical", "5 hours"},
+		{-time.Hour, "expired", "expired"},
+	} {
+		c := inventory.Certificate{NotBefore: now.Add(-90 * 24 * time.Hour), NotAfter: now.Add(tt.left)}
+		got := newTimeline(c, now)
+		if got.Class != tt.class || got.Remaining != tt.remaining {
+			t.Errorf("Expected %s/%s for %v left, got %s/%s", tt.class, tt.remaining, tt.left, got.Class, got.Remaining)
+		}
+	}
+	if got := newTimeline(inventory.Certificate{NotBefore: now.Add(time.Hour), NotAfter: now.Add(2 * time.Hour)}, now); got.Elapsed != 0 {
+		t.Errorf("Expected a not yet valid certificate at 0%%, got %d%%", got.Elapsed)
+	}
+}
@@ -0,0 +1,328 @@
+// Package delegated issues TLS delegated credentials (RFC 9345): short-lived
+// keys signed by the long-lived certificate's key, so the key used in
+// handshakes can be rotated every few hours without re-issuing the
+// certificate. Go's crypto/tls cannot serve delegated credentials, so they
+// are written out for a TLS frontend that can.
+package delegated
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// OIDDelegationUsage is the certificate extension allowing the subject key
+// to sign delegated credentials
+var OIDDelegationUsage = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 44363, 44}
+
+// MaxValidity is the longest a credential may remain valid (RFC 9345 4.1.3)
+const MaxValidity = 7 * 24 * time.Hour
+
+// signatureContext prefixes the signed content (RFC 9345 4)
+const signatureContext = "TLS, server delegated credentials"
+
+var (
+	// ErrNoDelegationUsage is returned for certificates lacking the
+	// DelegationUsage extension or the digitalSignature key usage
+	ErrNoDelegationUsage = errors.New("certificate does not allow delegated credentials")
+
+	// ErrExpired is returned when a credential is not valid at the given time
+	ErrExpired = errors.New("delegated credential expired")
+)
+
+// Credential is a delegated credential
+type Credential struct {
+	// ValidTime is the credential lifetime counted from the certificate's
+	// NotBefore
+	ValidTime time.Duration
+
+	// Scheme is the algorithm the delegated key signs handshakes with
+	Scheme tls.SignatureScheme
+
+	// PublicKey is the delegated key
+	PublicKey crypto.PublicKey
+
+	// Algorithm and Signature are the certificate key's signature
+	Algorithm tls.SignatureScheme
+	Signature []byte
+
+	// Raw is the wire encoding
+	Raw []byte
+
+	rawSPKI []byte
+}
+
+// Expiry returns when the credential issued under leaf expires
+func (c *Credential) Expiry(leaf *x509.Certificate) time.Time {
+	return leaf.NotBefore.Add(c.ValidTime)
+}
+
+// AllowsDelegation reports whether leaf may sign delegated credentials
+func AllowsDelegation(leaf *x509.Certificate) bool {
+	if leaf.KeyUsage&x509.KeyUsageDigitalSignature == 0 {
+		return false
+	}
+	for _, ext := range leaf.Extensions {
+		if ext.Id.Equal(OIDDelegationUsage) {
+			return true
+		}
+	}
+	return false
+}
+
+// Issue creates a credential for a fresh key of scheme, valid for validity
+// from now, signed by cert's key. It returns the credential and its key.
+func Issue(cert *tls.Certificate, scheme tls.SignatureScheme, validity time.Duration, now time.Time) (*Credential, crypto.Signer, error) {
+	if len(cert.Certificate) == 0 {
+		return nil, nil, errors.New("no certificate")
+	}
+	leaf := cert.Leaf
+	if leaf == nil {
+		var err error
+		if leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return nil, nil, err
+		}
+	}
+	if !AllowsDelegation(leaf) {
+		return nil, nil, ErrNoDelegationUsage
+	}
+	if validity <= 0 || validity > MaxValidity {
+		return nil, nil, fmt.Errorf("validity %v outside (0, %v]", validity, MaxValidity)
+	}
+	expiry := now.Add(validity)
+	if expiry.After(leaf.NotAfter) {
+		expiry = leaf.NotAfter
+	}
+	if !expiry.After(now) {
+		return nil, nil, errors.New("certificate expired")
+	}
+
+	signer, ok := cert.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, nil, errors.New("certificate key cannot sign")
+	}
+	algorithm, err := schemeFor(signer.Public())
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := generateKey(scheme)
+	if err != nil {
+		return nil, nil, err
+	}
+	spki, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c := &Credential{
+		ValidTime: expiry.Sub(leaf.NotBefore).Truncate(time.Second),
+		Scheme:    scheme,
+		PublicKey: key.Public(),
+		Algorithm: algorithm,
+		rawSPKI:   spki,
+	}
+	digest, opts, err := hashed(algorithm, signedContent(leaf.Raw, c.marshalCredential(), algorithm))
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.Signature, err = signer.Sign(rand.Reader, digest, opts); err != nil {
+		return nil, nil, fmt.Errorf("sign delegated credential: %w", err)
+	}
+	c.Raw = c.marshal()
+	return c, key, nil
+}
+
+// Parse decodes a credential from its wire encoding
+func Parse(data []byte) (*Credential, error) {
+	errMalformed := errors.New("malformed delegated credential")
+	r := bytes.NewReader(data)
+	var hdr struct {
+		ValidTime uint32
+		Scheme    uint16
+	}
+	if err := binary.Read(r, binary.BigEndian, &hdr); err != nil {
+		return nil, errMalformed
+	}
+	var l [3]byte
+	if _, err := r.Read(l[:]); err != nil {
+		return nil, errMalformed
+	}
+	spki := make([]byte, int(l[0])<<16|int(l[1])<<8|int(l[2]))
+	if n, _ := r.Read(spki); n != len(spki) || len(spki) == 0 {
+		return nil, errMalformed
+	}
+	var sig struct {
+		Algorithm uint16
+		Length    uint16
+	}
+	if err := binary.Read(r, binary.BigEndian, &sig); err != nil {
+		return nil, errMalformed
+	}
+	signature := make([]byte, sig.Length)
+	if n, _ := r.Read(signature); n != len(signature) || r.Len() != 0 {
+		return nil, errMalformed
+	}
+	pub, err := x509.ParsePKIXPublicKey(spki)
+	if err != nil {
+		return nil, fmt.Errorf("delegated credential key: %w", err)
+	}
+	return &Credential{
+		ValidTime: time.Duration(hdr.ValidTime) * time.Second,
+		Scheme:    tls.SignatureScheme(hdr.Scheme),
+		PublicKey: pub,
+		Algorithm: tls.SignatureScheme(sig.Algorithm),
+		Signature: signature,
+		Raw:       append([]byte(nil), data...),
+		rawSPKI:   spki,
+	}, nil
+}
+
+// Verify checks that the credential was signed by leaf's key and is valid
+// at now, as a client would
+func (c *Credential) Verify(leaf *x509.Certificate, now time.Time) error {
+	if !AllowsDelegation(leaf) {
+		return ErrNoDelegationUsage
+	}
+	if now.After(c.Expiry(leaf)) {
+		return ErrExpired
+	}
+	if c.Expiry(leaf).Sub(now) > MaxValidity {
+		return fmt.Errorf("delegated credential valid for more than %v", MaxValidity)
+	}
+	content := signedContent(leaf.Raw, c.marshalCredential(), c.Algorithm)
+	digest, _, err := hashed(c.Algorithm, content)
+	if err != nil {
+		return err
+	}
+	switch pub := leaf.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(pub, digest, c.Signature) {
+			return errors.New("invalid delegated credential signature")
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(pub, content, c.Signature) {
+			return errors.New("invalid delegated credential signature")
+		}
+	case *rsa.PublicKey:
+		opts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256}
+		if err := rsa.VerifyPSS(pub, crypto.SHA256, digest, c.Signature, opts); err != nil {
+			return fmt.Errorf("invalid delegated credential signature: %w", err)
+		}
+	default:
+		return fmt.Errorf("unsupported certificate key %T", pub)
+	}
+	return nil
+}
+
+// marshalCredential encodes the Credential struct, the signed part
+func (c *Credential) marshalCredential() []byte {
+	var b bytes.Buffer
+	_ = binary.Write(&b, binary.BigEndian, uint32(c.ValidTime/time.Second))
+	_ = binary.Write(&b, binary.BigEndian, uint16(c.Scheme))
+	n := len(c.rawSPKI)
+	b.Write([]byte{byte(n >> 16), byte(n >> 8), byte(n)})
+	b.Write(c.rawSPKI)
+	return b.Bytes()
+}
+
+// marshal encodes the DelegatedCredential struct
+func (c *Credential) marshal() []byte {
+	b := bytes.NewBuffer(c.marshalCredential())
+	_ = binary.Write(b, binary.BigEndian, uint16(c.Algorithm))
+	_ = binary.Write(b, binary.BigEndian, uint16(len(c.Signature)))
+	b.Write(c.Signature)
+	return b.Bytes()
+}
+
+// signedContent is the input to the credential signature
+func signedContent(leafDER, credential []byte, algorithm tls.SignatureScheme) []byte {
+	var b bytes.Buffer
+	b.Write(bytes.Repeat([]byte{0x20}, 64))
+	b.WriteString(signatureContext)
+	b.WriteByte(0)
+	b.Write(leafDER)
+	b.Write(credential)
+	_ = binary.Write(&b, binary.BigEndian, uint16(algorithm))
+	return b.Bytes()
+}
+
+// schemeFor returns the TLS 1.3 signature scheme for a certificate key
+func schemeFor(pub crypto.PublicKey) (tls.SignatureScheme, error) {
+	switch pub := pub.(type) {
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256():
+			return tls.ECDSAWithP256AndSHA256, nil
+		case elliptic.P384():
+			return tls.ECDSAWithP384AndSHA384, nil
+		case elliptic.P521():
+			return tls.ECDSAWithP521AndSHA512, nil
+		}
+	case ed25519.PublicKey:
+		return tls.Ed25519, nil
+	case *rsa.PublicKey:
+		return tls.PSSWithSHA256, nil
+	}
+	return 0, fmt.Errorf("unsupported certificate key %T", pub)
+}
+
+// hashed returns what a crypto.Signer signs for algorithm over content
+func hashed(algorithm tls.SignatureScheme, content []byte) ([]byte, crypto.SignerOpts, error) {
+	switch algorithm {
+	case tls.ECDSAWithP256AndSHA256:
+		sum := sha256.Sum256(content)
+		return sum[:], crypto.SHA256, nil
+	case tls.ECDSAWithP384AndSHA384:
+		sum := sha512.Sum384(content)
+		return sum[:], crypto.SHA384, nil
+	case tls.ECDSAWithP521AndSHA512:
+		sum := sha512.Sum512(content)
+		return sum[:], crypto.SHA512, nil
+	case tls.PSSWithSHA256:
+		sum := sha256.Sum256(content)
+		return sum[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256}, nil
+	case tls.Ed25519:
+		return content, crypto.Hash(0), nil
+	}
+	return nil, nil, fmt.Errorf("unsupported signature scheme %v", algorithm)
+}
+
+// generateKey creates a delegated key for scheme
+func generateKey(scheme tls.SignatureScheme) (crypto.Signer, error) {
+	switch scheme {
+	case tls.ECDSAWithP256AndSHA256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case tls.ECDSAWithP384AndSHA384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case tls.Ed25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	}
+	return nil, fmt.Errorf("unsupported delegated credential scheme %v", scheme)
+}
+
+// ParseScheme converts a configured key type into a signature scheme
+func ParseScheme(name string) (tls.SignatureScheme, error) {
+	switch name {
+	case "", "p256", "ecdsa":
+		return tls.ECDSAWithP256AndSHA256, nil
+	case "p384":
+		return tls.ECDSAWithP384AndSHA384, nil
+	case "ed25519":
+		return tls.Ed25519, nil
+	}
+	return 0, fmt.Errorf("unsupported delegated credential key type %q", name)
+}
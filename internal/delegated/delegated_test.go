@@ -0,0 +1,132 @@
+package delegated
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tls-agent/pkg/agenttest"
+)
+
+// delegator returns a certificate template that allows delegation when
+// delegation is set
+func delegator(delegation bool) *x509.Certificate {
+	tmpl := &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "localhost"},
+		DNSNames: []string{"localhost"},
+		NotAfter: time.Now().Add(30 * 24 * time.Hour),
+		KeyUsage: x509.KeyUsageDigitalSignature,
+	}
+	if delegation {
+		tmpl.ExtraExtensions = []pkix.Extension{{Id: OIDDelegationUsage, Value: []byte{0x05, 0x00}}}
+	}
+	return tmpl
+}
+
+// TestIssue tests issuing, encoding and verifying credentials per certificate key type
+func TestIssue(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	now := time.Now()
+	for name, key := range map[string]crypto.Signer{"ecdsa": ecKey, "ed25519": edKey, "rsa": rsaKey} {
+		cert := agenttest.SelfSigned(t, delegator(true), key)
+		cred, dcKey, err := Issue(cert, tls.ECDSAWithP256AndSHA256, 8*time.Hour, now)
+		if err != nil {
+			t.Fatalf("%s: failed to issue: %v", name, err)
+		}
+		if !dcKey.Public().(*ecdsa.PublicKey).Equal(cred.PublicKey) {
+			t.Errorf("%s: credential does not carry the delegated key", name)
+		}
+
+		parsed, err := Parse(cred.Raw)
+		if err != nil {
+			t.Fatalf("%s: failed to parse: %v", name, err)
+		}
+		if err := parsed.Verify(cert.Leaf, now); err != nil {
+			t.Errorf("%s: failed to verify: %v", name, err)
+		}
+		if got := parsed.Expiry(cert.Leaf); got.Sub(now) > 8*time.Hour || now.Add(8*time.Hour).Sub(got) > time.Second {
+			t.Errorf("%s: expected expiry in 8h, got %v", name, got)
+		}
+		if err := parsed.Verify(cert.Leaf, now.Add(9*time.Hour)); !errors.Is(err, ErrExpired) {
+			t.Errorf("%s: expected an expired credential, got %v", name, err)
+		}
+
+		parsed.Signature[0] ^= 0xff
+		if err := parsed.Verify(cert.Leaf, now); err == nil {
+			t.Errorf("%s: expected a tampered signature to fail", name)
+		}
+	}
+}
+
+// TestIssueRejects tests certificates and lifetimes that cannot be delegated
+func TestIssueRejects(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if _, _, err := Issue(agenttest.SelfSigned(t, delegator(false), key), tls.Ed25519, time.Hour, time.Now()); !errors.Is(err, ErrNoDelegationUsage) {
+		t.Errorf("Expected ErrNoDelegationUsage, got %v", err)
+	}
+	if _, _, err := Issue(agenttest.SelfSigned(t, delegator(true), key), tls.Ed25519, 8*24*time.Hour, time.Now()); err == nil {
+		t.Error("Expected a validity over 7 days to be rejected")
+	}
+	if _, err := Parse([]byte{0, 0, 1}); err == nil {
+		t.Error("Expected a truncated credential to be rejected")
+	}
+}
+
+// TestRotator tests writing and rotating credentials
+func TestRotator(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	cert := agenttest.SelfSigned(t, delegator(true), key)
+	dir := t.TempDir()
+	now := time.Now()
+	r := &Rotator{
+		Certificate:    func() *tls.Certificate { return cert },
+		Scheme:         tls.Ed25519,
+		Validity:       4 * time.Hour,
+		CredentialFile: filepath.Join(dir, "dc.bin"),
+		KeyFile:        filepath.Join(dir, "dc.key"),
+		now:            func() time.Time { return now },
+	}
+
+	if reason := r.needsRotation(cert); reason != "no credential" {
+		t.Errorf("Expected a first credential to be due, got %q", reason)
+	}
+	if err := r.Rotate(); err != nil {
+		t.Fatalf("Failed to rotate: %v", err)
+	}
+	data, err := os.ReadFile(r.CredentialFile)
+	if err != nil {
+		t.Fatalf("Failed to read credential: %v", err)
+	}
+	cred, err := Parse(data)
+	if err != nil || cred.Verify(cert.Leaf, now) != nil {
+		t.Errorf("Expected a valid credential on disk (%v)", err)
+	}
+	if info, err := os.Stat(r.KeyFile); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the key file with 0600 permissions (%v)", err)
+	}
+
+	if reason := r.needsRotation(cert); reason != "" {
+		t.Errorf("Expected no rotation yet, got %q", reason)
+	}
+	now = now.Add(2*time.Hour + time.Minute)
+	if reason := r.needsRotation(cert); reason != "half of validity passed" {
+		t.Errorf("Expected rotation at half validity, got %q", reason)
+	}
+	if reason := r.needsRotation(agenttest.SelfSigned(t, delegator(true), key)); reason != "certificate changed" {
+		t.Errorf("Expected rotation for a new certificate, got %q", reason)
+	}
+}
@@ -0,0 +1,155 @@
+package delegated
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"tls-agent/internal/metrics"
+	"tls-agent/internal/notify"
+	"tls-agent/internal/tlsstore"
+)
+
+var (
+	issued = metrics.NewCounter("tls_agent_delegated_credentials_issued_total",
+		"Delegated credentials issued")
+	expiryGauge = metrics.NewGauge("tls_agent_delegated_credential_expiry_timestamp_seconds",
+		"Expiry of the current delegated credential as a Unix timestamp")
+)
+
+// checkInterval is how often Run checks whether to rotate
+const checkInterval = time.Minute
+
+// Rotator keeps a delegated credential for the served certificate on disk,
+// issuing a new one with a new key when half its validity has passed or
+// the certificate changes
+type Rotator struct {
+	// Certificate returns the served certificate
+	Certificate func() *tls.Certificate
+
+	// Scheme is the delegated key's signature scheme
+	Scheme tls.SignatureScheme
+
+	// Validity is each credential's lifetime, at most MaxValidity
+	Validity time.Duration
+
+	// CredentialFile receives the wire-encoded credential and KeyFile its
+	// PEM private key (0600)
+	CredentialFile string
+	KeyFile        string
+
+	now func() time.Time
+
+	mu      sync.Mutex
+	current *Credential
+	leaf    []byte
+}
+
+func (r *Rotator) clock() time.Time {
+	if r.now != nil {
+		return r.now()
+	}
+	return time.Now()
+}
+
+// Current returns the credential last issued, or nil
+func (r *Rotator) Current() *Credential {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+// needsRotation reports why a new credential is due, or ""
+func (r *Rotator) needsRotation(cert *tls.Certificate) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case r.current == nil:
+		return "no credential"
+	case string(r.leaf) != string(cert.Certificate[0]):
+		return "certificate changed"
+	}
+	leaf, err := x509.ParseCertificate(r.leaf)
+	if err != nil {
+		return "certificate unreadable"
+	}
+	if r.clock().After(r.current.Expiry(leaf).Add(-r.Validity / 2)) {
+		return "half of validity passed"
+	}
+	return ""
+}
+
+// Rotate issues a new credential and writes it out
+func (r *Rotator) Rotate() error {
+	cert := r.Certificate()
+	if cert == nil || len(cert.Certificate) == 0 {
+		return errors.New("delegated credentials: no certificate")
+	}
+	return r.rotate(cert)
+}
+
+func (r *Rotator) rotate(cert *tls.Certificate) error {
+	cred, key, err := Issue(cert, r.Scheme, r.Validity, r.clock())
+	if err != nil {
+		return err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	// The key goes first so a frontend reloading on the credential never
+	// pairs it with the previous key
+	if err := tlsstore.WriteKeyFile(r.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})); err != nil {
+		return err
+	}
+	if err := tlsstore.WriteFile(r.CredentialFile, cred.Raw, 0644); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.current = cred
+	r.leaf = cert.Certificate[0]
+	r.mu.Unlock()
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err == nil {
+		expiryGauge.Set(float64(cred.Expiry(leaf).Unix()))
+	}
+	issued.Inc()
+	return nil
+}
+
+// Run rotates when due until ctx is cancelled
+func (r *Rotator) Run(ctx context.Context) error {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		if cert := r.Certificate(); cert != nil && len(cert.Certificate) > 0 {
+			if reason := r.needsRotation(cert); reason != "" {
+				if err := r.rotate(cert); err != nil {
+					log.Printf("Delegated credentials: rotation (%s) failed: %v", reason, err)
+				} else {
+					log.Printf("Delegated credentials: issued new credential (%s)", reason)
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Notify issues a credential for a newly loaded certificate
+func (r *Rotator) Notify(_ context.Context, e notify.Event) error {
+	if e.Type != notify.EventReloadSucceeded {
+		return nil
+	}
+	return r.Rotate()
+}
@@ -0,0 +1,229 @@
+// Package deploy writes the served certificate to secondary locations after
+// every reload, for co-located software that cannot hot-reload from the
+// canonical path: separate PEM files, a combined PEM, a PKCS#12 bundle or a
+// Java KeyStore.
+package deploy
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"tls-agent/internal/backup"
+	"tls-agent/internal/notify"
+	"tls-agent/internal/tlsstore"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// Target formats
+const (
+	FormatPEM      = "pem"
+	FormatCombined = "combined"
+	FormatPKCS12   = "pkcs12"
+	FormatJKS      = "jks"
+)
+
+// DefaultAlias names the key entry in JKS keystores
+const DefaultAlias = "tls-agent"
+
+// ErrKeyNotExportable is returned for certificates whose private key cannot
+// be serialized, such as keys held by a remote signer
+var ErrKeyNotExportable = errors.New("deploy: private key cannot be exported")
+
+// Target is one secondary location and its format
+type Target struct {
+	Name   string
+	Format string
+
+	// CertFile, ChainFile, FullChainFile and KeyFile are written for the pem
+	// format; empty paths are skipped. The certificate files hold the leaf,
+	// the intermediates, and both.
+	CertFile      string
+	ChainFile     string
+	FullChainFile string
+	KeyFile       string
+
+	// Path is written for the combined, pkcs12 and jks formats
+	Path string
+
+	// Password protects pkcs12 and jks output
+	Password string
+
+	// Alias names the jks key entry; empty uses DefaultAlias
+	Alias string
+}
+
+// Write writes cert to the target. Files holding the private key are
+// created with 0600 permissions, others with 0644.
+func (t *Target) Write(cert *tls.Certificate) error {
+	if cert == nil || len(cert.Certificate) == 0 {
+		return errors.New("deploy: no certificate")
+	}
+	chain := make([]*x509.Certificate, len(cert.Certificate))
+	for i, der := range cert.Certificate {
+		c, err := x509.ParseCertificate(der)
+		if err != nil {
+			return fmt.Errorf("deploy: %w", err)
+		}
+		chain[i] = c
+	}
+
+	switch t.Format {
+	case FormatPEM:
+		return t.writePEM(cert, chain)
+	case FormatCombined:
+		key, err := keyPEM(cert)
+		if err != nil {
+			return err
+		}
+		return tlsstore.WriteKeyFile(t.Path, append(certsPEM(chain), key...))
+	case FormatPKCS12:
+		data, err := pkcs12.Modern.Encode(cert.PrivateKey, chain[0], chain[1:], t.Password)
+		if err != nil {
+			return fmt.Errorf("deploy: pkcs12: %w", err)
+		}
+		return tlsstore.WriteKeyFile(t.Path, data)
+	case FormatJKS:
+		pkcs8, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrKeyNotExportable, err)
+		}
+		alias := t.Alias
+		if alias == "" {
+			alias = DefaultAlias
+		}
+		data, err := encodeJKS(alias, pkcs8, chain, t.Password, time.Now())
+		if err != nil {
+			return fmt.Errorf("deploy: jks: %w", err)
+		}
+		return tlsstore.WriteKeyFile(t.Path, data)
+	}
+	return fmt.Errorf("deploy: unknown format %q", t.Format)
+}
+
+// Paths returns the files the target writes
+func (t *Target) Paths() []string {
+	if t.Format != FormatPEM {
+		return []string{t.Path}
+	}
+	var paths []string
+	for _, path := range []string{t.CertFile, t.ChainFile, t.FullChainFile, t.KeyFile} {
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// writePEM writes the configured PEM files. The key is written last so that
+// software watching it sees a matching certificate already in place.
+func (t *Target) writePEM(cert *tls.Certificate, chain []*x509.Certificate) error {
+	files := []struct {
+		path  string
+		certs []*x509.Certificate
+	}{
+		{t.CertFile, chain[:1]},
+		{t.ChainFile, chain[1:]},
+		{t.FullChainFile, chain},
+	}
+	for _, f := range files {
+		if f.path == "" {
+			continue
+		}
+		if err := tlsstore.WriteFile(f.path, certsPEM(f.certs), 0644); err != nil {
+			return err
+		}
+	}
+	if t.KeyFile == "" {
+		return nil
+	}
+	key, err := keyPEM(cert)
+	if err != nil {
+		return err
+	}
+	return tlsstore.WriteKeyFile(t.KeyFile, key)
+}
+
+func certsPEM(certs []*x509.Certificate) []byte {
+	var buf bytes.Buffer
+	for _, c := range certs {
+		pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})
+	}
+	return buf.Bytes()
+}
+
+func keyPEM(cert *tls.Certificate) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrKeyNotExportable, err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// Deployer writes the current certificate to every target. It implements
+// notify.Notifier and redeploys after every successful reload or rollback.
+type Deployer struct {
+	Targets []Target
+
+	// Current returns the certificate to deploy
+	Current func() *tls.Certificate
+
+	// Backups, when set, keeps a copy of each target's files before they are
+	// overwritten. A target whose backup fails is not written.
+	Backups *backup.Store
+
+	mu       sync.Mutex
+	deployed []byte // leaf of the last complete deployment
+}
+
+// Deploy writes the current certificate to every target unless it has
+// already been deployed. Every target is attempted even if one fails.
+func (d *Deployer) Deploy() error {
+	cert := d.Current()
+	if cert == nil || len(cert.Certificate) == 0 {
+		return errors.New("deploy: no certificate")
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if bytes.Equal(cert.Certificate[0], d.deployed) {
+		return nil
+	}
+
+	var errs []error
+	for i := range d.Targets {
+		t := &d.Targets[i]
+		if d.Backups != nil {
+			if _, _, err := d.Backups.Backup(t.Name, t.Paths()...); err != nil {
+				errs = append(errs, fmt.Errorf("target %s: %w", t.Name, err))
+				continue
+			}
+		}
+		if err := t.Write(cert); err != nil {
+			errs = append(errs, fmt.Errorf("target %s: %w", t.Name, err))
+			continue
+		}
+		log.Printf("Deploy: wrote certificate to target %s", t.Name)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	d.deployed = cert.Certificate[0]
+	return nil
+}
+
+// Notify redeploys after a successful reload
+func (d *Deployer) Notify(_ context.Context, e notify.Event) error {
+	if e.Type != notify.EventReloadSucceeded {
+		return nil
+	}
+	return d.Deploy()
+}
@@ -0,0 +1,254 @@
+package deploy
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"tls-agent/internal/backup"
+	"tls-agent/internal/notify"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// testChain returns a leaf certificate and key issued by a test CA, with
+// the CA as the chain's second certificate
+func testChain(t *testing.T) *tls.Certificate {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "deploy CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("Failed to create CA: %v", err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "www.example.com"},
+		DNSNames:     []string{"www.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("Failed to issue certificate: %v", err)
+	}
+	return &tls.Certificate{Certificate: [][]byte{der, caDER}, PrivateKey: key}
+}
+
+// pemBlocks returns the PEM block types in path
+func pemBlocks(t *testing.T, path string) []string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+	var types []string
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return types
+		}
+		types = append(types, block.Type)
+	}
+}
+
+func checkMode(t *testing.T, path string, want os.FileMode) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat %s: %v", path, err)
+	}
+	if info.Mode().Perm() != want {
+		t.Errorf("Expected %s to have mode %v, got %v", path, want, info.Mode().Perm())
+	}
+}
+
+// TestWritePEM tests the separate PEM files
+func TestWritePEM(t *testing.T) {
+	dir := t.TempDir()
+	target := &Target{
+		Name:          "nginx",
+		Format:        FormatPEM,
+		CertFile:      filepath.Join(dir, "cert.pem"),
+		ChainFile:     filepath.Join(dir, "chain.pem"),
+		FullChainFile: filepath.Join(dir, "fullchain.pem"),
+		KeyFile:       filepath.Join(dir, "key.pem"),
+	}
+	cert := testChain(t)
+	if err := target.Write(cert); err != nil {
+		t.Fatalf("Failed to write target: %v", err)
+	}
+
+	want := map[string]int{target.CertFile: 1, target.ChainFile: 1, target.FullChainFile: 2}
+	for path, n := range want {
+		if blocks := pemBlocks(t, path); len(blocks) != n {
+			t.Errorf("Expected %d certificates in %s, got %v", n, path, blocks)
+		}
+		checkMode(t, path, 0644)
+	}
+	checkMode(t, target.KeyFile, 0600)
+
+	if _, err := tls.LoadX509KeyPair(target.FullChainFile, target.KeyFile); err != nil {
+		t.Errorf("Expected a usable key pair, got %v", err)
+	}
+}
+
+// TestWriteCombined tests the single file holding chain and key
+func TestWriteCombined(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "haproxy.pem")
+	target := &Target{Name: "haproxy", Format: FormatCombined, Path: path}
+	if err := target.Write(testChain(t)); err != nil {
+		t.Fatalf("Failed to write target: %v", err)
+	}
+	blocks := pemBlocks(t, path)
+	if len(blocks) != 3 || blocks[0] != "CERTIFICATE" || blocks[2] != "PRIVATE KEY" {
+		t.Errorf("Expected leaf, CA and key, got %v", blocks)
+	}
+	checkMode(t, path, 0600)
+}
+
+// TestWritePKCS12 tests that the bundle decodes with its password
+func TestWritePKCS12(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.p12")
+	target := &Target{Name: "windows", Format: FormatPKCS12, Path: path, Password: "changeit"}
+	cert := testChain(t)
+	if err := target.Write(cert); err != nil {
+		t.Fatalf("Failed to write target: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read bundle: %v", err)
+	}
+	key, leaf, cas, err := pkcs12.DecodeChain(data, "changeit")
+	if err != nil {
+		t.Fatalf("Failed to decode bundle: %v", err)
+	}
+	if string(leaf.Raw) != string(cert.Certificate[0]) || len(cas) != 1 {
+		t.Error("Expected the leaf and its CA in the bundle")
+	}
+	if !key.(*ecdsa.PrivateKey).Equal(cert.PrivateKey) {
+		t.Error("Expected the private key in the bundle")
+	}
+}
+
+// signerOnly hides the concrete key type, like a remote signer
+type signerOnly struct{ crypto.Signer }
+
+// TestWriteErrors tests unknown formats and keys that cannot be exported
+func TestWriteErrors(t *testing.T) {
+	dir := t.TempDir()
+	cert := testChain(t)
+	if err := (&Target{Format: "der", Path: filepath.Join(dir, "x")}).Write(cert); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+
+	remote := &tls.Certificate{Certificate: cert.Certificate, PrivateKey: signerOnly{cert.PrivateKey.(crypto.Signer)}}
+	target := &Target{Format: FormatCombined, Path: filepath.Join(dir, "combined.pem")}
+	if err := target.Write(remote); !errors.Is(err, ErrKeyNotExportable) {
+		t.Errorf("Expected ErrKeyNotExportable, got %v", err)
+	}
+	if err := (&Target{Format: FormatJKS, Path: filepath.Join(dir, "ks.jks")}).Write(cert); err == nil {
+		t.Error("Expected an error for a JKS keystore without a password")
+	}
+}
+
+// TestDeployer tests that reloads redeploy only changed certificates
+func TestDeployer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "combined.pem")
+	cert := testChain(t)
+	d := &Deployer{
+		Targets: []Target{{Name: "combined", Format: FormatCombined, Path: path}},
+		Current: func() *tls.Certificate { return cert },
+	}
+	if err := d.Deploy(); err != nil {
+		t.Fatalf("Failed to deploy: %v", err)
+	}
+
+	os.Remove(path)
+	d.Notify(context.Background(), notify.Event{Type: notify.EventReloadSucceeded})
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Expected an unchanged certificate not to be redeployed")
+	}
+
+	cert = testChain(t)
+	d.Notify(context.Background(), notify.Event{Type: notify.EventReloadFailed})
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Expected failed reloads not to deploy")
+	}
+	if err := d.Notify(context.Background(), notify.Event{Type: notify.EventReloadSucceeded}); err != nil {
+		t.Fatalf("Failed to deploy: %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("Expected the new certificate to be deployed, got %v", err)
+	}
+}
+
+// TestDeployerBackups tests that the previous files are backed up before a
+// redeploy overwrites them
+func TestDeployerBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "combined.pem")
+	cert := testChain(t)
+	store := &backup.Store{Dir: t.TempDir(), Keep: 5}
+	d := &Deployer{
+		Targets: []Target{{Name: "combined", Format: FormatCombined, Path: path}},
+		Current: func() *tls.Certificate { return cert },
+		Backups: store,
+	}
+	if err := d.Deploy(); err != nil {
+		t.Fatalf("Failed to deploy: %v", err)
+	}
+	if snaps, _ := store.List("combined"); len(snaps) != 0 {
+		t.Errorf("Expected no backup of a missing file, got %d", len(snaps))
+	}
+	first, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+
+	cert = testChain(t)
+	if err := d.Deploy(); err != nil {
+		t.Fatalf("Failed to deploy: %v", err)
+	}
+	snaps, err := store.List("combined")
+	if err != nil || len(snaps) != 1 {
+		t.Fatalf("Expected one backup, got %d (%v)", len(snaps), err)
+	}
+	if _, err := store.Restore("combined", snaps[0].ID); err != nil {
+		t.Fatalf("Failed to restore: %v", err)
+	}
+	if restored, _ := os.ReadFile(path); string(restored) != string(first) {
+		t.Error("Expected the first certificate to be restored")
+	}
+}
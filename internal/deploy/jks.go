@@ -0,0 +1,114 @@
+package deploy
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// JKS constants from the format keytool reads and writes
+const (
+	jksMagic          = 0xFEEDFEED
+	jksVersion        = 2
+	jksPrivateKeyTag  = 1
+	jksIntegrityWhite = "Mighty Aphrodite"
+)
+
+// jksKeyProtector identifies Sun's proprietary key protection algorithm
+var jksKeyProtector = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 42, 2, 17, 1, 1}
+
+// encryptedPrivateKeyInfo is the PKCS#8 wrapper of a protected key
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+// encodeJKS returns a Java KeyStore holding one private key entry under
+// alias, with the key and the store both protected by password
+func encodeJKS(alias string, pkcs8 []byte, chain []*x509.Certificate, password string, created time.Time) ([]byte, error) {
+	if password == "" {
+		return nil, errors.New("a JKS keystore needs a password")
+	}
+	pass := passwordBytes(password)
+
+	protected, err := protectKey(pkcs8, pass)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	write := func(v any) { binary.Write(&buf, binary.BigEndian, v) }
+	write(uint32(jksMagic))
+	write(uint32(jksVersion))
+	write(uint32(1)) // entries
+
+	write(uint32(jksPrivateKeyTag))
+	writeUTF(&buf, strings.ToLower(alias)) // JKS aliases are case-insensitive
+	write(uint64(created.UnixMilli()))
+	write(uint32(len(protected)))
+	buf.Write(protected)
+	write(uint32(len(chain)))
+	for _, cert := range chain {
+		writeUTF(&buf, "X.509")
+		write(uint32(len(cert.Raw)))
+		buf.Write(cert.Raw)
+	}
+
+	// The integrity check covers the password, a fixed phrase and the store
+	digest := sha1.New()
+	digest.Write(pass)
+	digest.Write([]byte(jksIntegrityWhite))
+	digest.Write(buf.Bytes())
+	buf.Write(digest.Sum(nil))
+	return buf.Bytes(), nil
+}
+
+// protectKey applies the JKS key protector: the key is XORed with a SHA-1
+// keystream seeded by a random salt, followed by a SHA-1 check value
+func protectKey(pkcs8, pass []byte) ([]byte, error) {
+	salt := make([]byte, sha1.Size)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	encrypted := make([]byte, len(pkcs8))
+	block := salt
+	for i := 0; i < len(pkcs8); i += sha1.Size {
+		sum := sha1.Sum(append(append([]byte(nil), pass...), block...))
+		block = sum[:]
+		for j := 0; j < sha1.Size && i+j < len(pkcs8); j++ {
+			encrypted[i+j] = pkcs8[i+j] ^ block[j]
+		}
+	}
+	check := sha1.Sum(append(append([]byte(nil), pass...), pkcs8...))
+
+	data := append(append(salt, encrypted...), check[:]...)
+	return asn1.Marshal(encryptedPrivateKeyInfo{
+		Algorithm:     pkix.AlgorithmIdentifier{Algorithm: jksKeyProtector, Parameters: asn1.NullRawValue},
+		EncryptedData: data,
+	})
+}
+
+// passwordBytes encodes a password as Java does for keystores: UTF-16BE
+func passwordBytes(password string) []byte {
+	var out []byte
+	for _, u := range utf16.Encode([]rune(password)) {
+		out = append(out, byte(u>>8), byte(u))
+	}
+	return out
+}
+
+// writeUTF writes s as Java's DataOutput.writeUTF does. Aliases and type
+// names are ASCII in practice, where modified UTF-8 equals UTF-8.
+func writeUTF(buf *bytes.Buffer, s string) {
+	binary.Write(buf, binary.BigEndian, uint16(len(s)))
+	buf.WriteString(s)
+}
@@ -0,0 +1,124 @@
+package deploy
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// jksReader reads the subset of JKS written by encodeJKS
+type jksReader struct {
+	t    *testing.T
+	data *bytes.Reader
+}
+
+func (r *jksReader) uint32() uint32 {
+	var v uint32
+	if err := binary.Read(r.data, binary.BigEndian, &v); err != nil {
+		r.t.Fatalf("Failed to read keystore: %v", err)
+	}
+	return v
+}
+
+func (r *jksReader) bytes(n int) []byte {
+	b := make([]byte, n)
+	if _, err := r.data.Read(b); err != nil {
+		r.t.Fatalf("Failed to read keystore: %v", err)
+	}
+	return b
+}
+
+func (r *jksReader) utf() string {
+	var n uint16
+	binary.Read(r.data, binary.BigEndian, &n)
+	return string(r.bytes(int(n)))
+}
+
+// TestWriteJKS tests the keystore structure, the integrity check and that
+// the key can be recovered with the password
+func TestWriteJKS(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.jks")
+	target := &Target{Name: "tomcat", Format: FormatJKS, Path: path, Password: "changeit", Alias: "Tomcat"}
+	cert := testChain(t)
+	if err := target.Write(cert); err != nil {
+		t.Fatalf("Failed to write target: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read keystore: %v", err)
+	}
+
+	pass := passwordBytes("changeit")
+	body, sum := data[:len(data)-sha1.Size], data[len(data)-sha1.Size:]
+	digest := sha1.New()
+	digest.Write(pass)
+	digest.Write([]byte("Mighty Aphrodite"))
+	digest.Write(body)
+	if !bytes.Equal(digest.Sum(nil), sum) {
+		t.Fatal("Keystore integrity check failed")
+	}
+
+	r := &jksReader{t: t, data: bytes.NewReader(body)}
+	if magic, version, count := r.uint32(), r.uint32(), r.uint32(); magic != jksMagic || version != 2 || count != 1 {
+		t.Fatalf("Unexpected header %x %d %d", magic, version, count)
+	}
+	if tag := r.uint32(); tag != jksPrivateKeyTag {
+		t.Fatalf("Expected a private key entry, got tag %d", tag)
+	}
+	if alias := r.utf(); alias != "tomcat" {
+		t.Errorf("Expected the lower-cased alias, got %q", alias)
+	}
+	r.bytes(8) // creation time
+
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(r.bytes(int(r.uint32())), &info); err != nil {
+		t.Fatalf("Failed to parse protected key: %v", err)
+	}
+	if !info.Algorithm.Algorithm.Equal(jksKeyProtector) {
+		t.Errorf("Unexpected key protection algorithm %v", info.Algorithm.Algorithm)
+	}
+
+	// Reverse the key protector
+	enc := info.EncryptedData
+	salt, encrypted, check := enc[:sha1.Size], enc[sha1.Size:len(enc)-sha1.Size], enc[len(enc)-sha1.Size:]
+	plain := make([]byte, len(encrypted))
+	block := salt
+	for i := 0; i < len(encrypted); i += sha1.Size {
+		sum := sha1.Sum(append(append([]byte(nil), pass...), block...))
+		block = sum[:]
+		for j := 0; j < sha1.Size && i+j < len(encrypted); j++ {
+			plain[i+j] = encrypted[i+j] ^ block[j]
+		}
+	}
+	if want := sha1.Sum(append(append([]byte(nil), pass...), plain...)); !bytes.Equal(want[:], check) {
+		t.Fatal("Key check value does not match")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(plain)
+	if err != nil {
+		t.Fatalf("Failed to parse recovered key: %v", err)
+	}
+	if !cert.PrivateKey.(*ecdsa.PrivateKey).Equal(key) {
+		t.Error("Recovered key does not match")
+	}
+
+	if n := r.uint32(); n != 2 {
+		t.Fatalf("Expected a chain of 2 certificates, got %d", n)
+	}
+	for i := range 2 {
+		if typ := r.utf(); typ != "X.509" {
+			t.Errorf("Unexpected certificate type %q", typ)
+		}
+		if der := r.bytes(int(r.uint32())); !bytes.Equal(der, cert.Certificate[i]) {
+			t.Errorf("Certificate %d does not match", i)
+		}
+	}
+	if r.data.Len() != 0 {
+		t.Errorf("Unexpected %d trailing bytes", r.data.Len())
+	}
+}
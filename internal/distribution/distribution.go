@@ -0,0 +1,85 @@
+// Package distribution lets one agent act as the distribution point for the
+// certificates it manages. Peer agents authenticate with client certificates
+// and pull bundles, long-polling for changes, so a fleet rotates from a
+// single renewal point.
+package distribution
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+
+	"tls-agent/internal/tlsstore"
+)
+
+// DefaultName names the serving agent's default certificate; SNI
+// certificates are named by server name
+const DefaultName = "default"
+
+// ErrNoKey is returned when a certificate's private key cannot be exported,
+// as with keyless signing
+var ErrNoKey = errors.New("distribution: private key is not exportable")
+
+// ErrExportDisabled is returned for a bundle request when the server does
+// not export private keys
+var ErrExportDisabled = errors.New("distribution: private key export is disabled")
+
+// Bundle is a certificate and its key as transferred between agents
+type Bundle struct {
+	Name        string    `json:"name"`
+	Fingerprint string    `json:"fingerprint"`
+	NotAfter    time.Time `json:"not_after"`
+	CertPEM     string    `json:"cert_pem"`
+	KeyPEM      string    `json:"key_pem"`
+}
+
+// Fingerprint returns the hex SHA-256 of cert's leaf, or "" for an empty
+// certificate
+func Fingerprint(cert *tls.Certificate) string {
+	if cert == nil || len(cert.Certificate) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(cert.Certificate[0])
+	return hex.EncodeToString(sum[:])
+}
+
+// newBundle encodes cert and its private key
+func newBundle(name string, cert *tls.Certificate) (*Bundle, error) {
+	if cert == nil || len(cert.Certificate) == 0 {
+		return nil, fmt.Errorf("distribution: %s has no certificate", name)
+	}
+	if cert.PrivateKey == nil {
+		return nil, ErrNoKey
+	}
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNoKey, err)
+	}
+
+	b := &Bundle{
+		Name:        name,
+		Fingerprint: Fingerprint(cert),
+		KeyPEM:      string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key})),
+	}
+	for _, der := range cert.Certificate {
+		b.CertPEM += string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	}
+	if leaf, err := x509.ParseCertificate(cert.Certificate[0]); err == nil {
+		b.NotAfter = leaf.NotAfter
+	}
+	return b, nil
+}
+
+// Certificate decodes the bundle, checking that the key matches
+func (b *Bundle) Certificate() (*tls.Certificate, error) {
+	cert, err := tlsstore.LoadFromPEM([]byte(b.CertPEM), []byte(b.KeyPEM))
+	if err != nil {
+		return nil, fmt.Errorf("distribution: bundle %s: %w", b.Name, err)
+	}
+	return cert, nil
+}
@@ -0,0 +1,188 @@
+package distribution
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"tls-agent/pkg/agenttest"
+)
+
+// certs is a mutable set of served certificates
+type certs struct {
+	mu     sync.Mutex
+	byName map[string]*tls.Certificate
+}
+
+func (c *certs) set(name string, cert *tls.Certificate) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.byName[name] = cert
+}
+
+func (c *certs) lookup(name string) *tls.Certificate {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.byName[name]
+}
+
+func (c *certs) names() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var names []string
+	for name := range c.byName {
+		names = append(names, name)
+	}
+	return names
+}
+
+// startServer serves the certificates over mTLS and returns a client that
+// presents a certificate from the same CA. configure, if given, adjusts the
+// server before it starts.
+func startServer(t *testing.T, ca *agenttest.CA, served *certs, configure ...func(*Server)) (*httptest.Server, *http.Client) {
+	s := &Server{Lookup: served.lookup, Names: served.names, MaxWait: 200 * time.Millisecond, PollInterval: 10 * time.Millisecond}
+	for _, f := range configure {
+		f(s)
+	}
+	srv := httptest.NewUnstartedServer(s.Handler())
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{*ca.IssueTLS(t, "127.0.0.1")},
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		ClientCAs:    ca.Pool,
+	}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	client := srv.Client()
+	transport := client.Transport.(*http.Transport)
+	transport.TLSClientConfig.InsecureSkipVerify = true
+	transport.TLSClientConfig.Certificates = []tls.Certificate{*ca.IssueTLS(t, "peer-agent")}
+	return srv, client
+}
+
+// TestSourceFollowsServer tests that a source receives the initial
+// certificate and is notified of rotations
+func TestSourceFollowsServer(t *testing.T) {
+	ca := agenttest.NewCA(t)
+	served := &certs{byName: map[string]*tls.Certificate{DefaultName: ca.IssueTLS(t, "v1.example.com")}}
+	srv, client := startServer(t, ca, served)
+
+	source := &Source{URL: srv.URL, Name: DefaultName, Client: client}
+	cert, err := source.Load("", "")
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	if Fingerprint(cert) != Fingerprint(served.lookup(DefaultName)) {
+		t.Fatal("Expected the served certificate")
+	}
+
+	changes := make(chan struct{}, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		source.Run(ctx, func() { changes <- struct{}{} })
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// Let a wait time out with no change before rotating
+	time.Sleep(300 * time.Millisecond)
+	rotated := ca.IssueTLS(t, "v2.example.com")
+	served.set(DefaultName, rotated)
+
+	select {
+	case <-changes:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected a change notification")
+	}
+	if cert, _ := source.Load("", ""); Fingerprint(cert) != Fingerprint(rotated) {
+		t.Error("Expected Load to return the rotated certificate")
+	}
+}
+
+// TestServerRequiresClientCertificate tests that anonymous clients are refused
+func TestServerRequiresClientCertificate(t *testing.T) {
+	ca := agenttest.NewCA(t)
+	served := &certs{byName: map[string]*tls.Certificate{DefaultName: ca.IssueTLS(t, "a.example.com")}}
+	srv, _ := startServer(t, ca, served)
+
+	anonymous := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	resp, err := anonymous.Get(srv.URL + "/v1/certificates/default")
+	if err != nil {
+		t.Fatalf("Failed to request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401, got %d", resp.StatusCode)
+	}
+}
+
+// TestServerErrors tests unknown names and certificates without exportable keys
+func TestServerErrors(t *testing.T) {
+	ca := agenttest.NewCA(t)
+	keyless := ca.IssueTLS(t, "keyless.example.com")
+	keyless.PrivateKey = nil
+	served := &certs{byName: map[string]*tls.Certificate{"keyless.example.com": keyless}}
+	srv, client := startServer(t, ca, served)
+
+	for path, want := range map[string]int{
+		"/v1/certificates/missing":             http.StatusNotFound,
+		"/v1/certificates/keyless.example.com": http.StatusConflict,
+		"/v1/certificates":                     http.StatusOK,
+	} {
+		resp, err := client.Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("Failed to request %s: %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("%s: expected %d, got %d", path, want, resp.StatusCode)
+		}
+	}
+}
+
+// TestServerNoExport tests that only public data is served when key export
+// is disabled
+func TestServerNoExport(t *testing.T) {
+	ca := agenttest.NewCA(t)
+	keyless := ca.IssueTLS(t, "keyless.example.com")
+	keyless.PrivateKey = nil
+	served := &certs{byName: map[string]*tls.Certificate{
+		DefaultName:           ca.IssueTLS(t, "a.example.com"),
+		"keyless.example.com": keyless,
+	}}
+	srv, client := startServer(t, ca, served, func(s *Server) { s.NoExport = true })
+
+	resp, err := client.Get(srv.URL + "/v1/certificates/default")
+	if err != nil {
+		t.Fatalf("Failed to request: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden || strings.Contains(string(body), "PRIVATE KEY") {
+		t.Errorf("Expected 403 without key material, got %d %q", resp.StatusCode, body)
+	}
+
+	resp, err = client.Get(srv.URL + "/v1/certificates")
+	if err != nil {
+		t.Fatalf("Failed to list: %v", err)
+	}
+	defer resp.Body.Close()
+	var summaries []Summary
+	if err := json.NewDecoder(resp.Body).Decode(&summaries); err != nil {
+		t.Fatalf("Failed to decode listing: %v", err)
+	}
+	if len(summaries) != 2 {
+		t.Errorf("Expected both certificates listed, keyless included, got %+v", summaries)
+	}
+}
@@ -0,0 +1,151 @@
+package distribution
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"tls-agent/internal/tlsstore"
+)
+
+// Defaults for Server
+const (
+	DefaultMaxWait      = 60 * time.Second
+	DefaultPollInterval = time.Second
+)
+
+// Server serves bundles over HTTP. It must run behind a TLS listener that
+// verifies client certificates, since bundles include private keys; requests
+// without one are refused.
+//
+//	GET /v1/certificates         names and fingerprints of every certificate
+//	GET /v1/certificates/{name}  the bundle; with ?wait=<fingerprint> the
+//	                             request is held until the certificate differs
+//	                             from that fingerprint, or 304 after MaxWait
+type Server struct {
+	// Lookup returns the current certificate called name, or nil
+	Lookup func(name string) *tls.Certificate
+
+	// Names lists the certificates that can be looked up
+	Names func() []string
+
+	// MaxWait bounds how long a waiting request is held
+	MaxWait time.Duration
+
+	// PollInterval is how often a waiting request checks for a change
+	PollInterval time.Duration
+
+	// NoExport refuses bundle requests, so only the public listing is served
+	NoExport bool
+}
+
+// Summary describes one certificate in a listing
+type Summary struct {
+	Name        string    `json:"name"`
+	Fingerprint string    `json:"fingerprint"`
+	NotAfter    time.Time `json:"not_after"`
+}
+
+// Handler returns the HTTP handler serving bundles
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/certificates", s.list)
+	mux.HandleFunc("GET /v1/certificates/{name}", s.get)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+			http.Error(w, "client certificate required", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) list(w http.ResponseWriter, r *http.Request) {
+	summaries := []Summary{}
+	for _, name := range s.Names() {
+		cert := s.Lookup(name)
+		if cert == nil || len(cert.Certificate) == 0 {
+			continue
+		}
+		summary := Summary{Name: name, Fingerprint: Fingerprint(cert)}
+		if leaf, err := x509.ParseCertificate(cert.Certificate[0]); err == nil {
+			summary.NotAfter = leaf.NotAfter
+		}
+		summaries = append(summaries, summary)
+	}
+	writeJSON(w, summaries)
+}
+
+func (s *Server) get(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	client := r.TLS.PeerCertificates[0].Subject.CommonName
+	if s.NoExport {
+		tlsstore.AuditKey("export refused", name+" to "+client)
+		http.Error(w, ErrExportDisabled.Error(), http.StatusForbidden)
+		return
+	}
+	cert := s.Lookup(name)
+	if cert == nil {
+		http.Error(w, "unknown certificate", http.StatusNotFound)
+		return
+	}
+
+	if known := r.URL.Query().Get("wait"); known != "" && Fingerprint(cert) == known {
+		cert = s.waitForChange(r, name, known)
+		if cert == nil {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	b, err := newBundle(name, cert)
+	if errors.Is(err, ErrNoKey) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	tlsstore.AuditKey("exported", fmt.Sprintf("%s (%s) to %s", name, b.Fingerprint[:12], client))
+	writeJSON(w, b)
+}
+
+// waitForChange returns the certificate once its fingerprint differs from
+// known, or nil when MaxWait passes or the client goes away first
+func (s *Server) waitForChange(r *http.Request, name, known string) *tls.Certificate {
+	maxWait, interval := s.MaxWait, s.PollInterval
+	if maxWait <= 0 {
+		maxWait = DefaultMaxWait
+	}
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+
+	timeout := time.NewTimer(maxWait)
+	defer timeout.Stop()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if cert := s.Lookup(name); cert != nil && Fingerprint(cert) != known {
+				return cert
+			}
+		case <-timeout.C:
+			return nil
+		case <-r.Context().Done():
+			return nil
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,139 @@
+package distribution
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Retry bounds for a Source that cannot reach its server
+const (
+	minRetry = time.Second
+	maxRetry = time.Minute
+)
+
+// Source pulls one certificate from a distribution server. Load serves as
+// the agent's certificate loader, and Run subscribes to changes.
+type Source struct {
+	// URL is the base URL of the distribution server
+	URL string
+
+	// Name is the certificate to pull, DefaultName for the server's default
+	Name string
+
+	// Client must present a client certificate the server trusts. Its
+	// timeout, if any, must exceed the server's MaxWait.
+	Client *http.Client
+
+	mu      sync.Mutex
+	current *tls.Certificate
+}
+
+// Load returns the most recently received certificate, fetching it first if
+// none has been received. The file arguments are ignored so that Load can
+// stand in for a file loader.
+func (s *Source) Load(_, _ string) (*tls.Certificate, error) {
+	s.mu.Lock()
+	current := s.current
+	s.mu.Unlock()
+	if current != nil {
+		return current, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	cert, _, err := s.fetch(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	s.store(cert)
+	return cert, nil
+}
+
+// Run long-polls the server until ctx is cancelled, calling onChange after
+// each new certificate is received. Failures are logged and retried with
+// backoff.
+func (s *Source) Run(ctx context.Context, onChange func()) error {
+	retry := minRetry
+	for {
+		s.mu.Lock()
+		known := Fingerprint(s.current)
+		s.mu.Unlock()
+
+		cert, changed, err := s.fetch(ctx, known)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			log.Printf("Distribution: fetch of %s failed, retrying in %s: %v", s.Name, retry, err)
+			select {
+			case <-time.After(retry):
+			case <-ctx.Done():
+				return nil
+			}
+			retry = min(retry*2, maxRetry)
+			continue
+		}
+		retry = minRetry
+
+		if changed {
+			s.store(cert)
+			log.Printf("Distribution: received %s (%s)", s.Name, Fingerprint(cert)[:12])
+			onChange()
+		}
+	}
+}
+
+func (s *Source) store(cert *tls.Certificate) {
+	s.mu.Lock()
+	s.current = cert
+	s.mu.Unlock()
+}
+
+// fetch requests the bundle, waiting for a change from known if it is set.
+// It reports false when the server timed out with no change.
+func (s *Source) fetch(ctx context.Context, known string) (*tls.Certificate, bool, error) {
+	u := strings.TrimSuffix(s.URL, "/") + "/v1/certificates/" + url.PathEscape(s.Name)
+	if known != "" {
+		u += "?wait=" + url.QueryEscape(known)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return nil, false, nil
+	default:
+		return nil, false, fmt.Errorf("distribution: %s returned %s", u, resp.Status)
+	}
+
+	var b Bundle
+	if err := json.NewDecoder(resp.Body).Decode(&b); err != nil {
+		return nil, false, fmt.Errorf("distribution: decode %s: %w", s.Name, err)
+	}
+	cert, err := b.Certificate()
+	if err != nil {
+		return nil, false, err
+	}
+	return cert, true, nil
+}
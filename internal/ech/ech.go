@@ -0,0 +1,295 @@
+package ech
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"tls-agent/internal/tlsstore"
+	"tls-agent/internal/watch"
+)
+
+// HPKE identifiers used for generated ECH configs (RFC 9180)
+const (
+	echVersion      = 0xfe0d
+	kemX25519       = 0x0020
+	kdfHKDFSHA256   = 0x0001
+	aeadAES128GCM   = 0x0001
+	maxNameLength   = 0
+	defaultRetained = 2
+)
+
+// Key is a single ECH key pair together with its serialized ECHConfig
+type Key struct {
+	ConfigID   uint8     `json:"config_id"`
+	PublicName string    `json:"public_name"`
+	PrivateKey []byte    `json:"private_key"`
+	Config     []byte    `json:"config"`
+	Created    time.Time `json:"created"`
+}
+
+type keyFile struct {
+	Keys []Key `json:"keys"`
+}
+
+// Generate creates a new X25519 ECH key and its ECHConfig for publicName
+func Generate(configID uint8, publicName string) (*Key, error) {
+	if publicName == "" || len(publicName) > 255 {
+		return nil, fmt.Errorf("ech: invalid public name %q", publicName)
+	}
+
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Key{
+		ConfigID:   configID,
+		PublicName: publicName,
+		PrivateKey: priv.Bytes(),
+		Config:     marshalConfig(configID, publicName, priv.PublicKey().Bytes()),
+		Created:    time.Now(),
+	}, nil
+}
+
+// marshalConfig serializes an ECHConfig as described in the ECH draft (version 0xfe0d)
+func marshalConfig(configID uint8, publicName string, publicKey []byte) []byte {
+	var contents []byte
+	contents = append(contents, configID)
+	contents = binary.BigEndian.AppendUint16(contents, kemX25519)
+	contents = binary.BigEndian.AppendUint16(contents, uint16(len(publicKey)))
+	contents = append(contents, publicKey...)
+	contents = binary.BigEndian.AppendUint16(contents, 4) // one cipher suite
+	contents = binary.BigEndian.AppendUint16(contents, kdfHKDFSHA256)
+	contents = binary.BigEndian.AppendUint16(contents, aeadAES128GCM)
+	contents = append(contents, maxNameLength)
+	contents = append(contents, uint8(len(publicName)))
+	contents = append(contents, publicName...)
+	contents = binary.BigEndian.AppendUint16(contents, 0) // no extensions
+
+	config := binary.BigEndian.AppendUint16(nil, echVersion)
+	config = binary.BigEndian.AppendUint16(config, uint16(len(contents)))
+	return append(config, contents...)
+}
+
+// ConfigList serializes the given keys' configs as an ECHConfigList
+func ConfigList(keys ...Key) []byte {
+	var body []byte
+	for _, k := range keys {
+		body = append(body, k.Config...)
+	}
+	list := binary.BigEndian.AppendUint16(nil, uint16(len(body)))
+	return append(list, body...)
+}
+
+// HTTPSRecord renders a DNS HTTPS resource record publishing the ECHConfigList for host
+func HTTPSRecord(host string, configList []byte) string {
+	return fmt.Sprintf("%s. 300 IN HTTPS 1 . alpn=h2,http/1.1 ech=%s",
+		host, base64.StdEncoding.EncodeToString(configList))
+}
+
+// Manager owns the ECH keys on disk, rotates them, and serves them to tls.Config
+type Manager struct {
+	path       string
+	publicName string
+	retain     int
+
+	mu   sync.RWMutex
+	keys []Key
+
+	// written is the key file content Rotate last wrote, so the watcher can
+	// tell the manager's own writes from external changes
+	written []byte
+}
+
+// NewManager creates a manager persisting its keys to path
+func NewManager(path, publicName string) *Manager {
+	return &Manager{
+		path:       path,
+		publicName: publicName,
+		retain:     defaultRetained,
+	}
+}
+
+// LoadOrGenerate loads the key file, generating a first key if it does not exist
+func (m *Manager) LoadOrGenerate() error {
+	err := m.Reload()
+	if errors.Is(err, os.ErrNotExist) {
+		return m.Rotate()
+	}
+	return err
+}
+
+// Reload re-reads the key file and atomically replaces the active keys
+func (m *Manager) Reload() error {
+	_, err := m.reload()
+	return err
+}
+
+// reload is Reload reporting whether the keys changed; a file still holding
+// what Rotate last wrote is not reloaded
+func (m *Manager) reload() (bool, error) {
+	data, err := os.ReadFile(m.path)
+	if err != nil {
+		return false, err
+	}
+	m.mu.RLock()
+	own := m.written != nil && bytes.Equal(data, m.written)
+	m.mu.RUnlock()
+	if own {
+		return false, nil
+	}
+
+	var kf keyFile
+	if err := json.Unmarshal(data, &kf); err != nil {
+		return false, fmt.Errorf("ech: parse %s: %w", m.path, err)
+	}
+	if len(kf.Keys) == 0 {
+		return false, fmt.Errorf("ech: %s contains no keys", m.path)
+	}
+	for _, k := range kf.Keys {
+		if _, err := ecdh.X25519().NewPrivateKey(k.PrivateKey); err != nil {
+			return false, fmt.Errorf("ech: key %d: %w", k.ConfigID, err)
+		}
+	}
+
+	m.mu.Lock()
+	m.keys = kf.Keys
+	m.written = nil
+	m.mu.Unlock()
+	return true, nil
+}
+
+// Rotate generates a new primary key, retaining the previous ones so clients
+// holding a cached HTTPS record can still connect, and persists the result
+func (m *Manager) Rotate() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var nextID uint8
+	if len(m.keys) > 0 {
+		nextID = m.keys[0].ConfigID + 1
+	}
+
+	key, err := Generate(nextID, m.publicName)
+	if err != nil {
+		return err
+	}
+
+	keys := append([]Key{*key}, m.keys...)
+	if len(keys) > m.retain {
+		keys = keys[:m.retain]
+	}
+
+	data, err := writeKeyFile(m.path, keys)
+	if err != nil {
+		return err
+	}
+	m.keys = keys
+	m.written = data
+	return nil
+}
+
+// Keys returns the active keys, newest first
+func (m *Manager) Keys() []Key {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]Key(nil), m.keys...)
+}
+
+// GetEncryptedClientHelloKeys implements tls.Config.GetEncryptedClientHelloKeys.
+// Only the newest key is offered as a retry config.
+func (m *Manager) GetEncryptedClientHelloKeys(*tls.ClientHelloInfo) ([]tls.EncryptedClientHelloKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	out := make([]tls.EncryptedClientHelloKey, 0, len(m.keys))
+	for i, k := range m.keys {
+		out = append(out, tls.EncryptedClientHelloKey{
+			Config:      k.Config,
+			PrivateKey:  k.PrivateKey,
+			SendAsRetry: i == 0,
+		})
+	}
+	return out, nil
+}
+
+// ConfigList returns the ECHConfigList that should currently be published
+func (m *Manager) ConfigList() []byte {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if len(m.keys) == 0 {
+		return nil
+	}
+	return ConfigList(m.keys[0])
+}
+
+// WriteRecord writes the HTTPS record for host to path
+func (m *Manager) WriteRecord(path, host string) error {
+	record := HTTPSRecord(host, m.ConfigList())
+	return os.WriteFile(path, []byte(record+"\n"), 0644)
+}
+
+// Register reloads the key file from w whenever it changes on disk.
+// onChange, if set, is called after each reload that changed the keys; the
+// manager's own rotations are reported by Run instead.
+func (m *Manager) Register(w *watch.Watcher, onChange func()) error {
+	return w.Add("ECH keys", func() {
+		changed, err := m.reload()
+		if err != nil {
+			log.Println("ECH: reload failed:", err)
+			return
+		}
+		if changed && onChange != nil {
+			onChange()
+		}
+	}, m.path)
+}
+
+// Run rotates keys every rotateEvery until stopChan is closed. A zero
+// rotateEvery disables rotation.
+func (m *Manager) Run(rotateEvery time.Duration, onChange func(), stopChan <-chan struct{}) {
+	if rotateEvery <= 0 {
+		return
+	}
+	ticker := time.NewTicker(rotateEvery)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := m.Rotate(); err != nil {
+				log.Println("ECH: rotation failed:", err)
+				continue
+			}
+			log.Println("ECH: rotated keys")
+			if onChange != nil {
+				onChange()
+			}
+
+		case <-stopChan:
+			return
+		}
+	}
+}
+
+// writeKeyFile atomically writes keys to path with owner-only permissions and
+// returns the bytes it wrote
+func writeKeyFile(path string, keys []Key) ([]byte, error) {
+	data, err := json.MarshalIndent(keyFile{Keys: keys}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return data, tlsstore.WriteKeyFile(path, data)
+}
@@ -0,0 +1,151 @@
+package ech
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tls-agent/pkg/agenttest"
+)
+
+// TestGenerate tests ECH key and config generation
+func TestGenerate(t *testing.T) {
+	key, err := Generate(7, "public.example.com")
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	if len(key.PrivateKey) != 32 {
+		t.Errorf("Expected 32-byte X25519 private key, got %d", len(key.PrivateKey))
+	}
+	if key.Config[0] != 0xfe || key.Config[1] != 0x0d {
+		t.Errorf("Unexpected ECHConfig version: %x", key.Config[:2])
+	}
+	if key.Config[4] != 7 {
+		t.Errorf("Expected config id 7, got %d", key.Config[4])
+	}
+
+	if _, err := Generate(1, ""); err == nil {
+		t.Error("Empty public name should be rejected")
+	}
+}
+
+// TestHTTPSRecord tests DNS HTTPS record output
+func TestHTTPSRecord(t *testing.T) {
+	key, err := Generate(1, "public.example.com")
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	list := ConfigList(*key)
+	record := HTTPSRecord("example.com", list)
+
+	if !strings.HasPrefix(record, "example.com. ") || !strings.Contains(record, " HTTPS 1 . ") {
+		t.Errorf("Unexpected record format: %s", record)
+	}
+	if !strings.Contains(record, "ech="+base64.StdEncoding.EncodeToString(list)) {
+		t.Errorf("Record does not contain the ECHConfigList: %s", record)
+	}
+}
+
+// TestManagerRotateAndReload tests rotation, retention, and persistence
+func TestManagerRotateAndReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ech.json")
+	m := NewManager(path, "public.example.com")
+
+	if err := m.LoadOrGenerate(); err != nil {
+		t.Fatalf("LoadOrGenerate failed: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Key file not written: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected key file mode 0600, got %v", info.Mode().Perm())
+	}
+
+	first := m.Keys()[0]
+	for i := 0; i < 3; i++ {
+		if err := m.Rotate(); err != nil {
+			t.Fatalf("Rotate failed: %v", err)
+		}
+	}
+
+	keys := m.Keys()
+	if len(keys) != defaultRetained {
+		t.Fatalf("Expected %d retained keys, got %d", defaultRetained, len(keys))
+	}
+	if keys[0].ConfigID != first.ConfigID+3 {
+		t.Errorf("Expected newest config id %d, got %d", first.ConfigID+3, keys[0].ConfigID)
+	}
+
+	// A second manager must pick up the persisted keys
+	other := NewManager(path, "public.example.com")
+	if err := other.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if other.Keys()[0].ConfigID != keys[0].ConfigID {
+		t.Error("Reloaded manager does not see the rotated keys")
+	}
+
+	tlsKeys, _ := m.GetEncryptedClientHelloKeys(nil)
+	if !tlsKeys[0].SendAsRetry || tlsKeys[1].SendAsRetry {
+		t.Error("Only the newest key should be sent as retry config")
+	}
+
+	// The watcher sees the manager's own rotations as no change, and
+	// rotations written by another process as one
+	if changed, err := m.reload(); err != nil || changed {
+		t.Errorf("Expected the manager's own write not to count as a change, got %v %v", changed, err)
+	}
+	if err := other.Rotate(); err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	if changed, err := m.reload(); err != nil || !changed {
+		t.Errorf("Expected another writer's rotation to be reloaded, got %v %v", changed, err)
+	}
+	if m.Keys()[0].ConfigID != other.Keys()[0].ConfigID {
+		t.Error("Expected the other writer's key to be active")
+	}
+}
+
+// TestECHHandshake tests that generated keys are accepted by crypto/tls
+func TestECHHandshake(t *testing.T) {
+	m := NewManager(filepath.Join(t.TempDir(), "ech.json"), "public.example.com")
+	if err := m.LoadOrGenerate(); err != nil {
+		t.Fatalf("LoadOrGenerate failed: %v", err)
+	}
+
+	serverCfg := &tls.Config{
+		Certificates:                []tls.Certificate{*agenttest.NewCA(t).IssueTLS(t, "example.com", "public.example.com")},
+		GetEncryptedClientHelloKeys: m.GetEncryptedClientHelloKeys,
+	}
+	clientCfg := &tls.Config{
+		ServerName:                     "example.com",
+		InsecureSkipVerify:             true,
+		MinVersion:                     tls.VersionTLS13,
+		EncryptedClientHelloConfigList: m.ConfigList(),
+	}
+
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	go func() {
+		server := tls.Server(serverConn, serverCfg)
+		_ = server.Handshake()
+	}()
+
+	client := tls.Client(clientConn, clientCfg)
+	if err := client.Handshake(); err != nil {
+		t.Fatalf("Handshake failed: %v", err)
+	}
+	if !client.ConnectionState().ECHAccepted {
+		t.Error("Expected ECH to be accepted")
+	}
+}
@@ -33,6 +33,25 @@ type Features struct {
 	// HealthCheck enables a health check endpoint (future feature)
 	HealthCheck bool `json:"health_check" yaml:"health_check"`
 
+	// Dashboard serves an HTML certificate dashboard on the admin API
+	Dashboard bool `json:"dashboard" yaml:"dashboard"`
+
+	// Debug serves expvar (/debug/vars) and pprof (/debug/pprof/) on the
+	// admin API
+	Debug bool `json:"debug" yaml:"debug"`
+
+	// RecordFile, if set, records the watcher's file events and reload
+	// decisions to this file as JSON lines, for `tls-agent replay`
+	RecordFile string `json:"record_file" yaml:"record_file"`
+
+	// Chaos injects load failures, slow reads and watcher errors to test
+	// alerting and recovery. Never enable it in production.
+	Chaos ChaosConfig `json:"chaos" yaml:"chaos"`
+
+	// StrictConfig rejects config files containing unknown keys, so typos
+	// fail loudly instead of being ignored
+	StrictConfig bool `json:"strict_config" yaml:"strict_config"`
+
 	// ShutdownTimeout is the timeout duration for graceful shutdown in seconds
 	ShutdownTimeout int `json:"shutdown_timeout" yaml:"shutdown_timeout"`
 
@@ -47,6 +66,1202 @@ type Features struct {
 
 	// CertExpiryWarning is the days before expiry to warn about certificate
 	CertExpiryWarning int `json:"cert_expiry_warning" yaml:"cert_expiry_warning"`
+
+	// NotBeforeGrace is how many seconds a certificate's NotBefore may lie in
+	// the future (clock skew with the CA) and still be accepted
+	NotBeforeGrace int `json:"not_before_grace" yaml:"not_before_grace"`
+
+	// ExpiredCertificate decides what happens when the served certificate
+	// expires before a replacement arrives
+	ExpiredCertificate ExpiredCertificateConfig `json:"expired_certificate" yaml:"expired_certificate"`
+
+	// AIAChasing fetches missing intermediates via the certificate's AIA URL
+	AIAChasing bool `json:"aia_chasing" yaml:"aia_chasing"`
+
+	// AIACacheDir persists fetched intermediates across restarts
+	AIACacheDir string `json:"aia_cache_dir" yaml:"aia_cache_dir"`
+
+	// AdminAddress is the listen address of the admin API (metrics, health)
+	AdminAddress string `json:"admin_address" yaml:"admin_address"`
+
+	// AdminTLS serves the admin API over TLS with its own identity
+	AdminTLS AdminTLSConfig `json:"admin_tls" yaml:"admin_tls"`
+
+	// AdminAuth requires bearer tokens or client certificates on the admin
+	// API, with a reader or operator role
+	AdminAuth AdminAuthConfig `json:"admin_auth" yaml:"admin_auth"`
+
+	// TLS configures the public TLS listener
+	TLS ListenerTLSConfig `json:"tls" yaml:"tls"`
+
+	// HTTP2 configures HTTP/2 on the TLS listeners
+	HTTP2 HTTP2Config `json:"http2" yaml:"http2"`
+
+	// ConnectionFilter drops connections to the TLS listeners before the
+	// handshake by client address and per-client rate
+	ConnectionFilter ConnectionFilterConfig `json:"connection_filter" yaml:"connection_filter"`
+
+	// HandshakeLimits caps TLS handshake concurrency and rate on the TLS
+	// listeners
+	HandshakeLimits HandshakeLimitsConfig `json:"handshake_limits" yaml:"handshake_limits"`
+
+	// ConnectionRotation drains or closes TLS connections established
+	// before a certificate rotation
+	ConnectionRotation ConnectionRotationConfig `json:"connection_rotation" yaml:"connection_rotation"`
+
+	// ChainFile, if set, supplies the intermediates served with the primary
+	// certificate. It is watched on its own, so a CA re-issuing
+	// intermediates is picked up without a new leaf.
+	ChainFile string `json:"chain_file" yaml:"chain_file"`
+
+	// Certificates are additional certificate pairs served by SNI
+	Certificates []CertificatePair `json:"certificates" yaml:"certificates"`
+
+	// LoadWorkers bounds concurrent certificate loads at startup (0 = CPU count)
+	LoadWorkers int `json:"load_workers" yaml:"load_workers"`
+
+	// RetainedVersions is how many versions of the served certificate are
+	// kept for rollback through the admin API (0 = 10)
+	RetainedVersions int `json:"retained_versions" yaml:"retained_versions"`
+
+	// LoadTimeout is how many seconds a certificate load may take before it
+	// is abandoned and the reload fails (0 = no timeout)
+	LoadTimeout int `json:"load_timeout" yaml:"load_timeout"`
+
+	// MaxCertFileSize is the largest certificate, key or chain file read, in
+	// bytes (0 = 1 MiB)
+	MaxCertFileSize int `json:"max_cert_file_size" yaml:"max_cert_file_size"`
+
+	// ECH configures Encrypted ClientHello key management
+	ECH ECHConfig `json:"ech" yaml:"ech"`
+
+	// DelegatedCredentials issues short-lived delegated credentials from the
+	// served certificate for a TLS frontend that supports them
+	DelegatedCredentials DelegatedCredentialsConfig `json:"delegated_credentials" yaml:"delegated_credentials"`
+
+	// Keyless configures remote signing so the private key stays on key servers
+	Keyless KeylessConfig `json:"keyless" yaml:"keyless"`
+
+	// KeyPermissions configures key file permission and ownership checks
+	KeyPermissions KeyPermissionsConfig `json:"key_permissions" yaml:"key_permissions"`
+
+	// FIPS restricts TLS and certificates to FIPS-approved algorithms
+	FIPS FIPSConfig `json:"fips" yaml:"fips"`
+
+	// KeyAge enforces a maximum age on the served private key
+	KeyAge KeyAgeConfig `json:"key_age" yaml:"key_age"`
+
+	// KeyHygiene limits how long private keys live in memory and where they
+	// can leave the process
+	KeyHygiene KeyHygieneConfig `json:"key_hygiene" yaml:"key_hygiene"`
+
+	// Policy configures the acceptance policy evaluated before every reload
+	Policy PolicyConfig `json:"policy" yaml:"policy"`
+
+	// Notifications configures where alerts are delivered
+	Notifications NotificationsConfig `json:"notifications" yaml:"notifications"`
+
+	// Heartbeat reports agent status to an external monitor
+	Heartbeat HeartbeatConfig `json:"heartbeat" yaml:"heartbeat"`
+
+	// Statsd pushes metrics to a statsd or DogStatsD daemon
+	Statsd StatsdConfig `json:"statsd" yaml:"statsd"`
+
+	// CTMonitor configures certificate transparency monitoring for our domains
+	CTMonitor CTMonitorConfig `json:"ct_monitor" yaml:"ct_monitor"`
+
+	// TrustStore configures the hot-reloaded CA bundle used for peer verification
+	TrustStore TrustStoreConfig `json:"trust_store" yaml:"trust_store"`
+
+	// OCSP configures stapling and Must-Staple enforcement
+	OCSP OCSPConfig `json:"ocsp" yaml:"ocsp"`
+
+	// Authorization restricts routes to allowed client certificate identities
+	Authorization AuthorizationConfig `json:"authorization" yaml:"authorization"`
+
+	// Proxy configures reverse proxying to a backend
+	Proxy ProxyConfig `json:"proxy" yaml:"proxy"`
+
+	// AccessLog logs every request served on the TLS listeners
+	AccessLog AccessLogConfig `json:"access_log" yaml:"access_log"`
+
+	// RequestID assigns request IDs and W3C trace context to requests on
+	// the TLS listeners
+	RequestID RequestIDConfig `json:"request_id" yaml:"request_id"`
+
+	// Signals binds OS signals to agent actions
+	Signals SignalsConfig `json:"signals" yaml:"signals"`
+
+	// LogFile, if set, receives log output and is reopened on rotate_logs
+	LogFile string `json:"log_file" yaml:"log_file"`
+
+	// LeaderElection elects one replica to perform renewals
+	LeaderElection LeaderElectionConfig `json:"leader_election" yaml:"leader_election"`
+
+	// Distribution shares certificates between agents
+	Distribution DistributionConfig `json:"distribution" yaml:"distribution"`
+
+	// Management serves the gRPC management API
+	Management ManagementConfig `json:"management" yaml:"management"`
+
+	// Webhook serves a Kubernetes admission webhook
+	Webhook WebhookConfig `json:"webhook" yaml:"webhook"`
+
+	// Probe verifies reloaded certificates before they are served
+	Probe ProbeConfig `json:"probe" yaml:"probe"`
+
+	// Hooks run external commands on certificate events
+	Hooks []HookConfig `json:"hooks" yaml:"hooks"`
+
+	// DeployTargets receive a copy of the certificate after every reload
+	DeployTargets []DeployTargetConfig `json:"deploy_targets" yaml:"deploy_targets"`
+
+	// Backup keeps copies of files the agent overwrites
+	Backup BackupConfig `json:"backup" yaml:"backup"`
+
+	// Tenants are served alongside the main certificates, each with its own
+	// certificates, policy and admin token
+	Tenants []TenantConfig `json:"tenants" yaml:"tenants"`
+
+	// Storage is where cached OCSP responses, intermediates, CRLs and the
+	// reload history are kept
+	Storage StorageConfig `json:"storage" yaml:"storage"`
+
+	// ACME obtains and renews the primary certificate from an ACME CA
+	ACME ACMEConfig `json:"acme" yaml:"acme"`
+}
+
+// ACMEConfig configures issuance of the primary certificate from an ACME
+// CA. Challenges are answered with DNS-01 records, so wildcards and hosts
+// the CA cannot reach can be issued.
+type ACMEConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+
+	// DirectoryURL is the CA's ACME directory, or one of the short names
+	// letsencrypt, letsencrypt-staging, zerossl, google and google-staging;
+	// empty uses Let's Encrypt
+	DirectoryURL string `json:"directory_url" yaml:"directory_url"`
+
+	// CABundle verifies the directory's TLS certificate, for private CAs
+	// such as step-ca; empty uses the system roots
+	CABundle string `json:"ca_bundle" yaml:"ca_bundle"`
+
+	// EABKeyID and EABHMACKeyFile are the external account binding
+	// credentials issued by the CA; the file holds the base64url HMAC key
+	EABKeyID       string `json:"eab_key_id" yaml:"eab_key_id"`
+	EABHMACKeyFile string `json:"eab_hmac_key_file" yaml:"eab_hmac_key_file"`
+
+	// Email is the account contact address
+	Email string `json:"email" yaml:"email"`
+
+	// Domains are the certificate's names, wildcards included
+	Domains []string `json:"domains" yaml:"domains"`
+
+	// RenewBeforeDays is how many days before expiry to renew
+	RenewBeforeDays int `json:"renew_before_days" yaml:"renew_before_days"`
+
+	// CheckInterval is how many hours pass between renewal checks
+	CheckInterval int `json:"check_interval" yaml:"check_interval"`
+
+	// DNS publishes the DNS-01 challenge records
+	DNS ACMEDNSConfig `json:"dns" yaml:"dns"`
+}
+
+// DNS providers for ACME challenges
+const (
+	DNSCloudflare = "cloudflare"
+	DNSRoute53    = "route53"
+	DNSRFC2136    = "rfc2136"
+	DNSExec       = "exec"
+)
+
+// ACMEDNSConfig selects and configures the DNS provider
+type ACMEDNSConfig struct {
+	// Provider is "cloudflare", "route53", "rfc2136" or "exec"
+	Provider string `json:"provider" yaml:"provider"`
+
+	// PropagationTimeout is how many seconds to wait for a challenge record
+	// to become visible (0 = 120)
+	PropagationTimeout int `json:"propagation_timeout" yaml:"propagation_timeout"`
+
+	// ZoneID and APITokenFile configure the cloudflare provider
+	ZoneID       string `json:"zone_id" yaml:"zone_id"`
+	APITokenFile string `json:"api_token_file" yaml:"api_token_file"`
+
+	// HostedZoneID configures the route53 provider. Credentials come from
+	// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN.
+	HostedZoneID string `json:"hosted_zone_id" yaml:"hosted_zone_id"`
+
+	// Nameserver, Zone and the TSIG settings configure the rfc2136 provider
+	Nameserver     string `json:"nameserver" yaml:"nameserver"`
+	Zone           string `json:"zone" yaml:"zone"`
+	TSIGKey        string `json:"tsig_key" yaml:"tsig_key"`
+	TSIGAlgorithm  string `json:"tsig_algorithm" yaml:"tsig_algorithm"`
+	TSIGSecretFile string `json:"tsig_secret_file" yaml:"tsig_secret_file"`
+
+	// Command is run by the exec provider as
+	// `command... present|cleanup <fqdn> <value>`
+	Command []string `json:"command" yaml:"command"`
+}
+
+// DefaultACMEConfig returns the default (disabled) ACME configuration
+func DefaultACMEConfig() ACMEConfig {
+	return ACMEConfig{RenewBeforeDays: 30, CheckInterval: 12}
+}
+
+// Storage backends
+const (
+	StorageFS     = "fs"
+	StorageBolt   = "bolt"
+	StorageSQLite = "sqlite"
+)
+
+// StorageConfig selects the backend for state the agent persists
+type StorageConfig struct {
+	// Backend is "fs", "bolt" or "sqlite"
+	Backend string `json:"backend" yaml:"backend"`
+
+	// Path is the directory (fs) or database file (bolt, sqlite). Empty with
+	// the fs backend keeps the per-cache directories and does not persist
+	// the reload history.
+	Path string `json:"path" yaml:"path"`
+}
+
+// DefaultStorageConfig returns the default storage configuration
+func DefaultStorageConfig() StorageConfig {
+	return StorageConfig{Backend: StorageFS}
+}
+
+// TenantConfig is one logical tenant. Handshakes reach it by server name on
+// the shared listener or through its own listener.
+type TenantConfig struct {
+	Name string `json:"name" yaml:"name"`
+
+	// ServerNames route handshakes on the shared listener to the tenant
+	ServerNames []string `json:"server_names" yaml:"server_names"`
+
+	// Listen, if set, is a listener serving only this tenant
+	Listen string `json:"listen" yaml:"listen"`
+
+	// Certificates are the tenant's pairs; the first is also served to
+	// handshakes matching none of the pairs' names
+	Certificates []CertificatePair `json:"certificates" yaml:"certificates"`
+
+	// Policy is the tenant's acceptance policy
+	Policy PolicyConfig `json:"policy" yaml:"policy"`
+
+	// TokenFile holds the bearer token for the tenant's admin endpoints;
+	// empty leaves them open to anyone who can reach the admin API
+	TokenFile string `json:"token_file" yaml:"token_file"`
+
+	// CurvePreferences and PostQuantum configure key exchange on the
+	// tenant's listener; unset values inherit tls.curve_preferences and
+	// tls.post_quantum
+	CurvePreferences []string `json:"curve_preferences" yaml:"curve_preferences"`
+	PostQuantum      *bool    `json:"post_quantum" yaml:"post_quantum"`
+}
+
+// BackupConfig configures the backups taken before the agent overwrites a
+// certificate or key it wrote earlier
+type BackupConfig struct {
+	// Dir holds the backups; empty disables them
+	Dir string `json:"dir" yaml:"dir"`
+
+	// Keep is how many backups to keep per target; 0 keeps all
+	Keep int `json:"keep" yaml:"keep"`
+
+	// MaxAgeDays removes older backups; 0 keeps them regardless of age
+	MaxAgeDays int `json:"max_age_days" yaml:"max_age_days"`
+}
+
+// DefaultBackupConfig returns the default (disabled) backup configuration
+func DefaultBackupConfig() BackupConfig {
+	return BackupConfig{Keep: 5, MaxAgeDays: 90}
+}
+
+// DeployTargetConfig is a secondary location the served certificate is
+// written to, for software that cannot reload from the canonical path
+type DeployTargetConfig struct {
+	Name string `json:"name" yaml:"name"`
+
+	// Format is "pem", "combined", "pkcs12" or "jks"
+	Format string `json:"format" yaml:"format"`
+
+	// CertFile (leaf), ChainFile (intermediates), FullChainFile and KeyFile
+	// are written for the pem format; empty paths are skipped
+	CertFile      string `json:"cert_file" yaml:"cert_file"`
+	ChainFile     string `json:"chain_file" yaml:"chain_file"`
+	FullChainFile string `json:"full_chain_file" yaml:"full_chain_file"`
+	KeyFile       string `json:"key_file" yaml:"key_file"`
+
+	// Path is written for the combined, pkcs12 and jks formats
+	Path string `json:"path" yaml:"path"`
+
+	// PasswordFile holds the pkcs12 or jks password; required for jks
+	PasswordFile string `json:"password_file" yaml:"password_file"`
+
+	// Alias names the jks key entry (default "tls-agent")
+	Alias string `json:"alias" yaml:"alias"`
+}
+
+// HookConfig is a command run on certificate events. It receives the event
+// in TLS_AGENT_* environment variables.
+type HookConfig struct {
+	Name string `json:"name" yaml:"name"`
+
+	// Events lists event types: reload_succeeded, reload_failed,
+	// certificate_expiring, key_age_exceeded or policy_violation
+	Events []string `json:"events" yaml:"events"`
+
+	// Command is the program and its arguments; it is not run by a shell
+	Command []string `json:"command" yaml:"command"`
+
+	// Timeout is how many seconds the command may run (0 = 30)
+	Timeout int `json:"timeout" yaml:"timeout"`
+}
+
+// ProbeConfig configures the blue/green switch: a reloaded certificate is
+// served on a temporary green listener and must pass a verifying handshake
+// before it replaces the current one
+type ProbeConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+
+	// CABundle holds the roots clients trust; empty uses the system roots
+	CABundle string `json:"ca_bundle" yaml:"ca_bundle"`
+
+	// ServerName is the name clients verify; empty uses the certificate's
+	// first DNS name
+	ServerName string `json:"server_name" yaml:"server_name"`
+
+	// Listen is the green listener address; empty picks a loopback port
+	Listen string `json:"listen" yaml:"listen"`
+
+	// URL, if set, is dialed instead of the green listener and must route
+	// to it, e.g. through the load balancer clients use
+	URL string `json:"url" yaml:"url"`
+
+	// Timeout is the probe timeout in seconds
+	Timeout int `json:"timeout" yaml:"timeout"`
+}
+
+// DefaultProbeConfig returns the default (disabled) probe configuration
+func DefaultProbeConfig() ProbeConfig {
+	return ProbeConfig{Timeout: 5}
+}
+
+// WebhookConfig configures admission webhook mode: the proxy upstream is the
+// webhook handler, and the CA bundle Kubernetes uses to verify the serving
+// certificate is published on every rotation
+type WebhookConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+
+	// CAFile is the CA that issues the serving certificate; empty uses the
+	// CA certificates of the served chain
+	CAFile string `json:"ca_file" yaml:"ca_file"`
+
+	// CABundleFile, if set, receives the CA bundle as PEM
+	CABundleFile string `json:"ca_bundle_file" yaml:"ca_bundle_file"`
+
+	// MutatingConfigurations and ValidatingConfigurations name webhook
+	// configurations whose caBundle is patched through the Kubernetes API
+	MutatingConfigurations   []string `json:"mutating_configurations" yaml:"mutating_configurations"`
+	ValidatingConfigurations []string `json:"validating_configurations" yaml:"validating_configurations"`
+
+	// Webhooks limits patching to the named webhooks; empty patches every
+	// webhook in the listed configurations
+	Webhooks []string `json:"webhooks" yaml:"webhooks"`
+}
+
+// ManagementConfig configures the gRPC management API, served over mutual
+// TLS with the agent's own certificate
+type ManagementConfig struct {
+	Enabled bool   `json:"enabled" yaml:"enabled"`
+	Address string `json:"address" yaml:"address"`
+
+	// ClientCA is a PEM bundle of CAs that issue operator certificates
+	ClientCA string `json:"client_ca" yaml:"client_ca"`
+
+	// AllowedClients lists SAN patterns such as "dns:ops.example.com";
+	// empty allows any certificate ClientCA verifies
+	AllowedClients []string `json:"allowed_clients" yaml:"allowed_clients"`
+}
+
+// DefaultManagementConfig returns the default (disabled) management API
+// configuration
+func DefaultManagementConfig() ManagementConfig {
+	return ManagementConfig{Address: ":9444"}
+}
+
+// DistributionConfig configures serving managed certificates to peer agents
+// and pulling the served certificate from another agent
+type DistributionConfig struct {
+	Server DistributionServerConfig `json:"server" yaml:"server"`
+	Remote RemoteSourceConfig       `json:"remote" yaml:"remote"`
+}
+
+// DistributionServerConfig configures the mTLS endpoint serving this agent's
+// certificates and keys to peers
+type DistributionServerConfig struct {
+	Enabled bool   `json:"enabled" yaml:"enabled"`
+	Address string `json:"address" yaml:"address"`
+
+	// ClientCA is a PEM bundle of CAs that issue peer agent certificates
+	ClientCA string `json:"client_ca" yaml:"client_ca"`
+
+	// AllowedClients lists SAN patterns such as "dns:*.agents.example.com";
+	// empty allows any certificate ClientCA verifies
+	AllowedClients []string `json:"allowed_clients" yaml:"allowed_clients"`
+}
+
+// RemoteSourceConfig pulls the served certificate from a distribution server
+// instead of loading it from files
+type RemoteSourceConfig struct {
+	// URL is the distribution server, e.g. https://certs.internal:9443;
+	// empty loads certificates from files
+	URL string `json:"url" yaml:"url"`
+
+	// Name is the certificate to pull: "default" or an SNI server name
+	Name string `json:"name" yaml:"name"`
+
+	// CertFile and KeyFile are the client certificate presented to the server
+	CertFile string `json:"cert_file" yaml:"cert_file"`
+	KeyFile  string `json:"key_file" yaml:"key_file"`
+
+	// CABundle verifies the server and is reloaded when it changes; empty
+	// uses the system roots
+	CABundle string `json:"ca_bundle" yaml:"ca_bundle"`
+
+	// Pins are SPKI pins ("sha256/<base64>"); the server chain must contain
+	// a pinned key
+	Pins []string `json:"pins" yaml:"pins"`
+}
+
+// DefaultDistributionConfig returns distribution settings with both roles
+// disabled
+func DefaultDistributionConfig() DistributionConfig {
+	return DistributionConfig{
+		Server: DistributionServerConfig{Address: ":9443"},
+		Remote: RemoteSourceConfig{Name: "default"},
+	}
+}
+
+// LeaderElectionConfig configures leader election among replicas that share
+// renewal duties. Every replica watches and serves; only the leader renews.
+type LeaderElectionConfig struct {
+	// Backend is "kubernetes" (a Lease object), "file" (an exclusive file
+	// lock), or empty to disable election so that every instance leads
+	Backend string `json:"backend" yaml:"backend"`
+
+	// LeaseName is the Lease object for the kubernetes backend
+	LeaseName string `json:"lease_name" yaml:"lease_name"`
+
+	// LockFile is the lock path for the file backend
+	LockFile string `json:"lock_file" yaml:"lock_file"`
+
+	// LeaseDuration is how many seconds leadership lasts without renewal
+	LeaseDuration int `json:"lease_duration" yaml:"lease_duration"`
+
+	// RetryPeriod is how many seconds pass between renewal attempts
+	RetryPeriod int `json:"retry_period" yaml:"retry_period"`
+}
+
+// DefaultLeaderElectionConfig returns leader election settings with election
+// disabled
+func DefaultLeaderElectionConfig() LeaderElectionConfig {
+	return LeaderElectionConfig{
+		LeaseName:     "tls-agent",
+		LockFile:      "tls-agent.lock",
+		LeaseDuration: 15,
+		RetryPeriod:   2,
+	}
+}
+
+// SignalsConfig lists the signals bound to each action by name (e.g. SIGHUP).
+// An empty list keeps the default binding; a signal may serve one action only.
+type SignalsConfig struct {
+	Shutdown     []string `json:"shutdown" yaml:"shutdown"`
+	ReloadConfig []string `json:"reload_config" yaml:"reload_config"`
+	ReloadCerts  []string `json:"reload_certs" yaml:"reload_certs"`
+	RotateLogs   []string `json:"rotate_logs" yaml:"rotate_logs"`
+}
+
+// ProxyConfig configures TLS termination in front of a backend
+type ProxyConfig struct {
+	// Upstream is the backend URL; empty serves locally instead of proxying
+	Upstream string `json:"upstream" yaml:"upstream"`
+
+	// Headers name the client identity headers sent to the backend
+	Headers ClientIdentityHeaders `json:"headers" yaml:"headers"`
+
+	// TLS controls trust in an https upstream
+	TLS UpstreamTLSConfig `json:"tls" yaml:"tls"`
+}
+
+// UpstreamTLSConfig controls how the agent verifies a server it dials
+type UpstreamTLSConfig struct {
+	// CABundle verifies the server and is reloaded when it changes; empty
+	// uses the system roots
+	CABundle string `json:"ca_bundle" yaml:"ca_bundle"`
+
+	// Pins are SPKI pins ("sha256/<base64>"); the server chain must contain
+	// a pinned key. Pinning an issuing CA survives leaf rotations.
+	Pins []string `json:"pins" yaml:"pins"`
+}
+
+// ClientIdentityHeaders names the forwarded client identity headers; an empty name disables one
+type ClientIdentityHeaders struct {
+	Subject     string `json:"subject" yaml:"subject"`
+	SANs        string `json:"sans" yaml:"sans"`
+	Fingerprint string `json:"fingerprint" yaml:"fingerprint"`
+	Verify      string `json:"verify" yaml:"verify"`
+	XFCC        string `json:"xfcc" yaml:"xfcc"`
+}
+
+// DefaultProxyConfig returns the proxy defaults with conventional header names
+func DefaultProxyConfig() ProxyConfig {
+	return ProxyConfig{
+		Headers: ClientIdentityHeaders{
+			Subject:     "X-Client-Subject",
+			SANs:        "X-Client-SANs",
+			Fingerprint: "X-Client-Fingerprint",
+			Verify:      "X-Client-Verify",
+			XFCC:        "X-Forwarded-Client-Cert",
+		},
+	}
+}
+
+// AccessLogConfig configures structured per-request access logs
+type AccessLogConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+
+	// Path receives one JSON object per line and is reopened on
+	// rotate_logs; empty writes to the agent log
+	Path string `json:"path" yaml:"path"`
+
+	// SampleRate is the fraction of successful requests logged (0 to 1)
+	SampleRate float64 `json:"sample_rate" yaml:"sample_rate"`
+
+	// ErrorsOnly logs only requests answered with status 400 and above
+	ErrorsOnly bool `json:"errors_only" yaml:"errors_only"`
+}
+
+// DefaultAccessLogConfig returns the access log defaults: disabled, and
+// logging every request once enabled
+func DefaultAccessLogConfig() AccessLogConfig {
+	return AccessLogConfig{SampleRate: 1}
+}
+
+// RequestIDConfig configures request ID and traceparent propagation
+type RequestIDConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+
+	// Header carries the request ID to the backend and in the response
+	Header string `json:"header" yaml:"header"`
+
+	// TrustIncoming keeps request IDs and traceparents sent by clients
+	// instead of always starting new ones
+	TrustIncoming bool `json:"trust_incoming" yaml:"trust_incoming"`
+}
+
+// DefaultRequestIDConfig returns the request ID defaults
+func DefaultRequestIDConfig() RequestIDConfig {
+	return RequestIDConfig{Header: "X-Request-ID", TrustIncoming: true}
+}
+
+// AdminTLSConfig configures TLS on the admin API. Its certificate and client
+// CA are separate from the public listener's, so either can be rotated or
+// revoked without touching the other.
+type AdminTLSConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+
+	// CertFile and KeyFile are the admin listener's pair, reloaded when the
+	// files change; empty serves the public certificate
+	CertFile string `json:"cert_file" yaml:"cert_file"`
+	KeyFile  string `json:"key_file" yaml:"key_file"`
+
+	// ClientCA, if set, verifies client certificates against this bundle,
+	// reloaded when it changes. Certificates stay optional so token-only
+	// callers can connect.
+	ClientCA string `json:"client_ca" yaml:"client_ca"`
+
+	// CurvePreferences and PostQuantum configure key exchange on the admin
+	// listener; unset values inherit tls.curve_preferences and
+	// tls.post_quantum
+	CurvePreferences []string `json:"curve_preferences" yaml:"curve_preferences"`
+	PostQuantum      *bool    `json:"post_quantum" yaml:"post_quantum"`
+}
+
+// AdminAuthConfig configures admin API authentication. Readers may use GET
+// and HEAD; operators may also reload, roll back and restore.
+type AdminAuthConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+
+	// Tokens are bearer tokens, each read from a file
+	Tokens []AdminTokenConfig `json:"tokens" yaml:"tokens"`
+
+	// Clients grant roles to client certificate identities verified by
+	// admin_tls.client_ca
+	Clients []AdminClientConfig `json:"clients" yaml:"clients"`
+
+	// OperatorPaths are path prefixes that need the operator role even to read
+	OperatorPaths []string `json:"operator_paths" yaml:"operator_paths"`
+
+	// PublicPaths are path prefixes served without authentication
+	PublicPaths []string `json:"public_paths" yaml:"public_paths"`
+}
+
+// AdminTokenConfig is one admin API bearer token
+type AdminTokenConfig struct {
+	// Name identifies the token in audit logs
+	Name string `json:"name" yaml:"name"`
+
+	// TokenFile holds the token
+	TokenFile string `json:"token_file" yaml:"token_file"`
+
+	// Role is "reader" or "operator"
+	Role string `json:"role" yaml:"role"`
+}
+
+// AdminClientConfig grants Role to client certificates matching Allow
+type AdminClientConfig struct {
+	// Allow lists SAN patterns such as "dns:ops.example.com" or "uri:spiffe://example.com/ns/ops/*"
+	Allow []string `json:"allow" yaml:"allow"`
+
+	// Role is "reader" or "operator"
+	Role string `json:"role" yaml:"role"`
+}
+
+// DefaultAdminAuthConfig returns the admin authentication defaults: pprof
+// needs an operator and health probes stay open
+func DefaultAdminAuthConfig() AdminAuthConfig {
+	return AdminAuthConfig{
+		OperatorPaths: []string{"/debug/"},
+		PublicPaths:   []string{"/healthz"},
+	}
+}
+
+// AuthorizationConfig configures SAN-based client authorization
+type AuthorizationConfig struct {
+	// Rules map route prefixes to allowed identities; an empty path covers the listener
+	Rules []AuthorizationRule `json:"rules" yaml:"rules"`
+}
+
+// AuthorizationRule allows identities matching Allow on routes under Path
+type AuthorizationRule struct {
+	// Path is the route prefix the rule applies to
+	Path string `json:"path" yaml:"path"`
+
+	// Allow lists SAN patterns such as "dns:*.example.com" or "uri:spiffe://example.com/ns/*"
+	Allow []string `json:"allow" yaml:"allow"`
+}
+
+// OCSPConfig configures OCSP stapling
+type OCSPConfig struct {
+	// Stapling fetches and staples OCSP responses for served certificates
+	Stapling bool `json:"stapling" yaml:"stapling"`
+
+	// MustStaple is "enforce" (refuse to serve Must-Staple certs without a
+	// fresh staple) or "warn" (serve anyway and log)
+	MustStaple string `json:"must_staple" yaml:"must_staple"`
+
+	// RefreshInterval is how often staples are checked for refresh, in minutes
+	RefreshInterval int `json:"refresh_interval" yaml:"refresh_interval"`
+
+	// CacheDir persists OCSP responses so restarts reuse valid staples
+	CacheDir string `json:"cache_dir" yaml:"cache_dir"`
+}
+
+// CertificatePair is a certificate/key pair served for the given server names
+type CertificatePair struct {
+	CertFile string `json:"cert_file" yaml:"cert_file"`
+
+	// KeyFile may be omitted when CertFile is a combined PEM file holding
+	// the key, leaf and intermediates
+	KeyFile string `json:"key_file" yaml:"key_file"`
+
+	// ChainFile, if set, supplies the intermediates in place of any in
+	// CertFile and is watched on its own
+	ChainFile string `json:"chain_file" yaml:"chain_file"`
+
+	// Names are the SNI names to serve; empty uses the certificate's DNS SANs
+	Names []string `json:"names" yaml:"names"`
+}
+
+// TrustStoreConfig configures the root/intermediate CA bundle
+type TrustStoreConfig struct {
+	// CABundle is a PEM file of trusted CAs; it is watched and reloaded on change
+	CABundle string `json:"ca_bundle" yaml:"ca_bundle"`
+
+	// ClientAuth is "none", "request" (verify if presented), or "require"
+	ClientAuth string `json:"client_auth" yaml:"client_auth"`
+
+	// CRLCheck rejects client certificates listed on their issuer's CRL
+	CRLCheck bool `json:"crl_check" yaml:"crl_check"`
+
+	// CRLHardFail rejects client certificates whose CRL cannot be fetched
+	CRLHardFail bool `json:"crl_hard_fail" yaml:"crl_hard_fail"`
+
+	// CRLRefreshInterval is how often cached CRLs are refreshed, in minutes
+	CRLRefreshInterval int `json:"crl_refresh_interval" yaml:"crl_refresh_interval"`
+
+	// CRLCacheDir persists downloaded CRLs across restarts
+	CRLCacheDir string `json:"crl_cache_dir" yaml:"crl_cache_dir"`
+}
+
+// CTMonitorConfig configures the CT log monitor
+type CTMonitorConfig struct {
+	// Enabled turns on periodic CT log polling
+	Enabled bool `json:"enabled" yaml:"enabled"`
+
+	// Domains are the domains to watch (subdomains included)
+	Domains []string `json:"domains" yaml:"domains"`
+
+	// AllowedIssuers are substrings of the issuer DN that are expected
+	AllowedIssuers []string `json:"allowed_issuers" yaml:"allowed_issuers"`
+
+	// ExpectedNames are SAN patterns (e.g. *.example.com); empty means each domain and its wildcard
+	ExpectedNames []string `json:"expected_names" yaml:"expected_names"`
+
+	// PollInterval is the polling interval in minutes
+	PollInterval int `json:"poll_interval" yaml:"poll_interval"`
+
+	// Endpoint overrides the crt.sh search endpoint
+	Endpoint string `json:"endpoint" yaml:"endpoint"`
+}
+
+// PolicyConfig configures certificate acceptance rules. Zero values disable a rule.
+type PolicyConfig struct {
+	// MinRSABits is the minimum RSA key size
+	MinRSABits int `json:"min_rsa_bits" yaml:"min_rsa_bits"`
+
+	// MinECDSABits is the minimum ECDSA key size
+	MinECDSABits int `json:"min_ecdsa_bits" yaml:"min_ecdsa_bits"`
+
+	// AllowedSignatureAlgorithms lists accepted signature algorithms (e.g. SHA256-RSA, ECDSA-SHA256)
+	AllowedSignatureAlgorithms []string `json:"allowed_signature_algorithms" yaml:"allowed_signature_algorithms"`
+
+	// RequiredSANs must all appear in the certificate
+	RequiredSANs []string `json:"required_sans" yaml:"required_sans"`
+
+	// MaxValidityDays is the maximum certificate lifetime in days
+	MaxValidityDays int `json:"max_validity_days" yaml:"max_validity_days"`
+
+	// RequiredIssuer must match the issuer common name or organization
+	RequiredIssuer string `json:"required_issuer" yaml:"required_issuer"`
+}
+
+// NotificationsConfig configures alert delivery
+type NotificationsConfig struct {
+	// WebhookURL receives alerts as JSON POSTs; alerts are always logged
+	WebhookURL string `json:"webhook_url" yaml:"webhook_url" redact:"true"`
+
+	// WebhookTLS controls trust in an https webhook
+	WebhookTLS UpstreamTLSConfig `json:"webhook_tls" yaml:"webhook_tls"`
+
+	// Kubernetes records alerts as Events on the agent's pod when running
+	// in-cluster
+	Kubernetes KubernetesNotificationsConfig `json:"kubernetes" yaml:"kubernetes"`
+}
+
+// HeartbeatConfig configures periodic status reports to an external
+// monitor, so a silent agent death is detected when they stop
+type HeartbeatConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+
+	// URL receives the status as a JSON POST
+	URL string `json:"url" yaml:"url" redact:"true"`
+
+	// FailURL receives it instead while the agent is unhealthy, as
+	// healthchecks.io's ".../fail" endpoint expects
+	FailURL string `json:"fail_url" yaml:"fail_url" redact:"true"`
+
+	// Interval is how many seconds apart heartbeats are sent
+	Interval int `json:"interval" yaml:"interval"`
+
+	// TLS controls trust in https heartbeat URLs
+	TLS UpstreamTLSConfig `json:"tls" yaml:"tls"`
+}
+
+// DefaultHeartbeatConfig returns the heartbeat defaults
+func DefaultHeartbeatConfig() HeartbeatConfig {
+	return HeartbeatConfig{Interval: 60}
+}
+
+// StatsdConfig configures pushing metrics over UDP for deployments without
+// Prometheus scraping. It exports the same metrics as /metrics.
+type StatsdConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+
+	// Address is the daemon's host:port
+	Address string `json:"address" yaml:"address"`
+
+	// Format is "statsd" (labels folded into the name) or "dogstatsd"
+	// (labels sent as tags)
+	Format string `json:"format" yaml:"format"`
+
+	// Prefix is prepended to every metric name
+	Prefix string `json:"prefix" yaml:"prefix"`
+
+	// Tags are "key:value" tags added to every metric (dogstatsd only)
+	Tags []string `json:"tags" yaml:"tags"`
+
+	// Interval is how many seconds apart metrics are flushed
+	Interval int `json:"interval" yaml:"interval"`
+}
+
+// DefaultStatsdConfig returns the statsd defaults
+func DefaultStatsdConfig() StatsdConfig {
+	return StatsdConfig{Address: "127.0.0.1:8125", Format: "statsd", Interval: 10}
+}
+
+// KubernetesNotificationsConfig configures Kubernetes Events and annotations.
+// The service account needs create on events, plus get and patch on pods for
+// annotations and for resolving the pod UID when POD_UID is not set.
+type KubernetesNotificationsConfig struct {
+	// Events emits an Event on the pod for reloads, failures and policy
+	// violations
+	Events bool `json:"events" yaml:"events"`
+
+	// Annotate records the last reload and certificate fingerprint as pod
+	// annotations
+	Annotate bool `json:"annotate" yaml:"annotate"`
+}
+
+// KeyPermissionsConfig configures checks run on the key file at every load
+type KeyPermissionsConfig struct {
+	// Policy is "enforce" (refuse to load), "warn" (log only), or "off"
+	Policy string `json:"policy" yaml:"policy"`
+
+	// Owner is the expected key file owner (user name or uid); empty skips the check
+	Owner string `json:"owner" yaml:"owner"`
+}
+
+// FIPSConfig configures the FIPS/strict-crypto mode for regulated
+// deployments
+type FIPSConfig struct {
+	// Enabled limits the TLS listeners to approved versions, cipher suites
+	// and key exchanges, and rejects certificates with small keys or SHA-1
+	// signatures
+	Enabled bool `json:"enabled" yaml:"enabled"`
+
+	// RequireModule refuses to start unless Go's FIPS 140-3 module is
+	// enabled (GODEBUG=fips140=on), which also restricts TLS 1.3 suites
+	RequireModule bool `json:"require_module" yaml:"require_module"`
+}
+
+// KeyAgeConfig configures the maximum key age policy. A key's age counts
+// from when the agent first saw it, or its certificate's issuance if
+// earlier, and carries over renewals that reuse the key.
+type KeyAgeConfig struct {
+	// MaxAge is the maximum key age in days (0 disables the policy)
+	MaxAge int `json:"max_age" yaml:"max_age"`
+
+	// Action past MaxAge is "warn" (alert once per key) or "reissue" (also
+	// order a certificate with a new key; needs acme)
+	Action string `json:"action" yaml:"action"`
+
+	// CheckInterval is how many minutes pass between checks
+	CheckInterval int `json:"check_interval" yaml:"check_interval"`
+}
+
+// DefaultKeyAgeConfig returns the default key age policy, which is disabled
+func DefaultKeyAgeConfig() KeyAgeConfig {
+	return KeyAgeConfig{Action: "warn", CheckInterval: 60}
+}
+
+// ExpiredCertificateConfig configures the handling of an expired certificate
+type ExpiredCertificateConfig struct {
+	// Mode is "serve" to keep serving it with warnings for Grace, or
+	// "fail-closed" to refuse handshakes and report unhealthy at once
+	Mode string `json:"mode" yaml:"mode"`
+
+	// Grace is how many hours "serve" keeps serving after expiry before
+	// failing closed; 0 serves indefinitely
+	Grace int `json:"grace" yaml:"grace"`
+}
+
+// DefaultExpiredCertificateConfig returns the default expired certificate
+// handling, which keeps serving
+func DefaultExpiredCertificateConfig() ExpiredCertificateConfig {
+	return ExpiredCertificateConfig{Mode: "serve"}
+}
+
+// ChaosConfig configures fault injection. Rates are probabilities between
+// 0 and 1.
+type ChaosConfig struct {
+	// Enabled turns fault injection on
+	Enabled bool `json:"enabled" yaml:"enabled"`
+
+	// LoadFailureRate is the chance that a certificate load fails
+	LoadFailureRate float64 `json:"load_failure_rate" yaml:"load_failure_rate"`
+
+	// SlowReadRate is the chance that a load is delayed by SlowReadDelay
+	// milliseconds
+	SlowReadRate  float64 `json:"slow_read_rate" yaml:"slow_read_rate"`
+	SlowReadDelay int     `json:"slow_read_delay" yaml:"slow_read_delay"`
+
+	// WatcherErrorRate is the chance each second of a watcher error
+	WatcherErrorRate float64 `json:"watcher_error_rate" yaml:"watcher_error_rate"`
+
+	// Seed makes the injected faults reproducible (0 = random)
+	Seed uint64 `json:"seed" yaml:"seed"`
+}
+
+// DefaultChaosConfig returns the default fault injection settings, which
+// inject nothing
+func DefaultChaosConfig() ChaosConfig {
+	return ChaosConfig{SlowReadDelay: 5000}
+}
+
+// KeyHygieneConfig configures the handling of private key material
+type KeyHygieneConfig struct {
+	// Zeroize overwrites a certificate's private key in memory once a reload
+	// retires it and it is no longer kept for rollback
+	Zeroize bool `json:"zeroize" yaml:"zeroize"`
+
+	// ZeroizeDelay is how many seconds handshakes already using a retired
+	// key have to finish
+	ZeroizeDelay int `json:"zeroize_delay" yaml:"zeroize_delay"`
+
+	// NoExport keeps private keys out of every API response; only public
+	// certificate data is served
+	NoExport bool `json:"no_export" yaml:"no_export"`
+
+	// AdminKeyExport lets operators export private keys from the admin
+	// API's /export endpoint. It needs admin_auth, and every export is
+	// audited.
+	AdminKeyExport bool `json:"admin_key_export" yaml:"admin_key_export"`
+}
+
+// DefaultKeyHygieneConfig returns the default key hygiene settings
+func DefaultKeyHygieneConfig() KeyHygieneConfig {
+	return KeyHygieneConfig{Zeroize: true, ZeroizeDelay: 30}
+}
+
+// KeylessConfig configures the remote keyless signing backend
+type KeylessConfig struct {
+	// Enabled loads only the certificate locally and signs handshakes remotely
+	Enabled bool `json:"enabled" yaml:"enabled"`
+
+	// Servers are key server base URLs, tried in order with failover
+	Servers []string `json:"servers" yaml:"servers"`
+
+	// Timeout is the per-request signing timeout in milliseconds
+	Timeout int `json:"timeout" yaml:"timeout"`
+
+	// CertFile and KeyFile are the client certificate presented to the key
+	// servers
+	CertFile string `json:"cert_file" yaml:"cert_file"`
+	KeyFile  string `json:"key_file" yaml:"key_file"`
+
+	// CABundle verifies the key servers and is reloaded when it changes;
+	// empty uses the system roots
+	CABundle string `json:"ca_bundle" yaml:"ca_bundle"`
+
+	// Pins are SPKI pins ("sha256/<base64>"); the key server chain must
+	// contain a pinned key
+	Pins []string `json:"pins" yaml:"pins"`
+}
+
+// ListenerTLSConfig holds per-listener TLS handshake settings
+type ListenerTLSConfig struct {
+	// CurvePreferences lists key exchanges by name (e.g. X25519MLKEM768, X25519, P256).
+	// Empty means Go's defaults.
+	CurvePreferences []string `json:"curve_preferences" yaml:"curve_preferences"`
+
+	// PostQuantum enables hybrid post-quantum key exchange (X25519MLKEM768)
+	PostQuantum bool `json:"post_quantum" yaml:"post_quantum"`
+
+	// ALPN lists the application protocols advertised, most preferred
+	// first. Empty advertises h2 (when HTTP/2 is enabled) and http/1.1.
+	ALPN []string `json:"alpn" yaml:"alpn"`
+
+	// ClientPolicies vary client authentication and cipher policy per
+	// connection; the first policy matching a handshake applies
+	ClientPolicies []ClientPolicyConfig `json:"client_policies" yaml:"client_policies"`
+}
+
+// ConnectionFilterConfig configures accept-time filtering on the TLS
+// listeners. The zero value filters nothing.
+type ConnectionFilterConfig struct {
+	// Allow, if not empty, admits only these CIDRs or addresses
+	Allow []string `json:"allow" yaml:"allow"`
+
+	// Deny rejects these CIDRs or addresses, even when allowed
+	Deny []string `json:"deny" yaml:"deny"`
+
+	// RatePerIP is how many connections per second one client address may
+	// open (0 = unlimited), with bursts up to BurstPerIP
+	RatePerIP  float64 `json:"rate_per_ip" yaml:"rate_per_ip"`
+	BurstPerIP int     `json:"burst_per_ip" yaml:"burst_per_ip"`
+}
+
+// HandshakeLimitsConfig bounds the TLS handshakes the listeners perform so
+// scans and reconnect storms cannot exhaust CPU. The zero value is
+// unlimited.
+type HandshakeLimitsConfig struct {
+	// MaxConcurrent caps handshakes running at once (0 = unlimited)
+	MaxConcurrent int `json:"max_concurrent" yaml:"max_concurrent"`
+
+	// Rate is how many handshakes per second may start across all TLS
+	// listeners (0 = unlimited), with bursts up to Burst
+	Rate  float64 `json:"rate" yaml:"rate"`
+	Burst int     `json:"burst" yaml:"burst"`
+
+	// RatePerIP and BurstPerIP limit handshakes from one client address
+	RatePerIP  float64 `json:"rate_per_ip" yaml:"rate_per_ip"`
+	BurstPerIP int     `json:"burst_per_ip" yaml:"burst_per_ip"`
+
+	// Overflow is what happens to connections arriving while
+	// MaxConcurrent handshakes are running: "queue" (default) or "reject"
+	Overflow string `json:"overflow" yaml:"overflow"`
+
+	// QueueTimeout is how many seconds a queued connection waits (0 = 5)
+	QueueTimeout int `json:"queue_timeout" yaml:"queue_timeout"`
+
+	// Timeout is how many seconds a handshake may take (0 = 10)
+	Timeout int `json:"timeout" yaml:"timeout"`
+}
+
+// Enabled reports whether any limit is configured
+func (h HandshakeLimitsConfig) Enabled() bool {
+	return h.MaxConcurrent > 0 || h.Rate > 0 || h.RatePerIP > 0
+}
+
+// ConnectionRotationConfig is the policy for connections that outlive a
+// certificate rotation
+type ConnectionRotationConfig struct {
+	// Mode is "never" (default) to keep them, "drain" to close each once
+	// idle, or "close" to close them when the grace period ends
+	Mode string `json:"mode" yaml:"mode"`
+
+	// GracePeriod is how many seconds older connections may live after a
+	// rotation; 0 drains without a deadline, or closes at once
+	GracePeriod int `json:"grace_period" yaml:"grace_period"`
+}
+
+// ClientPolicyConfig is the TLS settings for connections matching its
+// server names and source networks, so public and mTLS traffic can share
+// a port. Empty server_names or sources match anything.
+type ClientPolicyConfig struct {
+	Name string `json:"name" yaml:"name"`
+
+	// ServerNames are SNI names, exact or wildcard
+	ServerNames []string `json:"server_names" yaml:"server_names"`
+
+	// Sources are client CIDRs or addresses
+	Sources []string `json:"sources" yaml:"sources"`
+
+	// ClientAuth is "none", "request" or "require"
+	ClientAuth string `json:"client_auth" yaml:"client_auth"`
+
+	// CABundle verifies client certificates; empty uses trust_store.ca_bundle
+	CABundle string `json:"ca_bundle" yaml:"ca_bundle"`
+
+	// MinVersion is "1.2" or "1.3"; empty keeps the listener's
+	MinVersion string `json:"min_version" yaml:"min_version"`
+
+	// CipherSuites are TLS 1.2 suite names; empty keeps Go's defaults
+	CipherSuites []string `json:"cipher_suites" yaml:"cipher_suites"`
+}
+
+// KeyExchange returns the curve names and post-quantum toggle of a listener
+// that overrides c with names and postQuantum, inheriting whichever is unset
+func (c ListenerTLSConfig) KeyExchange(names []string, postQuantum *bool) ([]string, bool) {
+	if len(names) == 0 {
+		names = c.CurvePreferences
+	}
+	if postQuantum == nil {
+		return names, c.PostQuantum
+	}
+	return names, *postQuantum
+}
+
+// DefaultListenerTLSConfig returns the default listener TLS settings
+func DefaultListenerTLSConfig() ListenerTLSConfig {
+	return ListenerTLSConfig{
+		PostQuantum: true,
+	}
+}
+
+// HTTP2Config configures HTTP/2 on the TLS listeners
+type HTTP2Config struct {
+	// Enabled negotiates HTTP/2 with clients that offer it
+	Enabled bool `json:"enabled" yaml:"enabled"`
+
+	// MaxConcurrentStreams caps open streams per connection (0 = Go's default)
+	MaxConcurrentStreams int `json:"max_concurrent_streams" yaml:"max_concurrent_streams"`
+
+	// IdleTimeout is how many seconds an idle connection, HTTP/1.1 or
+	// HTTP/2, is kept open (0 = no limit)
+	IdleTimeout int `json:"idle_timeout" yaml:"idle_timeout"`
+}
+
+// DefaultHTTP2Config returns the HTTP/2 defaults
+func DefaultHTTP2Config() HTTP2Config {
+	return HTTP2Config{Enabled: true}
+}
+
+// ECHConfig configures generation, rotation, and publication of ECH keys
+type ECHConfig struct {
+	// Enabled turns on ECH for the TLS listener
+	Enabled bool `json:"enabled" yaml:"enabled"`
+
+	// KeyFile is where ECH keys are persisted (written with 0600 permissions)
+	KeyFile string `json:"key_file" yaml:"key_file"`
+
+	// PublicName is the outer SNI clients use when ECH is negotiated
+	PublicName string `json:"public_name" yaml:"public_name"`
+
+	// Domain is the name the DNS HTTPS record is published for
+	Domain string `json:"domain" yaml:"domain"`
+
+	// RecordFile, if set, receives the HTTPS record after every key change
+	RecordFile string `json:"record_file" yaml:"record_file"`
+
+	// RotationInterval is the key rotation interval in hours (0 disables rotation)
+	RotationInterval int `json:"rotation_interval" yaml:"rotation_interval"`
+}
+
+// DefaultECHConfig returns the default (disabled) ECH configuration
+func DefaultECHConfig() ECHConfig {
+	return ECHConfig{
+		Enabled:          false,
+		KeyFile:          "certs/ech.json",
+		PublicName:       "localhost",
+		Domain:           "localhost",
+		RotationInterval: 24,
+	}
+}
+
+// DelegatedCredentialsConfig configures issuing and rotating RFC 9345
+// delegated credentials. The certificate must carry the DelegationUsage
+// extension. Go's TLS stack cannot serve them, so they are written to
+// files for a frontend that can.
+type DelegatedCredentialsConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+
+	// KeyType is the delegated key: p256 (default), p384 or ed25519
+	KeyType string `json:"key_type" yaml:"key_type"`
+
+	// Validity is each credential's lifetime in hours (at most 168); a new
+	// one is issued when half of it has passed
+	Validity int `json:"validity" yaml:"validity"`
+
+	// CredentialFile receives the encoded credential and KeyFile its
+	// private key (0600)
+	CredentialFile string `json:"credential_file" yaml:"credential_file"`
+	KeyFile        string `json:"key_file" yaml:"key_file"`
+}
+
+// DefaultDelegatedCredentialsConfig returns the delegated credential defaults
+func DefaultDelegatedCredentialsConfig() DelegatedCredentialsConfig {
+	return DelegatedCredentialsConfig{
+		KeyType:        "p256",
+		Validity:       24,
+		CredentialFile: "certs/dc.bin",
+		KeyFile:        "certs/dc.key",
+	}
 }
 
 // DefaultFeatures returns the default feature configuration with all features enabled
@@ -59,11 +1274,45 @@ func DefaultFeatures() Features {
 		Logging:              true,
 		MetricsCollection:    false, // Disabled by default (future feature)
 		HealthCheck:          false, // Disabled by default (future feature)
+		Dashboard:            false,
+		Debug:                false,
+		StrictConfig:         false,
 		ShutdownTimeout:      10,
 		AgentShutdownTimeout: 5,
 		CertWatchInterval:    30,
 		DebounceInterval:     2000, // 2 seconds in milliseconds
 		CertExpiryWarning:    7,    // 7 days
+		NotBeforeGrace:       300,
+		LoadTimeout:          30,
+		AIAChasing:           true,
+		AIACacheDir:          "certs/.aia-cache",
+		AdminAddress:         "127.0.0.1:9090",
+		AdminAuth:            DefaultAdminAuthConfig(),
+		TLS:                  DefaultListenerTLSConfig(),
+		HTTP2:                DefaultHTTP2Config(),
+		ECH:                  DefaultECHConfig(),
+		DelegatedCredentials: DefaultDelegatedCredentialsConfig(),
+		LeaderElection:       DefaultLeaderElectionConfig(),
+		Distribution:         DefaultDistributionConfig(),
+		Management:           DefaultManagementConfig(),
+		Probe:                DefaultProbeConfig(),
+		Backup:               DefaultBackupConfig(),
+		Storage:              DefaultStorageConfig(),
+		ACME:                 DefaultACMEConfig(),
+		Keyless:              KeylessConfig{Timeout: 2000},
+		KeyPermissions:       KeyPermissionsConfig{Policy: "warn"},
+		KeyAge:               DefaultKeyAgeConfig(),
+		KeyHygiene:           DefaultKeyHygieneConfig(),
+		ExpiredCertificate:   DefaultExpiredCertificateConfig(),
+		Chaos:                DefaultChaosConfig(),
+		CTMonitor:            CTMonitorConfig{PollInterval: 60},
+		TrustStore:           TrustStoreConfig{ClientAuth: "none", CRLRefreshInterval: 60, CRLCacheDir: "certs/.crl-cache"},
+		Proxy:                DefaultProxyConfig(),
+		AccessLog:            DefaultAccessLogConfig(),
+		RequestID:            DefaultRequestIDConfig(),
+		Heartbeat:            DefaultHeartbeatConfig(),
+		Statsd:               DefaultStatsdConfig(),
+		OCSP:                 OCSPConfig{Stapling: true, MustStaple: "enforce", RefreshInterval: 5, CacheDir: "certs/.ocsp-cache"},
 	}
 }
 
@@ -77,11 +1326,45 @@ func MinimalFeatures() Features {
 		Logging:              true,
 		MetricsCollection:    false,
 		HealthCheck:          false,
+		Dashboard:            false,
+		Debug:                false,
+		StrictConfig:         false,
 		ShutdownTimeout:      5,
 		AgentShutdownTimeout: 2,
 		CertWatchInterval:    60,
 		DebounceInterval:     1000,
 		CertExpiryWarning:    14,
+		NotBeforeGrace:       300,
+		LoadTimeout:          30,
+		AIAChasing:           false,
+		AIACacheDir:          "certs/.aia-cache",
+		AdminAddress:         "127.0.0.1:9090",
+		AdminAuth:            DefaultAdminAuthConfig(),
+		TLS:                  DefaultListenerTLSConfig(),
+		HTTP2:                DefaultHTTP2Config(),
+		ECH:                  DefaultECHConfig(),
+		DelegatedCredentials: DefaultDelegatedCredentialsConfig(),
+		LeaderElection:       DefaultLeaderElectionConfig(),
+		Distribution:         DefaultDistributionConfig(),
+		Management:           DefaultManagementConfig(),
+		Probe:                DefaultProbeConfig(),
+		Backup:               DefaultBackupConfig(),
+		Storage:              DefaultStorageConfig(),
+		ACME:                 DefaultACMEConfig(),
+		Keyless:              KeylessConfig{Timeout: 2000},
+		KeyPermissions:       KeyPermissionsConfig{Policy: "warn"},
+		KeyAge:               DefaultKeyAgeConfig(),
+		KeyHygiene:           DefaultKeyHygieneConfig(),
+		ExpiredCertificate:   DefaultExpiredCertificateConfig(),
+		Chaos:                DefaultChaosConfig(),
+		CTMonitor:            CTMonitorConfig{PollInterval: 60},
+		TrustStore:           TrustStoreConfig{ClientAuth: "none", CRLRefreshInterval: 60, CRLCacheDir: "certs/.crl-cache"},
+		Proxy:                DefaultProxyConfig(),
+		AccessLog:            DefaultAccessLogConfig(),
+		RequestID:            DefaultRequestIDConfig(),
+		Heartbeat:            DefaultHeartbeatConfig(),
+		Statsd:               DefaultStatsdConfig(),
+		OCSP:                 OCSPConfig{Stapling: false, MustStaple: "enforce", RefreshInterval: 5, CacheDir: "certs/.ocsp-cache"},
 	}
 }
 
@@ -95,17 +1378,54 @@ func AllFeatures() Features {
 		Logging:              true,
 		MetricsCollection:    true,
 		HealthCheck:          true,
+		Dashboard:            true,
+		Debug:                true,
+		StrictConfig:         true,
 		ShutdownTimeout:      10,
 		AgentShutdownTimeout: 5,
 		CertWatchInterval:    30,
 		DebounceInterval:     2000,
 		CertExpiryWarning:    7,
+		NotBeforeGrace:       300,
+		LoadTimeout:          30,
+		AIAChasing:           true,
+		AIACacheDir:          "certs/.aia-cache",
+		AdminAddress:         "127.0.0.1:9090",
+		AdminAuth:            DefaultAdminAuthConfig(),
+		TLS:                  DefaultListenerTLSConfig(),
+		HTTP2:                DefaultHTTP2Config(),
+		ECH:                  DefaultECHConfig(),
+		DelegatedCredentials: DefaultDelegatedCredentialsConfig(),
+		LeaderElection:       DefaultLeaderElectionConfig(),
+		Distribution:         DefaultDistributionConfig(),
+		Management:           DefaultManagementConfig(),
+		Probe:                DefaultProbeConfig(),
+		Backup:               DefaultBackupConfig(),
+		Storage:              DefaultStorageConfig(),
+		ACME:                 DefaultACMEConfig(),
+		Keyless:              KeylessConfig{Timeout: 2000},
+		KeyPermissions:       KeyPermissionsConfig{Policy: "warn"},
+		KeyAge:               DefaultKeyAgeConfig(),
+		KeyHygiene:           DefaultKeyHygieneConfig(),
+		ExpiredCertificate:   DefaultExpiredCertificateConfig(),
+		Chaos:                DefaultChaosConfig(),
+		CTMonitor:            CTMonitorConfig{PollInterval: 60},
+		TrustStore:           TrustStoreConfig{ClientAuth: "none", CRLRefreshInterval: 60, CRLCacheDir: "certs/.crl-cache"},
+		Proxy:                DefaultProxyConfig(),
+		AccessLog:            DefaultAccessLogConfig(),
+		RequestID:            DefaultRequestIDConfig(),
+		Heartbeat:            DefaultHeartbeatConfig(),
+		Statsd:               DefaultStatsdConfig(),
+		OCSP:                 OCSPConfig{Stapling: true, MustStaple: "enforce", RefreshInterval: 5, CacheDir: "certs/.ocsp-cache"},
 	}
 }
 
 // ConfigLoader provides methods to load feature configurations from various sources
 type ConfigLoader struct {
 	features Features
+
+	// strict rejects unknown keys in config files
+	strict bool
 }
 
 // NewConfigLoader creates a new configuration loader with default features
@@ -127,6 +1447,11 @@ func (cl *ConfigLoader) LoadFromEnv() error {
 	cl.loadBoolEnv("LOGGING", &cl.features.Logging)
 	cl.loadBoolEnv("METRICS_COLLECTION", &cl.features.MetricsCollection)
 	cl.loadBoolEnv("HEALTH_CHECK", &cl.features.HealthCheck)
+	cl.loadBoolEnv("DASHBOARD", &cl.features.Dashboard)
+	cl.loadBoolEnv("DEBUG", &cl.features.Debug)
+	cl.loadStringEnv("RECORD_FILE", &cl.features.RecordFile)
+	cl.loadBoolEnv("CHAOS_ENABLED", &cl.features.Chaos.Enabled)
+	cl.loadBoolEnv("STRICT_CONFIG", &cl.features.StrictConfig)
 
 	// Load integer features
 	cl.loadIntEnv("SHUTDOWN_TIMEOUT", &cl.features.ShutdownTimeout)
@@ -135,12 +1460,187 @@ func (cl *ConfigLoader) LoadFromEnv() error {
 	cl.loadIntEnv("DEBOUNCE_INTERVAL", &cl.features.DebounceInterval)
 	cl.loadIntEnv("CERT_EXPIRY_WARNING", &cl.features.CertExpiryWarning)
 
+	cl.loadStringEnv("ADMIN_ADDRESS", &cl.features.AdminAddress)
+	cl.loadBoolEnv("AIA_CHASING", &cl.features.AIAChasing)
+	cl.loadStringEnv("AIA_CACHE_DIR", &cl.features.AIACacheDir)
+
+	// Load listener TLS settings
+	cl.loadListEnv("TLS_CURVE_PREFERENCES", &cl.features.TLS.CurvePreferences)
+	cl.loadBoolEnv("TLS_POST_QUANTUM", &cl.features.TLS.PostQuantum)
+
+	// Load ECH settings
+	cl.loadBoolEnv("ECH_ENABLED", &cl.features.ECH.Enabled)
+	cl.loadStringEnv("ECH_KEY_FILE", &cl.features.ECH.KeyFile)
+	cl.loadStringEnv("ECH_PUBLIC_NAME", &cl.features.ECH.PublicName)
+	cl.loadStringEnv("ECH_DOMAIN", &cl.features.ECH.Domain)
+	cl.loadStringEnv("ECH_RECORD_FILE", &cl.features.ECH.RecordFile)
+	cl.loadIntEnv("ECH_ROTATION_INTERVAL", &cl.features.ECH.RotationInterval)
+
+	cl.loadBoolEnv("DELEGATED_CREDENTIALS_ENABLED", &cl.features.DelegatedCredentials.Enabled)
+	cl.loadStringEnv("DELEGATED_CREDENTIALS_KEY_TYPE", &cl.features.DelegatedCredentials.KeyType)
+	cl.loadIntEnv("DELEGATED_CREDENTIALS_VALIDITY", &cl.features.DelegatedCredentials.Validity)
+
+	// Load keyless signing settings
+	cl.loadBoolEnv("KEYLESS_ENABLED", &cl.features.Keyless.Enabled)
+	cl.loadListEnv("KEYLESS_SERVERS", &cl.features.Keyless.Servers)
+	cl.loadIntEnv("KEYLESS_TIMEOUT", &cl.features.Keyless.Timeout)
+
+	// Load key permission settings
+	cl.loadStringEnv("KEY_PERMISSIONS_POLICY", &cl.features.KeyPermissions.Policy)
+	cl.loadStringEnv("KEY_PERMISSIONS_OWNER", &cl.features.KeyPermissions.Owner)
+	cl.loadBoolEnv("FIPS_ENABLED", &cl.features.FIPS.Enabled)
+	cl.loadBoolEnv("FIPS_REQUIRE_MODULE", &cl.features.FIPS.RequireModule)
+	cl.loadIntEnv("KEY_AGE_MAX_AGE", &cl.features.KeyAge.MaxAge)
+	cl.loadStringEnv("KEY_AGE_ACTION", &cl.features.KeyAge.Action)
+	cl.loadIntEnv("KEY_AGE_CHECK_INTERVAL", &cl.features.KeyAge.CheckInterval)
+	cl.loadBoolEnv("KEY_HYGIENE_ZEROIZE", &cl.features.KeyHygiene.Zeroize)
+	cl.loadIntEnv("KEY_HYGIENE_ZEROIZE_DELAY", &cl.features.KeyHygiene.ZeroizeDelay)
+	cl.loadBoolEnv("KEY_HYGIENE_NO_EXPORT", &cl.features.KeyHygiene.NoExport)
+	cl.loadBoolEnv("KEY_HYGIENE_ADMIN_KEY_EXPORT", &cl.features.KeyHygiene.AdminKeyExport)
+
+	// Load certificate policy settings
+	cl.loadIntEnv("POLICY_MIN_RSA_BITS", &cl.features.Policy.MinRSABits)
+	cl.loadIntEnv("POLICY_MIN_ECDSA_BITS", &cl.features.Policy.MinECDSABits)
+	cl.loadListEnv("POLICY_ALLOWED_SIGNATURE_ALGORITHMS", &cl.features.Policy.AllowedSignatureAlgorithms)
+	cl.loadListEnv("POLICY_REQUIRED_SANS", &cl.features.Policy.RequiredSANs)
+	cl.loadIntEnv("POLICY_MAX_VALIDITY_DAYS", &cl.features.Policy.MaxValidityDays)
+	cl.loadStringEnv("POLICY_REQUIRED_ISSUER", &cl.features.Policy.RequiredIssuer)
+
+	cl.loadStringEnv("NOTIFICATIONS_WEBHOOK_URL", &cl.features.Notifications.WebhookURL)
+	cl.loadStringEnv("NOTIFICATIONS_WEBHOOK_TLS_CA_BUNDLE", &cl.features.Notifications.WebhookTLS.CABundle)
+	cl.loadListEnv("NOTIFICATIONS_WEBHOOK_TLS_PINS", &cl.features.Notifications.WebhookTLS.Pins)
+	cl.loadBoolEnv("NOTIFICATIONS_KUBERNETES_EVENTS", &cl.features.Notifications.Kubernetes.Events)
+	cl.loadBoolEnv("NOTIFICATIONS_KUBERNETES_ANNOTATE", &cl.features.Notifications.Kubernetes.Annotate)
+
+	cl.loadBoolEnv("HEARTBEAT_ENABLED", &cl.features.Heartbeat.Enabled)
+	cl.loadStringEnv("HEARTBEAT_URL", &cl.features.Heartbeat.URL)
+	cl.loadStringEnv("HEARTBEAT_FAIL_URL", &cl.features.Heartbeat.FailURL)
+	cl.loadIntEnv("HEARTBEAT_INTERVAL", &cl.features.Heartbeat.Interval)
+	cl.loadStringEnv("HEARTBEAT_TLS_CA_BUNDLE", &cl.features.Heartbeat.TLS.CABundle)
+	cl.loadListEnv("HEARTBEAT_TLS_PINS", &cl.features.Heartbeat.TLS.Pins)
+	cl.loadBoolEnv("ADMIN_AUTH_ENABLED", &cl.features.AdminAuth.Enabled)
+	cl.loadBoolEnv("ADMIN_TLS_ENABLED", &cl.features.AdminTLS.Enabled)
+	cl.loadStringEnv("ADMIN_TLS_CERT_FILE", &cl.features.AdminTLS.CertFile)
+	cl.loadStringEnv("ADMIN_TLS_KEY_FILE", &cl.features.AdminTLS.KeyFile)
+	cl.loadStringEnv("ADMIN_TLS_CLIENT_CA", &cl.features.AdminTLS.ClientCA)
+	cl.loadBoolEnv("STATSD_ENABLED", &cl.features.Statsd.Enabled)
+	cl.loadStringEnv("STATSD_ADDRESS", &cl.features.Statsd.Address)
+	cl.loadStringEnv("STATSD_FORMAT", &cl.features.Statsd.Format)
+	cl.loadStringEnv("STATSD_PREFIX", &cl.features.Statsd.Prefix)
+	cl.loadListEnv("STATSD_TAGS", &cl.features.Statsd.Tags)
+
+	// Load CT monitor settings
+	cl.loadBoolEnv("CT_MONITOR_ENABLED", &cl.features.CTMonitor.Enabled)
+	cl.loadListEnv("CT_MONITOR_DOMAINS", &cl.features.CTMonitor.Domains)
+	cl.loadListEnv("CT_MONITOR_ALLOWED_ISSUERS", &cl.features.CTMonitor.AllowedIssuers)
+	cl.loadListEnv("CT_MONITOR_EXPECTED_NAMES", &cl.features.CTMonitor.ExpectedNames)
+	cl.loadIntEnv("CT_MONITOR_POLL_INTERVAL", &cl.features.CTMonitor.PollInterval)
+	cl.loadStringEnv("CT_MONITOR_ENDPOINT", &cl.features.CTMonitor.Endpoint)
+
+	// Load trust store settings
+	cl.loadStringEnv("TRUST_STORE_CA_BUNDLE", &cl.features.TrustStore.CABundle)
+	cl.loadStringEnv("TRUST_STORE_CLIENT_AUTH", &cl.features.TrustStore.ClientAuth)
+	cl.loadBoolEnv("TRUST_STORE_CRL_CHECK", &cl.features.TrustStore.CRLCheck)
+	cl.loadBoolEnv("TRUST_STORE_CRL_HARD_FAIL", &cl.features.TrustStore.CRLHardFail)
+	cl.loadIntEnv("TRUST_STORE_CRL_REFRESH_INTERVAL", &cl.features.TrustStore.CRLRefreshInterval)
+	cl.loadStringEnv("TRUST_STORE_CRL_CACHE_DIR", &cl.features.TrustStore.CRLCacheDir)
+
+	// Load OCSP settings
+	cl.loadBoolEnv("OCSP_STAPLING", &cl.features.OCSP.Stapling)
+	cl.loadStringEnv("OCSP_MUST_STAPLE", &cl.features.OCSP.MustStaple)
+	cl.loadIntEnv("OCSP_REFRESH_INTERVAL", &cl.features.OCSP.RefreshInterval)
+	cl.loadStringEnv("OCSP_CACHE_DIR", &cl.features.OCSP.CacheDir)
+
+	cl.loadStringEnv("PROXY_UPSTREAM", &cl.features.Proxy.Upstream)
+	cl.loadStringEnv("PROXY_TLS_CA_BUNDLE", &cl.features.Proxy.TLS.CABundle)
+	cl.loadListEnv("PROXY_TLS_PINS", &cl.features.Proxy.TLS.Pins)
+	cl.loadStringEnv("LOG_FILE", &cl.features.LogFile)
+	cl.loadBoolEnv("ACCESS_LOG_ENABLED", &cl.features.AccessLog.Enabled)
+	cl.loadStringEnv("ACCESS_LOG_PATH", &cl.features.AccessLog.Path)
+	cl.loadBoolEnv("ACCESS_LOG_ERRORS_ONLY", &cl.features.AccessLog.ErrorsOnly)
+	cl.loadBoolEnv("REQUEST_ID_ENABLED", &cl.features.RequestID.Enabled)
+	cl.loadStringEnv("REQUEST_ID_HEADER", &cl.features.RequestID.Header)
+	cl.loadIntEnv("NOT_BEFORE_GRACE", &cl.features.NotBeforeGrace)
+	cl.loadStringEnv("EXPIRED_CERTIFICATE_MODE", &cl.features.ExpiredCertificate.Mode)
+	cl.loadIntEnv("EXPIRED_CERTIFICATE_GRACE", &cl.features.ExpiredCertificate.Grace)
+	cl.loadIntEnv("LOAD_WORKERS", &cl.features.LoadWorkers)
+	cl.loadStringEnv("CHAIN_FILE", &cl.features.ChainFile)
+	cl.loadIntEnv("RETAINED_VERSIONS", &cl.features.RetainedVersions)
+	cl.loadIntEnv("LOAD_TIMEOUT", &cl.features.LoadTimeout)
+	cl.loadIntEnv("MAX_CERT_FILE_SIZE", &cl.features.MaxCertFileSize)
+
+	cl.loadStringEnv("LEADER_ELECTION_BACKEND", &cl.features.LeaderElection.Backend)
+	cl.loadStringEnv("LEADER_ELECTION_LEASE_NAME", &cl.features.LeaderElection.LeaseName)
+	cl.loadStringEnv("LEADER_ELECTION_LOCK_FILE", &cl.features.LeaderElection.LockFile)
+	cl.loadIntEnv("LEADER_ELECTION_LEASE_DURATION", &cl.features.LeaderElection.LeaseDuration)
+	cl.loadIntEnv("LEADER_ELECTION_RETRY_PERIOD", &cl.features.LeaderElection.RetryPeriod)
+
+	cl.loadBoolEnv("DISTRIBUTION_SERVER_ENABLED", &cl.features.Distribution.Server.Enabled)
+	cl.loadStringEnv("DISTRIBUTION_SERVER_ADDRESS", &cl.features.Distribution.Server.Address)
+	cl.loadStringEnv("DISTRIBUTION_SERVER_CLIENT_CA", &cl.features.Distribution.Server.ClientCA)
+	cl.loadListEnv("DISTRIBUTION_SERVER_ALLOWED_CLIENTS", &cl.features.Distribution.Server.AllowedClients)
+	cl.loadStringEnv("DISTRIBUTION_REMOTE_URL", &cl.features.Distribution.Remote.URL)
+	cl.loadStringEnv("DISTRIBUTION_REMOTE_NAME", &cl.features.Distribution.Remote.Name)
+	cl.loadStringEnv("DISTRIBUTION_REMOTE_CERT_FILE", &cl.features.Distribution.Remote.CertFile)
+	cl.loadStringEnv("DISTRIBUTION_REMOTE_KEY_FILE", &cl.features.Distribution.Remote.KeyFile)
+	cl.loadStringEnv("DISTRIBUTION_REMOTE_CA_BUNDLE", &cl.features.Distribution.Remote.CABundle)
+	cl.loadListEnv("DISTRIBUTION_REMOTE_PINS", &cl.features.Distribution.Remote.Pins)
+
+	cl.loadBoolEnv("MANAGEMENT_ENABLED", &cl.features.Management.Enabled)
+	cl.loadStringEnv("MANAGEMENT_ADDRESS", &cl.features.Management.Address)
+	cl.loadStringEnv("MANAGEMENT_CLIENT_CA", &cl.features.Management.ClientCA)
+	cl.loadListEnv("MANAGEMENT_ALLOWED_CLIENTS", &cl.features.Management.AllowedClients)
+
+	cl.loadBoolEnv("WEBHOOK_ENABLED", &cl.features.Webhook.Enabled)
+	cl.loadStringEnv("WEBHOOK_CA_FILE", &cl.features.Webhook.CAFile)
+	cl.loadStringEnv("WEBHOOK_CA_BUNDLE_FILE", &cl.features.Webhook.CABundleFile)
+	cl.loadListEnv("WEBHOOK_MUTATING_CONFIGURATIONS", &cl.features.Webhook.MutatingConfigurations)
+	cl.loadListEnv("WEBHOOK_VALIDATING_CONFIGURATIONS", &cl.features.Webhook.ValidatingConfigurations)
+	cl.loadListEnv("WEBHOOK_WEBHOOKS", &cl.features.Webhook.Webhooks)
+
+	cl.loadBoolEnv("PROBE_ENABLED", &cl.features.Probe.Enabled)
+	cl.loadStringEnv("PROBE_CA_BUNDLE", &cl.features.Probe.CABundle)
+	cl.loadStringEnv("PROBE_SERVER_NAME", &cl.features.Probe.ServerName)
+	cl.loadStringEnv("PROBE_LISTEN", &cl.features.Probe.Listen)
+	cl.loadStringEnv("PROBE_URL", &cl.features.Probe.URL)
+	cl.loadIntEnv("PROBE_TIMEOUT", &cl.features.Probe.Timeout)
+
+	cl.loadStringEnv("BACKUP_DIR", &cl.features.Backup.Dir)
+	cl.loadIntEnv("BACKUP_KEEP", &cl.features.Backup.Keep)
+	cl.loadIntEnv("BACKUP_MAX_AGE_DAYS", &cl.features.Backup.MaxAgeDays)
+
+	cl.loadListEnv("TLS_ALPN", &cl.features.TLS.ALPN)
+	cl.loadBoolEnv("HTTP2_ENABLED", &cl.features.HTTP2.Enabled)
+	cl.loadIntEnv("HTTP2_MAX_CONCURRENT_STREAMS", &cl.features.HTTP2.MaxConcurrentStreams)
+	cl.loadIntEnv("HTTP2_IDLE_TIMEOUT", &cl.features.HTTP2.IdleTimeout)
+
+	cl.loadListEnv("CONNECTION_FILTER_ALLOW", &cl.features.ConnectionFilter.Allow)
+	cl.loadListEnv("CONNECTION_FILTER_DENY", &cl.features.ConnectionFilter.Deny)
+
+	cl.loadIntEnv("HANDSHAKE_MAX_CONCURRENT", &cl.features.HandshakeLimits.MaxConcurrent)
+	cl.loadStringEnv("HANDSHAKE_OVERFLOW", &cl.features.HandshakeLimits.Overflow)
+	cl.loadStringEnv("CONNECTION_ROTATION_MODE", &cl.features.ConnectionRotation.Mode)
+	cl.loadIntEnv("CONNECTION_ROTATION_GRACE_PERIOD", &cl.features.ConnectionRotation.GracePeriod)
+
+	cl.loadStringEnv("STORAGE_BACKEND", &cl.features.Storage.Backend)
+	cl.loadStringEnv("STORAGE_PATH", &cl.features.Storage.Path)
+
+	cl.loadBoolEnv("ACME_ENABLED", &cl.features.ACME.Enabled)
+	cl.loadStringEnv("ACME_DIRECTORY_URL", &cl.features.ACME.DirectoryURL)
+	cl.loadStringEnv("ACME_CA_BUNDLE", &cl.features.ACME.CABundle)
+	cl.loadStringEnv("ACME_EAB_KEY_ID", &cl.features.ACME.EABKeyID)
+	cl.loadStringEnv("ACME_EAB_HMAC_KEY_FILE", &cl.features.ACME.EABHMACKeyFile)
+	cl.loadStringEnv("ACME_EMAIL", &cl.features.ACME.Email)
+	cl.loadListEnv("ACME_DOMAINS", &cl.features.ACME.Domains)
+	cl.loadIntEnv("ACME_RENEW_BEFORE_DAYS", &cl.features.ACME.RenewBeforeDays)
+	cl.loadStringEnv("ACME_DNS_PROVIDER", &cl.features.ACME.DNS.Provider)
+
 	return nil
 }
 
 // LoadFromYAML loads feature flags from a YAML configuration file
 func (cl *ConfigLoader) LoadFromYAML(filePath string) error {
-	data, err := os.ReadFile(filePath)
+	data, err := loadMerged(filePath, decodeYAML, yaml.Marshal, cl.strict)
 	if err != nil {
 		return err
 	}
@@ -159,7 +1659,7 @@ func (cl *ConfigLoader) LoadFromYAML(filePath string) error {
 
 // LoadFromJSON loads feature flags from a JSON configuration file
 func (cl *ConfigLoader) LoadFromJSON(filePath string) error {
-	data, err := os.ReadFile(filePath)
+	data, err := loadMerged(filePath, decodeJSON, json.Marshal, cl.strict)
 	if err != nil {
 		return err
 	}
@@ -176,6 +1676,12 @@ func (cl *ConfigLoader) LoadFromJSON(filePath string) error {
 	return nil
 }
 
+// SetStrict makes config files with unknown keys fail to load. A file can
+// also opt in with "strict_config: true".
+func (cl *ConfigLoader) SetStrict(strict bool) {
+	cl.strict = strict
+}
+
 // Get returns the current feature configuration
 func (cl *ConfigLoader) Get() Features {
 	return cl.features
@@ -217,6 +1723,18 @@ func (cl *ConfigLoader) Update(featureName string, value interface{}) {
 		if b, ok := value.(bool); ok {
 			cl.features.HealthCheck = b
 		}
+	case "dashboard":
+		if b, ok := value.(bool); ok {
+			cl.features.Dashboard = b
+		}
+	case "debug":
+		if b, ok := value.(bool); ok {
+			cl.features.Debug = b
+		}
+	case "strict_config":
+		if b, ok := value.(bool); ok {
+			cl.features.StrictConfig = b
+		}
 	case "shutdown_timeout":
 		if i, ok := value.(int); ok {
 			cl.features.ShutdownTimeout = i
@@ -244,12 +1762,40 @@ func (cl *ConfigLoader) LogFeatures() {
 	log.Printf("  Logging:               %v\n", cl.features.Logging)
 	log.Printf("  Metrics Collection:    %v\n", cl.features.MetricsCollection)
 	log.Printf("  Health Check:          %v\n", cl.features.HealthCheck)
+	log.Printf("  Dashboard:             %v\n", cl.features.Dashboard)
+	log.Printf("  Debug Endpoints:       %v\n", cl.features.Debug)
+	log.Printf("  Strict Config:         %v\n", cl.features.StrictConfig)
+	if cl.features.Chaos.Enabled {
+		log.Printf("  Chaos Mode:            ENABLED (not for production)\n")
+	}
 	log.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
 	log.Printf("  Shutdown Timeout:      %d seconds\n", cl.features.ShutdownTimeout)
 	log.Printf("  Agent Shutdown Timeout: %d seconds\n", cl.features.AgentShutdownTimeout)
 	log.Printf("  Cert Watch Interval:   %d seconds\n", cl.features.CertWatchInterval)
 	log.Printf("  Debounce Interval:     %d ms\n", cl.features.DebounceInterval)
 	log.Printf("  Cert Expiry Warning:   %d days\n", cl.features.CertExpiryWarning)
+	log.Printf("  Expired Certificate:   %s (grace %d hours)\n", cl.features.ExpiredCertificate.Mode, cl.features.ExpiredCertificate.Grace)
+	log.Printf("  AIA Chasing:           %v\n", cl.features.AIAChasing)
+	log.Printf("  Post-Quantum KEX:      %v\n", cl.features.TLS.PostQuantum)
+	log.Printf("  HTTP/2:                %v\n", cl.features.HTTP2.Enabled)
+	log.Printf("  ECH:                   %v\n", cl.features.ECH.Enabled)
+	log.Printf("  Delegated Credentials: %v\n", cl.features.DelegatedCredentials.Enabled)
+	log.Printf("  Keyless Signing:       %v\n", cl.features.Keyless.Enabled)
+	log.Printf("  Key Permissions:       %s\n", cl.features.KeyPermissions.Policy)
+	log.Printf("  FIPS Mode:             %v\n", cl.features.FIPS.Enabled)
+	log.Printf("  Max Key Age:           %d days\n", cl.features.KeyAge.MaxAge)
+	log.Printf("  Key Zeroization:       %v\n", cl.features.KeyHygiene.Zeroize)
+	log.Printf("  Key No-Export:         %v\n", cl.features.KeyHygiene.NoExport)
+	log.Printf("  CT Monitor:            %v\n", cl.features.CTMonitor.Enabled)
+	log.Printf("  ACME:                  %v\n", cl.features.ACME.Enabled)
+	log.Printf("  Handshake Limits:      %v\n", cl.features.HandshakeLimits.Enabled())
+	log.Printf("  Access Log:            %v\n", cl.features.AccessLog.Enabled)
+	log.Printf("  Request IDs:           %v\n", cl.features.RequestID.Enabled)
+	log.Printf("  Admin TLS:             %v\n", cl.features.AdminTLS.Enabled)
+	log.Printf("  Admin Auth:            %v\n", cl.features.AdminAuth.Enabled)
+	log.Printf("  Heartbeat:             %v\n", cl.features.Heartbeat.Enabled)
+	log.Printf("  Statsd:                %v\n", cl.features.Statsd.Enabled)
+	log.Printf("  OCSP Stapling:         %v (must-staple: %s)\n", cl.features.OCSP.Stapling, cl.features.OCSP.MustStaple)
 	log.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
 }
 
@@ -272,3 +1818,23 @@ func (cl *ConfigLoader) loadIntEnv(envName string, target *int) {
 		}
 	}
 }
+
+func (cl *ConfigLoader) loadStringEnv(envName string, target *string) {
+	fullEnvName := "TLS_AGENT_FEATURES_" + envName
+	if val, exists := os.LookupEnv(fullEnvName); exists {
+		*target = val
+	}
+}
+
+func (cl *ConfigLoader) loadListEnv(envName string, target *[]string) {
+	fullEnvName := "TLS_AGENT_FEATURES_" + envName
+	if val, exists := os.LookupEnv(fullEnvName); exists {
+		var items []string
+		for _, item := range strings.Split(val, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		*target = items
+	}
+}
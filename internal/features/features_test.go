@@ -329,3 +329,20 @@ func TestEnvironmentVariablePriority(t *testing.T) {
 		t.Errorf("Environment variable should override JSON config, got %d", features.ShutdownTimeout)
 	}
 }
+
+// TestListenerKeyExchange tests per-listener overrides of the key exchange
+// settings
+func TestListenerKeyExchange(t *testing.T) {
+	public := ListenerTLSConfig{CurvePreferences: []string{"X25519MLKEM768", "X25519"}, PostQuantum: false}
+
+	names, pq := public.KeyExchange(nil, nil)
+	if len(names) != 2 || pq {
+		t.Errorf("Expected unset settings to inherit, got %v %v", names, pq)
+	}
+
+	enabled := true
+	names, pq = public.KeyExchange([]string{"P256"}, &enabled)
+	if len(names) != 1 || names[0] != "P256" || !pq {
+		t.Errorf("Expected the listener's own settings, got %v %v", names, pq)
+	}
+}
@@ -0,0 +1,155 @@
+package features
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// IncludeKey is the top-level config key listing files to include. Each
+// entry is a path or glob, relative to the including file. Included files
+// are merged in order, matches of a glob in lexical order, and the
+// including file is merged last, so a base file plus per-host overrides
+// looks like:
+//
+//	include: [base.yaml, "conf.d/*.yaml"]
+//	tls:
+//	  min_version: "1.3"
+//
+// Merging is deep for mappings; any other value, lists included, replaces
+// the earlier one.
+const IncludeKey = "include"
+
+// decodeFunc unmarshals one config file format
+type decodeFunc func(data []byte, v any) error
+
+// loadMerged reads filePath and its includes and returns the merged
+// document, re-encoded with encode. Unknown keys are an error when strict is
+// set or the document sets strict_config.
+func loadMerged(filePath string, decode decodeFunc, encode func(any) ([]byte, error), strict bool) ([]byte, error) {
+	doc, err := readMerged(filePath, decode, nil)
+	if err != nil {
+		return nil, err
+	}
+	if optIn, _ := doc["strict_config"].(bool); strict || optIn {
+		if err := CheckKeys(doc); err != nil {
+			return nil, fmt.Errorf("%s: %w", filePath, err)
+		}
+	}
+	return encode(doc)
+}
+
+// readMerged returns filePath's document with its includes merged in.
+// stack holds the files being included, to detect cycles.
+func readMerged(filePath string, decode decodeFunc, stack []string) (map[string]any, error) {
+	abs, err := filepath.Abs(filePath)
+	if err != nil {
+		return nil, err
+	}
+	for i, p := range stack {
+		if p == abs {
+			return nil, fmt.Errorf("config include cycle: %s", strings.Join(append(stack[i:], abs), " -> "))
+		}
+	}
+	if len(stack) >= MaxIncludeDepth {
+		return nil, fmt.Errorf("%s: %s nested more than %d files deep", filePath, IncludeKey, MaxIncludeDepth)
+	}
+	stack = append(stack, abs)
+
+	data, err := readConfigFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := parseDocument(data, decode)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filePath, err)
+	}
+
+	includes, err := includePaths(doc[IncludeKey], filepath.Dir(abs))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filePath, err)
+	}
+	delete(doc, IncludeKey)
+
+	merged := map[string]any{}
+	for _, inc := range includes {
+		included, err := readMerged(inc, decode, stack)
+		if err != nil {
+			return nil, err
+		}
+		mergeInto(merged, included)
+	}
+	mergeInto(merged, doc)
+	return merged, nil
+}
+
+// includePaths resolves the include directive, a string or list of
+// strings, into files relative to dir
+func includePaths(value any, dir string) ([]string, error) {
+	var patterns []string
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		patterns = []string{v}
+	case []any:
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s entries must be strings, got %v", IncludeKey, item)
+			}
+			patterns = append(patterns, s)
+		}
+	default:
+		return nil, fmt.Errorf("%s must be a path or a list of paths", IncludeKey)
+	}
+
+	var paths []string
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+		if !strings.ContainsAny(pattern, "*?[") {
+			paths = append(paths, pattern)
+			continue
+		}
+		// A glob may match nothing, so that an empty conf.d is fine
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s %q: %w", IncludeKey, pattern, err)
+		}
+		sort.Strings(matches)
+		paths = append(paths, matches...)
+	}
+	return paths, nil
+}
+
+// mergeInto deep-merges src over dst. Nested mappings are merged key by
+// key; any other src value replaces dst's.
+func mergeInto(dst, src map[string]any) {
+	for k, v := range src {
+		srcMap, srcOK := v.(map[string]any)
+		dstMap, dstOK := dst[k].(map[string]any)
+		if srcOK && dstOK {
+			mergeInto(dstMap, srcMap)
+			continue
+		}
+		if srcOK {
+			// Copy so later merges never write into an included document
+			copied := map[string]any{}
+			mergeInto(copied, srcMap)
+			v = copied
+		}
+		dst[k] = v
+	}
+}
+
+// decodeYAML and decodeJSON adapt the config formats to decodeFunc
+var (
+	decodeYAML decodeFunc = yaml.Unmarshal
+	decodeJSON decodeFunc = json.Unmarshal
+)
@@ -0,0 +1,104 @@
+package features
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeConfig writes a config file under dir
+func writeConfig(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+// TestLoadWithIncludes tests deep-merging a base file, a conf.d glob and
+// per-host overrides
+func TestLoadWithIncludes(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, "base.yaml", `
+shutdown_timeout: 20
+tls:
+  post_quantum: false
+  alpn: [h2, http/1.1]
+heartbeat:
+  enabled: true
+  url: https://hc.example/base
+`)
+	writeConfig(t, dir, "conf.d/10-tls.yaml", "tls:\n  post_quantum: true\n")
+	writeConfig(t, dir, "conf.d/20-heartbeat.yaml", "heartbeat:\n  interval: 30\n")
+	host := writeConfig(t, dir, "host.yaml", `
+include:
+  - base.yaml
+  - conf.d/*.yaml
+tls:
+  alpn: [http/1.1]
+heartbeat:
+  url: https://hc.example/host
+`)
+
+	loader := NewConfigLoader()
+	if err := loader.LoadFromYAML(host); err != nil {
+		t.Fatalf("LoadFromYAML failed: %v", err)
+	}
+	f := loader.Get()
+	if f.ShutdownTimeout != 20 {
+		t.Errorf("Expected the base shutdown_timeout, got %d", f.ShutdownTimeout)
+	}
+	if !f.TLS.PostQuantum {
+		t.Error("Expected conf.d to override post_quantum")
+	}
+	if len(f.TLS.ALPN) != 1 || f.TLS.ALPN[0] != "http/1.1" {
+		t.Errorf("Expected the host's list to replace the base's, got %v", f.TLS.ALPN)
+	}
+	if hb := f.Heartbeat; !hb.Enabled || hb.Interval != 30 || hb.URL != "https://hc.example/host" {
+		t.Errorf("Expected heartbeat merged from all three files, got %+v", hb)
+	}
+}
+
+// TestIncludeJSON tests includes between JSON files
+func TestIncludeJSON(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, "base.json", `{"shutdown_timeout": 20, "logging": false}`)
+	main := writeConfig(t, dir, "main.json", `{"include": "base.json", "logging": true}`)
+
+	loader := NewConfigLoader()
+	if err := loader.LoadFromJSON(main); err != nil {
+		t.Fatalf("LoadFromJSON failed: %v", err)
+	}
+	if f := loader.Get(); f.ShutdownTimeout != 20 || !f.Logging {
+		t.Errorf("Expected merged values, got shutdown_timeout=%d logging=%v", f.ShutdownTimeout, f.Logging)
+	}
+}
+
+// TestIncludeErrors tests cycles, missing files and malformed directives
+func TestIncludeErrors(t *testing.T) {
+	dir := t.TempDir()
+	a := writeConfig(t, dir, "a.yaml", "include: b.yaml\n")
+	writeConfig(t, dir, "b.yaml", "include: [a.yaml]\n")
+	missing := writeConfig(t, dir, "missing.yaml", "include: nope.yaml\n")
+	bad := writeConfig(t, dir, "bad.yaml", "include: {file: a.yaml}\n")
+	empty := writeConfig(t, dir, "empty.yaml", "include: \"none.d/*.yaml\"\nlogging: true\n")
+
+	err := NewConfigLoader().LoadFromYAML(a)
+	if err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("Expected a cycle error, got %v", err)
+	}
+	if err := NewConfigLoader().LoadFromYAML(missing); err == nil {
+		t.Error("Expected a missing include to fail")
+	}
+	if err := NewConfigLoader().LoadFromYAML(bad); err == nil {
+		t.Error("Expected a mapping include directive to fail")
+	}
+	if err := NewConfigLoader().LoadFromYAML(empty); err != nil {
+		t.Errorf("Expected a glob matching nothing to be fine, got %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package features
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Limits on config input, so a malformed or hostile file fails with a clean
+// error instead of exhausting memory or the stack. Real configs are a few
+// KiB and a handful of levels deep.
+const (
+	// MaxConfigSize is the largest config file read, includes counted
+	// separately
+	MaxConfigSize = 1 << 20
+	// MaxConfigDepth is the deepest nesting of mappings and lists allowed
+	MaxConfigDepth = 32
+	// MaxIncludeDepth is the longest chain of files including each other
+	MaxIncludeDepth = 16
+)
+
+var (
+	ErrConfigTooLarge = errors.New("config file too large")
+	ErrConfigTooDeep  = errors.New("config nested too deeply")
+)
+
+// readConfigFile reads filePath, refusing files over MaxConfigSize
+func readConfigFile(filePath string) ([]byte, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err == nil && info.Size() > MaxConfigSize {
+		return nil, fmt.Errorf("%s: %w: %d bytes, limit %d", filePath, ErrConfigTooLarge, info.Size(), MaxConfigSize)
+	}
+	// The size may change between Stat and the read, or be unknown
+	data, err := io.ReadAll(io.LimitReader(f, MaxConfigSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxConfigSize {
+		return nil, fmt.Errorf("%s: %w: limit %d bytes", filePath, ErrConfigTooLarge, MaxConfigSize)
+	}
+	return data, nil
+}
+
+// parseDocument decodes one config file into a generic document, checking
+// the limits above. An empty file is an empty document.
+func parseDocument(data []byte, decode decodeFunc) (map[string]any, error) {
+	if len(data) > MaxConfigSize {
+		return nil, fmt.Errorf("%w: limit %d bytes", ErrConfigTooLarge, MaxConfigSize)
+	}
+	var doc map[string]any
+	if err := decode(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		doc = map[string]any{}
+	}
+	if err := checkDepth(doc, 1); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// checkDepth fails when v nests mappings or lists beyond MaxConfigDepth
+func checkDepth(v any, depth int) error {
+	if depth > MaxConfigDepth {
+		return fmt.Errorf("%w: more than %d levels", ErrConfigTooDeep, MaxConfigDepth)
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		for _, item := range v {
+			if err := checkDepth(item, depth+1); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, item := range v {
+			if err := checkDepth(item, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package features
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TestConfigLimits tests oversized, deeply nested and deeply included
+// configs failing cleanly
+func TestConfigLimits(t *testing.T) {
+	dir := t.TempDir()
+
+	large := writeConfig(t, dir, "large.yaml", "# "+strings.Repeat("x", MaxConfigSize)+"\n")
+	if err := NewConfigLoader().LoadFromYAML(large); !errors.Is(err, ErrConfigTooLarge) {
+		t.Errorf("Expected ErrConfigTooLarge, got %v", err)
+	}
+
+	deep := writeConfig(t, dir, "deep.json", strings.Repeat(`{"a":`, MaxConfigDepth+1)+"1"+strings.Repeat("}", MaxConfigDepth+1))
+	if err := NewConfigLoader().LoadFromJSON(deep); !errors.Is(err, ErrConfigTooDeep) {
+		t.Errorf("Expected ErrConfigTooDeep, got %v", err)
+	}
+	deepList := writeConfig(t, dir, "deep-list.yaml", "a: "+strings.Repeat("[", MaxConfigDepth)+strings.Repeat("]", MaxConfigDepth)+"\n")
+	if err := NewConfigLoader().LoadFromYAML(deepList); !errors.Is(err, ErrConfigTooDeep) {
+		t.Errorf("Expected ErrConfigTooDeep for nested lists, got %v", err)
+	}
+
+	// A chain of includes, each file including the next
+	for i := 0; i <= MaxIncludeDepth; i++ {
+		writeConfig(t, dir, fmt.Sprintf("chain%d.yaml", i), fmt.Sprintf("include: chain%d.yaml\n", i+1))
+	}
+	writeConfig(t, dir, fmt.Sprintf("chain%d.yaml", MaxIncludeDepth+1), "shutdown_timeout: 5\n")
+	err := NewConfigLoader().LoadFromYAML(filepath.Join(dir, "chain0.yaml"))
+	if err == nil || !strings.Contains(err.Error(), "nested more than") {
+		t.Errorf("Expected an include depth error, got %v", err)
+	}
+}
+
+// FuzzParseYAML feeds arbitrary YAML through the config pipeline, which
+// must return an error or a config but never panic
+func FuzzParseYAML(f *testing.F) {
+	f.Add([]byte("shutdown_timeout: 20\ntls:\n  alpn: [h2]\n"))
+	f.Add([]byte("a: &a [*a]\n"))
+	f.Add([]byte("a: &x [1, 2]\nb: [*x, *x, *x]\n"))
+	f.Add([]byte("!!binary AAAA"))
+	f.Add([]byte("include: [1, 2]\n"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fuzzConfig(t, data, decodeYAML, yaml.Marshal, yaml.Unmarshal)
+	})
+}
+
+// FuzzParseJSON is FuzzParseYAML for JSON configs
+func FuzzParseJSON(f *testing.F) {
+	f.Add([]byte(`{"shutdown_timeout": 20, "tls": {"alpn": ["h2"]}}`))
+	f.Add([]byte(`[[[[]]]]`))
+	f.Add([]byte(`{"a": 1e999}`))
+	f.Add([]byte(`{"strict_config": true, "nope": 1}`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fuzzConfig(t, data, decodeJSON, json.Marshal, json.Unmarshal)
+	})
+}
+
+// fuzzConfig runs data through the same steps as loadMerged and the final
+// unmarshal into Features
+func fuzzConfig(t *testing.T, data []byte, decode decodeFunc, encode func(any) ([]byte, error), unmarshal func([]byte, any) error) {
+	doc, err := parseDocument(data, decode)
+	if err != nil {
+		return
+	}
+	if err := checkDepth(doc, 1); err != nil {
+		t.Fatalf("parseDocument accepted a document over the depth limit: %v", err)
+	}
+	_, _ = includePaths(doc[IncludeKey], t.TempDir())
+	_ = CheckKeys(doc)
+	merged := map[string]any{}
+	mergeInto(merged, doc)
+	out, err := encode(merged)
+	if err != nil {
+		return
+	}
+	features := DefaultFeatures()
+	_ = unmarshal(out, &features)
+}
@@ -0,0 +1,54 @@
+package features
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+// Redacted replaces secret values in dumped configuration
+const Redacted = "[REDACTED]"
+
+// Redact returns a copy of f that is safe to show: fields tagged
+// `redact:"true"`, such as webhook URLs that embed a token, are replaced by
+// Redacted, and passwords in any URL are masked. Secrets configured through
+// *_file settings are never in Features and need no redaction.
+func Redact(f Features) Features {
+	v := reflect.ValueOf(&f).Elem()
+	redactValue(v, false)
+	return f
+}
+
+// redactValue redacts v in place. Slices are copied first so the caller's
+// Features is not modified through shared backing arrays.
+func redactValue(v reflect.Value, secret bool) {
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).IsExported() {
+				redactValue(v.Field(i), t.Field(i).Tag.Get("redact") == "true")
+			}
+		}
+	case reflect.Slice:
+		if v.IsNil() {
+			return
+		}
+		copied := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		reflect.Copy(copied, v)
+		v.Set(copied)
+		for i := 0; i < v.Len(); i++ {
+			redactValue(v.Index(i), secret)
+		}
+	case reflect.String:
+		switch s := v.String(); {
+		case s == "":
+		case secret:
+			v.SetString(Redacted)
+		case strings.Contains(s, "://"):
+			if u, err := url.Parse(s); err == nil && u.User != nil {
+				v.SetString(u.Redacted())
+			}
+		}
+	}
+}
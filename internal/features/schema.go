@@ -0,0 +1,203 @@
+package features
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// SchemaID identifies the configuration schema shipped as
+// features.schema.json
+const SchemaID = "https://github.com/sbusanelli/TLSAIAgent/features.schema.json"
+
+// Schema returns a JSON Schema (draft 2020-12) for config files. It is
+// generated from Features, with the defaults of DefaultFeatures, so it
+// cannot drift from what the loader accepts.
+func Schema() map[string]any {
+	s := schemaFor(reflect.TypeOf(Features{}), reflect.ValueOf(DefaultFeatures()))
+	s["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	s["$id"] = SchemaID
+	s["title"] = "TLS Agent configuration"
+	s["properties"].(map[string]any)[IncludeKey] = map[string]any{
+		"description": "Files merged in before this one, relative to it; globs allowed",
+		"oneOf": []any{
+			map[string]any{"type": "string"},
+			map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+		},
+	}
+	return s
+}
+
+// schemaFor returns the schema of typ. def, when valid, holds the default
+// value reported for scalars.
+func schemaFor(typ reflect.Type, def reflect.Value) map[string]any {
+	// Pointers mark optional settings that inherit when unset
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+		if def.IsValid() && !def.IsNil() {
+			def = def.Elem()
+		} else {
+			def = reflect.Value{}
+		}
+	}
+	s := map[string]any{}
+	switch typ.Kind() {
+	case reflect.Struct:
+		props := map[string]any{}
+		for name, f := range keyFields(typ) {
+			var fieldDef reflect.Value
+			if def.IsValid() {
+				fieldDef = def.FieldByIndex(f.Index)
+			}
+			props[name] = schemaFor(f.Type, fieldDef)
+		}
+		s["type"] = "object"
+		s["properties"] = props
+		s["additionalProperties"] = false
+		return s
+	case reflect.Slice, reflect.Array:
+		s["type"] = "array"
+		s["items"] = schemaFor(typ.Elem(), reflect.Value{})
+		return s
+	case reflect.Bool:
+		s["type"] = "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s["type"] = "integer"
+	case reflect.Float32, reflect.Float64:
+		s["type"] = "number"
+	case reflect.String:
+		s["type"] = "string"
+	}
+	if def.IsValid() && !def.IsZero() {
+		s["default"] = def.Interface()
+	}
+	return s
+}
+
+// ReadDocument reads a config file and its includes into one document
+// without applying it. Files ending in .json are parsed as JSON, others as
+// YAML.
+func ReadDocument(filePath string) (map[string]any, error) {
+	decode := decodeYAML
+	if strings.EqualFold(filepath.Ext(filePath), ".json") {
+		decode = decodeJSON
+	}
+	return readMerged(filePath, decode, nil)
+}
+
+// ValidateDocument checks a document read by ReadDocument against Schema,
+// reporting unknown keys, with suggestions, and values of the wrong type
+func ValidateDocument(doc map[string]any) error {
+	schema := Schema()
+	// The include directive has been resolved by ReadDocument
+	delete(schema["properties"].(map[string]any), IncludeKey)
+
+	var errs []error
+	validate(doc, schema, "", &errs)
+	return errors.Join(errs...)
+}
+
+// validate checks value against the subset of JSON Schema that Schema
+// generates
+func validate(value any, schema map[string]any, path string, errs *[]error) {
+	if value == nil {
+		// An empty YAML value leaves the default
+		return
+	}
+	at := strings.TrimSuffix(path, ".")
+	if at == "" {
+		at = "(root)"
+	}
+	if alternatives, ok := schema["oneOf"].([]any); ok {
+		for _, alt := range alternatives {
+			var altErrs []error
+			validate(value, alt.(map[string]any), path, &altErrs)
+			if len(altErrs) == 0 {
+				return
+			}
+		}
+		*errs = append(*errs, fmt.Errorf("%s: value does not match any allowed form", at))
+		return
+	}
+
+	typ, _ := schema["type"].(string)
+	if !hasType(value, typ) {
+		*errs = append(*errs, fmt.Errorf("%s: expected %s, got %s", at, typ, describe(value)))
+		return
+	}
+	switch typ {
+	case "object":
+		doc := value.(map[string]any)
+		props := schema["properties"].(map[string]any)
+		for _, k := range slices.Sorted(maps.Keys(doc)) {
+			prop, ok := props[k].(map[string]any)
+			if !ok {
+				*errs = append(*errs, unknownKey(path+k, k, slices.Collect(maps.Keys(props))))
+				continue
+			}
+			validate(doc[k], prop, path+k+".", errs)
+		}
+	case "array":
+		items := schema["items"].(map[string]any)
+		for i, item := range value.([]any) {
+			validate(item, items, fmt.Sprintf("%s[%d].", strings.TrimSuffix(path, "."), i), errs)
+		}
+	}
+}
+
+// hasType reports whether a decoded YAML or JSON value is of the schema type
+func hasType(value any, typ string) bool {
+	switch typ {
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "integer":
+		switch v := value.(type) {
+		case int, int64, uint64:
+			return true
+		case float64:
+			// JSON numbers decode as float64
+			return v == math.Trunc(v)
+		}
+		return false
+	case "number":
+		switch value.(type) {
+		case int, int64, uint64, float64:
+			return true
+		}
+		return false
+	}
+	return true
+}
+
+// describe names the type of a decoded value for error messages
+func describe(value any) string {
+	switch value.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case int, int64, uint64, float64:
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
@@ -0,0 +1,76 @@
+package features
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestSchemaShipped tests that features.schema.json matches the generated
+// schema; regenerate it with `go run . config schema > features.schema.json`
+func TestSchemaShipped(t *testing.T) {
+	shipped, err := os.ReadFile("../../features.schema.json")
+	if err != nil {
+		t.Fatalf("Failed to read the shipped schema: %v", err)
+	}
+	var generated bytes.Buffer
+	enc := json.NewEncoder(&generated)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(Schema()); err != nil {
+		t.Fatalf("Failed to encode schema: %v", err)
+	}
+	if !bytes.Equal(shipped, generated.Bytes()) {
+		t.Error("features.schema.json is out of date; run `go run . config schema > features.schema.json`")
+	}
+}
+
+// TestValidateDocument tests schema validation of YAML and JSON documents
+func TestValidateDocument(t *testing.T) {
+	dir := t.TempDir()
+	good := writeConfig(t, dir, "good.json", `{"shutdown_timeout": 20, "access_log": {"sample_rate": 0.5}, "tls": {"alpn": ["h2"]}}`)
+	doc, err := ReadDocument(good)
+	if err != nil {
+		t.Fatalf("ReadDocument failed: %v", err)
+	}
+	if err := ValidateDocument(doc); err != nil {
+		t.Errorf("Expected a valid document, got %v", err)
+	}
+
+	bad := writeConfig(t, dir, "bad.yaml", `
+include: good.json
+shutdown_timeout: "soon"
+cert_watch_interval: 1.5
+logging: yes please
+tls:
+  alpn: h2
+heartbeat:
+  intervall: 30
+tenants:
+  - name: shop
+    certificates: [{cert_file: 7}]
+`)
+	if doc, err = ReadDocument(bad); err != nil {
+		t.Fatalf("ReadDocument failed: %v", err)
+	}
+	err = ValidateDocument(doc)
+	if err == nil {
+		t.Fatal("Expected validation errors")
+	}
+	for _, want := range []string{
+		"shutdown_timeout: expected integer, got string",
+		"cert_watch_interval: expected integer, got number",
+		"logging: expected boolean, got string",
+		"tls.alpn: expected array, got string",
+		`"heartbeat.intervall" (did you mean "heartbeat.interval"?)`,
+		"tenants[0].certificates[0].cert_file: expected string, got number",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected %q in:\n%v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "access_log") {
+		t.Errorf("Expected the included file's values to be valid:\n%v", err)
+	}
+}
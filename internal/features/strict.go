@@ -0,0 +1,116 @@
+package features
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ErrUnknownKey is wrapped by the errors CheckKeys reports
+var ErrUnknownKey = errors.New("unknown config key")
+
+// CheckKeys reports every key in doc, a decoded config document, that does
+// not name a Features field, suggesting the closest valid key for each
+func CheckKeys(doc map[string]any) error {
+	var errs []error
+	checkKeys(doc, reflect.TypeOf(Features{}), "", &errs)
+	return errors.Join(errs...)
+}
+
+// checkKeys checks value against typ, appending errors for unknown keys
+// under path
+func checkKeys(value any, typ reflect.Type, path string, errs *[]error) {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	switch typ.Kind() {
+	case reflect.Struct:
+		doc, ok := value.(map[string]any)
+		if !ok {
+			return
+		}
+		fields := keyFields(typ)
+		keys := make([]string, 0, len(doc))
+		for k := range doc {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			field, ok := fields[k]
+			if !ok {
+				*errs = append(*errs, unknownKey(path+k, k, slices.Collect(maps.Keys(fields))))
+				continue
+			}
+			checkKeys(doc[k], field.Type, path+k+".", errs)
+		}
+	case reflect.Slice, reflect.Array:
+		items, ok := value.([]any)
+		if !ok {
+			return
+		}
+		for i, item := range items {
+			checkKeys(item, typ.Elem(), fmt.Sprintf("%s[%d].", strings.TrimSuffix(path, "."), i), errs)
+		}
+	}
+}
+
+// keyFields maps the config keys of a struct type to its fields
+func keyFields(typ reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = f
+	}
+	return fields
+}
+
+// unknownKey describes an unknown key, naming the closest valid sibling
+// when it is a plausible typo
+func unknownKey(path, key string, names []string) error {
+	best, bestDist := "", -1
+	for _, name := range names {
+		d := editDistance(strings.ToLower(key), name)
+		if bestDist < 0 || d < bestDist || (d == bestDist && name < best) {
+			best, bestDist = name, d
+		}
+	}
+	if bestDist >= 0 && bestDist <= max(2, len(key)/3) {
+		return fmt.Errorf("%w %q (did you mean %q?)", ErrUnknownKey, path, strings.TrimSuffix(path, key)+best)
+	}
+	return fmt.Errorf("%w %q", ErrUnknownKey, path)
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
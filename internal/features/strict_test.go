@@ -0,0 +1,62 @@
+package features
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestStrictConfig tests that unknown keys fail with a suggestion
+func TestStrictConfig(t *testing.T) {
+	dir := t.TempDir()
+	typo := writeConfig(t, dir, "typo.yaml", `
+certificate_wacther: true
+tls:
+  alpm: [h2]
+  client_policies:
+    - name: internal
+      client_auht: require
+tenants:
+  - name: shop
+    completely_unrelated_setting: 1
+`)
+
+	// Without strict mode unknown keys are ignored as before
+	if err := NewConfigLoader().LoadFromYAML(typo); err != nil {
+		t.Fatalf("Expected a lenient load to succeed, got %v", err)
+	}
+
+	loader := NewConfigLoader()
+	loader.SetStrict(true)
+	err := loader.LoadFromYAML(typo)
+	if !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("Expected ErrUnknownKey, got %v", err)
+	}
+	for _, want := range []string{
+		`"certificate_wacther" (did you mean "certificate_watcher"?)`,
+		`"tls.alpm" (did you mean "tls.alpn"?)`,
+		`"tls.client_policies[0].client_auht" (did you mean "tls.client_policies[0].client_auth"?)`,
+		`"tenants[0].completely_unrelated_setting"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected %s in:\n%v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "completely_unrelated_setting\" (did you mean") {
+		t.Errorf("Expected no suggestion for an unrelated key:\n%v", err)
+	}
+}
+
+// TestStrictConfigOptIn tests enabling strict mode from the file itself
+func TestStrictConfigOptIn(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, dir, "features.json", `{"strict_config": true, "loging": true}`)
+	if err := NewConfigLoader().LoadFromJSON(path); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Expected strict_config to reject loging, got %v", err)
+	}
+
+	valid := writeConfig(t, dir, "valid.yaml", "strict_config: true\nlogging: true\ntls:\n  alpn: [h2]\n")
+	if err := NewConfigLoader().LoadFromYAML(valid); err != nil {
+		t.Errorf("Expected a valid strict file to load, got %v", err)
+	}
+}
@@ -0,0 +1,243 @@
+package fetchcache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"tls-agent/internal/clock"
+	"tls-agent/internal/metrics"
+	"tls-agent/internal/storage"
+
+	"golang.org/x/sync/singleflight"
+)
+
+var lookups = metrics.NewCounterVec("tls_agent_fetch_cache_total",
+	"Fetch cache lookups by result (hit, stale, miss, error)", "result")
+
+// Validity describes how long a fetched document may be used
+type Validity struct {
+	// RefreshAt is when the document should be refreshed. After it, the
+	// document is still served while a background fetch revalidates it.
+	RefreshAt time.Time
+
+	// ExpiresAt is when the document must no longer be served; zero never expires
+	ExpiresAt time.Time
+}
+
+// Fetcher retrieves the raw document
+type Fetcher func(ctx context.Context) ([]byte, error)
+
+// Decoder parses a raw document and reports its validity. An error rejects it.
+type Decoder func(data []byte) (value any, validity Validity, err error)
+
+// Item is a cached document together with its decoded value
+type Item struct {
+	Data    []byte
+	Value   any
+	Fetched time.Time
+	Validity
+}
+
+func (it *Item) expired(now time.Time) bool {
+	return !it.ExpiresAt.IsZero() && !now.Before(it.ExpiresAt)
+}
+
+func (it *Item) stale(now time.Time) bool {
+	return !it.RefreshAt.IsZero() && !now.Before(it.RefreshAt)
+}
+
+// Cache deduplicates concurrent fetches of the same key, caches documents
+// until their validity runs out, serves stale documents while revalidating,
+// and persists documents to disk so restarts do not hit the network
+type Cache struct {
+	// Dir, if set, persists fetched documents across restarts
+	Dir string
+
+	// Storage, if set, persists documents instead of Dir
+	Storage storage.Storage
+
+	// Timeout bounds each fetch; defaults to 30 seconds
+	Timeout time.Duration
+
+	// Clock judges staleness and expiry; defaults to the wall clock
+	Clock clock.Clock
+
+	group singleflight.Group
+
+	mu    sync.Mutex
+	items map[string]*Item
+}
+
+// New creates a cache persisting documents in dir (empty disables persistence)
+func New(dir string) *Cache {
+	return &Cache{Dir: dir}
+}
+
+// Get returns the document for key, fetching it only when there is no
+// usable cached copy. Concurrent callers share a single fetch.
+func (c *Cache) Get(key string, fetch Fetcher, decode Decoder) (*Item, error) {
+	now := clock.Or(c.Clock).Now()
+	item := c.Peek(key)
+	if item == nil {
+		item = c.loadDisk(key, decode)
+	}
+
+	switch {
+	case item != nil && !item.stale(now) && !item.expired(now):
+		lookups.With("hit").Inc()
+		return item, nil
+
+	case item != nil && !item.expired(now):
+		// Stale while revalidate: serve what we have, refresh in the background
+		lookups.With("stale").Inc()
+		c.group.DoChan(key, func() (any, error) {
+			return c.fetch(key, fetch, decode)
+		})
+		return item, nil
+	}
+
+	lookups.With("miss").Inc()
+	return c.Refresh(key, fetch, decode)
+}
+
+// Refresh fetches key now, sharing the fetch with concurrent callers. On
+// failure the cached copy, if any, is kept.
+func (c *Cache) Refresh(key string, fetch Fetcher, decode Decoder) (*Item, error) {
+	v, err, _ := c.group.Do(key, func() (any, error) {
+		return c.fetch(key, fetch, decode)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*Item), nil
+}
+
+// Peek returns the in-memory copy of key without fetching, or nil
+func (c *Cache) Peek(key string) *Item {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.items[key]
+}
+
+func (c *Cache) fetch(key string, fetch Fetcher, decode Decoder) (*Item, error) {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	data, err := fetch(ctx)
+	if err == nil {
+		var item *Item
+		if item, err = decodeItem(data, clock.Or(c.Clock).Now(), decode); err == nil {
+			c.store(key, item)
+			return item, nil
+		}
+	}
+
+	lookups.With("error").Inc()
+	log.Printf("Fetch cache: %s: %v", key, err)
+	return nil, err
+}
+
+func decodeItem(data []byte, fetched time.Time, decode Decoder) (*Item, error) {
+	value, validity, err := decode(data)
+	if err != nil {
+		return nil, err
+	}
+	return &Item{Data: data, Value: value, Fetched: fetched, Validity: validity}, nil
+}
+
+func (c *Cache) store(key string, item *Item) {
+	c.mu.Lock()
+	if c.items == nil {
+		c.items = make(map[string]*Item)
+	}
+	c.items[key] = item
+	c.mu.Unlock()
+
+	backend := c.backend()
+	if backend == nil {
+		return
+	}
+	if err := backend.Put(storageKey(key), item.Data); err != nil {
+		log.Printf("Fetch cache: failed to persist %s: %v", key, err)
+	}
+}
+
+func (c *Cache) loadDisk(key string, decode Decoder) *Item {
+	backend := c.backend()
+	if backend == nil {
+		return nil
+	}
+
+	data, fetched, err := backend.Get(storageKey(key))
+	if err != nil {
+		return nil
+	}
+	item, err := decodeItem(data, fetched, decode)
+	if err != nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	if c.items == nil {
+		c.items = make(map[string]*Item)
+	}
+	c.items[key] = item
+	c.mu.Unlock()
+	return item
+}
+
+// backend returns where documents persist, or nil when they do not
+func (c *Cache) backend() storage.Storage {
+	if c.Storage != nil {
+		return c.Storage
+	}
+	if c.Dir != "" {
+		return &storage.FS{Dir: c.Dir}
+	}
+	return nil
+}
+
+// storageKey maps a cache key, often a URL, to a flat storage key
+func storageKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetURL returns a Fetcher performing an HTTP GET of url, reading at most
+// limit bytes. A nil client uses a client with a 10s timeout.
+func GetURL(client *http.Client, url string, limit int64) Fetcher {
+	return func(ctx context.Context) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		return Do(client, req, limit)
+	}
+}
+
+// Do sends req and returns the body of a 200 response, reading at most limit bytes
+func Do(client *http.Client, req *http.Request, limit int64) ([]byte, error) {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s %s returned %d", req.Method, req.URL, resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, limit))
+}
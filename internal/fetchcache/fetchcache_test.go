@@ -0,0 +1,139 @@
+package fetchcache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeSource returns the current payload and counts fetches
+type fakeSource struct {
+	fetches atomic.Int32
+	mu      sync.Mutex
+	payload string
+	err     error
+	delay   time.Duration
+}
+
+func (f *fakeSource) fetch(ctx context.Context) ([]byte, error) {
+	f.fetches.Add(1)
+	time.Sleep(f.delay)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return []byte(f.payload), f.err
+}
+
+func (f *fakeSource) set(payload string, err error) {
+	f.mu.Lock()
+	f.payload, f.err = payload, err
+	f.mu.Unlock()
+}
+
+// decodeWith returns a decoder assigning the given validity
+func decodeWith(v Validity) Decoder {
+	return func(data []byte) (any, Validity, error) {
+		if string(data) == "invalid" {
+			return nil, Validity{}, errors.New("invalid document")
+		}
+		return string(data), v, nil
+	}
+}
+
+// TestSingleflight tests that concurrent misses share one fetch
+func TestSingleflight(t *testing.T) {
+	src := &fakeSource{payload: "doc", delay: 50 * time.Millisecond}
+	cache := New("")
+	decode := decodeWith(Validity{RefreshAt: time.Now().Add(time.Hour)})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			item, err := cache.Get("k", src.fetch, decode)
+			if err != nil || item.Value != "doc" {
+				t.Errorf("Get failed: %v %v", item, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := src.fetches.Load(); n != 1 {
+		t.Errorf("Expected 1 fetch for concurrent callers, got %d", n)
+	}
+
+	// Fresh hits do not fetch
+	cache.Get("k", src.fetch, decode)
+	if n := src.fetches.Load(); n != 1 {
+		t.Errorf("Fresh hit should not fetch, got %d fetches", n)
+	}
+}
+
+// TestStaleWhileRevalidate tests that stale documents are served while a
+// background fetch refreshes them, and expired ones are not served
+func TestStaleWhileRevalidate(t *testing.T) {
+	src := &fakeSource{payload: "v1"}
+	cache := New("")
+	stale := decodeWith(Validity{RefreshAt: time.Now().Add(-time.Minute), ExpiresAt: time.Now().Add(time.Hour)})
+
+	if _, err := cache.Get("k", src.fetch, stale); err != nil {
+		t.Fatalf("Initial Get failed: %v", err)
+	}
+
+	src.set("v2", nil)
+	item, err := cache.Get("k", src.fetch, stale)
+	if err != nil || item.Value != "v1" {
+		t.Fatalf("Expected stale v1 to be served, got %v (%v)", item, err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if item := cache.Peek("k"); item != nil && item.Value == "v2" {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if item := cache.Peek("k"); item == nil || item.Value != "v2" {
+		t.Fatal("Background revalidation did not update the cache")
+	}
+
+	// An expired document is never served; the fetch error is returned
+	expired := decodeWith(Validity{ExpiresAt: time.Now().Add(-time.Second)})
+	cache.Refresh("e", src.fetch, expired)
+	src.set("", errors.New("responder down"))
+	if _, err := cache.Get("e", src.fetch, expired); err == nil {
+		t.Error("Expired document should not be served when the fetch fails")
+	}
+}
+
+// TestPersistence tests that documents survive a restart and invalid ones are rejected
+func TestPersistence(t *testing.T) {
+	dir := t.TempDir()
+	src := &fakeSource{payload: "persisted"}
+	decode := decodeWith(Validity{RefreshAt: time.Now().Add(time.Hour)})
+
+	if _, err := New(dir).Get("k", src.fetch, decode); err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+
+	restarted := New(dir)
+	item, err := restarted.Get("k", src.fetch, decode)
+	if err != nil || item.Value != "persisted" {
+		t.Fatalf("Expected persisted document, got %v (%v)", item, err)
+	}
+	if n := src.fetches.Load(); n != 1 {
+		t.Errorf("Restart should not refetch, got %d fetches", n)
+	}
+
+	// A failed refresh keeps the previous copy
+	src.set("invalid", nil)
+	if _, err := restarted.Refresh("k", src.fetch, decode); err == nil {
+		t.Error("Invalid document should be rejected")
+	}
+	if item := restarted.Peek("k"); item == nil || item.Value != "persisted" {
+		t.Error("Failed refresh should keep the cached copy")
+	}
+}
@@ -0,0 +1,137 @@
+// Package grpccreds provides gRPC client transport credentials that present
+// the certificate currently held by a tlsstore.CertificateProvider, mirroring
+// the server side, where GetCertificate reads the store on every handshake.
+package grpccreds
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+
+	"tls-agent/internal/tlsstore"
+
+	"google.golang.org/grpc/credentials"
+)
+
+var errServerHandshake = errors.New("grpccreds: client credentials cannot serve")
+
+// Credentials are client TransportCredentials presenting the store's
+// certificate on every handshake. gRPC keeps connections open indefinitely,
+// so after a rotation Rotate closes those established with the previous
+// certificate; gRPC then reconnects with the new one.
+type Credentials struct {
+	store tlsstore.CertificateProvider
+	base  *tls.Config
+
+	mu    sync.Mutex
+	conns map[*conn][]byte
+}
+
+// New returns credentials presenting store's certificate. base supplies the
+// server verification settings (RootCAs, ServerName); nil verifies against
+// the system roots.
+func New(store tlsstore.CertificateProvider, base *tls.Config) *Credentials {
+	if base == nil {
+		base = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	return &Credentials{store: store, base: base.Clone(), conns: make(map[*conn][]byte)}
+}
+
+// ClientHandshake performs the TLS handshake on raw and records which
+// certificate was presented, for Rotate
+func (c *Credentials) ClientHandshake(ctx context.Context, authority string, raw net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	var presented []byte
+	cfg := c.base.Clone()
+	cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		cert, err := c.store.GetCertificate(nil)
+		if err != nil {
+			return nil, err
+		}
+		presented = cert.Certificate[0]
+		return cert, nil
+	}
+
+	secure, info, err := credentials.NewTLS(cfg).ClientHandshake(ctx, authority, raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	if presented == nil {
+		// The server did not ask for a certificate, so rotations do not
+		// affect this connection
+		return secure, info, nil
+	}
+
+	tracked := &conn{Conn: secure, creds: c}
+	c.mu.Lock()
+	c.conns[tracked] = presented
+	c.mu.Unlock()
+	return tracked, info, nil
+}
+
+// ServerHandshake is not supported; these are client credentials
+func (c *Credentials) ServerHandshake(net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return nil, nil, errServerHandshake
+}
+
+// Info returns the TLS protocol information
+func (c *Credentials) Info() credentials.ProtocolInfo {
+	return credentials.NewTLS(c.base).Info()
+}
+
+// Clone returns credentials sharing the store but tracking connections
+// separately
+func (c *Credentials) Clone() credentials.TransportCredentials {
+	return New(c.store, c.base)
+}
+
+// OverrideServerName sets the name verified in the server certificate.
+//
+// Deprecated: use grpc.WithAuthority instead, as gRPC does.
+func (c *Credentials) OverrideServerName(name string) error {
+	c.base.ServerName = name
+	return nil
+}
+
+// Rotate closes the connections that presented a certificate other than the
+// store's current one and returns how many were closed. Call it after the
+// store is updated; gRPC re-establishes the connections with the new
+// certificate.
+func (c *Credentials) Rotate() int {
+	current, err := c.store.GetCertificate(nil)
+	if err != nil {
+		return 0
+	}
+
+	var stale []*conn
+	c.mu.Lock()
+	for tracked, presented := range c.conns {
+		if !bytes.Equal(presented, current.Certificate[0]) {
+			stale = append(stale, tracked)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, tracked := range stale {
+		tracked.Close()
+	}
+	return len(stale)
+}
+
+// conn removes itself from the tracked connections when closed
+type conn struct {
+	net.Conn
+	creds *Credentials
+	once  sync.Once
+}
+
+func (c *conn) Close() error {
+	c.once.Do(func() {
+		c.creds.mu.Lock()
+		delete(c.creds.conns, c)
+		c.creds.mu.Unlock()
+	})
+	return c.Conn.Close()
+}
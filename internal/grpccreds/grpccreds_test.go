@@ -0,0 +1,81 @@
+package grpccreds
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tls-agent/internal/tlsstore"
+	"tls-agent/pkg/agenttest"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// TestRotate tests that every handshake presents the store's certificate and
+// that Rotate makes gRPC reconnect with a new one
+func TestRotate(t *testing.T) {
+	ca := agenttest.NewCA(t)
+	serverCert := ca.IssueTLS(t, "localhost")
+	var seen atomic.Value
+	serverCreds := credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{*serverCert},
+		ClientAuth:   tls.RequireAnyClientCert,
+		VerifyPeerCertificate: func(raw [][]byte, _ [][]*x509.Certificate) error {
+			cert, err := x509.ParseCertificate(raw[0])
+			if err == nil {
+				seen.Store(cert.Subject.CommonName)
+			}
+			return err
+		},
+	})
+	server := grpc.NewServer(grpc.Creds(serverCreds))
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	go server.Serve(ln)
+	defer server.Stop()
+
+	store := tlsstore.New(ca.IssueTLS(t, "client-1"))
+	creds := New(store, &tls.Config{RootCAs: ca.Pool, ServerName: "localhost"})
+
+	conn, err := grpc.NewClient(ln.Addr().String(), grpc.WithTransportCredentials(creds))
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+	check := func() {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{}, grpc.WaitForReady(true)); err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+	}
+
+	check()
+	if got := seen.Load(); got != "client-1" {
+		t.Fatalf("Server saw %v, want client-1", got)
+	}
+	if n := creds.Rotate(); n != 0 {
+		t.Errorf("Rotate closed %d connections before any rotation", n)
+	}
+
+	store.Update(ca.IssueTLS(t, "client-2"))
+	if n := creds.Rotate(); n != 1 {
+		t.Errorf("Rotate closed %d connections, want 1", n)
+	}
+	check()
+	if got := seen.Load(); got != "client-2" {
+		t.Errorf("Server saw %v after rotation, want client-2", got)
+	}
+}
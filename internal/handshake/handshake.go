@@ -0,0 +1,281 @@
+// Package handshake performs TLS handshakes for a listener under limits on
+// concurrency and rate, so scans, reconnect storms and renewal-triggered
+// reconnects cannot exhaust CPU on small instances. Connections are handed
+// to the server only once their handshake has completed.
+package handshake
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"tls-agent/internal/clock"
+	"tls-agent/internal/connfilter"
+	"tls-agent/internal/metrics"
+)
+
+// Handshake results reported in metrics
+const (
+	ResultOK          = "ok"
+	ResultFailed      = "failed"
+	ResultRateLimited = "rate_limited"
+	ResultOverflow    = "overflow"
+)
+
+var (
+	handshakes = metrics.NewCounterVec("tls_agent_handshakes_total",
+		"TLS handshakes by listener and result (ok, failed, rate_limited, overflow)", "listener", "result")
+	inFlight = metrics.NewGauge("tls_agent_handshakes_in_flight", "TLS handshakes currently running")
+	queued   = metrics.NewGauge("tls_agent_handshakes_queued", "TLS handshakes waiting for a concurrency slot")
+)
+
+// Defaults for zero Limits durations
+const (
+	DefaultQueueTimeout = 5 * time.Second
+	DefaultTimeout      = 10 * time.Second
+)
+
+// Limits bounds handshake work. The zero value only applies DefaultTimeout.
+type Limits struct {
+	// MaxConcurrent caps handshakes running at once (0 = unlimited)
+	MaxConcurrent int
+
+	// Rate is how many handshakes per second may start across all
+	// listeners (0 = unlimited), with bursts up to Burst
+	Rate  float64
+	Burst int
+
+	// RatePerIP and BurstPerIP limit handshakes from one client address
+	RatePerIP  float64
+	BurstPerIP int
+
+	// Reject closes connections arriving while MaxConcurrent handshakes
+	// are running instead of queueing them
+	Reject bool
+
+	// QueueTimeout is how long a queued connection waits for a slot
+	QueueTimeout time.Duration
+
+	// Timeout bounds each handshake
+	Timeout time.Duration
+}
+
+// Limiter enforces Limits across every listener it wraps
+type Limiter struct {
+	limits Limits
+	slots  chan struct{}
+	perIP  *connfilter.Filter
+	clock  clock.Clock
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+
+	running, waiting atomic.Int64
+}
+
+// NewLimiter creates a limiter for limits
+func NewLimiter(limits Limits) *Limiter {
+	if limits.QueueTimeout <= 0 {
+		limits.QueueTimeout = DefaultQueueTimeout
+	}
+	if limits.Timeout <= 0 {
+		limits.Timeout = DefaultTimeout
+	}
+	l := &Limiter{limits: limits, clock: clock.Real{}, tokens: float64(max(limits.Burst, 1))}
+	if limits.MaxConcurrent > 0 {
+		l.slots = make(chan struct{}, limits.MaxConcurrent)
+	}
+	if limits.RatePerIP > 0 {
+		l.perIP = &connfilter.Filter{Rate: limits.RatePerIP, Burst: limits.BurstPerIP}
+	}
+	return l
+}
+
+// SetClock refills the rate limits and times queued connections out by c
+// instead of the wall clock; handshake timeouts stay on the wall clock. It
+// must be called before the first listener is wrapped.
+func (l *Limiter) SetClock(c clock.Clock) {
+	l.clock = clock.Or(c)
+	if l.perIP != nil {
+		l.perIP.Clock = c
+	}
+}
+
+// allow reports whether a handshake from addr is within the rate limits
+func (l *Limiter) allow(addr netip.Addr, ok bool) bool {
+	if ok && l.perIP != nil && l.perIP.Check(addr) != "" {
+		return false
+	}
+	if l.limits.Rate <= 0 {
+		return true
+	}
+	now := l.clock.Now()
+	burst := float64(max(l.limits.Burst, 1))
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.last.IsZero() {
+		l.tokens = min(burst, l.tokens+now.Sub(l.last).Seconds()*l.limits.Rate)
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// acquire takes a concurrency slot, queueing unless Reject is set. It
+// reports false when no slot became available.
+func (l *Limiter) acquire(done <-chan struct{}) bool {
+	if l.slots == nil {
+		return true
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+	}
+	if l.limits.Reject {
+		return false
+	}
+
+	queued.Set(float64(l.waiting.Add(1)))
+	defer func() { queued.Set(float64(l.waiting.Add(-1))) }()
+	timer := l.clock.NewTimer(l.limits.QueueTimeout)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-timer.C():
+		return false
+	case <-done:
+		return false
+	}
+}
+
+func (l *Limiter) release() {
+	if l.slots != nil {
+		<-l.slots
+	}
+}
+
+// Listen returns a listener yielding *tls.Conn connections from ln whose
+// handshakes with config completed within the limits; name labels the
+// listener in metrics. config should advertise the application protocols
+// the server speaks, as http.Server.Serve does not add "h2" itself.
+func (l *Limiter) Listen(name string, ln net.Listener, config *tls.Config) net.Listener {
+	hl := &listener{
+		Listener: ln,
+		name:     name,
+		config:   config,
+		limiter:  l,
+		conns:    make(chan net.Conn),
+		errs:     make(chan error),
+		done:     make(chan struct{}),
+	}
+	go hl.acceptLoop()
+	return hl
+}
+
+// listener runs handshakes in the background and hands completed
+// connections to Accept
+type listener struct {
+	net.Listener
+	name    string
+	config  *tls.Config
+	limiter *Limiter
+
+	conns     chan net.Conn
+	errs      chan error
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Accept returns the next connection whose handshake completed
+func (l *listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case err := <-l.errs:
+		return nil, err
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close stops accepting; handshakes in progress are abandoned
+func (l *listener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return l.Listener.Close()
+}
+
+func (l *listener) acceptLoop() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			select {
+			case l.errs <- err:
+			case <-l.done:
+				return
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		addr, ok := remoteAddr(conn)
+		if !l.limiter.allow(addr, ok) {
+			handshakes.With(l.name, ResultRateLimited).Inc()
+			conn.Close()
+			continue
+		}
+		go l.handshake(conn)
+	}
+}
+
+func (l *listener) handshake(conn net.Conn) {
+	if !l.limiter.acquire(l.done) {
+		handshakes.With(l.name, ResultOverflow).Inc()
+		conn.Close()
+		return
+	}
+	inFlight.Set(float64(l.limiter.running.Add(1)))
+
+	tlsConn := tls.Server(conn, l.config)
+	ctx, cancel := context.WithTimeout(context.Background(), l.limiter.limits.Timeout)
+	err := tlsConn.HandshakeContext(ctx)
+	cancel()
+
+	inFlight.Set(float64(l.limiter.running.Add(-1)))
+	l.limiter.release()
+	if err != nil {
+		handshakes.With(l.name, ResultFailed).Inc()
+		conn.Close()
+		return
+	}
+	handshakes.With(l.name, ResultOK).Inc()
+
+	select {
+	case l.conns <- tlsConn:
+	case <-l.done:
+		tlsConn.Close()
+	}
+}
+
+func remoteAddr(conn net.Conn) (netip.Addr, bool) {
+	if tcp, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		return tcp.AddrPort().Addr().Unmap(), true
+	}
+	ap, err := netip.ParseAddrPort(conn.RemoteAddr().String())
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return ap.Addr().Unmap(), true
+}
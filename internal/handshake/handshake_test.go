@@ -0,0 +1,105 @@
+package handshake
+
+import (
+	"crypto/tls"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"tls-agent/internal/clock"
+	"tls-agent/internal/metrics/metricstest"
+	"tls-agent/pkg/agenttest"
+)
+
+// TestListener tests that accepted connections have completed their handshake
+func TestListener(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	limiter := NewLimiter(Limits{MaxConcurrent: 1})
+	hl := limiter.Listen("test", ln, &tls.Config{Certificates: []tls.Certificate{*agenttest.NewCA(t).IssueTLS(t, "localhost")}, NextProtos: []string{"h2"}})
+	defer hl.Close()
+	ok := metricstest.Delta(handshakes.With("test", ResultOK))
+
+	go func() {
+		conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"h2"}})
+		if err == nil {
+			defer conn.Close()
+			_, _ = conn.Read(make([]byte, 1))
+		}
+	}()
+
+	conn, err := hl.Accept()
+	if err != nil {
+		t.Fatalf("Failed to accept: %v", err)
+	}
+	defer conn.Close()
+	state := conn.(*tls.Conn).ConnectionState()
+	if !state.HandshakeComplete || state.NegotiatedProtocol != "h2" {
+		t.Errorf("Expected a completed h2 handshake, got %+v", state)
+	}
+	if got := ok(); got != 1 {
+		t.Errorf("Expected 1 successful handshake, got %d", got)
+	}
+
+	hl.Close()
+	if _, err := hl.Accept(); err == nil {
+		t.Error("Expected Accept to fail after Close")
+	}
+}
+
+// TestRate tests the global and per-address handshake rates
+func TestRate(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1000, 0))
+	l := NewLimiter(Limits{Rate: 1, Burst: 2, RatePerIP: 10, BurstPerIP: 1})
+	l.SetClock(fake)
+	a := netip.MustParseAddr("192.0.2.1")
+	b := netip.MustParseAddr("192.0.2.2")
+
+	if !l.allow(a, true) {
+		t.Fatal("Expected the first handshake to be allowed")
+	}
+	if l.allow(a, true) {
+		t.Error("Expected the per-address burst to be exhausted")
+	}
+	if !l.allow(b, true) {
+		t.Error("Expected another address within the global burst to be allowed")
+	}
+	if l.allow(netip.MustParseAddr("192.0.2.3"), true) {
+		t.Error("Expected the global burst to be exhausted")
+	}
+
+	fake.Advance(time.Second)
+	if !l.allow(netip.Addr{}, false) {
+		t.Error("Expected a global token after a second at 1/s")
+	}
+}
+
+// TestOverflow tests queueing and rejecting beyond the concurrency cap
+func TestOverflow(t *testing.T) {
+	done := make(chan struct{})
+
+	reject := NewLimiter(Limits{MaxConcurrent: 1, Reject: true})
+	if !reject.acquire(done) {
+		t.Fatal("Expected a free slot")
+	}
+	if reject.acquire(done) {
+		t.Error("Expected overflow to be rejected")
+	}
+	reject.release()
+	if !reject.acquire(done) {
+		t.Error("Expected the released slot to be available")
+	}
+
+	queue := NewLimiter(Limits{MaxConcurrent: 1, QueueTimeout: 50 * time.Millisecond})
+	queue.acquire(done)
+	if queue.acquire(done) {
+		t.Error("Expected the queue wait to time out")
+	}
+	time.AfterFunc(10*time.Millisecond, queue.release)
+	if !queue.acquire(done) {
+		t.Error("Expected a queued handshake to get the released slot")
+	}
+}
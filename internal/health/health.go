@@ -0,0 +1,97 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// CheckFunc reports the health of one subsystem. It returns an error when
+// unhealthy and may return optional details to include in the report.
+type CheckFunc func() (details any, err error)
+
+// Result is the outcome of a single check
+type Result struct {
+	OK      bool   `json:"ok"`
+	Error   string `json:"error,omitempty"`
+	Details any    `json:"details,omitempty"`
+}
+
+// Report is the JSON document served by the health endpoint
+type Report struct {
+	Status    string            `json:"status"`
+	CheckedAt time.Time         `json:"checked_at"`
+	Checks    map[string]Result `json:"checks"`
+}
+
+// Registry holds named health checks
+type Registry struct {
+	mu     sync.RWMutex
+	checks map[string]CheckFunc
+}
+
+// Default is the registry used by the package-level functions
+var Default = NewRegistry()
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{checks: make(map[string]CheckFunc)}
+}
+
+// Register adds or replaces a named check
+func (r *Registry) Register(name string, check CheckFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks[name] = check
+}
+
+// Register adds a check to the default registry
+func Register(name string, check CheckFunc) {
+	Default.Register(name, check)
+}
+
+// Run evaluates all checks
+func (r *Registry) Run() Report {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.checks))
+	for name := range r.checks {
+		names = append(names, name)
+	}
+	r.mu.RUnlock()
+	sort.Strings(names)
+
+	report := Report{Status: "ok", CheckedAt: time.Now(), Checks: make(map[string]Result, len(names))}
+	for _, name := range names {
+		r.mu.RLock()
+		check := r.checks[name]
+		r.mu.RUnlock()
+
+		details, err := check()
+		result := Result{OK: err == nil, Details: details}
+		if err != nil {
+			result.Error = err.Error()
+			report.Status = "unhealthy"
+		}
+		report.Checks[name] = result
+	}
+	return report
+}
+
+// Handler serves the registry as JSON, returning 503 when any check fails
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		report := r.Run()
+		w.Header().Set("Content-Type", "application/json")
+		if report.Status != "ok" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(report)
+	})
+}
+
+// Handler serves the default registry
+func Handler() http.Handler {
+	return Default.Handler()
+}
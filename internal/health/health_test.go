@@ -0,0 +1,40 @@
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestRegistryHandler tests status codes and report contents
+func TestRegistryHandler(t *testing.T) {
+	r := NewRegistry()
+	r.Register("always_ok", func() (any, error) { return map[string]int{"n": 1}, nil })
+
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200, got %d", rec.Code)
+	}
+
+	r.Register("broken", func() (any, error) { return nil, errors.New("watcher died") })
+
+	rec = httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503, got %d", rec.Code)
+	}
+
+	var report Report
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if report.Status != "unhealthy" || report.Checks["broken"].Error != "watcher died" {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+	if !report.Checks["always_ok"].OK {
+		t.Error("Passing check should be reported as ok")
+	}
+}
@@ -0,0 +1,110 @@
+// Package heartbeat periodically reports agent status to an external
+// monitor, so an agent that dies silently is noticed when the heartbeats
+// stop. It works with plain JSON receivers and with dead man's switch
+// services such as healthchecks.io or Dead Man's Snitch.
+package heartbeat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"tls-agent/internal/metrics"
+)
+
+var (
+	sent = metrics.NewCounterVec("tls_agent_heartbeats_total",
+		"Heartbeats sent by result (ok, error)", "result")
+	lastSuccess = metrics.NewGauge("tls_agent_heartbeat_last_success_timestamp_seconds",
+		"Time of the last delivered heartbeat as a Unix timestamp")
+)
+
+// Status is the heartbeat payload
+type Status struct {
+	Time              time.Time `json:"time"`
+	Host              string    `json:"host"`
+	Healthy           bool      `json:"healthy"`
+	CertificateExpiry time.Time `json:"certificate_expiry,omitzero"`
+	LastReload        time.Time `json:"last_reload,omitzero"`
+	LastReloadResult  string    `json:"last_reload_result,omitempty"`
+	LastError         string    `json:"last_error,omitempty"`
+	Health            any       `json:"health,omitempty"`
+}
+
+// Sender posts heartbeats
+type Sender struct {
+	// URL receives a POST of the status as JSON
+	URL string
+
+	// FailURL, if set, receives the heartbeat instead while the agent is
+	// unhealthy (e.g. a healthchecks.io ".../fail" URL)
+	FailURL string
+
+	// Interval is the time between heartbeats
+	Interval time.Duration
+
+	// Status returns the current status
+	Status func() Status
+
+	// Client sends the requests; nil uses a client with a 10s timeout
+	Client *http.Client
+}
+
+// Send posts one heartbeat
+func (s *Sender) Send(ctx context.Context) error {
+	status := s.Status()
+	body, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	url := s.URL
+	if !status.Healthy && s.FailURL != "" {
+		url = s.FailURL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		sent.With("error").Inc()
+		return fmt.Errorf("heartbeat: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode/100 != 2 {
+		sent.With("error").Inc()
+		return fmt.Errorf("heartbeat: %s returned %s", url, resp.Status)
+	}
+	sent.With("ok").Inc()
+	lastSuccess.Set(float64(time.Now().Unix()))
+	return nil
+}
+
+// Run sends a heartbeat immediately and then every Interval until ctx is
+// cancelled. Failures are logged; the next heartbeat is attempted anyway.
+func (s *Sender) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	for {
+		if err := s.Send(ctx); err != nil && ctx.Err() == nil {
+			log.Println("Heartbeat:", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package heartbeat
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tls-agent/internal/metrics/metricstest"
+)
+
+// TestSend tests posting the status and routing failures to the fail URL
+func TestSend(t *testing.T) {
+	var paths []string
+	var got Status
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	expiry := time.Now().Add(48 * time.Hour).Truncate(time.Second)
+	status := Status{Host: "agent-1", Healthy: true, CertificateExpiry: expiry}
+	s := &Sender{URL: srv.URL + "/ping", FailURL: srv.URL + "/ping/fail", Status: func() Status { return status }}
+	ok, errors := metricstest.Delta(sent.With("ok")), metricstest.Delta(sent.With("error"))
+
+	if err := s.Send(context.Background()); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	if got.Host != "agent-1" || !got.CertificateExpiry.Equal(expiry) {
+		t.Errorf("Unexpected payload %+v", got)
+	}
+
+	status.Healthy = false
+	status.LastError = "reload failed"
+	if err := s.Send(context.Background()); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	if paths[1] != "/ping/fail" || got.LastError != "reload failed" {
+		t.Errorf("Expected the unhealthy heartbeat on the fail URL, got %s %+v", paths[1], got)
+	}
+
+	s.URL, s.FailURL = srv.URL+"/down", ""
+	if err := s.Send(context.Background()); err == nil {
+		t.Error("Expected an error status to fail the heartbeat")
+	}
+	if ok() != 2 || errors() != 1 {
+		t.Errorf("Unexpected heartbeat counts: %d ok, %d errors", ok(), errors())
+	}
+}
@@ -0,0 +1,210 @@
+// Package hooks runs external commands on certificate events, e.g. to
+// reload nginx, restart a sidecar or update a load balancer after the
+// certificate changes. Commands run one at a time in event order on a
+// background worker, so a slow hook never delays a reload.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"tls-agent/internal/metrics"
+	"tls-agent/internal/notify"
+)
+
+// Defaults for Hook and Runner
+const (
+	DefaultTimeout = 30 * time.Second
+	queueSize      = 32
+	maxOutput      = 4096
+)
+
+var failures = metrics.NewCounterVec("tls_agent_hook_failures_total",
+	"Exec hook runs that failed or timed out", "hook")
+
+// Hook is a command run for a set of event types
+type Hook struct {
+	Name string
+
+	// Events lists the notify event types that run the hook
+	Events []string
+
+	// Command is the program and its arguments; it is not run by a shell
+	Command []string
+
+	// Timeout kills the command when exceeded; zero uses DefaultTimeout
+	Timeout time.Duration
+}
+
+// Runner queues hook runs for events. It implements notify.Notifier; Run
+// executes the queue.
+type Runner struct {
+	Hooks []Hook
+
+	// CertFile and KeyFile are passed to hooks as TLS_AGENT_CERT_FILE and
+	// TLS_AGENT_KEY_FILE
+	CertFile string
+	KeyFile  string
+
+	// Leaf returns the served certificate, whose SANs and expiry are passed
+	// to hooks; it may be nil
+	Leaf func() *x509.Certificate
+
+	queue chan job
+}
+
+// job is one hook run with its environment
+type job struct {
+	hook Hook
+	env  []string
+}
+
+// NewRunner creates a runner for hooks
+func NewRunner(hooks []Hook) *Runner {
+	return &Runner{Hooks: hooks, queue: make(chan job, queueSize)}
+}
+
+// Notify queues every hook subscribed to e. Runs are dropped with a log
+// line when the queue is full.
+func (r *Runner) Notify(_ context.Context, e notify.Event) error {
+	var env []string
+	for _, h := range r.Hooks {
+		if !slices.Contains(h.Events, e.Type) {
+			continue
+		}
+		if env == nil {
+			env = r.environment(e)
+		}
+		select {
+		case r.queue <- job{hook: h, env: env}:
+		default:
+			failures.With(h.Name).Inc()
+			return fmt.Errorf("hooks: queue full, dropped %s for %s", h.Name, e.Type)
+		}
+	}
+	return nil
+}
+
+// Run executes queued hooks until ctx is cancelled. A hook that is running
+// when ctx is cancelled is killed.
+func (r *Runner) Run(ctx context.Context) error {
+	for {
+		select {
+		case j := <-r.queue:
+			if err := run(ctx, j.hook, j.env); err != nil {
+				failures.With(j.hook.Name).Inc()
+				log.Printf("Hook %s: %v", j.hook.Name, err)
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// run executes one hook, logging its combined output
+func run(ctx context.Context, h Hook, env []string) error {
+	if len(h.Command) == 0 {
+		return errors.New("no command")
+	}
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, h.Command[0], h.Command[1:]...)
+	cmd.Env = append(os.Environ(), env...)
+	output := &limitedBuffer{limit: maxOutput}
+	cmd.Stdout = output
+	cmd.Stderr = output
+	// Do not wait for grandchildren holding the output pipes after a kill
+	cmd.WaitDelay = time.Second
+
+	started := time.Now()
+	err := cmd.Run()
+	for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+		if line != "" {
+			log.Printf("Hook %s: %s", h.Name, line)
+		}
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out after %s", timeout)
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("Hook %s: completed in %s", h.Name, time.Since(started).Round(time.Millisecond))
+	return nil
+}
+
+// environment returns the TLS_AGENT_* variables describing e. Every event
+// field is passed upper-cased (fingerprint becomes TLS_AGENT_FINGERPRINT).
+func (r *Runner) environment(e notify.Event) []string {
+	vars := map[string]string{
+		"EVENT":     e.Type,
+		"SEVERITY":  e.Severity,
+		"MESSAGE":   e.Message,
+		"CERT_FILE": r.CertFile,
+		"KEY_FILE":  r.KeyFile,
+	}
+	if !e.Time.IsZero() {
+		vars["TIME"] = e.Time.UTC().Format(time.RFC3339)
+	}
+	if r.Leaf != nil {
+		if leaf := r.Leaf(); leaf != nil {
+			vars["SANS"] = strings.Join(sans(leaf), ",")
+			vars["SUBJECT"] = leaf.Subject.String()
+			vars["NOT_AFTER"] = leaf.NotAfter.UTC().Format(time.RFC3339)
+		}
+	}
+	for k, v := range e.Fields {
+		vars[strings.ToUpper(k)] = v
+	}
+
+	env := make([]string, 0, len(vars))
+	for k, v := range vars {
+		env = append(env, "TLS_AGENT_"+k+"="+v)
+	}
+	slices.Sort(env)
+	return env
+}
+
+// sans returns the subject alternative names of leaf
+func sans(leaf *x509.Certificate) []string {
+	names := slices.Clone(leaf.DNSNames)
+	for _, ip := range leaf.IPAddresses {
+		names = append(names, ip.String())
+	}
+	for _, u := range leaf.URIs {
+		names = append(names, u.String())
+	}
+	names = append(names, leaf.EmailAddresses...)
+	return names
+}
+
+// limitedBuffer keeps the first limit bytes written to it
+type limitedBuffer struct {
+	buf   bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); room > 0 {
+		b.buf.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	return b.buf.String()
+}
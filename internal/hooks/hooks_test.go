@@ -0,0 +1,145 @@
+package hooks
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"tls-agent/internal/notify"
+)
+
+func skipWithoutShell(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook tests use /bin/sh")
+	}
+}
+
+// TestRunnerRunsMatchingHooks tests that subscribed hooks run with the
+// event environment and others do not
+func TestRunnerRunsMatchingHooks(t *testing.T) {
+	skipWithoutShell(t)
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+
+	r := NewRunner([]Hook{
+		{Name: "record", Events: []string{notify.EventReloadSucceeded},
+			Command: []string{"sh", "-c", `echo "$TLS_AGENT_EVENT $TLS_AGENT_FINGERPRINT $TLS_AGENT_SANS $TLS_AGENT_KEY_FILE" > "$0"`, out}},
+		{Name: "unrelated", Events: []string{notify.EventReloadFailed},
+			Command: []string{"sh", "-c", `touch "$0"`, filepath.Join(dir, "unrelated")}},
+	})
+	r.KeyFile = "/etc/tls/server.key"
+	r.Leaf = func() *x509.Certificate {
+		return &x509.Certificate{DNSNames: []string{"www.example.com"}, IPAddresses: []net.IP{net.ParseIP("10.0.0.1")}}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	err := r.Notify(ctx, notify.Event{Type: notify.EventReloadSucceeded, Fields: map[string]string{"fingerprint": "abc123"}})
+	if err != nil {
+		t.Fatalf("Failed to queue hook: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	var data []byte
+	for time.Now().Before(deadline) {
+		if data, err = os.ReadFile(out); err == nil && len(data) > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got, want := strings.TrimSpace(string(data)), "reload_succeeded abc123 www.example.com,10.0.0.1 /etc/tls/server.key"; got != want {
+		t.Errorf("Expected hook output %q, got %q", want, got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "unrelated")); !os.IsNotExist(err) {
+		t.Error("Expected hooks for other events not to run")
+	}
+}
+
+// TestRunTimeout tests that a hook exceeding its timeout is killed
+func TestRunTimeout(t *testing.T) {
+	skipWithoutShell(t)
+	started := time.Now()
+	err := run(context.Background(), Hook{Name: "slow", Command: []string{"sleep", "10"}, Timeout: 100 * time.Millisecond}, nil)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Expected a timeout error, got %v", err)
+	}
+	if time.Since(started) > 5*time.Second {
+		t.Error("Expected the hook to be killed at its timeout")
+	}
+
+	if err := run(context.Background(), Hook{Name: "fails", Command: []string{"sh", "-c", "exit 3"}}, nil); err == nil {
+		t.Error("Expected a non-zero exit to be reported")
+	}
+	if err := run(context.Background(), Hook{Name: "empty"}, nil); err == nil {
+		t.Error("Expected an error for a hook without a command")
+	}
+}
+
+// TestEnvironment tests the variables passed to hooks
+func TestEnvironment(t *testing.T) {
+	r := NewRunner(nil)
+	r.CertFile = "/etc/tls/server.crt"
+	r.Leaf = func() *x509.Certificate {
+		return &x509.Certificate{Subject: pkix.Name{CommonName: "www"}, NotAfter: time.Date(2027, 1, 2, 3, 4, 5, 0, time.UTC)}
+	}
+	env := r.environment(notify.Event{
+		Type:     notify.EventCertificateExpiring,
+		Severity: notify.SeverityWarning,
+		Fields:   map[string]string{"trigger": "expiry"},
+	})
+	for _, want := range []string{
+		"TLS_AGENT_EVENT=certificate_expiring",
+		"TLS_AGENT_SEVERITY=warning",
+		"TLS_AGENT_CERT_FILE=/etc/tls/server.crt",
+		"TLS_AGENT_NOT_AFTER=2027-01-02T03:04:05Z",
+		"TLS_AGENT_SUBJECT=CN=www",
+		"TLS_AGENT_TRIGGER=expiry",
+	} {
+		if !slices.Contains(env, want) {
+			t.Errorf("Expected %s in %v", want, env)
+		}
+	}
+}
+
+// TestNotifyQueueFull tests that runs are dropped rather than blocking
+func TestNotifyQueueFull(t *testing.T) {
+	r := NewRunner([]Hook{{Name: "hup", Events: []string{notify.EventReloadSucceeded}, Command: []string{"true"}}})
+	event := notify.Event{Type: notify.EventReloadSucceeded}
+	for range queueSize {
+		if err := r.Notify(context.Background(), event); err != nil {
+			t.Fatalf("Failed to queue hook: %v", err)
+		}
+	}
+	if err := r.Notify(context.Background(), event); err == nil {
+		t.Error("Expected an error when the queue is full")
+	}
+}
+
+// TestLimitedBuffer tests that captured output is truncated
+func TestLimitedBuffer(t *testing.T) {
+	b := &limitedBuffer{limit: 4}
+	if n, err := b.Write([]byte("abcdef")); n != 6 || err != nil {
+		t.Errorf("Expected the full write to be accepted, got %d, %v", n, err)
+	}
+	b.Write([]byte("gh"))
+	if b.String() != "abcd" {
+		t.Errorf("Expected abcd, got %q", b.String())
+	}
+}
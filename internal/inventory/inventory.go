@@ -0,0 +1,163 @@
+// Package inventory lists every certificate the agent serves, for fleet
+// inventory tooling: where it came from, what it covers, who issued it, when
+// it expires and was last rotated, and its OCSP state.
+package inventory
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"tls-agent/internal/agent"
+	"tls-agent/internal/stapling"
+	"tls-agent/internal/tlsstore"
+)
+
+// DefaultName names the certificate served to clients without a dedicated one
+const DefaultName = "default"
+
+// OCSP states reported besides the responder's "good", "revoked" and "unknown"
+const (
+	// OCSPDisabled means stapling is turned off
+	OCSPDisabled = "disabled"
+
+	// OCSPUnavailable means there is no response, e.g. because the chain has
+	// no issuer or the responder has not answered yet
+	OCSPUnavailable = "unavailable"
+
+	// OCSPStale means the last good response has passed its next update
+	OCSPStale = "stale"
+)
+
+// Certificate is one inventory entry
+type Certificate struct {
+	// Name is DefaultName or the first server name of an SNI certificate
+	Name        string   `json:"name"`
+	ServerNames []string `json:"server_names,omitempty"`
+	Source      string   `json:"source,omitempty"`
+
+	Subject     string    `json:"subject"`
+	SANs        []string  `json:"sans"`
+	Issuer      string    `json:"issuer"`
+	Serial      string    `json:"serial"`
+	NotBefore   time.Time `json:"not_before"`
+	NotAfter    time.Time `json:"not_after"`
+	Fingerprint string    `json:"fingerprint"`
+
+	// LastRotation is when the agent started serving this certificate
+	LastRotation time.Time `json:"last_rotation"`
+
+	OCSP       string `json:"ocsp"`
+	MustStaple bool   `json:"must_staple"`
+}
+
+// Inventory describes the certificates in Store
+type Inventory struct {
+	Store *tlsstore.Store
+
+	// DefaultSource describes where the default certificate is loaded from
+	DefaultSource string
+
+	// Stapler reports OCSP state; nil when stapling is disabled
+	Stapler *stapling.Manager
+}
+
+// List returns the default certificate followed by the SNI certificates
+func (inv *Inventory) List() []Certificate {
+	managed := inv.Store.Certificates()
+	out := make([]Certificate, 0, len(managed))
+	for _, m := range managed {
+		c := Certificate{
+			Name:         DefaultName,
+			ServerNames:  m.Names,
+			Source:       m.Source,
+			Fingerprint:  agent.Fingerprint(m.Cert),
+			LastRotation: m.Since,
+			OCSP:         inv.ocsp(m.Cert),
+		}
+		if len(m.Names) > 0 {
+			c.Name = m.Names[0]
+		} else if c.Source == "" {
+			c.Source = inv.DefaultSource
+		}
+		if leaf := m.Leaf; leaf != nil {
+			c.Subject = leaf.Subject.String()
+			c.SANs = sans(leaf)
+			c.Issuer = leaf.Issuer.String()
+			c.Serial = leaf.SerialNumber.Text(16)
+			c.NotBefore = leaf.NotBefore
+			c.NotAfter = leaf.NotAfter
+			c.MustStaple = stapling.MustStaple(leaf)
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// ocsp returns the OCSP state of cert
+func (inv *Inventory) ocsp(cert *tls.Certificate) string {
+	if inv.Stapler == nil {
+		return OCSPDisabled
+	}
+	status, ok := inv.Stapler.StatusOf(cert)
+	switch {
+	case !ok || status.Response == "":
+		return OCSPUnavailable
+	case status.Response == "good" && !status.Fresh:
+		return OCSPStale
+	}
+	return status.Response
+}
+
+// sans returns the subject alternative names of leaf as strings
+func sans(leaf *x509.Certificate) []string {
+	out := append([]string{}, leaf.DNSNames...)
+	for _, ip := range leaf.IPAddresses {
+		out = append(out, ip.String())
+	}
+	out = append(out, leaf.EmailAddresses...)
+	for _, uri := range leaf.URIs {
+		out = append(out, uri.String())
+	}
+	return out
+}
+
+// Handler serves the inventory as JSON, or as a table with ?format=table
+func (inv *Inventory) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		certs := inv.List()
+		if r.URL.Query().Get("format") == "table" {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			WriteTable(w, certs)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(struct {
+			Certificates []Certificate `json:"certificates"`
+		}{certs})
+	})
+}
+
+// WriteTable formats certificates as a human-readable table
+func WriteTable(out io.Writer, certs []Certificate) {
+	if len(certs) == 0 {
+		fmt.Fprintln(out, "No certificates")
+		return
+	}
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSANS\tISSUER\tSERIAL\tEXPIRES\tROTATED\tOCSP\tSOURCE")
+	for _, c := range certs {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			c.Name, strings.Join(c.SANs, ","), c.Issuer, c.Serial,
+			c.NotAfter.Local().Format(time.RFC3339), c.LastRotation.Local().Format(time.RFC3339),
+			c.OCSP, c.Source)
+	}
+	w.Flush()
+}
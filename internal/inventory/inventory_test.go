@@ -0,0 +1,99 @@
+package inventory
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"tls-agent/internal/stapling"
+	"tls-agent/internal/tlsstore"
+	"tls-agent/pkg/agenttest"
+)
+
+// TestList tests the inventory of default and SNI certificates
+func TestList(t *testing.T) {
+	store := tlsstore.New(agenttest.NewCA(t).Sign(t, &x509.Certificate{
+		SerialNumber: big.NewInt(0xabc),
+		DNSNames:     []string{"default.example.com"},
+		IPAddresses:  []net.IP{net.ParseIP("10.0.0.1")},
+	}, nil))
+	store.SetSNIFrom("certs/api.crt", agenttest.SelfSigned(t, &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "api.example.com"},
+		DNSNames: []string{"api.example.com"},
+	}, nil))
+
+	inv := &Inventory{Store: store, DefaultSource: "certs/server.crt"}
+	certs := inv.List()
+	if len(certs) != 2 {
+		t.Fatalf("Expected 2 certificates, got %d", len(certs))
+	}
+
+	def := certs[0]
+	if def.Name != DefaultName || def.Source != "certs/server.crt" || def.Serial != "abc" {
+		t.Errorf("Unexpected default certificate %+v", def)
+	}
+	if !slices.Equal(def.SANs, []string{"default.example.com", "10.0.0.1"}) {
+		t.Errorf("Expected DNS and IP SANs, got %v", def.SANs)
+	}
+	if def.OCSP != OCSPDisabled || def.LastRotation.IsZero() || len(def.Fingerprint) != 64 {
+		t.Errorf("Unexpected default certificate state %+v", def)
+	}
+
+	sni := certs[1]
+	if sni.Name != "api.example.com" || sni.Source != "certs/api.crt" || !strings.Contains(sni.Issuer, "api.example.com") {
+		t.Errorf("Unexpected SNI certificate %+v", sni)
+	}
+
+	// Certificates the stapler has not seen have no OCSP state
+	inv.Stapler = stapling.NewManager(stapling.MustStapleWarn, "")
+	if got := inv.List()[0].OCSP; got != OCSPUnavailable {
+		t.Errorf("Expected %q, got %q", OCSPUnavailable, got)
+	}
+}
+
+// TestHandler tests the JSON and table formats
+func TestHandler(t *testing.T) {
+	inv := &Inventory{Store: tlsstore.New(agenttest.NewCA(t).IssueTLS(t, "www.example.com")), DefaultSource: "certs/server.crt"}
+	srv := httptest.NewServer(inv.Handler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Failed to get inventory: %v", err)
+	}
+	var body struct {
+		Certificates []Certificate `json:"certificates"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	resp.Body.Close()
+	if err != nil || len(body.Certificates) != 1 || body.Certificates[0].SANs[0] != "www.example.com" {
+		t.Fatalf("Unexpected inventory %+v (%v)", body, err)
+	}
+
+	resp, err = http.Get(srv.URL + "?format=table")
+	if err != nil {
+		t.Fatalf("Failed to get inventory: %v", err)
+	}
+	var table bytes.Buffer
+	table.ReadFrom(resp.Body)
+	resp.Body.Close()
+	for _, want := range []string{"NAME", "default", "www.example.com", "certs/server.crt", OCSPDisabled} {
+		if !strings.Contains(table.String(), want) {
+			t.Errorf("Table missing %q:\n%s", want, table.String())
+		}
+	}
+
+	var empty bytes.Buffer
+	WriteTable(&empty, nil)
+	if !strings.Contains(empty.String(), "No certificates") {
+		t.Errorf("Unexpected empty table %q", empty.String())
+	}
+}
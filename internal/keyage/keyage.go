@@ -0,0 +1,180 @@
+// Package keyage tracks how long the served private key has been in use and
+// enforces a maximum key age, independent of certificate validity: a key
+// reused across renewals keeps ageing until it is replaced.
+package keyage
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"tls-agent/internal/clock"
+	"tls-agent/internal/metrics"
+	"tls-agent/internal/notify"
+	"tls-agent/internal/storage"
+	"tls-agent/internal/tlsstore"
+)
+
+// Actions taken when the key is older than MaxAge
+const (
+	ActionWarn    = "warn"
+	ActionReissue = "reissue"
+)
+
+var keyAge = metrics.NewGauge("tls_agent_key_age_seconds",
+	"Time the served private key has been in use")
+
+// Tracker records when each key was first seen, so its age survives
+// certificate renewals that reuse it and, with Storage, restarts. A key
+// seen for the first time is taken to be as old as its certificate.
+type Tracker struct {
+	// MaxAge is the age at which the key should be replaced
+	MaxAge time.Duration
+
+	// Action is ActionWarn or ActionReissue
+	Action string
+
+	// Reissue, if set, obtains a certificate with a new key; it is called
+	// for ActionReissue on every check until the key is replaced
+	Reissue func(ctx context.Context) error
+
+	// Current returns the served certificate
+	Current func() *tls.Certificate
+
+	// Notifier receives an EventKeyAgeExceeded once per key
+	Notifier notify.Notifier
+
+	// Storage, if set, persists first-seen times
+	Storage storage.Storage
+
+	// Clock judges key ages and schedules checks; defaults to the wall
+	// clock
+	Clock clock.Clock
+
+	mu      sync.Mutex
+	seen    map[string]time.Time
+	alerted string
+}
+
+// KeyID identifies cert's key by the SHA-256 of its public key
+func KeyID(cert *tls.Certificate) (string, error) {
+	leaf, err := tlsstore.ParseLeaf(cert)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(leaf.RawSubjectPublicKeyInfo)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (t *Tracker) now() time.Time {
+	return clock.Or(t.Clock).Now()
+}
+
+// Age returns how long cert's key has been in use
+func (t *Tracker) Age(cert *tls.Certificate) (time.Duration, error) {
+	id, err := KeyID(cert)
+	if err != nil {
+		return 0, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.seen == nil {
+		t.seen = make(map[string]time.Time)
+	}
+	first, ok := t.seen[id]
+	if !ok {
+		first = t.firstSeen(id, cert)
+		t.seen[id] = first
+	}
+	return t.now().Sub(first), nil
+}
+
+// firstSeen loads the first-seen time of id, recording it if unknown
+func (t *Tracker) firstSeen(id string, cert *tls.Certificate) time.Time {
+	if t.Storage != nil {
+		data, _, err := t.Storage.Get(id)
+		if err == nil {
+			if first, err := time.Parse(time.RFC3339, string(data)); err == nil {
+				return first
+			}
+		} else if !errors.Is(err, storage.ErrNotExist) {
+			log.Printf("Key age: %v", err)
+		}
+	}
+
+	first := t.now()
+	if cert.Leaf != nil && cert.Leaf.NotBefore.Before(first) {
+		first = cert.Leaf.NotBefore
+	}
+	if t.Storage != nil {
+		if err := t.Storage.Put(id, []byte(first.UTC().Format(time.RFC3339))); err != nil {
+			log.Printf("Key age: %v", err)
+		}
+	}
+	return first
+}
+
+// Check measures the current key's age and, past MaxAge, alerts and
+// reissues per Action
+func (t *Tracker) Check(ctx context.Context) error {
+	cert := t.Current()
+	if cert == nil {
+		return nil
+	}
+	age, err := t.Age(cert)
+	if err != nil {
+		return err
+	}
+	keyAge.Set(age.Seconds())
+	if t.MaxAge <= 0 || age < t.MaxAge {
+		return nil
+	}
+
+	id, _ := KeyID(cert)
+	message := fmt.Sprintf("private key has been in use for %s, maximum is %s", age.Round(time.Hour), t.MaxAge)
+	t.mu.Lock()
+	alert := t.alerted != id
+	t.alerted = id
+	t.mu.Unlock()
+	if alert {
+		log.Printf("Key age: %s", message)
+		notify.Send(t.Notifier, notify.Event{
+			Type:     notify.EventKeyAgeExceeded,
+			Severity: notify.SeverityWarning,
+			Message:  message,
+			Fields:   map[string]string{"key_id": id, "action": t.Action},
+		})
+	}
+
+	if t.Action != ActionReissue || t.Reissue == nil {
+		return nil
+	}
+	log.Println("Key age: reissuing with a new key")
+	if err := t.Reissue(ctx); err != nil {
+		return fmt.Errorf("key age: reissue: %w", err)
+	}
+	return nil
+}
+
+// Run checks every interval until ctx is done. Failed checks are logged and
+// retried on the next one.
+func (t *Tracker) Run(ctx context.Context, interval time.Duration) {
+	ticker := clock.Or(t.Clock).NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := t.Check(ctx); err != nil {
+			log.Println("Key age:", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package keyage
+
+import (
+	"context"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"testing"
+	"time"
+
+	"tls-agent/internal/clock"
+	"tls-agent/internal/notify"
+	"tls-agent/internal/storage"
+	"tls-agent/pkg/agenttest"
+)
+
+// TestAgeCarriesOverRenewals tests that a reused key keeps its age across
+// renewals and restarts
+func TestAgeCarriesOverRenewals(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	fake := clock.NewFake(now)
+	store := &storage.FS{Dir: t.TempDir()}
+	tracker := &Tracker{Storage: store, Clock: fake}
+
+	first := agenttest.SelfSigned(t, &x509.Certificate{NotBefore: now.Add(-10 * 24 * time.Hour)}, nil)
+	if age, err := tracker.Age(first); err != nil || age != 10*24*time.Hour {
+		t.Fatalf("Expected an unseen key to be as old as its certificate, got %s %v", age, err)
+	}
+
+	// A renewal reusing the key, seen after a restart
+	fake.Advance(24 * time.Hour)
+	now = fake.Now()
+	renewed := agenttest.SelfSigned(t, &x509.Certificate{NotBefore: now}, first.PrivateKey.(crypto.Signer))
+	restarted := &Tracker{Storage: store, Clock: fake}
+	if age, _ := restarted.Age(renewed); age != 11*24*time.Hour {
+		t.Errorf("Expected the reused key to keep ageing, got %s", age)
+	}
+	if age, _ := restarted.Age(agenttest.SelfSigned(t, &x509.Certificate{NotBefore: now}, nil)); age != 0 {
+		t.Errorf("Expected a new key to start at zero, got %s", age)
+	}
+}
+
+// TestCheck tests alerting once per key and reissuing past the maximum age
+func TestCheck(t *testing.T) {
+	cert := agenttest.SelfSigned(t, &x509.Certificate{NotBefore: time.Now().Add(-40 * 24 * time.Hour)}, nil)
+	var events []notify.Event
+	reissues := 0
+	tracker := &Tracker{
+		MaxAge:  30 * 24 * time.Hour,
+		Action:  ActionReissue,
+		Current: func() *tls.Certificate { return cert },
+		Notifier: notify.NotifierFunc(func(_ context.Context, e notify.Event) error {
+			events = append(events, e)
+			return nil
+		}),
+		Reissue: func(context.Context) error {
+			reissues++
+			return errors.New("order failed")
+		},
+	}
+
+	for range 2 {
+		if err := tracker.Check(context.Background()); err == nil {
+			t.Error("Expected the reissue failure to be returned")
+		}
+	}
+	if len(events) != 1 || events[0].Type != notify.EventKeyAgeExceeded {
+		t.Errorf("Expected one key age alert, got %+v", events)
+	}
+	if reissues != 2 {
+		t.Errorf("Expected a reissue attempt on every check, got %d", reissues)
+	}
+
+	// Warn-only and a fresh key do nothing more
+	tracker.Action = ActionWarn
+	cert = agenttest.SelfSigned(t, &x509.Certificate{NotBefore: time.Now()}, nil)
+	if err := tracker.Check(context.Background()); err != nil || reissues != 2 || len(events) != 1 {
+		t.Errorf("Expected no action for a fresh key, got %v, %d reissues, %d events", err, reissues, len(events))
+	}
+}
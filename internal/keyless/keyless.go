@@ -0,0 +1,281 @@
+package keyless
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"tls-agent/internal/metrics"
+	"tls-agent/internal/tlsstore"
+)
+
+var (
+	signRequests = metrics.NewCounterVec("tls_agent_keyless_sign_requests_total",
+		"Remote signing requests by key server and result", "server", "result")
+	failovers = metrics.NewCounter("tls_agent_keyless_failovers_total",
+		"Signing requests that had to fail over to another key server")
+)
+
+// SignRequest is the JSON body sent to a key server's /sign endpoint
+type SignRequest struct {
+	KeyID      string `json:"key_id"`
+	Digest     []byte `json:"digest"`
+	Hash       uint   `json:"hash"`
+	SaltLength *int   `json:"pss_salt_length,omitempty"`
+}
+
+// SignResponse is the JSON body returned by a key server
+type SignResponse struct {
+	Signature []byte `json:"signature,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// KeyID returns the identifier used to address a key on the key server:
+// the hex SHA-256 of its SubjectPublicKeyInfo
+func KeyID(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Signer implements crypto.Signer by delegating to remote key servers.
+// Requests go to the last server that succeeded and fail over in order.
+type Signer struct {
+	public  crypto.PublicKey
+	keyID   string
+	servers []string
+	client  *http.Client
+	timeout time.Duration
+	next    atomic.Int32
+}
+
+// NewSigner creates a remote signer for pub. A nil client gets a pooled default.
+func NewSigner(pub crypto.PublicKey, servers []string, client *http.Client, timeout time.Duration) (*Signer, error) {
+	if len(servers) == 0 {
+		return nil, errors.New("keyless: no key servers configured")
+	}
+	keyID, err := KeyID(pub)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		client = &http.Client{Transport: &http.Transport{
+			MaxIdleConnsPerHost: 16,
+			IdleConnTimeout:     90 * time.Second,
+			ForceAttemptHTTP2:   true,
+		}}
+	}
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	return &Signer{
+		public:  pub,
+		keyID:   keyID,
+		servers: servers,
+		client:  client,
+		timeout: timeout,
+	}, nil
+}
+
+// Public returns the public key of the remote private key
+func (s *Signer) Public() crypto.PublicKey {
+	return s.public
+}
+
+// Sign asks the key servers to sign digest, verifying the returned signature
+// against the public key before handing it to crypto/tls
+func (s *Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	req := SignRequest{
+		KeyID:  s.keyID,
+		Digest: digest,
+		Hash:   uint(opts.HashFunc()),
+	}
+	if pss, ok := opts.(*rsa.PSSOptions); ok {
+		saltLength := pss.SaltLength
+		req.SaltLength = &saltLength
+	}
+
+	start := int(s.next.Load())
+	var lastErr error
+	for i := range s.servers {
+		idx := (start + i) % len(s.servers)
+		server := s.servers[idx]
+
+		sig, err := s.signWith(server, req)
+		if err == nil {
+			err = verify(s.public, digest, sig, opts)
+		}
+		if err != nil {
+			signRequests.With(server, "error").Inc()
+			lastErr = fmt.Errorf("%s: %w", server, err)
+			continue
+		}
+
+		signRequests.With(server, "ok").Inc()
+		if i > 0 {
+			failovers.Inc()
+			s.next.Store(int32(idx))
+		}
+		return sig, nil
+	}
+	return nil, fmt.Errorf("keyless: all key servers failed: %w", lastErr)
+}
+
+func (s *Signer) signWith(server string, req SignRequest) ([]byte, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(server, "/")+"/sign", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out SignResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decode response (status %d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK || out.Error != "" {
+		return nil, fmt.Errorf("key server returned %d: %s", resp.StatusCode, out.Error)
+	}
+	return out.Signature, nil
+}
+
+// verify checks a signature returned by a key server
+func verify(pub crypto.PublicKey, digest, sig []byte, opts crypto.SignerOpts) error {
+	var ok bool
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		ok = ecdsa.VerifyASN1(k, digest, sig)
+	case *rsa.PublicKey:
+		if pss, isPSS := opts.(*rsa.PSSOptions); isPSS {
+			ok = rsa.VerifyPSS(k, opts.HashFunc(), digest, sig, pss) == nil
+		} else {
+			ok = rsa.VerifyPKCS1v15(k, opts.HashFunc(), digest, sig) == nil
+		}
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(k, digest, sig)
+	default:
+		return fmt.Errorf("unsupported public key type %T", pub)
+	}
+	if !ok {
+		return errors.New("key server returned an invalid signature")
+	}
+	return nil
+}
+
+// LoadCertificate loads a certificate chain from certFile and pairs it with a
+// remote signer, so the private key never needs to be present locally.
+// Reloads should pass the same client so they share its connections; nil
+// gets a new pooled default.
+func LoadCertificate(certFile string, servers []string, client *http.Client, timeout time.Duration) (*tls.Certificate, error) {
+	data, err := tlsstore.ReadFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var cert tls.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			cert.Certificate = append(cert.Certificate, block.Bytes)
+		}
+	}
+	if len(cert.Certificate) == 0 {
+		return nil, fmt.Errorf("keyless: no certificates found in %s", certFile)
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	cert.Leaf = leaf
+
+	signer, err := NewSigner(leaf.PublicKey, servers, client, timeout)
+	if err != nil {
+		return nil, err
+	}
+	cert.PrivateKey = signer
+	return &cert, nil
+}
+
+// NewHandler returns a reference key server serving /sign for the given keys,
+// indexed by KeyID. It is intended for tests and simple deployments.
+func NewHandler(keys ...crypto.Signer) (http.Handler, error) {
+	byID := make(map[string]crypto.Signer, len(keys))
+	for _, k := range keys {
+		id, err := KeyID(k.Public())
+		if err != nil {
+			return nil, err
+		}
+		byID[id] = k
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sign", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		var req SignRequest
+		if err := json.NewDecoder(io.LimitReader(r.Body, 64<<10)).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(SignResponse{Error: err.Error()})
+			return
+		}
+
+		key, ok := byID[req.KeyID]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(SignResponse{Error: "unknown key"})
+			return
+		}
+
+		var opts crypto.SignerOpts = crypto.Hash(req.Hash)
+		if req.SaltLength != nil {
+			opts = &rsa.PSSOptions{SaltLength: *req.SaltLength, Hash: crypto.Hash(req.Hash)}
+		}
+
+		sig, err := key.Sign(rand.Reader, req.Digest, opts)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_ = json.NewEncoder(w).Encode(SignResponse{Error: err.Error()})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(SignResponse{Signature: sig})
+	})
+	return mux, nil
+}
@@ -0,0 +1,137 @@
+package keyless
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tls-agent/pkg/agenttest"
+)
+
+// keyServer starts a reference key server for key
+func keyServer(t *testing.T, key crypto.Signer) *httptest.Server {
+	t.Helper()
+
+	handler, err := NewHandler(key)
+	if err != nil {
+		t.Fatalf("NewHandler failed: %v", err)
+	}
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// TestSignerECDSA tests remote ECDSA signing and local verification
+func TestSignerECDSA(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	srv := keyServer(t, key)
+
+	signer, err := NewSigner(key.Public(), []string{srv.URL}, nil, time.Second)
+	if err != nil {
+		t.Fatalf("NewSigner failed: %v", err)
+	}
+
+	digest := sha256.Sum256([]byte("hello"))
+	sig, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	if !ecdsa.VerifyASN1(&key.PublicKey, digest[:], sig) {
+		t.Error("Signature does not verify")
+	}
+}
+
+// TestSignerFailover tests that a dead key server is skipped
+func TestSignerFailover(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+	live := keyServer(t, key)
+
+	signer, err := NewSigner(key.Public(), []string{dead.URL, live.URL}, nil, time.Second)
+	if err != nil {
+		t.Fatalf("NewSigner failed: %v", err)
+	}
+
+	before := failovers.Value()
+	digest := sha256.Sum256([]byte("hello"))
+	opts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256}
+	if _, err := signer.Sign(rand.Reader, digest[:], opts); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	if failovers.Value() != before+1 {
+		t.Error("Expected failover to be counted")
+	}
+
+	// The live server is now preferred
+	if _, err := signer.Sign(rand.Reader, digest[:], opts); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	if failovers.Value() != before+1 {
+		t.Error("Second request should go straight to the live server")
+	}
+}
+
+// TestSignerRejectsWrongKey tests that signatures from the wrong key are refused
+func TestSignerRejectsWrongKey(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	srv := keyServer(t, key)
+
+	signer, err := NewSigner(other.Public(), []string{srv.URL}, nil, time.Second)
+	if err != nil {
+		t.Fatalf("NewSigner failed: %v", err)
+	}
+
+	digest := sha256.Sum256([]byte("hello"))
+	if _, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256); err == nil {
+		t.Error("Unknown key should fail to sign")
+	}
+}
+
+// TestKeylessHandshake tests a full TLS handshake using a remote key
+func TestKeylessHandshake(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	srv := keyServer(t, key)
+
+	certFile := filepath.Join(t.TempDir(), "server.crt")
+	signed := agenttest.NewCA(t).Sign(t, &x509.Certificate{DNSNames: []string{"localhost"}}, key)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: signed.Certificate[0]})
+	if err := os.WriteFile(certFile, certPEM, 0644); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+
+	cert, err := LoadCertificate(certFile, []string{srv.URL}, nil, time.Second)
+	if err != nil {
+		t.Fatalf("LoadCertificate failed: %v", err)
+	}
+	if _, ok := cert.PrivateKey.(*Signer); !ok {
+		t.Fatalf("Expected remote signer, got %T", cert.PrivateKey)
+	}
+
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	go func() {
+		_ = tls.Server(serverConn, &tls.Config{Certificates: []tls.Certificate{*cert}}).Handshake()
+	}()
+
+	client := tls.Client(clientConn, &tls.Config{InsecureSkipVerify: true})
+	if err := client.Handshake(); err != nil {
+		t.Fatalf("Handshake with remote key failed: %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"tls-agent/internal/notify"
+)
+
+// Event types
+const (
+	EventNormal  = "Normal"
+	EventWarning = "Warning"
+)
+
+// component is reported as the source of events
+const component = "tls-agent"
+
+// Annotations set on the pod when annotating is enabled
+const (
+	AnnotationLastReload  = "tls-agent.io/last-reload"
+	AnnotationFingerprint = "tls-agent.io/certificate-fingerprint"
+	AnnotationLastFailure = "tls-agent.io/last-reload-failure"
+)
+
+// reasons maps agent event types to Event reasons
+var reasons = map[string]string{
+	notify.EventReloadSucceeded: "CertificateReloaded",
+	notify.EventReloadFailed:    "CertificateReloadFailed",
+	notify.EventPolicyViolation: "CertificatePolicyViolation",
+
+	notify.EventCertificateExpiring: "CertificateExpiring",
+	notify.EventKeyAgeExceeded:      "KeyAgeExceeded",
+}
+
+// event is the subset of a core/v1 Event the agent sets
+type event struct {
+	Metadata struct {
+		GenerateName string `json:"generateName"`
+		Namespace    string `json:"namespace"`
+	} `json:"metadata"`
+	InvolvedObject struct {
+		APIVersion string `json:"apiVersion"`
+		Kind       string `json:"kind"`
+		Namespace  string `json:"namespace"`
+		Name       string `json:"name"`
+		UID        string `json:"uid,omitempty"`
+	} `json:"involvedObject"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+	Type    string `json:"type"`
+	Source  struct {
+		Component string `json:"component"`
+		Host      string `json:"host,omitempty"`
+	} `json:"source"`
+	FirstTimestamp     time.Time `json:"firstTimestamp"`
+	LastTimestamp      time.Time `json:"lastTimestamp"`
+	Count              int       `json:"count"`
+	ReportingComponent string    `json:"reportingComponent"`
+	ReportingInstance  string    `json:"reportingInstance"`
+}
+
+// Notifier records agent events as Kubernetes Events on a pod when Events is
+// set, and keeps the pod's reload annotations current when Annotate is set.
+// Agent events without an Event reason are ignored.
+type Notifier struct {
+	Client   *Client
+	Pod      Pod
+	Events   bool
+	Annotate bool
+
+	// uid is looked up on first use when Pod.UID is empty; `kubectl
+	// describe` only lists events whose involvedObject carries it
+	mu  sync.Mutex
+	uid string
+}
+
+// Notify implements notify.Notifier
+func (n *Notifier) Notify(ctx context.Context, e notify.Event) error {
+	var err error
+	if n.Events {
+		err = n.sendEvent(ctx, e)
+	}
+	if n.Annotate {
+		if annotations := reloadAnnotations(e); annotations != nil {
+			err = errors.Join(err, n.Client.AnnotatePod(ctx, n.Pod, annotations))
+		}
+	}
+	return err
+}
+
+// sendEvent creates an Event on the pod for e
+func (n *Notifier) sendEvent(ctx context.Context, e notify.Event) error {
+	reason, ok := reasons[e.Type]
+	if !ok {
+		return nil
+	}
+
+	ev := event{Reason: reason, Message: e.Message, Type: EventWarning, Count: 1}
+	if e.Severity == notify.SeverityInfo {
+		ev.Type = EventNormal
+	}
+	ev.Metadata.GenerateName = n.Pod.Name + "."
+	ev.Metadata.Namespace = n.Pod.Namespace
+	ev.InvolvedObject.APIVersion = "v1"
+	ev.InvolvedObject.Kind = "Pod"
+	ev.InvolvedObject.Namespace = n.Pod.Namespace
+	ev.InvolvedObject.Name = n.Pod.Name
+	ev.InvolvedObject.UID = n.podUID(ctx)
+	ev.Source.Component = component
+	ev.Source.Host = os.Getenv("NODE_NAME")
+	ev.FirstTimestamp, ev.LastTimestamp = e.Time, e.Time
+	ev.ReportingComponent = component
+	ev.ReportingInstance = n.Pod.Name
+
+	path := "/api/v1/namespaces/" + url.PathEscape(n.Pod.Namespace) + "/events"
+	return n.Client.do(ctx, http.MethodPost, path, "application/json", ev, nil)
+}
+
+// podUID returns the pod's UID, looking it up once. A failed lookup is
+// retried on the next event; the event is still sent without it.
+func (n *Notifier) podUID(ctx context.Context) string {
+	if n.Pod.UID != "" {
+		return n.Pod.UID
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.uid == "" {
+		n.uid, _ = n.Client.PodUID(ctx, n.Pod)
+	}
+	return n.uid
+}
+
+// reloadAnnotations returns the annotations recording e, or nil when e is not
+// a reload outcome
+func reloadAnnotations(e notify.Event) map[string]string {
+	at := e.Time.UTC().Format(time.RFC3339)
+	switch e.Type {
+	case notify.EventReloadSucceeded:
+		annotations := map[string]string{AnnotationLastReload: at}
+		if fp := e.Fields["fingerprint"]; fp != "" {
+			annotations[AnnotationFingerprint] = fp
+		}
+		return annotations
+	case notify.EventReloadFailed:
+		return map[string]string{AnnotationLastFailure: at}
+	}
+	return nil
+}
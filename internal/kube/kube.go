@@ -0,0 +1,197 @@
+// Package kube reports certificate events to the Kubernetes API when the
+// agent runs in a pod: reloads and failures become Events on the pod, so
+// they show in `kubectl describe pod`, and the pod can be annotated with the
+// current certificate. It talks to the API server directly with the pod's
+// service account rather than depending on client-go.
+package kube
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Service account files mounted into every pod
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	tokenFile         = serviceAccountDir + "/token"
+	caFile            = serviceAccountDir + "/ca.crt"
+	namespaceFile     = serviceAccountDir + "/namespace"
+)
+
+// ErrNotInCluster is returned by InCluster outside a Kubernetes pod
+var ErrNotInCluster = errors.New("kube: not running in a Kubernetes pod")
+
+// Client is a minimal Kubernetes API client
+type Client struct {
+	// BaseURL is the API server address, e.g. https://10.0.0.1:443
+	BaseURL string
+
+	// TokenFile holds the bearer token. It is re-read on every request
+	// since projected service account tokens are rotated.
+	TokenFile string
+
+	HTTP *http.Client
+}
+
+// InCluster returns a client for the API server of the cluster the pod runs
+// in, authenticated as the pod's service account
+func InCluster() (*Client, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, ErrNotInCluster
+	}
+	ca, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("kube: read service account CA: %w", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("kube: no certificates in %s", caFile)
+	}
+	return &Client{
+		BaseURL:   "https://" + net.JoinHostPort(host, port),
+		TokenFile: tokenFile,
+		HTTP: &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12},
+			},
+		},
+	}, nil
+}
+
+// do sends a request with body encoded as JSON and decodes the response into
+// out when it is non-nil
+func (c *Client) do(ctx context.Context, method, path, contentType string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.BaseURL, "/")+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.TokenFile != "" {
+		token, err := os.ReadFile(c.TokenFile)
+		if err != nil {
+			return fmt.Errorf("kube: read token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("kube: %s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &APIError{Method: method, Path: path, StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+// APIError is a non-success response from the API server
+type APIError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("kube: %s %s returned %d: %s", e.Method, e.Path, e.StatusCode, e.Message)
+}
+
+// hasStatus reports whether err is an APIError with the given status
+func hasStatus(err error, status int) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == status
+}
+
+// Pod identifies the pod the agent runs in
+type Pod struct {
+	Namespace string
+	Name      string
+	UID       string
+}
+
+// CurrentPod returns the agent's pod from the downward API variables
+// POD_NAME, POD_NAMESPACE and POD_UID, falling back to the hostname and the
+// service account namespace. UID may be empty.
+func CurrentPod() (Pod, error) {
+	pod := Pod{
+		Namespace: os.Getenv("POD_NAMESPACE"),
+		Name:      os.Getenv("POD_NAME"),
+		UID:       os.Getenv("POD_UID"),
+	}
+	if pod.Name == "" {
+		// A pod's hostname is its name unless spec.hostname overrides it
+		name, err := os.Hostname()
+		if err != nil {
+			return Pod{}, fmt.Errorf("kube: pod name: %w", err)
+		}
+		pod.Name = name
+	}
+	if pod.Namespace == "" {
+		ns, err := os.ReadFile(namespaceFile)
+		if err != nil {
+			return Pod{}, fmt.Errorf("kube: pod namespace: %w", err)
+		}
+		pod.Namespace = strings.TrimSpace(string(ns))
+	}
+	return pod, nil
+}
+
+// podPath returns the API path of pod
+func podPath(pod Pod) string {
+	return "/api/v1/namespaces/" + url.PathEscape(pod.Namespace) + "/pods/" + url.PathEscape(pod.Name)
+}
+
+// PodUID looks up the UID of pod
+func (c *Client) PodUID(ctx context.Context, pod Pod) (string, error) {
+	var out struct {
+		Metadata struct {
+			UID string `json:"uid"`
+		} `json:"metadata"`
+	}
+	if err := c.do(ctx, http.MethodGet, podPath(pod), "", nil, &out); err != nil {
+		return "", err
+	}
+	return out.Metadata.UID, nil
+}
+
+// AnnotatePod merges annotations into pod's metadata
+func (c *Client) AnnotatePod(ctx context.Context, pod Pod, annotations map[string]string) error {
+	patch := map[string]any{"metadata": map[string]any{"annotations": annotations}}
+	return c.do(ctx, http.MethodPatch, podPath(pod), "application/merge-patch+json", patch, nil)
+}
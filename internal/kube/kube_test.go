@@ -0,0 +1,155 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"tls-agent/internal/notify"
+)
+
+// request is a call received by the fake API server
+type request struct {
+	Method, Path, ContentType, Auth string
+	Body                            map[string]any
+}
+
+// fakeAPI records requests and answers pod lookups
+type fakeAPI struct {
+	mu       sync.Mutex
+	requests []request
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req := request{Method: r.Method, Path: r.URL.Path, ContentType: r.Header.Get("Content-Type"), Auth: r.Header.Get("Authorization")}
+	if data, _ := io.ReadAll(r.Body); len(data) > 0 {
+		json.Unmarshal(data, &req.Body)
+	}
+	f.mu.Lock()
+	f.requests = append(f.requests, req)
+	f.mu.Unlock()
+
+	if r.Method == http.MethodGet {
+		io.WriteString(w, `{"metadata":{"uid":"pod-uid"}}`)
+	}
+}
+
+func (f *fakeAPI) calls() []request {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]request(nil), f.requests...)
+}
+
+// newTestClient starts a fake API server authenticated with token
+func newTestClient(t *testing.T, token string) (*Client, *fakeAPI) {
+	api := &fakeAPI{}
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+
+	tokenPath := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenPath, []byte(token+"\n"), 0600); err != nil {
+		t.Fatalf("Failed to write token: %v", err)
+	}
+	return &Client{BaseURL: srv.URL, TokenFile: tokenPath, HTTP: srv.Client()}, api
+}
+
+// TestNotifierEvents tests that reloads become Events on the pod
+func TestNotifierEvents(t *testing.T) {
+	client, api := newTestClient(t, "secret")
+	n := &Notifier{Client: client, Pod: Pod{Namespace: "prod", Name: "agent-0"}, Events: true}
+
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, e := range []notify.Event{
+		{Type: notify.EventReloadSucceeded, Severity: notify.SeverityInfo, Message: "certificate reloaded", Time: at},
+		{Type: notify.EventReloadFailed, Severity: notify.SeverityWarning, Message: "bad key", Time: at},
+		{Type: "unmapped", Severity: notify.SeverityInfo, Time: at},
+	} {
+		if err := n.Notify(context.Background(), e); err != nil {
+			t.Fatalf("Failed to notify: %v", err)
+		}
+	}
+
+	calls := api.calls()
+	// The pod UID is looked up once, then one Event per mapped type
+	if len(calls) != 3 {
+		t.Fatalf("Expected 3 requests, got %+v", calls)
+	}
+	if calls[0].Method != http.MethodGet || calls[0].Path != "/api/v1/namespaces/prod/pods/agent-0" {
+		t.Errorf("Expected a pod lookup, got %s %s", calls[0].Method, calls[0].Path)
+	}
+	for i, want := range []struct{ reason, typ string }{
+		{"CertificateReloaded", EventNormal},
+		{"CertificateReloadFailed", EventWarning},
+	} {
+		call := calls[i+1]
+		if call.Method != http.MethodPost || call.Path != "/api/v1/namespaces/prod/events" {
+			t.Fatalf("Expected an event POST, got %s %s", call.Method, call.Path)
+		}
+		if call.Auth != "Bearer secret" {
+			t.Errorf("Expected bearer token, got %q", call.Auth)
+		}
+		if call.Body["reason"] != want.reason || call.Body["type"] != want.typ {
+			t.Errorf("Expected %s/%s, got %v/%v", want.reason, want.typ, call.Body["reason"], call.Body["type"])
+		}
+		involved := call.Body["involvedObject"].(map[string]any)
+		if involved["name"] != "agent-0" || involved["uid"] != "pod-uid" || involved["kind"] != "Pod" {
+			t.Errorf("Unexpected involvedObject %v", involved)
+		}
+	}
+}
+
+// TestNotifierAnnotate tests that reload outcomes are recorded as pod annotations
+func TestNotifierAnnotate(t *testing.T) {
+	client, api := newTestClient(t, "secret")
+	n := &Notifier{Client: client, Pod: Pod{Namespace: "prod", Name: "agent-0", UID: "known"}, Annotate: true}
+
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	err := n.Notify(context.Background(), notify.Event{
+		Type:     notify.EventReloadSucceeded,
+		Severity: notify.SeverityInfo,
+		Time:     at,
+		Fields:   map[string]string{"fingerprint": "abc123"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to notify: %v", err)
+	}
+
+	calls := api.calls()
+	if len(calls) != 1 || calls[0].Method != http.MethodPatch || calls[0].ContentType != "application/merge-patch+json" {
+		t.Fatalf("Expected one merge patch, got %+v", calls)
+	}
+	annotations := calls[0].Body["metadata"].(map[string]any)["annotations"].(map[string]any)
+	if annotations[AnnotationLastReload] != "2026-01-02T03:04:05Z" || annotations[AnnotationFingerprint] != "abc123" {
+		t.Errorf("Unexpected annotations %v", annotations)
+	}
+}
+
+// TestClientError tests that API errors include the status and message
+func TestClientError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "events is forbidden", http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	n := &Notifier{Client: &Client{BaseURL: srv.URL}, Pod: Pod{Namespace: "prod", Name: "agent-0", UID: "known"}, Events: true}
+	err := n.Notify(context.Background(), notify.Event{Type: notify.EventReloadFailed, Severity: notify.SeverityWarning})
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	t.Logf("Got expected error: %v", err)
+}
+
+// TestInClusterOutsideCluster tests detection of running outside a pod
+func TestInClusterOutsideCluster(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	if _, err := InCluster(); err != ErrNotInCluster {
+		t.Errorf("Expected ErrNotInCluster, got %v", err)
+	}
+}
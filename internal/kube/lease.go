@@ -0,0 +1,137 @@
+package kube
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// microTime marshals like the API's MicroTime
+type microTime time.Time
+
+func (t microTime) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + time.Time(t).UTC().Format("2006-01-02T15:04:05.000000Z07:00") + `"`), nil
+}
+
+func (t *microTime) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*t = microTime{}
+		return nil
+	}
+	var parsed time.Time
+	if err := parsed.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	*t = microTime(parsed)
+	return nil
+}
+
+// lease is the subset of a coordination.k8s.io/v1 Lease the agent uses
+type lease struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name            string `json:"name"`
+		Namespace       string `json:"namespace"`
+		ResourceVersion string `json:"resourceVersion,omitempty"`
+	} `json:"metadata"`
+	Spec struct {
+		HolderIdentity       string     `json:"holderIdentity"`
+		LeaseDurationSeconds int        `json:"leaseDurationSeconds"`
+		AcquireTime          *microTime `json:"acquireTime,omitempty"`
+		RenewTime            *microTime `json:"renewTime,omitempty"`
+		LeaseTransitions     int        `json:"leaseTransitions"`
+	} `json:"spec"`
+}
+
+// heldByOther reports whether a holder other than identity has a lease that
+// is still current at now
+func (l *lease) heldByOther(identity string, now time.Time) bool {
+	s := l.Spec
+	if s.HolderIdentity == "" || s.HolderIdentity == identity || s.RenewTime == nil {
+		return false
+	}
+	return now.Before(time.Time(*s.RenewTime).Add(time.Duration(s.LeaseDurationSeconds) * time.Second))
+}
+
+// LeaseLock is a leader election lock backed by a Lease object. The service
+// account needs get, create and update on leases in Namespace.
+type LeaseLock struct {
+	Client    *Client
+	Namespace string
+	Name      string
+}
+
+func (l *LeaseLock) path() string {
+	return "/apis/coordination.k8s.io/v1/namespaces/" + url.PathEscape(l.Namespace) + "/leases"
+}
+
+// TryAcquire takes or renews the lease for identity for ttl and reports
+// whether identity holds it. Losing a concurrent update is not an error.
+func (l *LeaseLock) TryAcquire(ctx context.Context, identity string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	seconds := max(int(ttl.Round(time.Second)/time.Second), 1)
+
+	var current lease
+	err := l.Client.do(ctx, http.MethodGet, l.path()+"/"+url.PathEscape(l.Name), "", nil, &current)
+	if hasStatus(err, http.StatusNotFound) {
+		created := l.newLease()
+		created.Spec.HolderIdentity = identity
+		created.Spec.LeaseDurationSeconds = seconds
+		created.Spec.AcquireTime = (*microTime)(&now)
+		created.Spec.RenewTime = (*microTime)(&now)
+		err := l.Client.do(ctx, http.MethodPost, l.path(), "application/json", created, nil)
+		if hasStatus(err, http.StatusConflict) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if current.heldByOther(identity, now) {
+		return false, nil
+	}
+	if current.Spec.HolderIdentity != identity {
+		current.Spec.HolderIdentity = identity
+		current.Spec.AcquireTime = (*microTime)(&now)
+		current.Spec.LeaseTransitions++
+	}
+	current.Spec.LeaseDurationSeconds = seconds
+	current.Spec.RenewTime = (*microTime)(&now)
+
+	// The resourceVersion makes the update fail if another replica won
+	err = l.Client.do(ctx, http.MethodPut, l.path()+"/"+url.PathEscape(l.Name), "application/json", &current, nil)
+	if hasStatus(err, http.StatusConflict) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Release gives up the lease if identity holds it, so another replica can
+// take over without waiting for it to expire
+func (l *LeaseLock) Release(ctx context.Context, identity string) error {
+	var current lease
+	if err := l.Client.do(ctx, http.MethodGet, l.path()+"/"+url.PathEscape(l.Name), "", nil, &current); err != nil {
+		return err
+	}
+	if current.Spec.HolderIdentity != identity {
+		return nil
+	}
+	current.Spec.HolderIdentity = ""
+	current.Spec.LeaseDurationSeconds = 1
+	err := l.Client.do(ctx, http.MethodPut, l.path()+"/"+url.PathEscape(l.Name), "application/json", &current, nil)
+	if hasStatus(err, http.StatusConflict) {
+		return nil
+	}
+	return err
+}
+
+func (l *LeaseLock) newLease() *lease {
+	created := &lease{APIVersion: "coordination.k8s.io/v1", Kind: "Lease"}
+	created.Metadata.Name = l.Name
+	created.Metadata.Namespace = l.Namespace
+	return created
+}
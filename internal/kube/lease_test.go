@@ -0,0 +1,107 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeLeases stores one Lease with optimistic concurrency like the API server
+type fakeLeases struct {
+	mu      sync.Mutex
+	current *lease
+	version int
+}
+
+func (f *fakeLeases) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+		if f.current == nil || !strings.HasSuffix(r.URL.Path, "/leases/agent") {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(f.current)
+	case http.MethodPost, http.MethodPut:
+		var l lease
+		if err := json.NewDecoder(r.Body).Decode(&l); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if (r.Method == http.MethodPost && f.current != nil) ||
+			(r.Method == http.MethodPut && l.Metadata.ResourceVersion != strconv.Itoa(f.version)) {
+			http.Error(w, "conflict", http.StatusConflict)
+			return
+		}
+		f.version++
+		l.Metadata.ResourceVersion = strconv.Itoa(f.version)
+		f.current = &l
+		json.NewEncoder(w).Encode(&l)
+	}
+}
+
+// TestLeaseLock tests acquiring, contending for and releasing a Lease
+func TestLeaseLock(t *testing.T) {
+	api := &fakeLeases{}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	client := &Client{BaseURL: srv.URL, HTTP: srv.Client()}
+	a := &LeaseLock{Client: client, Namespace: "prod", Name: "agent"}
+	b := &LeaseLock{Client: client, Namespace: "prod", Name: "agent"}
+	ctx := context.Background()
+
+	for _, step := range []struct {
+		lock     *LeaseLock
+		identity string
+		want     bool
+	}{
+		{a, "a", true},  // creates the lease
+		{a, "a", true},  // renews it
+		{b, "b", false}, // still held by a
+	} {
+		held, err := step.lock.TryAcquire(ctx, step.identity, 15*time.Second)
+		if err != nil || held != step.want {
+			t.Fatalf("TryAcquire(%s) = %v, %v; want %v", step.identity, held, err, step.want)
+		}
+	}
+	if got := api.current.Spec.LeaseDurationSeconds; got != 15 {
+		t.Errorf("Expected a 15s lease, got %d", got)
+	}
+
+	if err := a.Release(ctx, "a"); err != nil {
+		t.Fatalf("Failed to release: %v", err)
+	}
+	if held, err := b.TryAcquire(ctx, "b", 15*time.Second); err != nil || !held {
+		t.Fatalf("Expected b to take the released lease, got %v, %v", held, err)
+	}
+	if api.current.Spec.HolderIdentity != "b" || api.current.Spec.LeaseTransitions != 1 {
+		t.Errorf("Unexpected lease spec %+v", api.current.Spec)
+	}
+}
+
+// TestLeaseExpired tests that an expired lease is taken over
+func TestLeaseExpired(t *testing.T) {
+	stale := time.Now().Add(-time.Minute)
+	api := &fakeLeases{current: &lease{}}
+	api.current.Spec.HolderIdentity = "crashed"
+	api.current.Spec.LeaseDurationSeconds = 15
+	api.current.Spec.RenewTime = (*microTime)(&stale)
+	api.current.Metadata.ResourceVersion = "0"
+
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	l := &LeaseLock{Client: &Client{BaseURL: srv.URL, HTTP: srv.Client()}, Namespace: "prod", Name: "agent"}
+	if held, err := l.TryAcquire(context.Background(), "a", 15*time.Second); err != nil || !held {
+		t.Fatalf("Expected to take over the expired lease, got %v, %v", held, err)
+	}
+}
@@ -0,0 +1,87 @@
+package kube
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+)
+
+// Admission webhook configuration kinds
+const (
+	WebhookMutating   = "mutating"
+	WebhookValidating = "validating"
+)
+
+// webhookConfigurationPath returns the API path of a cluster-scoped
+// admission webhook configuration
+func webhookConfigurationPath(kind, name string) (string, error) {
+	var resource string
+	switch kind {
+	case WebhookMutating:
+		resource = "mutatingwebhookconfigurations"
+	case WebhookValidating:
+		resource = "validatingwebhookconfigurations"
+	default:
+		return "", fmt.Errorf("kube: unknown webhook configuration kind %q", kind)
+	}
+	return "/apis/admissionregistration.k8s.io/v1/" + resource + "/" + url.PathEscape(name), nil
+}
+
+// patchOp is one JSON Patch (RFC 6902) operation
+type patchOp struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	Value any    `json:"value"`
+}
+
+// SetWebhookCABundle sets clientConfig.caBundle of the webhooks in the named
+// configuration to caBundle (PEM). Only the webhooks listed in webhooks are
+// changed, or all of them when it is empty. Webhooks that already carry the
+// bundle are left alone, so an unchanged bundle costs one read.
+func (c *Client) SetWebhookCABundle(ctx context.Context, kind, name string, webhooks []string, caBundle []byte) error {
+	path, err := webhookConfigurationPath(kind, name)
+	if err != nil {
+		return err
+	}
+	var config struct {
+		Webhooks []struct {
+			Name         string `json:"name"`
+			ClientConfig struct {
+				CABundle []byte `json:"caBundle"`
+			} `json:"clientConfig"`
+		} `json:"webhooks"`
+	}
+	if err := c.do(ctx, http.MethodGet, path, "", nil, &config); err != nil {
+		return err
+	}
+
+	// Each change is guarded by a test of the webhook name, so a concurrent
+	// reordering of the list fails the patch instead of touching the wrong entry
+	var patch []patchOp
+	matched := false
+	for i, w := range config.Webhooks {
+		if len(webhooks) > 0 && !slices.Contains(webhooks, w.Name) {
+			continue
+		}
+		matched = true
+		if bytes.Equal(w.ClientConfig.CABundle, caBundle) {
+			continue
+		}
+		prefix := "/webhooks/" + strconv.Itoa(i)
+		patch = append(patch,
+			patchOp{Op: "test", Path: prefix + "/name", Value: w.Name},
+			patchOp{Op: "add", Path: prefix + "/clientConfig/caBundle", Value: caBundle},
+		)
+	}
+	if !matched {
+		return fmt.Errorf("kube: %s webhook configuration %s has no matching webhooks", kind, name)
+	}
+	if len(patch) == 0 {
+		return nil
+	}
+	return c.do(ctx, http.MethodPatch, path, "application/json-patch+json", patch, nil)
+}
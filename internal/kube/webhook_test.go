@@ -0,0 +1,86 @@
+package kube
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeWebhooks serves one mutating webhook configuration and records patches
+type fakeWebhooks struct {
+	mu      sync.Mutex
+	config  string
+	patches [][]map[string]any
+}
+
+func (f *fakeWebhooks) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/apis/admissionregistration.k8s.io/v1/mutatingwebhookconfigurations/injector" {
+		http.NotFound(w, r)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodGet:
+		io.WriteString(w, f.config)
+	case http.MethodPatch:
+		if ct := r.Header.Get("Content-Type"); ct != "application/json-patch+json" {
+			http.Error(w, "unexpected content type "+ct, http.StatusUnsupportedMediaType)
+			return
+		}
+		var patch []map[string]any
+		json.NewDecoder(r.Body).Decode(&patch)
+		f.patches = append(f.patches, patch)
+	}
+}
+
+// TestSetWebhookCABundle tests that only matching webhooks with a different
+// bundle are patched
+func TestSetWebhookCABundle(t *testing.T) {
+	bundle := []byte("-----BEGIN CERTIFICATE-----\n")
+	current := base64.StdEncoding.EncodeToString(bundle)
+	api := &fakeWebhooks{config: `{"webhooks":[
+		{"name":"a.example.com","clientConfig":{"caBundle":"` + current + `"}},
+		{"name":"b.example.com","clientConfig":{}},
+		{"name":"c.example.com","clientConfig":{"caBundle":"b2xk"}}]}`}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+	client := &Client{BaseURL: srv.URL, HTTP: srv.Client()}
+	ctx := context.Background()
+
+	if err := client.SetWebhookCABundle(ctx, WebhookMutating, "injector", []string{"a.example.com", "b.example.com"}, bundle); err != nil {
+		t.Fatalf("Failed to set CA bundle: %v", err)
+	}
+	if len(api.patches) != 1 {
+		t.Fatalf("Expected one patch, got %d", len(api.patches))
+	}
+	patch := api.patches[0]
+	if len(patch) != 2 || patch[0]["op"] != "test" || patch[0]["value"] != "b.example.com" ||
+		patch[1]["path"] != "/webhooks/1/clientConfig/caBundle" || patch[1]["value"] != current {
+		t.Errorf("Expected a guarded update of webhook 1 only, got %v", patch)
+	}
+
+	// Already up to date: no patch
+	if err := client.SetWebhookCABundle(ctx, WebhookMutating, "injector", []string{"a.example.com"}, bundle); err != nil {
+		t.Fatalf("Failed to set CA bundle: %v", err)
+	}
+	if len(api.patches) != 1 {
+		t.Errorf("Expected no patch for an unchanged bundle, got %d patches", len(api.patches))
+	}
+
+	if err := client.SetWebhookCABundle(ctx, WebhookMutating, "injector", []string{"missing.example.com"}, bundle); err == nil || !strings.Contains(err.Error(), "no matching webhooks") {
+		t.Errorf("Expected an error for unmatched webhooks, got %v", err)
+	}
+	if err := client.SetWebhookCABundle(ctx, WebhookValidating, "injector", nil, bundle); !hasStatus(err, http.StatusNotFound) {
+		t.Errorf("Expected 404 for a missing configuration, got %v", err)
+	}
+	if err := client.SetWebhookCABundle(ctx, "conversion", "injector", nil, bundle); err == nil {
+		t.Error("Expected an error for an unknown kind")
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !unix && !windows
+
+package leader
+
+import (
+	"errors"
+	"os"
+)
+
+// tryLock reports that file locks are unavailable on this platform
+func tryLock(*os.File) (bool, error) {
+	return false, errors.New("leader: file locks are not supported on this platform")
+}
@@ -0,0 +1,149 @@
+// Package leader elects one replica among several to perform work that must
+// not be duplicated, such as certificate issuance, while every replica keeps
+// watching and serving.
+package leader
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"tls-agent/internal/metrics"
+)
+
+// Defaults for Elector timing
+const (
+	DefaultLeaseDuration = 15 * time.Second
+	DefaultRetryPeriod   = 2 * time.Second
+)
+
+var isLeader = metrics.NewGauge("tls_agent_leader",
+	"1 when this instance holds the leader lock, 0 otherwise")
+
+// Lock is a lease that at most one identity holds at a time
+type Lock interface {
+	// TryAcquire takes or renews the lock for identity, valid for ttl, and
+	// reports whether identity holds it
+	TryAcquire(ctx context.Context, identity string, ttl time.Duration) (bool, error)
+
+	// Release gives up the lock if identity holds it
+	Release(ctx context.Context, identity string) error
+}
+
+// Elector campaigns for a Lock and runs work while it is held
+type Elector struct {
+	Lock     Lock
+	Identity string
+
+	// LeaseDuration is how long a lock stays valid without renewal; a
+	// leader that cannot renew within it stops leading
+	LeaseDuration time.Duration
+
+	// RetryPeriod is how often the lock is renewed or acquisition retried
+	RetryPeriod time.Duration
+
+	mu      sync.Mutex
+	leading bool
+}
+
+// IsLeader reports whether this instance currently holds the lock
+func (e *Elector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leading
+}
+
+// Run campaigns until ctx is cancelled. Each time leadership is gained lead
+// runs with a context that is cancelled when it is lost; lead must return
+// promptly after that. The lock is released on return.
+func (e *Elector) Run(ctx context.Context, lead func(ctx context.Context)) error {
+	leaseDuration := e.LeaseDuration
+	if leaseDuration <= 0 {
+		leaseDuration = DefaultLeaseDuration
+	}
+	retry := e.RetryPeriod
+	if retry <= 0 {
+		retry = DefaultRetryPeriod
+	}
+
+	ticker := time.NewTicker(retry)
+	defer ticker.Stop()
+
+	var (
+		stopLeading context.CancelFunc
+		leadDone    chan struct{}
+		renewed     time.Time
+	)
+	stop := func() {
+		if stopLeading == nil {
+			return
+		}
+		stopLeading()
+		<-leadDone
+		stopLeading = nil
+		e.setLeading(false)
+		log.Printf("Leader: %s stopped leading", e.Identity)
+	}
+	defer func() {
+		stop()
+		// Release with a fresh context since ctx is already done
+		releaseCtx, cancel := context.WithTimeout(context.Background(), retry)
+		defer cancel()
+		if err := e.Lock.Release(releaseCtx, e.Identity); err != nil {
+			log.Printf("Leader: failed to release lock: %v", err)
+		}
+	}()
+
+	for {
+		attemptCtx, cancel := context.WithTimeout(ctx, retry)
+		held, err := e.Lock.TryAcquire(attemptCtx, e.Identity, leaseDuration)
+		cancel()
+
+		switch {
+		case err == nil && held:
+			renewed = time.Now()
+			if stopLeading == nil {
+				log.Printf("Leader: %s is now the leader", e.Identity)
+				e.setLeading(true)
+				leadCtx, cancelLead := context.WithCancel(ctx)
+				stopLeading = cancelLead
+				leadDone = make(chan struct{})
+				go func() {
+					defer close(leadDone)
+					lead(leadCtx)
+				}()
+			}
+		case err == nil:
+			// Another instance holds the lock
+			stop()
+		default:
+			if ctx.Err() != nil {
+				return nil
+			}
+			log.Printf("Leader: lock update failed: %v", err)
+			// Keep leading through transient errors while the lease is
+			// still ours, but stop before another instance can take it
+			if time.Since(renewed) >= leaseDuration-retry {
+				stop()
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (e *Elector) setLeading(leading bool) {
+	e.mu.Lock()
+	e.leading = leading
+	e.mu.Unlock()
+	if leading {
+		isLeader.Set(1)
+	} else {
+		isLeader.Set(0)
+	}
+}
@@ -0,0 +1,166 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryLock is a Lock shared by electors in one test
+type memoryLock struct {
+	mu     sync.Mutex
+	holder string
+	err    error
+}
+
+func (l *memoryLock) TryAcquire(_ context.Context, identity string, _ time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return false, l.err
+	}
+	if l.holder == "" {
+		l.holder = identity
+	}
+	return l.holder == identity, nil
+}
+
+func (l *memoryLock) Release(_ context.Context, identity string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.holder == identity {
+		l.holder = ""
+	}
+	return nil
+}
+
+func (l *memoryLock) set(holder string, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.holder, l.err = holder, err
+}
+
+// waitFor polls cond until it holds or the deadline passes
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// startElector runs e in the background and returns a function that stops it
+func startElector(e *Elector, lead func(ctx context.Context)) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		e.Run(ctx, lead)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// TestElectorFailover tests that only one elector leads and another takes
+// over once the leader stops
+func TestElectorFailover(t *testing.T) {
+	lock := &memoryLock{}
+	a := &Elector{Lock: lock, Identity: "a", RetryPeriod: 10 * time.Millisecond}
+	b := &Elector{Lock: lock, Identity: "b", RetryPeriod: 10 * time.Millisecond}
+
+	leadStopped := make(chan struct{})
+	stopA := startElector(a, func(ctx context.Context) {
+		<-ctx.Done()
+		close(leadStopped)
+	})
+	waitFor(t, "a to lead", a.IsLeader)
+
+	stopB := startElector(b, func(ctx context.Context) { <-ctx.Done() })
+	defer stopB()
+	time.Sleep(50 * time.Millisecond)
+	if b.IsLeader() {
+		t.Fatal("Expected only one leader")
+	}
+
+	stopA()
+	select {
+	case <-leadStopped:
+	default:
+		t.Error("Expected the leader's work to be stopped before Run returned")
+	}
+	waitFor(t, "b to take over", b.IsLeader)
+}
+
+// TestElectorLosesLock tests that work is cancelled when another instance
+// takes the lock
+func TestElectorLosesLock(t *testing.T) {
+	lock := &memoryLock{}
+	e := &Elector{Lock: lock, Identity: "a", RetryPeriod: 10 * time.Millisecond}
+
+	cancelled := make(chan struct{})
+	stop := startElector(e, func(ctx context.Context) {
+		<-ctx.Done()
+		close(cancelled)
+	})
+	defer stop()
+	waitFor(t, "a to lead", e.IsLeader)
+
+	lock.set("b", nil)
+	select {
+	case <-cancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected leadership to be lost")
+	}
+	waitFor(t, "a to step down", func() bool { return !e.IsLeader() })
+}
+
+// TestElectorTransientErrors tests that a leader rides out errors while its
+// lease is valid and steps down before it expires
+func TestElectorTransientErrors(t *testing.T) {
+	lock := &memoryLock{}
+	e := &Elector{Lock: lock, Identity: "a", LeaseDuration: 200 * time.Millisecond, RetryPeriod: 10 * time.Millisecond}
+
+	stop := startElector(e, func(ctx context.Context) { <-ctx.Done() })
+	defer stop()
+	waitFor(t, "a to lead", e.IsLeader)
+
+	lock.set("a", errors.New("api unavailable"))
+	time.Sleep(50 * time.Millisecond)
+	if !e.IsLeader() {
+		t.Fatal("Expected to keep leading through a brief outage")
+	}
+	waitFor(t, "a to step down", func() bool { return !e.IsLeader() })
+}
+
+// TestFileLock tests that a file lock has one holder at a time
+func TestFileLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "leader.lock")
+	a, b := &FileLock{Path: path}, &FileLock{Path: path}
+	ctx := context.Background()
+
+	if held, err := a.TryAcquire(ctx, "a", time.Second); err != nil || !held {
+		t.Fatalf("Expected a to acquire the lock, got %v, %v", held, err)
+	}
+	if held, err := a.TryAcquire(ctx, "a", time.Second); err != nil || !held {
+		t.Fatalf("Expected a to keep the lock, got %v, %v", held, err)
+	}
+	if held, err := b.TryAcquire(ctx, "b", time.Second); err != nil || held {
+		t.Fatalf("Expected b to be refused, got %v, %v", held, err)
+	}
+
+	if err := a.Release(ctx, "a"); err != nil {
+		t.Fatalf("Failed to release: %v", err)
+	}
+	if held, err := b.TryAcquire(ctx, "b", time.Second); err != nil || !held {
+		t.Fatalf("Expected b to acquire the released lock, got %v, %v", held, err)
+	}
+	b.Release(ctx, "b")
+}
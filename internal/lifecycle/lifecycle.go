@@ -0,0 +1,204 @@
+// Package lifecycle runs the agent's servers and background tasks and shuts
+// them down in a fixed order once the run context ends.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Server is a listener the runner can drain. *http.Server satisfies it.
+type Server interface {
+	Shutdown(ctx context.Context) error
+	Close() error
+}
+
+// Runner owns the process lifecycle. Shutdown happens in order: servers stop
+// accepting and drain, background tasks are cancelled and awaited, then
+// shutdown hooks (such as notifier flushes) run.
+type Runner struct {
+	// ShutdownTimeout bounds how long servers may drain in-flight requests,
+	// and separately how long shutdown hooks may take. Zero closes
+	// connections immediately and gives hooks an expired context.
+	ShutdownTimeout time.Duration
+
+	// TaskTimeout bounds how long cancelled tasks may take to return; zero
+	// waits for them indefinitely
+	TaskTimeout time.Duration
+
+	// Logging enables progress messages; warnings are always logged
+	Logging bool
+
+	servers []server
+	tasks   []task
+	hooks   []func(ctx context.Context) error
+
+	mu  sync.Mutex
+	err error
+}
+
+type server struct {
+	name  string
+	srv   Server
+	serve func() error
+}
+
+type task struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// AddServer registers a server. serve blocks until the server is shut down;
+// http.ErrServerClosed is treated as a clean stop.
+func (r *Runner) AddServer(name string, srv Server, serve func() error) {
+	r.servers = append(r.servers, server{name: name, srv: srv, serve: serve})
+}
+
+// Go registers a background task that runs until ctx is cancelled. A task
+// returning an error shuts the runner down.
+func (r *Runner) Go(name string, run func(ctx context.Context) error) {
+	r.tasks = append(r.tasks, task{name: name, run: run})
+}
+
+// OnShutdown registers a cleanup step that runs after all tasks have
+// stopped. Hooks run in registration order and share ShutdownTimeout; hooks
+// still pending when it expires are skipped. Without a ShutdownTimeout every
+// hook runs with an expired context, so it should only do non-blocking work.
+func (r *Runner) OnShutdown(hook func(ctx context.Context) error) {
+	r.hooks = append(r.hooks, hook)
+}
+
+// Run starts everything and blocks until ctx is cancelled or a server or
+// task fails, then shuts down in order. It returns the first failure, or nil
+// for a requested shutdown.
+func (r *Runner) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	taskCtx, stopTasks := context.WithCancel(context.Background())
+	defer stopTasks()
+
+	var tasks errgroup.Group
+	for _, t := range r.tasks {
+		tasks.Go(func() error {
+			err := t.run(taskCtx)
+			if err != nil && taskCtx.Err() == nil {
+				r.fail(fmt.Errorf("%s: %w", t.name, err))
+				cancel()
+			}
+			return nil
+		})
+	}
+
+	servers, serveCtx := errgroup.WithContext(ctx)
+	for _, s := range r.servers {
+		servers.Go(func() error {
+			if err := s.serve(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				return fmt.Errorf("%s: %w", s.name, err)
+			}
+			return nil
+		})
+	}
+	servers.Go(func() error {
+		<-serveCtx.Done()
+		r.drain()
+		return nil
+	})
+	if err := servers.Wait(); err != nil {
+		r.fail(err)
+	}
+
+	// Servers are drained; nothing can trigger new work in the tasks
+	r.logf("Stopping background tasks...")
+	stopTasks()
+	done := make(chan struct{})
+	go func() {
+		tasks.Wait()
+		close(done)
+	}()
+	// A nil channel never fires, so without a timeout the wait is unbounded
+	var timeout <-chan time.Time
+	if r.TaskTimeout > 0 {
+		timer := time.NewTimer(r.TaskTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-done:
+		r.logf("Background tasks stopped")
+	case <-timeout:
+		log.Printf("Warning: background tasks did not stop within %s (continuing anyway)", r.TaskTimeout)
+	}
+
+	r.runHooks()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// runHooks runs the shutdown hooks in order within ShutdownTimeout
+func (r *Runner) runHooks() {
+	ctx, cancel := context.WithTimeout(context.Background(), r.ShutdownTimeout)
+	defer cancel()
+
+	for i, hook := range r.hooks {
+		if r.ShutdownTimeout > 0 && ctx.Err() != nil {
+			log.Printf("Warning: shutdown timeout reached, skipping %d shutdown hooks", len(r.hooks)-i)
+			return
+		}
+		if err := hook(ctx); err != nil {
+			log.Printf("Shutdown hook %d failed: %v", i+1, err)
+		}
+	}
+}
+
+// drain stops every server, closing connections that outlive ShutdownTimeout
+func (r *Runner) drain() {
+	if r.ShutdownTimeout > 0 {
+		r.logf("Initiating graceful shutdown...")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.ShutdownTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, s := range r.servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if r.ShutdownTimeout <= 0 {
+				s.srv.Close()
+				return
+			}
+			if err := s.srv.Shutdown(ctx); err != nil {
+				log.Printf("%s shutdown error: %v", s.name, err)
+				s.srv.Close()
+			}
+		}()
+	}
+	wg.Wait()
+	r.logf("Server shutdown complete")
+}
+
+// fail records the first failure
+func (r *Runner) fail(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *Runner) logf(format string, args ...any) {
+	if r.Logging {
+		log.Printf(format, args...)
+	}
+}
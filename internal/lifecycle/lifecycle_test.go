@@ -0,0 +1,232 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newServer returns an HTTP server on a loopback listener and its address
+func newServer(t *testing.T, handler http.Handler) (*http.Server, func() error, string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	srv := &http.Server{Handler: handler}
+	return srv, func() error { return srv.Serve(ln) }, "http://" + ln.Addr().String()
+}
+
+// recorder collects shutdown steps in order
+type recorder struct {
+	mu    sync.Mutex
+	steps []string
+}
+
+func (r *recorder) add(step string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.steps = append(r.steps, step)
+}
+
+func (r *recorder) list() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.steps...)
+}
+
+// TestRunnerShutdownOrder tests that in-flight requests drain before tasks
+// stop and shutdown hooks run last
+func TestRunnerShutdownOrder(t *testing.T) {
+	var rec recorder
+	started := make(chan struct{})
+	srv, serve, url := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		rec.add("request")
+	}))
+
+	r := &Runner{ShutdownTimeout: time.Second, TaskTimeout: time.Second}
+	r.AddServer("server", srv, serve)
+	r.Go("agent", func(ctx context.Context) error {
+		<-ctx.Done()
+		rec.add("task")
+		return nil
+	})
+	r.OnShutdown(func(context.Context) error {
+		rec.add("hook 1")
+		return nil
+	})
+	r.OnShutdown(func(context.Context) error {
+		rec.add("hook 2")
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() { result <- r.Run(ctx) }()
+
+	go http.Get(url)
+	<-started
+	cancel()
+
+	if err := <-result; err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	got := rec.list()
+	want := []string{"request", "task", "hook 1", "hook 2"}
+	if len(got) != len(want) {
+		t.Fatalf("Expected steps %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Expected steps %v, got %v", want, got)
+		}
+	}
+}
+
+// TestRunnerTaskFailure tests that a failing task shuts everything down
+func TestRunnerTaskFailure(t *testing.T) {
+	srv, serve, _ := newServer(t, http.NotFoundHandler())
+
+	r := &Runner{ShutdownTimeout: time.Second, TaskTimeout: time.Second}
+	r.AddServer("server", srv, serve)
+	boom := errors.New("boom")
+	r.Go("broken", func(context.Context) error { return boom })
+
+	done := make(chan error, 1)
+	go func() { done <- r.Run(context.Background()) }()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, boom) {
+			t.Errorf("Expected task error, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Runner did not shut down after task failure")
+	}
+}
+
+// TestRunnerServeFailure tests that a server that cannot serve is reported
+// and the remaining servers are stopped
+func TestRunnerServeFailure(t *testing.T) {
+	srv, serve, _ := newServer(t, http.NotFoundHandler())
+	failed := &http.Server{}
+
+	r := &Runner{ShutdownTimeout: time.Second, TaskTimeout: time.Second}
+	r.AddServer("server", srv, serve)
+	r.AddServer("broken", failed, func() error { return errors.New("address in use") })
+
+	done := make(chan error, 1)
+	go func() { done <- r.Run(context.Background()) }()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("Expected serve error")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Runner did not shut down after serve failure")
+	}
+}
+
+// TestRunnerTaskTimeout tests that a stuck task does not block shutdown
+func TestRunnerTaskTimeout(t *testing.T) {
+	r := &Runner{TaskTimeout: 50 * time.Millisecond}
+	release := make(chan struct{})
+	defer close(release)
+	r.Go("stuck", func(context.Context) error {
+		<-release
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	if err := r.Run(ctx); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Shutdown took %s despite task timeout", elapsed)
+	}
+}
+
+// TestRunnerNoTaskTimeout tests that a zero TaskTimeout waits for
+// cancelled tasks to return
+func TestRunnerNoTaskTimeout(t *testing.T) {
+	r := &Runner{}
+	var stopped atomic.Bool
+	r.Go("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		time.Sleep(100 * time.Millisecond)
+		stopped.Store(true)
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := r.Run(ctx); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if !stopped.Load() {
+		t.Error("Expected Run to wait for the task without a task timeout")
+	}
+}
+
+// TestRunnerImmediateClose tests that a zero ShutdownTimeout does not wait for requests
+func TestRunnerImmediateClose(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	srv, serve, url := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+
+	r := &Runner{TaskTimeout: time.Second}
+	r.AddServer("server", srv, serve)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- r.Run(ctx) }()
+
+	go http.Get(url)
+	<-started
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Runner waited for an in-flight request without a shutdown timeout")
+	}
+}
+
+// TestRunnerShutdownHookTimeout tests that hooks share ShutdownTimeout and
+// later hooks are skipped once it expires
+func TestRunnerShutdownHookTimeout(t *testing.T) {
+	r := &Runner{ShutdownTimeout: 50 * time.Millisecond}
+	var ran []string
+	r.OnShutdown(func(ctx context.Context) error {
+		ran = append(ran, "slow")
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	r.OnShutdown(func(context.Context) error {
+		ran = append(ran, "skipped")
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := r.Run(ctx); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if len(ran) != 1 || ran[0] != "slow" {
+		t.Errorf("Expected only the first hook to run, got %v", ran)
+	}
+}
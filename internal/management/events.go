@@ -0,0 +1,75 @@
+package management
+
+import (
+	"context"
+	"sync"
+
+	"tls-agent/internal/notify"
+)
+
+// subscriberBuffer is how many events a slow stream may fall behind before
+// further events are dropped for it
+const subscriberBuffer = 64
+
+// Hub fans agent events out to event streams. It implements notify.Notifier
+// so it can be added to the agent's notifier chain.
+type Hub struct {
+	mu     sync.Mutex
+	subs   map[chan notify.Event]struct{}
+	closed bool
+}
+
+// NewHub creates an empty hub
+func NewHub() *Hub {
+	return &Hub{subs: make(map[chan notify.Event]struct{})}
+}
+
+// Notify delivers event to every subscriber without blocking; subscribers
+// whose buffer is full miss it
+func (h *Hub) Notify(_ context.Context, event notify.Event) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+	return nil
+}
+
+// Subscribe returns a channel receiving events from now on and a function
+// that ends the subscription. The channel is closed when either is called
+// or the hub is closed.
+func (h *Hub) Subscribe() (<-chan notify.Event, func()) {
+	ch := make(chan notify.Event, subscriberBuffer)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	h.subs[ch] = struct{}{}
+	return ch, func() { h.remove(ch) }
+}
+
+func (h *Hub) remove(ch chan notify.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subs[ch]; ok {
+		delete(h.subs, ch)
+		close(ch)
+	}
+}
+
+// Close ends every subscription; later subscriptions end immediately
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for ch := range h.subs {
+		delete(h.subs, ch)
+		close(ch)
+	}
+}
@@ -0,0 +1,160 @@
+// Package management implements the gRPC management API defined in
+// api/v1/management.proto. It lets operators inspect and control a running
+// agent remotely; the server must be run with mutual TLS credentials.
+package management
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"time"
+
+	managementv1 "tls-agent/api/gen/v1"
+	"tls-agent/internal/agent"
+	"tls-agent/internal/tlsstore"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// DefaultName names the certificate served when no SNI certificate matches
+const DefaultName = "default"
+
+// Service implements managementv1.ManagementServer on top of the agent's
+// store and state
+type Service struct {
+	Store *tlsstore.Store
+	State *agent.State
+
+	// Started is reported by GetStatus
+	Started time.Time
+
+	// RequestReload requests a reload and reports whether it was queued;
+	// nil disables TriggerReload
+	RequestReload func() bool
+
+	// RequestRollback restores the previously served certificate; nil
+	// disables Rollback
+	RequestRollback func(ctx context.Context) error
+
+	// Events feeds StreamEvents; nil disables it
+	Events *Hub
+}
+
+var _ managementv1.ManagementServer = (*Service)(nil)
+
+// GetStatus returns the served certificate and the last reload outcome
+func (s *Service) GetStatus(context.Context, *managementv1.GetStatusRequest) (*managementv1.Status, error) {
+	cert, _ := s.Store.GetCertificate(nil)
+	st := &managementv1.Status{
+		Certificate: certificate(DefaultName, cert),
+		Healthy:     s.Store.IsValid(),
+	}
+	if !s.Started.IsZero() {
+		st.Started = timestamppb.New(s.Started)
+	}
+	if history := s.State.History(); len(history) > 0 {
+		st.LastReload = reloadEvent(history[0])
+	}
+	if last := s.State.GetLastError(); last != nil {
+		st.LastError = last.Source + ": " + last.Message
+	}
+	return st, nil
+}
+
+// ListCerts returns the default certificate followed by the SNI
+// certificates in name order
+func (s *Service) ListCerts(context.Context, *managementv1.ListCertsRequest) (*managementv1.ListCertsResponse, error) {
+	cert, _ := s.Store.GetCertificate(nil)
+	resp := &managementv1.ListCertsResponse{
+		Certificates: []*managementv1.Certificate{certificate(DefaultName, cert)},
+	}
+	for _, name := range s.Store.SNINames() {
+		cert, _ := s.Store.GetCertificate(&tls.ClientHelloInfo{ServerName: name})
+		resp.Certificates = append(resp.Certificates, certificate(name, cert))
+	}
+	return resp, nil
+}
+
+// TriggerReload queues a reload of the certificate from its source
+func (s *Service) TriggerReload(context.Context, *managementv1.TriggerReloadRequest) (*managementv1.TriggerReloadResponse, error) {
+	if s.RequestReload == nil {
+		return nil, status.Error(codes.Unimplemented, "reload is not available")
+	}
+	return &managementv1.TriggerReloadResponse{Accepted: s.RequestReload()}, nil
+}
+
+// Rollback restores the certificate replaced by the last reload
+func (s *Service) Rollback(ctx context.Context, _ *managementv1.RollbackRequest) (*managementv1.RollbackResponse, error) {
+	if s.RequestRollback == nil {
+		return nil, status.Error(codes.Unimplemented, "rollback is not available")
+	}
+	if err := s.RequestRollback(ctx); err != nil {
+		switch {
+		case errors.Is(err, agent.ErrNoPrevious):
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+			return nil, status.FromContextError(err).Err()
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	cert, _ := s.Store.GetCertificate(nil)
+	return &managementv1.RollbackResponse{Fingerprint: agent.Fingerprint(cert)}, nil
+}
+
+// StreamEvents sends events until the client goes away or the hub closes
+func (s *Service) StreamEvents(_ *managementv1.StreamEventsRequest, stream managementv1.Management_StreamEventsServer) error {
+	if s.Events == nil {
+		return status.Error(codes.Unimplemented, "event streaming is not available")
+	}
+	events, cancel := s.Events.Subscribe()
+	defer cancel()
+
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				return status.Error(codes.Unavailable, "agent is shutting down")
+			}
+			err := stream.Send(&managementv1.Event{
+				Type:     e.Type,
+				Severity: e.Severity,
+				Message:  e.Message,
+				Time:     timestamppb.New(e.Time),
+				Fields:   e.Fields,
+			})
+			if err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// certificate summarizes cert; an unparseable certificate yields only its name
+func certificate(name string, cert *tls.Certificate) *managementv1.Certificate {
+	c := &managementv1.Certificate{Name: name, Fingerprint: agent.Fingerprint(cert)}
+	leaf, err := tlsstore.ParseLeaf(cert)
+	if err != nil {
+		return c
+	}
+	c.Subject = leaf.Subject.String()
+	c.Issuer = leaf.Issuer.String()
+	c.DnsNames = leaf.DNSNames
+	c.NotBefore = timestamppb.New(leaf.NotBefore)
+	c.NotAfter = timestamppb.New(leaf.NotAfter)
+	return c
+}
+
+func reloadEvent(e agent.ReloadEvent) *managementv1.ReloadEvent {
+	return &managementv1.ReloadEvent{
+		Time:           timestamppb.New(e.Time),
+		Trigger:        e.Trigger,
+		OldFingerprint: e.OldFingerprint,
+		NewFingerprint: e.NewFingerprint,
+		Result:         e.Result,
+		Error:          e.Error,
+	}
+}
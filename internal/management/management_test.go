@@ -0,0 +1,228 @@
+package management
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	managementv1 "tls-agent/api/gen/v1"
+	"tls-agent/internal/agent"
+	"tls-agent/internal/authz"
+	"tls-agent/internal/notify"
+	"tls-agent/internal/tlsstore"
+	"tls-agent/pkg/agenttest"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+// startServer serves service on a loopback port. Client certificates are
+// optional at the TLS layer so that the interceptor's checks are exercised.
+func startServer(t *testing.T, ca *agenttest.CA, service *Service, authorizer *authz.Authorizer) (*Server, string) {
+	creds := credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{*ca.IssueTLS(t, "localhost")},
+		ClientCAs:    ca.Pool,
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		MinVersion:   tls.VersionTLS12,
+	})
+	srv := NewServer(service, creds, authorizer)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+	return srv, ln.Addr().String()
+}
+
+// dial connects to addr, presenting cert when it is not nil
+func dial(t *testing.T, ca *agenttest.CA, addr string, cert *tls.Certificate) managementv1.ManagementClient {
+	cfg := &tls.Config{RootCAs: ca.Pool, ServerName: "localhost", MinVersion: tls.VersionTLS12}
+	if cert != nil {
+		cfg.Certificates = []tls.Certificate{*cert}
+	}
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(credentials.NewTLS(cfg)))
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return managementv1.NewManagementClient(conn)
+}
+
+// TestService tests every method against a store and state
+func TestService(t *testing.T) {
+	ca := agenttest.NewCA(t)
+	served := ca.IssueTLS(t, "www.example.com")
+	store := tlsstore.New(served)
+	store.SetSNI(ca.IssueTLS(t, "api.example.com"), "api.example.com")
+	state := agent.NewState(served)
+	state.RecordReload(agent.ReloadEvent{Time: time.Now(), Trigger: agent.TriggerManual, Result: agent.ResultSuccess})
+
+	var reloads, rollbacks atomic.Int32
+	rollbackErr := agent.ErrNoPrevious
+	hub := NewHub()
+	service := &Service{
+		Store:         store,
+		State:         state,
+		Started:       time.Now(),
+		RequestReload: func() bool { reloads.Add(1); return true },
+		RequestRollback: func(context.Context) error {
+			rollbacks.Add(1)
+			return rollbackErr
+		},
+		Events: hub,
+	}
+	srv, addr := startServer(t, ca, service, nil)
+	client := dial(t, ca, addr, ca.IssueTLS(t, "ops.example.com"))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	st, err := client.GetStatus(ctx, &managementv1.GetStatusRequest{})
+	if err != nil {
+		t.Fatalf("Failed to get status: %v", err)
+	}
+	if st.GetCertificate().GetFingerprint() != agent.Fingerprint(served) || !st.GetHealthy() {
+		t.Errorf("Expected the served certificate to be reported healthy, got %v", st)
+	}
+	if st.GetLastReload().GetTrigger() != agent.TriggerManual {
+		t.Errorf("Expected the last reload to be reported, got %v", st.GetLastReload())
+	}
+
+	list, err := client.ListCerts(ctx, &managementv1.ListCertsRequest{})
+	if err != nil {
+		t.Fatalf("Failed to list certificates: %v", err)
+	}
+	if certs := list.GetCertificates(); len(certs) != 2 || certs[0].GetName() != DefaultName || certs[1].GetName() != "api.example.com" {
+		t.Errorf("Expected default and SNI certificates, got %v", certs)
+	} else if dns := certs[1].GetDnsNames(); len(dns) != 1 || dns[0] != "api.example.com" {
+		t.Errorf("Expected SNI certificate details, got %v", certs[1])
+	}
+
+	if resp, err := client.TriggerReload(ctx, &managementv1.TriggerReloadRequest{}); err != nil || !resp.GetAccepted() || reloads.Load() != 1 {
+		t.Errorf("Expected an accepted reload, got %v, %v", resp, err)
+	}
+
+	if _, err := client.Rollback(ctx, &managementv1.RollbackRequest{}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Expected FailedPrecondition without a previous certificate, got %v", err)
+	}
+	rollbackErr = nil
+	if resp, err := client.Rollback(ctx, &managementv1.RollbackRequest{}); err != nil || resp.GetFingerprint() != agent.Fingerprint(served) {
+		t.Errorf("Expected a rollback reporting the served fingerprint, got %v, %v", resp, err)
+	}
+
+	stream, err := client.StreamEvents(ctx, &managementv1.StreamEventsRequest{})
+	if err != nil {
+		t.Fatalf("Failed to stream events: %v", err)
+	}
+	// Wait for the server to subscribe before publishing
+	deadline := time.Now().Add(2 * time.Second)
+	for hubSize(hub) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	hub.Notify(ctx, notify.Event{Type: notify.EventReloadSucceeded, Message: "certificate reloaded", Time: time.Now()})
+	event, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Failed to receive event: %v", err)
+	}
+	if event.GetType() != notify.EventReloadSucceeded {
+		t.Errorf("Expected reload event, got %v", event)
+	}
+
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Errorf("Failed to shut down: %v", err)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.Unavailable {
+		t.Errorf("Expected the stream to end with Unavailable on shutdown, got %v", err)
+	}
+}
+
+func hubSize(h *Hub) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs)
+}
+
+// TestServerAuthorization tests that calls need a client certificate whose
+// identity the authorizer allows
+func TestServerAuthorization(t *testing.T) {
+	ca := agenttest.NewCA(t)
+	served := ca.IssueTLS(t, "www.example.com")
+	service := &Service{Store: tlsstore.New(served), State: agent.NewState(served)}
+	authorizer := authz.New([]authz.Rule{{Allow: []string{"dns:ops.example.com"}}})
+	authorizer.Audit = func(authz.Decision) {}
+	_, addr := startServer(t, ca, service, authorizer)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tests := []struct {
+		name string
+		cert *tls.Certificate
+		want codes.Code
+	}{
+		{"no certificate", nil, codes.Unauthenticated},
+		{"not allowed", ca.IssueTLS(t, "app.example.com"), codes.PermissionDenied},
+		{"allowed", ca.IssueTLS(t, "ops.example.com"), codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := dial(t, ca, addr, tt.cert)
+			_, err := client.GetStatus(ctx, &managementv1.GetStatusRequest{})
+			if status.Code(err) != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+
+	// Methods without a configured callback are reported as unimplemented
+	client := dial(t, ca, addr, ca.IssueTLS(t, "ops.example.com"))
+	if _, err := client.Rollback(ctx, &managementv1.RollbackRequest{}); status.Code(err) != codes.Unimplemented {
+		t.Errorf("Expected Unimplemented, got %v", err)
+	}
+}
+
+// TestHub tests subscription delivery, cancellation and close
+func TestHub(t *testing.T) {
+	hub := NewHub()
+	events, cancel := hub.Subscribe()
+	hub.Notify(context.Background(), notify.Event{Type: notify.EventReloadFailed})
+	if e := <-events; e.Type != notify.EventReloadFailed {
+		t.Errorf("Expected reload failure event, got %+v", e)
+	}
+
+	cancel()
+	if _, ok := <-events; ok {
+		t.Error("Expected the channel to close on cancel")
+	}
+	cancel()
+
+	events, _ = hub.Subscribe()
+	hub.Close()
+	if _, ok := <-events; ok {
+		t.Error("Expected the channel to close with the hub")
+	}
+	if events, _ := hub.Subscribe(); !isClosed(events) {
+		t.Error("Expected subscriptions after close to end immediately")
+	}
+
+	// A full subscriber does not block delivery
+	hub = NewHub()
+	hub.Subscribe()
+	for range subscriberBuffer + 1 {
+		hub.Notify(context.Background(), notify.Event{})
+	}
+}
+
+func isClosed(ch <-chan notify.Event) bool {
+	select {
+	case _, ok := <-ch:
+		return !ok
+	default:
+		return false
+	}
+}
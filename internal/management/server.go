@@ -0,0 +1,105 @@
+package management
+
+import (
+	"context"
+	"crypto/x509"
+	"net"
+
+	managementv1 "tls-agent/api/gen/v1"
+	"tls-agent/internal/authz"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Server serves a Service over gRPC and implements lifecycle.Server
+type Server struct {
+	grpc    *grpc.Server
+	service *Service
+}
+
+// NewServer creates a server for service. creds must verify client
+// certificates; calls without one are refused. When authorizer is set, the
+// client identity is also checked against its rules using the full method
+// name (e.g. "/api.v1.Management/Rollback") as the path.
+func NewServer(service *Service, creds credentials.TransportCredentials, authorizer *authz.Authorizer) *Server {
+	check := func(ctx context.Context, method string) error {
+		cert := peerCertificate(ctx)
+		if cert == nil {
+			return status.Error(codes.Unauthenticated, "client certificate required")
+		}
+		if authorizer == nil {
+			return nil
+		}
+		if err := authorizer.Authorize(method, cert); err != nil {
+			return status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil
+	}
+
+	gs := grpc.NewServer(
+		grpc.Creds(creds),
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if err := check(ctx, info.FullMethod); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := check(ss.Context(), info.FullMethod); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		}),
+	)
+	managementv1.RegisterManagementServer(gs, service)
+	return &Server{grpc: gs, service: service}
+}
+
+// Serve accepts connections on ln until the server stops
+func (s *Server) Serve(ln net.Listener) error {
+	return s.grpc.Serve(ln)
+}
+
+// Shutdown ends event streams and waits for in-flight calls, stopping
+// forcibly if ctx expires first
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.service.Events != nil {
+		s.service.Events.Close()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.grpc.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.grpc.Stop()
+		return ctx.Err()
+	}
+}
+
+// Close stops the server immediately
+func (s *Server) Close() error {
+	s.grpc.Stop()
+	return nil
+}
+
+// peerCertificate returns the verified client leaf certificate of the call
+func peerCertificate(ctx context.Context) *x509.Certificate {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.PeerCertificates) == 0 {
+		return nil
+	}
+	return info.State.PeerCertificates[0]
+}
@@ -0,0 +1,384 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Registry holds a set of metrics and renders them in the Prometheus text format
+type Registry struct {
+	mu      sync.RWMutex
+	metrics map[string]collector
+}
+
+type collector interface {
+	write(w io.Writer, name string)
+	collect(name string, add func(Sample))
+}
+
+// Metric kinds reported in samples
+const (
+	KindCounter = "counter"
+	KindGauge   = "gauge"
+)
+
+// Label is one label of a sample
+type Label struct {
+	Name, Value string
+}
+
+// Sample is the current value of one metric series, for exporters other
+// than the Prometheus text format
+type Sample struct {
+	Name   string
+	Kind   string
+	Labels []Label
+	Value  float64
+}
+
+// Default is the registry used by the package-level constructors
+var Default = NewRegistry()
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]collector)}
+}
+
+// register adds c under name, returning the existing collector if the name is taken
+func (r *Registry) register(name string, c collector) collector {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.metrics[name]; ok {
+		return existing
+	}
+	r.metrics[name] = c
+	return c
+}
+
+// WriteText writes all metrics in the Prometheus text exposition format
+func (r *Registry) WriteText(w io.Writer) {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	r.mu.RUnlock()
+	sort.Strings(names)
+
+	for _, name := range names {
+		r.mu.RLock()
+		c := r.metrics[name]
+		r.mu.RUnlock()
+		c.write(w, name)
+	}
+}
+
+// Gather returns the current value of every series, sorted by name
+func (r *Registry) Gather() []Sample {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	r.mu.RUnlock()
+	sort.Strings(names)
+
+	var samples []Sample
+	for _, name := range names {
+		r.mu.RLock()
+		c := r.metrics[name]
+		r.mu.RUnlock()
+		c.collect(name, func(s Sample) { samples = append(samples, s) })
+	}
+	return samples
+}
+
+// Gather returns the samples of the default registry
+func Gather() []Sample {
+	return Default.Gather()
+}
+
+// Handler serves the registry over HTTP
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		r.WriteText(w)
+	})
+}
+
+// Handler serves the default registry over HTTP
+func Handler() http.Handler {
+	return Default.Handler()
+}
+
+// Counter is a monotonically increasing value
+type Counter struct {
+	help string
+	v    atomic.Uint64
+}
+
+// NewCounter registers a counter in the default registry
+func NewCounter(name, help string) *Counter {
+	return Default.NewCounter(name, help)
+}
+
+// NewCounter registers a counter in r
+func (r *Registry) NewCounter(name, help string) *Counter {
+	c, ok := r.register(name, &Counter{help: help}).(*Counter)
+	if !ok {
+		panic("metrics: " + name + " already registered with a different type")
+	}
+	return c
+}
+
+// Inc increments the counter by one
+func (c *Counter) Inc() {
+	c.v.Add(1)
+}
+
+// Add increments the counter by n
+func (c *Counter) Add(n uint64) {
+	c.v.Add(n)
+}
+
+// Value returns the current counter value
+func (c *Counter) Value() uint64 {
+	return c.v.Load()
+}
+
+func (c *Counter) write(w io.Writer, name string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, c.help, name, name, c.Value())
+}
+
+func (c *Counter) collect(name string, add func(Sample)) {
+	add(Sample{Name: name, Kind: KindCounter, Value: float64(c.Value())})
+}
+
+// Gauge is a value that can go up and down
+type Gauge struct {
+	help string
+	bits atomic.Uint64
+}
+
+// NewGauge registers a gauge in the default registry
+func NewGauge(name, help string) *Gauge {
+	return Default.NewGauge(name, help)
+}
+
+// NewGauge registers a gauge in r
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	g, ok := r.register(name, &Gauge{help: help}).(*Gauge)
+	if !ok {
+		panic("metrics: " + name + " already registered with a different type")
+	}
+	return g
+}
+
+// Set sets the gauge to v
+func (g *Gauge) Set(v float64) {
+	g.bits.Store(math.Float64bits(v))
+}
+
+// Value returns the current gauge value
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(g.bits.Load())
+}
+
+func (g *Gauge) write(w io.Writer, name string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %g\n", name, g.help, name, name, g.Value())
+}
+
+func (g *Gauge) collect(name string, add func(Sample)) {
+	add(Sample{Name: name, Kind: KindGauge, Value: g.Value()})
+}
+
+// CounterVec is a family of counters partitioned by label values
+type CounterVec struct {
+	help   string
+	labels []string
+
+	mu       sync.RWMutex
+	counters map[string]*Counter
+	values   map[string][]string
+}
+
+// NewCounterVec registers a labelled counter family in the default registry
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return Default.NewCounterVec(name, help, labels...)
+}
+
+// NewCounterVec registers a labelled counter family in r
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	v, ok := r.register(name, &CounterVec{
+		help:     help,
+		labels:   labels,
+		counters: make(map[string]*Counter),
+		values:   make(map[string][]string),
+	}).(*CounterVec)
+	if !ok {
+		panic("metrics: " + name + " already registered with a different type")
+	}
+	return v
+}
+
+// With returns the counter for the given label values, creating it if needed
+func (v *CounterVec) With(values ...string) *Counter {
+	key := labelString(v.labels, values)
+
+	v.mu.RLock()
+	c, ok := v.counters[key]
+	v.mu.RUnlock()
+	if ok {
+		return c
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if c, ok = v.counters[key]; !ok {
+		c = &Counter{}
+		v.counters[key] = c
+		v.values[key] = append([]string(nil), values...)
+	}
+	return c
+}
+
+func (v *CounterVec) write(w io.Writer, name string) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	keys := make([]string, 0, len(v.counters))
+	for key := range v.counters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, v.help, name)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s{%s} %d\n", name, key, v.counters[key].Value())
+	}
+}
+
+func (v *CounterVec) collect(name string, add func(Sample)) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	keys := make([]string, 0, len(v.counters))
+	for key := range v.counters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		add(Sample{Name: name, Kind: KindCounter, Labels: labelPairs(v.labels, v.values[key]), Value: float64(v.counters[key].Value())})
+	}
+}
+
+// labelPairs zips label names with their values
+func labelPairs(names, values []string) []Label {
+	labels := make([]Label, len(names))
+	for i, name := range names {
+		labels[i].Name = name
+		if i < len(values) {
+			labels[i].Value = values[i]
+		}
+	}
+	return labels
+}
+
+// labelString renders label names and values in the text format
+func labelString(names, values []string) string {
+	pairs := make([]string, len(names))
+	for i, label := range names {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		pairs[i] = fmt.Sprintf("%s=%q", label, value)
+	}
+	return strings.Join(pairs, ",")
+}
+
+// GaugeVec is a family of gauges partitioned by label values
+type GaugeVec struct {
+	help   string
+	labels []string
+
+	mu     sync.RWMutex
+	gauges map[string]*Gauge
+	values map[string][]string
+}
+
+// NewGaugeVec registers a labelled gauge family in the default registry
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return Default.NewGaugeVec(name, help, labels...)
+}
+
+// NewGaugeVec registers a labelled gauge family in r
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	v, ok := r.register(name, &GaugeVec{
+		help:   help,
+		labels: labels,
+		gauges: make(map[string]*Gauge),
+		values: make(map[string][]string),
+	}).(*GaugeVec)
+	if !ok {
+		panic("metrics: " + name + " already registered with a different type")
+	}
+	return v
+}
+
+// With returns the gauge for the given label values, creating it if needed
+func (v *GaugeVec) With(values ...string) *Gauge {
+	key := labelString(v.labels, values)
+
+	v.mu.RLock()
+	g, ok := v.gauges[key]
+	v.mu.RUnlock()
+	if ok {
+		return g
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if g, ok = v.gauges[key]; !ok {
+		g = &Gauge{}
+		v.gauges[key] = g
+		v.values[key] = append([]string(nil), values...)
+	}
+	return g
+}
+
+// sortedKeys returns the label strings of the family's gauges in order
+func (v *GaugeVec) sortedKeys() []string {
+	keys := make([]string, 0, len(v.gauges))
+	for key := range v.gauges {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (v *GaugeVec) write(w io.Writer, name string) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", name, v.help, name)
+	for _, key := range v.sortedKeys() {
+		fmt.Fprintf(w, "%s{%s} %g\n", name, key, v.gauges[key].Value())
+	}
+}
+
+func (v *GaugeVec) collect(name string, add func(Sample)) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	for _, key := range v.sortedKeys() {
+		add(Sample{Name: name, Kind: KindGauge, Labels: labelPairs(v.labels, v.values[key]), Value: v.gauges[key].Value()})
+	}
+}
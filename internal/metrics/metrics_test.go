@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestCounterAndGauge tests basic counter and gauge behavior
+func TestCounterAndGauge(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("test_total", "A test counter")
+	g := r.NewGauge("test_gauge", "A test gauge")
+
+	c.Inc()
+	c.Add(2)
+	g.Set(1.5)
+
+	if c.Value() != 3 {
+		t.Errorf("Expected counter 3, got %d", c.Value())
+	}
+	if g.Value() != 1.5 {
+		t.Errorf("Expected gauge 1.5, got %v", g.Value())
+	}
+
+	// Registering the same name again returns the existing metric
+	if r.NewCounter("test_total", "dup") != c {
+		t.Error("Duplicate registration should return the existing counter")
+	}
+}
+
+// TestCounterVec tests labelled counters and text exposition
+func TestCounterVec(t *testing.T) {
+	r := NewRegistry()
+	v := r.NewCounterVec("requests_total", "Requests", "code")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v.With("200").Inc()
+		}()
+	}
+	wg.Wait()
+	v.With("500").Inc()
+
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+
+	for _, want := range []string{
+		"# TYPE requests_total counter",
+		`requests_total{code="200"} 50`,
+		`requests_total{code="500"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected %q in output:\n%s", want, body)
+		}
+	}
+}
+
+// TestGaugeVec tests labelled gauges and text exposition
+func TestGaugeVec(t *testing.T) {
+	r := NewRegistry()
+	v := r.NewGaugeVec("build_info", "Build", "version", "commit")
+	v.With("1.2.3", "abc").Set(1)
+
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{"# TYPE build_info gauge", `build_info{version="1.2.3",commit="abc"} 1`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected %q in output:\n%s", want, body)
+		}
+	}
+	if samples := r.Gather(); len(samples) != 1 || samples[0].Kind != KindGauge || samples[0].Labels[1].Value != "abc" {
+		t.Errorf("Unexpected samples %+v", samples)
+	}
+}
+
+// TestGather tests collecting samples for exporters
+func TestGather(t *testing.T) {
+	r := NewRegistry()
+	r.NewGauge("b_gauge", "A gauge").Set(2.5)
+	r.NewCounterVec("a_total", "Labelled", "listener", "reason").With("public", "denied").Add(3)
+
+	samples := r.Gather()
+	if len(samples) != 2 {
+		t.Fatalf("Expected 2 samples, got %+v", samples)
+	}
+	vec := samples[0]
+	if vec.Name != "a_total" || vec.Kind != KindCounter || vec.Value != 3 ||
+		len(vec.Labels) != 2 || vec.Labels[1] != (Label{Name: "reason", Value: "denied"}) {
+		t.Errorf("Unexpected counter sample %+v", vec)
+	}
+	if g := samples[1]; g.Name != "b_gauge" || g.Kind != KindGauge || g.Value != 2.5 {
+		t.Errorf("Unexpected gauge sample %+v", g)
+	}
+}
@@ -0,0 +1,15 @@
+// Package metricstest helps tests assert on metrics registered in the
+// process-wide default registry, which other tests in the same package may
+// also have moved
+package metricstest
+
+import "tls-agent/internal/metrics"
+
+// Delta returns a function reporting how much c has grown since Delta was
+// called
+func Delta(c *metrics.Counter) func() uint64 {
+	start := c.Value()
+	return func() uint64 {
+		return c.Value() - start
+	}
+}
@@ -0,0 +1,178 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Event types emitted by the agent
+const (
+	EventPolicyViolation = "policy_violation"
+	EventReloadSucceeded = "reload_succeeded"
+	EventReloadFailed    = "reload_failed"
+
+	EventCertificateExpiring = "certificate_expiring"
+	EventKeyAgeExceeded      = "key_age_exceeded"
+)
+
+// Severities
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Event is an alert or notification raised by a subsystem
+type Event struct {
+	Type     string            `json:"type"`
+	Severity string            `json:"severity"`
+	Message  string            `json:"message"`
+	Time     time.Time         `json:"time"`
+	Fields   map[string]string `json:"fields,omitempty"`
+}
+
+// Notifier delivers events to an external system
+type Notifier interface {
+	Notify(ctx context.Context, event Event) error
+}
+
+// NotifierFunc adapts a function to the Notifier interface
+type NotifierFunc func(ctx context.Context, event Event) error
+
+// Notify calls f(ctx, event)
+func (f NotifierFunc) Notify(ctx context.Context, event Event) error {
+	return f(ctx, event)
+}
+
+// Log writes events to the standard logger
+type Log struct{}
+
+// Notify logs the event
+func (Log) Notify(_ context.Context, event Event) error {
+	log.Printf("Alert [%s] %s: %s %v", event.Severity, event.Type, event.Message, event.Fields)
+	return nil
+}
+
+// Webhook POSTs events as JSON to a URL
+type Webhook struct {
+	URL    string
+	Client *http.Client
+}
+
+// Notify posts the event to the webhook URL
+func (w *Webhook) Notify(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := w.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s returned %d", w.URL, resp.StatusCode)
+	}
+	return nil
+}
+
+// Multi fans an event out to several notifiers, returning all errors joined
+type Multi []Notifier
+
+// Notify delivers the event to every notifier
+func (m Multi) Notify(ctx context.Context, event Event) error {
+	var errs []error
+	for _, n := range m {
+		if err := n.Notify(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Send fills in the event time and delivers it with a bounded timeout, logging
+// delivery failures. A nil notifier is a no-op.
+func Send(n Notifier, event Event) {
+	if n == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	inflight.begin()
+	defer inflight.end()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := n.Notify(ctx, event); err != nil {
+		log.Printf("Notifier: failed to deliver %s event: %v", event.Type, err)
+	}
+}
+
+// inflight tracks deliveries started by Send
+var inflight deliveries
+
+// deliveries counts deliveries in progress. Unlike a WaitGroup it may be
+// waited on while new deliveries start.
+type deliveries struct {
+	mu   sync.Mutex
+	n    int
+	idle chan struct{} // closed when n drops to zero
+}
+
+func (d *deliveries) begin() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.n == 0 {
+		d.idle = make(chan struct{})
+	}
+	d.n++
+}
+
+func (d *deliveries) end() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.n--
+	if d.n == 0 {
+		close(d.idle)
+	}
+}
+
+// Flush waits for deliveries in progress to finish or ctx to end, so that
+// alerts raised just before shutdown are not lost
+func Flush(ctx context.Context) error {
+	inflight.mu.Lock()
+	if inflight.n == 0 {
+		inflight.mu.Unlock()
+		return nil
+	}
+	idle := inflight.idle
+	inflight.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,84 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestWebhook tests JSON delivery to a webhook
+func TestWebhook(t *testing.T) {
+	received := make(chan Event, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e Event
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			t.Errorf("Invalid webhook body: %v", err)
+		}
+		received <- e
+	}))
+	defer srv.Close()
+
+	Send(&Webhook{URL: srv.URL}, Event{Type: EventPolicyViolation, Severity: SeverityCritical, Message: "bad cert"})
+
+	e := <-received
+	if e.Type != EventPolicyViolation || e.Message != "bad cert" || e.Time.IsZero() {
+		t.Errorf("Unexpected event: %+v", e)
+	}
+}
+
+// TestMulti tests fan-out and error aggregation
+func TestMulti(t *testing.T) {
+	var calls int
+	ok := NotifierFunc(func(context.Context, Event) error { calls++; return nil })
+	failing := NotifierFunc(func(context.Context, Event) error { calls++; return errors.New("down") })
+
+	err := Multi{ok, failing, ok}.Notify(context.Background(), Event{Type: EventReloadFailed})
+	if err == nil {
+		t.Error("Expected aggregated error")
+	}
+	if calls != 3 {
+		t.Errorf("Expected all notifiers to be called, got %d", calls)
+	}
+
+	// A nil notifier is a no-op
+	Send(nil, Event{Type: EventReloadFailed})
+}
+
+// TestFlush tests that Flush waits for deliveries in progress
+func TestFlush(t *testing.T) {
+	release := make(chan struct{})
+	delivered := make(chan struct{})
+	slow := NotifierFunc(func(context.Context, Event) error {
+		<-release
+		close(delivered)
+		return nil
+	})
+
+	entered := make(chan struct{})
+	go func() {
+		close(entered)
+		Send(slow, Event{Type: EventReloadFailed})
+	}()
+	<-entered
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := Flush(ctx); err == nil {
+		t.Error("Flush should time out while a delivery is blocked")
+	}
+
+	close(release)
+	if err := Flush(context.Background()); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	select {
+	case <-delivered:
+	default:
+		t.Error("Flush returned before the delivery finished")
+	}
+}
@@ -0,0 +1,23 @@
+//go:build windows
+
+package pidfile
+
+import "golang.org/x/sys/windows"
+
+// stillActive is the exit code reported for a process that has not exited
+const stillActive = 259
+
+// alive reports whether a process with the given ID exists
+func alive(pid int) bool {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		// Access denied means the process exists but belongs to another user
+		return err == windows.ERROR_ACCESS_DENIED
+	}
+	defer windows.CloseHandle(h)
+	var code uint32
+	if err := windows.GetExitCodeProcess(h, &code); err != nil {
+		return true
+	}
+	return code == stillActive
+}
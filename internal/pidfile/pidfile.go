@@ -0,0 +1,76 @@
+// Package pidfile records the agent's process ID for init scripts and ops
+// tooling, and refuses to start a second agent against the same file.
+package pidfile
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ErrRunning is returned by Acquire when the file names a live process
+var ErrRunning = errors.New("pidfile: another process is running")
+
+// File is a PID file owned by this process
+type File struct {
+	path string
+	pid  int
+}
+
+// Acquire writes the current process ID to path. A file left behind by a
+// process that has exited is replaced; one naming a running process fails
+// with ErrRunning.
+func Acquire(path string) (*File, error) {
+	pid := os.Getpid()
+	for range 2 {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, werr := fmt.Fprintf(f, "%d\n", pid)
+			if err := errors.Join(werr, f.Close()); err != nil {
+				os.Remove(path)
+				return nil, fmt.Errorf("pidfile: write %s: %w", path, err)
+			}
+			return &File{path: path, pid: pid}, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("pidfile: %w", err)
+		}
+
+		// A file naming this process is left over from a previous run that
+		// had the same PID, as is common for PID 1 in containers
+		if other, err := Read(path); err == nil && other != pid && alive(other) {
+			return nil, fmt.Errorf("%w: pid %d in %s", ErrRunning, other, path)
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("pidfile: remove stale %s: %w", path, err)
+		}
+	}
+	return nil, fmt.Errorf("pidfile: %s was recreated concurrently", path)
+}
+
+// Read returns the process ID stored in path
+func Read(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("pidfile: %s does not hold a process ID", path)
+	}
+	return pid, nil
+}
+
+// Remove deletes the file unless another process has since taken it over
+func (f *File) Remove() error {
+	if pid, err := Read(f.path); err != nil || pid != f.pid {
+		return nil
+	}
+	if err := os.Remove(f.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("pidfile: %w", err)
+	}
+	return nil
+}
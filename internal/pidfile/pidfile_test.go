@@ -0,0 +1,91 @@
+package pidfile
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// TestAcquireRemove tests writing and removing a PID file
+func TestAcquireRemove(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.pid")
+	f, err := Acquire(path)
+	if err != nil {
+		t.Fatalf("Failed to acquire: %v", err)
+	}
+	if pid, err := Read(path); err != nil || pid != os.Getpid() {
+		t.Errorf("Expected pid %d, got %d (%v)", os.Getpid(), pid, err)
+	}
+	if err := f.Remove(); err != nil {
+		t.Fatalf("Failed to remove: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected the file to be removed, got %v", err)
+	}
+}
+
+// TestAcquireRunning tests that a file naming a live process is not replaced
+func TestAcquireRunning(t *testing.T) {
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+
+	path := filepath.Join(t.TempDir(), "agent.pid")
+	if err := os.WriteFile(path, []byte(strconv.Itoa(cmd.Process.Pid)), 0644); err != nil {
+		t.Fatalf("Failed to write pid file: %v", err)
+	}
+	if _, err := Acquire(path); !errors.Is(err, ErrRunning) {
+		t.Errorf("Expected ErrRunning, got %v", err)
+	}
+}
+
+// TestAcquireStale tests that files left by exited processes, or holding
+// garbage, are replaced
+func TestAcquireStale(t *testing.T) {
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Failed to run process: %v", err)
+	}
+
+	for name, content := range map[string]string{
+		"exited":  strconv.Itoa(cmd.Process.Pid),
+		"garbage": "not a pid",
+		"self":    strconv.Itoa(os.Getpid()),
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "agent.pid")
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatalf("Failed to write pid file: %v", err)
+			}
+			f, err := Acquire(path)
+			if err != nil {
+				t.Fatalf("Failed to replace stale file: %v", err)
+			}
+			f.Remove()
+		})
+	}
+}
+
+// TestRemoveTakenOver tests that Remove leaves a file another process now owns
+func TestRemoveTakenOver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.pid")
+	f, err := Acquire(path)
+	if err != nil {
+		t.Fatalf("Failed to acquire: %v", err)
+	}
+	if err := os.WriteFile(path, []byte("1\n"), 0644); err != nil {
+		t.Fatalf("Failed to overwrite pid file: %v", err)
+	}
+	if err := f.Remove(); err != nil {
+		t.Fatalf("Failed to remove: %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("Expected the file to be kept, got %v", err)
+	}
+}
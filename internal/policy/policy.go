@@ -0,0 +1,213 @@
+package policy
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Policy describes the constraints a certificate must satisfy before the
+// agent will serve it. Zero values disable the corresponding rule.
+type Policy struct {
+	// MinRSABits is the minimum RSA modulus size
+	MinRSABits int
+
+	// MinECDSABits is the minimum ECDSA curve size
+	MinECDSABits int
+
+	// AllowedSignatureAlgorithms lists accepted x509 signature algorithms
+	// by name (e.g. "SHA256-RSA", "ECDSA-SHA256")
+	AllowedSignatureAlgorithms []string
+
+	// RequiredSANs must all be present as DNS names, IPs, emails, or URIs
+	RequiredSANs []string
+
+	// MaxValidity is the maximum NotAfter-NotBefore span
+	MaxValidity time.Duration
+
+	// RequiredIssuer must match the issuer common name or organization
+	RequiredIssuer string
+
+	// FIPS requires FIPS 186-5 keys and signatures: RSA of at least 2048
+	// bits, ECDSA on P-256 or larger, Ed25519, and SHA-2 signatures. It
+	// applies on top of the other rules.
+	FIPS bool
+}
+
+// fipsSignatureAlgorithms are the certificate signatures accepted by FIPS
+var fipsSignatureAlgorithms = map[x509.SignatureAlgorithm]bool{
+	x509.SHA256WithRSA:    true,
+	x509.SHA384WithRSA:    true,
+	x509.SHA512WithRSA:    true,
+	x509.SHA256WithRSAPSS: true,
+	x509.SHA384WithRSAPSS: true,
+	x509.SHA512WithRSAPSS: true,
+	x509.ECDSAWithSHA256:  true,
+	x509.ECDSAWithSHA384:  true,
+	x509.ECDSAWithSHA512:  true,
+	x509.PureEd25519:      true,
+}
+
+// Minimum FIPS key sizes
+const (
+	fipsMinRSABits   = 2048
+	fipsMinECDSABits = 256
+)
+
+// Violation is a single failed rule
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// ViolationError is returned when a certificate fails the policy
+type ViolationError struct {
+	Violations []Violation
+}
+
+func (e *ViolationError) Error() string {
+	msgs := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		msgs[i] = v.Rule + ": " + v.Message
+	}
+	return "certificate policy violation: " + strings.Join(msgs, "; ")
+}
+
+// IsZero reports whether the policy has no rules
+func (p Policy) IsZero() bool {
+	return p.MinRSABits == 0 && p.MinECDSABits == 0 && len(p.AllowedSignatureAlgorithms) == 0 &&
+		len(p.RequiredSANs) == 0 && p.MaxValidity == 0 && p.RequiredIssuer == "" && !p.FIPS
+}
+
+// Check evaluates the policy against cert, returning a *ViolationError if any rule fails
+func (p Policy) Check(cert *tls.Certificate) error {
+	if cert == nil || len(cert.Certificate) == 0 {
+		return &ViolationError{Violations: []Violation{{Rule: "certificate", Message: "no certificate"}}}
+	}
+
+	leaf := cert.Leaf
+	if leaf == nil {
+		var err error
+		if leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return fmt.Errorf("parse certificate: %w", err)
+		}
+	}
+
+	violations := p.Evaluate(leaf)
+	if len(violations) > 0 {
+		return &ViolationError{Violations: violations}
+	}
+	return nil
+}
+
+// Evaluate returns every rule the leaf certificate violates
+func (p Policy) Evaluate(leaf *x509.Certificate) []Violation {
+	var violations []Violation
+	add := func(rule, format string, args ...any) {
+		violations = append(violations, Violation{Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch key := leaf.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if bits := key.N.BitLen(); p.MinRSABits > 0 && bits < p.MinRSABits {
+			add("min_key_size", "RSA key is %d bits, minimum is %d", bits, p.MinRSABits)
+		}
+	case *ecdsa.PublicKey:
+		if bits := key.Curve.Params().BitSize; p.MinECDSABits > 0 && bits < p.MinECDSABits {
+			add("min_key_size", "ECDSA key is %d bits, minimum is %d", bits, p.MinECDSABits)
+		}
+	case ed25519.PublicKey:
+		// Fixed-size key, nothing to check
+	}
+
+	if len(p.AllowedSignatureAlgorithms) > 0 {
+		alg := leaf.SignatureAlgorithm.String()
+		allowed := false
+		for _, a := range p.AllowedSignatureAlgorithms {
+			if strings.EqualFold(a, alg) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			add("signature_algorithm", "%s is not in the allowed list %v", alg, p.AllowedSignatureAlgorithms)
+		}
+	}
+
+	for _, san := range p.RequiredSANs {
+		if !hasSAN(leaf, san) {
+			add("required_san", "missing SAN %q", san)
+		}
+	}
+
+	if validity := leaf.NotAfter.Sub(leaf.NotBefore); p.MaxValidity > 0 && validity > p.MaxValidity {
+		add("max_validity", "validity period %s exceeds %s", validity.Round(time.Hour), p.MaxValidity)
+	}
+
+	if p.RequiredIssuer != "" && !issuerMatches(leaf, p.RequiredIssuer) {
+		add("required_issuer", "issuer %q does not match %q", leaf.Issuer.String(), p.RequiredIssuer)
+	}
+
+	if p.FIPS {
+		switch key := leaf.PublicKey.(type) {
+		case *rsa.PublicKey:
+			if bits := key.N.BitLen(); bits < fipsMinRSABits {
+				add("fips", "RSA key is %d bits, FIPS requires %d", bits, fipsMinRSABits)
+			}
+		case *ecdsa.PublicKey:
+			if bits := key.Curve.Params().BitSize; bits < fipsMinECDSABits {
+				add("fips", "ECDSA key is %d bits, FIPS requires %d", bits, fipsMinECDSABits)
+			}
+		case ed25519.PublicKey:
+			// Approved by FIPS 186-5
+		default:
+			add("fips", "%s keys are not FIPS approved", leaf.PublicKeyAlgorithm)
+		}
+		if !fipsSignatureAlgorithms[leaf.SignatureAlgorithm] {
+			add("fips", "%s signatures are not FIPS approved", leaf.SignatureAlgorithm)
+		}
+	}
+
+	return violations
+}
+
+func hasSAN(leaf *x509.Certificate, san string) bool {
+	for _, name := range leaf.DNSNames {
+		if strings.EqualFold(name, san) {
+			return true
+		}
+	}
+	for _, ip := range leaf.IPAddresses {
+		if ip.String() == san {
+			return true
+		}
+	}
+	for _, email := range leaf.EmailAddresses {
+		if email == san {
+			return true
+		}
+	}
+	for _, uri := range leaf.URIs {
+		if uri.String() == san {
+			return true
+		}
+	}
+	return false
+}
+
+func issuerMatches(leaf *x509.Certificate, issuer string) bool {
+	if leaf.Issuer.CommonName == issuer || leaf.Issuer.String() == issuer {
+		return true
+	}
+	for _, org := range leaf.Issuer.Organization {
+		if org == issuer {
+			return true
+		}
+	}
+	return false
+}
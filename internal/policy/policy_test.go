@@ -0,0 +1,119 @@
+package policy_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"testing"
+	"time"
+
+	"tls-agent/internal/policy"
+	"tls-agent/pkg/agenttest"
+)
+
+func template() *x509.Certificate {
+	return &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "example.com", Organization: []string{"Example CA"}},
+		DNSNames: []string{"example.com", "www.example.com"},
+		NotAfter: time.Now().Add(90 * 24 * time.Hour),
+	}
+}
+
+// TestPolicyAccepts tests a certificate satisfying every rule
+func TestPolicyAccepts(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	cert := agenttest.SelfSigned(t, template(), key)
+
+	p := policy.Policy{
+		MinECDSABits:               256,
+		AllowedSignatureAlgorithms: []string{"ECDSA-SHA256"},
+		RequiredSANs:               []string{"example.com", "www.example.com"},
+		MaxValidity:                100 * 24 * time.Hour,
+		RequiredIssuer:             "Example CA",
+	}
+	if err := p.Check(cert); err != nil {
+		t.Errorf("Expected certificate to pass, got %v", err)
+	}
+}
+
+// TestPolicyViolations tests that each rule reports its violation
+func TestPolicyViolations(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 1024)
+	cert := agenttest.SelfSigned(t, template(), key)
+
+	p := policy.Policy{
+		MinRSABits:                 2048,
+		AllowedSignatureAlgorithms: []string{"ECDSA-SHA256"},
+		RequiredSANs:               []string{"api.example.com"},
+		MaxValidity:                30 * 24 * time.Hour,
+		RequiredIssuer:             "Other CA",
+	}
+
+	err := p.Check(cert)
+	var violation *policy.ViolationError
+	if !errors.As(err, &violation) {
+		t.Fatalf("Expected ViolationError, got %v", err)
+	}
+
+	rules := map[string]bool{}
+	for _, v := range violation.Violations {
+		rules[v.Rule] = true
+	}
+	for _, rule := range []string{"min_key_size", "signature_algorithm", "required_san", "max_validity", "required_issuer"} {
+		if !rules[rule] {
+			t.Errorf("Expected %s violation in %v", rule, violation.Violations)
+		}
+	}
+}
+
+// TestPolicyZero tests that an empty policy accepts anything
+func TestPolicyZero(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 1024)
+	cert := agenttest.SelfSigned(t, template(), key)
+
+	var p policy.Policy
+	if !p.IsZero() {
+		t.Error("Empty policy should be zero")
+	}
+	if err := p.Check(cert); err != nil {
+		t.Errorf("Empty policy should accept, got %v", err)
+	}
+}
+
+// TestPolicyFIPS tests the FIPS key size and signature rules
+func TestPolicyFIPS(t *testing.T) {
+	fips := policy.Policy{FIPS: true}
+	if fips.IsZero() {
+		t.Error("Expected a FIPS policy not to be zero")
+	}
+
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err := fips.Check(agenttest.SelfSigned(t, template(), ecKey)); err != nil {
+		t.Errorf("Expected a P-256 certificate to pass, got %v", err)
+	}
+
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+	tmpl := template()
+	tmpl.SignatureAlgorithm = x509.SHA1WithRSA
+	var violation *policy.ViolationError
+	if err := fips.Check(agenttest.SelfSigned(t, tmpl, rsaKey)); !errors.As(err, &violation) {
+		t.Fatalf("Expected a violation, got %v", err)
+	}
+	if len(violation.Violations) != 2 {
+		t.Errorf("Expected key size and signature violations, got %+v", violation.Violations)
+	}
+	for _, v := range violation.Violations {
+		if v.Rule != "fips" {
+			t.Errorf("Expected fips violations, got %+v", v)
+		}
+	}
+
+	smallKey, _ := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	if err := fips.Check(agenttest.SelfSigned(t, template(), smallKey)); err == nil {
+		t.Error("Expected a P-224 certificate to be rejected")
+	}
+}
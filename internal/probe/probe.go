@@ -0,0 +1,126 @@
+// Package probe verifies a candidate certificate the way clients will see it
+// before it is promoted. The candidate is served on a temporary "green"
+// listener and a verifying client handshakes with it, either directly or
+// through a configured URL that routes to the green listener (a load
+// balancer or DNS name), so a certificate that clients would reject never
+// replaces the one in service.
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	"tls-agent/internal/tlsstore"
+)
+
+// DefaultTimeout bounds a probe when Prober.Timeout is zero
+const DefaultTimeout = 5 * time.Second
+
+// Prober checks candidate certificates with a TLS handshake
+type Prober struct {
+	// Roots are the roots clients trust; nil uses the system roots
+	Roots *x509.CertPool
+
+	// ServerName is the name clients verify; empty uses the first DNS name
+	// of the candidate
+	ServerName string
+
+	// Listen is the green listener address; empty picks a loopback port
+	Listen string
+
+	// URL, if set, is dialed instead of the green listener, e.g.
+	// https://green.example.com:8444. It must route to Listen.
+	URL string
+
+	Timeout time.Duration
+}
+
+// Check serves cert on the green listener and handshakes with it using a
+// client that verifies the chain and server name
+func (p *Prober) Check(cert *tls.Certificate) error {
+	serverName := p.ServerName
+	if serverName == "" {
+		leaf, err := tlsstore.ParseLeaf(cert)
+		if err != nil {
+			return fmt.Errorf("probe: %w", err)
+		}
+		if len(leaf.DNSNames) == 0 {
+			return errors.New("probe: certificate has no DNS names; set a server name")
+		}
+		serverName = leaf.DNSNames[0]
+	}
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	listen := p.Listen
+	if listen == "" {
+		listen = "127.0.0.1:0"
+	}
+	ln, err := net.Listen("tcp", listen)
+	if err != nil {
+		return fmt.Errorf("probe: %w", err)
+	}
+	defer ln.Close()
+	go serve(ctx, ln, cert)
+
+	target := ln.Addr().String()
+	if p.URL != "" {
+		if target, err = urlAddress(p.URL); err != nil {
+			return err
+		}
+	}
+
+	dialer := &tls.Dialer{Config: &tls.Config{
+		RootCAs:    p.Roots,
+		ServerName: serverName,
+		MinVersion: tls.VersionTLS12,
+	}}
+	conn, err := dialer.DialContext(ctx, "tcp", target)
+	if err != nil {
+		return fmt.Errorf("probe: handshake with %s: %w", target, err)
+	}
+	conn.Close()
+	return nil
+}
+
+// serve completes handshakes with cert until ctx ends
+func serve(ctx context.Context, ln net.Listener, cert *tls.Certificate) {
+	config := &tls.Config{Certificates: []tls.Certificate{*cert}, MinVersion: tls.VersionTLS12}
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			tlsConn := tls.Server(conn, config)
+			tlsConn.HandshakeContext(ctx)
+		}()
+	}
+}
+
+// urlAddress returns the host:port dialed for rawURL
+func urlAddress(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("probe: %w", err)
+	}
+	if u.Hostname() == "" {
+		return "", fmt.Errorf("probe: no host in %q", rawURL)
+	}
+	port := u.Port()
+	if port == "" {
+		port = "443"
+	}
+	return net.JoinHostPort(u.Hostname(), port), nil
+}
@@ -0,0 +1,75 @@
+package probe
+
+import (
+	"crypto/x509"
+	"net"
+	"testing"
+
+	"tls-agent/pkg/agenttest"
+)
+
+// TestCheck tests that only certificates clients would accept pass
+func TestCheck(t *testing.T) {
+	ca := agenttest.NewCA(t)
+	roots, cert := ca.Pool, ca.IssueTLS(t, "www.example.com")
+	otherRoots := agenttest.NewCA(t).Pool
+
+	tests := []struct {
+		name   string
+		prober Prober
+		ok     bool
+	}{
+		{"trusted", Prober{Roots: roots}, true},
+		{"untrusted", Prober{Roots: otherRoots}, false},
+		{"wrong name", Prober{Roots: roots, ServerName: "api.example.com"}, false},
+		{"explicit name", Prober{Roots: roots, ServerName: "www.example.com"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.prober.Check(cert)
+			if tt.ok && err != nil {
+				t.Errorf("Expected the probe to pass, got %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Error("Expected the probe to fail")
+			}
+		})
+	}
+
+	unnamed := ca.Sign(t, &x509.Certificate{ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}, nil)
+	if err := (&Prober{Roots: roots}).Check(unnamed); err == nil {
+		t.Error("Expected an error for a certificate without DNS names")
+	}
+}
+
+// TestCheckURL tests probing through a URL that routes to the green listener
+func TestCheckURL(t *testing.T) {
+	ca := agenttest.NewCA(t)
+	roots, cert := ca.Pool, ca.IssueTLS(t, "green.example.com")
+
+	// Reserve a port for the green listener
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	p := &Prober{Roots: roots, Listen: addr, URL: "https://" + addr + "/healthz"}
+	if err := p.Check(cert); err != nil {
+		t.Errorf("Expected the probe through the URL to pass, got %v", err)
+	}
+}
+
+// TestURLAddress tests the default HTTPS port
+func TestURLAddress(t *testing.T) {
+	if addr, err := urlAddress("https://green.example.com/healthz"); err != nil || addr != "green.example.com:443" {
+		t.Errorf("Expected green.example.com:443, got %q (%v)", addr, err)
+	}
+	if addr, err := urlAddress("https://green.example.com:8444"); err != nil || addr != "green.example.com:8444" {
+		t.Errorf("Expected green.example.com:8444, got %q (%v)", addr, err)
+	}
+	if _, err := urlAddress("/healthz"); err == nil {
+		t.Error("Expected an error for a URL without a host")
+	}
+}
@@ -0,0 +1,133 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+)
+
+// Verify results reported to the backend
+const (
+	VerifySuccess    = "SUCCESS"
+	VerifyNone       = "NONE"
+	VerifyUnverified = "UNVERIFIED"
+)
+
+// IdentityHeaders names the headers used to forward the client identity. An
+// empty name disables that header.
+type IdentityHeaders struct {
+	Subject     string
+	SANs        string
+	Fingerprint string
+	Verify      string
+
+	// XFCC carries all fields in one Envoy-style X-Forwarded-Client-Cert value
+	XFCC string
+}
+
+// DefaultIdentityHeaders returns the conventional header names
+func DefaultIdentityHeaders() IdentityHeaders {
+	return IdentityHeaders{
+		Subject:     "X-Client-Subject",
+		SANs:        "X-Client-SANs",
+		Fingerprint: "X-Client-Fingerprint",
+		Verify:      "X-Client-Verify",
+		XFCC:        "X-Forwarded-Client-Cert",
+	}
+}
+
+func (h IdentityHeaders) names() []string {
+	var names []string
+	for _, name := range []string{h.Subject, h.SANs, h.Fingerprint, h.Verify, h.XFCC} {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Middleware strips any identity headers supplied by the client, so they
+// cannot be spoofed, and sets them from the TLS connection state.
+// verified reports whether the listener verifies client certificates during
+// the handshake; presented certificates are otherwise marked UNVERIFIED.
+func (h IdentityHeaders) Middleware(next http.Handler, verified bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, name := range h.names() {
+			r.Header.Del(name)
+		}
+		h.set(r.Header, r.TLS, verified)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (h IdentityHeaders) set(header http.Header, state *tls.ConnectionState, verified bool) {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		setIf(header, h.Verify, VerifyNone)
+		return
+	}
+
+	cert := state.PeerCertificates[0]
+	sum := sha256.Sum256(cert.Raw)
+	fingerprint := hex.EncodeToString(sum[:])
+
+	result := VerifyUnverified
+	if verified || len(state.VerifiedChains) > 0 {
+		result = VerifySuccess
+	}
+
+	var sans []string
+	sans = append(sans, cert.DNSNames...)
+	for _, u := range cert.URIs {
+		sans = append(sans, u.String())
+	}
+	sans = append(sans, cert.EmailAddresses...)
+
+	setIf(header, h.Subject, cert.Subject.String())
+	setIf(header, h.SANs, strings.Join(sans, ","))
+	setIf(header, h.Fingerprint, fingerprint)
+	setIf(header, h.Verify, result)
+
+	if h.XFCC != "" {
+		fields := []string{"Hash=" + fingerprint, fmt.Sprintf("Subject=%q", cert.Subject.String())}
+		for _, u := range cert.URIs {
+			fields = append(fields, "URI="+u.String())
+		}
+		for _, name := range cert.DNSNames {
+			fields = append(fields, "DNS="+name)
+		}
+		header.Set(h.XFCC, strings.Join(fields, ";"))
+	}
+}
+
+func setIf(header http.Header, name, value string) {
+	if name != "" {
+		header.Set(name, value)
+	}
+}
+
+// New returns a reverse proxy to upstream that forwards the client identity
+// using headers. transport dials the upstream; nil uses
+// http.DefaultTransport.
+func New(upstream string, headers IdentityHeaders, verified bool, transport http.RoundTripper) (http.Handler, error) {
+	target, err := url.Parse(upstream)
+	if err != nil {
+		return nil, err
+	}
+	if target.Scheme == "" || target.Host == "" {
+		return nil, fmt.Errorf("invalid upstream URL %q", upstream)
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.SetXForwarded()
+		},
+		Transport: transport,
+	}
+	return headers.Middleware(proxy, verified), nil
+}
@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// TestIdentityHeaders tests header stripping and population
+func TestIdentityHeaders(t *testing.T) {
+	headers := DefaultIdentityHeaders()
+
+	var got http.Header
+	handler := headers.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}), true)
+
+	spiffe, _ := url.Parse("spiffe://example.com/ns/web")
+	cert := &x509.Certificate{
+		Raw:      []byte("client certificate"),
+		Subject:  pkix.Name{CommonName: "client", Organization: []string{"Example"}},
+		DNSNames: []string{"client.example.com"},
+		URIs:     []*url.URL{spiffe},
+	}
+
+	// Spoofed values from the client are replaced
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Client-Subject", "CN=admin")
+	req.Header.Set("X-Forwarded-Client-Cert", "Hash=forged")
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got.Get("X-Client-Subject") != "CN=client,O=Example" {
+		t.Errorf("Unexpected subject: %q", got.Get("X-Client-Subject"))
+	}
+	if got.Get("X-Client-SANs") != "client.example.com,spiffe://example.com/ns/web" {
+		t.Errorf("Unexpected SANs: %q", got.Get("X-Client-SANs"))
+	}
+	if len(got.Get("X-Client-Fingerprint")) != 64 {
+		t.Errorf("Unexpected fingerprint: %q", got.Get("X-Client-Fingerprint"))
+	}
+	if got.Get("X-Client-Verify") != VerifySuccess {
+		t.Errorf("Expected verify SUCCESS, got %q", got.Get("X-Client-Verify"))
+	}
+	xfcc := got.Get("X-Forwarded-Client-Cert")
+	if strings.Contains(xfcc, "forged") || !strings.Contains(xfcc, "URI=spiffe://example.com/ns/web") {
+		t.Errorf("Unexpected XFCC: %q", xfcc)
+	}
+
+	// Without a client certificate only the verify result is sent
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Client-Subject", "CN=admin")
+	req.TLS = &tls.ConnectionState{}
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got.Get("X-Client-Subject") != "" {
+		t.Error("Spoofed subject should be stripped")
+	}
+	if got.Get("X-Client-Verify") != VerifyNone {
+		t.Errorf("Expected verify NONE, got %q", got.Get("X-Client-Verify"))
+	}
+}
+
+// TestProxy tests forwarding to the upstream
+func TestProxy(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-Client-Verify")))
+	}))
+	defer backend.Close()
+
+	handler, err := New(backend.URL, DefaultIdentityHeaders(), false, nil)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Raw: []byte("x")}}}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Body.String() != VerifyUnverified {
+		t.Errorf("Expected backend to see UNVERIFIED, got %q", rec.Body.String())
+	}
+
+	if _, err := New("not a url", DefaultIdentityHeaders(), false, nil); err == nil {
+		t.Error("Invalid upstream should be rejected")
+	}
+}
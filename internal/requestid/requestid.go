@@ -0,0 +1,147 @@
+// Package requestid assigns every request an ID and a W3C trace context
+// (traceparent) span, propagating both to the backend and into the request
+// context so logs from the terminator and downstream services line up.
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// DefaultHeader carries the request ID when no other is configured
+const DefaultHeader = "X-Request-ID"
+
+// maxIDLength bounds accepted incoming request IDs
+const maxIDLength = 128
+
+// Info identifies a request
+type Info struct {
+	// RequestID is the incoming or generated request ID
+	RequestID string
+
+	// TraceID is the W3C trace ID (32 hex digits) the request belongs to
+	TraceID string
+
+	// SpanID is the span (16 hex digits) this hop forwarded as the parent
+	SpanID string
+
+	// Sampled is the traceparent sampled flag
+	Sampled bool
+}
+
+type contextKey struct{}
+
+// FromContext returns the request's Info, if the middleware assigned one
+func FromContext(ctx context.Context) (Info, bool) {
+	info, ok := ctx.Value(contextKey{}).(Info)
+	return info, ok
+}
+
+// NewContext returns ctx carrying info
+func NewContext(ctx context.Context, info Info) context.Context {
+	return context.WithValue(ctx, contextKey{}, info)
+}
+
+// Middleware assigns request IDs and trace context
+type Middleware struct {
+	// Header carries the request ID (DefaultHeader when empty)
+	Header string
+
+	// TrustIncoming keeps well-formed request IDs and traceparents sent by
+	// clients instead of always starting new ones
+	TrustIncoming bool
+}
+
+// Wrap returns next with requests identified. The request ID is echoed in
+// the response, and the request forwarded with its ID and a traceparent
+// naming this hop as the parent span.
+func (m Middleware) Wrap(next http.Handler) http.Handler {
+	header := m.Header
+	if header == "" {
+		header = DefaultHeader
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var info Info
+		if m.TrustIncoming {
+			if id := r.Header.Get(header); validID(id) {
+				info.RequestID = id
+			}
+			info.TraceID, info.Sampled = parseTraceparent(r.Header.Get("Traceparent"))
+		}
+		if info.TraceID == "" {
+			info.TraceID = randomHex(16)
+			info.Sampled = true
+			r.Header.Del("Tracestate")
+		}
+		if info.RequestID == "" {
+			info.RequestID = info.TraceID
+		}
+		info.SpanID = randomHex(8)
+
+		flags := "00"
+		if info.Sampled {
+			flags = "01"
+		}
+		r.Header.Set(header, info.RequestID)
+		r.Header.Set("Traceparent", "00-"+info.TraceID+"-"+info.SpanID+"-"+flags)
+		w.Header().Set(header, info.RequestID)
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), info)))
+	})
+}
+
+// parseTraceparent returns the trace ID and sampled flag of a version 00
+// traceparent, or "" when value is malformed
+func parseTraceparent(value string) (string, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || parts[0] == "ff" || !isHex(parts[0], 2) {
+		return "", false
+	}
+	// Version 00 has exactly four fields; later versions may append more
+	if parts[0] == "00" && len(parts) != 4 {
+		return "", false
+	}
+	traceID, parentID, flags := parts[1], parts[2], parts[3]
+	if !isHex(traceID, 32) || !isHex(parentID, 16) || !isHex(flags, 2) {
+		return "", false
+	}
+	if traceID == strings.Repeat("0", 32) || parentID == strings.Repeat("0", 16) {
+		return "", false
+	}
+	b, _ := hex.DecodeString(flags)
+	return traceID, b[0]&1 == 1
+}
+
+// isHex reports whether s is n lowercase hex digits
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// validID reports whether an incoming request ID is safe to propagate and log
+func validID(id string) bool {
+	if id == "" || len(id) > maxIDLength {
+		return false
+	}
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,81 @@
+package requestid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// serve runs one request through m and returns what the handler saw
+func serve(m Middleware, header http.Header) (Info, *http.Request, *httptest.ResponseRecorder) {
+	var info Info
+	var seen *http.Request
+	h := m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info, _ = FromContext(r.Context())
+		seen = r
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return info, seen, rec
+}
+
+// TestPropagation tests continuing an incoming trace
+func TestPropagation(t *testing.T) {
+	incoming := http.Header{
+		"X-Request-Id": {"abc-123"},
+		"Traceparent":  {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		"Tracestate":   {"vendor=value"},
+	}
+	info, req, rec := serve(Middleware{TrustIncoming: true}, incoming)
+
+	if info.RequestID != "abc-123" || info.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || !info.Sampled {
+		t.Errorf("Unexpected info %+v", info)
+	}
+	want := "00-4bf92f3577b34da6a3ce929d0e0e4736-" + info.SpanID + "-01"
+	if got := req.Header.Get("Traceparent"); got != want || info.SpanID == "00f067aa0ba902b7" {
+		t.Errorf("Expected forwarded traceparent %s with a new span, got %s", want, got)
+	}
+	if req.Header.Get("Tracestate") != "vendor=value" {
+		t.Error("Expected tracestate to be kept for a continued trace")
+	}
+	if got := rec.Header().Get("X-Request-ID"); got != "abc-123" {
+		t.Errorf("Expected the request ID in the response, got %q", got)
+	}
+}
+
+// TestNewTrace tests starting a trace for untrusted or malformed input
+func TestNewTrace(t *testing.T) {
+	for name, tc := range map[string]struct {
+		m      Middleware
+		header http.Header
+	}{
+		"untrusted": {Middleware{}, http.Header{"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}, "X-Request-Id": {"abc"}}},
+		"malformed": {Middleware{TrustIncoming: true}, http.Header{"Traceparent": {"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01"}}},
+		"zero":      {Middleware{TrustIncoming: true}, http.Header{"Traceparent": {"00-00000000000000000000000000000000-00f067aa0ba902b7-01"}}},
+		"bad id":    {Middleware{TrustIncoming: true}, http.Header{"X-Request-Id": {"has space"}, "Tracestate": {"vendor=value"}}},
+	} {
+		info, req, _ := serve(tc.m, tc.header)
+		if len(info.TraceID) != 32 || info.TraceID == "4bf92f3577b34da6a3ce929d0e0e4736" || info.RequestID != info.TraceID {
+			t.Errorf("%s: expected a new trace and request ID, got %+v", name, info)
+		}
+		if !strings.HasPrefix(req.Header.Get("Traceparent"), "00-"+info.TraceID+"-") {
+			t.Errorf("%s: unexpected traceparent %s", name, req.Header.Get("Traceparent"))
+		}
+		if req.Header.Get("Tracestate") != "" {
+			t.Errorf("%s: expected tracestate to be dropped with a new trace", name)
+		}
+	}
+}
+
+// TestCustomHeader tests a configured request ID header
+func TestCustomHeader(t *testing.T) {
+	info, req, rec := serve(Middleware{Header: "X-Correlation-ID", TrustIncoming: true}, http.Header{"X-Correlation-Id": {"corr-1"}})
+	if info.RequestID != "corr-1" || req.Header.Get("X-Correlation-ID") != "corr-1" || rec.Header().Get("X-Correlation-ID") != "corr-1" {
+		t.Errorf("Expected corr-1 to be propagated, got %+v", info)
+	}
+}
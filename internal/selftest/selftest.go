@@ -0,0 +1,244 @@
+// Package selftest verifies that the agent can start: certificates parse and
+// match, chains verify, ports bind, files can be watched, and the clock is
+// plausible. Results are collected into a report rather than stopping at the
+// first failure.
+package selftest
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"tls-agent/internal/tlsstore"
+	"tls-agent/internal/watch"
+)
+
+// Check statuses
+const (
+	StatusPass = "pass"
+	StatusWarn = "warn"
+	StatusFail = "fail"
+)
+
+// minPlausibleTime is earlier than any certificate this agent will serve; a
+// clock before it has not been set (e.g. an embedded device after boot)
+var minPlausibleTime = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Result is the outcome of one check
+type Result struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Check is a named verification step
+type Check struct {
+	Name string
+	Run  func() Result
+}
+
+// Report collects the results of all checks in order
+type Report struct {
+	Results []Result `json:"results"`
+	Passed  bool     `json:"passed"`
+}
+
+// Run executes every check and reports whether none failed. Warnings do not
+// fail the report.
+func Run(checks []Check) *Report {
+	report := &Report{Passed: true}
+	for _, c := range checks {
+		res := c.Run()
+		res.Name = c.Name
+		if res.Status == StatusFail {
+			report.Passed = false
+		}
+		report.Results = append(report.Results, res)
+	}
+	return report
+}
+
+// Print writes the report as a table
+func (r *Report) Print(out io.Writer) {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CHECK\tSTATUS\tDETAIL")
+	for _, res := range r.Results {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", res.Name, res.Status, res.Detail)
+	}
+	w.Flush()
+	if r.Passed {
+		fmt.Fprintln(out, "Self-test passed")
+	} else {
+		fmt.Fprintln(out, "Self-test FAILED")
+	}
+}
+
+// PrintJSON writes the report as JSON
+func (r *Report) PrintJSON(out io.Writer) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+func pass(format string, args ...any) Result {
+	return Result{Status: StatusPass, Detail: fmt.Sprintf(format, args...)}
+}
+
+func warn(format string, args ...any) Result {
+	return Result{Status: StatusWarn, Detail: fmt.Sprintf(format, args...)}
+}
+
+func fail(err error) Result {
+	return Result{Status: StatusFail, Detail: err.Error()}
+}
+
+// Certificate returns checks for one certificate/key pair: that it loads
+// (load must verify that the key matches), that its chain verifies against
+// roots (system roots when nil), and that it is currently valid, allowing a
+// NotBefore up to grace in the future. The pair is loaded once and shared by
+// the checks.
+func Certificate(certFile, keyFile string, load func(certFile, keyFile string) (*tls.Certificate, error), roots *x509.CertPool, grace time.Duration) []Check {
+	var (
+		once sync.Once
+		cert *tls.Certificate
+		leaf *x509.Certificate
+		err  error
+	)
+	loaded := func() (*tls.Certificate, *x509.Certificate, error) {
+		once.Do(func() {
+			if cert, err = load(certFile, keyFile); err == nil {
+				leaf, err = leafOf(cert)
+			}
+		})
+		return cert, leaf, err
+	}
+
+	return []Check{
+		{Name: "certificate " + certFile, Run: func() Result {
+			_, leaf, err := loaded()
+			if err != nil {
+				return fail(err)
+			}
+			return pass("%s, key matches", leaf.Subject.CommonName)
+		}},
+		{Name: "chain " + certFile, Run: func() Result {
+			cert, leaf, err := loaded()
+			if err != nil {
+				return fail(fmt.Errorf("not loaded: %w", err))
+			}
+			return verifyChain(cert, leaf, roots)
+		}},
+		{Name: "validity " + certFile, Run: func() Result {
+			_, leaf, err := loaded()
+			if err != nil {
+				return fail(fmt.Errorf("not loaded: %w", err))
+			}
+			skew, err := tlsstore.CheckValidity(leaf, time.Now(), grace)
+			if err != nil {
+				return fail(err)
+			}
+			if skew > 0 {
+				return warn("valid in %s (clock skew within grace)", skew.Round(time.Second))
+			}
+			return pass("expires %s", leaf.NotAfter.Format(time.RFC3339))
+		}},
+	}
+}
+
+// verifyChain verifies leaf with the intermediates sent in cert. Self-signed
+// leaves are reported as a warning since they cannot chain.
+func verifyChain(cert *tls.Certificate, leaf *x509.Certificate, roots *x509.CertPool) Result {
+	if bytes.Equal(leaf.RawIssuer, leaf.RawSubject) &&
+		leaf.CheckSignature(leaf.SignatureAlgorithm, leaf.RawTBSCertificate, leaf.Signature) == nil {
+		return warn("self-signed certificate")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, der := range cert.Certificate[1:] {
+		c, err := x509.ParseCertificate(der)
+		if err != nil {
+			return fail(fmt.Errorf("parse intermediate: %w", err))
+		}
+		intermediates.AddCert(c)
+	}
+	chains, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	if err != nil {
+		return fail(err)
+	}
+	return pass("verified to %s", chains[0][len(chains[0])-1].Subject.CommonName)
+}
+
+// Port checks that addr can be bound
+func Port(addr string) Check {
+	return Check{Name: "port " + addr, Run: func() Result {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return fail(err)
+		}
+		ln.Close()
+		return pass("bindable")
+	}}
+}
+
+// Watchable checks that the directories of paths can be watched for changes
+func Watchable(paths ...string) Check {
+	return Check{Name: "watch", Run: func() Result {
+		w, err := watch.New(0)
+		if err != nil {
+			return fail(err)
+		}
+		// Run with a closed stop channel releases the watcher immediately
+		defer func() {
+			stop := make(chan struct{})
+			close(stop)
+			w.Run(stop)
+		}()
+		if err := w.Add("self-test", func() {}, paths...); err != nil {
+			return fail(err)
+		}
+		return pass("%d files", len(paths))
+	}}
+}
+
+// Clock checks that the system clock has been set
+func Clock() Check {
+	return Check{Name: "clock", Run: func() Result {
+		now := time.Now()
+		if now.Before(minPlausibleTime) {
+			return fail(fmt.Errorf("system time %s is before %s; the clock is not set", now.Format(time.RFC3339), minPlausibleTime.Format("2006-01-02")))
+		}
+		return pass("%s", now.UTC().Format(time.RFC3339))
+	}}
+}
+
+// Config reports the result of validating the configuration
+func Config(validate func() error) Check {
+	return Check{Name: "config", Run: func() Result {
+		if err := validate(); err != nil {
+			return fail(err)
+		}
+		return pass("valid")
+	}}
+}
+
+func leafOf(cert *tls.Certificate) (*x509.Certificate, error) {
+	if cert.Leaf != nil {
+		return cert.Leaf, nil
+	}
+	if len(cert.Certificate) == 0 {
+		return nil, errors.New("no certificate in chain")
+	}
+	return x509.ParseCertificate(cert.Certificate[0])
+}
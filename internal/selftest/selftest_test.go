@@ -0,0 +1,98 @@
+package selftest
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"tls-agent/pkg/agenttest"
+)
+
+// TestCertificateChecks tests that a pair is loaded once and its checks report independently
+func TestCertificateChecks(t *testing.T) {
+	loads := 0
+	notBefore := time.Now().Add(time.Hour)
+	cert := agenttest.SelfSigned(t, &x509.Certificate{NotBefore: notBefore, NotAfter: notBefore.Add(24 * time.Hour)}, nil)
+	load := func(string, string) (*tls.Certificate, error) {
+		loads++
+		return cert, nil
+	}
+
+	report := Run(Certificate("a.crt", "a.key", load, nil, time.Minute))
+	if loads != 1 {
+		t.Errorf("Expected the pair to be loaded once, got %d", loads)
+	}
+	if report.Passed {
+		t.Error("A certificate valid only beyond the grace window should fail the report")
+	}
+
+	want := map[string]string{
+		"certificate a.crt": StatusPass,
+		"chain a.crt":       StatusWarn,
+		"validity a.crt":    StatusFail,
+	}
+	for _, res := range report.Results {
+		if want[res.Name] != res.Status {
+			t.Errorf("%s: expected %s, got %s (%s)", res.Name, want[res.Name], res.Status, res.Detail)
+		}
+	}
+
+	// Within the grace window the skew is only a warning
+	report = Run(Certificate("a.crt", "a.key", load, nil, 2*time.Hour))
+	if !report.Passed || report.Results[2].Status != StatusWarn {
+		t.Errorf("Expected a skew warning within the grace window, got %+v", report.Results)
+	}
+}
+
+// TestCertificateLoadFailure tests that a load error fails every check of the pair
+func TestCertificateLoadFailure(t *testing.T) {
+	load := func(string, string) (*tls.Certificate, error) {
+		return nil, errors.New("private key does not match public key")
+	}
+	report := Run(Certificate("a.crt", "a.key", load, nil, 0))
+	for _, res := range report.Results {
+		if res.Status != StatusFail {
+			t.Errorf("%s: expected failure, got %s", res.Name, res.Status)
+		}
+	}
+}
+
+// TestPortAndWatchable tests the environment checks
+func TestPortAndWatchable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	report := Run([]Check{
+		Port(ln.Addr().String()),
+		Port("127.0.0.1:0"),
+		Watchable(filepath.Join(t.TempDir(), "server.crt")),
+		Watchable(filepath.Join(t.TempDir(), "missing", "server.crt")),
+		Clock(),
+	})
+	statuses := []string{StatusFail, StatusPass, StatusPass, StatusFail, StatusPass}
+	for i, res := range report.Results {
+		if res.Status != statuses[i] {
+			t.Errorf("%s: expected %s, got %s (%s)", res.Name, statuses[i], res.Status, res.Detail)
+		}
+	}
+}
+
+// TestReportPrint tests the table output
+func TestReportPrint(t *testing.T) {
+	report := Run([]Check{Config(func() error { return errors.New("bad setting") })})
+
+	var buf bytes.Buffer
+	report.Print(&buf)
+	if !strings.Contains(buf.String(), "bad setting") || !strings.Contains(buf.String(), "FAILED") {
+		t.Errorf("Unexpected report output:\n%s", buf.String())
+	}
+}
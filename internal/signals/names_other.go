@@ -0,0 +1,16 @@
+//go:build !unix
+
+package signals
+
+import (
+	"os"
+	"syscall"
+)
+
+// byName lists the signals that can be bound on this platform. There is no
+// SIGUSR1 or SIGUSR2, so those actions have no default binding.
+var byName = map[string]os.Signal{
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGINT":  syscall.SIGINT,
+	"SIGTERM": syscall.SIGTERM,
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package signals
+
+import (
+	"os"
+	"syscall"
+)
+
+// byName lists the signals that can be bound on this platform
+var byName = map[string]os.Signal{
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGINT":  syscall.SIGINT,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGTERM": syscall.SIGTERM,
+	"SIGUSR1": syscall.SIGUSR1,
+	"SIGUSR2": syscall.SIGUSR2,
+}
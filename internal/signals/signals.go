@@ -0,0 +1,146 @@
+// Package signals maps OS signals to named actions and dispatches them to
+// the subsystems subscribed to each action.
+package signals
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Actions a signal can be bound to
+const (
+	ActionShutdown     = "shutdown"
+	ActionReloadConfig = "reload_config"
+	ActionReloadCerts  = "reload_certs"
+	ActionRotateLogs   = "rotate_logs"
+)
+
+// DefaultBindings returns the conventional signals for each action, leaving
+// out those this platform does not have
+func DefaultBindings() map[string][]string {
+	defaults := map[string][]string{
+		ActionShutdown:     {"SIGTERM", "SIGINT"},
+		ActionReloadConfig: {"SIGHUP"},
+		ActionReloadCerts:  {"SIGUSR1"},
+		ActionRotateLogs:   {"SIGUSR2"},
+	}
+	for action, names := range defaults {
+		var available []string
+		for _, name := range names {
+			if _, ok := byName[name]; ok {
+				available = append(available, name)
+			}
+		}
+		defaults[action] = available
+	}
+	return defaults
+}
+
+// Registry routes received signals to the handlers of their action
+type Registry struct {
+	bindings map[os.Signal]string
+
+	mu       sync.RWMutex
+	handlers map[string][]func()
+}
+
+// New creates a registry from action -> signal name bindings. Names may omit
+// the SIG prefix and are case-insensitive. A signal bound to two actions or
+// unknown to this platform is an error.
+func New(bindings map[string][]string) (*Registry, error) {
+	r := &Registry{
+		bindings: make(map[os.Signal]string),
+		handlers: make(map[string][]func()),
+	}
+
+	// Iterate in a fixed order so conflicts are reported deterministically
+	actions := make([]string, 0, len(bindings))
+	for action := range bindings {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+
+	for _, action := range actions {
+		for _, name := range bindings[action] {
+			sig, err := Parse(name)
+			if err != nil {
+				return nil, fmt.Errorf("signal binding for %s: %w", action, err)
+			}
+			if other, ok := r.bindings[sig]; ok {
+				return nil, fmt.Errorf("signal %s is bound to both %s and %s", name, other, action)
+			}
+			r.bindings[sig] = action
+		}
+	}
+	return r, nil
+}
+
+// Parse returns the signal with the given name, such as "SIGHUP" or "hup"
+func Parse(name string) (os.Signal, error) {
+	key := strings.ToUpper(strings.TrimSpace(name))
+	if !strings.HasPrefix(key, "SIG") {
+		key = "SIG" + key
+	}
+	sig, ok := byName[key]
+	if !ok {
+		return nil, fmt.Errorf("unknown signal %q", name)
+	}
+	return sig, nil
+}
+
+// Subscribe calls handler whenever a signal bound to action is received.
+// Handlers run one at a time on the registry goroutine.
+func (r *Registry) Subscribe(action string, handler func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[action] = append(r.handlers[action], handler)
+}
+
+// Dispatch runs the handlers subscribed to action
+func (r *Registry) Dispatch(action string) {
+	r.mu.RLock()
+	handlers := r.handlers[action]
+	r.mu.RUnlock()
+
+	if len(handlers) == 0 {
+		log.Printf("Signals: no handler for %s", action)
+		return
+	}
+	for _, h := range handlers {
+		h()
+	}
+}
+
+// Run receives the bound signals until ctx is cancelled, after which their
+// default behavior is restored
+func (r *Registry) Run(ctx context.Context) error {
+	if len(r.bindings) == 0 {
+		<-ctx.Done()
+		return nil
+	}
+
+	sigs := make([]os.Signal, 0, len(r.bindings))
+	for sig := range r.bindings {
+		sigs = append(sigs, sig)
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+	defer signal.Stop(ch)
+
+	for {
+		select {
+		case sig := <-ch:
+			action := r.bindings[sig]
+			log.Printf("Received signal: %v (%s)", sig, action)
+			r.Dispatch(action)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
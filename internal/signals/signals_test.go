@@ -0,0 +1,84 @@
+//go:build unix
+
+package signals
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestParse tests signal name normalization
+func TestParse(t *testing.T) {
+	for _, name := range []string{"SIGHUP", "hup", " Sighup "} {
+		sig, err := Parse(name)
+		if err != nil || sig != syscall.SIGHUP {
+			t.Errorf("Parse(%q) = %v, %v", name, sig, err)
+		}
+	}
+	if _, err := Parse("SIGNOPE"); err == nil {
+		t.Error("Expected error for unknown signal")
+	}
+}
+
+// TestNewRejectsConflicts tests that a signal cannot serve two actions
+func TestNewRejectsConflicts(t *testing.T) {
+	_, err := New(map[string][]string{
+		ActionShutdown:    {"SIGTERM"},
+		ActionReloadCerts: {"TERM"},
+	})
+	if err == nil {
+		t.Error("Expected error for a signal bound twice")
+	}
+	if _, err := New(DefaultBindings()); err != nil {
+		t.Errorf("Default bindings should be valid: %v", err)
+	}
+}
+
+// TestRunDispatches tests that a received signal reaches the subscribers of its action
+func TestRunDispatches(t *testing.T) {
+	r, err := New(map[string][]string{ActionReloadCerts: {"SIGUSR1"}})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	got := make(chan struct{}, 1)
+	r.Subscribe(ActionReloadCerts, func() {
+		select {
+		case got <- struct{}{}:
+		default:
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// Keep the default action (exit) away until Run has installed its handler
+	guard := make(chan os.Signal, 1)
+	signal.Notify(guard, syscall.SIGUSR1)
+	defer signal.Stop(guard)
+
+	deadline := time.After(2 * time.Second)
+	for {
+		if err := syscall.Kill(syscall.Getpid(), syscall.SIGUSR1); err != nil {
+			t.Fatalf("Failed to send signal: %v", err)
+		}
+		select {
+		case <-got:
+			return
+		case <-time.After(50 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("Handler was not called")
+		}
+	}
+}
@@ -0,0 +1,482 @@
+package stapling
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"tls-agent/internal/clock"
+	"tls-agent/internal/fetchcache"
+	"tls-agent/internal/metrics"
+	"tls-agent/internal/storage"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// Must-Staple enforcement modes
+const (
+	MustStapleEnforce = "enforce"
+	MustStapleWarn    = "warn"
+)
+
+// oidTLSFeature is the TLS Feature extension (RFC 7633)
+var oidTLSFeature = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}
+
+// statusRequest is the TLS feature value for OCSP stapling
+const statusRequest = 5
+
+var (
+	stapleAge = metrics.NewGauge("tls_agent_ocsp_staple_age_seconds",
+		"Age of the most recently fetched OCSP staple")
+	fetchFailures = metrics.NewCounter("tls_agent_ocsp_fetch_failures_total",
+		"Failed OCSP responder fetches")
+	mustStapleRefusals = metrics.NewCounter("tls_agent_must_staple_refusals_total",
+		"Handshakes refused because a Must-Staple certificate had no fresh staple")
+)
+
+// ErrNoFreshStaple is returned when a Must-Staple certificate cannot be served
+var ErrNoFreshStaple = errors.New("must-staple certificate has no fresh OCSP staple")
+
+// MustStaple reports whether leaf carries the TLS Feature status_request extension
+func MustStaple(leaf *x509.Certificate) bool {
+	for _, ext := range leaf.Extensions {
+		if !ext.Id.Equal(oidTLSFeature) {
+			continue
+		}
+		var features []int
+		if _, err := asn1.Unmarshal(ext.Value, &features); err != nil {
+			return false
+		}
+		for _, f := range features {
+			if f == statusRequest {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Response is a fetched and validated OCSP response
+type Response struct {
+	Raw        []byte
+	Status     int
+	ThisUpdate time.Time
+	NextUpdate time.Time
+}
+
+// Fresh reports whether the response is still within its validity window
+func (r *Response) Fresh(now time.Time) bool {
+	return r != nil && r.Status == ocsp.Good && now.Before(r.NextUpdate)
+}
+
+// refreshAt is halfway through the validity window, the usual stapling schedule
+func (r *Response) refreshAt() time.Time {
+	return r.ThisUpdate.Add(r.NextUpdate.Sub(r.ThisUpdate) / 2)
+}
+
+// Fetch queries the leaf's OCSP responder and validates the response against issuer
+func Fetch(ctx context.Context, client *http.Client, leaf, issuer *x509.Certificate) (*Response, error) {
+	raw, err := fetchRaw(ctx, client, leaf, issuer)
+	if err != nil {
+		return nil, err
+	}
+	return parseResponse(raw, leaf, issuer)
+}
+
+// fetchRaw posts an OCSP request to each of the leaf's responders in turn
+func fetchRaw(ctx context.Context, client *http.Client, leaf, issuer *x509.Certificate) ([]byte, error) {
+	if len(leaf.OCSPServer) == 0 {
+		return nil, errors.New("certificate has no OCSP responder URL")
+	}
+
+	reqDER, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for _, server := range leaf.OCSPServer {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, server, bytes.NewReader(reqDER))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		req.Header.Set("Content-Type", "application/ocsp-request")
+
+		raw, err := fetchcache.Do(client, req, 1<<20)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return raw, nil
+	}
+	return nil, lastErr
+}
+
+func parseResponse(raw []byte, leaf, issuer *x509.Certificate) (*Response, error) {
+	parsed, err := ocsp.ParseResponseForCert(raw, leaf, issuer)
+	if err != nil {
+		return nil, err
+	}
+	return &Response{
+		Raw:        raw,
+		Status:     parsed.Status,
+		ThisUpdate: parsed.ThisUpdate,
+		NextUpdate: parsed.NextUpdate,
+	}, nil
+}
+
+// entry tracks stapling state for one loaded certificate
+type entry struct {
+	base       *tls.Certificate
+	leaf       *x509.Certificate
+	issuer     *x509.Certificate
+	mustStaple bool
+
+	mu       sync.Mutex
+	response *Response
+	stapled  *tls.Certificate
+	lastUsed time.Time
+
+	// retired is when a reload replaced this certificate; zero while current
+	retired time.Time
+
+	// warned is set once serving without a fresh staple has been logged
+	warned bool
+}
+
+// retiredIdle is how long a replaced certificate is kept after it was last
+// served, covering handshakes that began before the swap and reloads that
+// were refused after the replacement was loaded
+const retiredIdle = time.Hour
+
+// Manager fetches OCSP staples, refreshes them on schedule, and enforces
+// Must-Staple when serving certificates
+type Manager struct {
+	client *http.Client
+	cache  *fetchcache.Cache
+	mode   string
+	clock  clock.Clock
+
+	// OnRefresh, if set, is called with the outcome of every staple fetch
+	OnRefresh func(err error)
+
+	mu      sync.Mutex
+	entries map[*tls.Certificate]*entry
+
+	// loaded is the certificate last loaded through Wrap for each cert
+	// and key file pair
+	loaded map[[2]string]*tls.Certificate
+}
+
+// NewManager creates a stapling manager; mode is MustStapleEnforce or
+// MustStapleWarn. Responses are persisted in cacheDir (empty disables) so a
+// restart reuses still-valid staples instead of hitting the responder.
+func NewManager(mode, cacheDir string) *Manager {
+	cache := fetchcache.New(cacheDir)
+	cache.Timeout = 15 * time.Second
+	return &Manager{
+		client:  &http.Client{Timeout: 10 * time.Second},
+		cache:   cache,
+		mode:    mode,
+		clock:   clock.Real{},
+		entries: make(map[*tls.Certificate]*entry),
+		loaded:  make(map[[2]string]*tls.Certificate),
+	}
+}
+
+// SetStorage persists responses in s instead of the cache directory. It must
+// be called before the first certificate is prepared.
+func (m *Manager) SetStorage(s storage.Storage) {
+	m.cache.Storage = s
+}
+
+// SetClock judges staple freshness and schedules refreshes by c instead of
+// the wall clock. It must be called before the first certificate is
+// prepared.
+func (m *Manager) SetClock(c clock.Clock) {
+	m.clock = c
+	m.cache.Clock = c
+}
+
+// Prepare registers cert and fetches its first staple synchronously. For a
+// Must-Staple certificate in enforce mode a failed fetch is an error, so a
+// reload is refused rather than swapping in a certificate clients will reject.
+func (m *Manager) Prepare(cert *tls.Certificate) error {
+	if len(cert.Certificate) < 2 {
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err == nil && MustStaple(leaf) && m.mode == MustStapleEnforce {
+			return fmt.Errorf("%w: chain has no issuer to build an OCSP request", ErrNoFreshStaple)
+		}
+		return nil
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return err
+	}
+	issuer, err := x509.ParseCertificate(cert.Certificate[1])
+	if err != nil {
+		return err
+	}
+
+	e := &entry{base: cert, leaf: leaf, issuer: issuer, mustStaple: MustStaple(leaf), lastUsed: m.clock.Now()}
+	m.mu.Lock()
+	m.entries[cert] = e
+	m.mu.Unlock()
+
+	err = m.refresh(e, false)
+	if err != nil && e.mustStaple {
+		if m.mode == MustStapleEnforce {
+			return fmt.Errorf("%w: %v", ErrNoFreshStaple, err)
+		}
+		log.Printf("Warning: Must-Staple certificate %q has no staple: %v", leaf.Subject.CommonName, err)
+	}
+	return nil
+}
+
+// Wrap returns a loader that prepares staples for every loaded certificate.
+// A certificate loaded again from the same files retires the previous one,
+// which is forgotten once it is no longer served.
+func (m *Manager) Wrap(load func(certFile, keyFile string) (*tls.Certificate, error)) func(certFile, keyFile string) (*tls.Certificate, error) {
+	return func(certFile, keyFile string) (*tls.Certificate, error) {
+		cert, err := load(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		if err := m.Prepare(cert); err != nil {
+			return nil, err
+		}
+		m.replace([2]string{certFile, keyFile}, cert)
+		return cert, nil
+	}
+}
+
+// replace records cert as the one loaded from files and retires the
+// certificate it replaces
+func (m *Manager) replace(files [2]string, cert *tls.Certificate) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old := m.loaded[files]
+	m.loaded[files] = cert
+	if old == nil || old == cert {
+		return
+	}
+	if e := m.entries[old]; e != nil {
+		e.mu.Lock()
+		e.retired = m.clock.Now()
+		e.mu.Unlock()
+	}
+}
+
+// refresh updates e's staple. Unless force is set a cached response that
+// is still within its refresh window is reused.
+func (m *Manager) refresh(e *entry, force bool) error {
+	err := m.fetch(e, force)
+	if m.OnRefresh != nil {
+		m.OnRefresh(err)
+	}
+	return err
+}
+
+func (m *Manager) fetch(e *entry, force bool) error {
+	sum := sha256.Sum256(e.issuer.RawSubjectPublicKeyInfo)
+	key := "ocsp:" + hex.EncodeToString(sum[:]) + ":" + e.leaf.SerialNumber.Text(16)
+
+	fetch := func(ctx context.Context) ([]byte, error) {
+		return fetchRaw(ctx, m.client, e.leaf, e.issuer)
+	}
+	decode := func(raw []byte) (any, fetchcache.Validity, error) {
+		resp, err := parseResponse(raw, e.leaf, e.issuer)
+		if err != nil {
+			return nil, fetchcache.Validity{}, err
+		}
+		if resp.Status != ocsp.Good {
+			return nil, fetchcache.Validity{}, fmt.Errorf("OCSP status is not good (%d)", resp.Status)
+		}
+		return resp, fetchcache.Validity{RefreshAt: resp.refreshAt(), ExpiresAt: resp.NextUpdate}, nil
+	}
+
+	var item *fetchcache.Item
+	var err error
+	if force {
+		item, err = m.cache.Refresh(key, fetch, decode)
+	} else {
+		item, err = m.cache.Get(key, fetch, decode)
+	}
+	if err != nil {
+		fetchFailures.Inc()
+		return err
+	}
+	resp := item.Value.(*Response)
+
+	stapled := *e.base
+	stapled.OCSPStaple = resp.Raw
+
+	e.mu.Lock()
+	e.response = resp
+	e.stapled = &stapled
+	e.warned = false
+	e.mu.Unlock()
+
+	stapleAge.Set(m.clock.Now().Sub(resp.ThisUpdate).Seconds())
+	return nil
+}
+
+// GetCertificate wraps next so served certificates carry the latest staple
+// and Must-Staple certificates without a fresh staple are refused (enforce)
+// or served with a warning (warn)
+func (m *Manager) GetCertificate(next func(*tls.ClientHelloInfo) (*tls.Certificate, error)) func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		cert, err := next(hello)
+		if err != nil || cert == nil {
+			return cert, err
+		}
+
+		m.mu.Lock()
+		e := m.entries[cert]
+		m.mu.Unlock()
+		if e == nil {
+			return cert, nil
+		}
+
+		now := m.clock.Now()
+		e.mu.Lock()
+		e.lastUsed = now
+		resp, stapled := e.response, e.stapled
+		fresh := resp.Fresh(now)
+		// Warn once per lapse rather than on every handshake
+		warn := !fresh && e.mustStaple && m.mode != MustStapleEnforce && !e.warned
+		if warn {
+			e.warned = true
+		}
+		e.mu.Unlock()
+
+		if fresh {
+			return stapled, nil
+		}
+		if e.mustStaple && m.mode == MustStapleEnforce {
+			mustStapleRefusals.Inc()
+			return nil, ErrNoFreshStaple
+		}
+		if warn {
+			log.Printf("Warning: serving Must-Staple certificate %q without a fresh staple", e.leaf.Subject.CommonName)
+		}
+		return cert, nil
+	}
+}
+
+// Status describes stapling state for health reporting
+type Status struct {
+	Subject    string    `json:"subject"`
+	MustStaple bool      `json:"must_staple"`
+	Fresh      bool      `json:"fresh"`
+	NextUpdate time.Time `json:"next_update,omitempty"`
+
+	// Response is the certificate status in the last response: "good",
+	// "revoked" or "unknown"; empty when none has been fetched
+	Response string `json:"response,omitempty"`
+}
+
+// Statuses returns stapling state for every tracked certificate
+func (m *Manager) Statuses() []Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.clock.Now()
+	out := make([]Status, 0, len(m.entries))
+	for _, e := range m.entries {
+		out = append(out, e.status(now))
+	}
+	return out
+}
+
+// StatusOf returns the stapling state of cert, a certificate returned by a
+// loader from Wrap. It reports false when cert is not tracked, e.g. because
+// its chain has no issuer.
+func (m *Manager) StatusOf(cert *tls.Certificate) (Status, bool) {
+	m.mu.Lock()
+	e, ok := m.entries[cert]
+	m.mu.Unlock()
+	if !ok {
+		return Status{}, false
+	}
+	return e.status(m.clock.Now()), true
+}
+
+func (e *entry) status(now time.Time) Status {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	s := Status{Subject: e.leaf.Subject.CommonName, MustStaple: e.mustStaple, Fresh: e.response.Fresh(now)}
+	if e.response != nil {
+		s.NextUpdate = e.response.NextUpdate
+		s.Response = responseStatus(e.response.Status)
+	}
+	return s
+}
+
+// responseStatus names an OCSP certificate status
+func responseStatus(status int) string {
+	switch status {
+	case ocsp.Good:
+		return "good"
+	case ocsp.Revoked:
+		return "revoked"
+	}
+	return "unknown"
+}
+
+// Run refreshes staples on their schedule until stopChan is closed. Must-Staple
+// certificates are retried every checkInterval once past their refresh point,
+// so a transient responder outage is bridged before the old staple expires.
+func (m *Manager) Run(checkInterval time.Duration, stopChan <-chan struct{}) {
+	ticker := m.clock.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			m.refreshDue(m.clock.Now())
+		case <-stopChan:
+			return
+		}
+	}
+}
+
+func (m *Manager) refreshDue(now time.Time) {
+	m.mu.Lock()
+	due := make([]*entry, 0, len(m.entries))
+	for key, e := range m.entries {
+		e.mu.Lock()
+		idle := now.Sub(e.lastUsed) > 24*time.Hour
+		replaced := !e.retired.IsZero() && now.Sub(e.lastUsed) > retiredIdle
+		needs := e.response == nil || now.After(e.response.refreshAt())
+		e.mu.Unlock()
+
+		// Certificates that stopped being served are forgotten
+		if replaced || idle && now.After(e.leaf.NotAfter) {
+			delete(m.entries, key)
+			continue
+		}
+		if needs {
+			due = append(due, e)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, e := range due {
+		if err := m.refresh(e, true); err != nil {
+			log.Printf("OCSP: refresh for %q failed: %v", e.leaf.Subject.CommonName, err)
+		}
+	}
+}
@@ -0,0 +1,327 @@
+package stapling
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tls-agent/internal/clock"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// testIssuer creates a CA certificate and key
+func testIssuer(t *testing.T) (*x509.Certificate, crypto.Signer) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate CA key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatalf("Failed to create CA: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return cert, key
+}
+
+// testLeaf issues a leaf pointing at responder, optionally with Must-Staple
+func testLeaf(t *testing.T, issuer *x509.Certificate, issuerKey crypto.Signer, responder string, mustStaple bool) *tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate leaf key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		DNSNames:     []string{"example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		OCSPServer:   []string{responder},
+	}
+	if mustStaple {
+		value, _ := asn1.Marshal([]int{statusRequest})
+		tmpl.ExtraExtensions = []pkix.Extension{{Id: oidTLSFeature, Value: value}}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, issuer, key.Public(), issuerKey)
+	if err != nil {
+		t.Fatalf("Failed to issue certificate: %v", err)
+	}
+	return &tls.Certificate{Certificate: [][]byte{der, issuer.Raw}, PrivateKey: key}
+}
+
+// testResponder serves good OCSP responses until failing is set
+func testResponder(t *testing.T, issuer *x509.Certificate, issuerKey crypto.Signer, failing *atomic.Bool) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		req, err := ocsp.ParseRequest(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp, err := ocsp.CreateResponse(issuer, issuer, ocsp.Response{
+			Status:       ocsp.Good,
+			SerialNumber: req.SerialNumber,
+			ThisUpdate:   time.Now().Add(-time.Minute),
+			NextUpdate:   time.Now().Add(time.Hour),
+		}, issuerKey)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/ocsp-response")
+		w.Write(resp)
+	}))
+}
+
+// TestMustStaple tests detection of the TLS Feature extension
+func TestMustStaple(t *testing.T) {
+	issuer, key := testIssuer(t)
+
+	for _, want := range []bool{true, false} {
+		cert := testLeaf(t, issuer, key, "http://ocsp.invalid", want)
+		leaf, _ := x509.ParseCertificate(cert.Certificate[0])
+		if got := MustStaple(leaf); got != want {
+			t.Errorf("MustStaple = %v, want %v", got, want)
+		}
+	}
+}
+
+// TestStapledCertificate tests that served certificates carry the fetched staple
+func TestStapledCertificate(t *testing.T) {
+	issuer, key := testIssuer(t)
+	var failing atomic.Bool
+	responder := testResponder(t, issuer, key, &failing)
+	defer responder.Close()
+
+	cert := testLeaf(t, issuer, key, responder.URL, true)
+	m := NewManager(MustStapleEnforce, "")
+	if err := m.Prepare(cert); err != nil {
+		t.Fatalf("Prepare failed: %v", err)
+	}
+
+	get := m.GetCertificate(func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return cert, nil })
+	served, err := get(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatalf("GetCertificate failed: %v", err)
+	}
+	if len(served.OCSPStaple) == 0 {
+		t.Error("Expected served certificate to carry an OCSP staple")
+	}
+	if len(cert.OCSPStaple) != 0 {
+		t.Error("Loaded certificate should not be mutated")
+	}
+
+	statuses := m.Statuses()
+	if len(statuses) != 1 || !statuses[0].MustStaple || !statuses[0].Fresh {
+		t.Errorf("Unexpected statuses: %+v", statuses)
+	}
+	if status, ok := m.StatusOf(cert); !ok || status.Response != "good" {
+		t.Errorf("Expected a good response for the certificate, got %+v", status)
+	}
+	if _, ok := m.StatusOf(served); ok {
+		t.Error("Expected an untracked certificate to have no status")
+	}
+}
+
+// TestMustStapleEnforcement tests refusal and warning when no staple is available
+func TestMustStapleEnforcement(t *testing.T) {
+	issuer, key := testIssuer(t)
+	var failing atomic.Bool
+	failing.Store(true)
+	responder := testResponder(t, issuer, key, &failing)
+	defer responder.Close()
+
+	load := func(string, string) (*tls.Certificate, error) {
+		return testLeaf(t, issuer, key, responder.URL, true), nil
+	}
+
+	// Enforce: the reload is refused
+	if _, err := NewManager(MustStapleEnforce, "").Wrap(load)("", ""); !errors.Is(err, ErrNoFreshStaple) {
+		t.Errorf("Expected ErrNoFreshStaple, got %v", err)
+	}
+
+	// Warn: the certificate is served without a staple
+	m := NewManager(MustStapleWarn, "")
+	cert, err := m.Wrap(load)("", "")
+	if err != nil {
+		t.Fatalf("Warn mode should accept the certificate: %v", err)
+	}
+	get := m.GetCertificate(func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return cert, nil })
+	for range 3 {
+		if _, err := get(&tls.ClientHelloInfo{}); err != nil {
+			t.Errorf("Warn mode should serve the certificate: %v", err)
+		}
+	}
+	if !m.entries[cert].warned {
+		t.Error("Expected the missing staple to have been warned about")
+	}
+
+	// Non Must-Staple certificates are never refused
+	plain := testLeaf(t, issuer, key, responder.URL, false)
+	if err := NewManager(MustStapleEnforce, "").Prepare(plain); err != nil {
+		t.Errorf("Plain certificate should be accepted: %v", err)
+	}
+}
+
+// TestStapleExpiry tests that an expired staple stops a Must-Staple cert from being served
+func TestStapleExpiry(t *testing.T) {
+	issuer, key := testIssuer(t)
+	var failing atomic.Bool
+	responder := testResponder(t, issuer, key, &failing)
+	defer responder.Close()
+
+	cert := testLeaf(t, issuer, key, responder.URL, true)
+	m := NewManager(MustStapleEnforce, "")
+	if err := m.Prepare(cert); err != nil {
+		t.Fatalf("Prepare failed: %v", err)
+	}
+
+	// Age the staple past NextUpdate and make the responder unavailable
+	e := m.entries[cert]
+	e.response.NextUpdate = time.Now().Add(-time.Second)
+	failing.Store(true)
+	m.refreshDue(time.Now())
+
+	get := m.GetCertificate(func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return cert, nil })
+	if _, err := get(&tls.ClientHelloInfo{}); !errors.Is(err, ErrNoFreshStaple) {
+		t.Errorf("Expected ErrNoFreshStaple after staple expiry, got %v", err)
+	}
+
+	// Once the responder recovers the next refresh restores service
+	failing.Store(false)
+	m.refreshDue(time.Now())
+	if _, err := get(&tls.ClientHelloInfo{}); err != nil {
+		t.Errorf("Expected certificate to be served after refresh: %v", err)
+	}
+}
+
+// TestStapleRefreshClock tests that freshness and the refresh schedule
+// follow the manager's clock
+func TestStapleRefreshClock(t *testing.T) {
+	issuer, key := testIssuer(t)
+	var failing atomic.Bool
+	responder := testResponder(t, issuer, key, &failing)
+	defer responder.Close()
+
+	fake := clock.NewFake(time.Now())
+	m := NewManager(MustStapleEnforce, "")
+	m.SetClock(fake)
+	refreshed := make(chan error, 4)
+	m.OnRefresh = func(err error) { refreshed <- err }
+
+	cert := testLeaf(t, issuer, key, responder.URL, true)
+	if err := m.Prepare(cert); err != nil {
+		t.Fatalf("Prepare failed: %v", err)
+	}
+	<-refreshed
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go m.Run(time.Minute, stop)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := fake.BlockUntil(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Halfway through the staple's validity the next check refreshes it
+	fake.Advance(31 * time.Minute)
+	select {
+	case err := <-refreshed:
+		if err != nil {
+			t.Errorf("Refresh failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a refresh past the refresh point")
+	}
+
+	// Past NextUpdate on the manager's clock the staple is no longer fresh
+	failing.Store(true)
+	fake.Advance(2 * time.Hour)
+	get := m.GetCertificate(func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return cert, nil })
+	if _, err := get(&tls.ClientHelloInfo{}); !errors.Is(err, ErrNoFreshStaple) {
+		t.Errorf("Expected ErrNoFreshStaple once the clock passes NextUpdate, got %v", err)
+	}
+}
+
+// TestReplacedCertificateForgotten tests that a certificate replaced by a
+// reload stops being tracked once it is no longer served
+func TestReplacedCertificateForgotten(t *testing.T) {
+	issuer, key := testIssuer(t)
+	var failing atomic.Bool
+	responder := testResponder(t, issuer, key, &failing)
+	defer responder.Close()
+
+	fake := clock.NewFake(time.Now())
+	m := NewManager(MustStapleEnforce, "")
+	m.SetClock(fake)
+	load := m.Wrap(func(string, string) (*tls.Certificate, error) {
+		return testLeaf(t, issuer, key, responder.URL, false), nil
+	})
+
+	old, err := load("server.crt", "server.key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := load("other.crt", "other.key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := load("server.crt", "server.key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A handshake that began before the swap keeps the old one for a while
+	get := m.GetCertificate(func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return old, nil })
+	get(&tls.ClientHelloInfo{})
+	fake.Advance(retiredIdle / 2)
+	m.refreshDue(fake.Now())
+	if _, ok := m.StatusOf(old); !ok {
+		t.Fatal("Expected the replaced certificate to be kept while recently served")
+	}
+
+	fake.Advance(retiredIdle)
+	m.refreshDue(fake.Now())
+	if _, ok := m.StatusOf(old); ok {
+		t.Error("Expected the replaced certificate to be forgotten")
+	}
+	for _, cert := range []*tls.Certificate{other, current} {
+		if _, ok := m.StatusOf(cert); !ok {
+			t.Error("Expected current certificates to stay tracked")
+		}
+	}
+}
@@ -0,0 +1,169 @@
+// Package statsd pushes the agent's metrics to a statsd or DogStatsD
+// daemon over UDP, for deployments that do not scrape Prometheus. Counters
+// are sent as the increase since the previous flush and gauges as their
+// current value.
+package statsd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"tls-agent/internal/metrics"
+)
+
+// Wire formats
+const (
+	// FormatStatsd folds label values into the metric name
+	FormatStatsd = "statsd"
+
+	// FormatDogStatsD sends labels and Tags as DogStatsD tags
+	FormatDogStatsD = "dogstatsd"
+)
+
+// maxPacket keeps datagrams within a typical MTU
+const maxPacket = 1432
+
+// Exporter periodically sends a metrics registry to a statsd daemon
+type Exporter struct {
+	// Address is the daemon's host:port
+	Address string
+
+	// Format is FormatStatsd (default) or FormatDogStatsD
+	Format string
+
+	// Prefix is prepended to every metric name, e.g. "tls_agent."
+	Prefix string
+
+	// Tags are added to every metric as "key:value" (DogStatsD only)
+	Tags []string
+
+	// Interval is the time between flushes
+	Interval time.Duration
+
+	// Registry is the source of the metrics; nil uses metrics.Default
+	Registry *metrics.Registry
+
+	mu   sync.Mutex
+	last map[string]float64
+}
+
+// Lines returns the statsd lines for the current metric values and
+// records the counter values they were computed from
+func (e *Exporter) Lines() []string {
+	registry := e.Registry
+	if registry == nil {
+		registry = metrics.Default
+	}
+	samples := registry.Gather()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.last == nil {
+		e.last = make(map[string]float64)
+	}
+
+	lines := make([]string, 0, len(samples))
+	for _, s := range samples {
+		name, tags := e.nameAndTags(s)
+		value := s.Value
+		typ := "g"
+		if s.Kind == metrics.KindCounter {
+			key := name + "|" + strings.Join(tags, ",")
+			value, e.last[key] = s.Value-e.last[key], s.Value
+			if value <= 0 {
+				continue
+			}
+			typ = "c"
+		}
+		line := name + ":" + strconv.FormatFloat(value, 'f', -1, 64) + "|" + typ
+		if len(tags) > 0 {
+			line += "|#" + strings.Join(tags, ",")
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// nameAndTags returns the metric name and tags for s in e's format
+func (e *Exporter) nameAndTags(s metrics.Sample) (string, []string) {
+	name := e.Prefix + s.Name
+	if e.Format != FormatDogStatsD {
+		for _, l := range s.Labels {
+			name += "." + sanitize(l.Value)
+		}
+		return name, nil
+	}
+	tags := append([]string(nil), e.Tags...)
+	for _, l := range s.Labels {
+		tags = append(tags, l.Name+":"+sanitize(l.Value))
+	}
+	return name, tags
+}
+
+// sanitize replaces characters with meaning in the statsd line format
+func sanitize(v string) string {
+	if v == "" {
+		return "none"
+	}
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ':', '|', ',', '#', '@', ' ', '\n':
+			return '_'
+		}
+		return r
+	}, v)
+}
+
+// Flush sends the current values over conn, packing lines into datagrams
+func (e *Exporter) Flush(conn net.Conn) error {
+	var packet []byte
+	send := func() error {
+		if len(packet) == 0 {
+			return nil
+		}
+		_, err := conn.Write(packet)
+		packet = packet[:0]
+		return err
+	}
+	for _, line := range e.Lines() {
+		if len(packet) > 0 && len(packet)+1+len(line) > maxPacket {
+			if err := send(); err != nil {
+				return err
+			}
+		}
+		if len(packet) > 0 {
+			packet = append(packet, '\n')
+		}
+		packet = append(packet, line...)
+	}
+	return send()
+}
+
+// Run flushes every Interval until ctx is cancelled, then flushes once
+// more so the final counts are not lost
+func (e *Exporter) Run(ctx context.Context) error {
+	conn, err := net.Dial("udp", e.Address)
+	if err != nil {
+		return fmt.Errorf("statsd: %w", err)
+	}
+	defer conn.Close()
+
+	ticker := time.NewTicker(e.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return e.Flush(conn)
+		case <-ticker.C:
+			if err := e.Flush(conn); err != nil {
+				log.Println("Statsd: flush failed:", err)
+			}
+		}
+	}
+}
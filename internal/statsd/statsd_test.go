@@ -0,0 +1,71 @@
+package statsd
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"tls-agent/internal/metrics"
+)
+
+// TestLines tests both formats and counter deltas
+func TestLines(t *testing.T) {
+	r := metrics.NewRegistry()
+	handshakes := r.NewCounterVec("handshakes_total", "Handshakes", "listener", "result")
+	handshakes.With("public", "ok").Add(3)
+	r.NewGauge("in_flight", "In flight").Set(2)
+
+	plain := &Exporter{Prefix: "tls_agent.", Registry: r}
+	want := []string{"tls_agent.handshakes_total.public.ok:3|c", "tls_agent.in_flight:2|g"}
+	if got := plain.Lines(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	handshakes.With("public", "ok").Add(2)
+	want = []string{"tls_agent.handshakes_total.public.ok:2|c", "tls_agent.in_flight:2|g"}
+	if got := plain.Lines(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected the counter increase %q, got %q", want, got)
+	}
+	if got := plain.Lines(); len(got) != 1 {
+		t.Errorf("Expected unchanged counters to be skipped, got %q", got)
+	}
+
+	dog := &Exporter{Format: FormatDogStatsD, Tags: []string{"env:prod"}, Registry: r}
+	want = []string{"handshakes_total:5|c|#env:prod,listener:public,result:ok", "in_flight:2|g|#env:prod"}
+	if got := dog.Lines(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+// TestRun tests that metrics arrive over UDP, including on shutdown
+func TestRun(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer pc.Close()
+
+	r := metrics.NewRegistry()
+	r.NewGauge("up", "Up").Set(1)
+	e := &Exporter{Address: pc.LocalAddr().String(), Interval: time.Hour, Registry: r}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- e.Run(ctx) }()
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	_ = pc.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, maxPacket)
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("Failed to receive metrics: %v", err)
+	}
+	if got := string(buf[:n]); got != "up:1|g" {
+		t.Errorf("Expected up:1|g, got %q", got)
+	}
+}
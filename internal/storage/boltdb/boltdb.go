@@ -0,0 +1,103 @@
+// Package boltdb implements storage.Storage on a bbolt database file, so
+// the agent's state lives in a single file that can sit off the
+// certificate directory
+package boltdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"tls-agent/internal/storage"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// bucket holds every key; values are prefixed with their store time
+var bucket = []byte("tls-agent")
+
+// Store is a bbolt-backed storage.Storage
+type Store struct {
+	db *bolt.DB
+}
+
+// Open opens or creates the database at path. bbolt locks the file, so
+// only one agent can use it at a time; Open gives up after timeout.
+func Open(path string, timeout time.Duration) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: timeout})
+	if err != nil {
+		return nil, fmt.Errorf("boltdb: open %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("boltdb: %w", err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Get implements storage.Storage
+func (s *Store) Get(key string) ([]byte, time.Time, error) {
+	if err := storage.ValidKey(key); err != nil {
+		return nil, time.Time{}, err
+	}
+	var value []byte
+	var modified time.Time
+	err := s.db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(bucket).Get([]byte(key))
+		if raw == nil {
+			return fmt.Errorf("%w: %s", storage.ErrNotExist, key)
+		}
+		if len(raw) < 8 {
+			return fmt.Errorf("boltdb: corrupt value for %s", key)
+		}
+		modified = time.Unix(0, int64(binary.BigEndian.Uint64(raw)))
+		value = bytes.Clone(raw[8:])
+		return nil
+	})
+	return value, modified, err
+}
+
+// Put implements storage.Storage
+func (s *Store) Put(key string, value []byte) error {
+	if err := storage.ValidKey(key); err != nil {
+		return err
+	}
+	raw := binary.BigEndian.AppendUint64(make([]byte, 0, 8+len(value)), uint64(time.Now().UnixNano()))
+	raw = append(raw, value...)
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put([]byte(key), raw)
+	})
+}
+
+// Delete implements storage.Storage
+func (s *Store) Delete(key string) error {
+	if err := storage.ValidKey(key); err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Delete([]byte(key))
+	})
+}
+
+// List implements storage.Storage
+func (s *Store) List(prefix string) ([]string, error) {
+	var keys []string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucket).Cursor()
+		for k, _ := c.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, _ = c.Next() {
+			keys = append(keys, string(k))
+		}
+		return nil
+	})
+	return keys, err
+}
+
+// Close implements storage.Storage
+func (s *Store) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,44 @@
+package boltdb
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tls-agent/internal/storage/storagetest"
+)
+
+// TestStore tests the bbolt backend, including reopening the file
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	s, err := Open(path, time.Second)
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+	storagetest.Run(t, s)
+	if err := s.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+
+	s, err = Open(path, time.Second)
+	if err != nil {
+		t.Fatalf("Failed to reopen: %v", err)
+	}
+	defer s.Close()
+	if value, _, err := s.Get("ocsp/b"); err != nil || string(value) != "value of ocsp/b" {
+		t.Errorf("Expected values to survive a reopen, got %q (%v)", value, err)
+	}
+}
+
+// TestLocked tests that a second agent cannot open the same database
+func TestLocked(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	s, err := Open(path, time.Second)
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+	defer s.Close()
+	if _, err := Open(path, 50*time.Millisecond); err == nil {
+		t.Error("Expected the locked database to fail to open")
+	}
+}
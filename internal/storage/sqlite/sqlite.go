@@ -0,0 +1,116 @@
+// Package sqlite implements storage.Storage on a SQLite database file. It
+// uses a pure-Go SQLite driver, so the backend works in CGO_ENABLED=0
+// builds such as the container image.
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"tls-agent/internal/storage"
+
+	_ "modernc.org/sqlite"
+)
+
+const schema = `CREATE TABLE IF NOT EXISTS kv (
+	key      TEXT PRIMARY KEY,
+	value    BLOB NOT NULL,
+	modified INTEGER NOT NULL
+)`
+
+// Store is a SQLite-backed storage.Storage
+type Store struct {
+	db *sql.DB
+}
+
+// Open opens or creates the database at path
+func Open(path string) (*Store, error) {
+	// WAL lets readers proceed during writes; busy_timeout waits out locks
+	// held by concurrent writers instead of failing immediately
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: open %s: %w", path, err)
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("sqlite: open %s: %w", path, err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Get implements storage.Storage
+func (s *Store) Get(key string) ([]byte, time.Time, error) {
+	if err := storage.ValidKey(key); err != nil {
+		return nil, time.Time{}, err
+	}
+	var value []byte
+	var modified int64
+	err := s.db.QueryRow(`SELECT value, modified FROM kv WHERE key = ?`, key).Scan(&value, &modified)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, time.Time{}, fmt.Errorf("%w: %s", storage.ErrNotExist, key)
+	}
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("sqlite: %w", err)
+	}
+	return value, time.Unix(0, modified), nil
+}
+
+// Put implements storage.Storage
+func (s *Store) Put(key string, value []byte) error {
+	if err := storage.ValidKey(key); err != nil {
+		return err
+	}
+	if value == nil {
+		value = []byte{}
+	}
+	_, err := s.db.Exec(`INSERT INTO kv (key, value, modified) VALUES (?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value, modified = excluded.modified`,
+		key, value, time.Now().UnixNano())
+	if err != nil {
+		return fmt.Errorf("sqlite: %w", err)
+	}
+	return nil
+}
+
+// Delete implements storage.Storage
+func (s *Store) Delete(key string) error {
+	if err := storage.ValidKey(key); err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(`DELETE FROM kv WHERE key = ?`, key); err != nil {
+		return fmt.Errorf("sqlite: %w", err)
+	}
+	return nil
+}
+
+// List implements storage.Storage
+func (s *Store) List(prefix string) ([]string, error) {
+	// Keys compare bytewise, so the keys with prefix follow it in order.
+	// This avoids LIKE, whose wildcards could appear in prefix.
+	rows, err := s.db.Query(`SELECT key FROM kv WHERE key >= ? ORDER BY key`, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, fmt.Errorf("sqlite: %w", err)
+		}
+		if !strings.HasPrefix(key, prefix) {
+			break
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// Close implements storage.Storage
+func (s *Store) Close() error {
+	return s.db.Close()
+}
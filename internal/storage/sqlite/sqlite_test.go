@@ -0,0 +1,30 @@
+package sqlite
+
+import (
+	"path/filepath"
+	"testing"
+
+	"tls-agent/internal/storage/storagetest"
+)
+
+// TestStore tests the SQLite backend, including reopening the file
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.sqlite")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+	storagetest.Run(t, s)
+	if err := s.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+
+	s, err = Open(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen: %v", err)
+	}
+	defer s.Close()
+	if value, _, err := s.Get("ocsp/b"); err != nil || string(value) != "value of ocsp/b" {
+		t.Errorf("Expected values to survive a reopen, got %q (%v)", value, err)
+	}
+}
@@ -0,0 +1,192 @@
+// Package storage persists the agent's state outside the certificate
+// directory: ACME account keys, issued certificates, fetched OCSP responses,
+// intermediates and CRLs, and the reload history. Keys are slash-separated
+// paths; by convention the first element names the owner, e.g.
+// "ocsp/<hash>" or "history/reloads.json".
+//
+// FS is the default backend; the boltdb and sqlite subpackages keep
+// everything in a single database file.
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrNotExist is returned by Get for a key that has no value
+var ErrNotExist = errors.New("storage: key does not exist")
+
+// Storage is a key/value store for the agent's state. Implementations must
+// be safe for concurrent use and must replace values atomically.
+type Storage interface {
+	// Get returns the value of key and when it was stored
+	Get(key string) ([]byte, time.Time, error)
+
+	// Put stores value under key, replacing any previous value
+	Put(key string, value []byte) error
+
+	// Delete removes key; deleting a missing key is not an error
+	Delete(key string) error
+
+	// List returns the keys starting with prefix in lexical order
+	List(prefix string) ([]string, error)
+
+	// Close releases the backend
+	Close() error
+}
+
+// ValidKey reports an error for keys that are empty, absolute, or contain
+// empty, "." or ".." elements, so that no backend can be made to escape
+// its namespace
+func ValidKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return fmt.Errorf("storage: invalid key %q", key)
+	}
+	for _, elem := range strings.Split(key, "/") {
+		if elem == "" || elem == "." || elem == ".." {
+			return fmt.Errorf("storage: invalid key %q", key)
+		}
+	}
+	return nil
+}
+
+// FS stores each key as a file under Dir. Values may hold private keys, so
+// files are created with 0600 permissions.
+type FS struct {
+	Dir string
+}
+
+// Get implements Storage
+func (s *FS) Get(key string) ([]byte, time.Time, error) {
+	if err := ValidKey(key); err != nil {
+		return nil, time.Time{}, err
+	}
+	p := s.path(key)
+	info, err := os.Stat(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, time.Time{}, fmt.Errorf("%w: %s", ErrNotExist, key)
+	}
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return data, info.ModTime(), nil
+}
+
+// Put implements Storage
+func (s *FS) Put(key string, value []byte) error {
+	if err := ValidKey(key); err != nil {
+		return err
+	}
+	p := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return err
+	}
+	return writeFile(p, value)
+}
+
+// writeFile atomically replaces p. os.CreateTemp creates the file with 0600
+// permissions, so the value is never readable by others.
+func writeFile(p string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(p), "."+filepath.Base(p)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+// Delete implements Storage
+func (s *FS) Delete(key string) error {
+	if err := ValidKey(key); err != nil {
+		return err
+	}
+	if err := os.Remove(s.path(key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// List implements Storage
+func (s *FS) List(prefix string) ([]string, error) {
+	var keys []string
+	err := filepath.WalkDir(s.Dir, func(p string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && p == s.Dir {
+			return filepath.SkipAll
+		}
+		if err != nil || d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+			return err
+		}
+		rel, err := filepath.Rel(s.Dir, p)
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	return keys, err
+}
+
+// Close implements Storage
+func (s *FS) Close() error {
+	return nil
+}
+
+func (s *FS) path(key string) string {
+	return filepath.Join(s.Dir, filepath.FromSlash(key))
+}
+
+// namespace prefixes every key of an underlying store
+type namespace struct {
+	Storage
+	prefix string
+}
+
+// Namespace returns a view of s in which every key is stored under
+// name + "/". Closing the view does not close s.
+func Namespace(s Storage, name string) Storage {
+	return &namespace{Storage: s, prefix: path.Clean(name) + "/"}
+}
+
+func (n *namespace) Get(key string) ([]byte, time.Time, error) {
+	return n.Storage.Get(n.prefix + key)
+}
+
+func (n *namespace) Put(key string, value []byte) error {
+	return n.Storage.Put(n.prefix+key, value)
+}
+
+func (n *namespace) Delete(key string) error {
+	return n.Storage.Delete(n.prefix + key)
+}
+
+func (n *namespace) List(prefix string) ([]string, error) {
+	keys, err := n.Storage.List(n.prefix + prefix)
+	for i, key := range keys {
+		keys[i] = strings.TrimPrefix(key, n.prefix)
+	}
+	return keys, err
+}
+
+func (n *namespace) Close() error {
+	return nil
+}
@@ -0,0 +1,33 @@
+package storage_test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"tls-agent/internal/storage"
+	"tls-agent/internal/storage/storagetest"
+)
+
+// TestFS tests the filesystem backend
+func TestFS(t *testing.T) {
+	dir := t.TempDir()
+	s := &storage.FS{Dir: dir}
+	storagetest.Run(t, s)
+
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(filepath.Join(dir, "acme", "accounts", "key.pem"))
+		if err != nil {
+			t.Fatalf("Failed to stat value: %v", err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("Expected values to be written 0600, got %v", info.Mode().Perm())
+		}
+	}
+
+	empty := &storage.FS{Dir: filepath.Join(dir, "missing")}
+	if keys, err := empty.List(""); err != nil || len(keys) != 0 {
+		t.Errorf("Expected no keys in a missing directory, got %v (%v)", keys, err)
+	}
+}
@@ -0,0 +1,95 @@
+// Package storagetest checks that a storage.Storage implementation
+// behaves like the others.
+package storagetest
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"tls-agent/internal/storage"
+)
+
+// Run tests s, which must be empty
+func Run(t *testing.T, s storage.Storage) {
+	t.Helper()
+	start := time.Now().Add(-time.Second)
+
+	if _, _, err := s.Get("missing/key"); !errors.Is(err, storage.ErrNotExist) {
+		t.Errorf("Expected ErrNotExist for a missing key, got %v", err)
+	}
+
+	for _, key := range []string{"ocsp/b", "ocsp/a", "acme/accounts/key.pem", "history"} {
+		if err := s.Put(key, []byte("value of "+key)); err != nil {
+			t.Fatalf("Failed to put %s: %v", key, err)
+		}
+	}
+	value, modified, err := s.Get("acme/accounts/key.pem")
+	if err != nil || string(value) != "value of acme/accounts/key.pem" {
+		t.Errorf("Unexpected value %q (%v)", value, err)
+	}
+	if modified.Before(start) || modified.After(time.Now().Add(time.Second)) {
+		t.Errorf("Unexpected modification time %v", modified)
+	}
+
+	if err := s.Put("ocsp/a", []byte("replaced")); err != nil {
+		t.Fatalf("Failed to replace: %v", err)
+	}
+	if value, _, _ := s.Get("ocsp/a"); string(value) != "replaced" {
+		t.Errorf("Expected the replaced value, got %q", value)
+	}
+
+	keys, err := s.List("ocsp/")
+	if err != nil || !slices.Equal(keys, []string{"ocsp/a", "ocsp/b"}) {
+		t.Errorf("Unexpected keys %v (%v)", keys, err)
+	}
+	if keys, _ := s.List(""); len(keys) != 4 {
+		t.Errorf("Expected 4 keys, got %v", keys)
+	}
+
+	if err := s.Delete("ocsp/a"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if err := s.Delete("ocsp/a"); err != nil {
+		t.Errorf("Expected deleting a missing key to succeed, got %v", err)
+	}
+	if _, _, err := s.Get("ocsp/a"); !errors.Is(err, storage.ErrNotExist) {
+		t.Errorf("Expected ErrNotExist after delete, got %v", err)
+	}
+
+	for _, key := range []string{"", "/abs", "a/../b", "a//b", "."} {
+		if err := s.Put(key, nil); err == nil {
+			t.Errorf("Expected key %q to be rejected", key)
+		}
+	}
+
+	ns := storage.Namespace(s, "crl")
+	if err := ns.Put("x", []byte("1")); err != nil {
+		t.Fatalf("Failed to put in namespace: %v", err)
+	}
+	if value, _, err := s.Get("crl/x"); err != nil || string(value) != "1" {
+		t.Errorf("Expected the namespaced key under crl/, got %q (%v)", value, err)
+	}
+	if keys, _ := ns.List(""); !slices.Equal(keys, []string{"x"}) {
+		t.Errorf("Expected namespace keys without the prefix, got %v", keys)
+	}
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			key := fmt.Sprintf("concurrent/%d", i)
+			if err := s.Put(key, []byte(key)); err != nil {
+				t.Errorf("Failed to put %s: %v", key, err)
+			}
+			if _, _, err := s.Get(key); err != nil {
+				t.Errorf("Failed to get %s: %v", key, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,129 @@
+// Package systemd implements the parts of the systemd service protocol the
+// agent uses: socket activation, readiness and stop notification, and the
+// watchdog. Every function is a no-op when the process was not started by
+// systemd with the corresponding feature enabled.
+package systemd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Notification states understood by systemd
+const (
+	Ready    = "READY=1"
+	Stopping = "STOPPING=1"
+	Watchdog = "WATCHDOG=1"
+)
+
+// listenFDsStart is the first file descriptor passed by socket activation
+const listenFDsStart = 3
+
+// Notify sends state to the service manager. It does nothing when
+// NOTIFY_SOCKET is unset, i.e. the unit is not Type=notify.
+func Notify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	// A leading @ denotes the abstract socket namespace
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("systemd: notify: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return fmt.Errorf("systemd: notify: %w", err)
+	}
+	return nil
+}
+
+// WatchdogInterval returns the WatchdogSec= of the unit, or zero when the
+// watchdog is disabled or meant for another process. Pings should be sent at
+// least twice per interval.
+func WatchdogInterval() (time.Duration, error) {
+	usec := os.Getenv("WATCHDOG_USEC")
+	if usec == "" {
+		return 0, nil
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(usec, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("systemd: invalid WATCHDOG_USEC %q", usec)
+	}
+	return time.Duration(n) * time.Microsecond, nil
+}
+
+// Listeners returns the sockets passed by socket activation, keyed by their
+// FileDescriptorName= (by default the name of the socket unit). It returns
+// nil when the process was not socket-activated. The activation variables
+// are cleared so child processes do not mistake the sockets for their own.
+func Listeners() (map[string]net.Listener, error) {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("systemd: invalid LISTEN_FDS %q", os.Getenv("LISTEN_FDS"))
+	}
+
+	names := fdNames(n, os.Getenv("LISTEN_FDNAMES"))
+	listeners := make(map[string]net.Listener, n)
+	for i := range n {
+		f := os.NewFile(uintptr(listenFDsStart+i), names[i])
+		ln, err := net.FileListener(f)
+		// FileListener duplicates the descriptor
+		f.Close()
+		if err != nil {
+			closeAll(listeners)
+			return nil, fmt.Errorf("systemd: socket %s: %w", names[i], err)
+		}
+		if _, ok := listeners[names[i]]; ok {
+			ln.Close()
+			closeAll(listeners)
+			return nil, fmt.Errorf("systemd: duplicate socket name %q", names[i])
+		}
+		listeners[names[i]] = ln
+	}
+	return listeners, nil
+}
+
+// fdNames returns the names of n passed descriptors. Descriptors without a
+// name in LISTEN_FDNAMES are named by their index.
+func fdNames(n int, env string) []string {
+	var given []string
+	if env != "" {
+		given = strings.Split(env, ":")
+	}
+	names := make([]string, n)
+	for i := range names {
+		if i < len(given) && given[i] != "" {
+			names[i] = given[i]
+		} else {
+			names[i] = strconv.Itoa(i)
+		}
+	}
+	return names
+}
+
+func closeAll(listeners map[string]net.Listener) {
+	for _, ln := range listeners {
+		ln.Close()
+	}
+}
@@ -0,0 +1,92 @@
+package tenant
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"tls-agent/internal/inventory"
+	"tls-agent/internal/stapling"
+)
+
+// Summary describes a tenant in the listing
+type Summary struct {
+	Name         string   `json:"name"`
+	ServerNames  []string `json:"server_names"`
+	Certificates int      `json:"certificates"`
+}
+
+// Handler serves the tenants on the admin API:
+//
+//	GET  /tenants                      every tenant
+//	GET  /tenants/{name}/certificates  the tenant's certificate inventory
+//	POST /tenants/{name}/reload        reload the tenant's certificates
+//
+// The per-tenant endpoints require the tenant's token when it has one, so a
+// tenant's operators can be given access to their tenant only. stapler may
+// be nil.
+func (s *Set) Handler(stapler *stapling.Manager) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /tenants", func(w http.ResponseWriter, r *http.Request) {
+		summaries := make([]Summary, len(s.tenants))
+		for i, t := range s.tenants {
+			summaries[i] = Summary{
+				Name:         t.Name,
+				ServerNames:  append([]string{}, t.ServerNames...),
+				Certificates: len(t.Store.Certificates()),
+			}
+		}
+		writeJSON(w, struct {
+			Tenants []Summary `json:"tenants"`
+		}{summaries})
+	})
+	mux.HandleFunc("GET /tenants/{name}/certificates", s.authorized(func(w http.ResponseWriter, r *http.Request, t *Tenant) {
+		inv := &inventory.Inventory{Store: t.Store, Stapler: stapler}
+		writeJSON(w, struct {
+			Certificates []inventory.Certificate `json:"certificates"`
+		}{inv.List()})
+	}))
+	mux.HandleFunc("POST /tenants/{name}/reload", s.authorized(func(w http.ResponseWriter, r *http.Request, t *Tenant) {
+		if t.Reload == nil {
+			http.Error(w, "reload is not available", http.StatusNotImplemented)
+			return
+		}
+		if err := t.Reload(); err != nil {
+			log.Printf("Tenant %s: reload failed: %v", t.Name, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, struct {
+			Reloaded string `json:"reloaded"`
+		}{t.Name})
+	}))
+	return mux
+}
+
+// authorized resolves the tenant named in the path and checks its token
+func (s *Set) authorized(next func(http.ResponseWriter, *http.Request, *Tenant)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t, err := s.Get(r.PathValue("name"))
+		if errors.Is(err, ErrUnknownTenant) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if t.Token != "" {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(t.Token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="`+t.Name+`"`)
+				http.Error(w, "invalid tenant token", http.StatusUnauthorized)
+				return
+			}
+		}
+		next(w, r, t)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
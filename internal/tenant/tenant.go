@@ -0,0 +1,114 @@
+// Package tenant serves several logical tenants from one agent. Each tenant
+// has its own certificates, acceptance policy and admin token. Handshakes
+// are routed to a tenant by server name on the shared listener, or by
+// arriving on the tenant's dedicated listener.
+package tenant
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strings"
+
+	"tls-agent/internal/tlsstore"
+)
+
+// ErrUnknownTenant is returned when no tenant has the requested name
+var ErrUnknownTenant = errors.New("tenant: unknown tenant")
+
+// Tenant is one logical tenant
+type Tenant struct {
+	Name string
+
+	// ServerNames route handshakes on the shared listener to this tenant;
+	// "*.example.com" matches one label
+	ServerNames []string
+
+	// Store holds the tenant's certificates. Its default certificate is
+	// served when a handshake matches none of the tenant's SNI names.
+	Store *tlsstore.Store
+
+	// Token, if set, is required as a bearer token on the tenant's admin
+	// endpoints
+	Token string
+
+	// Reload reloads the tenant's certificates from their sources
+	Reload func() error
+}
+
+// Set routes handshakes to tenants
+type Set struct {
+	tenants []*Tenant
+	byName  map[string]*Tenant
+
+	// routes maps lower-cased server names (exact or "*.suffix") to tenants
+	routes map[string]*Tenant
+}
+
+// NewSet returns a set of tenants. Names and server names must be unique.
+func NewSet(tenants ...*Tenant) (*Set, error) {
+	s := &Set{byName: make(map[string]*Tenant), routes: make(map[string]*Tenant)}
+	for _, t := range tenants {
+		if t.Name == "" {
+			return nil, errors.New("tenant: name is required")
+		}
+		if _, ok := s.byName[t.Name]; ok {
+			return nil, fmt.Errorf("tenant: duplicate tenant %q", t.Name)
+		}
+		s.byName[t.Name] = t
+		s.tenants = append(s.tenants, t)
+
+		for _, name := range t.ServerNames {
+			name = strings.ToLower(strings.TrimSuffix(name, "."))
+			if other, ok := s.routes[name]; ok {
+				return nil, fmt.Errorf("tenant: server name %q is claimed by %q and %q", name, other.Name, t.Name)
+			}
+			s.routes[name] = t
+		}
+	}
+	return s, nil
+}
+
+// Tenants returns the tenants in configuration order
+func (s *Set) Tenants() []*Tenant {
+	return s.tenants
+}
+
+// Get returns the tenant called name
+func (s *Set) Get(name string) (*Tenant, error) {
+	t, ok := s.byName[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownTenant, name)
+	}
+	return t, nil
+}
+
+// Route returns the tenant serving serverName, trying an exact match and
+// then a wildcard for the first label, or nil
+func (s *Set) Route(serverName string) *Tenant {
+	if serverName == "" {
+		return nil
+	}
+	name := strings.ToLower(strings.TrimSuffix(serverName, "."))
+	if t, ok := s.routes[name]; ok {
+		return t
+	}
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		if t, ok := s.routes["*"+name[i:]]; ok {
+			return t
+		}
+	}
+	return nil
+}
+
+// GetCertificate returns a tls.Config.GetCertificate callback that serves
+// the routed tenant's certificate and falls back to next for server names
+// no tenant claims
+func (s *Set) GetCertificate(next func(*tls.ClientHelloInfo) (*tls.Certificate, error)) func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		if t := s.Route(hello.ServerName); t != nil {
+			return t.Store.GetCertificate(hello)
+		}
+		return next(hello)
+	}
+}
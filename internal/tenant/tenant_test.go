@@ -0,0 +1,112 @@
+package tenant
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"tls-agent/internal/tlsstore"
+	"tls-agent/pkg/agenttest"
+)
+
+// TestRouting tests that server names select the tenant's certificate
+func TestRouting(t *testing.T) {
+	ca := agenttest.NewCA(t)
+	shopCert := ca.IssueTLS(t, "shop.example.com")
+	blogCert := ca.IssueTLS(t, "blog.example.com")
+	fallback := ca.IssueTLS(t, "agent.example.com")
+
+	set, err := NewSet(
+		&Tenant{Name: "shop", ServerNames: []string{"shop.example.com", "*.shop.example.com"}, Store: tlsstore.New(shopCert)},
+		&Tenant{Name: "blog", ServerNames: []string{"blog.example.com"}, Store: tlsstore.New(blogCert)},
+	)
+	if err != nil {
+		t.Fatalf("Failed to create set: %v", err)
+	}
+	get := set.GetCertificate(func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return fallback, nil })
+
+	for serverName, want := range map[string]*tls.Certificate{
+		"shop.example.com":      shopCert,
+		"Cart.Shop.example.com": shopCert,
+		"blog.example.com.":     blogCert,
+		"a.b.shop.example.com":  fallback,
+		"other.example.com":     fallback,
+		"":                      fallback,
+	} {
+		got, err := get(&tls.ClientHelloInfo{ServerName: serverName})
+		if err != nil || got != want {
+			t.Errorf("Wrong certificate for %q (%v)", serverName, err)
+		}
+	}
+}
+
+// TestNewSetConflicts tests that tenants cannot share names or server names
+func TestNewSetConflicts(t *testing.T) {
+	if _, err := NewSet(&Tenant{Name: "a"}, &Tenant{Name: "a"}); err == nil {
+		t.Error("Expected an error for duplicate tenants")
+	}
+	if _, err := NewSet(&Tenant{Name: "a", ServerNames: []string{"x.example.com"}}, &Tenant{Name: "b", ServerNames: []string{"X.example.com"}}); err == nil {
+		t.Error("Expected an error for a shared server name")
+	}
+	if _, err := NewSet(&Tenant{}); err == nil {
+		t.Error("Expected an error for a tenant without a name")
+	}
+}
+
+// TestHandler tests the tenant admin endpoints and their tokens
+func TestHandler(t *testing.T) {
+	ca := agenttest.NewCA(t)
+	reloads := 0
+	set, err := NewSet(
+		&Tenant{Name: "shop", ServerNames: []string{"shop.example.com"}, Store: tlsstore.New(ca.IssueTLS(t, "shop.example.com")), Token: "s3cret",
+			Reload: func() error { reloads++; return nil }},
+		&Tenant{Name: "blog", ServerNames: []string{"blog.example.com"}, Store: tlsstore.New(ca.IssueTLS(t, "blog.example.com"))},
+	)
+	if err != nil {
+		t.Fatalf("Failed to create set: %v", err)
+	}
+	srv := httptest.NewServer(set.Handler(nil))
+	defer srv.Close()
+
+	do := func(method, path, token string) *http.Response {
+		req, _ := http.NewRequest(method, srv.URL+path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to %s %s: %v", method, path, err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	var list struct {
+		Tenants []Summary `json:"tenants"`
+	}
+	if err := json.NewDecoder(do(http.MethodGet, "/tenants", "").Body).Decode(&list); err != nil || len(list.Tenants) != 2 || list.Tenants[0].Name != "shop" {
+		t.Errorf("Unexpected tenant list %+v (%v)", list, err)
+	}
+
+	for _, tt := range []struct {
+		method, path, token string
+		want                int
+	}{
+		{http.MethodGet, "/tenants/shop/certificates", "", http.StatusUnauthorized},
+		{http.MethodGet, "/tenants/shop/certificates", "wrong", http.StatusUnauthorized},
+		{http.MethodGet, "/tenants/shop/certificates", "s3cret", http.StatusOK},
+		{http.MethodGet, "/tenants/blog/certificates", "", http.StatusOK},
+		{http.MethodGet, "/tenants/nope/certificates", "", http.StatusNotFound},
+		{http.MethodPost, "/tenants/shop/reload", "s3cret", http.StatusOK},
+		{http.MethodPost, "/tenants/blog/reload", "", http.StatusNotImplemented},
+	} {
+		if got := do(tt.method, tt.path, tt.token).StatusCode; got != tt.want {
+			t.Errorf("Expected %d for %s %s with token %q, got %d", tt.want, tt.method, tt.path, tt.token, got)
+		}
+	}
+	if reloads != 1 {
+		t.Errorf("Expected one reload, got %d", reloads)
+	}
+}
@@ -0,0 +1,212 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+
+	"tls-agent/internal/metrics"
+)
+
+var policyHandshakes = metrics.NewCounterVec("tls_agent_client_policy_handshakes_total",
+	"TLS handshakes by the per-connection client policy applied (default when none matched)", "policy")
+
+// ClientPolicy is the TLS settings for connections matching its server
+// names and source networks. Empty ServerNames or Sources match anything.
+type ClientPolicy struct {
+	Name string
+
+	// ServerNames are SNI names, exact or wildcard ("*.example.com")
+	ServerNames []string
+
+	// Sources are the client networks the policy applies to
+	Sources []netip.Prefix
+
+	// ClientAuth is the client certificate requirement. Certificates are
+	// checked by VerifyClient, so use RequestClientCert or
+	// RequireAnyClientCert rather than the verifying modes.
+	ClientAuth tls.ClientAuthType
+
+	// VerifyClient verifies presented client certificates
+	VerifyClient func(rawCerts [][]byte, chains [][]*x509.Certificate) error
+
+	// ClientCAs, if set, returns the pool advertised to clients as
+	// acceptable issuers; it is called per handshake so rotations apply
+	ClientCAs func() *x509.CertPool
+
+	// MinVersion and CipherSuites override the listener's; zero keeps them
+	MinVersion   uint16
+	CipherSuites []uint16
+}
+
+// matches reports whether the policy applies to hello
+func (p *ClientPolicy) matches(hello *tls.ClientHelloInfo) bool {
+	if len(p.ServerNames) > 0 && !matchServerName(p.ServerNames, hello.ServerName) {
+		return false
+	}
+	if len(p.Sources) > 0 {
+		addr, ok := remoteAddr(hello.Conn)
+		if !ok {
+			return false
+		}
+		for _, prefix := range p.Sources {
+			if prefix.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// ClientPolicies selects per-connection TLS settings with the first policy
+// matching each ClientHello. Policies can be replaced while serving.
+type ClientPolicies struct {
+	base     *tls.Config
+	policies atomic.Pointer[[]ClientPolicy]
+}
+
+// NewClientPolicies creates a selector deriving per-connection configs from
+// base. base must be the config the listener serves with; its later changes
+// are picked up, since it is cloned on every matching handshake.
+func NewClientPolicies(base *tls.Config, policies []ClientPolicy) *ClientPolicies {
+	c := &ClientPolicies{base: base}
+	c.Set(policies)
+	return c
+}
+
+// Set replaces the policies
+func (c *ClientPolicies) Set(policies []ClientPolicy) {
+	c.policies.Store(&policies)
+}
+
+// GetConfigForClient implements tls.Config.GetConfigForClient. It returns
+// nil, keeping the listener's settings, when no policy matches.
+func (c *ClientPolicies) GetConfigForClient(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+	policies := *c.policies.Load()
+	for i := range policies {
+		p := &policies[i]
+		if !p.matches(hello) {
+			continue
+		}
+		policyHandshakes.With(p.Name).Inc()
+		return c.configFor(p), nil
+	}
+	policyHandshakes.With("default").Inc()
+	return nil, nil
+}
+
+func (c *ClientPolicies) configFor(p *ClientPolicy) *tls.Config {
+	cfg := c.base.Clone()
+	cfg.GetConfigForClient = nil
+	cfg.ClientAuth = p.ClientAuth
+	cfg.VerifyPeerCertificate = p.VerifyClient
+	cfg.ClientCAs = nil
+	if p.ClientCAs != nil {
+		cfg.ClientCAs = p.ClientCAs()
+	}
+	if p.MinVersion != 0 {
+		cfg.MinVersion = p.MinVersion
+	}
+	if len(p.CipherSuites) > 0 {
+		cfg.CipherSuites = p.CipherSuites
+	}
+	return cfg
+}
+
+// ParseVersion converts "1.2" or "1.3" (optionally prefixed "TLS") into a
+// tls version; "" returns 0
+func ParseVersion(name string) (uint16, error) {
+	switch strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(name)), "TLS") {
+	case "":
+		return 0, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unsupported TLS version %q", name)
+	}
+}
+
+// ParseCipherSuites converts IANA suite names such as
+// "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256" into IDs. Only suites Go
+// considers secure are accepted. TLS 1.3 suites are not configurable and
+// are rejected.
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	byName := make(map[string]*tls.CipherSuite)
+	for _, s := range tls.CipherSuites() {
+		byName[s.Name] = s
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		s, ok := byName[strings.ToUpper(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+		if len(s.SupportedVersions) == 1 && s.SupportedVersions[0] == tls.VersionTLS13 {
+			return nil, fmt.Errorf("cipher suite %s is TLS 1.3 only and cannot be configured", name)
+		}
+		ids = append(ids, s.ID)
+	}
+	return ids, nil
+}
+
+// ParsePrefixes parses CIDRs or single addresses into prefixes
+func ParsePrefixes(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, v := range values {
+		if !strings.Contains(v, "/") {
+			addr, err := netip.ParseAddr(v)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(v)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// matchServerName reports whether name matches one of patterns exactly or
+// through a wildcard for its first label
+func matchServerName(patterns []string, name string) bool {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	for _, p := range patterns {
+		p = strings.ToLower(p)
+		if p == name {
+			return true
+		}
+		if suffix, ok := strings.CutPrefix(p, "*."); ok {
+			if i := strings.IndexByte(name, '.'); i > 0 && name[i+1:] == suffix {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// remoteAddr returns the client's address for a handshake on conn
+func remoteAddr(conn net.Conn) (netip.Addr, bool) {
+	if conn == nil {
+		return netip.Addr{}, false
+	}
+	if tcp, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		return tcp.AddrPort().Addr().Unmap(), true
+	}
+	ap, err := netip.ParseAddrPort(conn.RemoteAddr().String())
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return ap.Addr().Unmap(), true
+}
@@ -0,0 +1,141 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/netip"
+	"testing"
+
+	"tls-agent/internal/metrics/metricstest"
+	"tls-agent/pkg/agenttest"
+)
+
+// addrConn reports a fixed remote address
+type addrConn struct {
+	net.Conn
+	remote net.Addr
+}
+
+func (c addrConn) RemoteAddr() net.Addr { return c.remote }
+
+// tryHandshake performs a handshake over an in-memory pipe and returns the
+// client's error
+func tryHandshake(server, client *tls.Config) error {
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	go func() {
+		_ = tls.Server(serverConn, server).Handshake()
+		serverConn.Close()
+	}()
+
+	conn := tls.Client(clientConn, client)
+	if err := conn.Handshake(); err != nil {
+		return err
+	}
+	// Client certificate rejections arrive after the client's handshake
+	// completes in TLS 1.3, so read to surface them
+	_, err := conn.Read(make([]byte, 1))
+	return err
+}
+
+// TestClientPoliciesByServerName tests mixing public and mTLS names on one listener
+func TestClientPoliciesByServerName(t *testing.T) {
+	cert := *agenttest.NewCA(t).IssueTLS(t, "localhost")
+	errRejected := errors.New("client certificate rejected")
+	base := &tls.Config{Certificates: []tls.Certificate{cert}}
+	policies := NewClientPolicies(base, []ClientPolicy{{
+		Name:        "internal",
+		ServerNames: []string{"*.internal.example"},
+		ClientAuth:  tls.RequireAnyClientCert,
+		VerifyClient: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return errRejected
+			}
+			return nil
+		},
+		MinVersion: tls.VersionTLS13,
+	}})
+	base.GetConfigForClient = policies.GetConfigForClient
+
+	handshakes := metricstest.Delta(policyHandshakes.With("internal"))
+
+	public := &tls.Config{InsecureSkipVerify: true, ServerName: "www.example"}
+	if err := tryHandshake(base, public); err == nil || err.Error() != "EOF" {
+		// The server closes after the handshake, so EOF means success
+		t.Errorf("Expected the public name to need no client certificate, got %v", err)
+	}
+
+	internal := &tls.Config{InsecureSkipVerify: true, ServerName: "api.internal.example"}
+	if err := tryHandshake(base, internal); err == nil || err.Error() == "EOF" {
+		t.Error("Expected the internal name to require a client certificate")
+	}
+
+	internal.Certificates = []tls.Certificate{cert}
+	if err := tryHandshake(base, internal); err == nil || err.Error() != "EOF" {
+		t.Errorf("Expected a handshake with a client certificate to succeed, got %v", err)
+	}
+
+	tls12 := &tls.Config{InsecureSkipVerify: true, ServerName: "api.internal.example", Certificates: []tls.Certificate{cert}, MaxVersion: tls.VersionTLS12}
+	if err := tryHandshake(base, tls12); err == nil || err.Error() == "EOF" {
+		t.Error("Expected the policy's minimum version to reject TLS 1.2")
+	}
+	if got := handshakes(); got != 3 {
+		t.Errorf("Expected 3 handshakes under the internal policy, got %d", got)
+	}
+}
+
+// TestClientPolicyMatch tests matching by server name and source network
+func TestClientPolicyMatch(t *testing.T) {
+	sources, err := ParsePrefixes([]string{"10.0.0.0/8", "192.0.2.7"})
+	if err != nil {
+		t.Fatalf("ParsePrefixes failed: %v", err)
+	}
+	p := &ClientPolicy{ServerNames: []string{"api.example.com"}, Sources: sources}
+
+	hello := func(name, addr string) *tls.ClientHelloInfo {
+		return &tls.ClientHelloInfo{ServerName: name, Conn: addrConn{remote: net.TCPAddrFromAddrPort(netip.MustParseAddrPort(addr))}}
+	}
+	cases := []struct {
+		name, addr string
+		want       bool
+	}{
+		{"api.example.com", "10.1.2.3:443", true},
+		{"API.example.com", "192.0.2.7:1000", true},
+		{"api.example.com", "192.0.2.8:1000", false},
+		{"www.example.com", "10.1.2.3:443", false},
+		{"api.example.com", "[::ffff:10.9.9.9]:443", true},
+	}
+	for _, c := range cases {
+		if got := p.matches(hello(c.name, c.addr)); got != c.want {
+			t.Errorf("%s from %s: expected %v, got %v", c.name, c.addr, c.want, got)
+		}
+	}
+
+	if _, err := ParsePrefixes([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("Invalid prefix should be rejected")
+	}
+}
+
+// TestParseCipherSuites tests cipher suite and version parsing
+func TestParseCipherSuites(t *testing.T) {
+	ids, err := ParseCipherSuites([]string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", "tls_ecdhe_rsa_with_chacha20_poly1305_sha256"})
+	if err != nil || len(ids) != 2 || ids[0] != tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 {
+		t.Errorf("Unexpected suites %v (%v)", ids, err)
+	}
+	for _, bad := range []string{"TLS_RSA_WITH_RC4_128_SHA", "TLS_AES_128_GCM_SHA256", "nope"} {
+		if _, err := ParseCipherSuites([]string{bad}); err == nil {
+			t.Errorf("Expected %s to be rejected", bad)
+		}
+	}
+
+	if v, err := ParseVersion("TLS1.3"); err != nil || v != tls.VersionTLS13 {
+		t.Errorf("Expected TLS 1.3, got %x (%v)", v, err)
+	}
+	if _, err := ParseVersion("1.1"); err == nil {
+		t.Error("TLS 1.1 should be rejected")
+	}
+}
@@ -0,0 +1,127 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"tls-agent/internal/metrics"
+)
+
+var curvesByName = map[string]tls.CurveID{
+	"x25519":         tls.X25519,
+	"p256":           tls.CurveP256,
+	"p384":           tls.CurveP384,
+	"p521":           tls.CurveP521,
+	"x25519mlkem768": tls.X25519MLKEM768,
+}
+
+// classicalCurves is used when post-quantum key exchange is disabled and no
+// explicit preferences are configured
+var classicalCurves = []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384, tls.CurveP521}
+
+var (
+	handshakesByCurve = metrics.NewCounterVec("tls_agent_handshakes_total",
+		"Completed TLS handshakes by listener and negotiated key exchange", "listener", "curve")
+	pqHandshakes = metrics.NewCounterVec("tls_agent_pq_handshakes_total",
+		"Completed TLS handshakes that negotiated a post-quantum hybrid key exchange", "listener")
+)
+
+// ParseCurves converts configured curve names (case-insensitive, e.g.
+// "X25519MLKEM768", "P256") into tls.CurveIDs
+func ParseCurves(names []string) ([]tls.CurveID, error) {
+	curves := make([]tls.CurveID, 0, len(names))
+	for _, name := range names {
+		key := strings.ToLower(strings.NewReplacer("-", "", "_", "").Replace(name))
+		id, ok := curvesByName[key]
+		if !ok {
+			return nil, fmt.Errorf("unknown curve %q", name)
+		}
+		curves = append(curves, id)
+	}
+	return curves, nil
+}
+
+// IsPostQuantum reports whether id is a hybrid post-quantum key exchange
+func IsPostQuantum(id tls.CurveID) bool {
+	return id == tls.X25519MLKEM768
+}
+
+// CurvePreferences resolves the curve list for a listener. With no explicit
+// names and PQ enabled, nil is returned so Go's defaults (which include
+// X25519MLKEM768) apply. With PQ disabled, hybrid groups are removed.
+func CurvePreferences(names []string, postQuantum bool) ([]tls.CurveID, error) {
+	curves, err := ParseCurves(names)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(curves) == 0 {
+		if postQuantum {
+			return nil, nil
+		}
+		return append([]tls.CurveID(nil), classicalCurves...), nil
+	}
+
+	if postQuantum {
+		return curves, nil
+	}
+
+	filtered := curves[:0]
+	for _, id := range curves {
+		if !IsPostQuantum(id) {
+			filtered = append(filtered, id)
+		}
+	}
+	if len(filtered) == 0 {
+		return nil, fmt.Errorf("post-quantum disabled but only hybrid curves configured")
+	}
+	return filtered, nil
+}
+
+// ApplyCurves sets CurvePreferences on cfg for the named listener
+func ApplyCurves(cfg *tls.Config, listener string, names []string, postQuantum bool) error {
+	curves, err := CurvePreferences(names, postQuantum)
+	if err != nil {
+		return fmt.Errorf("listener %s: %w", listener, err)
+	}
+	cfg.CurvePreferences = curves
+	return nil
+}
+
+// HandshakeMetrics returns an http.Server ConnState hook counting the key
+// exchanges negotiated on the named listener. A connection is recorded on
+// its first state change after StateNew, by which point the server has
+// finished its handshake, and only if that handshake completed.
+func HandshakeMetrics(listener string) func(net.Conn, http.ConnState) {
+	var mu sync.Mutex
+	pending := make(map[net.Conn]bool)
+	return func(conn net.Conn, state http.ConnState) {
+		mu.Lock()
+		if state == http.StateNew {
+			pending[conn] = true
+			mu.Unlock()
+			return
+		}
+		first := pending[conn]
+		delete(pending, conn)
+		mu.Unlock()
+
+		if tlsConn, ok := conn.(*tls.Conn); ok && first {
+			if cs := tlsConn.ConnectionState(); cs.HandshakeComplete {
+				RecordHandshake(listener, cs)
+			}
+		}
+	}
+}
+
+// RecordHandshake updates key exchange metrics for a completed handshake
+func RecordHandshake(listener string, cs tls.ConnectionState) {
+	handshakesByCurve.With(listener, cs.CurveID.String()).Inc()
+	if IsPostQuantum(cs.CurveID) {
+		pqHandshakes.With(listener).Inc()
+	}
+}
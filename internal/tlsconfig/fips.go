@@ -0,0 +1,67 @@
+package tlsconfig
+
+import (
+	"crypto/fips140"
+	"crypto/tls"
+	"fmt"
+	"slices"
+)
+
+// fipsCipherSuites are the TLS 1.2 suites approved by NIST SP 800-52r2 that
+// Go implements
+var fipsCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+}
+
+// fipsCurves are the approved key exchange groups
+var fipsCurves = []tls.CurveID{tls.CurveP256, tls.CurveP384, tls.CurveP521}
+
+// IsFIPSCipherSuite reports whether id is an approved TLS 1.2 suite
+func IsFIPSCipherSuite(id uint16) bool {
+	return slices.Contains(fipsCipherSuites, id)
+}
+
+// IsFIPSCurve reports whether id is an approved key exchange group
+func IsFIPSCurve(id tls.CurveID) bool {
+	return slices.Contains(fipsCurves, id)
+}
+
+// FIPSModule reports whether Go's FIPS 140-3 module is enabled
+// (GODEBUG=fips140=on). Only then are TLS 1.3 cipher suites, which Go does
+// not let a tls.Config choose, restricted to approved ones as well.
+func FIPSModule() bool {
+	return fips140.Enabled()
+}
+
+// ApplyFIPS restricts cfg to FIPS-approved protocol versions, TLS 1.2
+// cipher suites and key exchanges. Configured suites and curves that are
+// not approved are dropped; when none remain, every approved one is used.
+func ApplyFIPS(cfg *tls.Config) {
+	cfg.MinVersion = max(cfg.MinVersion, tls.VersionTLS12)
+
+	suites := slices.DeleteFunc(slices.Clone(cfg.CipherSuites), func(id uint16) bool { return !IsFIPSCipherSuite(id) })
+	if len(suites) == 0 {
+		suites = slices.Clone(fipsCipherSuites)
+	}
+	cfg.CipherSuites = suites
+
+	curves := slices.DeleteFunc(slices.Clone(cfg.CurvePreferences), func(id tls.CurveID) bool { return !IsFIPSCurve(id) })
+	if len(curves) == 0 {
+		curves = slices.Clone(fipsCurves)
+	}
+	cfg.CurvePreferences = curves
+}
+
+// CheckFIPS returns an error if p selects TLS 1.2 cipher suites that are not
+// FIPS approved, since they would replace the listener's approved list
+func (p *ClientPolicy) CheckFIPS() error {
+	for _, id := range p.CipherSuites {
+		if !IsFIPSCipherSuite(id) {
+			return fmt.Errorf("client policy %s: cipher suite %s is not FIPS approved", p.Name, tls.CipherSuiteName(id))
+		}
+	}
+	return nil
+}
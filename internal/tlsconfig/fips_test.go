@@ -0,0 +1,69 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"net"
+	"slices"
+	"testing"
+
+	"tls-agent/pkg/agenttest"
+)
+
+// TestApplyFIPS tests that only approved parameters remain and are
+// negotiated
+func TestApplyFIPS(t *testing.T) {
+	cert := *agenttest.NewCA(t).IssueTLS(t, "localhost")
+	server := &tls.Config{
+		Certificates:     []tls.Certificate{cert},
+		CipherSuites:     []uint16{tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256, tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384},
+		CurvePreferences: []tls.CurveID{tls.X25519MLKEM768, tls.X25519, tls.CurveP384},
+	}
+	ApplyFIPS(server)
+	if server.MinVersion != tls.VersionTLS12 {
+		t.Errorf("Expected TLS 1.2 minimum, got %x", server.MinVersion)
+	}
+	if !slices.Equal(server.CipherSuites, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384}) {
+		t.Errorf("Expected only the approved configured suite, got %v", server.CipherSuites)
+	}
+	if !slices.Equal(server.CurvePreferences, []tls.CurveID{tls.CurveP384}) {
+		t.Errorf("Expected only the approved configured curve, got %v", server.CurvePreferences)
+	}
+
+	defaults := &tls.Config{MinVersion: tls.VersionTLS13}
+	ApplyFIPS(defaults)
+	if defaults.MinVersion != tls.VersionTLS13 || len(defaults.CipherSuites) != len(fipsCipherSuites) || len(defaults.CurvePreferences) != len(fipsCurves) {
+		t.Errorf("Expected a stricter minimum to be kept and every approved choice used, got %+v", defaults)
+	}
+
+	cs := handshake(t, server, &tls.Config{InsecureSkipVerify: true, MaxVersion: tls.VersionTLS12})
+	if cs.CipherSuite != tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384 || cs.CurveID != tls.CurveP384 {
+		t.Errorf("Expected an approved suite and curve, got %s %s", tls.CipherSuiteName(cs.CipherSuite), cs.CurveID)
+	}
+
+	// A client offering only unapproved choices is refused
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+	go func() { _ = tls.Server(serverConn, server).Handshake() }()
+	err := tls.Client(clientConn, &tls.Config{
+		InsecureSkipVerify: true,
+		MaxVersion:         tls.VersionTLS12,
+		CipherSuites:       []uint16{tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256},
+	}).Handshake()
+	if err == nil {
+		t.Error("Expected a ChaCha20-only client to be refused")
+	}
+}
+
+// TestClientPolicyCheckFIPS tests that policies cannot select unapproved
+// suites
+func TestClientPolicyCheckFIPS(t *testing.T) {
+	ok := &ClientPolicy{Name: "ok", CipherSuites: []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}}
+	if err := ok.CheckFIPS(); err != nil {
+		t.Errorf("Expected an approved suite to pass, got %v", err)
+	}
+	bad := &ClientPolicy{Name: "legacy", CipherSuites: []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA}}
+	if err := bad.CheckFIPS(); err == nil {
+		t.Error("Expected a CBC suite to be rejected")
+	}
+}
@@ -0,0 +1,79 @@
+package tlsconfig
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// pinPrefix is the only supported pin hash, as in HPKP and curl's
+// --pinnedpubkey
+const pinPrefix = "sha256/"
+
+// ErrPinMismatch is returned when no certificate in a verified chain matches
+// a configured pin
+var ErrPinMismatch = errors.New("no certificate in the chain matches a pinned public key")
+
+// PinSet is a set of SPKI pins of the form "sha256/<base64>". A chain is
+// accepted when any of its certificates (leaf, intermediate or root) has a
+// pinned public key, so pinning an issuing CA survives leaf rotations.
+type PinSet map[string]bool
+
+// ParsePins validates pins and returns them as a set
+func ParsePins(pins []string) (PinSet, error) {
+	set := make(PinSet, len(pins))
+	for _, pin := range pins {
+		hash, ok := strings.CutPrefix(pin, pinPrefix)
+		if !ok {
+			return nil, fmt.Errorf("pin %q: must start with %q", pin, pinPrefix)
+		}
+		sum, err := base64.StdEncoding.DecodeString(hash)
+		if err != nil {
+			return nil, fmt.Errorf("pin %q: %w", pin, err)
+		}
+		if len(sum) != sha256.Size {
+			return nil, fmt.Errorf("pin %q: want a %d-byte SHA-256 hash, got %d bytes", pin, sha256.Size, len(sum))
+		}
+		set[pin] = true
+	}
+	return set, nil
+}
+
+// SPKIPin returns the pin of cert's public key
+func SPKIPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return pinPrefix + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// CheckChain returns ErrPinMismatch unless a certificate in chain is pinned.
+// An empty set accepts every chain.
+func (p PinSet) CheckChain(chain []*x509.Certificate) error {
+	if len(p) == 0 {
+		return nil
+	}
+	for _, cert := range chain {
+		if p[SPKIPin(cert)] {
+			return nil
+		}
+	}
+	return ErrPinMismatch
+}
+
+// VerifyConnection is a tls.Config.VerifyConnection callback accepting the
+// connection when any verified chain passes CheckChain. It relies on
+// standard verification having built cs.VerifiedChains.
+func (p PinSet) VerifyConnection(cs tls.ConnectionState) error {
+	if len(p) == 0 {
+		return nil
+	}
+	for _, chain := range cs.VerifiedChains {
+		if p.CheckChain(chain) == nil {
+			return nil
+		}
+	}
+	return ErrPinMismatch
+}
@@ -0,0 +1,55 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"strings"
+	"testing"
+
+	"tls-agent/pkg/agenttest"
+)
+
+// TestParsePins tests pin format validation
+func TestParsePins(t *testing.T) {
+	valid := "sha256/" + strings.Repeat("A", 43) + "="
+	set, err := ParsePins([]string{valid})
+	if err != nil || !set[valid] {
+		t.Fatalf("ParsePins(%q) = %v, %v", valid, set, err)
+	}
+
+	for _, pin := range []string{
+		strings.Repeat("A", 43) + "=",
+		"sha1/" + strings.Repeat("A", 27) + "=",
+		"sha256/not base64!",
+		"sha256/" + strings.Repeat("A", 24),
+	} {
+		if _, err := ParsePins([]string{pin}); err == nil {
+			t.Errorf("Expected an error for %q", pin)
+		}
+	}
+}
+
+// TestPinSetVerifyConnection tests that a verified chain must contain a
+// pinned key and that an empty set accepts any chain
+func TestPinSetVerifyConnection(t *testing.T) {
+	tmpl := &x509.Certificate{Subject: pkix.Name{CommonName: "localhost"}, DNSNames: []string{"localhost"}}
+	cert := agenttest.SelfSigned(t, tmpl, nil)
+	roots := x509.NewCertPool()
+	roots.AddCert(cert.Leaf)
+	server := &tls.Config{Certificates: []tls.Certificate{*cert}}
+
+	client := func(pins PinSet) *tls.Config {
+		return &tls.Config{RootCAs: roots, ServerName: "localhost", VerifyConnection: pins.VerifyConnection}
+	}
+
+	handshake(t, server, client(nil))
+	handshake(t, server, client(PinSet{SPKIPin(cert.Leaf): true}))
+
+	other := agenttest.SelfSigned(t, tmpl, nil).Leaf
+	err := tryHandshake(server, client(PinSet{SPKIPin(other): true}))
+	if !errors.Is(err, ErrPinMismatch) {
+		t.Errorf("Expected ErrPinMismatch, got %v", err)
+	}
+}
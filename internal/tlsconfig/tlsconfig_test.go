@@ -0,0 +1,164 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+
+	"tls-agent/internal/metrics/metricstest"
+	"tls-agent/pkg/agenttest"
+)
+
+// handshake performs a handshake over an in-memory pipe
+func handshake(t *testing.T, server, client *tls.Config) tls.ConnectionState {
+	t.Helper()
+
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	go func() {
+		_ = tls.Server(serverConn, server).Handshake()
+	}()
+
+	conn := tls.Client(clientConn, client)
+	if err := conn.Handshake(); err != nil {
+		t.Fatalf("Handshake failed: %v", err)
+	}
+	return conn.ConnectionState()
+}
+
+// TestParseCurves tests curve name parsing
+func TestParseCurves(t *testing.T) {
+	curves, err := ParseCurves([]string{"X25519MLKEM768", "x25519", "P-256"})
+	if err != nil {
+		t.Fatalf("ParseCurves failed: %v", err)
+	}
+	want := []tls.CurveID{tls.X25519MLKEM768, tls.X25519, tls.CurveP256}
+	for i := range want {
+		if curves[i] != want[i] {
+			t.Errorf("Curve %d: expected %v, got %v", i, want[i], curves[i])
+		}
+	}
+
+	if _, err := ParseCurves([]string{"brainpool"}); err == nil {
+		t.Error("Unknown curve should be rejected")
+	}
+}
+
+// TestCurvePreferencesToggle tests enabling and disabling post-quantum KEX
+func TestCurvePreferencesToggle(t *testing.T) {
+	curves, err := CurvePreferences(nil, true)
+	if err != nil || curves != nil {
+		t.Errorf("PQ with no explicit curves should use Go defaults, got %v (%v)", curves, err)
+	}
+
+	curves, err = CurvePreferences(nil, false)
+	if err != nil {
+		t.Fatalf("CurvePreferences failed: %v", err)
+	}
+	for _, id := range curves {
+		if IsPostQuantum(id) {
+			t.Errorf("PQ disabled but %v present", id)
+		}
+	}
+
+	curves, err = CurvePreferences([]string{"X25519MLKEM768", "X25519"}, false)
+	if err != nil || len(curves) != 1 || curves[0] != tls.X25519 {
+		t.Errorf("Expected hybrid curve to be stripped, got %v (%v)", curves, err)
+	}
+
+	if _, err := CurvePreferences([]string{"X25519MLKEM768"}, false); err == nil {
+		t.Error("Only hybrid curves with PQ disabled should be rejected")
+	}
+}
+
+// recordedHandshake performs a handshake like handshake, passing the server
+// side through the listener's HandshakeMetrics hook as an http.Server
+// would. It returns the client's view of the connection and the server's
+// handshake error.
+func recordedHandshake(t *testing.T, listener string, server, client *tls.Config) (tls.ConnectionState, error) {
+	t.Helper()
+
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	hook := HandshakeMetrics(listener)
+	serverErr := make(chan error, 1)
+	go func() {
+		conn := tls.Server(serverConn, server)
+		hook(conn, http.StateNew)
+		err := conn.Handshake()
+		if err == nil {
+			hook(conn, http.StateActive)
+			hook(conn, http.StateIdle)
+		}
+		serverConn.Close()
+		hook(conn, http.StateClosed)
+		serverErr <- err
+	}()
+
+	conn := tls.Client(clientConn, client)
+	_ = conn.Handshake()
+	clientConn.Close()
+	return conn.ConnectionState(), <-serverErr
+}
+
+// TestPostQuantumHandshakeMetric tests that PQ handshakes are counted per listener
+func TestPostQuantumHandshakeMetric(t *testing.T) {
+	server := &tls.Config{Certificates: []tls.Certificate{*agenttest.NewCA(t).IssueTLS(t, "localhost")}}
+	if err := ApplyCurves(server, "pq-test", []string{"X25519MLKEM768", "X25519"}, true); err != nil {
+		t.Fatalf("ApplyCurves failed: %v", err)
+	}
+	pq := metricstest.Delta(pqHandshakes.With("pq-test"))
+
+	client := &tls.Config{InsecureSkipVerify: true, CurvePreferences: []tls.CurveID{tls.X25519MLKEM768}}
+	cs, err := recordedHandshake(t, "pq-test", server, client)
+	if err != nil {
+		t.Fatalf("Handshake failed: %v", err)
+	}
+	if cs.CurveID != tls.X25519MLKEM768 {
+		t.Fatalf("Expected X25519MLKEM768, got %v", cs.CurveID)
+	}
+	if got := pq(); got != 1 {
+		t.Errorf("Expected 1 PQ handshake, got %d", got)
+	}
+
+	// Disabling PQ on the listener falls back to a classical exchange
+	classical := &tls.Config{Certificates: []tls.Certificate{*agenttest.NewCA(t).IssueTLS(t, "localhost")}}
+	if err := ApplyCurves(classical, "classic-test", nil, false); err != nil {
+		t.Fatalf("ApplyCurves failed: %v", err)
+	}
+	classicalPQ := metricstest.Delta(pqHandshakes.With("classic-test"))
+	x25519 := metricstest.Delta(handshakesByCurve.With("classic-test", tls.X25519.String()))
+	cs, err = recordedHandshake(t, "classic-test", classical, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("Handshake failed: %v", err)
+	}
+	if IsPostQuantum(cs.CurveID) {
+		t.Errorf("Expected classical key exchange, got %v", cs.CurveID)
+	}
+	if got := classicalPQ(); got != 0 {
+		t.Errorf("Expected 0 PQ handshakes, got %d", got)
+	}
+	if cs.CurveID != tls.X25519 {
+		t.Fatalf("Expected the listener's preferred X25519, got %v", cs.CurveID)
+	}
+	if got := x25519(); got != 1 {
+		t.Errorf("Expected 1 classical handshake, got %d", got)
+	}
+
+	// A handshake that fails after the server has verified the client is
+	// not counted
+	server.ClientAuth = tls.RequireAnyClientCert
+	server.VerifyConnection = func(tls.ConnectionState) error { return errors.New("refused") }
+	if _, err := recordedHandshake(t, "pq-test", server, client); err == nil {
+		t.Fatal("Expected the handshake to fail")
+	}
+	if got := pq(); got != 1 {
+		t.Errorf("Expected the failed handshake not to be counted, got %d", got)
+	}
+}
@@ -0,0 +1,148 @@
+package tlsstore
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"tls-agent/internal/clock"
+	"tls-agent/internal/fetchcache"
+	"tls-agent/internal/storage"
+)
+
+// maxChainDepth bounds how many intermediates are chased for one leaf
+const maxChainDepth = 5
+
+// ChainCompleter fetches missing intermediates via the AIA CA Issuers URL
+type ChainCompleter struct {
+	// Client performs AIA fetches; defaults to a client with a 10s timeout
+	Client *http.Client
+
+	// CacheDir, if set, persists fetched intermediates across restarts
+	CacheDir string
+
+	// Storage, if set, persists fetched intermediates instead of CacheDir
+	Storage storage.Storage
+
+	// Clock schedules revalidation; defaults to the wall clock. Set it
+	// before the first load.
+	Clock clock.Clock
+
+	once  sync.Once
+	cache *fetchcache.Cache
+}
+
+// NewChainCompleter creates a completer caching intermediates in cacheDir
+func NewChainCompleter(cacheDir string) *ChainCompleter {
+	return &ChainCompleter{CacheDir: cacheDir}
+}
+
+// Wrap returns a loader that completes the chain of every certificate load produces
+func (c *ChainCompleter) Wrap(load func(certFile, keyFile string) (*tls.Certificate, error)) func(certFile, keyFile string) (*tls.Certificate, error) {
+	return func(certFile, keyFile string) (*tls.Certificate, error) {
+		cert, err := load(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.Complete(cert); err != nil {
+			// An incomplete chain still works for lenient clients, so serve it
+			log.Printf("Warning: could not complete chain for %s: %v", certFile, err)
+		}
+		return cert, nil
+	}
+}
+
+// Complete appends missing intermediates to cert.Certificate. Chains that
+// already contain intermediates, or self-signed leaves, are left untouched.
+func (c *ChainCompleter) Complete(cert *tls.Certificate) error {
+	if cert == nil || len(cert.Certificate) != 1 {
+		return nil
+	}
+
+	current, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return err
+	}
+
+	var chain [][]byte
+	for depth := 0; depth < maxChainDepth; depth++ {
+		if isSelfSigned(current) {
+			break
+		}
+		if len(current.IssuingCertificateURL) == 0 {
+			if depth == 0 {
+				return errors.New("leaf has no AIA CA Issuers URL")
+			}
+			break
+		}
+
+		issuer, err := c.fetch(current.IssuingCertificateURL)
+		if err != nil {
+			return err
+		}
+		if err := current.CheckSignatureFrom(issuer); err != nil {
+			return fmt.Errorf("AIA issuer does not sign %q: %w", current.Subject.CommonName, err)
+		}
+		// Roots are not sent on the wire
+		if isSelfSigned(issuer) {
+			break
+		}
+
+		chain = append(chain, issuer.Raw)
+		current = issuer
+	}
+
+	cert.Certificate = append(cert.Certificate, chain...)
+	return nil
+}
+
+func (c *ChainCompleter) fetch(urls []string) (*x509.Certificate, error) {
+	var lastErr error
+	for _, u := range urls {
+		item, err := c.fetchCache().Get("aia:"+u, fetchcache.GetURL(c.Client, u, 1<<20), decodeIssuer(clock.Or(c.fetchCache().Clock)))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return item.Value.(*x509.Certificate), nil
+	}
+	return nil, fmt.Errorf("AIA fetch failed: %w", lastErr)
+}
+
+func (c *ChainCompleter) fetchCache() *fetchcache.Cache {
+	c.once.Do(func() {
+		c.cache = fetchcache.New(c.CacheDir)
+		c.cache.Storage = c.Storage
+		c.cache.Clock = c.Clock
+	})
+	return c.cache
+}
+
+// decodeIssuer accepts DER (the common AIA format) or PEM. Intermediates
+// change rarely, so they are revalidated daily on c and dropped at expiry.
+func decodeIssuer(c clock.Clock) fetchcache.Decoder {
+	return func(data []byte) (any, fetchcache.Validity, error) {
+		if block, _ := pem.Decode(data); block != nil {
+			data = block.Bytes
+		}
+		cert, err := x509.ParseCertificate(data)
+		if err != nil {
+			return nil, fetchcache.Validity{}, err
+		}
+		return cert, fetchcache.Validity{
+			RefreshAt: c.Now().Add(24 * time.Hour),
+			ExpiresAt: cert.NotAfter,
+		}, nil
+	}
+}
+
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignatureFrom(cert) == nil
+}
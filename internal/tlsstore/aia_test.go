@@ -0,0 +1,118 @@
+package tlsstore
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestChainCompleter tests fetching a missing intermediate via AIA
+func TestChainCompleter(t *testing.T) {
+	root := newTestCA(t, "Test Root")
+
+	// Intermediate signed by the root
+	intKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	intTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "Test Intermediate"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	intDER, err := x509.CreateCertificate(rand.Reader, intTmpl, root.cert, intKey.Public(), root.key)
+	if err != nil {
+		t.Fatalf("Failed to create intermediate: %v", err)
+	}
+	intCert, _ := x509.ParseCertificate(intDER)
+
+	var fetches atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		switch r.URL.Path {
+		case "/int.cer":
+			w.Write(intDER)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	leafKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	leafTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(3),
+		Subject:               pkix.Name{CommonName: "leaf.example.com"},
+		DNSNames:              []string{"leaf.example.com"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IssuingCertificateURL: []string{srv.URL + "/int.cer"},
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTmpl, intCert, leafKey.Public(), intKey)
+	if err != nil {
+		t.Fatalf("Failed to create leaf: %v", err)
+	}
+
+	cacheDir := filepath.Join(t.TempDir(), "aia")
+	completer := NewChainCompleter(cacheDir)
+
+	cert := &tls.Certificate{Certificate: [][]byte{leafDER}, PrivateKey: leafKey}
+	if err := completer.Complete(cert); err != nil {
+		t.Fatalf("Complete failed: %v", err)
+	}
+	if len(cert.Certificate) != 2 {
+		t.Fatalf("Expected leaf + intermediate, got %d certificates", len(cert.Certificate))
+	}
+
+	// The completed chain must verify against the root alone
+	roots := x509.NewCertPool()
+	roots.AddCert(root.cert)
+	inters := x509.NewCertPool()
+	parsedInt, _ := x509.ParseCertificate(cert.Certificate[1])
+	inters.AddCert(parsedInt)
+	leaf, _ := x509.ParseCertificate(cert.Certificate[0])
+	if _, err := leaf.Verify(x509.VerifyOptions{Roots: roots, Intermediates: inters, DNSName: "leaf.example.com"}); err != nil {
+		t.Errorf("Completed chain does not verify: %v", err)
+	}
+
+	// A fresh completer is served from the on-disk cache
+	entries, _ := os.ReadDir(cacheDir)
+	if len(entries) != 1 {
+		t.Errorf("Expected 1 cached intermediate, got %d", len(entries))
+	}
+	srv.Close()
+	again := &tls.Certificate{Certificate: [][]byte{leafDER}, PrivateKey: leafKey}
+	if err := NewChainCompleter(cacheDir).Complete(again); err != nil || len(again.Certificate) != 2 {
+		t.Errorf("Expected cached completion, got %d certificates (%v)", len(again.Certificate), err)
+	}
+	if fetches.Load() != 1 {
+		t.Errorf("Expected a single network fetch, got %d", fetches.Load())
+	}
+}
+
+// TestChainCompleterSkipsCompleteChains tests that full chains and self-signed certs are untouched
+func TestChainCompleterSkipsCompleteChains(t *testing.T) {
+	ca := newTestCA(t, "Self Signed")
+	self := &tls.Certificate{Certificate: [][]byte{ca.cert.Raw}}
+
+	completer := NewChainCompleter("")
+	if err := completer.Complete(self); err != nil || len(self.Certificate) != 1 {
+		t.Errorf("Self-signed certificate should be untouched (%v)", err)
+	}
+
+	chain := &tls.Certificate{Certificate: [][]byte{ca.cert.Raw, ca.cert.Raw}}
+	if err := completer.Complete(chain); err != nil || len(chain.Certificate) != 2 {
+		t.Errorf("Existing chain should be untouched (%v)", err)
+	}
+}
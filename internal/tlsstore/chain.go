@@ -0,0 +1,66 @@
+package tlsstore
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+)
+
+// ErrChainMismatch is returned (wrapped) when a chain file does not contain
+// the issuer of the leaf it is composed with
+var ErrChainMismatch = errors.New("chain does not issue the certificate")
+
+// ComposeChain returns cert served with the intermediates in chainFile in
+// place of any in its own file, so a CA re-issuing intermediates is picked
+// up without a new leaf. The chain file may list its certificates in any
+// order and may include the root. cert is not modified.
+func ComposeChain(cert *tls.Certificate, chainFile string) (*tls.Certificate, error) {
+	data, err := readFile("read chain", chainFile)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := ParseChain(data)
+	if err != nil {
+		return nil, &LoadError{Op: "parse chain", Path: chainFile, Err: err}
+	}
+	leaf, err := ParseLeaf(cert)
+	if err != nil {
+		return nil, &LoadError{Op: "parse certificate", Path: chainFile, Err: err}
+	}
+
+	chain := orderChain(leaf, pool)
+	if leaf.CheckSignatureFrom(chain[1]) != nil {
+		return nil, &LoadError{Op: "compose chain", Path: chainFile, Kind: ErrChainMismatch,
+			Err: fmt.Errorf("no certificate in the chain issued %q", leaf.Subject.CommonName)}
+	}
+
+	composed := *cert
+	composed.Leaf = leaf
+	composed.Certificate = make([][]byte, len(chain))
+	composed.Certificate[0] = cert.Certificate[0]
+	for i, c := range chain[1:] {
+		composed.Certificate[i+1] = c.Raw
+	}
+	return &composed, nil
+}
+
+// WithChains wraps load so that pairs whose certificate file is a key of
+// chains are composed with the chain file it names. Wrap chain completion
+// around the result, so intermediates are only fetched when no chain file
+// supplies them.
+func WithChains(load func(certFile, keyFile string) (*tls.Certificate, error), chains map[string]string) func(certFile, keyFile string) (*tls.Certificate, error) {
+	if len(chains) == 0 {
+		return load
+	}
+	return func(certFile, keyFile string) (*tls.Certificate, error) {
+		cert, err := load(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		chainFile := chains[certFile]
+		if chainFile == "" {
+			return cert, nil
+		}
+		return ComposeChain(cert, chainFile)
+	}
+}
@@ -0,0 +1,75 @@
+package tlsstore
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// reissue returns inter re-signed by root with its subject and key kept, as
+// a CA does when it re-issues an intermediate
+func reissue(t *testing.T, root, inter *testCA) *testCA {
+	t.Helper()
+
+	tmpl := *inter.cert
+	tmpl.SerialNumber = big.NewInt(time.Now().UnixNano())
+	tmpl.NotAfter = time.Now().Add(48 * time.Hour)
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, root.cert, inter.key.Public(), root.key)
+	if err != nil {
+		t.Fatalf("Failed to re-issue intermediate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: inter.key}
+}
+
+// TestComposeChain tests serving a leaf with the intermediates of a separate
+// chain file as that file is rotated
+func TestComposeChain(t *testing.T) {
+	root := newTestCA(t, "Test Root")
+	inter := root.intermediate(t, "Test Intermediate")
+	issued := inter.issue(t, "chain.example.com")
+
+	dir := t.TempDir()
+	certFile, keyFile, chainFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), filepath.Join(dir, "chain.pem")
+	writeFile(t, certFile, certPEM(issued.Certificate[0]), 0644)
+	writeFile(t, keyFile, keyPEM(t, issued.PrivateKey), 0600)
+
+	// Root first: the chain is ordered from the leaf
+	writeFile(t, chainFile, append(certPEM(root.cert.Raw), certPEM(inter.cert.Raw)...), 0644)
+	load := WithChains(Load, map[string]string{certFile: chainFile})
+	cert, err := load(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Load with chain failed: %v", err)
+	}
+	if len(cert.Certificate) != 3 || !bytes.Equal(cert.Certificate[1], inter.cert.Raw) || !bytes.Equal(cert.Certificate[2], root.cert.Raw) {
+		t.Fatalf("Unexpected chain of %d certificates", len(cert.Certificate))
+	}
+
+	// The CA re-issues the intermediate; the leaf and key stay
+	reissued := reissue(t, root, inter)
+	writeFile(t, chainFile, certPEM(reissued.cert.Raw), 0644)
+	cert, err = load(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Load with re-issued chain failed: %v", err)
+	}
+	if len(cert.Certificate) != 2 || !bytes.Equal(cert.Certificate[1], reissued.cert.Raw) || !cert.Leaf.Equal(issued.Leaf) {
+		t.Error("Expected the existing leaf served with the re-issued intermediate")
+	}
+
+	// A chain from another CA is refused rather than served broken
+	other := newTestCA(t, "Other Root")
+	writeFile(t, chainFile, certPEM(other.cert.Raw), 0644)
+	if _, err := load(certFile, keyFile); !errors.Is(err, ErrChainMismatch) {
+		t.Errorf("Expected ErrChainMismatch, got %v", err)
+	}
+
+	// Pairs without a chain file load as before
+	if cert, err := WithChains(Load, map[string]string{"other.crt": chainFile})(certFile, keyFile); err != nil || len(cert.Certificate) != 1 {
+		t.Errorf("Expected the pair unchanged, got %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package tlsstore
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+)
+
+// Server verification modes for ClientTLSConfig, named after libpq's sslmode
+// so they map directly onto database connection strings
+const (
+	// VerifyFull checks the chain and that the certificate names the server
+	VerifyFull = "verify-full"
+
+	// VerifyCA checks the chain only, for servers reached by an address
+	// their certificate does not name
+	VerifyCA = "verify-ca"
+
+	// VerifyNone encrypts without authenticating the server
+	VerifyNone = "require"
+)
+
+// ClientOptions configure ClientTLSConfig
+type ClientOptions struct {
+	// Certificate is presented when the server asks for one; nil presents
+	// none
+	Certificate CertificateProvider
+
+	// Roots verify the server; nil uses the system roots
+	Roots *RootCAStore
+
+	// Verify is VerifyFull (the default), VerifyCA or VerifyNone
+	Verify string
+
+	// ServerName is the name verified under VerifyFull and sent as SNI.
+	// Empty leaves it to the driver, which usually sets the host it dials.
+	ServerName string
+}
+
+// ClientTLSConfig returns a tls.Config for database drivers and other
+// libraries that take one and keep it for the life of the process, such as
+// pgx connectors or mysql.RegisterTLSConfig. The config never changes: the
+// client certificate is read from the store on every handshake and the
+// server is verified against the roots' current bundle, so both rotate
+// without re-registering anything. Pooled connections keep the credentials
+// they were established with until the driver recycles them.
+func ClientTLSConfig(opts ClientOptions) (*tls.Config, error) {
+	switch opts.Verify {
+	case "":
+		opts.Verify = VerifyFull
+	case VerifyFull, VerifyCA, VerifyNone:
+	default:
+		return nil, fmt.Errorf("tlsstore: unknown verify mode %q", opts.Verify)
+	}
+
+	cfg := &tls.Config{
+		ServerName: opts.ServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+	if opts.Certificate != nil {
+		store := opts.Certificate
+		cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return store.GetCertificate(nil)
+		}
+	}
+
+	// Standard verification would fix the roots at creation time and
+	// always check the host name, so both are done in VerifyConnection
+	cfg.InsecureSkipVerify = true
+	mode, roots := opts.Verify, opts.Roots
+	cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+		if mode == VerifyNone {
+			return nil
+		}
+		dnsName := ""
+		if mode == VerifyFull {
+			if cs.ServerName == "" {
+				return errors.New("tlsstore: verify-full needs a server name; set ServerName or dial by host name")
+			}
+			dnsName = cs.ServerName
+		}
+		return verifyServer(roots, cs.PeerCertificates, dnsName)
+	}
+	return cfg, nil
+}
+
+// verifyServer verifies a server chain against roots, or the system roots
+// when roots is nil, applying the roots' chain check
+func verifyServer(roots *RootCAStore, certs []*x509.Certificate, dnsName string) error {
+	if len(certs) == 0 {
+		return errors.New("no peer certificates presented")
+	}
+	if roots != nil {
+		raw := make([][]byte, len(certs))
+		for i, c := range certs {
+			raw[i] = c.Raw
+		}
+		return roots.checkChains(roots.verify(raw, dnsName, x509.ExtKeyUsageServerAuth))
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range certs[1:] {
+		intermediates.AddCert(c)
+	}
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		Intermediates: intermediates,
+		DNSName:       dnsName,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	return err
+}
@@ -0,0 +1,130 @@
+package tlsstore
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+// TestClientTLSConfig tests that one config follows client certificate and
+// CA rotations, and the verify modes' host name handling
+func TestClientTLSConfig(t *testing.T) {
+	ca := newTestCA(t, "Test Root")
+	other := newTestCA(t, "Other Root")
+
+	var presented atomic.Value
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{*ca.issue(t, "db.example.com")},
+		ClientAuth:   tls.RequireAnyClientCert,
+		VerifyPeerCertificate: func(raw [][]byte, _ [][]*x509.Certificate) error {
+			cert, err := x509.ParseCertificate(raw[0])
+			if err == nil {
+				presented.Store(cert.Subject.CommonName)
+			}
+			return err
+		},
+	})
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_ = conn.(*tls.Conn).Handshake()
+				conn.Close()
+			}()
+		}
+	}()
+
+	dial := func(cfg *tls.Config, serverName string) error {
+		if serverName != "" {
+			// Drivers set the host they dial on a copy of the config
+			cfg = cfg.Clone()
+			cfg.ServerName = serverName
+		}
+		conn, err := tls.Dial("tcp", ln.Addr().String(), cfg)
+		if err != nil {
+			return err
+		}
+		// Wait for the server to finish its side of a TLS 1.3 handshake
+		_, _ = conn.Read(make([]byte, 1))
+		return conn.Close()
+	}
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	writeFile(t, bundle, certPEM(other.cert.Raw), 0644)
+	roots, err := NewRootCAStore(bundle)
+	if err != nil {
+		t.Fatalf("NewRootCAStore failed: %v", err)
+	}
+	store := New(ca.issue(t, "client-1"))
+
+	cfg, err := ClientTLSConfig(ClientOptions{Certificate: store, Roots: roots})
+	if err != nil {
+		t.Fatalf("ClientTLSConfig failed: %v", err)
+	}
+	if err := dial(cfg, "db.example.com"); err == nil {
+		t.Fatal("Server signed by an untrusted CA should be rejected")
+	}
+
+	writeFile(t, bundle, certPEM(ca.cert.Raw), 0644)
+	if err := roots.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if err := dial(cfg, "db.example.com"); err != nil {
+		t.Fatalf("Handshake after CA rotation failed: %v", err)
+	}
+	if got := presented.Load(); got != "client-1" {
+		t.Errorf("Server saw %v, want client-1", got)
+	}
+
+	store.Update(ca.issue(t, "client-2"))
+	if err := dial(cfg, "db.example.com"); err != nil {
+		t.Fatalf("Handshake after certificate rotation failed: %v", err)
+	}
+	if got := presented.Load(); got != "client-2" {
+		t.Errorf("Server saw %v, want client-2", got)
+	}
+
+	// verify-full checks the name, and needs one
+	if err := dial(cfg, "other.example.com"); err == nil {
+		t.Error("verify-full should reject a certificate for another name")
+	}
+	if err := dial(cfg, ""); err == nil {
+		t.Error("verify-full without a server name should fail")
+	}
+
+	verifyCA, err := ClientTLSConfig(ClientOptions{Certificate: store, Roots: roots, Verify: VerifyCA})
+	if err != nil {
+		t.Fatalf("ClientTLSConfig failed: %v", err)
+	}
+	if err := dial(verifyCA, "10.0.0.5"); err != nil {
+		t.Errorf("verify-ca should not check the name: %v", err)
+	}
+
+	writeFile(t, bundle, certPEM(other.cert.Raw), 0644)
+	if err := roots.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if err := dial(verifyCA, ""); err == nil {
+		t.Error("verify-ca should still check the chain")
+	}
+	require, err := ClientTLSConfig(ClientOptions{Certificate: store, Verify: VerifyNone})
+	if err != nil {
+		t.Fatalf("ClientTLSConfig failed: %v", err)
+	}
+	if err := dial(require, ""); err != nil {
+		t.Errorf("require should not verify the server: %v", err)
+	}
+
+	if _, err := ClientTLSConfig(ClientOptions{Verify: "verify-some"}); err == nil {
+		t.Error("Expected an error for an unknown verify mode")
+	}
+}
@@ -0,0 +1,136 @@
+package tlsstore
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"strings"
+)
+
+// IsCombined reports whether a pair names a combined PEM file: the key file
+// is omitted or the same as the certificate file
+func IsCombined(certFile, keyFile string) bool {
+	return keyFile == "" || keyFile == certFile
+}
+
+// LoadCombined reads a single PEM file holding the private key, the leaf
+// and its intermediates in any order, as produced by HAProxy-style
+// deployments. The key permission policy applies to the file.
+func LoadCombined(path string) (*tls.Certificate, error) {
+	if err := enforcePermissions(path); err != nil {
+		return nil, &LoadError{Op: "check key", Path: path, Kind: ErrInsecureKeyFile, Err: err}
+	}
+	data, err := readFile("read combined file", path)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(data)
+
+	cert, err := parseCombined(data, path)
+	if err != nil {
+		return nil, err
+	}
+	AuditKey("loaded", path)
+	return cert, nil
+}
+
+// ParseCombined is LoadCombined for data held in memory
+func ParseCombined(data []byte) (*tls.Certificate, error) {
+	cert, err := parseCombined(data, memoryPath)
+	if err != nil {
+		return nil, err
+	}
+	AuditKey("loaded", memoryPath)
+	return cert, nil
+}
+
+// parseCombined splits data into its key and certificate blocks, orders the
+// certificates leaf first with each followed by its issuer, and parses the
+// result as a pair
+func parseCombined(data []byte, path string) (*tls.Certificate, error) {
+	if decoded, ok := unwrapBase64(data); ok {
+		defer clear(decoded)
+		data = decoded
+	}
+	if err := checkPEM(data); err != nil {
+		return nil, &LoadError{Op: "parse combined file", Path: path, Err: err}
+	}
+	var keyPEM []byte
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		switch {
+		case block.Type == "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, &LoadError{Op: "parse certificate", Path: path, Err: err}
+			}
+			certs = append(certs, cert)
+		case strings.HasSuffix(block.Type, "PRIVATE KEY"):
+			if keyPEM != nil {
+				return nil, &LoadError{Op: "parse combined file", Path: path, Err: errors.New("more than one private key")}
+			}
+			keyPEM = pem.EncodeToMemory(block)
+		}
+	}
+	if keyPEM == nil {
+		return nil, &LoadError{Op: "parse combined file", Path: path, Kind: ErrCertNotFound, Err: errors.New("no private key")}
+	}
+	defer clear(keyPEM)
+	if len(certs) == 0 {
+		return nil, &LoadError{Op: "parse combined file", Path: path, Kind: ErrCertNotFound, Err: errors.New("no certificates")}
+	}
+
+	// The leaf is the certificate matching the key, wherever it appears
+	for i, cert := range certs {
+		if _, err := tls.X509KeyPair(certPEMBlocks(certs[i:i+1]), keyPEM); err != nil {
+			continue
+		}
+		rest := append(append([]*x509.Certificate{}, certs[:i]...), certs[i+1:]...)
+		return parsePair(certPEMBlocks(orderChain(cert, rest)), keyPEM, path)
+	}
+	return nil, &LoadError{Op: "parse combined file", Path: path, Kind: ErrKeyMismatch, Err: errors.New("no certificate matches the private key")}
+}
+
+// orderChain returns leaf followed by its issuers from pool, each issuer
+// after the certificate it signed. Certificates outside the chain are
+// appended in their original order.
+func orderChain(leaf *x509.Certificate, pool []*x509.Certificate) []*x509.Certificate {
+	chain := []*x509.Certificate{leaf}
+	used := make([]bool, len(pool))
+	for current := leaf; ; {
+		next := -1
+		for i, cert := range pool {
+			if !used[i] && bytes.Equal(current.RawIssuer, cert.RawSubject) && current.CheckSignatureFrom(cert) == nil {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			break
+		}
+		used[next] = true
+		chain = append(chain, pool[next])
+		current = pool[next]
+	}
+	for i, cert := range pool {
+		if !used[i] {
+			chain = append(chain, cert)
+		}
+	}
+	return chain
+}
+
+func certPEMBlocks(certs []*x509.Certificate) []byte {
+	var out []byte
+	for _, cert := range certs {
+		out = append(out, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	return out
+}
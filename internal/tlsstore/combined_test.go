@@ -0,0 +1,69 @@
+package tlsstore
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// TestLoadCombined tests that a combined file is split and ordered leaf
+// first, then issuers, whatever order its blocks are in
+func TestLoadCombined(t *testing.T) {
+	root := newTestCA(t, "Test Root")
+	inter := root.intermediate(t, "Test Intermediate")
+	issued := inter.issue(t, "combined.example.com")
+	privPEM := keyPEM(t, issued.PrivateKey)
+
+	// Intermediate, root, key, then leaf
+	var data []byte
+	data = append(data, certPEM(inter.cert.Raw)...)
+	data = append(data, certPEM(root.cert.Raw)...)
+	data = append(data, privPEM...)
+	data = append(data, certPEM(issued.Certificate[0])...)
+
+	path := filepath.Join(t.TempDir(), "combined.pem")
+	writeFile(t, path, data, 0600)
+	for name, load := range map[string]func() (*tls.Certificate, error){
+		"LoadCombined":  func() (*tls.Certificate, error) { return LoadCombined(path) },
+		"Load":          func() (*tls.Certificate, error) { return Load(path, "") },
+		"Load same":     func() (*tls.Certificate, error) { return Load(path, path) },
+		"ParseCombined": func() (*tls.Certificate, error) { return ParseCombined(data) },
+	} {
+		cert, err := load()
+		if err != nil {
+			t.Fatalf("%s failed: %v", name, err)
+		}
+		want := [][]byte{issued.Certificate[0], inter.cert.Raw, root.cert.Raw}
+		if len(cert.Certificate) != len(want) {
+			t.Fatalf("%s: got %d certificates, want %d", name, len(cert.Certificate), len(want))
+		}
+		for i := range want {
+			if !bytes.Equal(cert.Certificate[i], want[i]) {
+				t.Errorf("%s: certificate %d out of order", name, i)
+			}
+		}
+		if cert.Leaf == nil || cert.Leaf.Subject.CommonName != "combined.example.com" {
+			t.Errorf("%s: unexpected leaf %v", name, cert.Leaf)
+		}
+	}
+
+	other := inter.issue(t, "other.example.com")
+	for name, tc := range map[string]struct {
+		data []byte
+		want error
+	}{
+		"no key":   {certPEM(issued.Certificate[0]), ErrCertNotFound},
+		"no cert":  {privPEM, ErrCertNotFound},
+		"no match": {append(certPEM(other.Certificate[0]), privPEM...), ErrKeyMismatch},
+		"two keys": {append(append(certPEM(issued.Certificate[0]), privPEM...), privPEM...), nil},
+	} {
+		_, err := ParseCombined(tc.data)
+		if err == nil {
+			t.Errorf("%s: expected an error", name)
+		} else if tc.want != nil && !errors.Is(err, tc.want) {
+			t.Errorf("%s: got %v, want %v", name, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package tlsstore
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"tls-agent/internal/clock"
+	"tls-agent/internal/fetchcache"
+	"tls-agent/internal/metrics"
+	"tls-agent/internal/storage"
+)
+
+var (
+	crlAge = metrics.NewGauge("tls_agent_crl_age_seconds",
+		"Age of the oldest cached CRL")
+	revokedRejections = metrics.NewCounter("tls_agent_revoked_client_rejections_total",
+		"Client handshakes rejected because a certificate was revoked")
+)
+
+// ErrRevoked is returned when a presented certificate appears on its issuer's CRL
+var ErrRevoked = errors.New("certificate has been revoked")
+
+// crlEntry is a parsed CRL with its revoked serial index
+type crlEntry struct {
+	list    *x509.RevocationList
+	revoked map[string]struct{}
+}
+
+// CRLChecker downloads CRLs from certificate distribution points, keeps them
+// refreshed, and rejects revoked client certificates
+type CRLChecker struct {
+	// Client performs CRL fetches; defaults to a client with a 10s timeout
+	Client *http.Client
+
+	// CacheDir, if set, persists downloaded CRLs across restarts
+	CacheDir string
+
+	// Storage, if set, persists downloaded CRLs instead of CacheDir
+	Storage storage.Storage
+
+	// HardFail rejects certificates whose CRL cannot be obtained. By default
+	// such certificates are accepted and a warning is logged.
+	HardFail bool
+
+	// Clock judges CRL age and refresh points; defaults to the wall clock.
+	// Set it before the first check.
+	Clock clock.Clock
+
+	once  sync.Once
+	cache *fetchcache.Cache
+
+	mu     sync.Mutex
+	issuer map[string]*x509.Certificate
+}
+
+// NewCRLChecker creates a checker caching CRLs in cacheDir
+func NewCRLChecker(cacheDir string, hardFail bool) *CRLChecker {
+	return &CRLChecker{CacheDir: cacheDir, HardFail: hardFail}
+}
+
+// CheckChain checks every non-root certificate of a verified chain against
+// the CRLs named in its distribution points
+func (c *CRLChecker) CheckChain(chain []*x509.Certificate) error {
+	for i := 0; i+1 < len(chain); i++ {
+		cert, issuer := chain[i], chain[i+1]
+		if len(cert.CRLDistributionPoints) == 0 {
+			continue
+		}
+
+		entry, err := c.crlFor(cert.CRLDistributionPoints, issuer)
+		if err != nil {
+			if c.HardFail {
+				return fmt.Errorf("revocation status of %q unknown: %w", cert.Subject.CommonName, err)
+			}
+			log.Printf("Warning: CRL check skipped for %q: %v", cert.Subject.CommonName, err)
+			continue
+		}
+		if _, revoked := entry.revoked[cert.SerialNumber.String()]; revoked {
+			revokedRejections.Inc()
+			return fmt.Errorf("%w: %q (serial %s)", ErrRevoked, cert.Subject.CommonName, cert.SerialNumber)
+		}
+	}
+	return nil
+}
+
+// Refresh re-downloads every known CRL older than maxAge. CRLs past their
+// refresh point are also revalidated on use.
+func (c *CRLChecker) Refresh(maxAge time.Duration) {
+	c.mu.Lock()
+	known := make(map[string]*x509.Certificate, len(c.issuer))
+	for url, issuer := range c.issuer {
+		known[url] = issuer
+	}
+	c.mu.Unlock()
+
+	for url, issuer := range known {
+		if item := c.fetchCache().Peek(crlKey(url)); item != nil && c.now().Sub(item.Fetched) <= maxAge {
+			continue
+		}
+		if _, err := c.fetchCache().Refresh(crlKey(url), c.fetcher(url), decodeCRL(issuer, c.now)); err != nil {
+			log.Printf("CRL: refresh of %s failed: %v", url, err)
+		}
+	}
+	c.updateAge()
+}
+
+// Run refreshes cached CRLs every interval until stopChan is closed
+func (c *CRLChecker) Run(interval time.Duration, stopChan <-chan struct{}) {
+	ticker := clock.Or(c.Clock).NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			c.Refresh(interval)
+		case <-stopChan:
+			return
+		}
+	}
+}
+
+func (c *CRLChecker) crlFor(urls []string, issuer *x509.Certificate) (*crlEntry, error) {
+	var lastErr error
+	for _, url := range urls {
+		item, err := c.fetchCache().Get(crlKey(url), c.fetcher(url), decodeCRL(issuer, c.now))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		c.mu.Lock()
+		if c.issuer == nil {
+			c.issuer = make(map[string]*x509.Certificate)
+		}
+		c.issuer[url] = issuer
+		c.mu.Unlock()
+
+		c.updateAge()
+		return item.Value.(*crlEntry), nil
+	}
+	return nil, fmt.Errorf("CRL fetch failed: %w", lastErr)
+}
+
+func (c *CRLChecker) fetchCache() *fetchcache.Cache {
+	c.once.Do(func() {
+		c.cache = fetchcache.New(c.CacheDir)
+		c.cache.Storage = c.Storage
+		c.cache.Clock = c.Clock
+	})
+	return c.cache
+}
+
+// now is the current time on the fetch cache's clock
+func (c *CRLChecker) now() time.Time {
+	return clock.Or(c.fetchCache().Clock).Now()
+}
+
+func (c *CRLChecker) fetcher(url string) fetchcache.Fetcher {
+	return fetchcache.GetURL(c.Client, url, 32<<20)
+}
+
+func crlKey(url string) string {
+	return "crl:" + url
+}
+
+// decodeCRL accepts DER or PEM and verifies the list was signed by issuer.
+// The CRL is refreshed halfway to NextUpdate and unusable after it; one
+// without a NextUpdate is refreshed an hour after now.
+func decodeCRL(issuer *x509.Certificate, now func() time.Time) fetchcache.Decoder {
+	return func(data []byte) (any, fetchcache.Validity, error) {
+		if block, _ := pem.Decode(data); block != nil {
+			data = block.Bytes
+		}
+		list, err := x509.ParseRevocationList(data)
+		if err != nil {
+			return nil, fetchcache.Validity{}, err
+		}
+		if err := list.CheckSignatureFrom(issuer); err != nil {
+			return nil, fetchcache.Validity{}, fmt.Errorf("CRL not signed by %q: %w", issuer.Subject.CommonName, err)
+		}
+
+		revoked := make(map[string]struct{}, len(list.RevokedCertificateEntries))
+		for _, r := range list.RevokedCertificateEntries {
+			revoked[r.SerialNumber.String()] = struct{}{}
+		}
+
+		validity := fetchcache.Validity{RefreshAt: now().Add(time.Hour)}
+		if !list.NextUpdate.IsZero() {
+			validity.RefreshAt = list.ThisUpdate.Add(list.NextUpdate.Sub(list.ThisUpdate) / 2)
+			validity.ExpiresAt = list.NextUpdate
+		}
+		return &crlEntry{list: list, revoked: revoked}, validity, nil
+	}
+}
+
+// updateAge publishes the age of the oldest cached CRL
+func (c *CRLChecker) updateAge() {
+	c.mu.Lock()
+	urls := make([]string, 0, len(c.issuer))
+	for url := range c.issuer {
+		urls = append(urls, url)
+	}
+	c.mu.Unlock()
+
+	var oldest time.Duration
+	for _, url := range urls {
+		if item := c.fetchCache().Peek(crlKey(url)); item != nil {
+			oldest = max(oldest, c.now().Sub(item.Fetched))
+		}
+	}
+	crlAge.Set(oldest.Seconds())
+}
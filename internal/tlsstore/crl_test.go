@@ -0,0 +1,198 @@
+package tlsstore
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"tls-agent/internal/clock"
+)
+
+// issueWithCDP creates a client certificate pointing at the given CRL URL
+func (ca *testCA) issueWithCDP(t *testing.T, serial int64, crlURL string) *x509.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate leaf key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: "client"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		CRLDistributionPoints: []string{crlURL},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, key.Public(), ca.key)
+	if err != nil {
+		t.Fatalf("Failed to issue certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return cert
+}
+
+// crl signs a CRL revoking the given serials
+func (ca *testCA) crl(t *testing.T, serials ...int64) []byte {
+	t.Helper()
+
+	var entries []x509.RevocationListEntry
+	for _, s := range serials {
+		entries = append(entries, x509.RevocationListEntry{SerialNumber: big.NewInt(s), RevocationTime: time.Now()})
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:                    big.NewInt(time.Now().UnixNano()),
+		ThisUpdate:                time.Now().Add(-time.Minute),
+		NextUpdate:                time.Now().Add(time.Hour),
+		RevokedCertificateEntries: entries,
+	}, ca.cert, ca.key)
+	if err != nil {
+		t.Fatalf("Failed to create CRL: %v", err)
+	}
+	return der
+}
+
+// crlServer serves whatever CRL is currently set
+type crlServer struct {
+	mu       sync.Mutex
+	crl      []byte
+	requests int
+}
+
+func (s *crlServer) set(crl []byte) {
+	s.mu.Lock()
+	s.crl = crl
+	s.mu.Unlock()
+}
+
+func (s *crlServer) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	if s.crl == nil {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	w.Write(s.crl)
+}
+
+// TestCRLChecker tests revocation checking, caching, and refresh
+func TestCRLChecker(t *testing.T) {
+	ca := newTestCA(t, "Client CA")
+	handler := &crlServer{}
+	handler.set(ca.crl(t, 2))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	good := ca.issueWithCDP(t, 1, server.URL)
+	revoked := ca.issueWithCDP(t, 2, server.URL)
+
+	checker := NewCRLChecker(filepath.Join(t.TempDir(), "crl"), false)
+	if err := checker.CheckChain([]*x509.Certificate{good, ca.cert}); err != nil {
+		t.Errorf("Good certificate rejected: %v", err)
+	}
+	if err := checker.CheckChain([]*x509.Certificate{revoked, ca.cert}); !errors.Is(err, ErrRevoked) {
+		t.Errorf("Expected ErrRevoked, got %v", err)
+	}
+	if handler.requests != 1 {
+		t.Errorf("Expected CRL to be fetched once, got %d fetches", handler.requests)
+	}
+
+	// A refresh picks up newly revoked serials
+	handler.set(ca.crl(t, 1, 2))
+	checker.Refresh(0)
+	if err := checker.CheckChain([]*x509.Certificate{good, ca.cert}); !errors.Is(err, ErrRevoked) {
+		t.Errorf("Expected ErrRevoked after refresh, got %v", err)
+	}
+
+	// A new checker sharing the cache directory does not need the network
+	handler.set(nil)
+	cached := NewCRLChecker(checker.CacheDir, true)
+	if err := cached.CheckChain([]*x509.Certificate{revoked, ca.cert}); !errors.Is(err, ErrRevoked) {
+		t.Errorf("Expected ErrRevoked from disk cache, got %v", err)
+	}
+}
+
+// TestCRLRefreshClock tests that Refresh judges CRL age on the checker's clock
+func TestCRLRefreshClock(t *testing.T) {
+	ca := newTestCA(t, "Client CA")
+	handler := &crlServer{}
+	handler.set(ca.crl(t))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	fake := clock.NewFake(time.Now())
+	checker := &CRLChecker{Clock: fake}
+	if err := checker.CheckChain([]*x509.Certificate{ca.issueWithCDP(t, 1, server.URL), ca.cert}); err != nil {
+		t.Fatalf("CheckChain failed: %v", err)
+	}
+
+	checker.Refresh(time.Hour)
+	if handler.requests != 1 {
+		t.Errorf("Expected a fresh CRL to be kept, got %d fetches", handler.requests)
+	}
+	fake.Advance(2 * time.Hour)
+	checker.Refresh(time.Hour)
+	if handler.requests != 2 {
+		t.Errorf("Expected an old CRL to be refetched, got %d fetches", handler.requests)
+	}
+}
+
+// TestCRLCheckerFailureModes tests soft and hard fail when the CRL is unavailable
+func TestCRLCheckerFailureModes(t *testing.T) {
+	ca := newTestCA(t, "Client CA")
+	server := httptest.NewServer(&crlServer{})
+	defer server.Close()
+
+	cert := ca.issueWithCDP(t, 1, server.URL)
+	chain := []*x509.Certificate{cert, ca.cert}
+
+	if err := NewCRLChecker("", false).CheckChain(chain); err != nil {
+		t.Errorf("Soft fail should accept the certificate: %v", err)
+	}
+	if err := NewCRLChecker("", true).CheckChain(chain); err == nil {
+		t.Error("Hard fail should reject the certificate")
+	}
+
+	// A CRL signed by another CA is not trusted
+	other := newTestCA(t, "Other CA")
+	forged := httptest.NewServer(&crlServer{crl: other.crl(t)})
+	defer forged.Close()
+	cert = ca.issueWithCDP(t, 1, forged.URL)
+	if err := NewCRLChecker("", true).CheckChain([]*x509.Certificate{cert, ca.cert}); err == nil {
+		t.Error("CRL signed by the wrong issuer should not be accepted")
+	}
+}
+
+// TestRootCAStoreChainCheck tests that client verification applies the chain check
+func TestRootCAStoreChainCheck(t *testing.T) {
+	ca := newTestCA(t, "Client CA")
+	server := httptest.NewServer(&crlServer{crl: ca.crl(t, 2)})
+	defer server.Close()
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	writeFile(t, bundle, certPEM(ca.cert.Raw), 0644)
+	store, err := NewRootCAStore(bundle)
+	if err != nil {
+		t.Fatalf("Failed to load bundle: %v", err)
+	}
+	store.SetChainCheck(NewCRLChecker("", false).CheckChain)
+
+	if err := store.VerifyClientCertificate([][]byte{ca.issueWithCDP(t, 1, server.URL).Raw}, nil); err != nil {
+		t.Errorf("Good client certificate rejected: %v", err)
+	}
+	if err := store.VerifyClientCertificate([][]byte{ca.issueWithCDP(t, 2, server.URL).Raw}, nil); !errors.Is(err, ErrRevoked) {
+		t.Errorf("Expected ErrRevoked, got %v", err)
+	}
+}
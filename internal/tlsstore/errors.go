@@ -0,0 +1,54 @@
+package tlsstore
+
+import (
+	"errors"
+	"strings"
+)
+
+// Sentinel errors for the ways loading and validating a certificate can
+// fail. Returned errors wrap them together with the file and operation, so
+// callers can test with errors.Is instead of matching messages.
+var (
+	ErrCertNotFound    = errors.New("certificate or key file not found")
+	ErrKeyMismatch     = errors.New("private key does not match certificate")
+	ErrInsecureKeyFile = errors.New("insecure key file")
+	ErrCertExpired     = errors.New("certificate has expired")
+	ErrNotYetValid     = errors.New("certificate is not yet valid")
+	ErrFileTooLarge    = errors.New("file too large")
+	ErrLoadTimeout     = errors.New("certificate load timed out")
+	ErrMalformedPEM    = errors.New("malformed PEM data")
+)
+
+// LoadError records the file and operation of a failed load. Unwrap yields
+// both the sentinel (if any) and the underlying cause.
+type LoadError struct {
+	Op   string // e.g. "read certificate", "parse key pair"
+	Path string
+	Kind error // one of the sentinels above, or nil
+	Err  error
+}
+
+func (e *LoadError) Error() string {
+	msg := "tlsstore: " + e.Op + " " + e.Path + ": "
+	if e.Kind != nil {
+		msg += e.Kind.Error() + ": "
+	}
+	return msg + e.Err.Error()
+}
+
+// Unwrap returns the sentinel and the underlying cause
+func (e *LoadError) Unwrap() []error {
+	if e.Kind == nil {
+		return []error{e.Err}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// keyPairErrorKind classifies errors from tls.X509KeyPair, which does not
+// export its own error values
+func keyPairErrorKind(err error) error {
+	if strings.Contains(err.Error(), "does not match") {
+		return ErrKeyMismatch
+	}
+	return nil
+}
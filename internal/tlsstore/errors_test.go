@@ -0,0 +1,63 @@
+package tlsstore
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"testing"
+)
+
+// TestLoadErrors tests that load failures wrap the matching sentinel and file
+func TestLoadErrors(t *testing.T) {
+	defer SetPermissionPolicy(PermissionPolicy{Mode: PolicyWarn})
+	SetPermissionPolicy(PermissionPolicy{Mode: PolicyEnforce})
+
+	ca := newTestCA(t, "Test Root")
+	a := ca.issue(t, "a.example.com")
+	b := ca.issue(t, "b.example.com")
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "a.crt")
+	keyFile := filepath.Join(dir, "a.key")
+	otherKey := filepath.Join(dir, "b.key")
+	openKey := filepath.Join(dir, "open.key")
+	writeFile(t, certFile, certPEM(a.Certificate[0]), 0644)
+	writeFile(t, keyFile, keyPEM(t, a.PrivateKey), 0600)
+	writeFile(t, otherKey, keyPEM(t, b.PrivateKey), 0600)
+	writeFile(t, openKey, keyPEM(t, a.PrivateKey), 0644)
+
+	tests := []struct {
+		name     string
+		certFile string
+		keyFile  string
+		want     error
+		wantPath string
+	}{
+		{"missing certificate", filepath.Join(dir, "missing.crt"), keyFile, ErrCertNotFound, filepath.Join(dir, "missing.crt")},
+		{"missing key", certFile, filepath.Join(dir, "missing.key"), ErrCertNotFound, filepath.Join(dir, "missing.key")},
+		{"key mismatch", certFile, otherKey, ErrKeyMismatch, certFile},
+		{"insecure key", certFile, openKey, ErrInsecureKeyFile, openKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(tt.certFile, tt.keyFile)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Expected %v, got %v", tt.want, err)
+			}
+			var loadErr *LoadError
+			if !errors.As(err, &loadErr) || loadErr.Path != tt.wantPath {
+				t.Errorf("Expected a LoadError for %s, got %#v", tt.wantPath, err)
+			}
+		})
+	}
+
+	// The underlying cause stays reachable
+	_, err := Load(filepath.Join(dir, "missing.crt"), keyFile)
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected fs.ErrNotExist to be wrapped, got %v", err)
+	}
+
+	if _, err := Load(certFile, keyFile); err != nil {
+		t.Errorf("Valid pair should load: %v", err)
+	}
+}
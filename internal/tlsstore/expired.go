@@ -0,0 +1,126 @@
+package tlsstore
+
+import (
+	"crypto/x509"
+	"fmt"
+	"log"
+	"time"
+
+	"tls-agent/internal/metrics"
+)
+
+// Modes of an ExpiryPolicy
+const (
+	// ExpiredServe keeps serving an expired certificate, with warnings,
+	// until the grace period ends
+	ExpiredServe = "serve"
+
+	// ExpiredFailClosed refuses handshakes as soon as the certificate
+	// expires
+	ExpiredFailClosed = "fail-closed"
+)
+
+// ExpiryPolicy is what a Store does once a certificate it serves expires and
+// no replacement has arrived. The zero value serves it indefinitely.
+type ExpiryPolicy struct {
+	// Mode is ExpiredServe (the default) or ExpiredFailClosed
+	Mode string
+
+	// Grace bounds how long ExpiredServe keeps serving after NotAfter, after
+	// which handshakes are refused; zero serves indefinitely
+	Grace time.Duration
+}
+
+// ExpiryState describes the default certificate under the expiry policy
+type ExpiryState string
+
+const (
+	// ExpiryValid: the certificate has not expired, or there is none
+	ExpiryValid ExpiryState = "valid"
+
+	// ExpiryServing: the certificate has expired and is still served
+	ExpiryServing ExpiryState = "serving-expired"
+
+	// ExpiryRefusing: the certificate has expired and handshakes are refused
+	ExpiryRefusing ExpiryState = "refusing"
+)
+
+var (
+	servingExpired = metrics.NewGauge("tls_agent_serving_expired_certificate",
+		"1 while handshakes are completed with an expired certificate")
+	expiredHandshakes = metrics.NewCounterVec("tls_agent_expired_certificate_handshakes_total",
+		"Handshakes that selected an expired certificate, by whether it was served or refused", "action")
+)
+
+// SetExpiryPolicy sets how expired certificates are handled from the next
+// handshake on
+func (s *Store) SetExpiryPolicy(p ExpiryPolicy) error {
+	switch p.Mode {
+	case "":
+		p.Mode = ExpiredServe
+	case ExpiredServe, ExpiredFailClosed:
+	default:
+		return fmt.Errorf("tlsstore: unknown expired certificate mode %q", p.Mode)
+	}
+	if p.Grace < 0 {
+		return fmt.Errorf("tlsstore: negative expired certificate grace %s", p.Grace)
+	}
+	s.expiry.Store(&p)
+	return nil
+}
+
+// ExpiryPolicy returns the policy set by SetExpiryPolicy
+func (s *Store) ExpiryPolicy() ExpiryPolicy {
+	if p := s.expiry.Load(); p != nil {
+		return *p
+	}
+	return ExpiryPolicy{Mode: ExpiredServe}
+}
+
+// ExpiryState reports the default certificate's state at now
+func (s *Store) ExpiryState(now time.Time) ExpiryState {
+	return s.ExpiryPolicy().state(s.load().leaf, now)
+}
+
+// state classifies leaf at now; a missing leaf counts as valid, since
+// GetCertificate reports it as missing instead
+func (p ExpiryPolicy) state(leaf *x509.Certificate, now time.Time) ExpiryState {
+	if leaf == nil || !now.After(leaf.NotAfter) {
+		return ExpiryValid
+	}
+	if p.Mode == ExpiredFailClosed || (p.Grace > 0 && now.Sub(leaf.NotAfter) > p.Grace) {
+		return ExpiryRefusing
+	}
+	return ExpiryServing
+}
+
+// checkExpired applies the expiry policy to a handshake selecting e. Each
+// entry logs once when first served expired and once when first refused.
+func (s *Store) checkExpired(e *entry) error {
+	now := s.now()
+	if e.leaf == nil || !now.After(e.leaf.NotAfter) {
+		return nil
+	}
+	p := s.ExpiryPolicy()
+	if p.state(e.leaf, now) == ExpiryRefusing {
+		servingExpired.Set(0)
+		expiredHandshakes.With("refused").Inc()
+		if !e.refusedLogged.Swap(true) {
+			log.Printf("Error: certificate %q expired at %s; refusing handshakes (expired certificate mode %s)",
+				e.leaf.Subject.CommonName, e.leaf.NotAfter.Format(time.RFC3339), p.Mode)
+		}
+		return fmt.Errorf("%w: %q expired at %s", ErrCertExpired, e.leaf.Subject.CommonName, e.leaf.NotAfter.Format(time.RFC3339))
+	}
+
+	servingExpired.Set(1)
+	expiredHandshakes.With("served").Inc()
+	if !e.servedLogged.Swap(true) {
+		until := "indefinitely"
+		if p.Grace > 0 {
+			until = "until " + e.leaf.NotAfter.Add(p.Grace).Format(time.RFC3339)
+		}
+		log.Printf("Warning: certificate %q expired at %s; still serving it %s",
+			e.leaf.Subject.CommonName, e.leaf.NotAfter.Format(time.RFC3339), until)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package tlsstore
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"tls-agent/internal/clock"
+)
+
+// expiredCert returns a certificate that expired ago
+func expiredCert(t *testing.T, ca *testCA, ago time.Duration) *tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "expired.example.com"},
+		DNSNames:     []string{"expired.example.com"},
+		NotBefore:    time.Now().Add(-ago - 24*time.Hour),
+		NotAfter:     time.Now().Add(-ago),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, key.Public(), ca.key)
+	if err != nil {
+		t.Fatalf("Failed to issue certificate: %v", err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+// TestExpiryPolicy tests serving or refusing an expired certificate under
+// each mode and grace period
+func TestExpiryPolicy(t *testing.T) {
+	ca := newTestCA(t, "Test Root")
+	recent := expiredCert(t, ca, time.Hour)
+	old := expiredCert(t, ca, 48*time.Hour)
+
+	tests := []struct {
+		name   string
+		policy ExpiryPolicy
+		cert   *tls.Certificate
+		want   ExpiryState
+	}{
+		{"default serves", ExpiryPolicy{}, old, ExpiryServing},
+		{"within grace", ExpiryPolicy{Mode: ExpiredServe, Grace: 24 * time.Hour}, recent, ExpiryServing},
+		{"beyond grace", ExpiryPolicy{Mode: ExpiredServe, Grace: 24 * time.Hour}, old, ExpiryRefusing},
+		{"fail closed", ExpiryPolicy{Mode: ExpiredFailClosed}, recent, ExpiryRefusing},
+		{"valid", ExpiryPolicy{Mode: ExpiredFailClosed}, ca.issue(t, "valid.example.com"), ExpiryValid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := New(tt.cert)
+			if err := store.SetExpiryPolicy(tt.policy); err != nil {
+				t.Fatalf("SetExpiryPolicy failed: %v", err)
+			}
+			if got := store.ExpiryState(time.Now()); got != tt.want {
+				t.Errorf("ExpiryState() = %s, want %s", got, tt.want)
+			}
+
+			served, err := store.GetCertificate(&tls.ClientHelloInfo{})
+			if tt.want == ExpiryRefusing {
+				if !errors.Is(err, ErrCertExpired) {
+					t.Errorf("Expected ErrCertExpired, got %v", err)
+				}
+				return
+			}
+			if err != nil || served != tt.cert {
+				t.Errorf("Expected the certificate to be served, got %v", err)
+			}
+		})
+	}
+
+	before := expiredHandshakes.With("refused").Value()
+	store := New(recent)
+	store.SetSNI(old, "expired.example.com")
+	if err := store.SetExpiryPolicy(ExpiryPolicy{Grace: 24 * time.Hour}); err != nil {
+		t.Fatalf("SetExpiryPolicy failed: %v", err)
+	}
+	if _, err := store.GetCertificate(&tls.ClientHelloInfo{ServerName: "expired.example.com"}); !errors.Is(err, ErrCertExpired) {
+		t.Errorf("Expected the SNI certificate beyond grace to be refused, got %v", err)
+	}
+	if expiredHandshakes.With("refused").Value() != before+1 {
+		t.Error("Expected the refusal to be counted")
+	}
+	if _, err := store.GetCertificate(nil); err != nil || servingExpired.Value() != 1 {
+		t.Errorf("Expected the default certificate within grace to be served and reported, got %v", err)
+	}
+	store.Update(ca.issue(t, "renewed.example.com"))
+	if servingExpired.Value() != 0 {
+		t.Error("Expected a valid replacement to clear the serving-expired gauge")
+	}
+
+	if err := store.SetExpiryPolicy(ExpiryPolicy{Mode: "fail-open"}); err == nil {
+		t.Error("Expected an unknown mode to be rejected")
+	}
+}
+
+// TestExpiryClock tests that expiry follows the store's clock
+func TestExpiryClock(t *testing.T) {
+	ca := newTestCA(t, "Test Root")
+	cert := ca.issue(t, "valid.example.com")
+	start := time.Now().Add(-30 * time.Minute)
+	fake := clock.NewFake(start)
+	store := NewWithClock(cert, fake)
+	if err := store.SetExpiryPolicy(ExpiryPolicy{Mode: ExpiredFailClosed}); err != nil {
+		t.Fatalf("SetExpiryPolicy failed: %v", err)
+	}
+	if !store.IsValid() {
+		t.Fatal("Expected the certificate to be valid")
+	}
+	if stored := store.Versions()[0].Stored; !stored.Equal(start) {
+		t.Errorf("Expected the version to be timestamped by the store's clock, got %s", stored)
+	}
+
+	fake.Advance(2 * time.Hour)
+	if store.IsValid() {
+		t.Error("Expected the certificate to have expired on the store's clock")
+	}
+	if _, err := store.GetCertificate(&tls.ClientHelloInfo{}); !errors.Is(err, ErrCertExpired) {
+		t.Errorf("Expected ErrCertExpired once the clock passes NotAfter, got %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package tlsstore
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrKeyNotExportable is returned (wrapped) when a snapshot asks for a
+// private key that is held outside the process or cannot be encoded
+var ErrKeyNotExportable = errors.New("tlsstore: private key cannot be exported")
+
+// ExportOptions selects what Export includes
+type ExportOptions struct {
+	// IncludeKey adds the private key as PKCS#8 PEM. Every key export is
+	// audited.
+	IncludeKey bool
+
+	// Requester names who asked, for the audit log
+	Requester string
+}
+
+// Snapshot is the material a Store serves for one certificate
+type Snapshot struct {
+	// Name is the server name asked for; empty for the default certificate
+	Name string `json:"name,omitempty"`
+
+	// Version is the default certificate's version; SNI certificates are
+	// not versioned
+	Version uint64 `json:"version,omitempty"`
+
+	Fingerprint string    `json:"fingerprint"`
+	Subject     string    `json:"subject"`
+	Issuer      string    `json:"issuer"`
+	DNSNames    []string  `json:"dns_names,omitempty"`
+	NotBefore   time.Time `json:"not_before"`
+	NotAfter    time.Time `json:"not_after"`
+	Source      string    `json:"source,omitempty"`
+
+	// CertPEM is the leaf and ChainPEM the intermediates served after it
+	CertPEM  string `json:"cert_pem"`
+	ChainPEM string `json:"chain_pem,omitempty"`
+	KeyPEM   string `json:"key_pem,omitempty"`
+
+	Exported time.Time `json:"exported"`
+}
+
+// PEM returns the leaf, chain and key, if exported, as one PEM file in the
+// layout LoadCombined reads
+func (s *Snapshot) PEM() []byte {
+	return []byte(s.CertPEM + s.ChainPEM + s.KeyPEM)
+}
+
+// Export returns the certificate served for name, or the default
+// certificate for "", without the private key unless opts.IncludeKey is
+// set. It returns ErrNoCertificate when nothing is served for name.
+func (s *Store) Export(name string, opts ExportOptions) (*Snapshot, error) {
+	e := s.load()
+	if name != "" {
+		e = s.lookupSNI(name)
+	}
+	if e == nil || e.cert == nil || len(e.cert.Certificate) == 0 {
+		return nil, ErrNoCertificate
+	}
+	leaf := e.leaf
+	if leaf == nil {
+		var err error
+		if leaf, err = x509.ParseCertificate(e.cert.Certificate[0]); err != nil {
+			return nil, fmt.Errorf("tlsstore: export %s: %w", exportName(name), err)
+		}
+	}
+
+	sum := sha256.Sum256(e.cert.Certificate[0])
+	snap := &Snapshot{
+		Name:        name,
+		Version:     e.version,
+		Fingerprint: hex.EncodeToString(sum[:]),
+		Subject:     leaf.Subject.String(),
+		Issuer:      leaf.Issuer.String(),
+		DNSNames:    leaf.DNSNames,
+		NotBefore:   leaf.NotBefore,
+		NotAfter:    leaf.NotAfter,
+		Source:      e.source,
+		CertPEM:     string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: e.cert.Certificate[0]})),
+		Exported:    time.Now(),
+	}
+	for _, der := range e.cert.Certificate[1:] {
+		snap.ChainPEM += string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	}
+
+	if opts.IncludeKey {
+		if e.cert.PrivateKey == nil {
+			return nil, fmt.Errorf("%w: %s has no private key", ErrKeyNotExportable, exportName(name))
+		}
+		key, err := x509.MarshalPKCS8PrivateKey(e.cert.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrKeyNotExportable, exportName(name), err)
+		}
+		snap.KeyPEM = string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}))
+		clear(key)
+		requester := opts.Requester
+		if requester == "" {
+			requester = "library caller"
+		}
+		AuditKey("exported", fmt.Sprintf("%s (%s) to %s", exportName(name), snap.Fingerprint[:12], requester))
+	}
+	return snap, nil
+}
+
+// exportName names the certificate for name in errors and audit logs
+func exportName(name string) string {
+	if name == "" {
+		return "default certificate"
+	}
+	return name
+}
@@ -0,0 +1,56 @@
+package tlsstore
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"testing"
+)
+
+// TestExport tests exporting the default and SNI certificates with and
+// without the private key
+func TestExport(t *testing.T) {
+	root := newTestCA(t, "Test Root")
+	inter := root.intermediate(t, "Test Intermediate")
+	def := inter.issue(t, "default.example.com")
+	def.Certificate = append(def.Certificate, inter.cert.Raw)
+	shop := inter.issue(t, "shop.example.com")
+
+	store := New(def)
+	store.SetSNI(shop, "*.example.com")
+
+	snap, err := store.Export("", ExportOptions{})
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if snap.KeyPEM != "" || snap.Version != 1 || snap.Subject != "CN=default.example.com" {
+		t.Fatalf("Unexpected snapshot: %+v", snap)
+	}
+	if snap.CertPEM != string(certPEM(def.Certificate[0])) || snap.ChainPEM != string(certPEM(inter.cert.Raw)) {
+		t.Fatal("Snapshot does not hold the served leaf and chain")
+	}
+
+	snap, err = store.Export("www.example.com", ExportOptions{IncludeKey: true, Requester: "test"})
+	if err != nil {
+		t.Fatalf("Export with key failed: %v", err)
+	}
+	if snap.Name != "www.example.com" || snap.Subject != "CN=shop.example.com" || snap.ChainPEM != "" {
+		t.Fatalf("Unexpected SNI snapshot: %+v", snap)
+	}
+	cert, err := ParseCombined(snap.PEM())
+	if err != nil {
+		t.Fatalf("Exported PEM does not load: %v", err)
+	}
+	if !bytes.Equal(cert.Certificate[0], shop.Certificate[0]) || !cert.PrivateKey.(interface{ Equal(crypto.PrivateKey) bool }).Equal(shop.PrivateKey) {
+		t.Fatal("Exported PEM does not hold the served certificate and key")
+	}
+
+	if _, err := store.Export("other.test", ExportOptions{}); !errors.Is(err, ErrNoCertificate) {
+		t.Fatalf("Expected ErrNoCertificate for an unserved name, got %v", err)
+	}
+	remote := *def
+	remote.PrivateKey = nil
+	if _, err := New(&remote).Export("", ExportOptions{IncludeKey: true}); !errors.Is(err, ErrKeyNotExportable) {
+		t.Fatalf("Expected ErrKeyNotExportable without a key, got %v", err)
+	}
+}
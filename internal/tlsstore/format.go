@@ -0,0 +1,145 @@
+package tlsstore
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// MaxPEMBlocks bounds the PEM blocks in one file. A chain is a handful of
+// certificates; thousands of blocks are a mistake or an attack.
+const MaxPEMBlocks = 64
+
+// Format is the encoding of certificate or key data
+type Format string
+
+const (
+	FormatPEM     Format = "pem"
+	FormatDER     Format = "der"
+	FormatBase64  Format = "base64"
+	FormatUnknown Format = "unknown"
+)
+
+// DetectFormat reports how data is encoded: PEM, raw DER, or base64 of
+// either, as found in the data fields of Kubernetes Secrets
+func DetectFormat(data []byte) Format {
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case len(trimmed) == 0:
+		return FormatUnknown
+	case bytes.Contains(trimmed, []byte("-----BEGIN ")):
+		return FormatPEM
+	}
+	// Checked before DER: base64 text may start with '0', but binary DER is
+	// never valid base64
+	if decoded, err := decodeBase64(trimmed); err == nil {
+		if decoded[0] == 0x30 || bytes.Contains(decoded, []byte("-----BEGIN ")) {
+			return FormatBase64
+		}
+	}
+	// Every certificate and key structure is an ASN.1 SEQUENCE
+	if trimmed[0] == 0x30 {
+		return FormatDER
+	}
+	return FormatUnknown
+}
+
+// decodeBase64 decodes standard or URL-safe base64, with or without padding,
+// ignoring line breaks
+func decodeBase64(data []byte) ([]byte, error) {
+	compact := bytes.Join(bytes.Fields(data), nil)
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if out, err := enc.DecodeString(string(compact)); err == nil && len(out) > 0 {
+			return out, nil
+		}
+	}
+	return nil, errors.New("not base64")
+}
+
+// unwrapBase64 returns data decoded when it is base64, and whether it was
+func unwrapBase64(data []byte) ([]byte, bool) {
+	if DetectFormat(data) != FormatBase64 {
+		return data, false
+	}
+	decoded, _ := decodeBase64(data)
+	return decoded, true
+}
+
+// checkPEM rejects PEM data the standard decoder would quietly accept in
+// part: a corrupt or truncated block (pem.Decode skips it and carries on),
+// a certificate block with headers, or more than MaxPEMBlocks blocks. Text
+// outside blocks, such as openssl's "subject=" lines, is allowed. Data
+// without PEM blocks passes, for the format's own parser to judge.
+func checkPEM(data []byte) error {
+	markers := bytes.Count(data, []byte("-----BEGIN "))
+	if markers > MaxPEMBlocks {
+		return fmt.Errorf("%w: more than %d blocks", ErrMalformedPEM, MaxPEMBlocks)
+	}
+	blocks := 0
+	for rest := data; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		blocks++
+		if block.Type == "CERTIFICATE" && len(block.Headers) > 0 {
+			return fmt.Errorf("%w: certificate block %d has headers", ErrMalformedPEM, blocks)
+		}
+	}
+	if blocks < markers {
+		return fmt.Errorf("%w: %d of %d blocks are corrupt or truncated", ErrMalformedPEM, markers-blocks, markers)
+	}
+	return nil
+}
+
+// certToPEM returns certificate data in any supported format as PEM.
+// Unrecognised data is returned unchanged for the PEM parser to reject.
+func certToPEM(data []byte) ([]byte, error) {
+	data, _ = unwrapBase64(data)
+	if DetectFormat(data) != FormatDER {
+		return data, checkPEM(data)
+	}
+	certs, err := x509.ParseCertificates(data)
+	if err != nil {
+		return nil, err
+	}
+	return certPEMBlocks(certs), nil
+}
+
+// keyToPEM returns key data in any supported format as PEM, and whether the
+// result is a new buffer the caller must clear
+func keyToPEM(data []byte) ([]byte, bool, error) {
+	data, decoded := unwrapBase64(data)
+	if DetectFormat(data) != FormatDER {
+		if err := checkPEM(data); err != nil {
+			if decoded {
+				clear(data)
+			}
+			return nil, false, err
+		}
+		return data, decoded, nil
+	}
+	der := data
+	var typ string
+	if _, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		typ = "PRIVATE KEY"
+	} else if _, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		typ = "RSA PRIVATE KEY"
+	} else if _, err := x509.ParseECPrivateKey(der); err == nil {
+		typ = "EC PRIVATE KEY"
+	} else {
+		if decoded {
+			clear(data)
+		}
+		return nil, false, errors.New("DER data is not a PKCS#8, PKCS#1 or EC private key")
+	}
+	out := pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der})
+	if decoded {
+		clear(data)
+	}
+	return out, true, nil
+}
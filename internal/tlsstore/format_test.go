@@ -0,0 +1,145 @@
+package tlsstore
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// TestLoadFormats tests loading pairs in every supported encoding
+func TestLoadFormats(t *testing.T) {
+	ca := newTestCA(t, "Test Root")
+	issued := ca.issue(t, "format.example.com")
+	keyDER, err := x509.MarshalPKCS8PrivateKey(issued.PrivateKey)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+	certDER := issued.Certificate[0]
+	b64 := func(data []byte) []byte {
+		// Wrapped the way kubectl and base64(1) print it
+		s := base64.StdEncoding.EncodeToString(data)
+		var out []byte
+		for len(s) > 76 {
+			out = append(out, s[:76]+"\n"...)
+			s = s[76:]
+		}
+		return append(out, s+"\n"...)
+	}
+
+	tests := []struct {
+		name      string
+		cert, key []byte
+		format    Format
+	}{
+		{"pem", certPEM(certDER), keyPEM(t, issued.PrivateKey), FormatPEM},
+		{"der", certDER, keyDER, FormatDER},
+		{"base64 pem", b64(certPEM(certDER)), b64(keyPEM(t, issued.PrivateKey)), FormatBase64},
+		{"base64 der", b64(certDER), b64(keyDER), FormatBase64},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectFormat(tt.cert); got != tt.format {
+				t.Errorf("DetectFormat(cert) = %s, want %s", got, tt.format)
+			}
+			if got := DetectFormat(tt.key); got != tt.format {
+				t.Errorf("DetectFormat(key) = %s, want %s", got, tt.format)
+			}
+
+			certFile, keyFile := filepath.Join(dir, tt.name+".crt"), filepath.Join(dir, tt.name+".key")
+			writeFile(t, certFile, tt.cert, 0644)
+			writeFile(t, keyFile, tt.key, 0600)
+			cert, err := Load(certFile, keyFile)
+			if err != nil {
+				t.Fatalf("Load failed: %v", err)
+			}
+			if !cert.Leaf.Equal(issued.Leaf) {
+				t.Error("Loaded a different leaf")
+			}
+			if _, err := LoadFromPEM(tt.cert, tt.key); err != nil {
+				t.Errorf("LoadFromPEM failed: %v", err)
+			}
+		})
+	}
+
+	combined := b64(append(keyPEM(t, issued.PrivateKey), certPEM(certDER)...))
+	if _, err := ParseCombined(combined); err != nil {
+		t.Errorf("ParseCombined of base64 failed: %v", err)
+	}
+	if chain, err := ParseChain(b64(certDER)); err != nil || len(chain) != 1 {
+		t.Errorf("ParseChain of base64 DER = %d certificates, %v", len(chain), err)
+	}
+	if got := DetectFormat([]byte("not a certificate")); got != FormatUnknown {
+		t.Errorf("DetectFormat(text) = %s, want unknown", got)
+	}
+	if _, err := LoadFromPEM(certDER, []byte{0x30, 0x03, 0x02, 0x01, 0x00}); err == nil {
+		t.Error("Expected an error for a DER blob that is not a key")
+	}
+}
+
+// TestMalformedPEM tests PEM input the decoder would otherwise accept in
+// part failing with ErrMalformedPEM
+func TestMalformedPEM(t *testing.T) {
+	ca := newTestCA(t, "Test Root")
+	issued := ca.issue(t, "malformed.example.com")
+	leafPEM := certPEM(issued.Certificate[0])
+	key := keyPEM(t, issued.PrivateKey)
+	caPEM := certPEM(ca.cert.Raw)
+
+	truncated := append(append([]byte{}, leafPEM...), caPEM[:len(caPEM)/2]...)
+	withHeaders := bytes.Replace(leafPEM, []byte("-----\n"), []byte("-----\nProc-Type: 4,ENCRYPTED\n\n"), 1)
+	tooMany := bytes.Repeat(caPEM, MaxPEMBlocks+1)
+
+	for name, data := range map[string][]byte{"truncated": truncated, "headers": withHeaders, "too many": tooMany} {
+		if _, err := LoadFromPEM(data, key); !errors.Is(err, ErrMalformedPEM) {
+			t.Errorf("%s: expected ErrMalformedPEM from LoadFromPEM, got %v", name, err)
+		}
+		if _, err := ParseChain(data); !errors.Is(err, ErrMalformedPEM) {
+			t.Errorf("%s: expected ErrMalformedPEM from ParseChain, got %v", name, err)
+		}
+		if _, err := ParseCombined(append(append([]byte{}, key...), data...)); !errors.Is(err, ErrMalformedPEM) {
+			t.Errorf("%s: expected ErrMalformedPEM from ParseCombined, got %v", name, err)
+		}
+	}
+	if _, err := LoadFromPEM(leafPEM, key[:len(key)-40]); !errors.Is(err, ErrMalformedPEM) {
+		t.Errorf("Expected ErrMalformedPEM for a truncated key, got %v", err)
+	}
+
+	// Text around blocks, as openssl prints it, is fine
+	annotated := append([]byte("subject=CN = malformed.example.com\n"), leafPEM...)
+	if _, err := LoadFromPEM(annotated, key); err != nil {
+		t.Errorf("Expected text outside blocks to be accepted, got %v", err)
+	}
+}
+
+// FuzzParsePEM feeds arbitrary certificate and key data through the
+// loaders, which must return an error or a pair but never panic
+func FuzzParsePEM(f *testing.F) {
+	ca := newTestCA(f, "Fuzz Root")
+	issued := ca.issue(f, "fuzz.example.com")
+	leafPEM := certPEM(issued.Certificate[0])
+	keyDER, err := x509.MarshalPKCS8PrivateKey(issued.PrivateKey)
+	if err != nil {
+		f.Fatalf("Failed to marshal key: %v", err)
+	}
+	key := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	f.Add(leafPEM, key)
+	f.Add(append(append([]byte{}, leafPEM...), certPEM(ca.cert.Raw)...), key)
+	f.Add(issued.Certificate[0], keyDER)
+	f.Add([]byte(base64.StdEncoding.EncodeToString(leafPEM)), []byte(base64.StdEncoding.EncodeToString(key)))
+	f.Add([]byte("-----BEGIN CERTIFICATE-----\n"), []byte("0"))
+	f.Fuzz(func(t *testing.T, cert, key []byte) {
+		if pair, err := LoadFromPEM(cert, key); err == nil && pair.Leaf == nil {
+			t.Fatal("LoadFromPEM returned a pair without a leaf")
+		}
+		if chain, err := ParseChain(cert); err == nil && len(chain) > MaxPEMBlocks {
+			t.Fatalf("ParseChain returned %d certificates", len(chain))
+		}
+		_, _ = ParseCombined(append(append([]byte{}, cert...), key...))
+		_ = DetectFormat(cert)
+	})
+}
@@ -0,0 +1,65 @@
+package tlsstore
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/tls"
+	"log"
+	"math/big"
+)
+
+// AuditKey records an operation on private key material. Every code path
+// that reads, writes, exports or destroys a key logs one, so key handling
+// can be reviewed from the logs alone.
+func AuditKey(op, subject string) {
+	log.Printf("AUDIT: key %s %s", op, subject)
+}
+
+// Zeroize overwrites the private key of a retired certificate in place and
+// reports whether it could. It must only be called once nothing can use the
+// key again. Only the key's own memory is cleared: copies made elsewhere,
+// such as by the runtime's crypto caches or a garbage-collected buffer, and
+// keys held outside the process (keyless, PKCS#11) are out of reach.
+func Zeroize(cert *tls.Certificate) bool {
+	if cert == nil {
+		return false
+	}
+	switch key := cert.PrivateKey.(type) {
+	case *ecdsa.PrivateKey:
+		clearInt(key.D)
+	case *rsa.PrivateKey:
+		clearInt(key.D)
+		for _, p := range key.Primes {
+			clearInt(p)
+		}
+		clearInt(key.Precomputed.Dp)
+		clearInt(key.Precomputed.Dq)
+		clearInt(key.Precomputed.Qinv)
+		for _, v := range key.Precomputed.CRTValues {
+			clearInt(v.Exp)
+			clearInt(v.Coeff)
+			clearInt(v.R)
+		}
+	case ed25519.PrivateKey:
+		clear(key)
+	default:
+		return false
+	}
+	return true
+}
+
+// SameKey reports whether a and b hold the same private key, so a retired
+// certificate sharing its key with a live one is never zeroized
+func SameKey(a, b crypto.PrivateKey) bool {
+	k, ok := a.(interface{ Equal(crypto.PrivateKey) bool })
+	return ok && b != nil && k.Equal(b)
+}
+
+func clearInt(n *big.Int) {
+	if n != nil {
+		clear(n.Bits())
+		n.SetInt64(0)
+	}
+}
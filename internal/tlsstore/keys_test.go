@@ -0,0 +1,72 @@
+package tlsstore
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"io"
+	"testing"
+)
+
+// TestZeroize tests that each supported key type is overwritten in place
+func TestZeroize(t *testing.T) {
+	ca := newTestCA(t, "Zeroize CA")
+	ecCert := ca.issue(t, "ec.example")
+	ecKey := ecCert.PrivateKey.(*ecdsa.PrivateKey)
+	if !Zeroize(ecCert) || ecKey.D.Sign() != 0 {
+		t.Error("Expected the ECDSA key to be zeroized")
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	if !Zeroize(&tls.Certificate{PrivateKey: rsaKey}) {
+		t.Fatal("Expected the RSA key to be zeroized")
+	}
+	if rsaKey.D.Sign() != 0 || rsaKey.Primes[0].Sign() != 0 || rsaKey.Precomputed.Dp.Sign() != 0 {
+		t.Error("Expected the RSA private values to be cleared")
+	}
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate Ed25519 key: %v", err)
+	}
+	if !Zeroize(&tls.Certificate{PrivateKey: edKey}) {
+		t.Fatal("Expected the Ed25519 key to be zeroized")
+	}
+	for _, b := range edKey {
+		if b != 0 {
+			t.Fatal("Expected the Ed25519 key bytes to be cleared")
+		}
+	}
+
+	// Keys held elsewhere, such as by a keyless signer, are out of reach
+	if Zeroize(&tls.Certificate{PrivateKey: opaqueSigner{}}) || Zeroize(nil) {
+		t.Error("Expected opaque and missing keys to be reported as not zeroized")
+	}
+}
+
+// TestSameKey tests key comparison across certificate objects
+func TestSameKey(t *testing.T) {
+	ca := newTestCA(t, "SameKey CA")
+	a, b := ca.issue(t, "a.example"), ca.issue(t, "b.example")
+	if !SameKey(a.PrivateKey, a.PrivateKey) {
+		t.Error("Expected a key to match itself")
+	}
+	if SameKey(a.PrivateKey, b.PrivateKey) || SameKey(a.PrivateKey, nil) || SameKey(opaqueSigner{}, a.PrivateKey) {
+		t.Error("Expected different or incomparable keys not to match")
+	}
+}
+
+// opaqueSigner is a signer whose key material is not in the process
+type opaqueSigner struct{}
+
+func (opaqueSigner) Public() crypto.PublicKey { return nil }
+
+func (opaqueSigner) Sign(_ io.Reader, _ []byte, _ crypto.SignerOpts) ([]byte, error) {
+	return nil, nil
+}
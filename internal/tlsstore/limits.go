@@ -0,0 +1,112 @@
+package tlsstore
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"tls-agent/internal/metrics"
+)
+
+// DefaultMaxFileSize bounds certificate, key and chain reads. Real files
+// are a few KiB; anything near the limit is a wrong path or a device.
+const DefaultMaxFileSize = 1 << 20
+
+// DefaultLoadTimeout is how long a load may take before it is abandoned
+const DefaultLoadTimeout = 30 * time.Second
+
+var (
+	maxFileSize atomic.Int64
+
+	loadTimeouts = metrics.NewCounter("tls_agent_certificate_load_timeouts_total",
+		"Certificate loads abandoned after the load timeout")
+)
+
+// SetMaxFileSize sets the largest file or stream Load and LoadFromReader
+// read; n <= 0 restores DefaultMaxFileSize
+func SetMaxFileSize(n int64) {
+	maxFileSize.Store(n)
+}
+
+// MaxFileSize returns the limit set by SetMaxFileSize
+func MaxFileSize() int64 {
+	if n := maxFileSize.Load(); n > 0 {
+		return n
+	}
+	return DefaultMaxFileSize
+}
+
+// readLimited reads r to the end, failing with ErrFileTooLarge past
+// MaxFileSize
+func readLimited(r io.Reader) ([]byte, error) {
+	limit := MaxFileSize()
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		clear(data)
+		return nil, fmt.Errorf("%w: larger than %d bytes", ErrFileTooLarge, limit)
+	}
+	return data, nil
+}
+
+// readFileLimited reads path, refusing files over MaxFileSize before
+// reading them
+func readFileLimited(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err == nil && info.Mode().IsRegular() && info.Size() > MaxFileSize() {
+		return nil, fmt.Errorf("%w: %d bytes, over the limit of %d", ErrFileTooLarge, info.Size(), MaxFileSize())
+	}
+	return readLimited(f)
+}
+
+// LoadContext runs load until ctx is done. Reads blocked on an
+// unresponsive filesystem cannot be interrupted, so a load that does not
+// return in time is abandoned: it finishes in the background and its
+// certificate's key is zeroized. The error wraps ErrLoadTimeout.
+func LoadContext(ctx context.Context, load func(certFile, keyFile string) (*tls.Certificate, error), certFile, keyFile string) (*tls.Certificate, error) {
+	type result struct {
+		cert *tls.Certificate
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		cert, err := load(certFile, keyFile)
+		done <- result{cert, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.cert, r.err
+	case <-ctx.Done():
+		loadTimeouts.Inc()
+		go func() {
+			if r := <-done; r.cert != nil {
+				Zeroize(r.cert)
+			}
+		}()
+		return nil, &LoadError{Op: "load", Path: certFile, Kind: ErrLoadTimeout, Err: ctx.Err()}
+	}
+}
+
+// WithTimeout wraps load so that each call is abandoned after d, as by
+// LoadContext; d <= 0 returns load unchanged
+func WithTimeout(load func(certFile, keyFile string) (*tls.Certificate, error), d time.Duration) func(certFile, keyFile string) (*tls.Certificate, error) {
+	if d <= 0 {
+		return load
+	}
+	return func(certFile, keyFile string) (*tls.Certificate, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), d)
+		defer cancel()
+		return LoadContext(ctx, load, certFile, keyFile)
+	}
+}
@@ -0,0 +1,72 @@
+package tlsstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestMaxFileSize tests that files and streams over the limit are refused
+func TestMaxFileSize(t *testing.T) {
+	ca := newTestCA(t, "Test CA")
+	cert := ca.issue(t, "limits.example.com")
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeFile(t, certFile, certPEM(cert.Certificate[0]), 0644)
+	writeFile(t, keyFile, keyPEM(t, cert.PrivateKey), 0600)
+
+	if _, err := Load(certFile, keyFile); err != nil {
+		t.Fatalf("Load under the default limit failed: %v", err)
+	}
+
+	SetMaxFileSize(64)
+	defer SetMaxFileSize(0)
+	if _, err := Load(certFile, keyFile); !errors.Is(err, ErrFileTooLarge) {
+		t.Fatalf("Expected ErrFileTooLarge from Load, got %v", err)
+	}
+	_, err := LoadFromReader(bytes.NewReader(certPEM(cert.Certificate[0])), bytes.NewReader(keyPEM(t, cert.PrivateKey)))
+	if !errors.Is(err, ErrFileTooLarge) {
+		t.Fatalf("Expected ErrFileTooLarge from LoadFromReader, got %v", err)
+	}
+
+	SetMaxFileSize(0)
+	if MaxFileSize() != DefaultMaxFileSize {
+		t.Errorf("Expected the default limit back, got %d", MaxFileSize())
+	}
+}
+
+// TestWithTimeout tests that a load that does not return in time fails
+// while one that does passes through
+func TestWithTimeout(t *testing.T) {
+	ca := newTestCA(t, "Test CA")
+	cert := ca.issue(t, "slow.example.com")
+	unblock := make(chan struct{})
+	slow := func(string, string) (*tls.Certificate, error) {
+		<-unblock
+		return cert, nil
+	}
+
+	before := loadTimeouts.Value()
+	start := time.Now()
+	_, err := WithTimeout(slow, 50*time.Millisecond)("slow.crt", "slow.key")
+	if !errors.Is(err, ErrLoadTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected ErrLoadTimeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Timed out load took %s to fail", elapsed)
+	}
+
+	if loadTimeouts.Value() == before {
+		t.Error("Expected the timeout to be counted")
+	}
+	close(unblock)
+
+	fast := WithTimeout(func(string, string) (*tls.Certificate, error) { return cert, nil }, time.Second)
+	if got, err := fast("fast.crt", "fast.key"); err != nil || got != cert {
+		t.Errorf("Expected a load within the timeout to pass through, got %v", err)
+	}
+}
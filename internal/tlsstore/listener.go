@@ -0,0 +1,139 @@
+package tlsstore
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sync"
+	"time"
+)
+
+// ListenerHooks observe the connections of a listener from NewListener. Any
+// hook may be nil; they run on the connection's goroutine and should not
+// block.
+type ListenerHooks struct {
+	// Accepted is called for each connection before its handshake
+	Accepted func(remote net.Addr)
+
+	// Handshake is called once per connection when its handshake ends, with
+	// the error if it failed and how long it took
+	Handshake func(state tls.ConnectionState, err error, elapsed time.Duration)
+
+	// Closed is called once per connection, reporting whether its handshake
+	// succeeded and how long it was open
+	Closed func(remote net.Addr, handshake bool, open time.Duration)
+}
+
+// ListenerConfig configures NewListener
+type ListenerConfig struct {
+	// Store supplies the served certificate on every handshake
+	Store CertificateProvider
+
+	// TLS is the base server config, for settings such as ClientAuth;
+	// its certificates are replaced by the store's. nil uses defaults.
+	TLS *tls.Config
+
+	Hooks ListenerHooks
+}
+
+// NewListener wraps inner so that accepted connections are TLS connections
+// serving the store's current certificate, giving protocols other than
+// net/http hot-reloaded TLS. Accept returns *Conn values, which handshake on
+// first read or write as with tls.NewListener. net/http needs a bare
+// *tls.Conn and should use Store.GetCertificate instead.
+func NewListener(inner net.Listener, cfg ListenerConfig) net.Listener {
+	var base *tls.Config
+	if cfg.TLS != nil {
+		base = cfg.TLS.Clone()
+	} else {
+		base = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	base.Certificates = nil
+	base.GetCertificate = cfg.Store.GetCertificate
+	return &listener{Listener: inner, hooks: cfg.Hooks, config: base}
+}
+
+type listener struct {
+	net.Listener
+	hooks  ListenerHooks
+	config *tls.Config
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	raw, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if l.hooks.Accepted != nil {
+		l.hooks.Accepted(raw.RemoteAddr())
+	}
+	return &Conn{Conn: tls.Server(raw, l.config), hooks: &l.hooks, opened: time.Now()}, nil
+}
+
+// Conn is a connection accepted by a listener from NewListener. It reports
+// its handshake and close to the listener's hooks.
+type Conn struct {
+	*tls.Conn
+	hooks  *ListenerHooks
+	opened time.Time
+
+	mu        sync.Mutex
+	started   time.Time
+	reported  bool
+	handshake bool
+	closed    bool
+}
+
+// Handshake runs the handshake if it has not run yet
+func (c *Conn) Handshake() error {
+	return c.HandshakeContext(context.Background())
+}
+
+// HandshakeContext runs the handshake if it has not run yet, reporting the
+// outcome of the first one to the Handshake hook
+func (c *Conn) HandshakeContext(ctx context.Context) error {
+	c.mu.Lock()
+	if c.started.IsZero() {
+		c.started = time.Now()
+	}
+	c.mu.Unlock()
+
+	err := c.Conn.HandshakeContext(ctx)
+
+	c.mu.Lock()
+	first := !c.reported
+	c.reported = true
+	c.handshake = err == nil
+	elapsed := time.Since(c.started)
+	c.mu.Unlock()
+	if first && c.hooks.Handshake != nil {
+		c.hooks.Handshake(c.Conn.ConnectionState(), err, elapsed)
+	}
+	return err
+}
+
+func (c *Conn) Read(b []byte) (int, error) {
+	if err := c.Handshake(); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *Conn) Write(b []byte) (int, error) {
+	if err := c.Handshake(); err != nil {
+		return 0, err
+	}
+	return c.Conn.Write(b)
+}
+
+func (c *Conn) Close() error {
+	c.mu.Lock()
+	first, handshake := !c.closed, c.handshake
+	c.closed = true
+	c.mu.Unlock()
+
+	if first && c.hooks.Closed != nil {
+		c.hooks.Closed(c.RemoteAddr(), handshake, time.Since(c.opened))
+	}
+	return c.Conn.Close()
+}
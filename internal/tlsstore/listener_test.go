@@ -0,0 +1,102 @@
+package tlsstore
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestNewListener tests a line echo protocol served over the wrapped
+// listener: rotations apply to new connections and the hooks see each
+// connection's lifecycle
+func TestNewListener(t *testing.T) {
+	ca := newTestCA(t, "Test Root")
+	store := New(ca.issue(t, "echo.example.com"))
+
+	var accepted, handshakes, failures atomic.Int32
+	closed := make(chan bool, 4)
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	ln := NewListener(inner, ListenerConfig{
+		Store: store,
+		Hooks: ListenerHooks{
+			Accepted: func(net.Addr) { accepted.Add(1) },
+			Handshake: func(_ tls.ConnectionState, err error, _ time.Duration) {
+				if err != nil {
+					failures.Add(1)
+				} else {
+					handshakes.Add(1)
+				}
+			},
+			Closed: func(_ net.Addr, handshake bool, _ time.Duration) { closed <- handshake },
+		},
+	})
+	defer ln.Close()
+
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				line, err := bufio.NewReader(c).ReadString('\n')
+				if err == nil {
+					_, _ = c.Write([]byte(line))
+				}
+			}()
+		}
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	echo := func() *x509.Certificate {
+		t.Helper()
+		conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{RootCAs: roots, ServerName: "echo.example.com"})
+		if err != nil {
+			t.Fatalf("Dial failed: %v", err)
+		}
+		defer conn.Close()
+		if _, err := conn.Write([]byte("ping\n")); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		if line, err := bufio.NewReader(conn).ReadString('\n'); err != nil || line != "ping\n" {
+			t.Fatalf("Echo returned %q, %v", line, err)
+		}
+		return conn.ConnectionState().PeerCertificates[0]
+	}
+
+	first := echo()
+	if !<-closed {
+		t.Error("Closed hook reported no handshake for a served connection")
+	}
+
+	rotated := ca.issue(t, "echo.example.com")
+	store.Update(rotated)
+	if got := echo(); got.Equal(first) || !got.Equal(rotated.Leaf) {
+		t.Error("New connection did not get the rotated certificate")
+	}
+	<-closed
+
+	// A client rejecting the certificate leaves the handshake incomplete
+	if _, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{ServerName: "echo.example.com"}); err == nil {
+		t.Fatal("Expected the system roots to reject the test CA")
+	}
+	if <-closed {
+		t.Error("Closed hook reported a handshake for a rejected connection")
+	}
+
+	if n := accepted.Load(); n != 3 {
+		t.Errorf("Accepted hook ran %d times, want 3", n)
+	}
+	if n, failed := handshakes.Load(), failures.Load(); n != 2 || failed != 1 {
+		t.Errorf("Handshake hook saw %d successes and %d failures, want 2 and 1", n, failed)
+	}
+}
@@ -1,11 +1,179 @@
 package tlsstore
 
-import "crypto/tls"
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"time"
+)
 
+// Retry bounds for files locked by a concurrent writer
+const (
+	maxReadRetries = 5
+	readRetryDelay = 20 * time.Millisecond
+)
+
+// Load reads and parses a certificate/key pair, applying the key file
+// permission policy. Errors are *LoadError values wrapping ErrCertNotFound,
+// ErrKeyMismatch, or ErrInsecureKeyFile where they apply. Either file may be
+// PEM, DER, or base64 of either; see DetectFormat. An empty keyFile, or one
+// equal to certFile, loads certFile as a combined file with LoadCombined.
 func Load(certFile, keyFile string) (*tls.Certificate, error) {
-	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if IsCombined(certFile, keyFile) {
+		return LoadCombined(certFile)
+	}
+	if err := enforcePermissions(keyFile); err != nil {
+		return nil, &LoadError{Op: "check key", Path: keyFile, Kind: ErrInsecureKeyFile, Err: err}
+	}
+	certPEM, err := readFile("read certificate", certFile)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := readFile("read key", keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := parsePair(certPEM, keyPEM, certFile)
+	clear(keyPEM)
 	if err != nil {
 		return nil, err
 	}
+	AuditKey("loaded", keyFile)
+	return cert, nil
+}
+
+// memoryPath names in-memory certificates in errors and audit lines
+const memoryPath = "<memory>"
+
+// LoadFromPEM parses a certificate/key pair held in memory, e.g. fetched
+// from Vault, a Kubernetes Secret or over HTTP, so that it never touches
+// disk. certPEM may hold the leaf followed by its chain. Despite the name,
+// DER and base64 input is accepted as for Load. keyPEM is not
+// retained; callers should clear it after use.
+func LoadFromPEM(certPEM, keyPEM []byte) (*tls.Certificate, error) {
+	cert, err := parsePair(certPEM, keyPEM, memoryPath)
+	if err != nil {
+		return nil, err
+	}
+	AuditKey("loaded", memoryPath)
+	return cert, nil
+}
+
+// LoadFromReader is LoadFromPEM for pairs read from streams, such as HTTP
+// response bodies. Each stream may hold up to MaxFileSize bytes. The key
+// bytes are cleared once parsed.
+func LoadFromReader(certReader, keyReader io.Reader) (*tls.Certificate, error) {
+	certPEM, err := readLimited(certReader)
+	if err != nil {
+		return nil, &LoadError{Op: "read certificate", Path: memoryPath, Err: err}
+	}
+	keyPEM, err := readLimited(keyReader)
+	if err != nil {
+		return nil, &LoadError{Op: "read key", Path: memoryPath, Err: err}
+	}
+	defer clear(keyPEM)
+	return LoadFromPEM(certPEM, keyPEM)
+}
+
+// parsePair parses a pair in any format DetectFormat recognises and caches
+// its leaf; path names the source in errors
+func parsePair(certPEM, keyPEM []byte, path string) (*tls.Certificate, error) {
+	certPEM, err := certToPEM(certPEM)
+	if err != nil {
+		return nil, &LoadError{Op: "decode certificate", Path: path, Err: err}
+	}
+	keyPEM, converted, err := keyToPEM(keyPEM)
+	if err != nil {
+		return nil, &LoadError{Op: "decode key", Path: path, Err: err}
+	}
+	if converted {
+		defer clear(keyPEM)
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, &LoadError{Op: "parse key pair", Path: path, Kind: keyPairErrorKind(err), Err: err}
+	}
+
+	// Cache the parsed leaf so expiry checks never need to re-parse
+	leaf, err := ParseLeaf(&cert)
+	if err != nil {
+		return nil, &LoadError{Op: "parse certificate", Path: path, Err: err}
+	}
+	cert.Leaf = leaf
 	return &cert, nil
 }
+
+// ParseChain parses every CERTIFICATE block of a concatenated PEM bundle in
+// order, leaf first for a served chain. Blocks of other types, such as a
+// private key in a combined file, are skipped. DER and base64 input is
+// converted first.
+func ParseChain(data []byte) ([]*x509.Certificate, error) {
+	data, err := certToPEM(data)
+	if err != nil {
+		return nil, fmt.Errorf("tlsstore: %w", err)
+	}
+	var chain []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("tlsstore: certificate %d: %w", len(chain)+1, err)
+		}
+		chain = append(chain, cert)
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("tlsstore: no certificates in PEM data")
+	}
+	return chain, nil
+}
+
+// ReadFile reads a certificate, key or chain file the way Load does: up to
+// MaxFileSize, retrying briefly while the file is locked
+func ReadFile(path string) ([]byte, error) {
+	return readFile("read", path)
+}
+
+// readFile reads path, up to MaxFileSize, retrying briefly while another
+// process holds it locked (Windows denies reads while a writer has the file
+// open)
+func readFile(op, path string) ([]byte, error) {
+	data, err := readFileLimited(path)
+	for attempt := 1; err != nil && isTransientReadError(err) && attempt <= maxReadRetries; attempt++ {
+		time.Sleep(time.Duration(attempt) * readRetryDelay)
+		data, err = readFileLimited(path)
+	}
+	if err != nil {
+		var kind error
+		if errors.Is(err, fs.ErrNotExist) {
+			kind = ErrCertNotFound
+		}
+		return nil, &LoadError{Op: op, Path: path, Kind: kind, Err: err}
+	}
+	return data, nil
+}
+
+// ParseLeaf returns cert.Leaf, or parses the leaf if it has not been cached.
+// cert is not modified, since it may already be shared with handshakes.
+func ParseLeaf(cert *tls.Certificate) (*x509.Certificate, error) {
+	if cert == nil || len(cert.Certificate) == 0 {
+		return nil, errors.New("no certificate")
+	}
+	if cert.Leaf != nil {
+		return cert.Leaf, nil
+	}
+
+	return x509.ParseCertificate(cert.Certificate[0])
+}
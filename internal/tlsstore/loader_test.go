@@ -0,0 +1,60 @@
+package tlsstore
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// TestLoadFromPEM tests loading pairs held in memory or read from streams
+func TestLoadFromPEM(t *testing.T) {
+	ca := newTestCA(t, "Test Root")
+	issued := ca.issue(t, "mem.example.com")
+	chainPEM := append(certPEM(issued.Certificate[0]), certPEM(ca.cert.Raw)...)
+	privPEM := keyPEM(t, issued.PrivateKey)
+
+	cert, err := LoadFromPEM(chainPEM, privPEM)
+	if err != nil {
+		t.Fatalf("LoadFromPEM failed: %v", err)
+	}
+	if len(cert.Certificate) != 2 || cert.Leaf == nil || cert.Leaf.Subject.CommonName != "mem.example.com" {
+		t.Errorf("Unexpected certificate: %d blocks, leaf %v", len(cert.Certificate), cert.Leaf)
+	}
+
+	cert, err = LoadFromReader(bytes.NewReader(chainPEM), bytes.NewReader(privPEM))
+	if err != nil {
+		t.Fatalf("LoadFromReader failed: %v", err)
+	}
+	if !cert.Leaf.Equal(issued.Leaf) {
+		t.Error("LoadFromReader returned a different leaf")
+	}
+
+	other := ca.issue(t, "other.example.com")
+	_, err = LoadFromPEM(chainPEM, keyPEM(t, other.PrivateKey))
+	if !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("Expected ErrKeyMismatch, got %v", err)
+	}
+}
+
+// TestParseChain tests parsing concatenated PEM, skipping non-certificate
+// blocks
+func TestParseChain(t *testing.T) {
+	ca := newTestCA(t, "Test Root")
+	issued := ca.issue(t, "chain.example.com")
+
+	var bundle []byte
+	bundle = append(bundle, keyPEM(t, issued.PrivateKey)...)
+	bundle = append(bundle, certPEM(issued.Certificate[0])...)
+	bundle = append(bundle, certPEM(ca.cert.Raw)...)
+	chain, err := ParseChain(bundle)
+	if err != nil {
+		t.Fatalf("ParseChain failed: %v", err)
+	}
+	if len(chain) != 2 || !chain[0].Equal(issued.Leaf) || !chain[1].Equal(ca.cert) {
+		t.Errorf("Unexpected chain of %d certificates", len(chain))
+	}
+
+	if _, err := ParseChain(keyPEM(t, issued.PrivateKey)); err == nil {
+		t.Error("Expected an error for PEM data without certificates")
+	}
+}
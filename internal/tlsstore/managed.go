@@ -0,0 +1,63 @@
+package tlsstore
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"sort"
+	"time"
+)
+
+// Managed describes one certificate held by a Store
+type Managed struct {
+	// Names are the server names the certificate is served for; empty for
+	// the default certificate
+	Names []string
+
+	// Source is where the certificate was loaded from, if known
+	Source string
+
+	Cert *tls.Certificate
+	Leaf *x509.Certificate
+
+	// Since is when the certificate was first stored
+	Since time.Time
+}
+
+// Certificates returns the default certificate followed by each distinct
+// SNI certificate, ordered by its first server name
+func (s *Store) Certificates() []Managed {
+	if s == nil {
+		return nil
+	}
+	var out []Managed
+	if e := s.load(); e.cert != nil {
+		out = append(out, managed(e, nil))
+	}
+
+	m := s.sni.Load()
+	if m == nil {
+		return out
+	}
+	names := make([]string, 0, len(*m))
+	for name := range *m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Names are sorted, so grouping them by entry keeps that order
+	index := make(map[*entry]int)
+	for _, name := range names {
+		e := (*m)[name]
+		if i, ok := index[e]; ok {
+			out[i].Names = append(out[i].Names, name)
+			continue
+		}
+		index[e] = len(out)
+		out = append(out, managed(e, []string{name}))
+	}
+	return out
+}
+
+func managed(e *entry, names []string) Managed {
+	return Managed{Names: names, Source: e.source, Cert: e.cert, Leaf: e.leaf, Since: e.since}
+}
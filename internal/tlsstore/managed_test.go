@@ -0,0 +1,40 @@
+package tlsstore
+
+import (
+	"slices"
+	"testing"
+)
+
+// TestCertificates tests listing the default and SNI certificates
+func TestCertificates(t *testing.T) {
+	ca := newTestCA(t, "Test CA")
+	def := ca.issue(t, "default.example.com")
+	api := ca.issue(t, "api.example.com")
+
+	store := New(def)
+	store.SetSNIFrom("certs/api.crt", api, "api.example.com", "www.example.com")
+
+	certs := store.Certificates()
+	if len(certs) != 2 {
+		t.Fatalf("Expected 2 certificates, got %d", len(certs))
+	}
+	if certs[0].Cert != def || len(certs[0].Names) != 0 {
+		t.Errorf("Expected the default certificate first, got %+v", certs[0])
+	}
+	if certs[1].Cert != api || certs[1].Source != "certs/api.crt" || !slices.Equal(certs[1].Names, []string{"api.example.com", "www.example.com"}) {
+		t.Errorf("Expected the SNI certificate with both names, got %+v", certs[1])
+	}
+
+	// Storing the same certificate again keeps its start time
+	since := certs[1].Since
+	store.SetSNIFrom("certs/api.crt", api, "api.example.com", "www.example.com")
+	certs = store.Certificates()
+	if !certs[1].Since.Equal(since) {
+		t.Error("Expected an unchanged SNI certificate to keep its start time")
+	}
+
+	var empty *Store
+	if len(empty.Certificates()) != 0 {
+		t.Error("Expected a nil store to have no certificates")
+	}
+}
@@ -0,0 +1,91 @@
+package tlsstore
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Pair identifies a certificate/key file pair and the server names it serves.
+// Without names the certificate's DNS SANs are used.
+type Pair struct {
+	CertFile string
+	KeyFile  string
+	Names    []string
+}
+
+// PairResult is the outcome of loading one pair
+type PairResult struct {
+	Pair
+	Cert     *tls.Certificate
+	Err      error
+	Duration time.Duration
+}
+
+// LoadReport collects the results of LoadPairs in input order
+type LoadReport struct {
+	Results []PairResult
+}
+
+// Failed returns the results of pairs that could not be loaded
+func (r *LoadReport) Failed() []PairResult {
+	var failed []PairResult
+	for _, res := range r.Results {
+		if res.Err != nil {
+			failed = append(failed, res)
+		}
+	}
+	return failed
+}
+
+// Err joins the errors of all failed pairs, or returns nil if all loaded
+func (r *LoadReport) Err() error {
+	var errs []error
+	for _, res := range r.Failed() {
+		errs = append(errs, fmt.Errorf("%s: %w", res.CertFile, res.Err))
+	}
+	return errors.Join(errs...)
+}
+
+// LoadPairs loads pairs concurrently with at most workers loads in flight
+// (GOMAXPROCS when workers <= 0). It always loads every pair so the report
+// names all failures at once.
+func LoadPairs(pairs []Pair, load func(certFile, keyFile string) (*tls.Certificate, error), workers int) *LoadReport {
+	if load == nil {
+		load = Load
+	}
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	report := &LoadReport{Results: make([]PairResult, len(pairs))}
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < min(workers, len(pairs)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				start := time.Now()
+				cert, err := load(pairs[i].CertFile, pairs[i].KeyFile)
+				report.Results[i] = PairResult{
+					Pair:     pairs[i],
+					Cert:     cert,
+					Err:      err,
+					Duration: time.Since(start),
+				}
+			}
+		}()
+	}
+
+	for i := range pairs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return report
+}
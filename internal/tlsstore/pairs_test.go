@@ -0,0 +1,76 @@
+package tlsstore
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestLoadPairs tests concurrent loading and error aggregation
+func TestLoadPairs(t *testing.T) {
+	ca := newTestCA(t, "Test CA")
+	dir := t.TempDir()
+
+	var pairs []Pair
+	for i := 0; i < 6; i++ {
+		cert := ca.issue(t, fmt.Sprintf("host%d.example.com", i))
+		certFile := filepath.Join(dir, fmt.Sprintf("host%d.crt", i))
+		keyFile := filepath.Join(dir, fmt.Sprintf("host%d.key", i))
+		writeFile(t, certFile, certPEM(cert.Certificate[0]), 0644)
+		writeFile(t, keyFile, keyPEM(t, cert.PrivateKey), 0600)
+		pairs = append(pairs, Pair{CertFile: certFile, KeyFile: keyFile})
+	}
+	// Two broken pairs
+	pairs[2].KeyFile = filepath.Join(dir, "missing.key")
+	writeFile(t, pairs[4].CertFile, []byte("not a certificate"), 0644)
+
+	report := LoadPairs(pairs, nil, 3)
+	if len(report.Results) != len(pairs) {
+		t.Fatalf("Expected %d results, got %d", len(pairs), len(report.Results))
+	}
+	for i, res := range report.Results {
+		if res.CertFile != pairs[i].CertFile {
+			t.Errorf("Result %d is out of order", i)
+		}
+		if broken := i == 2 || i == 4; broken != (res.Err != nil) {
+			t.Errorf("Pair %d: unexpected error state: %v", i, res.Err)
+		}
+	}
+
+	failed := report.Failed()
+	if len(failed) != 2 {
+		t.Fatalf("Expected 2 failures, got %d", len(failed))
+	}
+	err := report.Err()
+	if err == nil || !strings.Contains(err.Error(), "host2.crt") || !strings.Contains(err.Error(), "host4.crt") {
+		t.Errorf("Aggregated error should name both failed pairs: %v", err)
+	}
+}
+
+// TestLoadPairsBoundedConcurrency tests that the worker limit is respected
+func TestLoadPairsBoundedConcurrency(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	load := func(string, string) (*tls.Certificate, error) {
+		n := inFlight.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		inFlight.Add(-1)
+		return nil, errors.New("unused")
+	}
+
+	pairs := make([]Pair, 20)
+	LoadPairs(pairs, load, 4)
+	if got := peak.Load(); got > 4 || got < 2 {
+		t.Errorf("Expected between 2 and 4 concurrent loads, got %d", got)
+	}
+}
@@ -0,0 +1,160 @@
+package tlsstore
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Permission policy modes
+const (
+	PolicyOff     = "off"
+	PolicyWarn    = "warn"
+	PolicyEnforce = "enforce"
+)
+
+// PermissionPolicy controls the key file checks performed by Load
+type PermissionPolicy struct {
+	// Mode is one of PolicyOff, PolicyWarn, or PolicyEnforce
+	Mode string
+
+	// Owner is the expected owner (user name or numeric uid); empty skips the owner check
+	Owner string
+}
+
+// PermissionCheck is the result of the most recent key file check
+type PermissionCheck struct {
+	Path      string    `json:"path"`
+	Mode      string    `json:"mode"`
+	OK        bool      `json:"ok"`
+	Problems  []string  `json:"problems,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+var (
+	permissionPolicy = atomic.Pointer[PermissionPolicy]{}
+	lastCheck        = atomic.Pointer[PermissionCheck]{}
+)
+
+func init() {
+	permissionPolicy.Store(&PermissionPolicy{Mode: PolicyWarn})
+}
+
+// SetPermissionPolicy sets the policy applied to key files on every Load
+func SetPermissionPolicy(p PermissionPolicy) {
+	permissionPolicy.Store(&p)
+}
+
+// LastPermissionCheck returns the result of the most recent key file check,
+// or nil if no check has run yet
+func LastPermissionCheck() *PermissionCheck {
+	return lastCheck.Load()
+}
+
+// CheckKeyFile verifies that path is not group/world accessible and is owned
+// by the expected owner
+func CheckKeyFile(path, owner string) PermissionCheck {
+	check := PermissionCheck{Path: path, CheckedAt: time.Now()}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		check.Problems = append(check.Problems, err.Error())
+		return check
+	}
+	check.Mode = info.Mode().Perm().String()
+
+	if perm := info.Mode().Perm(); permissionBitsSupported && perm&0077 != 0 {
+		check.Problems = append(check.Problems,
+			fmt.Sprintf("key file is group/world accessible (mode %04o, want 0600 or stricter)", perm))
+	}
+
+	if owner != "" {
+		wantUID, err := lookupUID(owner)
+		if err != nil {
+			check.Problems = append(check.Problems, err.Error())
+		} else if uid, ok := fileOwner(info); ok && uid != wantUID {
+			check.Problems = append(check.Problems,
+				fmt.Sprintf("key file owned by uid %d, expected %s (uid %d)", uid, owner, wantUID))
+		}
+	}
+
+	check.OK = len(check.Problems) == 0
+	return check
+}
+
+// enforcePermissions runs the configured policy for keyFile, recording the result
+func enforcePermissions(keyFile string) error {
+	policy := permissionPolicy.Load()
+	if policy.Mode == PolicyOff {
+		return nil
+	}
+
+	// A missing key is reported by the read that follows, as ErrCertNotFound
+	if _, err := os.Stat(keyFile); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	check := CheckKeyFile(keyFile, policy.Owner)
+	lastCheck.Store(&check)
+	if check.OK {
+		return nil
+	}
+
+	err := errors.New(strings.Join(check.Problems, "; "))
+	if policy.Mode == PolicyEnforce {
+		return err
+	}
+	log.Printf("Warning: insecure key file %s: %v", keyFile, err)
+	return nil
+}
+
+func lookupUID(owner string) (int, error) {
+	if uid, err := strconv.Atoi(owner); err == nil {
+		return uid, nil
+	}
+	u, err := user.Lookup(owner)
+	if err != nil {
+		return 0, fmt.Errorf("unknown key file owner %q: %w", owner, err)
+	}
+	return strconv.Atoi(u.Uid)
+}
+
+// WriteKeyFile atomically writes private key material to path with 0600 permissions
+func WriteKeyFile(path string, data []byte) error {
+	if err := WriteFile(path, data, 0600); err != nil {
+		return err
+	}
+	AuditKey("written", path)
+	return nil
+}
+
+// WriteFile atomically replaces path with data. The permissions are set
+// before any data is written, so key material is never readable by others.
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
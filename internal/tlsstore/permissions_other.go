@@ -0,0 +1,13 @@
+//go:build !unix
+
+package tlsstore
+
+import "os"
+
+// permissionBitsSupported is false because mode bits do not reflect ACLs here
+const permissionBitsSupported = false
+
+// fileOwner is not supported on this platform; ownership checks are skipped
+func fileOwner(os.FileInfo) (int, bool) {
+	return 0, false
+}
@@ -0,0 +1,83 @@
+//go:build unix
+
+package tlsstore
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestCheckKeyFile tests mode and ownership checks on key files
+func TestCheckKeyFile(t *testing.T) {
+	dir := t.TempDir()
+	secure := filepath.Join(dir, "secure.key")
+	loose := filepath.Join(dir, "loose.key")
+
+	if err := os.WriteFile(secure, []byte("key"), 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	if err := os.WriteFile(loose, []byte("key"), 0644); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+
+	if check := CheckKeyFile(secure, ""); !check.OK {
+		t.Errorf("0600 key file should pass: %v", check.Problems)
+	}
+	if check := CheckKeyFile(loose, ""); check.OK {
+		t.Error("0644 key file should fail")
+	}
+
+	self := strconv.Itoa(os.Getuid())
+	if check := CheckKeyFile(secure, self); !check.OK {
+		t.Errorf("Key owned by current user should pass: %v", check.Problems)
+	}
+	other := strconv.Itoa(os.Getuid() + 1)
+	if check := CheckKeyFile(secure, other); check.OK {
+		t.Error("Key owned by another uid should fail")
+	}
+}
+
+// TestLoadPermissionPolicy tests warn and enforce policies during Load
+func TestLoadPermissionPolicy(t *testing.T) {
+	defer SetPermissionPolicy(PermissionPolicy{Mode: PolicyWarn})
+
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "server.key")
+	if err := os.WriteFile(keyFile, []byte("not a key"), 0644); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+
+	SetPermissionPolicy(PermissionPolicy{Mode: PolicyEnforce})
+	_, err := Load(filepath.Join(dir, "server.crt"), keyFile)
+	if err == nil || !strings.Contains(err.Error(), "insecure key file") {
+		t.Errorf("Enforce policy should refuse insecure key, got %v", err)
+	}
+	if check := LastPermissionCheck(); check == nil || check.OK {
+		t.Error("Last check should record the failure")
+	}
+
+	SetPermissionPolicy(PermissionPolicy{Mode: PolicyWarn})
+	_, err = Load(filepath.Join(dir, "server.crt"), keyFile)
+	if err == nil || strings.Contains(err.Error(), "insecure key file") {
+		t.Errorf("Warn policy should fall through to the parse error, got %v", err)
+	}
+}
+
+// TestWriteKeyFile tests that generated keys are written owner-only
+func TestWriteKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "generated.key")
+	if err := WriteKeyFile(path, []byte("secret")); err != nil {
+		t.Fatalf("WriteKeyFile failed: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected 0600, got %v", info.Mode().Perm())
+	}
+}
@@ -0,0 +1,20 @@
+//go:build unix
+
+package tlsstore
+
+import (
+	"os"
+	"syscall"
+)
+
+// permissionBitsSupported reports whether Unix mode bits are meaningful here
+const permissionBitsSupported = true
+
+// fileOwner returns the uid owning the file
+func fileOwner(info os.FileInfo) (int, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return int(stat.Uid), true
+}
@@ -0,0 +1,30 @@
+package tlsstore
+
+import "crypto/tls"
+
+// CertificateProvider is what the agent and servers need from a certificate
+// store. *Store implements it; alternatives such as a remote store or a test
+// fake can be swapped in wherever a provider is accepted.
+type CertificateProvider interface {
+	// GetCertificate returns the certificate for a handshake, as
+	// tls.Config.GetCertificate
+	GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error)
+
+	// Update replaces the default certificate
+	Update(cert *tls.Certificate)
+
+	// Info describes the default certificate; its Cert is nil when there
+	// is none
+	Info() Managed
+
+	// Subscribe calls fn after every Update until the returned function is
+	// called
+	Subscribe(fn func(Change)) (cancel func())
+}
+
+// Change describes one Update of the default certificate
+type Change struct {
+	Old, New Managed
+}
+
+var _ CertificateProvider = (*Store)(nil)
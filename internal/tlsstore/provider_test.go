@@ -0,0 +1,63 @@
+package tlsstore
+
+import (
+	"testing"
+)
+
+// TestStoreSubscribe tests that subscribers see each Update with the old and
+// new certificates until they cancel
+func TestStoreSubscribe(t *testing.T) {
+	ca := newTestCA(t, "Test Root")
+	first, second := ca.issue(t, "a.example.com"), ca.issue(t, "b.example.com")
+	store := New(first)
+	if info := store.Info(); info.Cert != first || info.Leaf != first.Leaf {
+		t.Errorf("Info() = %+v, want the initial certificate", info)
+	}
+
+	var changes []Change
+	cancel := store.Subscribe(func(c Change) { changes = append(changes, c) })
+	store.Update(second)
+	if len(changes) != 1 {
+		t.Fatalf("Expected 1 change, got %d", len(changes))
+	}
+	if changes[0].Old.Cert != first || changes[0].New.Cert != second {
+		t.Errorf("Unexpected change %+v", changes[0])
+	}
+	if changes[0].New.Since.IsZero() {
+		t.Error("Expected the new certificate's start time")
+	}
+
+	cancel()
+	store.Update(first)
+	if len(changes) != 1 {
+		t.Errorf("Expected no changes after cancel, got %d", len(changes))
+	}
+}
+
+// TestStoreChanges tests that a slow reader of Changes gets the latest change
+func TestStoreChanges(t *testing.T) {
+	ca := newTestCA(t, "Test Root")
+	store := New(ca.issue(t, "a.example.com"))
+	changes, cancel := store.Changes(1)
+	defer cancel()
+
+	second, third := ca.issue(t, "b.example.com"), ca.issue(t, "c.example.com")
+	store.Update(second)
+	store.Update(third)
+	select {
+	case c := <-changes:
+		if c.Old.Cert != second || c.New.Cert != third {
+			t.Errorf("Expected the latest change, got %+v", c)
+		}
+	default:
+		t.Fatal("Expected a pending change")
+	}
+
+	cancel()
+	store.Update(second)
+	select {
+	case c := <-changes:
+		t.Errorf("Unexpected change after cancel: %+v", c)
+	default:
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package tlsstore
+
+// isTransientReadError reports whether a read may succeed if retried. Files
+// being written are readable on this platform, so no error is transient.
+func isTransientReadError(error) bool {
+	return false
+}
@@ -0,0 +1,15 @@
+//go:build windows
+
+package tlsstore
+
+import (
+	"errors"
+
+	"golang.org/x/sys/windows"
+)
+
+// isTransientReadError reports whether err is a sharing or lock violation
+// caused by a writer that still has the file open
+func isTransientReadError(err error) bool {
+	return errors.Is(err, windows.ERROR_SHARING_VIOLATION) || errors.Is(err, windows.ERROR_LOCK_VIOLATION)
+}
@@ -0,0 +1,227 @@
+package tlsstore
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"tls-agent/internal/watch"
+)
+
+// RootCAStore holds a CA bundle used for verifying upstreams and client
+// certificates, and keeps it current as the bundle file changes
+type RootCAStore struct {
+	path  string
+	pool  atomic.Pointer[x509.CertPool]
+	count atomic.Int64
+
+	chainCheck func(chain []*x509.Certificate) error
+
+	mu        sync.Mutex
+	listeners []func()
+}
+
+// NewRootCAStore loads the PEM bundle at path
+func NewRootCAStore(path string) (*RootCAStore, error) {
+	s := &RootCAStore{path: path}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Pool returns the most recently loaded certificate pool. The returned pool
+// must not be modified.
+func (s *RootCAStore) Pool() *x509.CertPool {
+	return s.pool.Load()
+}
+
+// Len returns the number of certificates in the current bundle
+func (s *RootCAStore) Len() int {
+	return int(s.count.Load())
+}
+
+// Path returns the bundle file path
+func (s *RootCAStore) Path() string {
+	return s.path
+}
+
+// Reload re-reads the bundle. On error the previous pool stays in place.
+func (s *RootCAStore) Reload() error {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return fmt.Errorf("no certificates found in CA bundle %s", s.path)
+	}
+
+	s.pool.Store(pool)
+	s.count.Store(int64(countPEMCertificates(data)))
+
+	s.mu.Lock()
+	listeners := s.listeners
+	s.mu.Unlock()
+	for _, fn := range listeners {
+		fn()
+	}
+	return nil
+}
+
+// OnReload calls fn after every successful reload, whichever watcher or
+// caller triggered it
+func (s *RootCAStore) OnReload(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listeners = append(s.listeners[:len(s.listeners):len(s.listeners)], fn)
+}
+
+// SetChainCheck installs an extra check (such as revocation or key pinning)
+// that a verified chain must pass, for client certificates and for servers
+// verified through ClientConfig. It must be called before the store is in use.
+func (s *RootCAStore) SetChainCheck(check func(chain []*x509.Certificate) error) {
+	s.chainCheck = check
+}
+
+// Watch reloads the bundle whenever its file changes until stopChan is closed.
+// onReload, if set, is called after each successful reload.
+func (s *RootCAStore) Watch(onReload func(), stopChan <-chan struct{}) error {
+	w, err := watch.New(0)
+	if err != nil {
+		return err
+	}
+	if err := s.Register(w, onReload); err != nil {
+		return err
+	}
+	return w.Run(stopChan)
+}
+
+// Register reloads the bundle from w whenever its file changes. onReload,
+// if set, is called after each successful reload.
+func (s *RootCAStore) Register(w *watch.Watcher, onReload func()) error {
+	return w.Add("trust store", func() {
+		if err := s.Reload(); err != nil {
+			log.Println("Trust store: reload failed:", err)
+			return
+		}
+		log.Printf("Trust store: reloaded %s (%d certificates)", s.path, s.Len())
+		if onReload != nil {
+			onReload()
+		}
+	}, s.path)
+}
+
+// VerifyClientCertificate verifies a presented client chain against the
+// current bundle. It is meant for tls.Config.VerifyPeerCertificate with
+// ClientAuth set to RequireAnyClientCert or RequestClientCert, so that
+// bundle rotations apply to new handshakes without rebuilding the config.
+func (s *RootCAStore) VerifyClientCertificate(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	if len(rawCerts) == 0 {
+		return nil
+	}
+	return s.checkChains(s.verify(rawCerts, "", x509.ExtKeyUsageClientAuth))
+}
+
+// checkChains applies the chain check to the result of verify, accepting if
+// any verified path passes
+func (s *RootCAStore) checkChains(chains [][]*x509.Certificate, err error) error {
+	if err != nil || s.chainCheck == nil {
+		return err
+	}
+	for _, chain := range chains {
+		if err = s.chainCheck(chain); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// ErrNoServerName is returned by handshakes through a ClientConfig that has
+// no server name to check the server's certificate against
+var ErrNoServerName = errors.New("tlsstore: no server name to verify the server certificate against")
+
+// ClientConfig returns a copy of base that verifies servers against the
+// current bundle on every handshake, for use by outbound transports. The
+// server's certificate is checked against base.ServerName or the dialled
+// host name. Servers dialled by IP address need base.ServerName; without a
+// name the handshake fails with ErrNoServerName instead of skipping the
+// check.
+func (s *RootCAStore) ClientConfig(base *tls.Config) *tls.Config {
+	var cfg *tls.Config
+	if base != nil {
+		cfg = base.Clone()
+	} else {
+		cfg = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	// Standard verification would pin the pool at config creation time, so
+	// it is replaced by VerifyConnection against the live pool
+	cfg.InsecureSkipVerify = true
+	cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+		// SNI is not sent for IP addresses, leaving cs.ServerName empty.
+		// x509 skips the hostname check for an empty name, and with
+		// InsecureSkipVerify nothing else would make it.
+		name := cs.ServerName
+		if name == "" {
+			name = cfg.ServerName
+		}
+		if name == "" {
+			return ErrNoServerName
+		}
+		raw := make([][]byte, len(cs.PeerCertificates))
+		for i, c := range cs.PeerCertificates {
+			raw[i] = c.Raw
+		}
+		return s.checkChains(s.verify(raw, name, x509.ExtKeyUsageServerAuth))
+	}
+	return cfg
+}
+
+func (s *RootCAStore) verify(rawCerts [][]byte, dnsName string, usage x509.ExtKeyUsage) ([][]*x509.Certificate, error) {
+	if len(rawCerts) == 0 {
+		return nil, errors.New("no peer certificates presented")
+	}
+
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return nil, err
+		}
+		certs[i] = cert
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range certs[1:] {
+		intermediates.AddCert(c)
+	}
+
+	return certs[0].Verify(x509.VerifyOptions{
+		Roots:         s.Pool(),
+		Intermediates: intermediates,
+		DNSName:       dnsName,
+		KeyUsages:     []x509.ExtKeyUsage{usage},
+	})
+}
+
+func countPEMCertificates(data []byte) int {
+	n := 0
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return n
+		}
+		if block.Type == "CERTIFICATE" {
+			n++
+		}
+	}
+}
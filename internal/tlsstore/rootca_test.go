@@ -0,0 +1,143 @@
+package tlsstore
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestRootCAStoreVerify tests client certificate verification against the bundle
+func TestRootCAStoreVerify(t *testing.T) {
+	ca := newTestCA(t, "Test Root")
+	other := newTestCA(t, "Other Root")
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	writeFile(t, bundle, certPEM(ca.cert.Raw), 0644)
+
+	roots, err := NewRootCAStore(bundle)
+	if err != nil {
+		t.Fatalf("NewRootCAStore failed: %v", err)
+	}
+	if roots.Len() != 1 {
+		t.Errorf("Expected 1 certificate, got %d", roots.Len())
+	}
+
+	good := ca.issue(t, "client.example.com")
+	if err := roots.VerifyClientCertificate(good.Certificate, nil); err != nil {
+		t.Errorf("Certificate from trusted CA should verify: %v", err)
+	}
+
+	bad := other.issue(t, "client.example.com")
+	if err := roots.VerifyClientCertificate(bad.Certificate, nil); err == nil {
+		t.Error("Certificate from untrusted CA should be rejected")
+	}
+
+	// Rotating the bundle changes what is trusted
+	writeFile(t, bundle, certPEM(other.cert.Raw), 0644)
+	if err := roots.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if err := roots.VerifyClientCertificate(bad.Certificate, nil); err != nil {
+		t.Errorf("Certificate should verify after bundle rotation: %v", err)
+	}
+
+	// A broken bundle keeps the previous pool
+	writeFile(t, bundle, []byte("garbage"), 0644)
+	if err := roots.Reload(); err == nil {
+		t.Error("Reload of invalid bundle should fail")
+	}
+	if err := roots.VerifyClientCertificate(bad.Certificate, nil); err != nil {
+		t.Errorf("Previous pool should remain active: %v", err)
+	}
+}
+
+// TestRootCAStoreWatch tests that bundle changes are picked up automatically
+func TestRootCAStoreWatch(t *testing.T) {
+	ca := newTestCA(t, "Test Root")
+	next := newTestCA(t, "Next Root")
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	writeFile(t, bundle, certPEM(ca.cert.Raw), 0644)
+
+	roots, err := NewRootCAStore(bundle)
+	if err != nil {
+		t.Fatalf("NewRootCAStore failed: %v", err)
+	}
+
+	reloaded := make(chan struct{}, 1)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		_ = roots.Watch(func() {
+			select {
+			case reloaded <- struct{}{}:
+			default:
+			}
+		}, stop)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	writeFile(t, bundle, append(certPEM(ca.cert.Raw), certPEM(next.cert.Raw)...), 0644)
+
+	select {
+	case <-reloaded:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Bundle change was not picked up")
+	}
+	if roots.Len() != 2 {
+		t.Errorf("Expected 2 certificates after reload, got %d", roots.Len())
+	}
+}
+
+// TestRootCAStoreClientConfig tests outbound verification using the live pool
+func TestRootCAStoreClientConfig(t *testing.T) {
+	ca := newTestCA(t, "Test Root")
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	writeFile(t, bundle, certPEM(ca.cert.Raw), 0644)
+
+	roots, err := NewRootCAStore(bundle)
+	if err != nil {
+		t.Fatalf("NewRootCAStore failed: %v", err)
+	}
+
+	serverCert := ca.issue(t, "upstream.example.com")
+	handshake := func(serverName string) error {
+		ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{*serverCert}})
+		if err != nil {
+			t.Fatalf("Listen failed: %v", err)
+		}
+		defer ln.Close()
+
+		go func() {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			_ = conn.(*tls.Conn).Handshake()
+		}()
+
+		cfg := roots.ClientConfig(&tls.Config{ServerName: serverName})
+		raw, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatalf("Dial failed: %v", err)
+		}
+		// tls.Client, unlike tls.Dial, does not fill in the server name
+		conn := tls.Client(raw, cfg)
+		defer conn.Close()
+		return conn.Handshake()
+	}
+
+	if err := handshake("upstream.example.com"); err != nil {
+		t.Errorf("Handshake with trusted upstream failed: %v", err)
+	}
+	if err := handshake("wrong.example.com"); err == nil {
+		t.Error("Hostname mismatch should fail verification")
+	}
+	if err := handshake(""); !errors.Is(err, ErrNoServerName) {
+		t.Errorf("Expected a handshake without a server name to fail with ErrNoServerName, got %v", err)
+	}
+}
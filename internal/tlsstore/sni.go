@@ -0,0 +1,102 @@
+package tlsstore
+
+import (
+	"crypto/tls"
+	"sort"
+	"strings"
+)
+
+// sniMap maps lower-cased server names (exact or "*.suffix") to snapshots.
+// It is never modified after publication; writers copy it.
+type sniMap map[string]*entry
+
+// lookupSNI returns the snapshot for serverName, trying an exact match and
+// then a wildcard for the first label. Lookups are lock-free.
+func (s *Store) lookupSNI(serverName string) *entry {
+	if s == nil || serverName == "" {
+		return nil
+	}
+	m := s.sni.Load()
+	if m == nil {
+		return nil
+	}
+
+	name := strings.ToLower(strings.TrimSuffix(serverName, "."))
+	if e, ok := (*m)[name]; ok {
+		return e
+	}
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		if e, ok := (*m)["*"+name[i:]]; ok {
+			return e
+		}
+	}
+	return nil
+}
+
+// SetSNI serves cert to clients requesting any of names, replacing what was
+// served for those names before. Names may be wildcards ("*.example.com").
+// Without names the DNS SANs of the certificate are used. Other names keep
+// their existing snapshot, so in-flight lookups are never blocked.
+func (s *Store) SetSNI(cert *tls.Certificate, names ...string) {
+	s.SetSNIFrom("", cert, names...)
+}
+
+// SetSNIFrom is SetSNI for a certificate loaded from source, which is
+// reported by Certificates
+func (s *Store) SetSNIFrom(source string, cert *tls.Certificate, names ...string) {
+	e := newEntry(cert, s.now())
+	e.source = source
+	if len(names) == 0 && e.leaf != nil {
+		names = e.leaf.DNSNames
+	}
+	s.updateSNI(func(m sniMap) {
+		if len(names) > 0 {
+			e.carry(m[strings.ToLower(names[0])])
+		}
+		for _, name := range names {
+			m[strings.ToLower(name)] = e
+		}
+	})
+}
+
+// RemoveSNI stops serving dedicated certificates for names; those clients
+// get the default certificate again
+func (s *Store) RemoveSNI(names ...string) {
+	s.updateSNI(func(m sniMap) {
+		for _, name := range names {
+			delete(m, strings.ToLower(name))
+		}
+	})
+}
+
+// SNINames returns the configured server names in sorted order
+func (s *Store) SNINames() []string {
+	if s == nil {
+		return nil
+	}
+	m := s.sni.Load()
+	if m == nil {
+		return nil
+	}
+	names := make([]string, 0, len(*m))
+	for name := range *m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// updateSNI applies change to a copy of the map and publishes it
+func (s *Store) updateSNI(change func(sniMap)) {
+	s.sniMu.Lock()
+	defer s.sniMu.Unlock()
+
+	next := make(sniMap)
+	if cur := s.sni.Load(); cur != nil {
+		for name, e := range *cur {
+			next[name] = e
+		}
+	}
+	change(next)
+	s.sni.Store(&next)
+}
@@ -0,0 +1,130 @@
+package tlsstore
+
+import (
+	"crypto/tls"
+	"fmt"
+	"testing"
+)
+
+// TestSNILookup tests exact, wildcard, and default certificate selection
+func TestSNILookup(t *testing.T) {
+	ca := newTestCA(t, "Test CA")
+	def := ca.issue(t, "default.example.com")
+	api := ca.issue(t, "api.example.com")
+	wildcard := ca.issue(t, "*.apps.example.com")
+
+	store := New(def)
+	store.SetSNI(api)
+	store.SetSNI(wildcard)
+
+	tests := []struct {
+		serverName string
+		want       *tls.Certificate
+	}{
+		{"api.example.com", api},
+		{"API.Example.com.", api},
+		{"shop.apps.example.com", wildcard},
+		{"a.b.apps.example.com", def},
+		{"unknown.example.com", def},
+		{"", def},
+	}
+	for _, tt := range tests {
+		got, err := store.GetCertificate(&tls.ClientHelloInfo{ServerName: tt.serverName})
+		if err != nil {
+			t.Fatalf("GetCertificate(%q) failed: %v", tt.serverName, err)
+		}
+		if got != tt.want {
+			t.Errorf("GetCertificate(%q) returned the wrong certificate", tt.serverName)
+		}
+	}
+
+	// Replacing one name leaves the others untouched
+	api2 := ca.issue(t, "api.example.com")
+	store.SetSNI(api2)
+	if got, _ := store.GetCertificate(&tls.ClientHelloInfo{ServerName: "api.example.com"}); got != api2 {
+		t.Error("SetSNI should replace the certificate for its names")
+	}
+	if got, _ := store.GetCertificate(&tls.ClientHelloInfo{ServerName: "x.apps.example.com"}); got != wildcard {
+		t.Error("Unrelated names should keep their certificate")
+	}
+
+	store.RemoveSNI("api.example.com")
+	if got, _ := store.GetCertificate(&tls.ClientHelloInfo{ServerName: "api.example.com"}); got != def {
+		t.Error("Removed names should fall back to the default certificate")
+	}
+	if names := store.SNINames(); len(names) != 1 || names[0] != "*.apps.example.com" {
+		t.Errorf("Unexpected SNI names: %v", names)
+	}
+}
+
+// TestSNIConcurrentUpdates tests lookups racing with updates
+func TestSNIConcurrentUpdates(t *testing.T) {
+	ca := newTestCA(t, "Test CA")
+	store := New(ca.issue(t, "default.example.com"))
+	certs := make([]*tls.Certificate, 8)
+	for i := range certs {
+		certs[i] = ca.issue(t, fmt.Sprintf("host%d.example.com", i))
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			store.SetSNI(certs[i%len(certs)])
+		}
+	}()
+
+	hello := &tls.ClientHelloInfo{ServerName: "host3.example.com"}
+	for {
+		select {
+		case <-done:
+			return
+		default:
+			if cert, err := store.GetCertificate(hello); err != nil || cert == nil {
+				t.Fatalf("Lookup failed during update: %v", err)
+			}
+		}
+	}
+}
+
+// benchmarkSNIStore builds a store with n SNI certificates sharing one key
+func benchmarkSNIStore(b *testing.B, n int) *Store {
+	b.Helper()
+	ca := newTestCA(b, "Bench CA")
+	base := ca.issue(b, "default.example.com")
+
+	store := New(base)
+	for i := 0; i < n; i++ {
+		store.SetSNI(base, fmt.Sprintf("host%d.example.com", i))
+	}
+	return store
+}
+
+// BenchmarkGetCertificateSNI benchmarks lookups as the number of SNI names grows
+func BenchmarkGetCertificateSNI(b *testing.B) {
+	for _, n := range []int{0, 10, 1000} {
+		store := benchmarkSNIStore(b, n)
+		hello := &tls.ClientHelloInfo{ServerName: "host5.example.com"}
+
+		b.Run(fmt.Sprintf("names=%d", n), func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, err := store.GetCertificate(hello); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkSetSNI benchmarks a single-name update in a large map
+func BenchmarkSetSNI(b *testing.B) {
+	store := benchmarkSNIStore(b, 1000)
+	cert, _ := store.GetCertificate(nil)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		store.SetSNI(cert, "host5.example.com")
+	}
+}
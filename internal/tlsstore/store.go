@@ -1,42 +1,268 @@
 package tlsstore
 
 import (
+	"bytes"
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"sync"
 	"sync/atomic"
 	"time"
+
+	"tls-agent/internal/clock"
 )
 
+// ErrNoCertificate is returned by GetCertificate when no certificate has been set
+var ErrNoCertificate = errors.New("tlsstore: no certificate available")
+
+// Store holds the certificate served to new handshakes. The zero value is an
+// empty store; a nil *Store behaves like an empty one.
 type Store struct {
-	cert atomic.Value
+	cert atomic.Pointer[entry]
+
+	// sni holds per-server-name certificates, replaced copy-on-write
+	sni   atomic.Pointer[sniMap]
+	sniMu sync.Mutex
+
+	// subs are the Subscribe callbacks, keyed for cancellation
+	subMu   sync.Mutex
+	subs    map[int]func(Change)
+	nextSub int
+
+	// versions are the retained default certificates, oldest first; verMu
+	// also orders Updates so versions are stored in sequence
+	verMu    sync.Mutex
+	versions []*entry
+	retain   int
+	version  uint64
+
+	// expiry is the expired certificate policy; nil is the zero policy
+	expiry atomic.Pointer[ExpiryPolicy]
+
+	// clock judges expiry and timestamps stored certificates; nil is the
+	// wall clock
+	clock clock.Clock
+}
+
+// entry is an immutable snapshot of the served certificate together with its
+// parsed chain, computed once when the certificate is stored
+type entry struct {
+	cert  *tls.Certificate
+	leaf  *x509.Certificate
+	chain []*x509.Certificate
+
+	// source describes where the certificate was loaded from, if known
+	source string
+
+	// since is when this certificate was first stored; storing the same
+	// leaf again keeps it
+	since time.Time
+
+	// version numbers the entry among the store's Updates; stored is when
+	// it was stored and rollbackOf the version it restored, if any
+	version    uint64
+	stored     time.Time
+	rollbackOf uint64
+
+	// servedLogged and refusedLogged are set once serving or refusing the
+	// expired certificate has been logged
+	servedLogged  atomic.Bool
+	refusedLogged atomic.Bool
 }
 
+func newEntry(cert *tls.Certificate, now time.Time) *entry {
+	e := &entry{cert: cert, since: now, stored: now}
+	if cert == nil {
+		return e
+	}
+
+	for _, der := range cert.Certificate {
+		parsed, err := x509.ParseCertificate(der)
+		if err != nil {
+			break
+		}
+		e.chain = append(e.chain, parsed)
+	}
+	if cert.Leaf != nil {
+		e.leaf = cert.Leaf
+	} else if len(e.chain) > 0 {
+		e.leaf = e.chain[0]
+	}
+	return e
+}
+
+// carry keeps prev's start time when e stores the same leaf again
+func (e *entry) carry(prev *entry) {
+	if prev == nil || e.cert == nil || prev.cert == nil || len(e.cert.Certificate) == 0 || len(prev.cert.Certificate) == 0 {
+		return
+	}
+	if bytes.Equal(e.cert.Certificate[0], prev.cert.Certificate[0]) {
+		e.since = prev.since
+	}
+}
+
+// New returns a store serving initial as version 1
 func New(initial *tls.Certificate) *Store {
-	s := &Store{}
-	s.cert.Store(initial)
+	return NewWithClock(initial, nil)
+}
+
+// NewWithClock is New with expiry judged and versions timestamped by c
+// instead of the wall clock
+func NewWithClock(initial *tls.Certificate, c clock.Clock) *Store {
+	s := &Store{clock: c}
+	s.store(newEntry(initial, s.now()))
 	return s
 }
 
-func (s *Store) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
-	return s.cert.Load().(*tls.Certificate), nil
+// Now returns the time on the store's clock, for judging its certificates
+// as the store does
+func (s *Store) Now() time.Time {
+	return s.now()
+}
+
+// now is the time on the store's clock
+func (s *Store) now() time.Time {
+	if s == nil {
+		return time.Now()
+	}
+	return clock.Or(s.clock).Now()
+}
+
+// load returns the current snapshot, or an empty one
+func (s *Store) load() *entry {
+	if s == nil {
+		return &entry{}
+	}
+	if e := s.cert.Load(); e != nil {
+		return e
+	}
+	return &entry{}
+}
+
+// GetCertificate returns the certificate configured for the requested server
+// name, falling back to the default certificate
+func (s *Store) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if hello != nil {
+		if e := s.lookupSNI(hello.ServerName); e != nil {
+			if err := s.checkExpired(e); err != nil {
+				return nil, err
+			}
+			return e.cert, nil
+		}
+	}
+
+	e := s.load()
+	if e.cert == nil {
+		return nil, ErrNoCertificate
+	}
+	if err := s.checkExpired(e); err != nil {
+		return nil, err
+	}
+	return e.cert, nil
 }
 
+// Update replaces the default certificate with a new version and notifies
+// subscribers
 func (s *Store) Update(cert *tls.Certificate) {
-	s.cert.Store(cert)
+	s.verMu.Lock()
+	e := newEntry(cert, s.now())
+	prev := s.store(e)
+	s.verMu.Unlock()
+	if e.leaf != nil && s.now().Before(e.leaf.NotAfter) {
+		servingExpired.Set(0)
+	}
+	s.notify(prev, e)
+}
+
+// notify calls the subscribers with the change from prev to e
+func (s *Store) notify(prev, e *entry) {
+	s.subMu.Lock()
+	subs := make([]func(Change), 0, len(s.subs))
+	for _, fn := range s.subs {
+		subs = append(subs, fn)
+	}
+	s.subMu.Unlock()
+	if len(subs) == 0 {
+		return
+	}
+
+	change := Change{New: managed(e, nil)}
+	if prev != nil {
+		change.Old = managed(prev, nil)
+	}
+	for _, fn := range subs {
+		fn(change)
+	}
+}
+
+// Changes is Subscribe as a channel, for consumers with their own loop. The
+// channel holds up to size changes (at least one); when a reader falls
+// behind the oldest pending change is dropped, so the latest is always
+// delivered. cancel stops deliveries but does not close the channel.
+func (s *Store) Changes(size int) (changes <-chan Change, cancel func()) {
+	ch := make(chan Change, max(size, 1))
+	var mu sync.Mutex
+	cancel = s.Subscribe(func(c Change) {
+		mu.Lock()
+		defer mu.Unlock()
+		for {
+			select {
+			case ch <- c:
+				return
+			default:
+			}
+			select {
+			case <-ch:
+			default:
+			}
+		}
+	})
+	return ch, cancel
+}
+
+// Info describes the default certificate
+func (s *Store) Info() Managed {
+	return managed(s.load(), nil)
+}
+
+// Subscribe calls fn synchronously after every Update, in no particular
+// order among subscribers, until the returned function is called. fn must
+// not call Update.
+func (s *Store) Subscribe(fn func(Change)) (cancel func()) {
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+	if s.subs == nil {
+		s.subs = make(map[int]func(Change))
+	}
+	id := s.nextSub
+	s.nextSub++
+	s.subs[id] = fn
+	return func() {
+		s.subMu.Lock()
+		defer s.subMu.Unlock()
+		delete(s.subs, id)
+	}
+}
+
+// Leaf returns the parsed leaf of the current certificate, or nil if there
+// is none or it could not be parsed
+func (s *Store) Leaf() *x509.Certificate {
+	return s.load().leaf
+}
+
+// Chain returns the parsed certificates of the current chain, leaf first.
+// The returned slice must not be modified.
+func (s *Store) Chain() []*x509.Certificate {
+	return s.load().chain
 }
 
 // IsValid checks if the current certificate is valid and not expired
 func (s *Store) IsValid() bool {
-	cert := s.cert.Load().(*tls.Certificate)
-	if cert == nil {
+	leaf := s.Leaf()
+	if leaf == nil {
 		return false
 	}
 
-	// If Leaf is not parsed, we consider the certificate valid
-	// (it would be parsed during TLS handshake)
-	if cert.Leaf == nil {
-		return true
-	}
-
 	// Check if certificate is still valid (not expired)
-	return time.Now().Before(cert.Leaf.NotAfter)
+	return s.now().Before(leaf.NotAfter)
 }
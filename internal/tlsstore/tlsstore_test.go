@@ -3,6 +3,7 @@ package tlsstore
 import (
 	"bytes"
 	"crypto/tls"
+	"errors"
 	"os"
 	"testing"
 )
@@ -184,14 +185,20 @@ func TestGetCertificateWithValidFiles(t *testing.T) {
 func TestGetCertificateWithNilStore(t *testing.T) {
 	var store *Store
 
-	// Test with nil store - this should panic, so we'll recover
-	defer func() {
-		if r := recover(); r == nil {
-			t.Error("Expected panic when calling GetCertificate on nil store")
-		}
-	}()
+	// A nil or empty store reports an error instead of panicking
+	cert, err := store.GetCertificate(&tls.ClientHelloInfo{})
+	if !errors.Is(err, ErrNoCertificate) || cert != nil {
+		t.Errorf("Expected ErrNoCertificate from nil store, got %v, %v", cert, err)
+	}
+	if store.IsValid() || store.Leaf() != nil {
+		t.Error("Nil store should report no valid certificate")
+	}
 
-	store.GetCertificate(&tls.ClientHelloInfo{})
+	for _, empty := range []*Store{New(nil), {}} {
+		if _, err := empty.GetCertificate(&tls.ClientHelloInfo{}); !errors.Is(err, ErrNoCertificate) {
+			t.Errorf("Expected ErrNoCertificate from empty store, got %v", err)
+		}
+	}
 }
 
 // TestGetCertificateConcurrentAccess tests concurrent certificate retrieval
@@ -506,3 +513,59 @@ func BenchmarkGetCertificate(b *testing.B) {
 		_, _ = store.GetCertificate(&tls.ClientHelloInfo{})
 	}
 }
+
+// TestLoadCachesLeaf tests that Load populates the parsed leaf
+func TestLoadCachesLeaf(t *testing.T) {
+	cert, err := Load("../../certs/server.crt", "../../certs/server.key")
+	if err != nil {
+		t.Fatalf("Failed to load certificates: %v", err)
+	}
+	if cert.Leaf == nil {
+		t.Fatal("Load should cache the parsed leaf")
+	}
+
+	// ParseLeaf works for certificates built without a cached leaf
+	uncached := &tls.Certificate{Certificate: cert.Certificate}
+	leaf, err := ParseLeaf(uncached)
+	if err != nil {
+		t.Fatalf("ParseLeaf failed: %v", err)
+	}
+	if !leaf.NotAfter.Equal(cert.Leaf.NotAfter) {
+		t.Error("ParseLeaf returned a different certificate")
+	}
+	if uncached.Leaf != nil {
+		t.Error("ParseLeaf should not modify the certificate")
+	}
+
+	if _, err := ParseLeaf(nil); err == nil {
+		t.Error("ParseLeaf should fail for a nil certificate")
+	}
+}
+
+// TestStoreParsedChain tests that the parsed leaf and chain follow updates
+func TestStoreParsedChain(t *testing.T) {
+	ca := newTestCA(t, "Test CA")
+	first := ca.issue(t, "first.example.com")
+	second := ca.issue(t, "second.example.com")
+	second.Certificate = append(second.Certificate, ca.cert.Raw)
+	second.Leaf = nil
+
+	store := New(first)
+	if store.Leaf() == nil || store.Leaf().Subject.CommonName != "first.example.com" {
+		t.Fatalf("Unexpected leaf: %v", store.Leaf())
+	}
+
+	store.Update(second)
+	if store.Leaf().Subject.CommonName != "second.example.com" {
+		t.Errorf("Leaf should follow updates, got %s", store.Leaf().Subject.CommonName)
+	}
+	chain := store.Chain()
+	if len(chain) != 2 || chain[1].Subject.CommonName != "Test CA" {
+		t.Errorf("Unexpected chain: %v", chain)
+	}
+
+	empty := New(nil)
+	if empty.Leaf() != nil || empty.Chain() != nil || empty.IsValid() {
+		t.Error("Empty store should have no parsed certificate")
+	}
+}
@@ -0,0 +1,69 @@
+package tlsstore
+
+import (
+	"crypto/tls"
+	"net/http"
+	"sync/atomic"
+)
+
+// Transport is an http.RoundTripper that trusts the servers signed by a
+// RootCAStore's bundle. Whenever the bundle is reloaded it rebuilds its
+// tls.Config with the new RootCAs and closes the idle connections of the
+// previous transport, so pooled connections verified against a retired CA
+// are not reused. Requests in flight finish on their existing connections.
+type Transport struct {
+	store *RootCAStore
+	base  *http.Transport
+
+	current atomic.Pointer[http.Transport]
+}
+
+// NewTransport returns a transport trusting store's bundle. base supplies
+// every other setting, including any client certificate; nil clones
+// http.DefaultTransport.
+func NewTransport(store *RootCAStore, base *http.Transport) *Transport {
+	if base == nil {
+		base = http.DefaultTransport.(*http.Transport)
+	}
+	t := &Transport{store: store, base: base.Clone()}
+	t.Refresh()
+	store.OnReload(t.Refresh)
+	return t
+}
+
+// RoundTrip sends req on the transport built for the current bundle
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.current.Load().RoundTrip(req)
+}
+
+// Refresh rebuilds the transport from the store's current pool and recycles
+// the previous transport's idle connections. It runs on every bundle
+// reload.
+func (t *Transport) Refresh() {
+	next := t.base.Clone()
+	cfg := next.TLSClientConfig
+	if cfg == nil {
+		cfg = &tls.Config{MinVersion: tls.VersionTLS12}
+	} else {
+		cfg = cfg.Clone()
+	}
+	cfg.RootCAs = t.store.Pool()
+
+	// Standard verification builds the chains; the store's chain check
+	// (such as key pinning) then runs on them
+	if t.store.chainCheck != nil {
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			return t.store.checkChains(cs.VerifiedChains, nil)
+		}
+	}
+	next.TLSClientConfig = cfg
+
+	if prev := t.current.Swap(next); prev != nil {
+		prev.CloseIdleConnections()
+	}
+}
+
+// CloseIdleConnections closes the current transport's idle connections
+func (t *Transport) CloseIdleConnections() {
+	t.current.Load().CloseIdleConnections()
+}
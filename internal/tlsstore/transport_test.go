@@ -0,0 +1,79 @@
+package tlsstore
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+// TestTransportRefresh tests that a bundle reload changes which servers are
+// trusted and recycles pooled connections
+func TestTransportRefresh(t *testing.T) {
+	ca := newTestCA(t, "Test Root")
+	other := newTestCA(t, "Other Root")
+
+	var conns atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{*ca.issue(t, "upstream.example.com")}}
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	writeFile(t, bundle, certPEM(other.cert.Raw), 0644)
+	roots, err := NewRootCAStore(bundle)
+	if err != nil {
+		t.Fatalf("NewRootCAStore failed: %v", err)
+	}
+
+	// The base transport's dialer is kept across rebuilds
+	base := &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+		},
+	}
+	client := &http.Client{Transport: NewTransport(roots, base)}
+	get := func() error {
+		resp, err := client.Get("https://upstream.example.com/")
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+
+	if err := get(); err == nil {
+		t.Fatal("Server signed by an untrusted CA should be rejected")
+	}
+
+	writeFile(t, bundle, certPEM(ca.cert.Raw), 0644)
+	if err := roots.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if err := get(); err != nil {
+		t.Fatalf("Request after bundle rotation failed: %v", err)
+	}
+	if err := get(); err != nil {
+		t.Fatalf("Second request failed: %v", err)
+	}
+	before := conns.Load()
+
+	// A reload drops idle connections, so the next request dials again
+	if err := roots.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if err := get(); err != nil {
+		t.Fatalf("Request after reload failed: %v", err)
+	}
+	if got := conns.Load(); got != before+1 {
+		t.Errorf("Expected a new connection after reload, got %d connections (had %d)", got, before)
+	}
+}
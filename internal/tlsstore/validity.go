@@ -0,0 +1,46 @@
+package tlsstore
+
+import (
+	"crypto/x509"
+	"fmt"
+	"log"
+	"time"
+
+	"tls-agent/internal/metrics"
+)
+
+// DefaultNotBeforeGrace tolerates certificates issued by a CA whose clock
+// runs slightly ahead of ours
+const DefaultNotBeforeGrace = 5 * time.Minute
+
+var (
+	clockSkew = metrics.NewGauge("tls_agent_cert_clock_skew_seconds",
+		"How far the NotBefore of the last accepted certificate was ahead of the local clock")
+	skewedCerts = metrics.NewCounter("tls_agent_cert_clock_skew_total",
+		"Certificates accepted within the NotBefore grace window")
+)
+
+// CheckValidity checks that leaf is valid at now. A NotBefore up to grace in
+// the future is accepted as clock skew: the skew is returned, logged, and
+// recorded in the skew metrics. Anything further ahead wraps ErrNotYetValid.
+func CheckValidity(leaf *x509.Certificate, now time.Time, grace time.Duration) (time.Duration, error) {
+	if now.After(leaf.NotAfter) {
+		return 0, fmt.Errorf("%w: expired at %s", ErrCertExpired, leaf.NotAfter.Format(time.RFC3339))
+	}
+
+	skew := leaf.NotBefore.Sub(now)
+	if skew <= 0 {
+		clockSkew.Set(0)
+		return 0, nil
+	}
+	if skew > grace {
+		return skew, fmt.Errorf("%w: valid from %s, %s ahead of the local clock (grace %s)",
+			ErrNotYetValid, leaf.NotBefore.Format(time.RFC3339), skew.Round(time.Second), grace)
+	}
+
+	clockSkew.Set(skew.Seconds())
+	skewedCerts.Inc()
+	log.Printf("Warning: certificate %q is valid from %s, %s ahead of the local clock; accepting within the %s grace window",
+		leaf.Subject.CommonName, leaf.NotBefore.Format(time.RFC3339), skew.Round(time.Second), grace)
+	return skew, nil
+}
@@ -0,0 +1,35 @@
+package tlsstore
+
+import (
+	"crypto/x509"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestCheckValidity tests the NotBefore grace window and expiry
+func TestCheckValidity(t *testing.T) {
+	now := time.Now()
+	leaf := &x509.Certificate{NotBefore: now.Add(2 * time.Minute), NotAfter: now.Add(24 * time.Hour)}
+
+	skew, err := CheckValidity(leaf, now, 5*time.Minute)
+	if err != nil {
+		t.Fatalf("Expected skew within grace to be accepted: %v", err)
+	}
+	if skew != 2*time.Minute {
+		t.Errorf("Expected 2m skew, got %s", skew)
+	}
+	if got := clockSkew.Value(); got != 120 {
+		t.Errorf("Expected skew gauge 120, got %v", got)
+	}
+
+	if _, err := CheckValidity(leaf, now, time.Minute); !errors.Is(err, ErrNotYetValid) {
+		t.Errorf("Expected ErrNotYetValid beyond grace, got %v", err)
+	}
+	if _, err := CheckValidity(leaf, now.Add(48*time.Hour), time.Minute); !errors.Is(err, ErrCertExpired) {
+		t.Errorf("Expected ErrCertExpired, got %v", err)
+	}
+	if skew, err := CheckValidity(leaf, now.Add(time.Hour), 0); err != nil || skew != 0 {
+		t.Errorf("Expected a valid certificate without skew, got %s, %v", skew, err)
+	}
+}
@@ -0,0 +1,141 @@
+package tlsstore
+
+import (
+	"errors"
+	"time"
+)
+
+// DefaultRetainedVersions is how many versions of the default certificate a
+// Store keeps for Rollback, including the one being served
+const DefaultRetainedVersions = 10
+
+// ErrUnknownVersion is returned by Rollback for a version that was never
+// stored or is no longer retained
+var ErrUnknownVersion = errors.New("tlsstore: version not retained")
+
+// Versioned is implemented by providers that number their certificates and
+// retain past ones, such as Store, so a bad rotation can be undone exactly
+type Versioned interface {
+	// Versions lists the retained versions, oldest first
+	Versions() []VersionInfo
+
+	// Rollback serves the certificate of a retained version again, as a
+	// new version, and returns it
+	Rollback(version uint64) (VersionInfo, error)
+}
+
+// VersionInfo describes one retained version of the default certificate
+type VersionInfo struct {
+	Managed
+
+	// Version increases by one on every Update or Rollback, starting at 1
+	Version uint64
+
+	// Stored is when this version was stored. Managed.Since is instead when
+	// its certificate was first served, which a rollback keeps.
+	Stored time.Time
+
+	// RollbackOf is the version this one restored, or 0
+	RollbackOf uint64
+
+	// Current reports whether this version is being served
+	Current bool
+}
+
+// store numbers e, serves it and retains it, returning the entry it
+// replaced. Callers other than New hold verMu.
+func (s *Store) store(e *entry) *entry {
+	s.version++
+	e.version = s.version
+	prev := s.cert.Load()
+	e.carry(prev)
+	s.cert.Store(e)
+
+	if e.cert != nil {
+		s.versions = append(s.versions, e)
+		s.trim()
+	}
+	return prev
+}
+
+// trim drops the oldest versions beyond the retention limit
+func (s *Store) trim() {
+	retain := s.retain
+	if retain == 0 {
+		retain = DefaultRetainedVersions
+	}
+	if n := len(s.versions) - retain; n > 0 {
+		clear(s.versions[:n])
+		s.versions = s.versions[n:]
+	}
+}
+
+// SetRetainedVersions sets how many versions are kept for Rollback,
+// including the current one, dropping the oldest beyond it. n below 1 is
+// treated as 1.
+func (s *Store) SetRetainedVersions(n int) {
+	s.verMu.Lock()
+	defer s.verMu.Unlock()
+	s.retain = max(n, 1)
+	s.trim()
+}
+
+// Version returns the version being served, or 0 for a store that has never
+// been given a certificate
+func (s *Store) Version() uint64 {
+	return s.load().version
+}
+
+// Versions lists the retained versions of the default certificate, oldest
+// first
+func (s *Store) Versions() []VersionInfo {
+	s.verMu.Lock()
+	defer s.verMu.Unlock()
+	current := s.cert.Load()
+	out := make([]VersionInfo, len(s.versions))
+	for i, e := range s.versions {
+		out[i] = versionInfo(e, e == current)
+	}
+	return out
+}
+
+// Rollback serves the certificate of a retained version again. It is stored
+// as a new version, so the one being replaced stays retained and a rollback
+// can itself be undone. Rolling back to the current version does nothing.
+func (s *Store) Rollback(version uint64) (VersionInfo, error) {
+	s.verMu.Lock()
+	var target *entry
+	for _, e := range s.versions {
+		if e.version == version {
+			target = e
+			break
+		}
+	}
+	if target == nil {
+		s.verMu.Unlock()
+		return VersionInfo{}, ErrUnknownVersion
+	}
+	if target == s.cert.Load() {
+		s.verMu.Unlock()
+		return versionInfo(target, true), nil
+	}
+
+	e := newEntry(target.cert, s.now())
+	e.source, e.since = target.source, target.since
+	e.rollbackOf = version
+	prev := s.store(e)
+	s.verMu.Unlock()
+
+	s.notify(prev, e)
+	return versionInfo(e, true), nil
+}
+
+func versionInfo(e *entry, current bool) VersionInfo {
+	return VersionInfo{
+		Managed:    managed(e, nil),
+		Version:    e.version,
+		Stored:     e.stored,
+		RollbackOf: e.rollbackOf,
+		Current:    current,
+	}
+}
@@ -0,0 +1,58 @@
+package tlsstore
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestStoreVersions tests that updates are numbered and retained up to the
+// limit, and that a rollback serves a retained version as a new one
+func TestStoreVersions(t *testing.T) {
+	ca := newTestCA(t, "Test Root")
+	a, b, c := ca.issue(t, "a.example.com"), ca.issue(t, "b.example.com"), ca.issue(t, "c.example.com")
+
+	store := New(a)
+	store.SetRetainedVersions(3)
+	store.Update(b)
+	store.Update(c)
+	if v := store.Version(); v != 3 {
+		t.Fatalf("Version() = %d, want 3", v)
+	}
+
+	var changes []Change
+	store.Subscribe(func(ch Change) { changes = append(changes, ch) })
+	info, err := store.Rollback(1)
+	if err != nil {
+		t.Fatalf("Rollback(1) failed: %v", err)
+	}
+	if info.Version != 4 || info.RollbackOf != 1 || info.Cert != a || !info.Current {
+		t.Errorf("Unexpected rollback version %+v", info)
+	}
+	if served, _ := store.GetCertificate(nil); served != a {
+		t.Error("Expected version 1's certificate to be served")
+	}
+	if len(changes) != 1 || changes[0].Old.Cert != c || changes[0].New.Cert != a {
+		t.Errorf("Expected subscribers to see the rollback, got %+v", changes)
+	}
+
+	// Version 1 fell out of the retained three
+	versions := store.Versions()
+	var numbers []uint64
+	for _, v := range versions {
+		numbers = append(numbers, v.Version)
+	}
+	if len(numbers) != 3 || numbers[0] != 2 || numbers[2] != 4 || !versions[2].Current || versions[0].Current {
+		t.Errorf("Versions() = %v, want [2 3 4] with 4 current", numbers)
+	}
+	if _, err := store.Rollback(1); !errors.Is(err, ErrUnknownVersion) {
+		t.Errorf("Rollback of a dropped version returned %v, want ErrUnknownVersion", err)
+	}
+
+	// Rolling back to the current version changes nothing
+	if info, err := store.Rollback(4); err != nil || info.Version != 4 || store.Version() != 4 {
+		t.Errorf("Rollback(current) = %+v, %v", info, err)
+	}
+	if _, err := store.Rollback(3); err != nil || store.Version() != 5 {
+		t.Errorf("Rollback(3) failed: %v, version %d", err, store.Version())
+	}
+}
@@ -0,0 +1,221 @@
+// Package watch multiplexes many file watches over a single fsnotify watcher.
+// Each registration gets its own debounce state, so a burst of writes to one
+// certificate pair does not delay the reload of another.
+package watch
+
+import (
+	"errors"
+	"log"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"tls-agent/internal/clock"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// ErrClosed is returned by Run when the underlying watcher shuts down
+var ErrClosed = errors.New("watch: file watcher closed")
+
+// kubernetesDataLink is the symlink swapped when a ConfigMap or Secret
+// volume is updated; its change affects every file in the directory
+const kubernetesDataLink = "..data"
+
+// Watcher dispatches file events from one fsnotify watcher to the handlers
+// registered for the affected paths
+type Watcher struct {
+	// Clock times debouncing; nil uses the wall clock. Set it before Run.
+	Clock clock.Clock
+
+	debounce time.Duration
+	fs       *fsnotify.Watcher
+
+	mu      sync.Mutex
+	targets map[string][]*target // cleaned path -> registrations
+	dirs    map[string]int       // watched directory -> registered paths in it
+}
+
+// target is one registration: a handler and its debounce state
+type target struct {
+	name    string
+	handler func()
+	due     time.Time // zero when nothing is pending
+}
+
+// New creates a watcher that runs a handler once its paths have been quiet
+// for debounce. A zero debounce runs the handler on every event.
+func New(debounce time.Duration) (*Watcher, error) {
+	fs, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	return &Watcher{
+		debounce: debounce,
+		fs:       fs,
+		targets:  make(map[string][]*target),
+		dirs:     make(map[string]int),
+	}, nil
+}
+
+// Add calls handler after any of paths changes. Parent directories are
+// watched rather than the files, so atomic replacements are seen. name
+// identifies the registration in logs. Empty and repeated paths are skipped,
+// so a combined file can be passed as both certificate and key. Add may be
+// called while Run is active.
+func (w *Watcher) Add(name string, handler func(), paths ...string) error {
+	t := &target{name: name, handler: handler}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	seen := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		if p == "" {
+			continue
+		}
+		p = pathKey(p)
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		dir := filepath.Dir(p)
+		if w.dirs[dir] == 0 {
+			if err := w.fs.Add(dir); err != nil {
+				return err
+			}
+		}
+		w.dirs[dir]++
+		w.targets[p] = append(w.targets[p], t)
+	}
+	return nil
+}
+
+// Paths returns the registered file paths in sorted order
+func (w *Watcher) Paths() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	paths := make([]string, 0, len(w.targets))
+	for p := range w.targets {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Run dispatches events until stopChan is closed, then releases the
+// underlying watcher. Handlers run on the Run goroutine one at a time.
+func (w *Watcher) Run(stopChan <-chan struct{}) error {
+	defer w.fs.Close()
+
+	c := clock.Or(w.Clock)
+	timer := c.NewTimer(time.Hour)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case event, ok := <-w.fs.Events:
+			if !ok {
+				return ErrClosed
+			}
+			if !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) && !event.Has(fsnotify.Rename) {
+				continue
+			}
+			w.schedule(event.Name, c.Now())
+
+		case err, ok := <-w.fs.Errors:
+			if !ok {
+				return ErrClosed
+			}
+			log.Println("Watch: watcher error:", err)
+
+		case <-timer.C():
+		case <-stopChan:
+			return nil
+		}
+
+		// Run everything that is due and re-arm for the earliest pending deadline
+		now := c.Now()
+		for _, t := range w.due(now) {
+			log.Printf("Watch: %s changed", t.name)
+			t.handler()
+		}
+		if next, ok := w.next(); ok {
+			timer.Stop()
+			timer.Reset(max(next.Sub(now), 0))
+		}
+	}
+}
+
+// pathKey normalizes a path for lookups. Windows paths are
+// case-insensitive, and events may not use the case the path was added with.
+func pathKey(p string) string {
+	p = filepath.Clean(p)
+	if runtime.GOOS == "windows" {
+		p = strings.ToLower(p)
+	}
+	return p
+}
+
+// schedule marks the registrations affected by a change to path as pending
+func (w *Watcher) schedule(path string, now time.Time) {
+	path = pathKey(path)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var affected []*target
+	if filepath.Base(path) == kubernetesDataLink {
+		dir := filepath.Dir(path)
+		for p, ts := range w.targets {
+			if filepath.Dir(p) == dir {
+				affected = append(affected, ts...)
+			}
+		}
+	} else {
+		affected = w.targets[path]
+	}
+
+	for _, t := range affected {
+		t.due = now.Add(w.debounce)
+	}
+}
+
+// due clears and returns the registrations whose quiet period has elapsed
+func (w *Watcher) due(now time.Time) []*target {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var ready []*target
+	seen := make(map[*target]bool)
+	for _, ts := range w.targets {
+		for _, t := range ts {
+			if seen[t] || t.due.IsZero() || t.due.After(now) {
+				continue
+			}
+			seen[t] = true
+			t.due = time.Time{}
+			ready = append(ready, t)
+		}
+	}
+	return ready
+}
+
+// next returns the earliest pending deadline
+func (w *Watcher) next() (time.Time, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var earliest time.Time
+	for _, ts := range w.targets {
+		for _, t := range ts {
+			if !t.due.IsZero() && (earliest.IsZero() || t.due.Before(earliest)) {
+				earliest = t.due
+			}
+		}
+	}
+	return earliest, !earliest.IsZero()
+}
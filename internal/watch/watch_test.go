@@ -0,0 +1,169 @@
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tls-agent/internal/clock"
+)
+
+// startWatcher runs w until the test ends
+func startWatcher(t *testing.T, w *Watcher) {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = w.Run(stop)
+	}()
+	t.Cleanup(func() {
+		close(stop)
+		<-done
+	})
+	// Give the watcher time to start before files are written
+	time.Sleep(50 * time.Millisecond)
+}
+
+// waitFor polls cond until it holds or the deadline passes
+func waitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("Condition not met before deadline")
+}
+
+// TestDispatch tests that events reach only the handler registered for the path
+func TestDispatch(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.crt"), filepath.Join(dir, "b.crt")
+
+	w, err := New(0)
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+	var hitsA, hitsB atomic.Int32
+	if err := w.Add("a", func() { hitsA.Add(1) }, a); err != nil {
+		t.Fatalf("Failed to add a: %v", err)
+	}
+	// A combined file registers as both certificate and key, with no key
+	// file; it is watched once
+	if err := w.Add("b", func() { hitsB.Add(1) }, b, "", b); err != nil {
+		t.Fatalf("Failed to add b: %v", err)
+	}
+	if got := w.Paths(); len(got) != 2 {
+		t.Errorf("Expected 2 watched paths, got %v", got)
+	}
+	if n := len(w.targets[pathKey(b)]); n != 1 {
+		t.Errorf("Expected b registered once, got %d", n)
+	}
+	startWatcher(t, w)
+
+	if err := os.WriteFile(a, []byte("a"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	waitFor(t, func() bool { return hitsA.Load() > 0 })
+
+	// Unrelated files in the same directory are ignored
+	if err := os.WriteFile(filepath.Join(dir, "other"), []byte("x"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if hitsB.Load() != 0 {
+		t.Errorf("Handler for b should not run, ran %d times", hitsB.Load())
+	}
+}
+
+// TestPerRegistrationDebounce tests that a burst runs the handler once and
+// does not hold back other registrations
+func TestPerRegistrationDebounce(t *testing.T) {
+	dir := t.TempDir()
+	cert, key, other := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), filepath.Join(dir, "ca.pem")
+
+	w, err := New(200 * time.Millisecond)
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+	var pair, bundle atomic.Int32
+	w.Add("pair", func() { pair.Add(1) }, cert, key)
+	w.Add("bundle", func() { bundle.Add(1) }, other)
+	startWatcher(t, w)
+
+	for i := 0; i < 5; i++ {
+		os.WriteFile(cert, []byte{byte(i)}, 0644)
+		os.WriteFile(key, []byte{byte(i)}, 0600)
+		time.Sleep(20 * time.Millisecond)
+	}
+	os.WriteFile(other, []byte("ca"), 0644)
+
+	waitFor(t, func() bool { return pair.Load() > 0 && bundle.Load() > 0 })
+	time.Sleep(300 * time.Millisecond)
+	if n := pair.Load(); n != 1 {
+		t.Errorf("Expected one debounced reload of the pair, got %d", n)
+	}
+}
+
+// TestDebounceClock tests that debouncing runs on the watcher's clock
+func TestDebounceClock(t *testing.T) {
+	dir := t.TempDir()
+	cert := filepath.Join(dir, "tls.crt")
+
+	w, err := New(time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+	fake := clock.NewFake(time.Now())
+	w.Clock = fake
+	var hits atomic.Int32
+	w.Add("pair", func() { hits.Add(1) }, cert)
+	startWatcher(t, w)
+
+	os.WriteFile(cert, []byte("v2"), 0644)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := fake.BlockUntil(ctx, 1); err != nil {
+		t.Fatalf("Debounce timer not armed: %v", err)
+	}
+	if hits.Load() != 0 {
+		t.Fatal("Handler ran before the debounce interval passed")
+	}
+
+	fake.Advance(time.Hour)
+	waitFor(t, func() bool { return hits.Load() == 1 })
+}
+
+// TestKubernetesDataLink tests that a ..data swap triggers every handler in the directory
+func TestKubernetesDataLink(t *testing.T) {
+	dir := t.TempDir()
+
+	w, err := New(0)
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+	var hits atomic.Int32
+	w.Add("secret", func() { hits.Add(1) }, filepath.Join(dir, "tls.crt"))
+	startWatcher(t, w)
+
+	if err := os.WriteFile(filepath.Join(dir, "..data"), []byte("v2"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	waitFor(t, func() bool { return hits.Load() > 0 })
+}
+
+// TestPathKey tests that paths are cleaned, and compared case-insensitively on Windows
+func TestPathKey(t *testing.T) {
+	if got, want := pathKey("certs/./sub/../server.crt"), filepath.Join("certs", "server.crt"); got != want {
+		t.Errorf("pathKey = %q, want %q", got, want)
+	}
+	upper, lower := pathKey("certs/Server.CRT"), pathKey("certs/server.crt")
+	if windows := runtime.GOOS == "windows"; (upper == lower) != windows {
+		t.Errorf("pathKey case folding = %v, want %v", upper == lower, windows)
+	}
+}
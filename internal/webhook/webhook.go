@@ -0,0 +1,130 @@
+// Package webhook publishes the CA bundle that Kubernetes needs to call an
+// admission webhook served by the agent. Every time the serving certificate
+// rotates, the bundle is written to a file and/or patched into the
+// caBundle of the mutating and validating webhook configurations, so the
+// API server trusts the new certificate without manual steps.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+
+	"tls-agent/internal/kube"
+	"tls-agent/internal/notify"
+	"tls-agent/internal/tlsstore"
+)
+
+// Configuration names the webhook configuration objects to keep up to date
+type Configuration struct {
+	// Kind is kube.WebhookMutating or kube.WebhookValidating
+	Kind string
+	Name string
+
+	// Webhooks limits the update to the named webhooks; empty updates all
+	Webhooks []string
+}
+
+// Publisher writes the CA bundle for the serving certificate wherever
+// Kubernetes reads it. It implements notify.Notifier and republishes after
+// every successful reload.
+type Publisher struct {
+	// Bundle returns the PEM CA bundle that verifies the serving certificate
+	Bundle func() ([]byte, error)
+
+	// File, if set, receives the bundle
+	File string
+
+	// Client patches Configurations; it may be nil when there are none
+	Client         *kube.Client
+	Configurations []Configuration
+
+	mu        sync.Mutex
+	published []byte
+}
+
+// Publish writes the current bundle unless it has already been published
+func (p *Publisher) Publish(ctx context.Context) error {
+	bundle, err := p.Bundle()
+	if err != nil {
+		return fmt.Errorf("webhook: CA bundle: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if bytes.Equal(bundle, p.published) {
+		return nil
+	}
+
+	var errs []error
+	if p.File != "" {
+		// A CA bundle is public
+		if err := tlsstore.WriteFile(p.File, bundle, 0644); err != nil {
+			errs = append(errs, fmt.Errorf("webhook: write CA bundle: %w", err))
+		}
+	}
+	for _, c := range p.Configurations {
+		if err := p.Client.SetWebhookCABundle(ctx, c.Kind, c.Name, c.Webhooks, bundle); err != nil {
+			errs = append(errs, fmt.Errorf("webhook: %w", err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	p.published = bundle
+	log.Println("Webhook: published CA bundle")
+	return nil
+}
+
+// Notify republishes the bundle after a successful reload
+func (p *Publisher) Notify(ctx context.Context, e notify.Event) error {
+	if e.Type != notify.EventReloadSucceeded {
+		return nil
+	}
+	return p.Publish(ctx)
+}
+
+// ChainBundle returns the CA certificates of a served chain as PEM: every
+// certificate after the leaf, or the leaf itself when it is self-signed and
+// so is its own CA
+func ChainBundle(chain []*x509.Certificate) ([]byte, error) {
+	if len(chain) == 0 {
+		return nil, errors.New("no certificate")
+	}
+	cas := chain[1:]
+	if len(cas) == 0 {
+		leaf := chain[0]
+		if leaf.CheckSignatureFrom(leaf) != nil {
+			return nil, errors.New("chain has no CA certificate; set a CA file")
+		}
+		cas = chain
+	}
+
+	var buf bytes.Buffer
+	for _, cert := range cas {
+		pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	}
+	return buf.Bytes(), nil
+}
+
+// FileBundle returns a Bundle reading the PEM bundle at path on every call,
+// so a rotated CA file is picked up with the next certificate
+func FileBundle(path string) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if block, _ := pem.Decode(data); block == nil || block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("no certificates in %s", path)
+		}
+		return data, nil
+	}
+}
@@ -0,0 +1,101 @@
+package webhook
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"tls-agent/internal/notify"
+	"tls-agent/pkg/agenttest"
+)
+
+// TestChainBundle tests which certificates of a chain form the CA bundle
+func TestChainBundle(t *testing.T) {
+	ca := agenttest.NewCA(t)
+	leaf := ca.IssueTLS(t, "webhook.default.svc").Leaf
+
+	bundle, err := ChainBundle([]*x509.Certificate{leaf, ca.Cert})
+	if err != nil {
+		t.Fatalf("Failed to build bundle: %v", err)
+	}
+	block, rest := pem.Decode(bundle)
+	if block == nil || len(rest) != 0 || string(block.Bytes) != string(ca.Cert.Raw) {
+		t.Error("Expected the bundle to hold only the CA certificate")
+	}
+
+	if bundle, err := ChainBundle([]*x509.Certificate{ca.Cert}); err != nil || len(bundle) == 0 {
+		t.Errorf("Expected a self-signed leaf to be its own bundle, got %v", err)
+	}
+	if _, err := ChainBundle([]*x509.Certificate{leaf}); err == nil {
+		t.Error("Expected an error for a leaf without its CA")
+	}
+	if _, err := ChainBundle(nil); err == nil {
+		t.Error("Expected an error for an empty chain")
+	}
+}
+
+// TestPublisher tests that the bundle is written after reloads and only
+// when it changes
+func TestPublisher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ca-bundle.pem")
+	bundle := []byte("first")
+	calls := 0
+	p := &Publisher{
+		Bundle: func() ([]byte, error) { calls++; return bundle, nil },
+		File:   path,
+	}
+	ctx := context.Background()
+
+	if err := p.Publish(ctx); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "first" {
+		t.Errorf("Expected the bundle in %s, got %q", path, data)
+	}
+
+	// Unchanged bundles are not rewritten
+	os.Remove(path)
+	if err := p.Notify(ctx, notify.Event{Type: notify.EventReloadSucceeded}); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Expected an unchanged bundle not to be rewritten")
+	}
+
+	// Other events are ignored
+	bundle = []byte("second")
+	p.Notify(ctx, notify.Event{Type: notify.EventReloadFailed})
+	if calls != 2 {
+		t.Errorf("Expected only reloads to publish, got %d bundle reads", calls)
+	}
+	if err := p.Notify(ctx, notify.Event{Type: notify.EventReloadSucceeded}); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "second" {
+		t.Errorf("Expected the new bundle, got %q", data)
+	}
+
+	p.Bundle = func() ([]byte, error) { return nil, errors.New("no certificate") }
+	if err := p.Publish(ctx); err == nil {
+		t.Error("Expected bundle errors to be returned")
+	}
+}
+
+// TestFileBundle tests reading a configured CA file
+func TestFileBundle(t *testing.T) {
+	ca := agenttest.NewCA(t)
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Cert.Raw}), 0644)
+
+	if data, err := FileBundle(path)(); err != nil || len(data) == 0 {
+		t.Errorf("Expected the CA file contents, got %v", err)
+	}
+	os.WriteFile(path, []byte("not pem"), 0644)
+	if _, err := FileBundle(path)(); err == nil {
+		t.Error("Expected an error for a file without certificates")
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"tls-agent/internal/agent"
+	"tls-agent/internal/features"
+	"tls-agent/internal/inventory"
+	"tls-agent/internal/stapling"
+	"tls-agent/internal/tlsstore"
+)
+
+// inventoryFor returns the inventory of the certificates in store. The
+// default certificate's source is its file, or the distribution server it is
+// pulled from.
+func inventoryFor(cfg features.Features, agentConfig agent.Config, store *tlsstore.Store, stapler *stapling.Manager) *inventory.Inventory {
+	inv := &inventory.Inventory{Store: store, DefaultSource: agentConfig.CertFile, Stapler: stapler}
+	if remote := cfg.Distribution.Remote; remote.URL != "" {
+		name := remote.Name
+		if name == "" {
+			name = inventory.DefaultName
+		}
+		inv.DefaultSource = remote.URL + "/v1/certificates/" + url.PathEscape(name)
+	}
+	return inv
+}
+
+// runList implements `tls-agent list`: it prints the running agent's
+// certificate inventory as a table, or as JSON with --json. It returns the
+// exit code.
+func runList(adminURL string, asJSON bool, out io.Writer) int {
+	client := adminClient(5 * time.Second)
+	resp, err := client.Get(adminURL + "/certificates")
+	if err != nil {
+		fmt.Fprintf(out, "Could not reach agent at %s: %v\n", adminURL, err)
+		return 1
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(out, "Listing certificates failed: %s\n", resp.Status)
+		return 1
+	}
+
+	var body struct {
+		Certificates []inventory.Certificate `json:"certificates"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		fmt.Fprintf(out, "Invalid response from agent: %v\n", err)
+		return 1
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(body)
+		return 0
+	}
+	inventory.WriteTable(out, body.Certificates)
+	return 0
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tls-agent/internal/agent"
+	"tls-agent/internal/features"
+	"tls-agent/internal/tlsstore"
+)
+
+// TestListCommand tests the list command against a fake admin API
+func TestListCommand(t *testing.T) {
+	admin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/certificates" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"certificates":[{"name":"default","source":"certs/server.crt","sans":["www.example.com"],"issuer":"CN=Test CA","serial":"abc","not_after":"2027-01-02T03:04:05Z","last_rotation":"2026-01-02T03:04:05Z","ocsp":"good"}]}`))
+	}))
+	defer admin.Close()
+	address := admin.URL
+
+	var out bytes.Buffer
+	if code := runList(address, false, &out); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, out.String())
+	}
+	for _, want := range []string{"SANS", "www.example.com", "CN=Test CA", "abc", "good", "certs/server.crt"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Output missing %q:\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	if code := runList(address, true, &out); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, out.String())
+	}
+	var body map[string][]map[string]any
+	if err := json.Unmarshal(out.Bytes(), &body); err != nil || body["certificates"][0]["serial"] != "abc" {
+		t.Errorf("Expected JSON output, got %s (%v)", out.String(), err)
+	}
+
+	out.Reset()
+	if code := runList("http://127.0.0.1:1", false, &out); code == 0 {
+		t.Error("Expected non-zero exit code when the agent is unreachable")
+	}
+}
+
+// TestInventoryFor tests the default certificate's source
+func TestInventoryFor(t *testing.T) {
+	cfg := features.DefaultFeatures()
+	agentConfig := agent.Config{CertFile: "certs/server.crt"}
+	if inv := inventoryFor(cfg, agentConfig, tlsstore.New(nil), nil); inv.DefaultSource != "certs/server.crt" {
+		t.Errorf("Expected the certificate file, got %q", inv.DefaultSource)
+	}
+
+	cfg.Distribution.Remote.URL = "https://certs.internal:9443"
+	if inv := inventoryFor(cfg, agentConfig, tlsstore.New(nil), nil); inv.DefaultSource != "https://certs.internal:9443/v1/certificates/default" {
+		t.Errorf("Expected the distribution URL, got %q", inv.DefaultSource)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/pem"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"tls-agent/internal/features"
+	"tls-agent/internal/keyless"
+	"tls-agent/pkg/agenttest"
+)
+
+// TestKeylessClient tests that signing requests reach a key server that
+// requires a client certificate only when one is configured
+func TestKeylessClient(t *testing.T) {
+	dir := t.TempDir()
+	ca := agenttest.NewCA(t)
+	served := ca.IssueTLS(t, "shop.example.com")
+	handler, err := keyless.NewHandler(served.PrivateKey.(crypto.Signer))
+	if err != nil {
+		t.Fatalf("NewHandler failed: %v", err)
+	}
+	srv := httptest.NewUnstartedServer(handler)
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{*ca.IssueTLS(t, "localhost")},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    ca.Pool,
+	}
+	srv.StartTLS()
+	defer srv.Close()
+	server := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+
+	bundle := filepath.Join(dir, "ca.pem")
+	certFile := filepath.Join(dir, "served.crt")
+	os.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Cert.Raw}), 0644)
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: served.Certificate[0]}), 0644)
+	certPEM, keyPEM, _ := ca.Issue(t, "agent.example.com")
+	clientCert, clientKey := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	os.WriteFile(clientCert, certPEM, 0644)
+	os.WriteFile(clientKey, keyPEM, 0600)
+
+	sign := func(cfg features.KeylessConfig) error {
+		client, err := keylessClient(cfg, &upstreamTrust{})
+		if err != nil {
+			t.Fatalf("keylessClient failed: %v", err)
+		}
+		cert, err := keyless.LoadCertificate(certFile, []string{server}, client, time.Second)
+		if err != nil {
+			t.Fatalf("LoadCertificate failed: %v", err)
+		}
+		digest := sha256.Sum256([]byte("hello"))
+		_, err = cert.PrivateKey.(crypto.Signer).Sign(rand.Reader, digest[:], crypto.SHA256)
+		return err
+	}
+
+	if err := sign(features.KeylessConfig{CABundle: bundle}); err == nil {
+		t.Error("Expected the key server to refuse a client without a certificate")
+	}
+	if err := sign(features.KeylessConfig{CABundle: bundle, CertFile: clientCert, KeyFile: clientKey}); err != nil {
+		t.Errorf("Expected signing with a client certificate to succeed, got %v", err)
+	}
+}
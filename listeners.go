@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"slices"
+	"time"
+
+	"tls-agent/internal/connfilter"
+	"tls-agent/internal/conntrack"
+	"tls-agent/internal/features"
+	"tls-agent/internal/handshake"
+	"tls-agent/internal/tlsconfig"
+)
+
+// listenerOptions are applied to every TLS listener the agent serves: the
+// public one and dedicated tenant listeners
+type listenerOptions struct {
+	filter  *connfilter.Filter
+	limiter *handshake.Limiter
+	tracker *conntrack.Tracker
+	alpn    []string
+	http2   features.HTTP2Config
+}
+
+// configure applies the ALPN and HTTP/2 settings to server. HTTP/1.1 is
+// always served; HTTP/2 when enabled and, with an explicit ALPN list,
+// listed in it.
+func (o listenerOptions) configure(server *http.Server) {
+	h2 := o.http2.Enabled && (len(o.alpn) == 0 || slices.Contains(o.alpn, "h2"))
+	server.Protocols = new(http.Protocols)
+	server.Protocols.SetHTTP1(true)
+	server.Protocols.SetHTTP2(h2)
+	if h2 && o.http2.MaxConcurrentStreams > 0 {
+		server.HTTP2 = &http.HTTP2Config{MaxConcurrentStreams: o.http2.MaxConcurrentStreams}
+	}
+	if o.http2.IdleTimeout > 0 {
+		server.IdleTimeout = time.Duration(o.http2.IdleTimeout) * time.Second
+	}
+	if len(o.alpn) > 0 {
+		server.TLSConfig.NextProtos = slices.Clone(o.alpn)
+	}
+}
+
+// serve returns a function serving server over TLS on ln, or on a new
+// listener for server.Addr when ln is nil, with the connection filter,
+// handshake limiter and rotation policy applied when set; name labels the
+// listener in metrics, including its negotiated key exchanges
+func (o listenerOptions) serve(server *http.Server, ln net.Listener, name string) func() error {
+	o.configure(server)
+	server.ConnState = tlsconfig.HandshakeMetrics(name)
+	if o.tracker != nil {
+		record, track := server.ConnState, o.tracker.ConnState(name)
+		server.ConnState = func(conn net.Conn, state http.ConnState) {
+			record(conn, state)
+			track(conn, state)
+		}
+	}
+	var tlsCfg *tls.Config
+	if o.limiter != nil {
+		tlsCfg = handshakeConfig(server)
+	}
+	return func() error {
+		if ln == nil && o.filter == nil && o.limiter == nil {
+			return server.ListenAndServeTLS("", "")
+		}
+		if ln == nil {
+			var err error
+			if ln, err = net.Listen("tcp", server.Addr); err != nil {
+				return err
+			}
+		}
+		if o.filter != nil {
+			ln = connfilter.Wrap(name, ln, o.filter)
+		}
+		if o.limiter != nil {
+			return server.Serve(o.limiter.Listen(name, ln, tlsCfg))
+		}
+		return server.ServeTLS(ln, "", "")
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"testing"
+
+	"tls-agent/internal/features"
+)
+
+// getProto serves one request under opts and returns the protocol used
+func getProto(t *testing.T, opts listenerOptions) string {
+	t.Helper()
+
+	certFile, keyFile := writeTestPair(t, t.TempDir(), "server")
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Failed to load pair: %v", err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	server := &http.Server{
+		Handler:   http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		TLSConfig: &tls.Config{Certificates: []tls.Certificate{cert}},
+	}
+	go opts.serve(server, ln, "test")()
+	defer server.Close()
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		ForceAttemptHTTP2: true,
+	}}
+	resp, err := client.Get("https://" + ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to get: %v", err)
+	}
+	resp.Body.Close()
+	return resp.Proto
+}
+
+// TestListenerOptionsHTTP2 tests the HTTP/2 and ALPN settings
+func TestListenerOptionsHTTP2(t *testing.T) {
+	enabled := features.DefaultHTTP2Config()
+	if got := getProto(t, listenerOptions{http2: enabled}); got != "HTTP/2.0" {
+		t.Errorf("Expected HTTP/2 by default, got %s", got)
+	}
+	if got := getProto(t, listenerOptions{http2: features.HTTP2Config{}}); got != "HTTP/1.1" {
+		t.Errorf("Expected HTTP/1.1 with HTTP/2 disabled, got %s", got)
+	}
+	if got := getProto(t, listenerOptions{http2: enabled, alpn: []string{"http/1.1", "h2"}}); got != "HTTP/1.1" {
+		t.Errorf("Expected the server's ALPN preference to pick HTTP/1.1, got %s", got)
+	}
+	if got := getProto(t, listenerOptions{http2: enabled, alpn: []string{"http/1.1"}}); got != "HTTP/1.1" {
+		t.Errorf("Expected HTTP/2 off when not listed in ALPN, got %s", got)
+	}
+
+	server := &http.Server{TLSConfig: &tls.Config{}}
+	listenerOptions{http2: features.HTTP2Config{Enabled: true, MaxConcurrentStreams: 10, IdleTimeout: 30}}.configure(server)
+	if server.HTTP2 == nil || server.HTTP2.MaxConcurrentStreams != 10 || server.IdleTimeout.Seconds() != 30 {
+		t.Errorf("Expected the stream limit and idle timeout to be set, got %+v, %v", server.HTTP2, server.IdleTimeout)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"sync"
+)
+
+// reopenableFile is an append-only log destination that can be reopened
+// after logrotate moves the file away
+type reopenableFile struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+}
+
+// Open opens path for appending, creating it if needed
+func (l *reopenableFile) Open(path string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.path = path
+	return l.reopenLocked()
+}
+
+// Reopen closes the current file and opens the path again
+func (l *reopenableFile) Reopen() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.path == "" {
+		return nil
+	}
+	return l.reopenLocked()
+}
+
+func (l *reopenableFile) reopenLocked() error {
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+	if l.f != nil {
+		l.f.Close()
+	}
+	l.f = f
+	return nil
+}
+
+// Write writes p to the current file
+func (l *reopenableFile) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return 0, errors.New("log file not open")
+	}
+	return l.f.Write(p)
+}
+
+// Sync flushes the current file to disk
+func (l *reopenableFile) Sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	return l.f.Sync()
+}
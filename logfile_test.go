@@ -0,0 +1,34 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestReopenableFile tests that writes go to the new file after a rotation
+func TestReopenableFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "agent.log")
+
+	var l reopenableFile
+	if err := l.Open(path); err != nil {
+		t.Fatalf("Failed to open log file: %v", err)
+	}
+	l.Write([]byte("before\n"))
+
+	// Simulate logrotate moving the file away
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatalf("Failed to rotate: %v", err)
+	}
+	if err := l.Reopen(); err != nil {
+		t.Fatalf("Failed to reopen: %v", err)
+	}
+	l.Write([]byte("after\n"))
+
+	rotated, _ := os.ReadFile(path + ".1")
+	current, _ := os.ReadFile(path)
+	if string(rotated) != "before\n" || string(current) != "after\n" {
+		t.Errorf("Unexpected contents: rotated=%q current=%q", rotated, current)
+	}
+}
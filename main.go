@@ -3,112 +3,696 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
-	"os/signal"
-	"syscall"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"tls-agent/internal/acme"
+	"tls-agent/internal/admin"
 	"tls-agent/internal/agent"
+	"tls-agent/internal/authz"
+	"tls-agent/internal/backup"
+	"tls-agent/internal/chaos"
+	"tls-agent/internal/conntrack"
+	"tls-agent/internal/ctmonitor"
+	"tls-agent/internal/dashboard"
+	"tls-agent/internal/deploy"
+	"tls-agent/internal/distribution"
+	"tls-agent/internal/ech"
 	"tls-agent/internal/features"
+	"tls-agent/internal/health"
+	"tls-agent/internal/hooks"
+	"tls-agent/internal/keyage"
+	"tls-agent/internal/keyless"
+	"tls-agent/internal/kube"
+	"tls-agent/internal/leader"
+	"tls-agent/internal/lifecycle"
+	"tls-agent/internal/management"
+	"tls-agent/internal/metrics"
+	"tls-agent/internal/notify"
+	"tls-agent/internal/pidfile"
+	"tls-agent/internal/policy"
+	"tls-agent/internal/probe"
+	"tls-agent/internal/proxy"
+	"tls-agent/internal/requestid"
+	"tls-agent/internal/selftest"
+	"tls-agent/internal/signals"
+	"tls-agent/internal/stapling"
+	"tls-agent/internal/storage"
+	"tls-agent/internal/systemd"
+	"tls-agent/internal/tenant"
+	"tls-agent/internal/tlsconfig"
 	"tls-agent/internal/tlsstore"
+	"tls-agent/internal/watch"
+	"tls-agent/internal/webhook"
 )
 
 func main() {
-	// Load feature configuration
-	featureLoader := features.NewConfigLoader()
+	started := time.Now()
+	if hasFlag(os.Args[1:], "--version") {
+		printVersion(os.Stdout)
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(runConfig(os.Args[2:], os.Stdout))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		os.Exit(runReplay(os.Args[2:], os.Stdout))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "soak" {
+		os.Exit(runSoak(os.Args[2:], os.Stdout))
+	}
+	featureLoader, err := loadFeatures()
+	if err != nil {
+		log.Fatalf("Invalid features config: %v", err)
+	}
+	featureConfig := featureLoader.Get()
 
-	// Try to load from config file if specified
-	if configPath := os.Getenv("FEATURES_CONFIG_PATH"); configPath != "" {
-		if err := featureLoader.LoadFromYAML(configPath); err != nil {
-			if err := featureLoader.LoadFromJSON(configPath); err != nil {
-				log.Printf("Warning: Could not load features config from %s: %v\n", configPath, err)
-			}
+	if len(os.Args) > 1 && os.Args[1] == "status" {
+		os.Exit(runStatus(adminURL(featureConfig)+admin.APIPrefix, hasFlag(os.Args[2:], "--json"), os.Stdout))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "list" {
+		os.Exit(runList(adminURL(featureConfig)+admin.APIPrefix, hasFlag(os.Args[2:], "--json"), os.Stdout))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "restore" {
+		os.Exit(runRestore(adminURL(featureConfig)+admin.APIPrefix, os.Args[2:], os.Stdout))
+	}
+
+	tlsstore.SetPermissionPolicy(tlsstore.PermissionPolicy{
+		Mode:  featureConfig.KeyPermissions.Policy,
+		Owner: featureConfig.KeyPermissions.Owner,
+	})
+	tlsstore.SetMaxFileSize(int64(featureConfig.MaxCertFileSize))
+
+	if hasFlag(os.Args[1:], "--self-test") {
+		os.Exit(runSelfTest(featureConfig, os.Stdout, hasFlag(os.Args[1:], "--json")))
+	}
+
+	daemon := parseDaemonOptions(os.Args[1:])
+	if daemon.background {
+		pid, err := daemonize(daemon, os.Args[1:])
+		if err != nil {
+			log.Fatal(err)
 		}
+		log.Printf("TLS Agent started in the background (pid %d)", pid)
+		return
+	}
+	if err := redirectOutput(daemon.stdout, daemon.stderr); err != nil {
+		log.Fatal(err)
+	}
+	var pidFile *pidfile.File
+	if daemon.pidFile != "" {
+		pidFile = acquirePIDFile(daemon.pidFile)
 	}
 
-	// Override with environment variables (takes precedence)
-	if err := featureLoader.LoadFromEnv(); err != nil {
-		log.Printf("Warning: Could not load features from environment: %v\n", err)
+	if featureConfig.LogFile != "" {
+		if err := logFile.Open(featureConfig.LogFile); err != nil {
+			log.Fatal(err)
+		}
+		log.SetOutput(&logFile)
 	}
 
-	featureConfig := featureLoader.Get()
+	if featureConfig.Logging {
+		log.Printf("TLS Agent %s", version)
+	}
 	featureLoader.LogFeatures()
+	registerBuildInfo()
+	if featureConfig.FIPS.RequireModule && !tlsconfig.FIPSModule() {
+		log.Fatal("fips.require_module is set but the Go FIPS 140-3 module is not enabled (GODEBUG=fips140=on)")
+	}
 
-	cert, err := tlsstore.Load("certs/server.crt", "certs/server.key")
+	registry, err := buildSignals(featureConfig.Signals)
 	if err != nil {
 		log.Fatal(err)
 	}
+	registry.Subscribe(signals.ActionRotateLogs, func() {
+		if err := logFile.Reopen(); err != nil {
+			log.Println("Failed to reopen log file:", err)
+		}
+	})
 
-	store := tlsstore.New(cert)
+	// Startup phase of the self-test; ports are bound for real below
+	if report := selftest.Run(selfTestChecks(featureConfig, false)); !report.Passed {
+		for _, res := range report.Results {
+			if res.Status == selftest.StatusFail {
+				log.Printf("Warning: self-test %s failed: %s", res.Name, res.Detail)
+			}
+		}
+	}
 
+	runner := &lifecycle.Runner{
+		TaskTimeout: time.Duration(featureConfig.AgentShutdownTimeout) * time.Second,
+		Logging:     featureConfig.Logging,
+	}
+	if featureConfig.GracefulShutdown {
+		runner.ShutdownTimeout = time.Duration(featureConfig.ShutdownTimeout) * time.Second
+	} else if featureConfig.Logging {
+		log.Println("Graceful shutdown feature disabled")
+	}
+
+	listeners, err := systemd.Listeners()
+	if err != nil {
+		log.Fatal(err)
+	}
+	activated := activatedListeners(listeners)
+	watchdog, err := systemd.WatchdogInterval()
+	if err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	cache, err := buildStorage(featureConfig.Storage)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if cache != nil {
+		runner.OnShutdown(func(context.Context) error { return cache.Close() })
+	}
+
+	agentConfig := agent.DefaultConfig()
+	var faults *chaos.Injector
+	if c := featureConfig.Chaos; c.Enabled {
+		faults = chaos.New(chaos.Config{
+			LoadFailureRate:  c.LoadFailureRate,
+			SlowReadRate:     c.SlowReadRate,
+			SlowReadDelay:    time.Duration(c.SlowReadDelay) * time.Millisecond,
+			WatcherErrorRate: c.WatcherErrorRate,
+			Seed:             c.Seed,
+		})
+		agentConfig.WatcherErrors = faults.WatcherErrors()
+		runner.Go("chaos", faults.Run)
+	}
+	// Outbound clients verify their servers with per-upstream CA bundles and
+	// pins, reloaded once the file watcher exists
+	upstreams := &upstreamTrust{}
+	var signing *http.Client
+	if featureConfig.Keyless.Enabled {
+		if signing, err = keylessClient(featureConfig.Keyless, upstreams); err != nil {
+			log.Fatal(err)
+		}
+	}
+	agentConfig.Load = certLoader(featureConfig, signing, namespace(cache, "aia"), faults)
+	agentConfig.ChainFile = featureConfig.ChainFile
+	agentConfig.Debounce = time.Duration(featureConfig.DebounceInterval) * time.Millisecond
+	if !featureConfig.DebounceFileChanges {
+		agentConfig.Debounce = 0
+	}
+	agentConfig.CheckInterval = time.Duration(featureConfig.CertWatchInterval) * time.Second
+	agentConfig.ExpiryWarning = time.Duration(featureConfig.CertExpiryWarning) * 24 * time.Hour
+	agentConfig.NotBeforeGrace = time.Duration(featureConfig.NotBeforeGrace) * time.Second
+	agentConfig.ZeroizeRetired = featureConfig.KeyHygiene.Zeroize
+	agentConfig.ZeroizeDelay = time.Duration(featureConfig.KeyHygiene.ZeroizeDelay) * time.Second
+	if featureConfig.RecordFile != "" {
+		recorder, err := agent.OpenRecorder(featureConfig.RecordFile)
+		if err != nil {
+			log.Fatalf("Failed to open record file: %v", err)
+		}
+		agentConfig.Recorder = recorder
+		runner.OnShutdown(func(context.Context) error { return recorder.Close() })
+		log.Printf("Recording file events and reload decisions to %s", featureConfig.RecordFile)
+	}
+	agentReload := make(chan struct{}, 1)
+	agentConfig.Reload = agentReload
+	requestReload := func() bool {
+		select {
+		case agentReload <- struct{}{}:
+			return true
+		default: // a reload is already pending
+			return false
+		}
+	}
+	agentRollback := make(chan chan error)
+	agentConfig.Rollback = agentRollback
+	agentRollbackVersion := make(chan agent.RollbackRequest)
+	agentConfig.RollbackVersion = agentRollbackVersion
+	if watchdog > 0 {
+		// A hung watch loop stops the pings and systemd restarts the unit
+		agentConfig.Watchdog = func() { notifySystemd(systemd.Watchdog) }
+		agentConfig.WatchdogInterval = watchdog / 2
+	}
+
+	var stapler *stapling.Manager
+	if featureConfig.OCSP.Stapling {
+		stapler = stapling.NewManager(featureConfig.OCSP.MustStaple, featureConfig.OCSP.CacheDir)
+		if cache != nil {
+			stapler.SetStorage(namespace(cache, "ocsp"))
+		}
+		agentConfig.Load = stapler.Wrap(agentConfig.Load)
+	}
+
+	// SNI pairs always load from files; the primary certificate may instead
+	// be pulled from a distribution server. They have no previous
+	// certificate to fall back to, so policy violations are refused outright.
+	certPolicy := buildPolicy(featureConfig.Policy, featureConfig.FIPS.Enabled)
+	sniLoad := agentConfig.Load
+	if !certPolicy.IsZero() {
+		sniLoad = policyLoad(certPolicy, sniLoad)
+	}
+	var remote *distribution.Source
+	if featureConfig.Distribution.Remote.URL != "" {
+		remote, err = remoteSource(featureConfig.Distribution.Remote, upstreams)
+		if err != nil {
+			log.Fatal(err)
+		}
+		agentConfig.Load = remote.Load
+		if stapler != nil {
+			agentConfig.Load = stapler.Wrap(remote.Load)
+		}
+	}
+
+	elector, err := buildElector(featureConfig.LeaderElection)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var issuer *acme.Issuer
+	if featureConfig.ACME.Enabled {
+		issuer, err = buildIssuer(featureConfig.ACME, agentConfig.CertFile, agentConfig.KeyFile, cache)
+		if err != nil {
+			log.Fatal(err)
+		}
+		// The first certificate must exist before anything can be served;
+		// renewals happen in the background
+		if issuer.NeedsRenewal() == "no certificate" {
+			log.Printf("ACME: requesting certificate for %s", strings.Join(featureConfig.ACME.Domains, ", "))
+		}
+		if err := obtainInitial(context.Background(), issuer, elector, time.Second); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	cert, err := agentConfig.Load(agentConfig.CertFile, agentConfig.KeyFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// There is nothing else to serve, so a certificate outside its validity
+	// window is only reported at startup; expired_certificate decides
+	// whether handshakes are refused
+	if leaf, err := tlsstore.ParseLeaf(cert); err == nil {
+		if _, err := tlsstore.CheckValidity(leaf, agentConfig.Clock.Now(), agentConfig.NotBeforeGrace); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+
+	// One watcher serves every file other than the primary pair, which the
+	// agent watches itself so its restarts cannot affect the rest
+	files, err := watch.New(agentConfig.Debounce)
+	if err != nil {
+		log.Fatal(err)
+	}
+	files.Clock = agentConfig.Clock
+	if err := upstreams.watch(files); err != nil {
+		log.Fatal(err)
+	}
+
+	store := tlsstore.NewWithClock(cert, agentConfig.Clock)
+	if featureConfig.RetainedVersions > 0 {
+		store.SetRetainedVersions(featureConfig.RetainedVersions)
+	}
+	if err := store.SetExpiryPolicy(tlsstore.ExpiryPolicy{
+		Mode:  featureConfig.ExpiredCertificate.Mode,
+		Grace: time.Duration(featureConfig.ExpiredCertificate.Grace) * time.Hour,
+	}); err != nil {
+		log.Fatal(err)
+	}
+	subscribeCertificateMetrics(store)
+	if err := loadSNICertificates(store, featureConfig, sniLoad); err != nil {
+		log.Fatal(err)
+	}
+	if featureConfig.CertificateWatcher {
+		if err := watchSNICertificates(files, registry, store, featureConfig, sniLoad); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var tenants *tenant.Set
+	if len(featureConfig.Tenants) > 0 {
+		if tenants, err = buildTenants(featureConfig.Tenants, sniLoad, featureConfig.LoadWorkers); err != nil {
+			log.Fatal(err)
+		}
+		if featureConfig.CertificateWatcher {
+			if err := watchTenants(files, registry, tenants, featureConfig.Tenants); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+
+	getCertificate := store.GetCertificate
+	if tenants != nil {
+		getCertificate = tenants.GetCertificate(store.GetCertificate)
+	}
 	tlsCfg := &tls.Config{
-		GetCertificate: store.GetCertificate,
+		GetCertificate: getCertificate,
 		MinVersion:     tls.VersionTLS12,
 	}
+	if stapler != nil {
+		tlsCfg.GetCertificate = stapler.GetCertificate(getCertificate)
+		runner.Go("ocsp", func(ctx context.Context) error {
+			stapler.Run(time.Duration(featureConfig.OCSP.RefreshInterval)*time.Minute, ctx.Done())
+			return nil
+		})
+	}
+	if err := tlsconfig.ApplyCurves(tlsCfg, "public", featureConfig.TLS.CurvePreferences, featureConfig.TLS.PostQuantum); err != nil {
+		log.Fatal(err)
+	}
+	if featureConfig.FIPS.Enabled {
+		tlsconfig.ApplyFIPS(tlsCfg)
+	}
 
-	state := agent.NewState(cert)
-	agentStopChan := make(chan struct{})
-	agentDone := make(chan struct{})
+	// Revocation covers the main trust store and client policies with a
+	// bundle of their own alike
+	var chainCheck func([]*x509.Certificate) error
+	if featureConfig.TrustStore.CRLCheck {
+		chainCheck = startCRLChecker(featureConfig.TrustStore, namespace(cache, "crl"), runner)
+	}
+	var trust *tlsstore.RootCAStore
+	if featureConfig.TrustStore.CABundle != "" {
+		if trust, err = setupTrustStore(tlsCfg, featureConfig.TrustStore, chainCheck, files); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if len(featureConfig.TLS.ClientPolicies) > 0 {
+		policies, err := buildClientPolicies(featureConfig.TLS.ClientPolicies, trust, chainCheck, files)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if featureConfig.FIPS.Enabled {
+			for i := range policies {
+				if err := policies[i].CheckFIPS(); err != nil {
+					log.Fatal(err)
+				}
+			}
+		}
+		tlsCfg.GetConfigForClient = tlsconfig.NewClientPolicies(tlsCfg, policies).GetConfigForClient
+	}
 
-	// Only start the certificate watcher agent if feature is enabled
-	if featureConfig.CertificateWatcher {
-		go func() {
-			agent.Run(store, state, agentStopChan)
-			close(agentDone)
-		}()
-	} else {
-		close(agentDone) // Mark as already done if feature is disabled
-		if featureConfig.Logging {
-			log.Println("Certificate watcher agent disabled")
+	if featureConfig.ECH.Enabled {
+		if err := setupECH(tlsCfg, featureConfig.ECH, files, runner); err != nil {
+			log.Fatal(err)
 		}
 	}
 
-	server := &http.Server{
-		Addr:      ":8443",
-		TLSConfig: tlsCfg,
+	if featureConfig.Distribution.Server.Enabled {
+		if err := setupDistribution(featureConfig.Distribution.Server, featureConfig.KeyHygiene.NoExport, store, files, runner); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var bundlePublisher *webhook.Publisher
+	if featureConfig.Webhook.Enabled {
+		if bundlePublisher, err = setupWebhook(featureConfig.Webhook, store, files, runner); err != nil {
+			log.Fatal(err)
+		}
 	}
 
-	// Channel for graceful shutdown
-	shutdownDone := make(chan struct{})
+	runner.Go("file watcher", func(ctx context.Context) error {
+		if err := files.Run(ctx.Done()); err != nil {
+			log.Println("Watch: file watcher stopped:", err)
+		}
+		return nil
+	})
 
-	if featureConfig.GracefulShutdown {
-		// Handle signals in a goroutine for graceful shutdown
-		go func() {
-			sigChan := make(chan os.Signal, 1)
-			signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	notifier, err := buildNotifier(featureConfig.Notifications, upstreams)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var events *management.Hub
+	if featureConfig.Management.Enabled {
+		events = management.NewHub()
+		notifier = notify.Multi{notifier, events}
+	}
+	if bundlePublisher != nil {
+		notifier = notify.Multi{notifier, bundlePublisher}
+	}
+	backups := buildBackups(featureConfig.Backup)
+	if len(featureConfig.DeployTargets) > 0 {
+		deployer, err := buildDeployer(featureConfig.DeployTargets, store)
+		if err != nil {
+			log.Fatal(err)
+		}
+		deployer.Backups = backups
+		if err := deployer.Deploy(); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+		subscribeDeployer(store, deployer)
+	}
+	if len(featureConfig.Hooks) > 0 {
+		hookRunner := buildHooks(featureConfig.Hooks, agentConfig, store)
+		notifier = notify.Multi{notifier, hookRunner}
+		runner.Go("exec hooks", hookRunner.Run)
+	}
+	var tracker *conntrack.Tracker
+	if rot := featureConfig.ConnectionRotation; rot.Mode != "" && rot.Mode != conntrack.ModeNever {
+		tracker = &conntrack.Tracker{Mode: rot.Mode, Grace: time.Duration(rot.GracePeriod) * time.Second}
+		notifier = notify.Multi{notifier, tracker}
+	}
+	if featureConfig.DelegatedCredentials.Enabled {
+		rotator, err := setupDelegated(featureConfig.DelegatedCredentials, store, runner)
+		if err != nil {
+			log.Fatal(err)
+		}
+		notifier = notify.Multi{notifier, rotator}
+	}
+	if err := certPolicy.Check(cert); err != nil {
+		if featureConfig.FIPS.Enabled {
+			log.Fatalf("Initial certificate is not FIPS compliant: %v", err)
+		}
+		log.Printf("Warning: initial certificate does not satisfy policy: %v", err)
+		notify.Send(notifier, notify.Event{
+			Type:     notify.EventPolicyViolation,
+			Severity: notify.SeverityCritical,
+			Message:  err.Error(),
+		})
+	}
+
+	agentConfig.Notifier = notifier
+	if !certPolicy.IsZero() {
+		agentConfig.Validate = certPolicy.Check
+	}
+	if featureConfig.Probe.Enabled {
+		prober, err := buildProber(featureConfig.Probe)
+		if err != nil {
+			log.Fatal(err)
+		}
+		agentConfig.Probe = prober.Check
+	}
 
-			sig := <-sigChan
-			if featureConfig.Logging {
-				log.Printf("Received signal: %v", sig)
-				log.Println("Initiating graceful shutdown...")
+	if ct := featureConfig.CTMonitor; ct.Enabled {
+		monitor := ctmonitor.New(&ctmonitor.CrtSh{Endpoint: ct.Endpoint}, ctmonitor.Config{
+			Domains:        ct.Domains,
+			AllowedIssuers: ct.AllowedIssuers,
+			ExpectedNames:  ct.ExpectedNames,
+		}, notifier)
+		runner.Go("ct monitor", func(ctx context.Context) error {
+			monitor.Run(time.Duration(ct.PollInterval)*time.Minute, ctx.Done())
+			return nil
+		})
+	}
+
+	state := agent.NewState(cert)
+	if cache != nil {
+		if err := state.PersistHistory(cache); err != nil {
+			log.Printf("Warning: failed to restore reload history: %v", err)
+		}
+	}
+	if stapler != nil {
+		stapler.OnRefresh = func(err error) {
+			if err != nil {
+				state.SetLastError(agent.SourceOCSP, err)
+			} else {
+				state.ClearLastError(agent.SourceOCSP)
 			}
+		}
+	}
 
-			// Signal the agent to stop
-			if featureConfig.CertificateWatcher {
-				close(agentStopChan)
+	// Only start the certificate watcher agent if feature is enabled
+	if featureConfig.CertificateWatcher {
+		watcher := agent.New(store, agent.WithConfig(agentConfig), agent.WithState(state))
+		runner.Go("agent", func(ctx context.Context) error {
+			if err := watcher.Start(); err != nil {
+				return err
 			}
+			<-ctx.Done()
+			return watcher.Stop(context.Background())
+		})
+		registry.Subscribe(signals.ActionReloadCerts, func() { requestReload() })
+	} else if featureConfig.Logging {
+		log.Println("Certificate watcher agent disabled")
+	}
+	if remote != nil {
+		// Received certificates go through the agent's reload, so they are
+		// validated and recorded like local changes
+		runner.Go("remote certificate", func(ctx context.Context) error {
+			return remote.Run(ctx, func() { registry.Dispatch(signals.ActionReloadCerts) })
+		})
+	}
+	if featureConfig.Management.Enabled {
+		service := &management.Service{
+			Store:   store,
+			State:   state,
+			Started: started,
+			Events:  events,
+		}
+		if featureConfig.CertificateWatcher {
+			service.RequestReload = requestReload
+			service.RequestRollback = rollbackRequester(agentRollback)
+		}
+		if err := setupManagement(featureConfig.Management, service, store, files, runner); err != nil {
+			log.Fatal(err)
+		}
+	}
+	// Work that must not be duplicated across replicas
+	var leaderTasks []leaderTask
+	if issuer != nil {
+		interval := time.Duration(featureConfig.ACME.CheckInterval) * time.Hour
+		leaderTasks = append(leaderTasks, leaderTask{"acme", func(ctx context.Context) {
+			issuer.Run(ctx, interval)
+		}})
+	}
+	if ka := featureConfig.KeyAge; ka.MaxAge > 0 {
+		tracker := &keyage.Tracker{
+			MaxAge:   time.Duration(ka.MaxAge) * 24 * time.Hour,
+			Action:   ka.Action,
+			Notifier: notifier,
+			Storage:  namespace(cache, "keyage"),
+			Current: func() *tls.Certificate {
+				cert, _ := store.GetCertificate(nil)
+				return cert
+			},
+		}
+		if issuer != nil {
+			// Every replica tracks the key's age, but only the leader
+			// orders its replacement
+			tracker.Reissue = leaderOnly(elector, "key age reissue", issuer.Obtain)
+		}
+		interval := time.Duration(ka.CheckInterval) * time.Minute
+		runner.Go("key age", func(ctx context.Context) error {
+			tracker.Run(ctx, interval)
+			return nil
+		})
+	}
+	runLeaderTasks(runner, elector, leaderTasks)
+	runner.OnShutdown(notify.Flush)
 
-			// Create context with timeout for shutdown
-			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(featureConfig.ShutdownTimeout)*time.Second)
-			defer cancel()
+	server := &http.Server{
+		Addr:      listenAddress,
+		TLSConfig: tlsCfg,
+	}
+	handler, err := buildHandler(featureConfig, upstreams)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if handler, err = buildAccessLog(featureConfig.AccessLog, handler, registry); err != nil {
+		log.Fatal(err)
+	}
+	if rid := featureConfig.RequestID; rid.Enabled {
+		handler = requestid.Middleware{Header: rid.Header, TrustIncoming: rid.TrustIncoming}.Wrap(handler)
+	}
+	server.Handler = handler
+	filter, err := buildConnFilter(featureConfig.ConnectionFilter)
+	if err != nil {
+		log.Fatal(err)
+	}
+	opts := listenerOptions{
+		filter:  filter,
+		limiter: buildHandshakeLimiter(featureConfig.HandshakeLimits),
+		tracker: tracker,
+		alpn:    featureConfig.TLS.ALPN,
+		http2:   featureConfig.HTTP2,
+	}
+	if tenants != nil {
+		if err := serveTenants(tenants, featureConfig.Tenants, tlsCfg, featureConfig.TLS, featureConfig.FIPS.Enabled, handler, stapler, opts, runner); err != nil {
+			log.Fatal(err)
+		}
+	}
 
-			// Shutdown the HTTP server
-			if err := server.Shutdown(ctx); err != nil {
-				log.Printf("Server shutdown error: %v", err)
-			}
+	ln, _ := activated.take(socketHTTPS)
+	runner.AddServer("server", server, opts.serve(server, ln, "public"))
 
-			if featureConfig.Logging {
-				log.Println("Server shutdown complete")
+	if featureConfig.MetricsCollection || featureConfig.HealthCheck || featureConfig.Dashboard || featureConfig.Debug {
+		adminServer := admin.New(featureConfig.AdminAddress)
+		if featureConfig.AdminTLS.Enabled {
+			if err := setupAdminTLS(adminServer, featureConfig.AdminTLS, featureConfig.TLS, featureConfig.FIPS.Enabled, store, files, registry); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if featureConfig.AdminAuth.Enabled {
+			if err := setupAdminAuth(adminServer, featureConfig.AdminAuth); err != nil {
+				log.Fatal(err)
 			}
-			close(shutdownDone)
-		}()
-	} else {
-		close(shutdownDone) // Mark as done if graceful shutdown is disabled
+		}
+		if featureConfig.MetricsCollection {
+			adminServer.HandleAPI("/metrics", metrics.Handler())
+		}
+		if featureConfig.HealthCheck {
+			registerHealthChecks(featureConfig, state, store, stapler)
+			adminServer.HandleAPI("/healthz", health.Handler())
+		}
+		adminServer.HandleAPI("/reloads", agent.HistoryHandler(state))
+		versionsHandler := agent.VersionsHandler(store, func(ctx context.Context, version uint64) (tlsstore.VersionInfo, error) {
+			return agent.RequestRollback(ctx, agentRollbackVersion, version)
+		})
+		adminServer.HandleAPI("/versions", versionsHandler)
+		adminServer.HandleAPI("/versions/", versionsHandler)
+		inv := inventoryFor(featureConfig, agentConfig, store, stapler)
+		adminServer.HandleAPI("/certificates", inv.Handler())
+		adminServer.HandleAPI("/config", configHandler(featureConfig))
+		adminServer.HandleAPI("/export", exportHandler(store, featureConfig.KeyHygiene.AdminKeyExport && !featureConfig.KeyHygiene.NoExport))
+		adminServer.HandleAPI("/status", &statusSource{
+			started:     started,
+			features:    featureConfig,
+			agentConfig: agentConfig,
+			inventory:   inv,
+			state:       state,
+			files:       files,
+		})
+		if featureConfig.Dashboard {
+			dash := &dashboard.Dashboard{Certificates: inv.List, Reloads: state.History}
+			if featureConfig.HealthCheck {
+				dash.Health = health.Default.Run
+			}
+			adminServer.Handle("/dashboard", dash)
+		}
+		if tenants != nil {
+			tenantHandler := tenants.Handler(stapler)
+			adminServer.HandleAPI("/tenants", tenantHandler)
+			adminServer.HandleAPI("/tenants/", tenantHandler)
+		}
+		if backups != nil {
+			backupHandler := backup.Handler(backups)
+			adminServer.HandleAPI("/backups", backupHandler)
+			adminServer.HandleAPI("/backups/", backupHandler)
+		}
+		if featureConfig.Debug {
+			registerDebug(adminServer, state)
+		}
+		if ln, ok := activated.take(socketAdmin); ok {
+			runner.AddServer("admin server", adminServer, func() error { return adminServer.Serve(ln) })
+		} else {
+			runner.AddServer("admin server", adminServer, adminServer.ListenAndServe)
+		}
 		if featureConfig.Logging {
-			log.Println("Graceful shutdown feature disabled")
+			log.Printf("Admin API listening on %s", adminURL(featureConfig))
+		}
+	}
+
+	if featureConfig.Heartbeat.Enabled {
+		sender := buildHeartbeat(featureConfig.Heartbeat, featureConfig.HealthCheck, store, state)
+		if sender.Client, err = upstreams.client(featureConfig.Heartbeat.TLS, 10*time.Second); err != nil {
+			log.Fatalf("heartbeat: tls: %v", err)
 		}
+		runner.Go("heartbeat", sender.Run)
+	}
+	if featureConfig.Statsd.Enabled {
+		runner.Go("statsd", buildStatsd(featureConfig.Statsd).Run)
 	}
 
 	if featureConfig.Logging {
@@ -118,30 +702,688 @@ func main() {
 		log.Println(" ")
 	}
 
-	if err := server.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	registry.Subscribe(signals.ActionShutdown, stop)
+	registry.Subscribe(signals.ActionShutdown, func() { notifySystemd(systemd.Stopping) })
+	if featureConfig.LogFile != "" {
+		runner.OnShutdown(func(context.Context) error { return logFile.Sync() })
+	}
+	registry.Subscribe(signals.ActionReloadConfig, func() {
+		reloaded, err := loadFeatures()
+		if err != nil {
+			log.Printf("Configuration reload failed, keeping the current settings: %v", err)
+			return
+		}
+		reloaded.LogFeatures()
+		cfg := reloaded.Get()
+		tlsstore.SetPermissionPolicy(tlsstore.PermissionPolicy{
+			Mode:  cfg.KeyPermissions.Policy,
+			Owner: cfg.KeyPermissions.Owner,
+		})
+		log.Println("Configuration reloaded: key permission policy applied; other settings take effect on restart")
+		registry.Dispatch(signals.ActionReloadCerts)
+	})
+	runner.Go("signals", registry.Run)
+	activated.closeUnused()
+	superviseSystemd(runner, watchdog, featureConfig.CertificateWatcher)
+
+	serviceFinished, err := startService(stop)
+	if err != nil {
+		log.Printf("Warning: failed to detect service mode: %v", err)
+	}
+
+	if err := runner.Run(ctx); err != nil {
 		log.Printf("Server error: %v", err)
 	}
 
-	// Wait for shutdown to complete
-	<-shutdownDone
+	if pidFile != nil {
+		if err := pidFile.Remove(); err != nil {
+			log.Printf("Failed to remove PID file: %v", err)
+		}
+	}
 
-	// Wait for agent to stop (with timeout) if watcher is enabled
-	if featureConfig.CertificateWatcher {
-		if featureConfig.Logging {
-			log.Println("Waiting for certificate watcher agent to stop...")
+	log.Println("TLS Agent shutdown complete")
+	serviceFinished()
+}
+
+// hasFlag reports whether flag appears in args
+func hasFlag(args []string, flag string) bool {
+	for _, a := range args {
+		if a == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// logFile is the log destination when features.LogFile is set
+var logFile reopenableFile
+
+// buildSignals binds signals to actions, keeping the default binding for
+// actions the configuration leaves empty
+func buildSignals(cfg features.SignalsConfig) (*signals.Registry, error) {
+	bindings := signals.DefaultBindings()
+	for action, names := range map[string][]string{
+		signals.ActionShutdown:     cfg.Shutdown,
+		signals.ActionReloadConfig: cfg.ReloadConfig,
+		signals.ActionReloadCerts:  cfg.ReloadCerts,
+		signals.ActionRotateLogs:   cfg.RotateLogs,
+	} {
+		if len(names) > 0 {
+			bindings[action] = names
+		}
+	}
+	return signals.New(bindings)
+}
+
+// loadFeatures loads the feature configuration from FEATURES_CONFIG_PATH and
+// the environment. An unreadable file only logs a warning and leaves the
+// defaults, but a file rejected by strict parsing is an error.
+func loadFeatures() (*features.ConfigLoader, error) {
+	// Load feature configuration
+	featureLoader := features.NewConfigLoader()
+
+	// Strict mode must be known before the file is parsed
+	if strict, err := strconv.ParseBool(os.Getenv("TLS_AGENT_FEATURES_STRICT_CONFIG")); err == nil {
+		featureLoader.SetStrict(strict)
+	}
+
+	// Try to load from config file if specified
+	if configPath := os.Getenv("FEATURES_CONFIG_PATH"); configPath != "" {
+		if err := featureLoader.LoadFromYAML(configPath); err != nil {
+			if errors.Is(err, features.ErrUnknownKey) {
+				return nil, err
+			}
+			if err := featureLoader.LoadFromJSON(configPath); err != nil {
+				log.Printf("Warning: Could not load features config from %s: %v\n", configPath, err)
+			}
 		}
-		agentStopCtx, cancel := context.WithTimeout(context.Background(), time.Duration(featureConfig.AgentShutdownTimeout)*time.Second)
-		defer cancel()
+	}
+
+	// Override with environment variables (takes precedence)
+	if err := featureLoader.LoadFromEnv(); err != nil {
+		log.Printf("Warning: Could not load features from environment: %v\n", err)
+	}
+
+	return featureLoader, nil
+}
+
+// setupECH loads (or generates) ECH keys, wires them into tlsCfg, and starts
+// the rotation/hot-reload loop. The HTTPS record is republished on every change.
+func setupECH(tlsCfg *tls.Config, cfg features.ECHConfig, files *watch.Watcher, runner *lifecycle.Runner) error {
+	manager := ech.NewManager(cfg.KeyFile, cfg.PublicName)
+	if err := manager.LoadOrGenerate(); err != nil {
+		return err
+	}
+
+	publish := func() {
+		record := ech.HTTPSRecord(cfg.Domain, manager.ConfigList())
+		log.Println("ECH: publish DNS record:", record)
+		if cfg.RecordFile != "" {
+			if err := manager.WriteRecord(cfg.RecordFile, cfg.Domain); err != nil {
+				log.Println("ECH: failed to write HTTPS record:", err)
+			}
+		}
+	}
+	publish()
+
+	tlsCfg.GetEncryptedClientHelloKeys = manager.GetEncryptedClientHelloKeys
 
+	if err := manager.Register(files, publish); err != nil {
+		return err
+	}
+	rotateEvery := time.Duration(cfg.RotationInterval) * time.Hour
+	runner.Go("ech rotation", func(ctx context.Context) error {
+		manager.Run(rotateEvery, publish, ctx.Done())
+		return nil
+	})
+	return nil
+}
+
+// registerHealthChecks wires subsystem checks into the health endpoint
+func registerHealthChecks(featureConfig features.Features, state *agent.State, store *tlsstore.Store, stapler *stapling.Manager) {
+	// The last error is reported but does not fail the check: the current
+	// certificate keeps being served while reloads are failing
+	health.Register("agent", func() (any, error) {
+		return map[string]any{"last_error": state.GetLastError()}, nil
+	})
+
+	// An expired certificate fails the check once handshakes are refused,
+	// and is reported while it is still served within the grace period
+	health.Register("certificate_expiry", func() (any, error) {
+		status := map[string]any{"state": store.ExpiryState(store.Now())}
+		leaf := store.Leaf()
+		if leaf != nil {
+			status["not_after"] = leaf.NotAfter
+		}
+		switch status["state"] {
+		case tlsstore.ExpiryRefusing:
+			return status, fmt.Errorf("certificate expired at %s; handshakes are refused", leaf.NotAfter.Format(time.RFC3339))
+		case tlsstore.ExpiryServing:
+			if grace := store.ExpiryPolicy().Grace; grace > 0 {
+				status["grace_ends"] = leaf.NotAfter.Add(grace)
+			}
+		}
+		return status, nil
+	})
+
+	health.Register("key_permissions", func() (any, error) {
+		check := tlsstore.LastPermissionCheck()
+		if check == nil {
+			return nil, nil
+		}
+		if !check.OK && featureConfig.KeyPermissions.Policy == tlsstore.PolicyEnforce {
+			return check, fmt.Errorf("insecure key file %s", check.Path)
+		}
+		return check, nil
+	})
+
+	if featureConfig.FIPS.Enabled {
+		health.Register("fips", fipsCheck(store, buildPolicy(featureConfig.Policy, true)))
+	}
+
+	if stapler != nil {
+		health.Register("ocsp", func() (any, error) {
+			statuses := stapler.Statuses()
+			for _, s := range statuses {
+				if s.MustStaple && !s.Fresh && featureConfig.OCSP.MustStaple == stapling.MustStapleEnforce {
+					return statuses, fmt.Errorf("must-staple certificate %q has no fresh staple", s.Subject)
+				}
+			}
+			return statuses, nil
+		})
+	}
+}
+
+// buildNotifier returns the alert notifier described by the config
+func buildNotifier(cfg features.NotificationsConfig, upstreams *upstreamTrust) (notify.Notifier, error) {
+	notifiers := notify.Multi{notify.Log{}}
+	if cfg.WebhookURL != "" {
+		client, err := upstreams.client(cfg.WebhookTLS, 10*time.Second)
+		if err != nil {
+			return nil, fmt.Errorf("notifications: webhook_tls: %w", err)
+		}
+		notifiers = append(notifiers, &notify.Webhook{URL: cfg.WebhookURL, Client: client})
+	}
+	if k := cfg.Kubernetes; k.Events || k.Annotate {
+		if n, err := kubeNotifier(k); err != nil {
+			log.Printf("Warning: Kubernetes notifications disabled: %v", err)
+		} else {
+			notifiers = append(notifiers, n)
+		}
+	}
+	return notifiers, nil
+}
+
+// Leader election backends
+const (
+	leaderBackendKubernetes = "kubernetes"
+	leaderBackendFile       = "file"
+)
+
+// buildElector returns the leader elector for cfg, or nil when election is
+// disabled and this instance always leads
+func buildElector(cfg features.LeaderElectionConfig) (*leader.Elector, error) {
+	if cfg.Backend == "" {
+		return nil, nil
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("leader election: %w", err)
+	}
+	identity := fmt.Sprintf("%s_%d", host, os.Getpid())
+
+	var lock leader.Lock
+	switch cfg.Backend {
+	case leaderBackendKubernetes:
+		client, err := kube.InCluster()
+		if err != nil {
+			return nil, fmt.Errorf("leader election: %w", err)
+		}
+		pod, err := kube.CurrentPod()
+		if err != nil {
+			return nil, fmt.Errorf("leader election: %w", err)
+		}
+		lock = &kube.LeaseLock{Client: client, Namespace: pod.Namespace, Name: cfg.LeaseName}
+		identity = pod.Name
+	case leaderBackendFile:
+		lock = &leader.FileLock{Path: cfg.LockFile}
+	default:
+		return nil, fmt.Errorf("leader election: unknown backend %q", cfg.Backend)
+	}
+
+	return &leader.Elector{
+		Lock:          lock,
+		Identity:      identity,
+		LeaseDuration: time.Duration(cfg.LeaseDuration) * time.Second,
+		RetryPeriod:   time.Duration(cfg.RetryPeriod) * time.Second,
+	}, nil
+}
+
+// obtainInitial orders the first certificate when there is none. With an
+// elector only the leader orders it, so replicas starting together do not
+// race for the CA's rate limits and DNS records; the others wait, polling
+// every poll, until the leader's certificate appears in the shared files.
+func obtainInitial(ctx context.Context, issuer *acme.Issuer, elector *leader.Elector, poll time.Duration) error {
+	if issuer.NeedsRenewal() != "no certificate" {
+		return nil
+	}
+	if elector == nil {
+		return issuer.Obtain(ctx)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	obtained := make(chan error, 1)
+	campaign := make(chan error, 1)
+	go func() {
+		campaign <- elector.Run(ctx, func(ctx context.Context) {
+			err := issuer.Obtain(ctx)
+			if ctx.Err() != nil {
+				// Leadership was lost mid-order; the next leader orders it
+				return
+			}
+			select {
+			case obtained <- err:
+			default:
+			}
+		})
+	}()
+	// Stop campaigning before returning, so the lock is released for the
+	// long-running elector
+	defer func() {
+		cancel()
+		<-campaign
+	}()
+
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+	for {
 		select {
-		case <-agentDone:
-			if featureConfig.Logging {
-				log.Println("Agent stopped gracefully")
+		case err := <-obtained:
+			return err
+		case <-ticker.C:
+			if issuer.NeedsRenewal() != "no certificate" {
+				log.Println("ACME: using the certificate obtained by the leader")
+				return nil
 			}
-		case <-agentStopCtx.Done():
-			log.Println("Warning: Agent stop timeout (continuing anyway)")
+		case <-ctx.Done():
+			return ctx.Err()
 		}
 	}
+}
 
-	log.Println("TLS Agent shutdown complete")
+// leaderOnly wraps fn so that, with an elector, it does nothing on replicas
+// that are not the leader; the leader's result reaches them through the
+// shared files
+func leaderOnly(elector *leader.Elector, name string, fn func(ctx context.Context) error) func(ctx context.Context) error {
+	if elector == nil {
+		return fn
+	}
+	return func(ctx context.Context) error {
+		if !elector.IsLeader() {
+			log.Printf("Leader: skipping %s: not the leader", name)
+			return nil
+		}
+		return fn(ctx)
+	}
+}
+
+// leaderTask is background work that must run on one replica at a time
+type leaderTask struct {
+	name string
+	run  func(ctx context.Context)
+}
+
+// runLeaderTasks registers tasks with runner. Without an elector this
+// instance always leads and they simply run; with one they start each time
+// it gains leadership and are cancelled when it loses it.
+func runLeaderTasks(runner *lifecycle.Runner, elector *leader.Elector, tasks []leaderTask) {
+	if elector == nil {
+		for _, t := range tasks {
+			runner.Go(t.name, func(ctx context.Context) error {
+				t.run(ctx)
+				return nil
+			})
+		}
+		return
+	}
+	runner.Go("leader election", func(ctx context.Context) error {
+		return elector.Run(ctx, func(ctx context.Context) {
+			var wg sync.WaitGroup
+			for _, t := range tasks {
+				wg.Go(func() { t.run(ctx) })
+			}
+			wg.Wait()
+		})
+	})
+}
+
+// kubeNotifier reports to the API server of the cluster the agent runs in
+func kubeNotifier(cfg features.KubernetesNotificationsConfig) (*kube.Notifier, error) {
+	client, err := kube.InCluster()
+	if err != nil {
+		return nil, err
+	}
+	pod, err := kube.CurrentPod()
+	if err != nil {
+		return nil, err
+	}
+	return &kube.Notifier{Client: client, Pod: pod, Events: cfg.Events, Annotate: cfg.Annotate}, nil
+}
+
+// buildPolicy converts the configured acceptance rules into a policy, adding
+// the FIPS rules in FIPS mode
+func buildPolicy(cfg features.PolicyConfig, fips bool) policy.Policy {
+	return policy.Policy{
+		FIPS:                       fips,
+		MinRSABits:                 cfg.MinRSABits,
+		MinECDSABits:               cfg.MinECDSABits,
+		AllowedSignatureAlgorithms: cfg.AllowedSignatureAlgorithms,
+		RequiredSANs:               cfg.RequiredSANs,
+		MaxValidity:                time.Duration(cfg.MaxValidityDays) * 24 * time.Hour,
+		RequiredIssuer:             cfg.RequiredIssuer,
+	}
+}
+
+// policyLoad wraps load to refuse certificates that violate p
+func policyLoad(p policy.Policy, load func(certFile, keyFile string) (*tls.Certificate, error)) func(certFile, keyFile string) (*tls.Certificate, error) {
+	return func(certFile, keyFile string) (*tls.Certificate, error) {
+		cert, err := load(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.Check(cert); err != nil {
+			return nil, fmt.Errorf("%s: %w", certFile, err)
+		}
+		return cert, nil
+	}
+}
+
+// keylessClient returns the client keyless signing requests are sent on.
+// It is built once so certificate reloads share its connections. Key
+// servers are verified against cfg's CA bundle and pins and, when cfg has a
+// client certificate, authenticate the agent by it.
+func keylessClient(cfg features.KeylessConfig, upstreams *upstreamTrust) (*http.Client, error) {
+	base := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.CertFile != "" {
+		base.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return tlsstore.Load(cfg.CertFile, cfg.KeyFile)
+		}
+	}
+	trust := features.UpstreamTLSConfig{CABundle: cfg.CABundle, Pins: cfg.Pins}
+	transport, err := upstreams.transport(trust, base)
+	if err != nil {
+		return nil, fmt.Errorf("keyless: %w", err)
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+// chainFiles maps each certificate file with a separate chain file to it
+func chainFiles(featureConfig features.Features) map[string]string {
+	chains := make(map[string]string)
+	if featureConfig.ChainFile != "" {
+		chains[agent.DefaultConfig().CertFile] = featureConfig.ChainFile
+	}
+	pairs := slices.Clone(featureConfig.Certificates)
+	for _, tc := range featureConfig.Tenants {
+		pairs = append(pairs, tc.Certificates...)
+	}
+	for _, c := range pairs {
+		if c.ChainFile != "" {
+			chains[c.CertFile] = c.ChainFile
+		}
+	}
+	return chains
+}
+
+// buildDeployer returns the deployer for the configured targets, writing
+// the certificate served for clients without SNI
+func buildDeployer(cfg []features.DeployTargetConfig, store *tlsstore.Store) (*deploy.Deployer, error) {
+	targets := make([]deploy.Target, len(cfg))
+	for i, t := range cfg {
+		targets[i] = deploy.Target{
+			Name:          t.Name,
+			Format:        t.Format,
+			CertFile:      t.CertFile,
+			ChainFile:     t.ChainFile,
+			FullChainFile: t.FullChainFile,
+			KeyFile:       t.KeyFile,
+			Path:          t.Path,
+			Alias:         t.Alias,
+		}
+		if targets[i].Name == "" {
+			targets[i].Name = fmt.Sprintf("%s #%d", t.Format, i+1)
+		}
+		if t.PasswordFile != "" {
+			password, err := os.ReadFile(t.PasswordFile)
+			if err != nil {
+				return nil, fmt.Errorf("deploy target %s: %w", targets[i].Name, err)
+			}
+			targets[i].Password = strings.TrimRight(string(password), "\r\n")
+		}
+	}
+	return &deploy.Deployer{
+		Targets: targets,
+		Current: func() *tls.Certificate {
+			cert, _ := store.GetCertificate(nil)
+			return cert
+		},
+	}, nil
+}
+
+// hookEvents are the event types hooks may subscribe to
+var hookEvents = []string{
+	notify.EventReloadSucceeded,
+	notify.EventReloadFailed,
+	notify.EventCertificateExpiring,
+	notify.EventKeyAgeExceeded,
+	notify.EventPolicyViolation,
+}
+
+// buildHooks returns the runner for the configured exec hooks
+func buildHooks(cfg []features.HookConfig, agentConfig agent.Config, store *tlsstore.Store) *hooks.Runner {
+	converted := make([]hooks.Hook, len(cfg))
+	for i, h := range cfg {
+		converted[i] = hooks.Hook{
+			Name:    h.Name,
+			Events:  h.Events,
+			Command: h.Command,
+			Timeout: time.Duration(h.Timeout) * time.Second,
+		}
+		if converted[i].Name == "" && len(h.Command) > 0 {
+			converted[i].Name = filepath.Base(h.Command[0])
+		}
+	}
+	r := hooks.NewRunner(converted)
+	r.CertFile = agentConfig.CertFile
+	r.KeyFile = agentConfig.KeyFile
+	r.Leaf = store.Leaf
+	return r
+}
+
+// buildProber returns the blue/green probe described by the config
+func buildProber(cfg features.ProbeConfig) (*probe.Prober, error) {
+	prober := &probe.Prober{
+		ServerName: cfg.ServerName,
+		Listen:     cfg.Listen,
+		URL:        cfg.URL,
+		Timeout:    time.Duration(cfg.Timeout) * time.Second,
+	}
+	if cfg.CABundle != "" {
+		roots, err := loadCertPool(cfg.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("probe: %w", err)
+		}
+		prober.Roots = roots
+	}
+	return prober, nil
+}
+
+// buildHandler returns the listener's handler: a reverse proxy when an
+// upstream is configured, wrapped by client authorization when rules exist
+func buildHandler(featureConfig features.Features, upstreams *upstreamTrust) (http.Handler, error) {
+	// Not http.DefaultServeMux: expvar and pprof register on it, and they
+	// belong on the admin listener only
+	var handler http.Handler = http.NewServeMux()
+	if upstream := featureConfig.Proxy.Upstream; upstream != "" {
+		h := featureConfig.Proxy.Headers
+		headers := proxy.IdentityHeaders{
+			Subject:     h.Subject,
+			SANs:        h.SANs,
+			Fingerprint: h.Fingerprint,
+			Verify:      h.Verify,
+			XFCC:        h.XFCC,
+		}
+		verified := clientCertsVerified(featureConfig)
+
+		transport, err := upstreams.transport(featureConfig.Proxy.TLS, nil)
+		if err != nil {
+			return nil, fmt.Errorf("proxy: tls: %w", err)
+		}
+		if handler, err = proxy.New(upstream, headers, verified, transport); err != nil {
+			return nil, err
+		}
+	}
+	if rules := featureConfig.Authorization.Rules; len(rules) > 0 {
+		handler = buildAuthorizer(rules).Middleware(handler)
+	}
+	return handler, nil
+}
+
+// buildAuthorizer converts the configured authorization rules
+func buildAuthorizer(rules []features.AuthorizationRule) *authz.Authorizer {
+	converted := make([]authz.Rule, len(rules))
+	for i, r := range rules {
+		converted[i] = authz.Rule{PathPrefix: r.Path, Allow: r.Allow}
+	}
+	return authz.New(converted)
+}
+
+// clientCertsVerified reports whether every client certificate the public
+// listener accepts has been verified, by the trust store or by a client
+// policy. Listeners that do not verify never ask for one.
+func clientCertsVerified(featureConfig features.Features) bool {
+	if featureConfig.TrustStore.CABundle != "" {
+		return true
+	}
+	for _, p := range featureConfig.TLS.ClientPolicies {
+		if p.ClientAuth == "request" || p.ClientAuth == "require" {
+			return true
+		}
+	}
+	return false
+}
+
+// startCRLChecker starts refreshing the revocation lists for chains it has
+// checked and returns its chain check
+func startCRLChecker(cfg features.TrustStoreConfig, cache storage.Storage, runner *lifecycle.Runner) func([]*x509.Certificate) error {
+	crls := tlsstore.NewCRLChecker(cfg.CRLCacheDir, cfg.CRLHardFail)
+	crls.Storage = cache
+	runner.Go("crl refresh", func(ctx context.Context) error {
+		crls.Run(time.Duration(cfg.CRLRefreshInterval)*time.Minute, ctx.Done())
+		return nil
+	})
+	return crls.CheckChain
+}
+
+// setupTrustStore loads and watches the CA bundle and, when client auth is
+// enabled, verifies client certificates against it on every handshake.
+// chainCheck, if set, must also pass for every verified chain.
+func setupTrustStore(tlsCfg *tls.Config, cfg features.TrustStoreConfig, chainCheck func([]*x509.Certificate) error, files *watch.Watcher) (*tlsstore.RootCAStore, error) {
+	roots, err := tlsstore.NewRootCAStore(cfg.CABundle)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := roots.Register(files, nil); err != nil {
+		return nil, err
+	}
+
+	if chainCheck != nil {
+		roots.SetChainCheck(chainCheck)
+	}
+
+	switch cfg.ClientAuth {
+	case "", "none":
+	case "request":
+		tlsCfg.ClientAuth = tls.RequestClientCert
+		tlsCfg.VerifyPeerCertificate = roots.VerifyClientCertificate
+	case "require":
+		tlsCfg.ClientAuth = tls.RequireAnyClientCert
+		tlsCfg.VerifyPeerCertificate = roots.VerifyClientCertificate
+	default:
+		return nil, fmt.Errorf("invalid client_auth %q", cfg.ClientAuth)
+	}
+	return roots, nil
+}
+
+// loadSNICertificates loads the configured SNI certificate pairs in parallel
+// and adds them to store. All failures are reported together.
+func loadSNICertificates(store *tlsstore.Store, featureConfig features.Features, load func(certFile, keyFile string) (*tls.Certificate, error)) error {
+	if len(featureConfig.Certificates) == 0 {
+		return nil
+	}
+
+	pairs := make([]tlsstore.Pair, len(featureConfig.Certificates))
+	for i, c := range featureConfig.Certificates {
+		pairs[i] = tlsstore.Pair{CertFile: c.CertFile, KeyFile: c.KeyFile, Names: c.Names}
+	}
+
+	start := time.Now()
+	report := tlsstore.LoadPairs(pairs, load, featureConfig.LoadWorkers)
+	if err := report.Err(); err != nil {
+		return fmt.Errorf("%d of %d certificate pairs failed to load:\n%w", len(report.Failed()), len(pairs), err)
+	}
+
+	for _, res := range report.Results {
+		store.SetSNIFrom(res.CertFile, res.Cert, res.Names...)
+	}
+	log.Printf("Loaded %d SNI certificate pairs in %s", len(pairs), time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// watchSNICertificates reloads each SNI pair when its files change or a
+// certificate reload is signalled. A pair that fails to reload keeps serving its previous certificate.
+func watchSNICertificates(files *watch.Watcher, registry *signals.Registry, store *tlsstore.Store, featureConfig features.Features, load func(certFile, keyFile string) (*tls.Certificate, error)) error {
+	for _, c := range featureConfig.Certificates {
+		reload := func() {
+			cert, err := load(c.CertFile, c.KeyFile)
+			if err != nil {
+				log.Printf("SNI: reload of %s failed: %v", c.CertFile, err)
+				return
+			}
+			store.SetSNIFrom(c.CertFile, cert, c.Names...)
+			log.Println("SNI: reloaded", c.CertFile)
+		}
+		if err := files.Add(c.CertFile, reload, c.CertFile, c.KeyFile, c.ChainFile); err != nil {
+			return err
+		}
+		registry.Subscribe(signals.ActionReloadCerts, reload)
+	}
+	return nil
+}
+
+// certLoader returns the function used for the initial load and every
+// reload. With keyless signing, signing is the client the key servers are
+// reached through.
+func certLoader(featureConfig features.Features, signing *http.Client, cache storage.Storage, faults *chaos.Injector) func(certFile, keyFile string) (*tls.Certificate, error) {
+	load := tlsstore.Load
+	if featureConfig.Keyless.Enabled {
+		timeout := time.Duration(featureConfig.Keyless.Timeout) * time.Millisecond
+		load = func(certFile, _ string) (*tls.Certificate, error) {
+			return keyless.LoadCertificate(certFile, featureConfig.Keyless.Servers, signing, timeout)
+		}
+	}
+	load = tlsstore.WithChains(load, chainFiles(featureConfig))
+	if featureConfig.AIAChasing {
+		completer := tlsstore.NewChainCompleter(featureConfig.AIACacheDir)
+		completer.Storage = cache
+		load = completer.Wrap(load)
+	}
+	if faults != nil {
+		load = faults.WrapLoad(load)
+	}
+	return tlsstore.WithTimeout(load, time.Duration(featureConfig.LoadTimeout)*time.Second)
 }
@@ -6,11 +6,18 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"sync/atomic"
 	"syscall"
 	"testing"
 	"time"
 
+	"tls-agent/internal/acme"
 	"tls-agent/internal/agent"
+	"tls-agent/internal/features"
+	"tls-agent/internal/leader"
+	"tls-agent/internal/lifecycle"
+	"tls-agent/internal/storage/boltdb"
 	"tls-agent/internal/tlsstore"
 )
 
@@ -379,3 +386,167 @@ func TestMultipleSignals(t *testing.T) {
 
 	t.Log("Multiple signals test passed")
 }
+
+// TestBuildDeployer tests target naming and password file handling
+func TestBuildDeployer(t *testing.T) {
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(passwordFile, []byte("changeit\n"), 0600); err != nil {
+		t.Fatalf("Failed to write password: %v", err)
+	}
+
+	deployer, err := buildDeployer([]features.DeployTargetConfig{
+		{Format: "pem", CertFile: "cert.pem"},
+		{Name: "tomcat", Format: "jks", Path: "keystore.jks", PasswordFile: passwordFile},
+	}, tlsstore.New(nil))
+	if err != nil {
+		t.Fatalf("Failed to build deployer: %v", err)
+	}
+	if deployer.Targets[0].Name != "pem #1" || deployer.Targets[1].Password != "changeit" {
+		t.Errorf("Unexpected targets %+v", deployer.Targets)
+	}
+
+	_, err = buildDeployer([]features.DeployTargetConfig{{Format: "jks", PasswordFile: filepath.Join(t.TempDir(), "missing")}}, tlsstore.New(nil))
+	if err == nil {
+		t.Error("Expected an error for a missing password file")
+	}
+}
+
+// TestRunLeaderTasks tests that leader-only work runs on one replica at a
+// time and moves to another when the leader stops
+func TestRunLeaderTasks(t *testing.T) {
+	lockFile := filepath.Join(t.TempDir(), "leader.lock")
+	type replica struct {
+		cancel  context.CancelFunc
+		done    chan error
+		running atomic.Bool
+	}
+	start := func(name string) *replica {
+		r := &replica{done: make(chan error, 1)}
+		elector := &leader.Elector{Lock: &leader.FileLock{Path: lockFile}, Identity: name, LeaseDuration: time.Second, RetryPeriod: 10 * time.Millisecond}
+		runner := &lifecycle.Runner{TaskTimeout: 5 * time.Second}
+		runLeaderTasks(runner, elector, []leaderTask{{"renew", func(ctx context.Context) {
+			r.running.Store(true)
+			<-ctx.Done()
+			r.running.Store(false)
+		}}})
+		var ctx context.Context
+		ctx, r.cancel = context.WithCancel(context.Background())
+		go func() { r.done <- runner.Run(ctx) }()
+		return r
+	}
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("Timed out waiting for %s", what)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	a := start("a")
+	waitFor("a to run the task", a.running.Load)
+	b := start("b")
+	defer func() {
+		b.cancel()
+		<-b.done
+	}()
+	time.Sleep(100 * time.Millisecond)
+	if b.running.Load() {
+		t.Fatal("Expected the task to run on the leader only")
+	}
+
+	a.cancel()
+	<-a.done
+	if a.running.Load() {
+		t.Error("Expected a's task to stop with it")
+	}
+	waitFor("b to take over the task", b.running.Load)
+}
+
+// noDNS is a DNS provider for issuers that must never order
+type noDNS struct{}
+
+func (noDNS) Present(context.Context, string, string) error { return nil }
+func (noDNS) CleanUp(context.Context, string, string) error { return nil }
+
+// TestObtainInitialFollower tests that a replica which is not the leader
+// waits for the leader's certificate instead of ordering its own
+func TestObtainInitialFollower(t *testing.T) {
+	dir := t.TempDir()
+	lock := &leader.FileLock{Path: filepath.Join(dir, "leader.lock")}
+	if held, err := lock.TryAcquire(context.Background(), "other", time.Minute); err != nil || !held {
+		t.Fatalf("Failed to take the lock for another replica: %v", err)
+	}
+	store, err := boltdb.Open(filepath.Join(dir, "store.db"), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	certFile := filepath.Join(dir, "server.crt")
+	issuer, err := acme.New(acme.Config{
+		// Nothing listens here, so an order would fail
+		DirectoryURL: "http://127.0.0.1:1/directory",
+		Domains:      []string{"example.com"},
+		CertFile:     certFile,
+		KeyFile:      filepath.Join(dir, "server.key"),
+		Provider:     noDNS{},
+		Storage:      store,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	elector := &leader.Elector{Lock: lock, Identity: "self", LeaseDuration: time.Minute, RetryPeriod: 10 * time.Millisecond}
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		os.WriteFile(certFile, []byte("issued by the leader"), 0644)
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := obtainInitial(ctx, issuer, elector, 10*time.Millisecond); err != nil {
+		t.Fatalf("Expected to pick up the leader's certificate, got %v", err)
+	}
+	if elector.IsLeader() {
+		t.Error("Expected to stop campaigning once the certificate appeared")
+	}
+}
+
+// TestLeaderOnly tests that leader-only calls are skipped on other replicas
+func TestLeaderOnly(t *testing.T) {
+	var calls atomic.Int32
+	fn := func(context.Context) error {
+		calls.Add(1)
+		return nil
+	}
+
+	leaderOnly(nil, "test", fn)(context.Background())
+	if calls.Load() != 1 {
+		t.Fatalf("Expected the call to run without leader election, got %d calls", calls.Load())
+	}
+
+	elector := &leader.Elector{Lock: &leader.FileLock{Path: filepath.Join(t.TempDir(), "leader.lock")}, Identity: "self", RetryPeriod: 10 * time.Millisecond}
+	wrapped := leaderOnly(elector, "test", fn)
+	wrapped(context.Background())
+	if calls.Load() != 1 {
+		t.Fatal("Expected the call to be skipped before leading")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	leading := make(chan struct{})
+	go func() {
+		done <- elector.Run(ctx, func(ctx context.Context) {
+			wrapped(ctx)
+			close(leading)
+			<-ctx.Done()
+		})
+	}()
+	<-leading
+	cancel()
+	<-done
+	if calls.Load() != 2 {
+		t.Errorf("Expected the call to run on the leader, got %d calls", calls.Load())
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+
+	"tls-agent/internal/authz"
+	"tls-agent/internal/features"
+	"tls-agent/internal/lifecycle"
+	"tls-agent/internal/management"
+	"tls-agent/internal/tlsstore"
+	"tls-agent/internal/watch"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// setupManagement serves the gRPC management API over mutual TLS, using the
+// agent's own certificate as the server certificate
+func setupManagement(cfg features.ManagementConfig, service *management.Service, store *tlsstore.Store, files *watch.Watcher, runner *lifecycle.Runner) error {
+	clientCAs, err := tlsstore.NewRootCAStore(cfg.ClientCA)
+	if err != nil {
+		return fmt.Errorf("management: %w", err)
+	}
+	if err := clientCAs.Register(files, nil); err != nil {
+		return fmt.Errorf("management: %w", err)
+	}
+
+	var authorizer *authz.Authorizer
+	if len(cfg.AllowedClients) > 0 {
+		authorizer = authz.New([]authz.Rule{{Allow: cfg.AllowedClients}})
+	}
+	creds := credentials.NewTLS(&tls.Config{
+		GetCertificate:        store.GetCertificate,
+		ClientAuth:            tls.RequireAnyClientCert,
+		VerifyPeerCertificate: clientCAs.VerifyClientCertificate,
+		MinVersion:            tls.VersionTLS12,
+	})
+	server := management.NewServer(service, creds, authorizer)
+	runner.AddServer("management server", server, func() error {
+		ln, err := net.Listen("tcp", cfg.Address)
+		if err != nil {
+			return err
+		}
+		return server.Serve(ln)
+	})
+	return nil
+}
+
+// rollbackRequester returns a function asking the agent listening on
+// rollback to restore its previous certificate, giving up when ctx ends
+func rollbackRequester(rollback chan<- chan error) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		reply := make(chan error, 1)
+		select {
+		case rollback <- reply:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		select {
+		case err := <-reply:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
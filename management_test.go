@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"tls-agent/internal/agent"
+)
+
+// TestRollbackRequester tests that a rollback request returns the agent's
+// answer, and gives up when the agent is not listening
+func TestRollbackRequester(t *testing.T) {
+	rollback := make(chan chan error)
+	request := rollbackRequester(rollback)
+
+	go func() {
+		reply := <-rollback
+		reply <- agent.ErrNoPrevious
+	}()
+	if err := request(context.Background()); !errors.Is(err, agent.ErrNoPrevious) {
+		t.Errorf("Expected the agent's error, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := request(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected DeadlineExceeded without an agent, got %v", err)
+	}
+}
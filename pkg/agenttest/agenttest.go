@@ -0,0 +1,446 @@
+// Package agenttest runs an agent and a TLS server on an ephemeral port
+// with generated certificates, for integration tests of code embedding the
+// agent. A test starts a Server, rotates its certificate and asserts which
+// certificate a client is served:
+//
+//	srv := agenttest.Start(t)
+//	leaf := srv.Rotate(t)
+//	srv.AssertServed(t, leaf)
+package agenttest
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tls-agent/internal/agent"
+	"tls-agent/internal/tlsstore"
+)
+
+// DefaultName is the DNS name certificates are issued for when none is
+// given
+const DefaultName = "agenttest.local"
+
+// Timeout bounds how long the helpers wait for the agent to pick up a
+// rotation
+var Timeout = 5 * time.Second
+
+// CA issues test certificates. Its pool verifies everything it issues.
+type CA struct {
+	Cert *x509.Certificate
+	Pool *x509.CertPool
+
+	key    *ecdsa.PrivateKey
+	serial atomic.Int64
+}
+
+// NewCA returns a CA with a new key
+func NewCA(t testing.TB) *CA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("agenttest: generate CA key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "agenttest CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("agenttest: create CA certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("agenttest: parse CA certificate: %v", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	ca := &CA{Cert: cert, Pool: pool, key: key}
+	ca.serial.Store(1)
+	return ca
+}
+
+// Issue returns a PEM certificate and PKCS#8 key for names, DefaultName
+// if none, and the parsed leaf. The certificate is valid for both server
+// and client authentication.
+func (ca *CA) Issue(t testing.TB, names ...string) (certPEM, keyPEM []byte, leaf *x509.Certificate) {
+	t.Helper()
+	cert := ca.IssueTLS(t, names...)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatalf("agenttest: marshal key: %v", err)
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, cert.Leaf
+}
+
+// IssueTLS is Issue returning a tls.Certificate, ready to serve or to
+// present as a client certificate. Names that parse as IP addresses become
+// IP SANs.
+func (ca *CA) IssueTLS(t testing.TB, names ...string) *tls.Certificate {
+	t.Helper()
+	if len(names) == 0 {
+		names = []string{DefaultName}
+	}
+	tmpl := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: names[0]},
+		NotAfter:    time.Now().Add(24 * time.Hour),
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	for _, name := range names {
+		if ip := net.ParseIP(name); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, name)
+		}
+	}
+	return ca.Sign(t, tmpl, nil)
+}
+
+// Sign issues a certificate from tmpl for key, or for a new P-256 key if
+// key is nil. Zero serial numbers and validity are filled in as for
+// SelfSigned, except that serials count up per CA.
+func (ca *CA) Sign(t testing.TB, tmpl *x509.Certificate, key crypto.Signer) *tls.Certificate {
+	t.Helper()
+	if tmpl.SerialNumber == nil {
+		c := *tmpl
+		c.SerialNumber = big.NewInt(ca.serial.Add(1))
+		tmpl = &c
+	}
+	return sign(t, tmpl, ca.Cert, ca.key, key)
+}
+
+// SelfSigned returns a certificate from tmpl signed by its own key, or by a
+// new P-256 key if key is nil, for tests that need a validity period, key
+// or extension a CA would not give them. A zero serial number defaults to
+// 1, and a zero NotBefore or NotAfter to an hour either side of now.
+func SelfSigned(t testing.TB, tmpl *x509.Certificate, key crypto.Signer) *tls.Certificate {
+	t.Helper()
+	return sign(t, tmpl, nil, nil, key)
+}
+
+// sign creates the certificate for tmpl, self-signed when parent is nil
+func sign(t testing.TB, tmpl, parent *x509.Certificate, parentKey, key crypto.Signer) *tls.Certificate {
+	t.Helper()
+	if key == nil {
+		var err error
+		if key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+			t.Fatalf("agenttest: generate key: %v", err)
+		}
+	}
+	c := *tmpl
+	if c.SerialNumber == nil {
+		c.SerialNumber = big.NewInt(1)
+	}
+	if c.NotBefore.IsZero() {
+		c.NotBefore = time.Now().Add(-time.Hour)
+	}
+	if c.NotAfter.IsZero() {
+		c.NotAfter = time.Now().Add(time.Hour)
+	}
+	if parent == nil {
+		parent, parentKey = &c, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &c, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatalf("agenttest: create certificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("agenttest: parse certificate: %v", err)
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+// Option adjusts a Server before it starts
+type Option func(*options)
+
+type options struct {
+	names     []string
+	handler   http.Handler
+	agentOpts []agent.Option
+	logger    *log.Logger
+}
+
+// WithNames issues the certificates for names instead of DefaultName
+func WithNames(names ...string) Option {
+	return func(o *options) { o.names = names }
+}
+
+// WithHandler serves handler over TLS instead of a handler answering 200 OK
+func WithHandler(h http.Handler) Option {
+	return func(o *options) { o.handler = h }
+}
+
+// WithAgentOptions passes opts to agent.New after the harness's own, e.g.
+// a validator or notifier under test
+func WithAgentOptions(opts ...agent.Option) Option {
+	return func(o *options) { o.agentOpts = append(o.agentOpts, opts...) }
+}
+
+// WithLogger sends the agent's log lines to logger instead of discarding
+// them
+func WithLogger(logger *log.Logger) Option {
+	return func(o *options) { o.logger = logger }
+}
+
+// Server is an agent watching a generated certificate pair and an HTTPS
+// server on 127.0.0.1 serving from the agent's store. It is stopped when
+// the test ends.
+type Server struct {
+	CA       *CA
+	CertFile string
+	KeyFile  string
+
+	// Addr is the server's host:port
+	Addr string
+
+	Store *tlsstore.Store
+	Agent *agent.Agent
+
+	names []string
+}
+
+// Start starts a Server and returns once its agent is watching the pair
+func Start(t testing.TB, opts ...Option) *Server {
+	t.Helper()
+	o := options{
+		handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "OK\n") }),
+		logger:  log.New(io.Discard, "", 0),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	dir := t.TempDir()
+	s := &Server{
+		CA:       NewCA(t),
+		CertFile: filepath.Join(dir, "tls.crt"),
+		KeyFile:  filepath.Join(dir, "tls.key"),
+		names:    o.names,
+	}
+	certPEM, keyPEM, _ := s.CA.Issue(t, s.names...)
+	s.write(t, certPEM, keyPEM)
+	cert, err := tlsstore.Load(s.CertFile, s.KeyFile)
+	if err != nil {
+		t.Fatalf("agenttest: load certificate: %v", err)
+	}
+	s.Store = tlsstore.New(cert)
+
+	agentOpts := append([]agent.Option{
+		agent.WithPaths(s.CertFile, s.KeyFile),
+		agent.WithDebounce(50 * time.Millisecond),
+		agent.WithLogger(o.logger),
+	}, o.agentOpts...)
+	s.Agent = agent.New(s.Store, agentOpts...)
+	if err := s.Agent.Start(); err != nil {
+		t.Fatalf("agenttest: start agent: %v", err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+		defer cancel()
+		s.Agent.Stop(ctx)
+	})
+	s.awaitWatching(t)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("agenttest: listen: %v", err)
+	}
+	s.Addr = ln.Addr().String()
+	server := &http.Server{
+		Handler:           o.handler,
+		TLSConfig:         &tls.Config{GetCertificate: s.Store.GetCertificate},
+		ReadHeaderTimeout: Timeout,
+		ErrorLog:          log.New(io.Discard, "", 0),
+	}
+	go server.ServeTLS(ln, "", "")
+	t.Cleanup(func() { server.Close() })
+	return s
+}
+
+// awaitWatching waits until the agent reacts to a rewrite of the pair,
+// since a rotation before its watches are set up would go unnoticed
+func (s *Server) awaitWatching(t testing.TB) {
+	t.Helper()
+	certPEM, err := os.ReadFile(s.CertFile)
+	if err != nil {
+		t.Fatalf("agenttest: %v", err)
+	}
+	keyPEM, err := os.ReadFile(s.KeyFile)
+	if err != nil {
+		t.Fatalf("agenttest: %v", err)
+	}
+	seen := len(s.Agent.State().History())
+	deadline := time.Now().Add(Timeout)
+	for time.Now().Before(deadline) {
+		s.write(t, certPEM, keyPEM)
+		for range 10 {
+			time.Sleep(20 * time.Millisecond)
+			if len(s.Agent.State().History()) > seen {
+				return
+			}
+		}
+	}
+	t.Fatalf("agenttest: agent did not start watching %s within %s", s.CertFile, Timeout)
+}
+
+// write replaces the pair, key first, each by a rename
+func (s *Server) write(t testing.TB, certPEM, keyPEM []byte) {
+	t.Helper()
+	writeFile(t, s.KeyFile, keyPEM)
+	writeFile(t, s.CertFile, certPEM)
+}
+
+// Rotate writes a new certificate and key for names, the server's names if
+// none, and waits until the agent serves them. It returns the new leaf.
+func (s *Server) Rotate(t testing.TB, names ...string) *x509.Certificate {
+	t.Helper()
+	leaf := s.RotateNoWait(t, names...)
+	s.WaitServing(t, leaf)
+	return leaf
+}
+
+// RotateNoWait writes a new certificate and key like Rotate without
+// waiting for the agent, e.g. to assert that a rotation is rejected
+func (s *Server) RotateNoWait(t testing.TB, names ...string) *x509.Certificate {
+	t.Helper()
+	if len(names) == 0 {
+		names = s.names
+	}
+	certPEM, keyPEM, leaf := s.CA.Issue(t, names...)
+	s.write(t, certPEM, keyPEM)
+	return leaf
+}
+
+// WriteFiles replaces the pair with certPEM and keyPEM as given, e.g. to
+// rotate in a broken or foreign certificate, without waiting for the agent
+func (s *Server) WriteFiles(t testing.TB, certPEM, keyPEM []byte) {
+	t.Helper()
+	s.write(t, certPEM, keyPEM)
+}
+
+// WaitServing waits until the store serves leaf, failing the test after
+// Timeout
+func (s *Server) WaitServing(t testing.TB, leaf *x509.Certificate) {
+	t.Helper()
+	s.WaitFor(t, "certificate "+describe(leaf)+" to be served", func() bool {
+		return bytes.Equal(s.Store.Info().Cert.Certificate[0], leaf.Raw)
+	})
+}
+
+// WaitFor polls cond until it holds, failing the test with what after
+// Timeout, e.g. to wait for a reload result in the agent's history
+func (s *Server) WaitFor(t testing.TB, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(Timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("agenttest: timed out after %s waiting for %s", Timeout, what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// ClientConfig returns a client TLS config trusting the server's CA for
+// serverName, the first certificate name if empty
+func (s *Server) ClientConfig(serverName string) *tls.Config {
+	if serverName == "" {
+		serverName = DefaultName
+		if len(s.names) > 0 {
+			serverName = s.names[0]
+		}
+	}
+	return &tls.Config{RootCAs: s.CA.Pool, ServerName: serverName}
+}
+
+// Client returns an HTTP client trusting the server's CA. Requests go to
+// "https://" + s.Addr.
+func (s *Server) Client() *http.Client {
+	return &http.Client{
+		Timeout:   Timeout,
+		Transport: &http.Transport{TLSClientConfig: s.ClientConfig(""), DisableKeepAlives: true},
+	}
+}
+
+// Served does a fresh handshake with serverName, the first certificate
+// name if empty, and returns the leaf the server presented
+func (s *Server) Served(t testing.TB, serverName string) *x509.Certificate {
+	t.Helper()
+	leaf, err := s.handshake(serverName)
+	if err != nil {
+		t.Fatalf("agenttest: handshake with %s: %v", s.Addr, err)
+	}
+	return leaf
+}
+
+func (s *Server) handshake(serverName string) (*x509.Certificate, error) {
+	dialer := &tls.Dialer{NetDialer: &net.Dialer{Timeout: Timeout}, Config: s.ClientConfig(serverName)}
+	conn, err := dialer.Dial("tcp", s.Addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	certs := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil, errors.New("no certificate presented")
+	}
+	return certs[0], nil
+}
+
+// AssertServed fails the test unless handshakes present leaf within
+// Timeout
+func (s *Server) AssertServed(t testing.TB, leaf *x509.Certificate) {
+	t.Helper()
+	deadline := time.Now().Add(Timeout)
+	for {
+		got, err := s.handshake("")
+		if err == nil && got.Equal(leaf) {
+			return
+		}
+		if time.Now().After(deadline) {
+			if err != nil {
+				t.Fatalf("agenttest: expected certificate %s, handshake failed: %v", describe(leaf), err)
+			}
+			t.Fatalf("agenttest: expected certificate %s, served %s", describe(leaf), describe(got))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// AssertNotServed fails the test if a handshake presents leaf
+func (s *Server) AssertNotServed(t testing.TB, leaf *x509.Certificate) {
+	t.Helper()
+	if got := s.Served(t, ""); got.Equal(leaf) {
+		t.Fatalf("agenttest: certificate %s is served", describe(leaf))
+	}
+}
+
+func describe(leaf *x509.Certificate) string {
+	return fmt.Sprintf("%s (%s)", leaf.SerialNumber, leaf.Subject.CommonName)
+}
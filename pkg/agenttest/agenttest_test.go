@@ -0,0 +1,106 @@
+package agenttest
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tls-agent/internal/agent"
+)
+
+// TestServerRotate tests that rotations are served over TLS and HTTP
+func TestServerRotate(t *testing.T) {
+	srv := Start(t)
+	first := srv.Served(t, "")
+
+	leaf := srv.Rotate(t)
+	if leaf.Equal(first) {
+		t.Fatal("Expected Rotate to issue a new certificate")
+	}
+	srv.AssertServed(t, leaf)
+	srv.AssertNotServed(t, first)
+
+	resp, err := srv.Client().Get("https://" + srv.Addr + "/")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "OK\n" {
+		t.Errorf("Expected 200 OK, got %d %q", resp.StatusCode, body)
+	}
+	if !resp.TLS.PeerCertificates[0].Equal(leaf) {
+		t.Error("Expected the HTTP client to be served the rotated certificate")
+	}
+}
+
+// TestServerNames tests certificates issued for custom names
+func TestServerNames(t *testing.T) {
+	srv := Start(t, WithNames("api.example.test", "www.example.test"))
+	if got := srv.Served(t, "www.example.test"); got.Subject.CommonName != "api.example.test" {
+		t.Errorf("Expected a certificate for api.example.test, got %s", got.Subject.CommonName)
+	}
+
+	leaf := srv.Rotate(t, "other.example.test")
+	if got := srv.Served(t, "other.example.test"); !got.Equal(leaf) {
+		t.Errorf("Expected the rotated certificate for other.example.test, got %s", got.Subject.CommonName)
+	}
+}
+
+// TestIssueAndSign tests IP names and the defaults filled into templates
+func TestIssueAndSign(t *testing.T) {
+	ca := NewCA(t)
+	leaf := ca.IssueTLS(t, "www.example.test", "10.0.0.1").Leaf
+	if len(leaf.DNSNames) != 1 || len(leaf.IPAddresses) != 1 || !leaf.IPAddresses[0].Equal(net.ParseIP("10.0.0.1")) {
+		t.Errorf("Expected one DNS and one IP SAN, got %v %v", leaf.DNSNames, leaf.IPAddresses)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{Roots: ca.Pool, DNSName: "www.example.test"}); err != nil {
+		t.Errorf("Expected the CA's pool to verify what it issued: %v", err)
+	}
+
+	notBefore := time.Now().Add(time.Hour)
+	self := SelfSigned(t, &x509.Certificate{NotBefore: notBefore}, nil).Leaf
+	if !self.NotBefore.Equal(notBefore.Truncate(time.Second)) || !self.NotAfter.After(time.Now()) || self.SerialNumber.Int64() != 1 {
+		t.Errorf("Expected the given start and default serial and expiry, got %+v", self)
+	}
+	if err := self.CheckSignature(self.SignatureAlgorithm, self.RawTBSCertificate, self.Signature); err != nil {
+		t.Errorf("Expected a self-signed certificate: %v", err)
+	}
+}
+
+// TestServerRejectedRotation tests asserting a rotation the agent rejects
+func TestServerRejectedRotation(t *testing.T) {
+	var reject atomic.Bool
+	srv := Start(t, WithAgentOptions(agent.WithValidator(func(*tls.Certificate) error {
+		if reject.Load() {
+			return errors.New("rejected by test")
+		}
+		return nil
+	})))
+	current := srv.Served(t, "")
+
+	reject.Store(true)
+	leaf := srv.RotateNoWait(t)
+	waitHistory(t, srv, agent.ResultRejected)
+	srv.AssertNotServed(t, leaf)
+	srv.AssertServed(t, current)
+
+	// A broken pair is refused and the last good certificate kept
+	srv.WriteFiles(t, []byte("not a certificate"), []byte("not a key"))
+	waitHistory(t, srv, agent.ResultFailed)
+	srv.AssertServed(t, current)
+}
+
+func waitHistory(t *testing.T, srv *Server, result string) {
+	t.Helper()
+	srv.WaitFor(t, "a "+result+" reload", func() bool {
+		history := srv.Agent.State().History()
+		return len(history) > 0 && history[0].Result == result
+	})
+}
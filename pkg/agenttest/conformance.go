@@ -0,0 +1,222 @@
+package agenttest
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// SourceFixture is a certificate source under test: the load function an
+// agent is given with agent.WithSource, and hooks that control what it
+// serves. Only Load is required; the defaults suit a source reading the
+// pair from CertFile and KeyFile.
+type SourceFixture struct {
+	// Load is the source
+	Load func(certFile, keyFile string) (*tls.Certificate, error)
+
+	// CertFile and KeyFile are passed to Load; they default to files in a
+	// temporary directory
+	CertFile string
+	KeyFile  string
+
+	// Publish makes certPEM and keyPEM the pair the source returns next,
+	// e.g. by writing a Vault secret or a Kubernetes Secret. It defaults
+	// to writing CertFile and KeyFile.
+	Publish func(t testing.TB, certPEM, keyPEM []byte)
+
+	// Break makes the backing store unusable until the next Publish, e.g.
+	// by stopping a fake server or publishing garbage. It defaults to
+	// writing garbage to CertFile and KeyFile.
+	Break func(t testing.TB)
+
+	// Close, if set, releases the source. Calling it twice must be safe and
+	// loads after it must fail.
+	Close func() error
+}
+
+// RunSourceConformance checks the behaviors an agent relies on from a
+// certificate source, each in a subtest with a fixture from newFixture:
+//
+//   - initial load returns the published pair, with a key matching the leaf
+//   - rotation returns the newly published pair on the next load
+//   - error recovery: while broken, loads fail without returning a
+//     certificate, or return the last good pair, never a mismatched one;
+//     the next publish is loaded again
+//   - concurrent loads are safe and agree
+//   - close semantics, when Close is set: Close is idempotent and loads
+//     after it fail
+//
+// Run it from a test of the source:
+//
+//	func TestVaultSourceConformance(t *testing.T) {
+//		agenttest.RunSourceConformance(t, func(t *testing.T) *agenttest.SourceFixture {
+//			v := newFakeVault(t)
+//			return &agenttest.SourceFixture{Load: v.Source().Load, Publish: v.Put, Break: v.Stop}
+//		})
+//	}
+func RunSourceConformance(t *testing.T, newFixture func(t *testing.T) *SourceFixture) {
+	t.Run("InitialLoad", func(t *testing.T) {
+		f, ca := setupFixture(t, newFixture)
+		leaf := f.publish(t, ca)
+		f.expectLoad(t, leaf)
+	})
+
+	t.Run("Rotation", func(t *testing.T) {
+		f, ca := setupFixture(t, newFixture)
+		f.expectLoad(t, f.publish(t, ca))
+		for range 3 {
+			f.expectLoad(t, f.publish(t, ca))
+		}
+	})
+
+	t.Run("ErrorRecovery", func(t *testing.T) {
+		f, ca := setupFixture(t, newFixture)
+		good := f.publish(t, ca)
+		f.expectLoad(t, good)
+
+		f.Break(t)
+		for range 3 {
+			cert, err := f.Load(f.CertFile, f.KeyFile)
+			switch {
+			case err != nil && cert != nil:
+				t.Fatalf("Load returned both a certificate and an error: %v", err)
+			case err == nil && cert == nil:
+				t.Fatal("Load returned neither a certificate nor an error while broken")
+			case err == nil:
+				// A caching source may keep serving the last good pair
+				checkPair(t, cert, good)
+			}
+		}
+
+		f.expectLoad(t, f.publish(t, ca))
+	})
+
+	t.Run("ConcurrentLoads", func(t *testing.T) {
+		f, ca := setupFixture(t, newFixture)
+		leaf := f.publish(t, ca)
+		var wg sync.WaitGroup
+		errs := make(chan error, 16)
+		for range cap(errs) {
+			wg.Go(func() {
+				cert, err := f.Load(f.CertFile, f.KeyFile)
+				if err == nil && !bytes.Equal(cert.Certificate[0], leaf.Raw) {
+					err = errMismatch
+				}
+				errs <- err
+			})
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				t.Fatalf("Concurrent load failed: %v", err)
+			}
+		}
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		f, ca := setupFixture(t, newFixture)
+		if f.Close == nil {
+			t.Skip("source has no Close")
+		}
+		f.expectLoad(t, f.publish(t, ca))
+		if err := f.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+		if err := f.Close(); err != nil {
+			t.Errorf("Second Close failed: %v", err)
+		}
+		if cert, err := f.Load(f.CertFile, f.KeyFile); err == nil || cert != nil {
+			t.Errorf("Expected Load after Close to fail, got %v", err)
+		}
+	})
+}
+
+// errMismatch reports a load returning a certificate other than the one
+// published
+var errMismatch = errors.New("loaded a certificate other than the published one")
+
+// setupFixture builds a fixture and fills in its defaults
+func setupFixture(t *testing.T, newFixture func(t *testing.T) *SourceFixture) (*SourceFixture, *CA) {
+	t.Helper()
+	f := newFixture(t)
+	if f == nil || f.Load == nil {
+		t.Fatal("agenttest: SourceFixture.Load is required")
+	}
+	if f.CertFile == "" || f.KeyFile == "" {
+		dir := t.TempDir()
+		f.CertFile, f.KeyFile = filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	}
+	if f.Publish == nil {
+		f.Publish = func(t testing.TB, certPEM, keyPEM []byte) {
+			t.Helper()
+			writeFile(t, f.KeyFile, keyPEM)
+			writeFile(t, f.CertFile, certPEM)
+		}
+	}
+	if f.Break == nil {
+		f.Break = func(t testing.TB) {
+			t.Helper()
+			writeFile(t, f.KeyFile, []byte("not a key\n"))
+			writeFile(t, f.CertFile, []byte("not a certificate\n"))
+		}
+	}
+	if f.Close != nil {
+		t.Cleanup(func() { f.Close() })
+	}
+	return f, NewCA(t)
+}
+
+// publish issues and publishes a new pair, returning its leaf
+func (f *SourceFixture) publish(t *testing.T, ca *CA) *x509.Certificate {
+	t.Helper()
+	certPEM, keyPEM, leaf := ca.Issue(t)
+	f.Publish(t, certPEM, keyPEM)
+	return leaf
+}
+
+// expectLoad loads and checks that leaf is returned with its key
+func (f *SourceFixture) expectLoad(t *testing.T, leaf *x509.Certificate) {
+	t.Helper()
+	cert, err := f.Load(f.CertFile, f.KeyFile)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cert == nil {
+		t.Fatal("Load returned no certificate and no error")
+	}
+	checkPair(t, cert, leaf)
+}
+
+// checkPair fails unless cert is leaf with a key for it
+func checkPair(t *testing.T, cert *tls.Certificate, leaf *x509.Certificate) {
+	t.Helper()
+	if len(cert.Certificate) == 0 || !bytes.Equal(cert.Certificate[0], leaf.Raw) {
+		t.Fatalf("Load returned a certificate other than the published one (serial %s)", leaf.SerialNumber)
+	}
+	key, ok := cert.PrivateKey.(crypto.Signer)
+	if !ok {
+		t.Fatalf("Load returned a private key of type %T, which cannot sign", cert.PrivateKey)
+	}
+	type equaler interface{ Equal(crypto.PublicKey) bool }
+	if pub, ok := key.Public().(equaler); !ok || !pub.Equal(leaf.PublicKey) {
+		t.Fatal("Load returned a private key that does not match the certificate")
+	}
+}
+
+func writeFile(t testing.TB, path string, data []byte) {
+	t.Helper()
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		t.Fatalf("agenttest: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatalf("agenttest: %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+package agenttest
+
+import (
+	"crypto/tls"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"tls-agent/internal/tlsstore"
+)
+
+// TestFileSourceConformance runs the suite against the default source
+func TestFileSourceConformance(t *testing.T) {
+	RunSourceConformance(t, func(t *testing.T) *SourceFixture {
+		return &SourceFixture{Load: tlsstore.Load}
+	})
+}
+
+// TestTimeoutSourceConformance runs the suite against a load bounded by a
+// timeout
+func TestTimeoutSourceConformance(t *testing.T) {
+	RunSourceConformance(t, func(t *testing.T) *SourceFixture {
+		return &SourceFixture{Load: tlsstore.WithTimeout(tlsstore.Load, time.Minute)}
+	})
+}
+
+// memorySource is a remote-style source holding its pair in memory, which
+// keeps serving the last good pair while its backend is down
+type memorySource struct {
+	mu              sync.Mutex
+	certPEM, keyPEM []byte
+	last            *tls.Certificate
+	down, closed    bool
+}
+
+func (m *memorySource) Load(string, string) (*tls.Certificate, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch {
+	case m.closed:
+		return nil, errors.New("source closed")
+	case m.down && m.last != nil:
+		return m.last, nil
+	case m.down:
+		return nil, errors.New("backend unavailable")
+	}
+	cert, err := tls.X509KeyPair(m.certPEM, m.keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	m.last = &cert
+	return m.last, nil
+}
+
+// TestMemorySourceConformance runs the suite against a caching source with
+// its own Publish, Break and Close
+func TestMemorySourceConformance(t *testing.T) {
+	RunSourceConformance(t, func(t *testing.T) *SourceFixture {
+		m := &memorySource{}
+		return &SourceFixture{
+			Load: m.Load,
+			Publish: func(_ testing.TB, certPEM, keyPEM []byte) {
+				m.mu.Lock()
+				defer m.mu.Unlock()
+				m.certPEM, m.keyPEM, m.down = certPEM, keyPEM, false
+			},
+			Break: func(testing.TB) {
+				m.mu.Lock()
+				defer m.mu.Unlock()
+				m.down = true
+			},
+			Close: func() error {
+				m.mu.Lock()
+				defer m.mu.Unlock()
+				m.closed = true
+				return nil
+			},
+		}
+	})
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"tls-agent/internal/agent"
+)
+
+// replayUsage describes the replay subcommand
+const replayUsage = `Usage:
+  tls-agent replay <file> [--debounce <duration>]
+
+Replays a recording made with record_file through the agent's change
+detection and debouncing, printing what the agent did and what the replay
+decides. --debounce replays with another quiet period; 0 disables it.
+`
+
+// runReplay implements `tls-agent replay`. It returns the exit code.
+func runReplay(args []string, out io.Writer) int {
+	var path string
+	var opts agent.ReplayOptions
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--debounce" && i+1 < len(args):
+			i++
+			d, err := time.ParseDuration(args[i])
+			if err != nil || d < 0 {
+				fmt.Fprintf(out, "Invalid --debounce %q\n%s", args[i], replayUsage)
+				return 2
+			}
+			opts.Debounce, opts.NoDebounce = d, d == 0
+		case path == "":
+			path = args[i]
+		default:
+			fmt.Fprint(out, replayUsage)
+			return 2
+		}
+	}
+	if path == "" {
+		fmt.Fprint(out, replayUsage)
+		return 2
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(out, "Could not open recording: %v\n", err)
+		return 1
+	}
+	defer f.Close()
+	if _, err := agent.Replay(f, out, opts); err != nil {
+		fmt.Fprintf(out, "Replay failed: %v\n", err)
+		return 1
+	}
+	return 0
+}
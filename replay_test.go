@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRunReplay tests the replay subcommand's arguments and output
+func TestRunReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "record.jsonl")
+	recording := `{"time":"2026-01-01T00:00:00Z","kind":"start","paths":["tls.crt"],"debounce":"2s"}
+{"time":"2026-01-01T00:00:10Z","kind":"event","path":"tls.crt","op":"WRITE","size":1200}
+{"time":"2026-01-01T00:00:11Z","kind":"event","path":"tls.crt","op":"WRITE","size":1200}
+`
+	if err := os.WriteFile(path, []byte(recording), 0600); err != nil {
+		t.Fatalf("Failed to write recording: %v", err)
+	}
+
+	for _, tc := range []struct {
+		args []string
+		code int
+		want string
+	}{
+		{nil, 2, "Usage:"},
+		{[]string{path, "--debounce", "soon"}, 2, `Invalid --debounce "soon"`},
+		{[]string{filepath.Join(t.TempDir(), "missing.jsonl")}, 1, "Could not open recording"},
+		{[]string{path}, 0, "the replay 1"},
+		{[]string{path, "--debounce", "0"}, 0, "the replay 2"},
+	} {
+		var out strings.Builder
+		if code := runReplay(tc.args, &out); code != tc.code || !strings.Contains(out.String(), tc.want) {
+			t.Errorf("replay %v: expected exit code %d and %q, got %d:\n%s", tc.args, tc.code, tc.want, code, out.String())
+		}
+	}
+}
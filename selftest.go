@@ -0,0 +1,459 @@
+package main
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"tls-agent/internal/admin"
+	"tls-agent/internal/agent"
+	"tls-agent/internal/delegated"
+	"tls-agent/internal/deploy"
+	"tls-agent/internal/features"
+	"tls-agent/internal/keyage"
+	"tls-agent/internal/selftest"
+	"tls-agent/internal/stapling"
+	"tls-agent/internal/tlsconfig"
+	"tls-agent/internal/tlsstore"
+)
+
+// listenAddress is the public TLS listener address
+const listenAddress = ":8443"
+
+// runSelfTest implements `tls-agent --self-test`: it verifies that the agent
+// could start with featureConfig and prints the report. It returns the exit code.
+func runSelfTest(featureConfig features.Features, out io.Writer, asJSON bool) int {
+	report := selftest.Run(selfTestChecks(featureConfig, true))
+	if asJSON {
+		if err := report.PrintJSON(out); err != nil {
+			return 1
+		}
+	} else {
+		report.Print(out)
+	}
+	if !report.Passed {
+		return 1
+	}
+	return 0
+}
+
+// selfTestChecks returns the startup checks. Port checks are left out when
+// the agent is about to bind the ports itself.
+func selfTestChecks(featureConfig features.Features, ports bool) []selftest.Check {
+	checks := []selftest.Check{
+		selftest.Config(func() error { return validateConfig(featureConfig) }),
+		selftest.Clock(),
+	}
+
+	load := certLoader(featureConfig, nil, nil, nil)
+	roots := selfTestRoots(featureConfig.TrustStore.CABundle)
+	grace := time.Duration(featureConfig.NotBeforeGrace) * time.Second
+	defaults := agent.DefaultConfig()
+	checks = append(checks, selftest.Certificate(defaults.CertFile, defaults.KeyFile, load, roots, grace)...)
+	watched := []string{defaults.CertFile, defaults.KeyFile, featureConfig.ChainFile}
+	pairs := slices.Clone(featureConfig.Certificates)
+	for _, tc := range featureConfig.Tenants {
+		pairs = append(pairs, tc.Certificates...)
+	}
+	for _, c := range pairs {
+		checks = append(checks, selftest.Certificate(c.CertFile, c.KeyFile, load, roots, grace)...)
+		watched = append(watched, c.CertFile, c.KeyFile, c.ChainFile)
+	}
+
+	if featureConfig.CertificateWatcher {
+		watched = slices.DeleteFunc(watched, func(p string) bool { return p == "" })
+		checks = append(checks, selftest.Watchable(watched...))
+	}
+	if ports {
+		checks = append(checks, selftest.Port(listenAddress))
+		if featureConfig.MetricsCollection || featureConfig.HealthCheck || featureConfig.Dashboard {
+			checks = append(checks, selftest.Port(featureConfig.AdminAddress))
+		}
+	}
+	return checks
+}
+
+// selfTestRoots returns the system roots plus the configured CA bundle, so
+// chains from a private CA verify
+func selfTestRoots(caBundle string) *x509.CertPool {
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+	if caBundle != "" {
+		if data, err := os.ReadFile(caBundle); err == nil {
+			roots.AppendCertsFromPEM(data)
+		}
+	}
+	return roots
+}
+
+// validateConfig reports every invalid setting at once
+func validateConfig(cfg features.Features) error {
+	var errs []error
+	invalid := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	for _, setting := range []struct {
+		name  string
+		value int
+	}{
+		{"shutdown_timeout", cfg.ShutdownTimeout},
+		{"agent_shutdown_timeout", cfg.AgentShutdownTimeout},
+		{"cert_watch_interval", cfg.CertWatchInterval},
+		{"debounce_interval", cfg.DebounceInterval},
+		{"cert_expiry_warning", cfg.CertExpiryWarning},
+		{"not_before_grace", cfg.NotBeforeGrace},
+		{"load_workers", cfg.LoadWorkers},
+		{"retained_versions", cfg.RetainedVersions},
+		{"load_timeout", cfg.LoadTimeout},
+		{"max_cert_file_size", cfg.MaxCertFileSize},
+	} {
+		if setting.value < 0 {
+			invalid("%s must not be negative, got %d", setting.name, setting.value)
+		}
+	}
+	if cfg.PeriodicCertCheck && cfg.CertWatchInterval == 0 {
+		invalid("cert_watch_interval must be positive")
+	}
+
+	if ka := cfg.KeyAge; ka.MaxAge != 0 {
+		if ka.MaxAge < 0 {
+			invalid("key_age.max_age must not be negative")
+		}
+		if ka.CheckInterval <= 0 {
+			invalid("key_age.check_interval must be positive")
+		}
+		switch ka.Action {
+		case keyage.ActionWarn:
+		case keyage.ActionReissue:
+			if !cfg.ACME.Enabled {
+				invalid("key_age.action %q needs acme to issue certificates", ka.Action)
+			}
+		default:
+			invalid("invalid key_age.action %q", ka.Action)
+		}
+	}
+	if cfg.KeyHygiene.ZeroizeDelay < 0 {
+		invalid("key_hygiene.zeroize_delay must not be negative")
+	}
+	if c := cfg.Chaos; c.Enabled {
+		for _, rate := range []struct {
+			name  string
+			value float64
+		}{
+			{"load_failure_rate", c.LoadFailureRate},
+			{"slow_read_rate", c.SlowReadRate},
+			{"watcher_error_rate", c.WatcherErrorRate},
+		} {
+			if rate.value < 0 || rate.value > 1 {
+				invalid("chaos.%s must be between 0 and 1, got %g", rate.name, rate.value)
+			}
+		}
+		if c.SlowReadDelay < 0 {
+			invalid("chaos.slow_read_delay must not be negative")
+		}
+	}
+	if cfg.KeyHygiene.AdminKeyExport && cfg.KeyHygiene.NoExport {
+		invalid("key_hygiene.admin_key_export conflicts with no_export")
+	}
+	if cfg.KeyHygiene.AdminKeyExport && !cfg.AdminAuth.Enabled {
+		invalid("key_hygiene.admin_key_export needs admin_auth.enabled")
+	}
+	switch cfg.KeyPermissions.Policy {
+	case tlsstore.PolicyOff, tlsstore.PolicyWarn, tlsstore.PolicyEnforce:
+	default:
+		invalid("invalid key_permissions.policy %q", cfg.KeyPermissions.Policy)
+	}
+	switch cfg.TrustStore.ClientAuth {
+	case "", "none", "request", "require":
+	default:
+		invalid("invalid trust_store.client_auth %q", cfg.TrustStore.ClientAuth)
+	}
+	if cfg.TrustStore.ClientAuth != "" && cfg.TrustStore.ClientAuth != "none" && cfg.TrustStore.CABundle == "" {
+		invalid("trust_store.client_auth %q requires trust_store.ca_bundle", cfg.TrustStore.ClientAuth)
+	}
+	for _, proto := range cfg.TLS.ALPN {
+		if proto == "" || len(proto) > 255 {
+			invalid("tls.alpn: invalid protocol %q", proto)
+		}
+		if proto == "h2" && !cfg.HTTP2.Enabled {
+			invalid("tls.alpn lists h2 but http2.enabled is false")
+		}
+	}
+	if cfg.HTTP2.MaxConcurrentStreams < 0 || cfg.HTTP2.IdleTimeout < 0 {
+		invalid("http2.max_concurrent_streams and idle_timeout must not be negative")
+	}
+	if cf := cfg.ConnectionFilter; cf.RatePerIP < 0 || cf.BurstPerIP < 0 {
+		invalid("connection_filter.rate_per_ip and burst_per_ip must not be negative")
+	}
+	for _, list := range [][]string{cfg.ConnectionFilter.Allow, cfg.ConnectionFilter.Deny} {
+		if _, err := tlsconfig.ParsePrefixes(list); err != nil {
+			invalid("connection_filter: %v", err)
+		}
+	}
+	if hl := cfg.HandshakeLimits; hl.MaxConcurrent < 0 || hl.Rate < 0 || hl.Burst < 0 || hl.RatePerIP < 0 || hl.BurstPerIP < 0 || hl.QueueTimeout < 0 || hl.Timeout < 0 {
+		invalid("handshake_limits values must not be negative")
+	}
+	switch cfg.ExpiredCertificate.Mode {
+	case "", tlsstore.ExpiredServe, tlsstore.ExpiredFailClosed:
+	default:
+		invalid("invalid expired_certificate.mode %q", cfg.ExpiredCertificate.Mode)
+	}
+	if cfg.ExpiredCertificate.Grace < 0 {
+		invalid("expired_certificate.grace must not be negative")
+	}
+	switch cfg.ConnectionRotation.Mode {
+	case "", "never", "drain", "close":
+	default:
+		invalid("invalid connection_rotation.mode %q", cfg.ConnectionRotation.Mode)
+	}
+	if cfg.ConnectionRotation.GracePeriod < 0 {
+		invalid("connection_rotation.grace_period must not be negative")
+	}
+	switch cfg.HandshakeLimits.Overflow {
+	case "", "queue", "reject":
+	default:
+		invalid("invalid handshake_limits.overflow %q", cfg.HandshakeLimits.Overflow)
+	}
+	for i, cp := range cfg.TLS.ClientPolicies {
+		if cp.Name == "" {
+			invalid("tls.client_policies[%d] needs a name", i)
+		}
+		switch cp.ClientAuth {
+		case "", "none":
+		case "request", "require":
+			if cp.CABundle == "" && cfg.TrustStore.CABundle == "" {
+				invalid("tls.client_policies[%d] client_auth %q needs a ca_bundle", i, cp.ClientAuth)
+			}
+		default:
+			invalid("tls.client_policies[%d] has invalid client_auth %q", i, cp.ClientAuth)
+		}
+		if _, err := tlsconfig.ParsePrefixes(cp.Sources); err != nil {
+			invalid("tls.client_policies[%d] sources: %v", i, err)
+		}
+		if _, err := tlsconfig.ParseVersion(cp.MinVersion); err != nil {
+			invalid("tls.client_policies[%d]: %v", i, err)
+		}
+		suites, err := tlsconfig.ParseCipherSuites(cp.CipherSuites)
+		if err != nil {
+			invalid("tls.client_policies[%d]: %v", i, err)
+		}
+		if cfg.FIPS.Enabled {
+			if err := (&tlsconfig.ClientPolicy{Name: cp.Name, CipherSuites: suites}).CheckFIPS(); err != nil {
+				invalid("tls.client_policies[%d]: %v", i, err)
+			}
+		}
+	}
+	if cfg.FIPS.Enabled && cfg.ECH.Enabled {
+		invalid("fips mode does not allow ech, whose key exchange is not FIPS approved")
+	}
+	if cfg.OCSP.Stapling {
+		switch cfg.OCSP.MustStaple {
+		case stapling.MustStapleEnforce, stapling.MustStapleWarn:
+		default:
+			invalid("invalid ocsp.must_staple %q", cfg.OCSP.MustStaple)
+		}
+	}
+	if dc := cfg.DelegatedCredentials; dc.Enabled {
+		if _, err := delegated.ParseScheme(dc.KeyType); err != nil {
+			invalid("delegated_credentials: %v", err)
+		}
+		if dc.Validity < 1 || dc.Validity > 168 {
+			invalid("delegated_credentials.validity must be between 1 and 168 hours")
+		}
+		if dc.CredentialFile == "" || dc.KeyFile == "" {
+			invalid("delegated_credentials needs credential_file and key_file")
+		}
+	}
+	if cfg.Keyless.Enabled && len(cfg.Keyless.Servers) == 0 {
+		invalid("keyless.enabled requires keyless.servers")
+	}
+	if k := cfg.Keyless; (k.CertFile == "") != (k.KeyFile == "") {
+		invalid("keyless needs both cert_file and key_file, or neither")
+	}
+	for i, c := range cfg.Certificates {
+		if c.CertFile == "" {
+			invalid("certificates[%d] needs cert_file", i)
+		}
+	}
+	if cfg.Distribution.Server.Enabled && cfg.Distribution.Server.ClientCA == "" {
+		invalid("distribution.server requires client_ca")
+	}
+	if r := cfg.Distribution.Remote; r.URL != "" && (r.CertFile == "" || r.KeyFile == "") {
+		invalid("distribution.remote requires cert_file and key_file")
+	}
+	for _, p := range []struct {
+		name string
+		pins []string
+	}{
+		{"proxy.tls.pins", cfg.Proxy.TLS.Pins},
+		{"notifications.webhook_tls.pins", cfg.Notifications.WebhookTLS.Pins},
+		{"heartbeat.tls.pins", cfg.Heartbeat.TLS.Pins},
+		{"distribution.remote.pins", cfg.Distribution.Remote.Pins},
+		{"keyless.pins", cfg.Keyless.Pins},
+	} {
+		if _, err := tlsconfig.ParsePins(p.pins); err != nil {
+			invalid("%s: %v", p.name, err)
+		}
+	}
+	if cfg.Management.Enabled && cfg.Management.ClientCA == "" {
+		invalid("management requires client_ca")
+	}
+	if r := cfg.AccessLog.SampleRate; r < 0 || r > 1 {
+		invalid("access_log.sample_rate must be between 0 and 1")
+	}
+	if h := cfg.RequestID.Header; cfg.RequestID.Enabled && (h == "" || strings.ContainsAny(h, " \t:")) {
+		invalid("invalid request_id.header %q", h)
+	}
+	if cfg.Webhook.Enabled && cfg.Proxy.Upstream == "" {
+		invalid("webhook requires proxy.upstream, the webhook handler")
+	}
+	for i, h := range cfg.Hooks {
+		if len(h.Command) == 0 {
+			invalid("hooks[%d] needs a command", i)
+		}
+		for _, e := range h.Events {
+			if !slices.Contains(hookEvents, e) {
+				invalid("hooks[%d] has unknown event %q", i, e)
+			}
+		}
+	}
+	for i, t := range cfg.DeployTargets {
+		switch t.Format {
+		case deploy.FormatPEM:
+			if t.CertFile == "" && t.ChainFile == "" && t.FullChainFile == "" && t.KeyFile == "" {
+				invalid("deploy_targets[%d] needs at least one file", i)
+			}
+		case deploy.FormatCombined, deploy.FormatPKCS12, deploy.FormatJKS:
+			if t.Path == "" {
+				invalid("deploy_targets[%d] needs a path", i)
+			}
+			if t.Format == deploy.FormatJKS && t.PasswordFile == "" {
+				invalid("deploy_targets[%d] needs a password_file for jks", i)
+			}
+		default:
+			invalid("deploy_targets[%d] has unknown format %q", i, t.Format)
+		}
+	}
+	if b := cfg.Backup; b.Keep < 0 || b.MaxAgeDays < 0 {
+		invalid("backup.keep and backup.max_age_days must not be negative")
+	}
+	switch st := cfg.Storage; st.Backend {
+	case features.StorageFS:
+	case features.StorageBolt, features.StorageSQLite:
+		if st.Path == "" {
+			invalid("storage.path is required for the %s backend", st.Backend)
+		}
+	default:
+		invalid("storage.backend %q must be fs, bolt or sqlite", st.Backend)
+	}
+	if a := cfg.ACME; a.Enabled {
+		if len(a.Domains) == 0 {
+			invalid("acme.domains must list at least one name")
+		}
+		if (a.EABKeyID == "") != (a.EABHMACKeyFile == "") {
+			invalid("acme.eab_key_id and acme.eab_hmac_key_file must be set together")
+		}
+		if a.CheckInterval <= 0 || a.RenewBeforeDays <= 0 {
+			invalid("acme.check_interval and acme.renew_before_days must be positive")
+		}
+		switch d := a.DNS; d.Provider {
+		case features.DNSCloudflare:
+			if d.ZoneID == "" || d.APITokenFile == "" {
+				invalid("acme.dns cloudflare needs zone_id and api_token_file")
+			}
+		case features.DNSRoute53:
+			if d.HostedZoneID == "" {
+				invalid("acme.dns route53 needs hosted_zone_id")
+			}
+		case features.DNSRFC2136:
+			if d.Nameserver == "" || d.Zone == "" {
+				invalid("acme.dns rfc2136 needs nameserver and zone")
+			}
+		case features.DNSExec:
+			if len(d.Command) == 0 {
+				invalid("acme.dns exec needs a command")
+			}
+		default:
+			invalid("acme.dns.provider %q must be cloudflare, route53, rfc2136 or exec", d.Provider)
+		}
+	}
+	tenantNames := make(map[string]bool)
+	for i, tc := range cfg.Tenants {
+		switch {
+		case tc.Name == "":
+			invalid("tenants[%d] needs a name", i)
+		case tenantNames[tc.Name]:
+			invalid("tenants[%d] duplicates tenant %q", i, tc.Name)
+		}
+		tenantNames[tc.Name] = true
+		if len(tc.Certificates) == 0 {
+			invalid("tenants[%d] needs at least one certificate", i)
+		}
+		if len(tc.ServerNames) == 0 && tc.Listen == "" {
+			invalid("tenants[%d] needs server_names or a listen address", i)
+		}
+	}
+	if hb := cfg.Heartbeat; hb.Enabled && (hb.URL == "" || hb.Interval <= 0) {
+		invalid("heartbeat needs a url and a positive interval")
+	}
+	if sd := cfg.Statsd; sd.Enabled {
+		if sd.Format != "statsd" && sd.Format != "dogstatsd" {
+			invalid("statsd.format must be statsd or dogstatsd, got %q", sd.Format)
+		}
+		if _, _, err := net.SplitHostPort(sd.Address); err != nil || sd.Interval <= 0 {
+			invalid("statsd needs a host:port address and a positive interval")
+		}
+	}
+	if at := cfg.AdminTLS; at.Enabled && (at.CertFile == "") != (at.KeyFile == "") {
+		invalid("admin_tls needs both cert_file and key_file, or neither to serve the public certificate")
+	}
+	if aa := cfg.AdminAuth; aa.Enabled {
+		if len(aa.Tokens) == 0 && len(aa.Clients) == 0 {
+			invalid("admin_auth needs tokens or clients")
+		}
+		if len(aa.Clients) > 0 && (!cfg.AdminTLS.Enabled || cfg.AdminTLS.ClientCA == "") {
+			invalid("admin_auth.clients need admin_tls with a client_ca to verify certificates against")
+		}
+		for i, t := range aa.Tokens {
+			if t.Name == "" || t.TokenFile == "" {
+				invalid("admin_auth.tokens[%d] needs a name and token_file", i)
+			}
+			if t.Role != admin.RoleReader && t.Role != admin.RoleOperator {
+				invalid("admin_auth.tokens[%d] has unknown role %q", i, t.Role)
+			}
+		}
+		for i, c := range aa.Clients {
+			if c.Role != admin.RoleReader && c.Role != admin.RoleOperator {
+				invalid("admin_auth.clients[%d] has unknown role %q", i, c.Role)
+			}
+		}
+	}
+	if p := cfg.Probe; p.Enabled && p.URL != "" && p.Listen == "" {
+		invalid("probe.url requires probe.listen so that the URL can route to the green listener")
+	}
+	switch le := cfg.LeaderElection; le.Backend {
+	case "":
+	case leaderBackendKubernetes, leaderBackendFile:
+		if le.LeaseDuration <= 0 || le.RetryPeriod <= 0 || le.RetryPeriod >= le.LeaseDuration {
+			invalid("leader_election needs 0 < retry_period < lease_duration, got %d and %d", le.RetryPeriod, le.LeaseDuration)
+		}
+	default:
+		invalid("invalid leader_election.backend %q", le.Backend)
+	}
+	if _, err := buildSignals(cfg.Signals); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := buildHandler(cfg, &upstreamTrust{}); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
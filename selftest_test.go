@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"tls-agent/internal/features"
+)
+
+// TestValidateConfig tests that every invalid setting is reported
+func TestValidateConfig(t *testing.T) {
+	if err := validateConfig(features.DefaultFeatures()); err != nil {
+		t.Errorf("Default configuration should be valid: %v", err)
+	}
+
+	cfg := features.DefaultFeatures()
+	cfg.ShutdownTimeout = -1
+	cfg.TrustStore.ClientAuth = "require"
+	cfg.OCSP.MustStaple = "sometimes"
+	cfg.Signals.Shutdown = []string{"SIGHUP"}
+	cfg.LeaderElection.Backend = "zookeeper"
+	cfg.Distribution.Remote.URL = "https://certs.internal:9443"
+	cfg.Management.Enabled = true
+	cfg.Webhook.Enabled = true
+	cfg.Hooks = []features.HookConfig{{Name: "hup", Events: []string{"reloaded"}}}
+	cfg.DeployTargets = []features.DeployTargetConfig{{Format: "jks", Path: "keystore.jks"}, {Format: "der"}}
+	cfg.Probe = features.ProbeConfig{Enabled: true, URL: "https://green.example.com"}
+	cfg.Backup.Keep = -1
+	cfg.Tenants = []features.TenantConfig{{Name: "shop"}, {Name: "shop", Listen: ":9443"}}
+	cfg.Storage.Backend = "bolt"
+	cfg.ConnectionFilter.Deny = []string{"not-an-ip"}
+	cfg.HandshakeLimits.Overflow = "drop"
+	cfg.Heartbeat.Enabled = true
+	cfg.Proxy.TLS.Pins = []string{"sha1/abc"}
+	cfg.Statsd.Enabled = true
+	cfg.AdminAuth.Enabled = true
+	cfg.AdminAuth.Tokens = []features.AdminTokenConfig{{Name: "ci", TokenFile: "token", Role: "root"}}
+	cfg.AdminTLS.Enabled = true
+	cfg.KeyHygiene.ZeroizeDelay = -1
+	cfg.Chaos = features.ChaosConfig{Enabled: true, LoadFailureRate: 2}
+	cfg.KeyHygiene.AdminKeyExport = true
+	cfg.KeyHygiene.NoExport = true
+	cfg.KeyAge.MaxAge = 90
+	cfg.KeyAge.Action = "rotate"
+	cfg.AdminTLS.CertFile = "admin.crt"
+	cfg.Statsd.Format = "graphite"
+	cfg.DelegatedCredentials.Enabled = true
+	cfg.DelegatedCredentials.Validity = 200
+	cfg.ConnectionRotation.Mode = "sometimes"
+	cfg.ExpiredCertificate.Mode = "fail-open"
+	cfg.TLS.ALPN = []string{"h2"}
+	cfg.HTTP2.Enabled = false
+	cfg.AccessLog.SampleRate = 2
+	cfg.RequestID = features.RequestIDConfig{Enabled: true, Header: "X Request"}
+	cfg.TLS.ClientPolicies = []features.ClientPolicyConfig{{Name: "internal", ClientAuth: "require", Sources: []string{"10.0.0.0/33"}, CipherSuites: []string{"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256"}}}
+	cfg.FIPS.Enabled = true
+	cfg.ECH.Enabled = true
+	cfg.ACME = features.ACMEConfig{Enabled: true, EABKeyID: "kid", CheckInterval: 12, RenewBeforeDays: 30, DNS: features.ACMEDNSConfig{Provider: "route53"}}
+
+	err := validateConfig(cfg)
+	if err == nil {
+		t.Fatal("Expected validation errors")
+	}
+	for _, want := range []string{"shutdown_timeout", "ca_bundle", "must_staple", "SIGHUP", "leader_election", "distribution.remote", "management", "webhook", "probe.url", "hooks[0] needs a command", "unknown event \"reloaded\"", "deploy_targets[0] needs a password_file", "deploy_targets[1] has unknown format", "backup.keep", "tenants[0] needs server_names", "tenants[1] duplicates tenant", "storage.path", "acme.domains", "connection_filter", "handshake_limits.overflow", "heartbeat needs a url", "proxy.tls.pins", "statsd.format", "admin_auth.tokens[0] has unknown role", "admin_tls needs both", "key_hygiene.zeroize_delay", "admin_key_export conflicts", "chaos.load_failure_rate", "invalid key_age.action", "is not FIPS approved", "does not allow ech", "delegated_credentials.validity", "connection_rotation.mode", "expired_certificate.mode", "tls.alpn lists h2", "access_log.sample_rate", "request_id.header", "client_auth \"require\" needs a ca_bundle", "client_policies[0] sources", "acme.eab_key_id", "hosted_zone_id"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error mentioning %s, got: %v", want, err)
+		}
+	}
+}
+
+// TestValidateConfigKeyExportNeedsAuth tests that admin key export is
+// rejected without admin auth
+func TestValidateConfigKeyExportNeedsAuth(t *testing.T) {
+	cfg := features.DefaultFeatures()
+	cfg.KeyHygiene.AdminKeyExport = true
+	if err := validateConfig(cfg); err == nil || !strings.Contains(err.Error(), "admin_key_export needs admin_auth.enabled") {
+		t.Errorf("Expected admin_key_export without admin auth to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package main
+
+// startService is a no-op on platforms without a service manager API; see
+// service_windows.go
+func startService(stop func()) (finished func(), err error) {
+	return func() {}, nil
+}
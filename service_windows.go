@@ -0,0 +1,71 @@
+//go:build windows
+
+package main
+
+import (
+	"log"
+
+	"golang.org/x/sys/windows/svc"
+)
+
+// serviceName is the name the agent registers under with the service manager
+const serviceName = "tls-agent"
+
+// startService connects to the Windows service manager when the process was
+// started as a service. A stop or shutdown request from the manager calls
+// stop; the service is reported stopped once finished is called, after the
+// agent has shut down. Outside a service it does nothing.
+func startService(stop func()) (finished func(), err error) {
+	isService, err := svc.IsWindowsService()
+	if err != nil || !isService {
+		return func() {}, err
+	}
+
+	h := &serviceHandler{stop: stop, finished: make(chan struct{})}
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		if err := svc.Run(serviceName, h); err != nil {
+			log.Printf("Service: %v", err)
+			stop()
+		}
+	}()
+	log.Println("Running as a Windows service")
+
+	return func() {
+		close(h.finished)
+		<-exited
+	}, nil
+}
+
+// serviceHandler reports the agent's state to the service manager
+type serviceHandler struct {
+	stop     func()
+	finished chan struct{}
+}
+
+// Execute implements svc.Handler
+func (h *serviceHandler) Execute(_ []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	const accepted = svc.AcceptStop | svc.AcceptShutdown
+	status <- svc.Status{State: svc.Running, Accepts: accepted}
+
+	for {
+		select {
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				status <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				log.Println("Service: stop requested")
+				status <- svc.Status{State: svc.StopPending}
+				h.stop()
+				<-h.finished
+				return false, 0
+			}
+		case <-h.finished:
+			// The agent stopped on its own
+			status <- svc.Status{State: svc.StopPending}
+			return false, 0
+		}
+	}
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"tls-agent/internal/agent"
+	"tls-agent/internal/tlsstore"
+)
+
+// soakUsage describes the soak subcommand
+const soakUsage = `Usage:
+  tls-agent soak [--duration <d>] [--interval <d>] [--handshakes <n>] [--verbose]
+
+Rotates a test certificate every --interval (default 5s) for --duration
+(default 1h) under an in-process agent and TLS server, driving --handshakes
+(default 20) handshakes after each rotation, and reports dropped reloads,
+failed handshakes and growth in goroutines, open files and heap. It exits 1
+if any are found.
+`
+
+// Soak leak thresholds: growth beyond these between the first and the last
+// rotation counts as a leak
+const (
+	soakGoroutineSlack = 5
+	soakFDSlack        = 5
+	soakHeapSlack      = 8 << 20
+
+	// soakReloadTimeout is how long a rotation may take to be served
+	soakReloadTimeout = 5 * time.Second
+)
+
+// soakName is the server name of the test certificates
+const soakName = "soak.tls-agent.test"
+
+// soakOptions are the soak subcommand's flags
+type soakOptions struct {
+	duration   time.Duration
+	interval   time.Duration
+	handshakes int
+	verbose    bool
+}
+
+// soakReport is what a soak run found
+type soakReport struct {
+	rotations, served, dropped, failedReloads int
+	handshakes, failedHandshakes, stale       int
+
+	goroutines, fds [2]int
+	heap            [2]uint64
+}
+
+// problems lists what makes the run fail
+func (r *soakReport) problems() []string {
+	var out []string
+	if r.dropped > 0 {
+		out = append(out, fmt.Sprintf("%d rotations were never served", r.dropped))
+	}
+	if r.failedHandshakes > 0 {
+		out = append(out, fmt.Sprintf("%d handshakes failed", r.failedHandshakes))
+	}
+	if r.stale > 0 {
+		out = append(out, fmt.Sprintf("%d handshakes saw a replaced certificate", r.stale))
+	}
+	if r.goroutines[1] > r.goroutines[0]+soakGoroutineSlack {
+		out = append(out, fmt.Sprintf("goroutines grew from %d to %d", r.goroutines[0], r.goroutines[1]))
+	}
+	if r.fds[0] >= 0 && r.fds[1] > r.fds[0]+soakFDSlack {
+		out = append(out, fmt.Sprintf("open files grew from %d to %d", r.fds[0], r.fds[1]))
+	}
+	if r.heap[1] > 2*r.heap[0] && r.heap[1]-r.heap[0] > soakHeapSlack {
+		out = append(out, fmt.Sprintf("heap grew from %s to %s", mib(r.heap[0]), mib(r.heap[1])))
+	}
+	return out
+}
+
+// runSoak implements `tls-agent soak`. It returns the exit code.
+func runSoak(args []string, out io.Writer) int {
+	opts := soakOptions{duration: time.Hour, interval: 5 * time.Second, handshakes: 20}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--verbose" {
+			opts.verbose = true
+			continue
+		}
+		if i+1 >= len(args) {
+			fmt.Fprint(out, soakUsage)
+			return 2
+		}
+		i++
+		var err error
+		switch arg {
+		case "--duration":
+			opts.duration, err = time.ParseDuration(args[i])
+		case "--interval":
+			opts.interval, err = time.ParseDuration(args[i])
+		case "--handshakes":
+			opts.handshakes, err = strconv.Atoi(args[i])
+		default:
+			err = errors.New("unknown flag")
+		}
+		if err != nil || opts.duration <= 0 || opts.interval <= 0 || opts.handshakes < 0 {
+			fmt.Fprintf(out, "Invalid %s %q\n%s", arg, args[i], soakUsage)
+			return 2
+		}
+	}
+
+	report, err := soak(opts, out)
+	if err != nil {
+		fmt.Fprintf(out, "Soak failed: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(out, "Soak: %d rotations and %d handshakes over %s\n", report.rotations, report.handshakes, opts.duration)
+	fmt.Fprintf(out, "  reloads:     %d served, %d dropped, %d failed attempts\n", report.served, report.dropped, report.failedReloads)
+	fmt.Fprintf(out, "  handshakes:  %d ok, %d failed, %d stale\n", report.handshakes-report.failedHandshakes-report.stale, report.failedHandshakes, report.stale)
+	fmt.Fprintf(out, "  goroutines:  %d -> %d\n", report.goroutines[0], report.goroutines[1])
+	if report.fds[0] >= 0 {
+		fmt.Fprintf(out, "  open files:  %d -> %d\n", report.fds[0], report.fds[1])
+	}
+	fmt.Fprintf(out, "  heap:        %s -> %s\n", mib(report.heap[0]), mib(report.heap[1]))
+	if problems := report.problems(); len(problems) > 0 {
+		for _, p := range problems {
+			fmt.Fprintf(out, "FAIL: %s\n", p)
+		}
+		return 1
+	}
+	fmt.Fprintln(out, "PASS")
+	return 0
+}
+
+// soak runs the rotations and handshakes. The agent's and the store's log
+// lines are dropped unless opts.verbose.
+func soak(opts soakOptions, out io.Writer) (*soakReport, error) {
+	if !opts.verbose {
+		previous := log.Writer()
+		log.SetOutput(io.Discard)
+		defer log.SetOutput(previous)
+	}
+
+	dir, err := os.MkdirTemp("", "tls-agent-soak-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	ca, err := newSoakCA()
+	if err != nil {
+		return nil, err
+	}
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	leaf, err := ca.rotate(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tlsstore.Load(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	store := tlsstore.New(cert)
+	a := agent.New(store,
+		agent.WithPaths(certFile, keyFile),
+		agent.WithDebounce(100*time.Millisecond),
+		agent.WithLogger(log.New(log.Writer(), "", log.LstdFlags)),
+	)
+	if err := a.Start(); err != nil {
+		return nil, err
+	}
+	defer a.Stop(context.Background())
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	var conns sync.WaitGroup
+	tlsLn := tls.NewListener(ln, &tls.Config{GetCertificate: store.GetCertificate})
+	go func() {
+		for {
+			conn, err := tlsLn.Accept()
+			if err != nil {
+				return
+			}
+			conns.Add(1)
+			go func() {
+				defer conns.Done()
+				defer conn.Close()
+				_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+				_ = conn.(*tls.Conn).Handshake()
+			}()
+		}
+	}()
+	defer func() {
+		tlsLn.Close()
+		conns.Wait()
+	}()
+
+	client := &tls.Config{RootCAs: ca.pool, ServerName: soakName}
+	dialer := &tls.Dialer{NetDialer: &net.Dialer{Timeout: 5 * time.Second}, Config: client}
+
+	report := &soakReport{}
+	start := time.Now()
+	lastProgress := start
+	for time.Since(start) < opts.duration {
+		// Waiting first also lets the agent set up its watches
+		time.Sleep(opts.interval)
+		report.rotations++
+		if leaf, err = ca.rotate(certFile, keyFile); err != nil {
+			return nil, err
+		}
+
+		// Wait for the agent to serve the rotated certificate
+		deadline := time.Now().Add(soakReloadTimeout)
+		for !servesLeaf(store, leaf) && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if servesLeaf(store, leaf) {
+			report.served++
+		} else {
+			report.dropped++
+		}
+
+		for range opts.handshakes {
+			report.handshakes++
+			conn, err := dialer.Dial("tcp", ln.Addr().String())
+			if err != nil {
+				report.failedHandshakes++
+				continue
+			}
+			if state := conn.(*tls.Conn).ConnectionState(); !bytes.Equal(state.PeerCertificates[0].Raw, leaf.Raw) {
+				report.stale++
+			}
+			conn.Close()
+		}
+
+		// The first rotation warms up caches; measure from the end of it
+		if report.rotations == 1 {
+			report.goroutines[0], report.fds[0], report.heap[0] = soakSample(0)
+		}
+		if time.Since(lastProgress) >= time.Minute {
+			lastProgress = time.Now()
+			goroutines, fds, heap := soakSample(0)
+			fmt.Fprintf(out, "%s: %d rotations, %d dropped, %d failed handshakes; %d goroutines, %d open files, heap %s\n",
+				time.Since(start).Round(time.Second), report.rotations, report.dropped, report.failedHandshakes, goroutines, fds, mib(heap))
+		}
+	}
+
+	for _, e := range a.State().History() {
+		if e.Result != agent.ResultSuccess {
+			report.failedReloads++
+		}
+	}
+	report.goroutines[1], report.fds[1], report.heap[1] = soakSample(report.goroutines[0] + soakGoroutineSlack)
+	return report, nil
+}
+
+// soakSample returns the goroutine count, open files (-1 where unknown) and
+// live heap. Goroutines still finishing a handshake are given up to a second
+// to exit while the count is above settle.
+func soakSample(settle int) (goroutines, fds int, heap uint64) {
+	goroutines = runtime.NumGoroutine()
+	for i := 0; i < 20 && goroutines > settle && settle > 0; i++ {
+		time.Sleep(50 * time.Millisecond)
+		goroutines = runtime.NumGoroutine()
+	}
+	fds = -1
+	if entries, err := os.ReadDir("/proc/self/fd"); err == nil {
+		fds = len(entries)
+	}
+	runtime.GC()
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return goroutines, fds, m.HeapAlloc
+}
+
+// servesLeaf reports whether store serves leaf by default
+func servesLeaf(store *tlsstore.Store, leaf *x509.Certificate) bool {
+	cert, err := store.GetCertificate(&tls.ClientHelloInfo{ServerName: soakName})
+	return err == nil && bytes.Equal(cert.Certificate[0], leaf.Raw)
+}
+
+func mib(n uint64) string {
+	return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+}
+
+// soakCA issues the rotated test certificates
+type soakCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newSoakCA() (*soakCA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "tls-agent soak CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(30 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &soakCA{cert: cert, key: key, pool: pool}, nil
+}
+
+// rotate issues a leaf with a new key and replaces the pair atomically,
+// key first, returning the leaf
+func (ca *soakCA) rotate(certFile, keyFile string) (*x509.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: soakName},
+		DNSNames:     []string{soakName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		return nil, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := replaceFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})); err != nil {
+		return nil, err
+	}
+	if err := replaceFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})); err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
+
+// replaceFile writes data beside path and renames it over path
+func replaceFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
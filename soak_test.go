@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestRunSoak tests the soak subcommand's arguments and a short clean run
+func TestRunSoak(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		code int
+		want string
+	}{
+		{[]string{"--duration"}, 2, "Usage:"},
+		{[]string{"--duration", "forever"}, 2, `Invalid --duration "forever"`},
+		{[]string{"--interval", "0s"}, 2, `Invalid --interval "0s"`},
+		{[]string{"--rotations", "5"}, 2, `Invalid --rotations "5"`},
+		{[]string{"--duration", "1s", "--interval", "100ms", "--handshakes", "3"}, 0, "PASS"},
+	} {
+		var out strings.Builder
+		if code := runSoak(tc.args, &out); code != tc.code || !strings.Contains(out.String(), tc.want) {
+			t.Errorf("soak %v: expected exit code %d and %q, got %d:\n%s", tc.args, tc.code, tc.want, code, out.String())
+		}
+	}
+}
+
+// TestSoakReportProblems tests which findings fail a soak run
+func TestSoakReportProblems(t *testing.T) {
+	clean := soakReport{goroutines: [2]int{10, 12}, fds: [2]int{8, 9}, heap: [2]uint64{4 << 20, 6 << 20}}
+	if problems := clean.problems(); len(problems) != 0 {
+		t.Errorf("Expected a clean report, got %v", problems)
+	}
+
+	leaky := soakReport{dropped: 1, stale: 2, goroutines: [2]int{10, 40}, fds: [2]int{8, 30}, heap: [2]uint64{4 << 20, 64 << 20}}
+	problems := strings.Join(leaky.problems(), "\n")
+	for _, want := range []string{"never served", "replaced certificate", "goroutines grew", "open files grew", "heap grew"} {
+		if !strings.Contains(problems, want) {
+			t.Errorf("Expected %q in problems:\n%s", want, problems)
+		}
+	}
+
+	// Open files are not counted where /proc is missing
+	unknown := soakReport{fds: [2]int{-1, 50}}
+	if problems := unknown.problems(); len(problems) != 0 {
+		t.Errorf("Expected no problems without open file counts, got %v", problems)
+	}
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"time"
+
+	"tls-agent/internal/features"
+	"tls-agent/internal/statsd"
+)
+
+// buildStatsd returns an exporter pushing the default metrics registry
+func buildStatsd(cfg features.StatsdConfig) *statsd.Exporter {
+	return &statsd.Exporter{
+		Address:  cfg.Address,
+		Format:   cfg.Format,
+		Prefix:   cfg.Prefix,
+		Tags:     cfg.Tags,
+		Interval: time.Duration(cfg.Interval) * time.Second,
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"tls-agent/internal/agent"
+	"tls-agent/internal/features"
+	"tls-agent/internal/inventory"
+	"tls-agent/internal/watch"
+)
+
+// agentStatus is the document served at /status
+type agentStatus struct {
+	Version       string                  `json:"version"`
+	Commit        string                  `json:"commit,omitempty"`
+	BuildDate     string                  `json:"build_date,omitempty"`
+	Started       time.Time               `json:"started"`
+	UptimeSeconds int64                   `json:"uptime_seconds"`
+	Features      features.Features       `json:"features"`
+	Certificates  []inventory.Certificate `json:"certificates"`
+	LastReload    *agent.ReloadEvent      `json:"last_reload,omitempty"`
+	LastError     *agent.LastError        `json:"last_error,omitempty"`
+	Watcher       watcherStatus           `json:"watcher"`
+}
+
+// watcherStatus reports whether certificate changes are being picked up
+type watcherStatus struct {
+	Enabled bool `json:"enabled"`
+
+	// Healthy is false while the last error came from the watcher
+	Healthy bool     `json:"healthy"`
+	Paths   []string `json:"paths"`
+}
+
+// statusSource gathers the status of a running agent
+type statusSource struct {
+	started     time.Time
+	features    features.Features
+	agentConfig agent.Config
+	inventory   *inventory.Inventory
+	state       *agent.State
+	files       *watch.Watcher
+}
+
+// report returns the current status
+func (s *statusSource) report() agentStatus {
+	build := currentBuild()
+	status := agentStatus{
+		Version:       build.Version,
+		Commit:        build.Commit,
+		BuildDate:     build.BuildDate,
+		Started:       s.started,
+		UptimeSeconds: int64(time.Since(s.started).Seconds()),
+		Features:      features.Redact(s.features),
+		Certificates:  s.inventory.List(),
+		LastError:     s.state.GetLastError(),
+		Watcher:       watcherStatus{Enabled: s.features.CertificateWatcher, Paths: []string{}},
+	}
+	if history := s.state.History(); len(history) > 0 {
+		status.LastReload = &history[0]
+	}
+	if status.Watcher.Enabled {
+		status.Watcher.Healthy = status.LastError == nil || status.LastError.Source != agent.SourceWatcher
+		status.Watcher.Paths = append(status.Watcher.Paths, s.agentConfig.CertFile, s.agentConfig.KeyFile)
+		status.Watcher.Paths = append(status.Watcher.Paths, s.files.Paths()...)
+		slices.Sort(status.Watcher.Paths)
+		status.Watcher.Paths = slices.Compact(status.Watcher.Paths)
+	}
+	return status
+}
+
+// ServeHTTP serves the status as JSON
+func (s *statusSource) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(s.report())
+}
+
+// runStatus implements `tls-agent status`: it queries the running agent's
+// admin API and prints a summary followed by the reload history, or the raw
+// status document with --json. It returns the exit code.
+func runStatus(adminURL string, asJSON bool, out io.Writer) int {
+	client := adminClient(5 * time.Second)
+	var status agentStatus
+	if code := getJSON(client, adminURL, "/status", &status, out); code != 0 {
+		return code
+	}
+	if asJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(status)
+		return 0
+	}
+	printStatus(out, status)
+
+	var body struct {
+		Reloads []agent.ReloadEvent `json:"reloads"`
+	}
+	if code := getJSON(client, adminURL, "/reloads", &body, out); code != 0 {
+		return code
+	}
+	fmt.Fprintln(out)
+	printReloads(out, body.Reloads)
+	return 0
+}
+
+// getJSON decodes the admin API response for path into v, reporting
+// failures to out. It returns the exit code.
+func getJSON(client *http.Client, adminURL, path string, v any, out io.Writer) int {
+	resp, err := client.Get(adminURL + path)
+	if err != nil {
+		fmt.Fprintf(out, "Could not reach agent at %s: %v\n", adminURL, err)
+		return 1
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(out, "Querying %s failed: %s\n", path, resp.Status)
+		return 1
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		fmt.Fprintf(out, "Invalid response from agent: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// printStatus formats the status summary for humans
+func printStatus(out io.Writer, s agentStatus) {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Version:\t%s\n", s.Version)
+	if s.Commit != "" {
+		fmt.Fprintf(w, "Commit:\t%s\n", s.Commit)
+	}
+	fmt.Fprintf(w, "Uptime:\t%s (since %s)\n", time.Duration(s.UptimeSeconds)*time.Second, s.Started.Local().Format(time.RFC3339))
+
+	watcher := "disabled"
+	if s.Watcher.Enabled {
+		watcher = fmt.Sprintf("healthy, %d paths", len(s.Watcher.Paths))
+		if !s.Watcher.Healthy {
+			watcher = fmt.Sprintf("failing, %d paths", len(s.Watcher.Paths))
+		}
+	}
+	fmt.Fprintf(w, "Watcher:\t%s\n", watcher)
+
+	if r := s.LastReload; r != nil {
+		fmt.Fprintf(w, "Last reload:\t%s %s (%s)\n", r.Time.Local().Format(time.RFC3339), r.Result, r.Trigger)
+	} else {
+		fmt.Fprintf(w, "Last reload:\tnone\n")
+	}
+	if e := s.LastError; e != nil {
+		fmt.Fprintf(w, "Last error:\t%s %s: %s\n", e.Time.Local().Format(time.RFC3339), e.Source, e.Message)
+	} else {
+		fmt.Fprintf(w, "Last error:\tnone\n")
+	}
+	w.Flush()
+
+	fmt.Fprintln(out)
+	inventory.WriteTable(out, s.Certificates)
+}
+
+// printReloads formats reload events as a table, newest first
+func printReloads(out io.Writer, reloads []agent.ReloadEvent) {
+	if len(reloads) == 0 {
+		fmt.Fprintln(out, "No reloads recorded since startup")
+		return
+	}
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tTRIGGER\tRESULT\tOLD\tNEW\tERROR")
+	for _, r := range reloads {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			r.Time.Local().Format(time.RFC3339), r.Trigger, r.Result,
+			shortFingerprint(r.OldFingerprint), shortFingerprint(r.NewFingerprint), r.Error)
+	}
+	w.Flush()
+}
+
+func shortFingerprint(fp string) string {
+	if len(fp) > 12 {
+		return fp[:12]
+	}
+	return fp
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"tls-agent/internal/agent"
+	"tls-agent/internal/features"
+	"tls-agent/internal/inventory"
+	"tls-agent/internal/tlsstore"
+	"tls-agent/internal/watch"
+)
+
+// TestStatusCommand tests the status command against a fake admin API
+func TestStatusCommand(t *testing.T) {
+	admin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/status":
+			w.Write([]byte(`{"version":"1.2.3","started":"2024-01-02T03:00:00Z","uptime_seconds":3600,"certificates":[{"name":"default","sans":["www.example.com"]}],"last_error":{"source":"reload","message":"bad key","time":"2024-01-02T03:04:05Z"},"watcher":{"enabled":true,"healthy":true,"paths":["a","b"]}}`))
+		case "/reloads":
+			w.Write([]byte(`{"reloads":[{"time":"2024-01-02T03:04:05Z","trigger":"file_change","result":"failed","old_fingerprint":"0123456789abcdef","error":"bad key"}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer admin.Close()
+	address := admin.URL
+
+	var out bytes.Buffer
+	if code := runStatus(address, false, &out); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, out.String())
+	}
+	for _, want := range []string{"1.2.3", "1h0m0s", "healthy, 2 paths", "reload: bad key", "www.example.com", "TRIGGER", "file_change", "failed", "0123456789ab"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Output missing %q:\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	if code := runStatus(address, true, &out); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, out.String())
+	}
+	var body map[string]any
+	if err := json.Unmarshal(out.Bytes(), &body); err != nil || body["version"] != "1.2.3" {
+		t.Errorf("Expected JSON output, got %s (%v)", out.String(), err)
+	}
+
+	out.Reset()
+	if code := runStatus("http://127.0.0.1:1", false, &out); code == 0 {
+		t.Error("Expected non-zero exit code when the agent is unreachable")
+	}
+}
+
+// TestStatusHandler tests the /status document
+func TestStatusHandler(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestPair(t, dir, "server")
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Failed to load pair: %v", err)
+	}
+	files, err := watch.New(0)
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+	state := agent.NewState(&cert)
+	state.RecordReload(agent.ReloadEvent{Time: time.Now(), Trigger: agent.TriggerManual, Result: agent.ResultSuccess})
+	state.SetLastError(agent.SourceWatcher, errors.New("watch failed"))
+
+	cfg := features.DefaultFeatures()
+	cfg.CertificateWatcher = true
+	source := &statusSource{
+		started:     time.Now().Add(-time.Minute),
+		features:    cfg,
+		agentConfig: agent.Config{CertFile: certFile, KeyFile: keyFile},
+		inventory:   &inventory.Inventory{Store: tlsstore.New(&cert)},
+		state:       state,
+		files:       files,
+	}
+
+	rec := httptest.NewRecorder()
+	source.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	var status agentStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("Failed to decode status: %v", err)
+	}
+	if status.Version != version || status.UptimeSeconds < 60 {
+		t.Errorf("Unexpected version or uptime: %+v", status)
+	}
+	if !status.Features.CertificateWatcher || len(status.Certificates) != 1 {
+		t.Errorf("Expected the features and one certificate, got %+v", status)
+	}
+	if status.LastReload == nil || status.LastReload.Trigger != agent.TriggerManual {
+		t.Errorf("Expected the last reload, got %+v", status.LastReload)
+	}
+	if status.Watcher.Healthy || len(status.Watcher.Paths) != 2 {
+		t.Errorf("Expected an unhealthy watcher on two paths, got %+v", status.Watcher)
+	}
+
+	rec = httptest.NewRecorder()
+	source.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/status", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for POST, got %d", rec.Code)
+	}
+}
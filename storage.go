@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"tls-agent/internal/features"
+	"tls-agent/internal/storage"
+	"tls-agent/internal/storage/boltdb"
+	"tls-agent/internal/storage/sqlite"
+)
+
+// buildStorage opens the configured storage backend. It returns nil for the
+// fs backend without a path, in which case each cache keeps its own directory.
+func buildStorage(cfg features.StorageConfig) (storage.Storage, error) {
+	switch cfg.Backend {
+	case "", features.StorageFS:
+		if cfg.Path == "" {
+			return nil, nil
+		}
+		return &storage.FS{Dir: cfg.Path}, nil
+	case features.StorageBolt:
+		// Another agent holding the file is a configuration error, so do
+		// not wait long for the lock
+		db, err := boltdb.Open(cfg.Path, 5*time.Second)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	case features.StorageSQLite:
+		db, err := sqlite.Open(cfg.Path)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
+	}
+}
+
+// namespace returns s restricted to name, or nil when s is nil
+func namespace(s storage.Storage, name string) storage.Storage {
+	if s == nil {
+		return nil
+	}
+	return storage.Namespace(s, name)
+}
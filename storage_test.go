@@ -0,0 +1,44 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"tls-agent/internal/features"
+)
+
+// TestBuildStorage tests backend selection from the storage configuration
+func TestBuildStorage(t *testing.T) {
+	s, err := buildStorage(features.DefaultStorageConfig())
+	if err != nil || s != nil {
+		t.Fatalf("Expected no storage for the default configuration, got %v, %v", s, err)
+	}
+
+	dir := t.TempDir()
+	for _, cfg := range []features.StorageConfig{
+		{Backend: features.StorageFS, Path: filepath.Join(dir, "fs")},
+		{Backend: features.StorageBolt, Path: filepath.Join(dir, "state.db")},
+	} {
+		s, err := buildStorage(cfg)
+		if err != nil {
+			t.Fatalf("Failed to open %s storage: %v", cfg.Backend, err)
+		}
+		ocsp := namespace(s, "ocsp")
+		if err := ocsp.Put("key", []byte("value")); err != nil {
+			t.Errorf("Failed to write to %s storage: %v", cfg.Backend, err)
+		}
+		if keys, err := s.List(""); err != nil || len(keys) != 1 || keys[0] != "ocsp/key" {
+			t.Errorf("Expected namespaced key ocsp/key in %s storage, got %v, %v", cfg.Backend, keys, err)
+		}
+		if err := s.Close(); err != nil {
+			t.Errorf("Failed to close %s storage: %v", cfg.Backend, err)
+		}
+	}
+
+	if _, err := buildStorage(features.StorageConfig{Backend: "etcd"}); err == nil {
+		t.Error("Expected an error for an unknown backend")
+	}
+	if namespace(nil, "ocsp") != nil {
+		t.Error("Expected no namespace without storage")
+	}
+}
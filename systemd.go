@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"sort"
+	"time"
+
+	"tls-agent/internal/lifecycle"
+	"tls-agent/internal/systemd"
+)
+
+// Names of the sockets the agent accepts from systemd socket activation
+// (FileDescriptorName= in the .socket unit)
+const (
+	socketHTTPS = "https"
+	socketAdmin = "admin"
+)
+
+// activatedListeners holds the sockets passed by systemd until the servers
+// claim them
+type activatedListeners map[string]net.Listener
+
+// take returns and removes the socket called name. A single socket without
+// a recognized name is used for the public listener.
+func (a activatedListeners) take(name string) (net.Listener, bool) {
+	if ln, ok := a[name]; ok {
+		delete(a, name)
+		return ln, true
+	}
+	if name == socketHTTPS && len(a) == 1 {
+		for other, ln := range a {
+			if other != socketAdmin {
+				delete(a, other)
+				return ln, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// closeUnused closes sockets no server claimed
+func (a activatedListeners) closeUnused() {
+	names := make([]string, 0, len(a))
+	for name := range a {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		log.Printf("Warning: ignoring activated socket %q", name)
+		a[name].Close()
+		delete(a, name)
+	}
+}
+
+// notifySystemd reports state to systemd, logging failures
+func notifySystemd(state string) {
+	if err := systemd.Notify(state); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+}
+
+// superviseSystemd reports readiness once the runner has started and, when
+// the agent loop is not running to do it, pings the watchdog
+func superviseSystemd(runner *lifecycle.Runner, watchdog time.Duration, agentPings bool) {
+	runner.Go("systemd", func(ctx context.Context) error {
+		notifySystemd(systemd.Ready)
+		if watchdog <= 0 || agentPings {
+			<-ctx.Done()
+			return nil
+		}
+
+		ticker := time.NewTicker(watchdog / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				notifySystemd(systemd.Watchdog)
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	})
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+// TestActivatedListenersTake tests matching activated sockets to servers
+func TestActivatedListenersTake(t *testing.T) {
+	https, admin := &net.TCPListener{}, &net.TCPListener{}
+
+	named := activatedListeners{socketHTTPS: https, socketAdmin: admin}
+	if ln, ok := named.take(socketAdmin); !ok || ln != admin {
+		t.Errorf("Expected the admin socket, got %v", ln)
+	}
+	if ln, ok := named.take(socketHTTPS); !ok || ln != https {
+		t.Errorf("Expected the https socket, got %v", ln)
+	}
+	if _, ok := named.take(socketHTTPS); ok {
+		t.Error("Expected a socket to be taken only once")
+	}
+
+	// A single socket without a known name serves the public listener only
+	single := activatedListeners{"tls-agent.socket": https}
+	if _, ok := single.take(socketAdmin); ok {
+		t.Error("Expected an unnamed socket not to be used for the admin server")
+	}
+	if ln, ok := single.take(socketHTTPS); !ok || ln != https {
+		t.Errorf("Expected the unnamed socket for the public listener, got %v", ln)
+	}
+}
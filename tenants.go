@@ -0,0 +1,129 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"tls-agent/internal/features"
+	"tls-agent/internal/lifecycle"
+	"tls-agent/internal/signals"
+	"tls-agent/internal/stapling"
+	"tls-agent/internal/tenant"
+	"tls-agent/internal/tlsconfig"
+	"tls-agent/internal/tlsstore"
+	"tls-agent/internal/watch"
+)
+
+// buildTenants loads the configured tenants. A tenant's certificates are
+// refused if they violate its policy; the global policy is left to load.
+func buildTenants(cfg []features.TenantConfig, load func(certFile, keyFile string) (*tls.Certificate, error), workers int) (*tenant.Set, error) {
+	tenants := make([]*tenant.Tenant, len(cfg))
+	for i, tc := range cfg {
+		t := &tenant.Tenant{Name: tc.Name, ServerNames: tc.ServerNames, Store: &tlsstore.Store{}}
+		if tc.TokenFile != "" {
+			token, err := os.ReadFile(tc.TokenFile)
+			if err != nil {
+				return nil, fmt.Errorf("tenant %s: %w", tc.Name, err)
+			}
+			t.Token = strings.TrimSpace(string(token))
+		}
+
+		tenantLoad := load
+		if certPolicy := buildPolicy(tc.Policy, false); !certPolicy.IsZero() {
+			tenantLoad = policyLoad(certPolicy, load)
+		}
+
+		pairs := make([]tlsstore.Pair, len(tc.Certificates))
+		for j, c := range tc.Certificates {
+			pairs[j] = tlsstore.Pair{CertFile: c.CertFile, KeyFile: c.KeyFile, Names: c.Names}
+		}
+		var mu sync.Mutex
+		t.Reload = func() error {
+			mu.Lock()
+			defer mu.Unlock()
+			return loadTenant(t, pairs, tenantLoad, workers)
+		}
+		if err := t.Reload(); err != nil {
+			return nil, fmt.Errorf("tenant %s: %w", tc.Name, err)
+		}
+		tenants[i] = t
+	}
+	return tenant.NewSet(tenants...)
+}
+
+// loadTenant loads every pair of t and serves them only if all loaded, so a
+// tenant never serves a mix of old and new certificates because of a
+// failure. The first pair also becomes the tenant's default certificate.
+func loadTenant(t *tenant.Tenant, pairs []tlsstore.Pair, load func(certFile, keyFile string) (*tls.Certificate, error), workers int) error {
+	report := tlsstore.LoadPairs(pairs, load, workers)
+	if err := report.Err(); err != nil {
+		return err
+	}
+	for i, res := range report.Results {
+		if i == 0 {
+			t.Store.Update(res.Cert)
+		}
+		t.Store.SetSNIFrom(res.CertFile, res.Cert, res.Names...)
+	}
+	log.Printf("Tenant %s: loaded %d certificate pairs", t.Name, len(pairs))
+	return nil
+}
+
+// watchTenants reloads a tenant when any of its files change or a
+// certificate reload is signalled. A failed reload keeps the tenant's
+// previous certificates.
+func watchTenants(files *watch.Watcher, registry *signals.Registry, tenants *tenant.Set, cfg []features.TenantConfig) error {
+	for i, t := range tenants.Tenants() {
+		reload := func() {
+			if err := t.Reload(); err != nil {
+				log.Printf("Tenant %s: reload failed: %v", t.Name, err)
+			}
+		}
+		var paths []string
+		for _, c := range cfg[i].Certificates {
+			paths = append(paths, c.CertFile, c.KeyFile)
+			if c.ChainFile != "" {
+				paths = append(paths, c.ChainFile)
+			}
+		}
+		if err := files.Add("tenant "+t.Name, reload, paths...); err != nil {
+			return err
+		}
+		registry.Subscribe(signals.ActionReloadCerts, reload)
+	}
+	return nil
+}
+
+// serveTenants starts the dedicated listeners of tenants that have one.
+// They share the public listener's TLS settings and handler but only ever
+// serve the tenant's certificates, and negotiate key exchanges of their own
+// where configured, inheriting the rest from listenerTLS.
+func serveTenants(tenants *tenant.Set, cfg []features.TenantConfig, base *tls.Config, listenerTLS features.ListenerTLSConfig, fips bool, handler http.Handler, stapler *stapling.Manager, opts listenerOptions, runner *lifecycle.Runner) error {
+	for i, t := range tenants.Tenants() {
+		if cfg[i].Listen == "" {
+			continue
+		}
+		listener := "tenant:" + t.Name
+		tlsCfg := base.Clone()
+		curves, postQuantum := listenerTLS.KeyExchange(cfg[i].CurvePreferences, cfg[i].PostQuantum)
+		if err := tlsconfig.ApplyCurves(tlsCfg, listener, curves, postQuantum); err != nil {
+			return err
+		}
+		if fips {
+			tlsconfig.ApplyFIPS(tlsCfg)
+		}
+		tlsCfg.GetCertificate = t.Store.GetCertificate
+		if stapler != nil {
+			tlsCfg.GetCertificate = stapler.GetCertificate(t.Store.GetCertificate)
+		}
+		server := &http.Server{Addr: cfg[i].Listen, Handler: handler, TLSConfig: tlsCfg}
+		runner.AddServer("tenant "+t.Name+" server", server, opts.serve(server, nil, listener))
+		log.Printf("Tenant %s: listening on %s", t.Name, cfg[i].Listen)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tls-agent/internal/features"
+	"tls-agent/internal/lifecycle"
+	"tls-agent/internal/policy"
+	"tls-agent/internal/tlsconfig"
+	"tls-agent/internal/tlsstore"
+	"tls-agent/pkg/agenttest"
+)
+
+// writeTestPair writes a certificate for name and its key into dir. The
+// shared certs/ files are rewritten by other tests.
+func writeTestPair(t *testing.T, dir, name string) (certFile, keyFile string) {
+	certPEM, keyPEM, _ := agenttest.NewCA(t).Issue(t, name)
+	certFile, keyFile = filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certFile, certPEM, 0644); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	return certFile, keyFile
+}
+
+// TestBuildTenants tests loading, reloading and policy enforcement per tenant
+func TestBuildTenants(t *testing.T) {
+	dir := t.TempDir()
+	shopCert, shopKey := writeTestPair(t, dir, "shop.example.com")
+	tokenFile := filepath.Join(dir, "token")
+	os.WriteFile(tokenFile, []byte("s3cret\n"), 0600)
+
+	cfg := []features.TenantConfig{{
+		Name:         "shop",
+		ServerNames:  []string{"shop.example.com"},
+		Certificates: []features.CertificatePair{{CertFile: shopCert, KeyFile: shopKey}},
+		TokenFile:    tokenFile,
+	}}
+	tenants, err := buildTenants(cfg, tlsstore.Load, 1)
+	if err != nil {
+		t.Fatalf("Failed to build tenants: %v", err)
+	}
+	shop, err := tenants.Get("shop")
+	if err != nil {
+		t.Fatalf("Failed to get tenant: %v", err)
+	}
+	if shop.Token != "s3cret" {
+		t.Errorf("Expected the token from the file, got %q", shop.Token)
+	}
+
+	get := tenants.GetCertificate(func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return nil, nil })
+	first, _ := get(&tls.ClientHelloInfo{ServerName: "shop.example.com"})
+	if first == nil {
+		t.Fatal("Expected the tenant's certificate")
+	}
+
+	writeTestPair(t, dir, "shop.example.com")
+	if err := shop.Reload(); err != nil {
+		t.Fatalf("Failed to reload: %v", err)
+	}
+	if second, _ := get(&tls.ClientHelloInfo{ServerName: "shop.example.com"}); second == first {
+		t.Error("Expected the reload to serve the new certificate")
+	}
+
+	cfg[0].Policy.RequiredIssuer = "Corporate CA"
+	if _, err := buildTenants(cfg, tlsstore.Load, 1); err == nil {
+		t.Error("Expected the tenant policy to refuse the certificate")
+	}
+
+	cfg[0].Policy.RequiredIssuer = ""
+	global := policyLoad(policy.Policy{RequiredSANs: []string{"www.example.com"}}, tlsstore.Load)
+	if _, err := buildTenants(cfg, global, 1); err == nil {
+		t.Error("Expected the global policy to refuse the certificate")
+	}
+}
+
+// TestServeTenantsKeyExchange tests that a tenant listener negotiates key
+// exchanges under its own settings rather than the public listener's
+func TestServeTenantsKeyExchange(t *testing.T) {
+	dir := t.TempDir()
+	shopCert, shopKey := writeTestPair(t, dir, "shop.example.com")
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	classical := false
+	cfg := []features.TenantConfig{{
+		Name:         "shop",
+		Listen:       addr,
+		Certificates: []features.CertificatePair{{CertFile: shopCert, KeyFile: shopKey}},
+		PostQuantum:  &classical,
+	}}
+	tenants, err := buildTenants(cfg, tlsstore.Load, 1)
+	if err != nil {
+		t.Fatalf("Failed to build tenants: %v", err)
+	}
+
+	public := features.DefaultListenerTLSConfig()
+	base := &tls.Config{MinVersion: tls.VersionTLS12}
+	if err := tlsconfig.ApplyCurves(base, "public", public.CurvePreferences, public.PostQuantum); err != nil {
+		t.Fatalf("ApplyCurves failed: %v", err)
+	}
+	runner := &lifecycle.Runner{}
+	handler := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	if err := serveTenants(tenants, cfg, base, public, false, handler, nil, listenerOptions{}, runner); err != nil {
+		t.Fatalf("serveTenants failed: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runner.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	client := &tls.Config{InsecureSkipVerify: true, CurvePreferences: []tls.CurveID{tls.X25519MLKEM768, tls.X25519}}
+	var conn *tls.Conn
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if conn, err = tls.Dial("tcp", addr, client); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatalf("Failed to dial the tenant listener: %v", err)
+	}
+	defer conn.Close()
+	if curve := conn.ConnectionState().CurveID; tlsconfig.IsPostQuantum(curve) {
+		t.Errorf("Expected the tenant's classical key exchange, got %v", curve)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"time"
+
+	"tls-agent/internal/features"
+	"tls-agent/internal/tlsconfig"
+	"tls-agent/internal/tlsstore"
+	"tls-agent/internal/watch"
+)
+
+// upstreamTrust builds the TLS settings of outbound clients: the reverse
+// proxy, the remote distribution source, keyless key servers, the alert
+// webhook and heartbeats.
+// Some are built before the file watcher exists, so their CA bundles are
+// held until watch is called and registered directly afterwards.
+type upstreamTrust struct {
+	files   *watch.Watcher
+	pending []*tlsstore.RootCAStore
+}
+
+// tlsConfig returns a client config built on base (nil for defaults) that
+// verifies servers against cfg's CA bundle and pins
+func (u *upstreamTrust) tlsConfig(cfg features.UpstreamTLSConfig, base *tls.Config) (*tls.Config, error) {
+	pins, err := tlsconfig.ParsePins(cfg.Pins)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.CABundle == "" {
+		var c *tls.Config
+		if base != nil {
+			c = base.Clone()
+		} else {
+			c = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		if len(pins) > 0 {
+			c.VerifyConnection = pins.VerifyConnection
+		}
+		return c, nil
+	}
+
+	roots, err := tlsstore.NewRootCAStore(cfg.CABundle)
+	if err != nil {
+		return nil, err
+	}
+	if len(pins) > 0 {
+		roots.SetChainCheck(pins.CheckChain)
+	}
+	if err := u.register(roots); err != nil {
+		return nil, err
+	}
+	return roots.ClientConfig(base), nil
+}
+
+// transport returns an HTTP transport whose TLS settings come from cfg and
+// base. With a CA bundle it is rebuilt on every bundle reload, dropping idle
+// connections verified against the previous CAs.
+func (u *upstreamTrust) transport(cfg features.UpstreamTLSConfig, base *tls.Config) (http.RoundTripper, error) {
+	if cfg.CABundle == "" {
+		tlsCfg, err := u.tlsConfig(cfg, base)
+		if err != nil {
+			return nil, err
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsCfg
+		return transport, nil
+	}
+
+	pins, err := tlsconfig.ParsePins(cfg.Pins)
+	if err != nil {
+		return nil, err
+	}
+	roots, err := tlsstore.NewRootCAStore(cfg.CABundle)
+	if err != nil {
+		return nil, err
+	}
+	if len(pins) > 0 {
+		roots.SetChainCheck(pins.CheckChain)
+	}
+	if err := u.register(roots); err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = base
+	return tlsstore.NewTransport(roots, transport), nil
+}
+
+// client returns an HTTP client using transport, or nil when cfg is empty so
+// that callers keep their default client
+func (u *upstreamTrust) client(cfg features.UpstreamTLSConfig, timeout time.Duration) (*http.Client, error) {
+	if cfg.CABundle == "" && len(cfg.Pins) == 0 {
+		return nil, nil
+	}
+	transport, err := u.transport(cfg, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: transport, Timeout: timeout}, nil
+}
+
+// watch reloads the collected CA bundles, and those of clients built later,
+// when their files change
+func (u *upstreamTrust) watch(files *watch.Watcher) error {
+	u.files = files
+	pending := u.pending
+	u.pending = nil
+	for _, roots := range pending {
+		if err := u.register(roots); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u *upstreamTrust) register(roots *tlsstore.RootCAStore) error {
+	if u.files == nil {
+		u.pending = append(u.pending, roots)
+		return nil
+	}
+	return roots.Register(u.files, nil)
+}
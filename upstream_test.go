@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"tls-agent/internal/features"
+	"tls-agent/internal/tlsconfig"
+	"tls-agent/internal/watch"
+)
+
+// TestUpstreamTrust tests that outbound connections are verified against a
+// reloaded CA bundle and pins
+func TestUpstreamTrust(t *testing.T) {
+	dir := t.TempDir()
+	servedCert, servedKey := writeTestPair(t, dir, "upstream.test")
+	otherCert, otherKey := writeTestPair(t, dir, "other.test")
+
+	pair, err := tls.LoadX509KeyPair(servedCert, servedKey)
+	if err != nil {
+		t.Fatalf("Failed to load pair: %v", err)
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{pair}})
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_ = conn.(*tls.Conn).Handshake()
+				conn.Close()
+			}()
+		}
+	}()
+
+	dial := func(cfg *tls.Config) error {
+		cfg = cfg.Clone()
+		cfg.ServerName = "upstream.test"
+		conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 5 * time.Second}, "tcp", ln.Addr().String(), cfg)
+		if err == nil {
+			conn.Close()
+		}
+		return err
+	}
+
+	// The bundle starts out trusting another server and is swapped while
+	// the watcher runs
+	bundle := dir + "/bundle.pem"
+	copyFile(t, otherCert, bundle)
+
+	files, err := watch.New(0)
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = files.Run(ctx.Done()) }()
+
+	trust := &upstreamTrust{}
+	cfg, err := trust.tlsConfig(features.UpstreamTLSConfig{CABundle: bundle}, nil)
+	if err != nil {
+		t.Fatalf("tlsConfig failed: %v", err)
+	}
+	if err := trust.watch(files); err != nil {
+		t.Fatalf("watch failed: %v", err)
+	}
+	if err := dial(cfg); err == nil {
+		t.Fatal("Expected the untrusted upstream to be rejected")
+	}
+
+	copyFile(t, servedCert, bundle)
+	deadline := time.Now().Add(5 * time.Second)
+	for dial(cfg) != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("Reloaded bundle was not used")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	other, err := tls.LoadX509KeyPair(otherCert, otherKey)
+	if err != nil {
+		t.Fatalf("Failed to load pair: %v", err)
+	}
+	served, otherLeaf := pair.Leaf, other.Leaf
+	pinned, err := trust.tlsConfig(features.UpstreamTLSConfig{CABundle: bundle, Pins: []string{tlsconfig.SPKIPin(served)}}, nil)
+	if err != nil {
+		t.Fatalf("tlsConfig failed: %v", err)
+	}
+	if err := dial(pinned); err != nil {
+		t.Errorf("Pinned upstream rejected: %v", err)
+	}
+
+	mispinned, err := trust.tlsConfig(features.UpstreamTLSConfig{CABundle: bundle, Pins: []string{tlsconfig.SPKIPin(otherLeaf)}}, nil)
+	if err != nil {
+		t.Fatalf("tlsConfig failed: %v", err)
+	}
+	if err := dial(mispinned); !errors.Is(err, tlsconfig.ErrPinMismatch) {
+		t.Errorf("Expected ErrPinMismatch, got %v", err)
+	}
+
+	if _, err := trust.tlsConfig(features.UpstreamTLSConfig{Pins: []string{"md5/abc"}}, nil); err == nil {
+		t.Error("Expected an error for an invalid pin")
+	}
+}
+
+func copyFile(t *testing.T, src, dst string) {
+	t.Helper()
+	data, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", src, err)
+	}
+	if err := os.WriteFile(dst, data, 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", dst, err)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+
+	"tls-agent/internal/metrics"
+)
+
+// Build information, set at link time:
+//
+//	go build -ldflags "-X main.version=1.4.0 -X main.commitSHA=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Builds without them fall back to the VCS stamp the go tool embeds.
+var (
+	version   = "dev"
+	commitSHA = ""
+	buildDate = ""
+)
+
+var buildInfoMetric = metrics.NewGaugeVec("tls_agent_build_info",
+	"Always 1, labelled with the agent's version, commit, build date and Go version", "version", "commit", "build_date", "go_version")
+
+// buildInfo identifies the running binary
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"build_date,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+// currentBuild returns the build information of this binary
+func currentBuild() buildInfo {
+	b := buildInfo{Version: version, Commit: commitSHA, BuildDate: buildDate, GoVersion: runtime.Version()}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			switch {
+			case s.Key == "vcs.revision" && b.Commit == "":
+				b.Commit = s.Value
+			case s.Key == "vcs.time" && b.BuildDate == "":
+				b.BuildDate = s.Value
+			}
+		}
+	}
+	return b
+}
+
+// registerBuildInfo publishes the build information as a metric
+func registerBuildInfo() {
+	b := currentBuild()
+	buildInfoMetric.With(b.Version, b.Commit, b.BuildDate, b.GoVersion).Set(1)
+}
+
+// printVersion implements --version
+func printVersion(out io.Writer) {
+	b := currentBuild()
+	fmt.Fprintf(out, "tls-agent %s\n", b.Version)
+	if b.Commit != "" {
+		fmt.Fprintf(out, "  commit:     %s\n", b.Commit)
+	}
+	if b.BuildDate != "" {
+		fmt.Fprintf(out, "  built:      %s\n", b.BuildDate)
+	}
+	fmt.Fprintf(out, "  go version: %s\n", b.GoVersion)
+}
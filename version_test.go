@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"tls-agent/internal/metrics"
+)
+
+// TestBuildInfo tests the version output and the build_info metric
+func TestBuildInfo(t *testing.T) {
+	defer func(v, c, d string) { version, commitSHA, buildDate = v, c, d }(version, commitSHA, buildDate)
+	version, commitSHA, buildDate = "1.4.0", "0123abcd", "2026-01-02T03:04:05Z"
+
+	var out bytes.Buffer
+	printVersion(&out)
+	for _, want := range []string{"tls-agent 1.4.0", "0123abcd", "2026-01-02T03:04:05Z", "go version: go"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Output missing %q:\n%s", want, out.String())
+		}
+	}
+
+	registerBuildInfo()
+	found := false
+	for _, s := range metrics.Gather() {
+		if s.Name == "tls_agent_build_info" && s.Labels[0].Value == "1.4.0" && s.Labels[1].Value == "0123abcd" && s.Value == 1 {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("Expected a tls_agent_build_info series for the version")
+	}
+}
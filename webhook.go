@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"tls-agent/internal/features"
+	"tls-agent/internal/kube"
+	"tls-agent/internal/lifecycle"
+	"tls-agent/internal/tlsstore"
+	"tls-agent/internal/watch"
+	"tls-agent/internal/webhook"
+)
+
+// webhookRetryInterval spaces attempts to publish the initial CA bundle
+const webhookRetryInterval = 30 * time.Second
+
+// setupWebhook publishes the CA bundle for the serving certificate at
+// startup and whenever the CA file changes. The returned publisher must
+// receive reload events to republish after certificate rotations.
+func setupWebhook(cfg features.WebhookConfig, store *tlsstore.Store, files *watch.Watcher, runner *lifecycle.Runner) (*webhook.Publisher, error) {
+	publisher := &webhook.Publisher{
+		Bundle:         func() ([]byte, error) { return webhook.ChainBundle(store.Chain()) },
+		File:           cfg.CABundleFile,
+		Configurations: webhookConfigurations(cfg),
+	}
+	if cfg.CAFile != "" {
+		publisher.Bundle = webhook.FileBundle(cfg.CAFile)
+	}
+	if len(publisher.Configurations) > 0 {
+		client, err := kube.InCluster()
+		if err != nil {
+			return nil, fmt.Errorf("webhook: %w", err)
+		}
+		publisher.Client = client
+	}
+
+	publish := func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		return publisher.Publish(ctx)
+	}
+	if cfg.CAFile != "" {
+		err := files.Add("webhook CA", func() {
+			if err := publish(context.Background()); err != nil {
+				log.Println("Webhook:", err)
+			}
+		}, cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("webhook: %w", err)
+		}
+	}
+
+	// The API server may not be reachable yet, or the configurations may be
+	// installed after the agent, so the first publication is retried
+	runner.Go("webhook CA bundle", func(ctx context.Context) error {
+		for {
+			err := publish(ctx)
+			if err == nil {
+				return nil
+			}
+			log.Println("Webhook:", err)
+			select {
+			case <-time.After(webhookRetryInterval):
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	})
+	return publisher, nil
+}
+
+// webhookConfigurations lists the webhook configurations to patch
+func webhookConfigurations(cfg features.WebhookConfig) []webhook.Configuration {
+	var configs []webhook.Configuration
+	for _, name := range cfg.MutatingConfigurations {
+		configs = append(configs, webhook.Configuration{Kind: kube.WebhookMutating, Name: name, Webhooks: cfg.Webhooks})
+	}
+	for _, name := range cfg.ValidatingConfigurations {
+		configs = append(configs, webhook.Configuration{Kind: kube.WebhookValidating, Name: name, Webhooks: cfg.Webhooks})
+	}
+	return configs
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"tls-agent/internal/features"
+	"tls-agent/internal/kube"
+	"tls-agent/internal/lifecycle"
+	"tls-agent/internal/tlsstore"
+	"tls-agent/internal/watch"
+	"tls-agent/pkg/agenttest"
+)
+
+// TestSetupWebhook tests that the CA bundle of a self-signed serving
+// certificate is written to the configured file
+func TestSetupWebhook(t *testing.T) {
+	// The shared certs/ files are rewritten by other tests
+	cert := agenttest.SelfSigned(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "webhook.default.svc"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}, nil)
+	files, err := watch.New(0)
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "ca-bundle.pem")
+	cfg := features.WebhookConfig{Enabled: true, CABundleFile: path}
+	publisher, err := setupWebhook(cfg, tlsstore.New(cert), files, &lifecycle.Runner{})
+	if err != nil {
+		t.Fatalf("Failed to set up webhook: %v", err)
+	}
+	if err := publisher.Publish(context.Background()); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read bundle: %v", err)
+	}
+	if block, _ := pem.Decode(data); block == nil || string(block.Bytes) != string(cert.Certificate[0]) {
+		t.Error("Expected the self-signed certificate as the CA bundle")
+	}
+}
+
+// TestWebhookConfigurations tests the conversion of configured names
+func TestWebhookConfigurations(t *testing.T) {
+	configs := webhookConfigurations(features.WebhookConfig{
+		MutatingConfigurations:   []string{"injector"},
+		ValidatingConfigurations: []string{"policy"},
+		Webhooks:                 []string{"inject.example.com"},
+	})
+	if len(configs) != 2 || configs[0].Kind != kube.WebhookMutating || configs[1].Kind != kube.WebhookValidating ||
+		configs[1].Name != "policy" || configs[0].Webhooks[0] != "inject.example.com" {
+		t.Errorf("Unexpected configurations %+v", configs)
+	}
+}